@@ -0,0 +1,148 @@
+package addons
+
+import (
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/UKHomeOffice/keto-k8/pkg/constants"
+	"github.com/UKHomeOffice/keto-k8/pkg/k8client"
+	"github.com/UKHomeOffice/keto-k8/pkg/placement"
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+	"github.com/UKHomeOffice/keto-k8/pkg/rbac"
+	"github.com/UKHomeOffice/keto-k8/pkg/render"
+	"github.com/UKHomeOffice/keto-k8/pkg/secprofile"
+)
+
+// Config is the cluster configuration used when rendering addons
+type Config struct {
+	CloudProvider       string
+	KubeVersion         string
+	ClusterName         string
+	DefaultStorageClass bool
+	StorageClassParams  map[string]string
+	PodSecurityPolicy   bool
+	// Values for each addon template, by addon name
+	Values map[string]map[string]interface{}
+	// Enabled are the optional addons to deploy
+	Enabled []string
+	// Client applies and prunes the addons (kubectl when nil)
+	Client k8client.Clienter
+}
+
+// IsEnabled will return true if an optional addon has been enabled
+func (c Config) IsEnabled(name string) bool {
+	for _, enabled := range c.Enabled {
+		if enabled == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Addon is a set of resources keto-k8 deploys to a cluster
+type Addon struct {
+	Name string
+	// Render returns the resources to deploy (an empty string when not required for a config)
+	Render func(cfg Config) (string, error)
+}
+
+// Registered - the addons to deploy (in order)
+var Registered []Addon
+
+// Register - will add an addon to be deployed
+func Register(addon Addon) {
+	for _, a := range Registered {
+		if a.Name == addon.Name {
+			log.Errorf("Addon %s already registered. Ignoring.", addon.Name)
+			return
+		}
+	}
+	Registered = append(Registered, addon)
+}
+
+// Rendered are the resources of an addon with all keto changes (labels, security profiles and placement)
+type Rendered struct {
+	Name      string
+	Resources string
+	objs      []podspec.Object
+}
+
+// Render will return the resources of all the addons required for a config (in order) without deploying anything
+func Render(cfg Config) ([]Rendered, error) {
+	rendered := []Rendered{}
+	securityProfiles := secprofile.Mutator(cfg.KubeVersion)
+	for _, addon := range Registered {
+		resources, err := addon.Render(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if len(resources) == 0 {
+			log.Printf("Addon %q not required", addon.Name)
+			continue
+		}
+		objs, err := podspec.Decode(resources)
+		if err != nil {
+			return nil, err
+		}
+		place, err := placement.For(cfg.Values[addon.Name])
+		if err != nil {
+			return nil, fmt.Errorf("addon %q: %v", addon.Name, err)
+		}
+		for _, o := range objs {
+			o.SetLabel(constants.ManagedByLabel, constants.ManagedByValue)
+			o.SetLabel(constants.AddonLabel, addon.Name)
+			if err = securityProfiles(o); err != nil {
+				return nil, err
+			}
+			if err = place.Mutator()(o); err != nil {
+				return nil, err
+			}
+		}
+		if resources, err = podspec.Encode(objs); err != nil {
+			return nil, err
+		}
+		rendered = append(rendered, Rendered{Name: addon.Name, Resources: resources, objs: objs})
+	}
+	return rendered, nil
+}
+
+// Deploy will render and apply all registered addons and remove any obsolete addon resources
+func Deploy(cfg Config) error {
+	rendered, err := Render(cfg)
+	if err != nil {
+		return err
+	}
+	client := k8client.Or(cfg.Client)
+	current := deployed{}
+	for _, addon := range rendered {
+		if err = rbac.Save(addon.Name, addon.objs); err != nil {
+			return err
+		}
+		log.Printf("Deploying addon %q", addon.Name)
+		if err = client.Apply(addon.Resources); err != nil {
+			return err
+		}
+		current.add(addon.objs)
+	}
+	return prune(client, current)
+}
+
+// renderTemplate will render an addon template with the values configured for that addon
+// Addon data is available as {{ .Data }} and values as {{ .Values }}
+func renderTemplate(name, addonTemplate string, cfg Config, data interface{}) (string, error) {
+	return render.Template(name, addonTemplate, struct {
+		Data   interface{}
+		Values map[string]interface{}
+	}{
+		Data:   data,
+		Values: cfg.Values[name],
+	})
+}
+
+func init() {
+	Register(Addon{Name: storageClassAddon, Render: renderStorageClass})
+	Register(Addon{Name: ingressAddon, Render: renderIngress})
+	Register(Addon{Name: nvidiaAddon, Render: renderNvidia})
+	Register(Addon{Name: npdAddon, Render: renderNpd})
+	Register(Addon{Name: CertManagerAddon, Render: renderCertManager})
+}
@@ -0,0 +1,207 @@
+package addons
+
+import "fmt"
+
+// CertManagerAddon is the name of the cert-manager addon (the CA ClusterIssuer is created by the primary master)
+const CertManagerAddon = "cert-manager"
+
+// certManagerSecretNamespaces are where cert-manager can manage secrets by default, its own namespace (for the cluster
+// issuers) and kube-system (for the migrated keto-k8 secrets)
+var certManagerSecretNamespaces = []string{"cert-manager", "kube-system"}
+
+// certManagerYaml runs the cert-manager controller, cluster issuers use secrets in its namespace
+// The custom resource definitions aren't pruned when the addon is disabled (that would delete all the certificates)
+// Secrets are only granted in the namespaces it manages (see the namespaces value), never cluster wide
+const certManagerYaml = `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: cert-manager
+---
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: certificates.certmanager.k8s.io
+spec:
+  group: certmanager.k8s.io
+  version: v1alpha1
+  scope: Namespaced
+  names:
+    kind: Certificate
+    plural: certificates
+    shortNames: ["cert", "certs"]
+---
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: issuers.certmanager.k8s.io
+spec:
+  group: certmanager.k8s.io
+  version: v1alpha1
+  scope: Namespaced
+  names:
+    kind: Issuer
+    plural: issuers
+---
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: clusterissuers.certmanager.k8s.io
+spec:
+  group: certmanager.k8s.io
+  version: v1alpha1
+  scope: Cluster
+  names:
+    kind: ClusterIssuer
+    plural: clusterissuers
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: cert-manager
+  namespace: cert-manager
+---
+apiVersion: rbac.authorization.k8s.io/v1beta1
+kind: ClusterRole
+metadata:
+  name: keto:cert-manager
+rules:
+- apiGroups: ["certmanager.k8s.io"]
+  resources: ["certificates", "issuers", "clusterissuers"]
+  verbs: ["get", "list", "watch", "create", "update", "patch"]
+- apiGroups: [""]
+  resources: ["events"]
+  verbs: ["create", "patch"]
+- apiGroups: [""]
+  resources: ["services", "pods"]
+  verbs: ["get", "list", "watch", "create", "delete"]
+- apiGroups: ["extensions"]
+  resources: ["ingresses"]
+  verbs: ["get", "list", "watch", "create", "update", "delete"]
+---
+apiVersion: rbac.authorization.k8s.io/v1beta1
+kind: ClusterRoleBinding
+metadata:
+  name: keto:cert-manager
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: keto:cert-manager
+subjects:
+- kind: ServiceAccount
+  name: cert-manager
+  namespace: cert-manager
+---
+apiVersion: rbac.authorization.k8s.io/v1beta1
+kind: Role
+metadata:
+  name: keto:cert-manager-leader-election
+  namespace: cert-manager
+rules:
+- apiGroups: [""]
+  resources: ["configmaps", "endpoints"]
+  verbs: ["get", "create", "update"]
+---
+apiVersion: rbac.authorization.k8s.io/v1beta1
+kind: RoleBinding
+metadata:
+  name: keto:cert-manager-leader-election
+  namespace: cert-manager
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: keto:cert-manager-leader-election
+subjects:
+- kind: ServiceAccount
+  name: cert-manager
+  namespace: cert-manager
+{{- range .Data.Namespaces }}
+---
+apiVersion: rbac.authorization.k8s.io/v1beta1
+kind: Role
+metadata:
+  name: keto:cert-manager-secrets
+  namespace: {{ . }}
+rules:
+- apiGroups: [""]
+  resources: ["secrets"]
+  verbs: ["get", "list", "watch", "create", "update", "patch", "delete"]
+---
+apiVersion: rbac.authorization.k8s.io/v1beta1
+kind: RoleBinding
+metadata:
+  name: keto:cert-manager-secrets
+  namespace: {{ . }}
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: keto:cert-manager-secrets
+subjects:
+- kind: ServiceAccount
+  name: cert-manager
+  namespace: cert-manager
+{{- end }}
+---
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: cert-manager
+  namespace: cert-manager
+spec:
+  replicas: 1
+  template:
+    metadata:
+      labels:
+        name: cert-manager
+    spec:
+      serviceAccountName: cert-manager
+      containers:
+      - name: cert-manager
+        image: {{ default "quay.io/jetstack/cert-manager-controller:v0.2.4" .Values.image }}
+        args:
+        - --cluster-resource-namespace=$(POD_NAMESPACE)
+        - --leader-election-namespace=$(POD_NAMESPACE)
+        env:
+        - name: POD_NAMESPACE
+          valueFrom:
+            fieldRef:
+              fieldPath: metadata.namespace
+        securityContext:
+          allowPrivilegeEscalation: false
+        resources:
+{{- if .Values.resources }}
+{{ toYaml .Values.resources | indent 10 }}
+{{- else }}
+          limits:
+            cpu: 100m
+            memory: 128Mi
+          requests:
+            cpu: 10m
+            memory: 32Mi
+{{- end }}
+`
+
+// renderCertManager will render cert-manager when enabled
+func renderCertManager(cfg Config) (string, error) {
+	if !cfg.IsEnabled(CertManagerAddon) {
+		return "", nil
+	}
+	names := append([]string{}, certManagerSecretNamespaces...)
+	extra, _ := cfg.Values[CertManagerAddon]["namespaces"].([]interface{})
+	for _, ns := range extra {
+		name, ok := ns.(string)
+		if !ok || len(name) == 0 {
+			return "", fmt.Errorf("invalid %s namespace %v", CertManagerAddon, ns)
+		}
+		names = append(names, name)
+	}
+	data := struct{ Namespaces []string }{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			data.Namespaces = append(data.Namespaces, name)
+		}
+	}
+	return renderTemplate(CertManagerAddon, certManagerYaml, cfg, data)
+}
@@ -0,0 +1,54 @@
+package addons
+
+import (
+	"testing"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+	"github.com/UKHomeOffice/keto-k8/pkg/rbac"
+)
+
+func TestRenderCertManagerRbac(t *testing.T) {
+	cfg := Config{
+		Enabled: []string{CertManagerAddon},
+		Values:  map[string]map[string]interface{}{CertManagerAddon: {"namespaces": []interface{}{"ingress", "kube-system"}}},
+	}
+	resources, err := renderCertManager(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs, err := podspec.Decode(resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rbac.Audit(CertManagerAddon, objs); err != nil {
+		t.Errorf("expected the cert-manager rbac to pass the audit but got %v", err)
+	}
+
+	secretRoles := map[string]bool{}
+	for _, o := range objs {
+		if o.Kind() != "Role" && o.Kind() != "ClusterRole" {
+			continue
+		}
+		rules, _ := o["rules"].([]interface{})
+		for _, r := range rules {
+			resources, _ := r.(map[string]interface{})["resources"].([]interface{})
+			for _, resource := range resources {
+				if resource != "secrets" {
+					continue
+				}
+				if o.Kind() == "ClusterRole" {
+					t.Errorf("expected no cluster wide access to secrets but got %v", o)
+				}
+				secretRoles[o.Namespace()] = true
+			}
+		}
+	}
+	if len(secretRoles) != 3 || !secretRoles["cert-manager"] || !secretRoles["kube-system"] || !secretRoles["ingress"] {
+		t.Errorf("expected secrets only in the managed namespaces but got %v", secretRoles)
+	}
+
+	cfg.Values[CertManagerAddon]["namespaces"] = []interface{}{""}
+	if _, err := renderCertManager(cfg); err == nil {
+		t.Error("expected an error for an empty namespace")
+	}
+}
@@ -0,0 +1,276 @@
+package addons
+
+import (
+	"fmt"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/psp"
+)
+
+const (
+	ingressAddon = "ingress-nginx"
+
+	ingressModeHostNetwork = "hostNetwork"
+	ingressModeNodePort    = "nodePort"
+)
+
+const ingressYaml = `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: ingress-nginx
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: nginx-ingress
+  namespace: ingress-nginx
+---
+apiVersion: rbac.authorization.k8s.io/v1beta1
+kind: ClusterRole
+metadata:
+  name: nginx-ingress
+rules:
+- apiGroups: [""]
+  resources: ["configmaps", "endpoints", "nodes", "pods", "secrets"]
+  verbs: ["list", "watch"]
+- apiGroups: [""]
+  resources: ["nodes"]
+  verbs: ["get"]
+- apiGroups: [""]
+  resources: ["services"]
+  verbs: ["get", "list", "watch"]
+- apiGroups: ["extensions"]
+  resources: ["ingresses"]
+  verbs: ["get", "list", "watch"]
+- apiGroups: [""]
+  resources: ["events"]
+  verbs: ["create", "patch"]
+- apiGroups: ["extensions"]
+  resources: ["ingresses/status"]
+  verbs: ["update"]
+---
+apiVersion: rbac.authorization.k8s.io/v1beta1
+kind: Role
+metadata:
+  name: nginx-ingress
+  namespace: ingress-nginx
+rules:
+- apiGroups: [""]
+  resources: ["configmaps", "pods", "secrets", "namespaces"]
+  verbs: ["get"]
+- apiGroups: [""]
+  resources: ["configmaps"]
+  resourceNames: ["ingress-controller-leader-nginx"]
+  verbs: ["get", "update"]
+- apiGroups: [""]
+  resources: ["configmaps"]
+  verbs: ["create"]
+- apiGroups: [""]
+  resources: ["endpoints"]
+  verbs: ["get", "create", "update"]
+---
+apiVersion: rbac.authorization.k8s.io/v1beta1
+kind: ClusterRoleBinding
+metadata:
+  name: nginx-ingress
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: nginx-ingress
+subjects:
+- kind: ServiceAccount
+  name: nginx-ingress
+  namespace: ingress-nginx
+---
+apiVersion: rbac.authorization.k8s.io/v1beta1
+kind: RoleBinding
+metadata:
+  name: nginx-ingress
+  namespace: ingress-nginx
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: nginx-ingress
+subjects:
+- kind: ServiceAccount
+  name: nginx-ingress
+  namespace: ingress-nginx
+---
+{{- if .Data.PrivilegedPolicy }}
+# nginx runs as root to bind ports 80 and 443 (as well as host ports in hostNetwork mode) so can't run with the
+# restricted policy in either mode
+apiVersion: rbac.authorization.k8s.io/v1beta1
+kind: RoleBinding
+metadata:
+  name: nginx-ingress-psp
+  namespace: ingress-nginx
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: {{ .Data.PrivilegedPolicy }}
+subjects:
+- kind: ServiceAccount
+  name: nginx-ingress
+  namespace: ingress-nginx
+---
+{{- end }}
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: nginx-configuration
+  namespace: ingress-nginx
+---
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: default-http-backend
+  namespace: ingress-nginx
+spec:
+  replicas: 1
+  template:
+    metadata:
+      labels:
+        app: default-http-backend
+    spec:
+      # The default backend never talks to the API
+      automountServiceAccountToken: false
+      terminationGracePeriodSeconds: 60
+      containers:
+      - name: default-http-backend
+        image: {{ default "gcr.io/google_containers/defaultbackend:1.3" .Values.defaultBackendImage }}
+        livenessProbe:
+          httpGet:
+            path: /healthz
+            port: 8080
+            scheme: HTTP
+          initialDelaySeconds: 30
+          timeoutSeconds: 5
+        ports:
+        - containerPort: 8080
+        resources:
+          limits:
+            cpu: 10m
+            memory: 20Mi
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: default-http-backend
+  namespace: ingress-nginx
+spec:
+  ports:
+  - port: 80
+    targetPort: 8080
+  selector:
+    app: default-http-backend
+---
+apiVersion: extensions/v1beta1
+{{- if eq .Data.Mode "hostNetwork" }}
+kind: DaemonSet
+{{- else }}
+kind: Deployment
+{{- end }}
+metadata:
+  name: nginx-ingress-controller
+  namespace: ingress-nginx
+spec:
+{{- if ne .Data.Mode "hostNetwork" }}
+  replicas: {{ default 2 .Values.replicas }}
+{{- end }}
+  template:
+    metadata:
+      labels:
+        app: nginx-ingress-controller
+    spec:
+      serviceAccountName: nginx-ingress
+{{- if eq .Data.Mode "hostNetwork" }}
+      hostNetwork: true
+{{- end }}
+{{- if .Values.nodeSelector }}
+      nodeSelector:
+{{ toYaml .Values.nodeSelector | indent 8 }}
+{{- end }}
+      containers:
+      - name: nginx-ingress-controller
+        image: {{ default "gcr.io/google_containers/nginx-ingress-controller:0.9.0-beta.11" .Values.image }}
+        args:
+        - /nginx-ingress-controller
+        - --default-backend-service=ingress-nginx/default-http-backend
+        - --configmap=ingress-nginx/nginx-configuration
+        env:
+        - name: POD_NAME
+          valueFrom:
+            fieldRef:
+              fieldPath: metadata.name
+        - name: POD_NAMESPACE
+          valueFrom:
+            fieldRef:
+              fieldPath: metadata.namespace
+        ports:
+        - name: http
+          containerPort: 80
+        - name: https
+          containerPort: 443
+        livenessProbe:
+          httpGet:
+            path: /healthz
+            port: 10254
+            scheme: HTTP
+          initialDelaySeconds: 10
+          timeoutSeconds: 1
+        readinessProbe:
+          httpGet:
+            path: /healthz
+            port: 10254
+            scheme: HTTP
+{{- if .Values.resources }}
+        resources:
+{{ toYaml .Values.resources | indent 10 }}
+{{- end }}
+{{- if ne .Data.Mode "hostNetwork" }}
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: ingress-nginx
+  namespace: ingress-nginx
+spec:
+  type: NodePort
+  ports:
+  - name: http
+    port: 80
+    targetPort: 80
+    nodePort: {{ default 30080 .Values.httpNodePort }}
+  - name: https
+    port: 443
+    targetPort: 443
+    nodePort: {{ default 30443 .Values.httpsNodePort }}
+  selector:
+    app: nginx-ingress-controller
+{{- end }}
+`
+
+// renderIngress will create an nginx ingress controller (when enabled)
+// Set the value "mode" to "hostNetwork" (default) or "nodePort"
+func renderIngress(cfg Config) (string, error) {
+	if !cfg.IsEnabled(ingressAddon) {
+		return "", nil
+	}
+	data := struct {
+		Mode             string
+		PrivilegedPolicy string
+	}{
+		Mode: ingressModeHostNetwork,
+	}
+	if mode, ok := cfg.Values[ingressAddon]["mode"].(string); ok && len(mode) > 0 {
+		data.Mode = mode
+	}
+	if data.Mode != ingressModeHostNetwork && data.Mode != ingressModeNodePort {
+		return "", fmt.Errorf("invalid %s mode %q, must be one of: %s, %s",
+			ingressAddon, data.Mode, ingressModeHostNetwork, ingressModeNodePort)
+	}
+	if cfg.PodSecurityPolicy {
+		data.PrivilegedPolicy = psp.ClusterRoleName(psp.Privileged)
+	}
+	return renderTemplate(ingressAddon, ingressYaml, cfg, data)
+}
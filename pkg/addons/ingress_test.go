@@ -0,0 +1,102 @@
+package addons
+
+import (
+	"testing"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+	"github.com/UKHomeOffice/keto-k8/pkg/psp"
+)
+
+// renderedIngress returns the ingress resources by kind/name
+func renderedIngress(t *testing.T, cfg Config) map[string]podspec.Object {
+	resources, err := renderIngress(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs, err := podspec.Decode(resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]podspec.Object{}
+	for _, o := range objs {
+		byName[o.Kind()+"/"+o.Name()] = o
+	}
+	return byName
+}
+
+func TestRenderIngressHostNetwork(t *testing.T) {
+	if resources, err := renderIngress(Config{}); err != nil || resources != "" {
+		t.Errorf("expected no ingress unless enabled but got %q, %v", resources, err)
+	}
+
+	cfg := Config{Enabled: []string{ingressAddon}, PodSecurityPolicy: true}
+	objs := renderedIngress(t, cfg)
+	controller, ok := objs["DaemonSet/nginx-ingress-controller"]
+	if !ok {
+		t.Fatalf("expected a controller on every node by default but got %v", objs)
+	}
+	if controller.PodSpec()["hostNetwork"] != true {
+		t.Errorf("expected the controller on the host network but got %v", controller.PodSpec())
+	}
+	if _, ok := objs["Service/ingress-nginx"]; ok {
+		t.Error("expected no node port service on the host network")
+	}
+	binding, ok := objs["RoleBinding/nginx-ingress-psp"]
+	if !ok {
+		t.Fatal("expected the controller to be bound to the privileged policy")
+	}
+	if roleRef, _ := binding["roleRef"].(map[string]interface{}); roleRef["name"] != psp.ClusterRoleName(psp.Privileged) {
+		t.Errorf("unexpected policy %v", binding["roleRef"])
+	}
+
+	cfg.PodSecurityPolicy = false
+	if _, ok := renderedIngress(t, cfg)["RoleBinding/nginx-ingress-psp"]; ok {
+		t.Error("expected no policy binding without pod security policies")
+	}
+}
+
+func TestRenderIngressNodePort(t *testing.T) {
+	cfg := Config{
+		Enabled:           []string{ingressAddon},
+		PodSecurityPolicy: true,
+		Values:            map[string]map[string]interface{}{ingressAddon: {"mode": "nodePort", "httpsNodePort": 31443}},
+	}
+	objs := renderedIngress(t, cfg)
+	controller, ok := objs["Deployment/nginx-ingress-controller"]
+	if !ok {
+		t.Fatalf("expected a controller deployment but got %v", objs)
+	}
+	if spec, _ := controller["spec"].(map[string]interface{}); spec["replicas"] != float64(2) {
+		t.Errorf("expected the default replicas but got %v", spec["replicas"])
+	}
+	if _, ok := controller.PodSpec()["hostNetwork"]; ok {
+		t.Error("expected the controller off the host network")
+	}
+	// nginx still runs as root off the host network, which the restricted policy doesn't allow
+	binding, ok := objs["RoleBinding/nginx-ingress-psp"]
+	if !ok {
+		t.Fatal("expected the controller to be bound to the privileged policy off the host network")
+	}
+	if roleRef, _ := binding["roleRef"].(map[string]interface{}); roleRef["name"] != psp.ClusterRoleName(psp.Privileged) {
+		t.Errorf("unexpected policy %v", binding["roleRef"])
+	}
+	service, ok := objs["Service/ingress-nginx"]
+	if !ok {
+		t.Fatal("expected a node port service")
+	}
+	spec, _ := service["spec"].(map[string]interface{})
+	ports, _ := spec["ports"].([]interface{})
+	nodePorts := map[interface{}]interface{}{}
+	for _, p := range ports {
+		port, _ := p.(map[string]interface{})
+		nodePorts[port["name"]] = port["nodePort"]
+	}
+	if spec["type"] != "NodePort" || nodePorts["http"] != float64(30080) || nodePorts["https"] != float64(31443) {
+		t.Errorf("expected the default http and set https node ports but got %v", spec)
+	}
+
+	cfg.Values[ingressAddon]["mode"] = "loadBalancer"
+	if _, err := renderIngress(cfg); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
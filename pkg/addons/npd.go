@@ -0,0 +1,226 @@
+package addons
+
+import (
+	"github.com/UKHomeOffice/keto-k8/pkg/psp"
+)
+
+const npdAddon = "node-problem-detector"
+
+// npdYaml runs node-problem-detector on every node with the kernel monitor and keto custom plugin monitors for the
+// kubelet, CNI and the disks the kubelet and container runtime use (each sets a node condition)
+const npdYaml = `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: node-problem-detector
+  namespace: kube-system
+---
+apiVersion: rbac.authorization.k8s.io/v1beta1
+kind: ClusterRole
+metadata:
+  name: keto:node-problem-detector
+rules:
+- apiGroups: [""]
+  resources: ["nodes"]
+  verbs: ["get"]
+- apiGroups: [""]
+  resources: ["nodes/status"]
+  verbs: ["patch"]
+- apiGroups: [""]
+  resources: ["events"]
+  verbs: ["create", "patch", "update"]
+---
+apiVersion: rbac.authorization.k8s.io/v1beta1
+kind: ClusterRoleBinding
+metadata:
+  name: keto:node-problem-detector
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: keto:node-problem-detector
+subjects:
+- kind: ServiceAccount
+  name: node-problem-detector
+  namespace: kube-system
+---
+{{- if .Data.PrivilegedPolicy }}
+# The detector reads the host logs and checks the kubelet on the host network so can't run with the restricted policy
+apiVersion: rbac.authorization.k8s.io/v1beta1
+kind: RoleBinding
+metadata:
+  name: node-problem-detector-psp
+  namespace: kube-system
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: {{ .Data.PrivilegedPolicy }}
+subjects:
+- kind: ServiceAccount
+  name: node-problem-detector
+  namespace: kube-system
+---
+{{- end }}
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: node-problem-detector-config
+  namespace: kube-system
+data:
+  kernel-monitor.json: |
+    {
+      "plugin": "journald",
+      "pluginConfig": {"source": "kernel"},
+      "logPath": "/var/log/journal",
+      "lookback": "5m",
+      "bufferSize": 10,
+      "source": "kernel-monitor",
+      "conditions": [
+        {"type": "KernelDeadlock", "reason": "KernelHasNoDeadlock", "message": "kernel has no deadlock"}
+      ],
+      "rules": [
+        {"type": "temporary", "reason": "OOMKilling", "pattern": "Killed process \\d+ (.+) total-vm:\\d+kB, anon-rss:\\d+kB, file-rss:\\d+kB.*"},
+        {"type": "temporary", "reason": "TaskHung", "pattern": "task \\S+:\\w+ blocked for more than \\w+ seconds\\."},
+        {"type": "permanent", "condition": "KernelDeadlock", "reason": "DockerHung", "pattern": "task docker:\\w+ blocked for more than \\w+ seconds\\."}
+      ]
+    }
+  keto-monitor.json: |
+    {
+      "plugin": "custom",
+      "pluginConfig": {"invoke_interval": "{{ default "30s" .Values.interval }}", "timeout": "10s", "max_output_length": 80, "concurrency": 3},
+      "source": "keto-monitor",
+      "conditions": [
+        {"type": "KubeletUnhealthy", "reason": "KubeletIsHealthy", "message": "kubelet is healthy"},
+        {"type": "CNIUnhealthy", "reason": "CNIIsConfigured", "message": "a CNI network is configured"},
+        {"type": "KetoDiskPressure", "reason": "KetoDiskHasSpace", "message": "the kubelet and container runtime disks have space"}
+      ],
+      "rules": [
+        {"type": "permanent", "condition": "KubeletUnhealthy", "reason": "KubeletHealthCheckFailed", "path": "/config/check-kubelet.sh", "timeout": "5s"},
+        {"type": "permanent", "condition": "CNIUnhealthy", "reason": "CNINotConfigured", "path": "/config/check-cni.sh", "timeout": "5s"},
+        {"type": "permanent", "condition": "KetoDiskPressure", "reason": "KetoDiskFull", "path": "/config/check-disk.sh", "timeout": "5s"}
+      ]
+    }
+  check-kubelet.sh: |
+    #!/bin/bash
+    # The kubelet healthz port only listens on localhost (the image has no http client)
+    status=$(bash -c 'exec 3<>/dev/tcp/127.0.0.1/10248 && printf "GET /healthz HTTP/1.0\r\n\r\n" >&3 && head -1 <&3' 2>/dev/null)
+    if [[ "${status}" != *" 200 "* ]]; then
+      echo "kubelet healthz failed"
+      exit 1
+    fi
+    echo "kubelet is healthy"
+  check-cni.sh: |
+    #!/bin/bash
+    if ! ls /host/etc/cni/net.d/*.conf /host/etc/cni/net.d/*.conflist >/dev/null 2>&1; then
+      echo "no CNI config in /etc/cni/net.d"
+      exit 1
+    fi
+    echo "a CNI network is configured"
+  check-disk.sh: |
+    #!/bin/bash
+    for dir in /host/var/lib/kubelet /host/var/lib/docker; do
+      used=$(df --output=pcent "${dir}" | tail -1 | tr -dc '0-9')
+      if [ "${used}" -ge {{ default 90 .Values.diskThreshold }} ]; then
+        echo "${dir#/host} is ${used}% full"
+        exit 1
+      fi
+    done
+    echo "the kubelet and container runtime disks have space"
+---
+apiVersion: extensions/v1beta1
+kind: DaemonSet
+metadata:
+  name: node-problem-detector
+  namespace: kube-system
+spec:
+  updateStrategy:
+    type: RollingUpdate
+  template:
+    metadata:
+      labels:
+        name: node-problem-detector
+    spec:
+      serviceAccountName: node-problem-detector
+      hostNetwork: true
+{{- if .Values.nodeSelector }}
+      nodeSelector:
+{{ toYaml .Values.nodeSelector | indent 8 }}
+{{- end }}
+      tolerations:
+      - operator: Exists
+        effect: NoSchedule
+      - key: CriticalAddonsOnly
+        operator: Exists
+      containers:
+      - name: node-problem-detector
+        image: {{ default "gcr.io/google_containers/node-problem-detector:v0.6.2" .Values.image }}
+        command:
+        - /node-problem-detector
+        - --logtostderr
+        - --system-log-monitors=/config/kernel-monitor.json
+        - --custom-plugin-monitors=/config/keto-monitor.json
+        env:
+        - name: NODE_NAME
+          valueFrom:
+            fieldRef:
+              fieldPath: spec.nodeName
+        securityContext:
+          allowPrivilegeEscalation: false
+        resources:
+{{- if .Values.resources }}
+{{ toYaml .Values.resources | indent 10 }}
+{{- else }}
+          limits:
+            cpu: 50m
+            memory: 80Mi
+          requests:
+            cpu: 20m
+            memory: 20Mi
+{{- end }}
+        volumeMounts:
+        - name: config
+          mountPath: /config
+          readOnly: true
+        - name: log
+          mountPath: /var/log
+          readOnly: true
+        - name: cni
+          mountPath: /host/etc/cni/net.d
+          readOnly: true
+        - name: kubelet
+          mountPath: /host/var/lib/kubelet
+          readOnly: true
+        - name: docker
+          mountPath: /host/var/lib/docker
+          readOnly: true
+      volumes:
+      - name: config
+        configMap:
+          name: node-problem-detector-config
+          defaultMode: 0755
+      - name: log
+        hostPath:
+          path: /var/log
+      - name: cni
+        hostPath:
+          path: /etc/cni/net.d
+      - name: kubelet
+        hostPath:
+          path: /var/lib/kubelet
+      - name: docker
+        hostPath:
+          path: /var/lib/docker
+`
+
+// renderNpd will render node-problem-detector when enabled
+func renderNpd(cfg Config) (string, error) {
+	if !cfg.IsEnabled(npdAddon) {
+		return "", nil
+	}
+	data := struct {
+		PrivilegedPolicy string
+	}{}
+	if cfg.PodSecurityPolicy {
+		data.PrivilegedPolicy = psp.ClusterRoleName(psp.Privileged)
+	}
+	return renderTemplate(npdAddon, npdYaml, cfg, data)
+}
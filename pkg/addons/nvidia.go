@@ -0,0 +1,98 @@
+package addons
+
+import (
+	"github.com/UKHomeOffice/keto-k8/pkg/constants"
+	"github.com/UKHomeOffice/keto-k8/pkg/psp"
+)
+
+const nvidiaAddon = "nvidia-device-plugin"
+
+const nvidiaYaml = `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: nvidia-device-plugin
+  namespace: kube-system
+---
+{{- if .Data.PrivilegedPolicy }}
+# The device plugin registers with the kubelet through a host path so can't run with the restricted policy
+apiVersion: rbac.authorization.k8s.io/v1beta1
+kind: RoleBinding
+metadata:
+  name: nvidia-device-plugin-psp
+  namespace: kube-system
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: {{ .Data.PrivilegedPolicy }}
+subjects:
+- kind: ServiceAccount
+  name: nvidia-device-plugin
+  namespace: kube-system
+---
+{{- end }}
+apiVersion: extensions/v1beta1
+kind: DaemonSet
+metadata:
+  name: nvidia-device-plugin
+  namespace: kube-system
+spec:
+  updateStrategy:
+    type: RollingUpdate
+  template:
+    metadata:
+      labels:
+        name: nvidia-device-plugin
+      annotations:
+        scheduler.alpha.kubernetes.io/critical-pod: ""
+    spec:
+      serviceAccountName: nvidia-device-plugin
+      nodeSelector:
+        {{ .Data.Label }}: nvidia
+{{- if .Values.nodeSelector }}
+{{ toYaml .Values.nodeSelector | indent 8 }}
+{{- end }}
+      tolerations:
+      - key: {{ .Data.Taint }}
+        operator: Exists
+        effect: NoSchedule
+      - key: CriticalAddonsOnly
+        operator: Exists
+      containers:
+      - name: nvidia-device-plugin
+        image: {{ default "nvidia/k8s-device-plugin:1.9" .Values.image }}
+        securityContext:
+          allowPrivilegeEscalation: false
+          capabilities:
+            drop: ["ALL"]
+{{- if .Values.resources }}
+        resources:
+{{ toYaml .Values.resources | indent 10 }}
+{{- end }}
+        volumeMounts:
+        - name: device-plugin
+          mountPath: /var/lib/kubelet/device-plugins
+      volumes:
+      - name: device-plugin
+        hostPath:
+          path: /var/lib/kubelet/device-plugins
+`
+
+// renderNvidia will render the NVIDIA device plugin (advertising the GPUs of nodes setup with --gpu) when enabled
+func renderNvidia(cfg Config) (string, error) {
+	if !cfg.IsEnabled(nvidiaAddon) {
+		return "", nil
+	}
+	data := struct {
+		Label            string
+		Taint            string
+		PrivilegedPolicy string
+	}{
+		Label: constants.GPULabel,
+		Taint: constants.GPUTaint,
+	}
+	if cfg.PodSecurityPolicy {
+		data.PrivilegedPolicy = psp.ClusterRoleName(psp.Privileged)
+	}
+	return renderTemplate(nvidiaAddon, nvidiaYaml, cfg, data)
+}
@@ -0,0 +1,60 @@
+package addons
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/UKHomeOffice/keto-k8/pkg/constants"
+	"github.com/UKHomeOffice/keto-k8/pkg/k8client"
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+)
+
+// managedKinds are all the kinds of resource which addons (past and present) have deployed
+// Namespaces are never pruned as deleting one deletes everything in it (not only the addon's resources)
+var managedKinds = []string{
+	"deployments",
+	"daemonsets",
+	"services",
+	"configmaps",
+	"serviceaccounts",
+	"roles",
+	"rolebindings",
+	"clusterroles",
+	"clusterrolebindings",
+	"storageclasses",
+}
+
+// deployed is the set of resources applied in a run (by resourceKey)
+type deployed map[string]bool
+
+func (d deployed) add(objs []podspec.Object) {
+	for _, o := range objs {
+		d[resourceKey(o)] = true
+	}
+}
+
+// prune will delete all keto-k8 addon resources which were not deployed in this run
+// e.g. from addons removed or disabled since the cluster was created
+func prune(client k8client.Clienter, current deployed) error {
+	managed, err := client.List(managedKinds, constants.ManagedByLabel+"="+constants.ManagedByValue)
+	if err != nil {
+		return fmt.Errorf("error listing keto-k8 managed resources [%v]", err)
+	}
+	for _, o := range managed {
+		// Only prune resources owned by an addon
+		addon := o.Label(constants.AddonLabel)
+		if len(addon) == 0 || current[resourceKey(o)] {
+			continue
+		}
+		log.Printf("Pruning %s %q from obsolete addon %q", o.Kind(), o.Name(), addon)
+		if err := client.Delete(o.Kind(), o.Name(), o.Namespace()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func resourceKey(o podspec.Object) string {
+	return strings.ToLower(o.Kind()) + "/" + o.Namespace() + "/" + o.Name()
+}
@@ -0,0 +1,79 @@
+package addons
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/constants"
+	"github.com/UKHomeOffice/keto-k8/pkg/k8client"
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+)
+
+// fakeClient lists the resources it was created with and records the deletes
+type fakeClient struct {
+	k8client.Clienter
+	objs    []podspec.Object
+	kinds   []string
+	deleted []string
+}
+
+func (f *fakeClient) List(kinds []string, selector string) ([]podspec.Object, error) {
+	if selector != constants.ManagedByLabel+"="+constants.ManagedByValue {
+		return nil, fmt.Errorf("unexpected selector %q", selector)
+	}
+	f.kinds = kinds
+	return f.objs, nil
+}
+
+func (f *fakeClient) Delete(kind, name, namespace string) error {
+	f.deleted = append(f.deleted, kind+"/"+namespace+"/"+name)
+	return nil
+}
+
+func TestPrune(t *testing.T) {
+	objs, err := podspec.Decode(fmt.Sprintf(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: kept
+  namespace: kube-system
+  labels:
+    %[1]s: %[2]s
+    %[3]s: ingress
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: pruned
+  namespace: kube-system
+  labels:
+    %[1]s: %[2]s
+    %[3]s: dashboard
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unlabelled
+  namespace: kube-system
+  labels:
+    %[1]s: %[2]s
+`, constants.ManagedByLabel, constants.ManagedByValue, constants.AddonLabel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &fakeClient{objs: objs}
+	current := deployed{}
+	current.add(objs[:1])
+
+	if err = prune(client, current); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"Deployment/kube-system/pruned"}; !reflect.DeepEqual(client.deleted, expected) {
+		t.Errorf("expected only %v to be pruned but got %v", expected, client.deleted)
+	}
+	for _, kind := range client.kinds {
+		if kind == "namespaces" {
+			t.Error("expected namespaces never to be pruned")
+		}
+	}
+}
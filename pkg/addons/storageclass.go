@@ -0,0 +1,76 @@
+package addons
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+const storageClassAddon = "default-storage-class"
+
+type storageClassDefaults struct {
+	Provisioner string
+	Parameters  map[string]string
+}
+
+// cloudStorageClasses are the sensible defaults for each cloud provider
+var cloudStorageClasses = map[string]storageClassDefaults{
+	"aws": {
+		Provisioner: "kubernetes.io/aws-ebs",
+		Parameters:  map[string]string{"type": "gp2"},
+	},
+	"gce": {
+		Provisioner: "kubernetes.io/gce-pd",
+		Parameters:  map[string]string{"type": "pd-standard"},
+	},
+	"azure": {
+		Provisioner: "kubernetes.io/azure-disk",
+		Parameters:  map[string]string{"storageaccounttype": "Standard_LRS", "kind": "Managed"},
+	},
+	"openstack": {
+		Provisioner: "kubernetes.io/cinder",
+		Parameters:  map[string]string{},
+	},
+}
+
+const storageClassYaml = `
+kind: StorageClass
+apiVersion: storage.k8s.io/v1
+metadata:
+  name: {{ default "default" .Values.name }}
+  annotations:
+    storageclass.kubernetes.io/is-default-class: "true"
+    storageclass.beta.kubernetes.io/is-default-class: "true"
+provisioner: {{ .Data.Provisioner }}
+{{- if .Values.reclaimPolicy }}
+reclaimPolicy: {{ .Values.reclaimPolicy }}
+{{- end }}
+{{- if .Data.Parameters }}
+parameters:
+{{- range $key, $value := .Data.Parameters }}
+  {{ $key }}: "{{ $value }}"
+{{- end }}
+{{- end }}
+`
+
+// renderStorageClass will create a default StorageClass for the cloud provider in use
+func renderStorageClass(cfg Config) (string, error) {
+	if !cfg.DefaultStorageClass || cfg.CloudProvider == "" {
+		return "", nil
+	}
+	defaults, ok := cloudStorageClasses[cfg.CloudProvider]
+	if !ok {
+		log.Warnf("No default storage class known for cloud provider %q", cfg.CloudProvider)
+		return "", nil
+	}
+	// Configured parameters override the cloud defaults
+	data := storageClassDefaults{
+		Provisioner: defaults.Provisioner,
+		Parameters:  map[string]string{},
+	}
+	for k, v := range defaults.Parameters {
+		data.Parameters[k] = v
+	}
+	for k, v := range cfg.StorageClassParams {
+		data.Parameters[k] = v
+	}
+	return renderTemplate(storageClassAddon, storageClassYaml, cfg, data)
+}
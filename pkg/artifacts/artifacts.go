@@ -0,0 +1,30 @@
+package artifacts
+
+import (
+	"os"
+	"path/filepath"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+)
+
+// DefaultDir is where generated manifests are kept for operators to inspect
+const DefaultDir = "/var/lib/keto-k8/artifacts"
+
+// Dir is the artifacts directory used by Save (can be changed by flags)
+var Dir = DefaultDir
+
+// Path returns the location of an artifact
+func Path(name string) string {
+	return filepath.Join(Dir, name)
+}
+
+// Save will write an artifact (name can include sub directories e.g. rbac/flannel.yaml)
+func Save(name, content string) error {
+	fileName := Path(name)
+	if err := os.MkdirAll(filepath.Dir(fileName), 0700); err != nil {
+		return err
+	}
+	log.Debugf("Saving artifact %s", fileName)
+	return fileutil.WriteFile(fileName, []byte(content), 0600)
+}
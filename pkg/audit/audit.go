@@ -0,0 +1,235 @@
+package audit
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+	"github.com/ghodss/yaml"
+	"k8s.io/kubernetes/pkg/util/version"
+)
+
+const (
+	// Dir holds the audit config (mounted into the apiserver)
+	Dir = "/etc/kubernetes/audit"
+
+	// PolicyFile is the audit policy used when none is specified
+	PolicyFile = Dir + "/policy.yaml"
+
+	// WebhookConfigFile is the kubeconfig for the webhook backend
+	WebhookConfigFile = Dir + "/webhook-kubeconfig.yaml"
+
+	apiServerContainer = "kube-apiserver"
+	auditVolume        = "audit-config"
+)
+
+var (
+	// First version with the audit policy and webhook backend (beta)
+	minAuditVersion = version.MustParseGeneric("v1.8.0")
+	// First version with the webhook batching flags
+	minBatchVersion = version.MustParseGeneric("v1.9.0")
+)
+
+// defaultPolicy records metadata for all requests except the noisy read only system traffic
+const defaultPolicy = `apiVersion: audit.k8s.io/v1beta1
+kind: Policy
+omitStages:
+- RequestReceived
+rules:
+- level: None
+  nonResourceURLs:
+  - /healthz*
+  - /version
+  - /swagger*
+- level: None
+  users: ["system:kube-proxy"]
+  verbs: ["watch"]
+- level: None
+  userGroups: ["system:nodes"]
+  verbs: ["get"]
+  resources:
+  - group: ""
+    resources: ["nodes", "nodes/status"]
+- level: Metadata
+  resources:
+  - group: ""
+    resources: ["secrets", "configmaps"]
+- level: Metadata
+`
+
+// Webhook is the remote endpoint and credentials for the webhook backend
+type Webhook struct {
+	// Server is the url to post audit events to
+	Server string `json:"server"`
+	// CertificateAuthority is a CA file to verify the server (system roots are used when empty)
+	CertificateAuthority string `json:"certificateAuthority,omitempty"`
+	// ClientCertificate and ClientKey are files to authenticate with a certificate
+	ClientCertificate string `json:"clientCertificate,omitempty"`
+	ClientKey         string `json:"clientKey,omitempty"`
+	// Token is a bearer token to authenticate with
+	Token string `json:"token,omitempty"`
+	// Mode is "batch" (default) or "blocking"
+	Mode string `json:"mode,omitempty"`
+	// BatchMaxSize and BatchMaxWait (e.g. 30s) tune batch mode
+	BatchMaxSize int    `json:"batchMaxSize,omitempty"`
+	BatchMaxWait string `json:"batchMaxWait,omitempty"`
+}
+
+// Config is the apiserver audit configuration
+type Config struct {
+	// Policy is an audit policy file (a default policy is used when empty)
+	Policy  string   `json:"policy,omitempty"`
+	Webhook *Webhook `json:"webhook,omitempty"`
+}
+
+// Enabled is true when an audit backend is configured
+func (c *Config) Enabled() bool {
+	return c != nil && c.Webhook != nil && len(c.Webhook.Server) > 0
+}
+
+// Validate checks the audit config can be used at a kubernetes version
+func (c *Config) Validate(kubeVersion string) error {
+	v, err := version.ParseGeneric(kubeVersion)
+	if err != nil {
+		return fmt.Errorf("couldn't parse kubernetes version %q: %v", kubeVersion, err)
+	}
+	if v.LessThan(minAuditVersion) {
+		return fmt.Errorf("audit webhook requires kubernetes %s or later (not %s)", minAuditVersion, kubeVersion)
+	}
+	w := c.Webhook
+	if (len(w.ClientCertificate) > 0) != (len(w.ClientKey) > 0) {
+		return fmt.Errorf("audit webhook clientCertificate and clientKey must be specified together")
+	}
+	if len(w.Mode) > 0 && w.Mode != "batch" && w.Mode != "blocking" {
+		return fmt.Errorf("invalid audit webhook mode %q, must be one of: batch, blocking", w.Mode)
+	}
+	return nil
+}
+
+// APIServerArgs returns the apiserver flags for the audit config
+func (c *Config) APIServerArgs(kubeVersion string) map[string]string {
+	mode := c.Webhook.Mode
+	if len(mode) == 0 {
+		mode = "batch"
+	}
+	args := map[string]string{
+		"audit-policy-file":         PolicyFile,
+		"audit-webhook-config-file": WebhookConfigFile,
+		"audit-webhook-mode":        mode,
+	}
+	v, err := version.ParseGeneric(kubeVersion)
+	if err != nil || v.LessThan(minBatchVersion) || mode != "batch" {
+		return args
+	}
+	if c.Webhook.BatchMaxSize > 0 {
+		args["audit-webhook-batch-max-size"] = strconv.Itoa(c.Webhook.BatchMaxSize)
+	}
+	if len(c.Webhook.BatchMaxWait) > 0 {
+		args["audit-webhook-batch-max-wait"] = c.Webhook.BatchMaxWait
+	}
+	return args
+}
+
+// Write will save the policy and webhook kubeconfig for the apiserver
+func (c *Config) Write() error {
+	files, err := c.Render()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(Dir, 0700); err != nil {
+		return err
+	}
+	for _, name := range []string{PolicyFile, WebhookConfigFile} {
+		if err = fileutil.WriteFile(name, files[name], 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Render returns the policy and webhook kubeconfig for the apiserver (by file name)
+func (c *Config) Render() (map[string][]byte, error) {
+	policy := []byte(defaultPolicy)
+	if len(c.Policy) > 0 {
+		var err error
+		if policy, err = ioutil.ReadFile(c.Policy); err != nil {
+			return nil, fmt.Errorf("error reading audit policy %q [%v]", c.Policy, err)
+		}
+	}
+	kubeconfig, err := c.Webhook.kubeconfig()
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{
+		PolicyFile:        policy,
+		WebhookConfigFile: kubeconfig,
+	}, nil
+}
+
+// kubeconfig returns the webhook config with all credentials embedded
+func (w *Webhook) kubeconfig() ([]byte, error) {
+	cluster := map[string]interface{}{"server": w.Server}
+	user := map[string]interface{}{}
+	files := []struct {
+		name string
+		key  string
+		data map[string]interface{}
+	}{
+		{name: w.CertificateAuthority, key: "certificate-authority-data", data: cluster},
+		{name: w.ClientCertificate, key: "client-certificate-data", data: user},
+		{name: w.ClientKey, key: "client-key-data", data: user},
+	}
+	for _, f := range files {
+		if len(f.name) == 0 {
+			continue
+		}
+		b, err := ioutil.ReadFile(f.name)
+		if err != nil {
+			return nil, fmt.Errorf("error reading audit webhook credentials %q [%v]", f.name, err)
+		}
+		f.data[f.key] = base64.StdEncoding.EncodeToString(b)
+	}
+	if len(w.Token) > 0 {
+		user["token"] = w.Token
+	}
+	kubeconfig := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Config",
+		"clusters": []interface{}{
+			map[string]interface{}{"name": "audit", "cluster": cluster},
+		},
+		"users": []interface{}{
+			map[string]interface{}{"name": "kube-apiserver", "user": user},
+		},
+		"contexts": []interface{}{
+			map[string]interface{}{
+				"name":    "audit",
+				"context": map[string]interface{}{"cluster": "audit", "user": "kube-apiserver"},
+			},
+		},
+		"current-context": "audit",
+	}
+	return yaml.Marshal(kubeconfig)
+}
+
+// Mutator returns a podspec.Mutator mounting the audit config into the apiserver static pod
+func (c *Config) Mutator() podspec.Mutator {
+	return func(o podspec.Object) error {
+		if o.Container(apiServerContainer) == nil {
+			return nil
+		}
+		o.AddVolume(map[string]interface{}{
+			"name":     auditVolume,
+			"hostPath": map[string]interface{}{"path": Dir},
+		})
+		return o.AddVolumeMount(apiServerContainer, map[string]interface{}{
+			"name":      auditVolume,
+			"mountPath": Dir,
+			"readOnly":  true,
+		})
+	}
+}
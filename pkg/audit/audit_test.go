@@ -0,0 +1,53 @@
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEnabled(t *testing.T) {
+	var c *Config
+	if c.Enabled() {
+		t.Errorf("expected a nil config not to be enabled")
+	}
+	if (&Config{Webhook: &Webhook{}}).Enabled() {
+		t.Errorf("expected a webhook without a server not to be enabled")
+	}
+}
+
+func TestAPIServerArgs(t *testing.T) {
+	c := &Config{Webhook: &Webhook{Server: "https://audit", BatchMaxSize: 100, BatchMaxWait: "10s"}}
+	args := c.APIServerArgs("v1.9.3")
+	if args["audit-webhook-mode"] != "batch" || args["audit-webhook-batch-max-size"] != "100" {
+		t.Errorf("unexpected args for v1.9 %v", args)
+	}
+	if _, ok := c.APIServerArgs("v1.8.5")["audit-webhook-batch-max-wait"]; ok {
+		t.Errorf("didn't expect batch flags for v1.8")
+	}
+	if err := c.Validate("v1.7.5"); err == nil {
+		t.Errorf("expected an error for an unsupported version")
+	}
+}
+
+func TestKubeconfig(t *testing.T) {
+	f, err := ioutil.TempFile("", "audit-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("test-ca")
+	f.Close()
+
+	w := &Webhook{Server: "https://audit", CertificateAuthority: f.Name(), Token: "secret"}
+	kubeconfig, err := w.kubeconfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"server: https://audit", "certificate-authority-data: dGVzdC1jYQ==", "token: secret"} {
+		if !strings.Contains(string(kubeconfig), expected) {
+			t.Errorf("expected %q in kubeconfig:\n%s", expected, kubeconfig)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package authwebhook
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+	kubeadmconstants "github.com/UKHomeOffice/keto-k8/pkg/kubeadm/constants"
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// AuthenticationConfigFile is the kubeconfig for the token authentication webhook
+	AuthenticationConfigFile = kubeadmconstants.KubernetesDir + "/webhook_authn.conf"
+
+	// AuthorizationConfigFile is the kubeconfig for the authorization webhook (the path kubeadm sets when the Webhook
+	// authorization mode is enabled)
+	AuthorizationConfigFile = kubeadmconstants.AuthorizationWebhookConfigPath
+
+	apiServerContainer = "kube-apiserver"
+	authnVolume        = "webhook-authn"
+	authzVolume        = "webhook-authz"
+)
+
+// Endpoint is the remote service and the credentials the apiserver uses to call it
+type Endpoint struct {
+	// Server is the url of the webhook
+	Server string `json:"server"`
+	// CertificateAuthority is a CA file to verify the server (system roots are used when empty)
+	CertificateAuthority string `json:"certificateAuthority,omitempty"`
+	// ClientCertificate and ClientKey are files to authenticate with a certificate
+	ClientCertificate string `json:"clientCertificate,omitempty"`
+	ClientKey         string `json:"clientKey,omitempty"`
+	// Token is a bearer token to authenticate with
+	Token string `json:"token,omitempty"`
+}
+
+// Authentication is a bearer token authentication webhook e.g. keto-tokens
+type Authentication struct {
+	Endpoint
+	// CacheTTL is how long token reviews are cached e.g. 2m (the apiserver default when empty)
+	CacheTTL string `json:"cacheTTL,omitempty"`
+}
+
+// Authorization is an external authorizer, consulted after RBAC
+type Authorization struct {
+	Endpoint
+	// CacheAuthorizedTTL and CacheUnauthorizedTTL are how long decisions are cached e.g. 5m and 30s (the apiserver
+	// defaults when empty)
+	CacheAuthorizedTTL   string `json:"cacheAuthorizedTTL,omitempty"`
+	CacheUnauthorizedTTL string `json:"cacheUnauthorizedTTL,omitempty"`
+}
+
+// Config is the apiserver authentication and authorization webhook configuration
+type Config struct {
+	Authentication *Authentication `json:"authentication,omitempty"`
+	Authorization  *Authorization  `json:"authorization,omitempty"`
+}
+
+// Enabled is true when either webhook is configured
+func (c *Config) Enabled() bool {
+	return c.AuthenticationEnabled() || c.AuthorizationEnabled()
+}
+
+// AuthenticationEnabled is true when an authentication webhook is configured
+func (c *Config) AuthenticationEnabled() bool {
+	return c != nil && c.Authentication != nil && len(c.Authentication.Server) > 0
+}
+
+// AuthorizationEnabled is true when an authorization webhook is configured
+func (c *Config) AuthorizationEnabled() bool {
+	return c != nil && c.Authorization != nil && len(c.Authorization.Server) > 0
+}
+
+// Validate checks the webhook urls, credentials and cache TTLs
+func (c *Config) Validate() error {
+	if c.AuthenticationEnabled() {
+		if err := c.Authentication.validate("authentication"); err != nil {
+			return err
+		}
+		if err := validateTTL("authentication cacheTTL", c.Authentication.CacheTTL); err != nil {
+			return err
+		}
+	}
+	if c.AuthorizationEnabled() {
+		if err := c.Authorization.validate("authorization"); err != nil {
+			return err
+		}
+		if err := validateTTL("authorization cacheAuthorizedTTL", c.Authorization.CacheAuthorizedTTL); err != nil {
+			return err
+		}
+		if err := validateTTL("authorization cacheUnauthorizedTTL", c.Authorization.CacheUnauthorizedTTL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate checks the endpoint url and credentials
+func (e *Endpoint) validate(name string) error {
+	u, err := url.Parse(e.Server)
+	if err != nil || u.Scheme != "https" || len(u.Host) == 0 {
+		return fmt.Errorf("invalid %s webhook server %q, must be an https url", name, e.Server)
+	}
+	if (len(e.ClientCertificate) > 0) != (len(e.ClientKey) > 0) {
+		return fmt.Errorf("%s webhook clientCertificate and clientKey must be specified together", name)
+	}
+	return nil
+}
+
+// validateTTL checks a cache TTL is a positive duration (when set)
+func validateTTL(name, ttl string) error {
+	if len(ttl) == 0 {
+		return nil
+	}
+	if d, err := time.ParseDuration(ttl); err != nil || d < 0 {
+		return fmt.Errorf("invalid webhook %s %q, must be a duration e.g. 2m", name, ttl)
+	}
+	return nil
+}
+
+// APIServerArgs returns the apiserver flags for the webhooks (the authorization mode and config file are set by
+// kubeadm from the authorization modes)
+func (c *Config) APIServerArgs() map[string]string {
+	args := map[string]string{}
+	if c.AuthenticationEnabled() {
+		args["authentication-token-webhook-config-file"] = AuthenticationConfigFile
+		if len(c.Authentication.CacheTTL) > 0 {
+			args["authentication-token-webhook-cache-ttl"] = c.Authentication.CacheTTL
+		}
+	}
+	if c.AuthorizationEnabled() {
+		if len(c.Authorization.CacheAuthorizedTTL) > 0 {
+			args["authorization-webhook-cache-authorized-ttl"] = c.Authorization.CacheAuthorizedTTL
+		}
+		if len(c.Authorization.CacheUnauthorizedTTL) > 0 {
+			args["authorization-webhook-cache-unauthorized-ttl"] = c.Authorization.CacheUnauthorizedTTL
+		}
+	}
+	return args
+}
+
+// Write will save the webhook kubeconfigs for the apiserver
+func (c *Config) Write() error {
+	files, err := c.Render()
+	if err != nil {
+		return err
+	}
+	for name, data := range files {
+		if err = fileutil.WriteFile(name, data, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Render returns the webhook kubeconfigs for the apiserver (by file name)
+func (c *Config) Render() (map[string][]byte, error) {
+	files := map[string][]byte{}
+	if c.AuthenticationEnabled() {
+		kubeconfig, err := c.Authentication.kubeconfig("authentication")
+		if err != nil {
+			return nil, err
+		}
+		files[AuthenticationConfigFile] = kubeconfig
+	}
+	if c.AuthorizationEnabled() {
+		kubeconfig, err := c.Authorization.kubeconfig("authorization")
+		if err != nil {
+			return nil, err
+		}
+		files[AuthorizationConfigFile] = kubeconfig
+	}
+	return files, nil
+}
+
+// kubeconfig returns the webhook config with all credentials embedded
+func (e *Endpoint) kubeconfig(name string) ([]byte, error) {
+	cluster := map[string]interface{}{"server": e.Server}
+	user := map[string]interface{}{}
+	files := []struct {
+		name string
+		key  string
+		data map[string]interface{}
+	}{
+		{name: e.CertificateAuthority, key: "certificate-authority-data", data: cluster},
+		{name: e.ClientCertificate, key: "client-certificate-data", data: user},
+		{name: e.ClientKey, key: "client-key-data", data: user},
+	}
+	for _, f := range files {
+		if len(f.name) == 0 {
+			continue
+		}
+		b, err := ioutil.ReadFile(f.name)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s webhook credentials %q [%v]", name, f.name, err)
+		}
+		f.data[f.key] = base64.StdEncoding.EncodeToString(b)
+	}
+	if len(e.Token) > 0 {
+		user["token"] = e.Token
+	}
+	kubeconfig := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Config",
+		"clusters": []interface{}{
+			map[string]interface{}{"name": name, "cluster": cluster},
+		},
+		"users": []interface{}{
+			map[string]interface{}{"name": "kube-apiserver", "user": user},
+		},
+		"contexts": []interface{}{
+			map[string]interface{}{
+				"name":    name,
+				"context": map[string]interface{}{"cluster": name, "user": "kube-apiserver"},
+			},
+		},
+		"current-context": name,
+	}
+	return yaml.Marshal(kubeconfig)
+}
+
+// Mutator returns a podspec.Mutator mounting the webhook kubeconfigs into the apiserver static pod
+func (c *Config) Mutator() podspec.Mutator {
+	mounts := map[string]string{}
+	if c.AuthenticationEnabled() {
+		mounts[authnVolume] = AuthenticationConfigFile
+	}
+	if c.AuthorizationEnabled() {
+		mounts[authzVolume] = AuthorizationConfigFile
+	}
+	return func(o podspec.Object) error {
+		if o.Container(apiServerContainer) == nil {
+			return nil
+		}
+		for _, volume := range []string{authnVolume, authzVolume} {
+			file, ok := mounts[volume]
+			if !ok {
+				continue
+			}
+			o.AddVolume(map[string]interface{}{
+				"name":     volume,
+				"hostPath": map[string]interface{}{"path": file},
+			})
+			if err := o.AddVolumeMount(apiServerContainer, map[string]interface{}{
+				"name":      volume,
+				"mountPath": file,
+				"readOnly":  true,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,92 @@
+package authwebhook
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+)
+
+const apiServerPod = `apiVersion: v1
+kind: Pod
+metadata:
+  name: kube-apiserver
+spec:
+  containers:
+  - name: kube-apiserver
+`
+
+func TestValidate(t *testing.T) {
+	valid := &Config{
+		Authentication: &Authentication{Endpoint: Endpoint{Server: "https://keto-tokens"}, CacheTTL: "2m"},
+		Authorization:  &Authorization{Endpoint: Endpoint{Server: "https://authz"}, CacheUnauthorizedTTL: "30s"},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	for _, c := range []*Config{
+		{Authentication: &Authentication{Endpoint: Endpoint{Server: "http://keto-tokens"}}},
+		{Authentication: &Authentication{Endpoint: Endpoint{Server: "https://keto-tokens"}, CacheTTL: "2 minutes"}},
+		{Authorization: &Authorization{Endpoint: Endpoint{Server: "https://authz", ClientCertificate: "client.pem"}}},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("expected an error for %+v", c)
+		}
+	}
+}
+
+func TestAPIServerArgs(t *testing.T) {
+	c := &Config{
+		Authentication: &Authentication{Endpoint: Endpoint{Server: "https://keto-tokens"}, CacheTTL: "2m"},
+		Authorization:  &Authorization{Endpoint: Endpoint{Server: "https://authz"}, CacheAuthorizedTTL: "5m"},
+	}
+	args := c.APIServerArgs()
+	expected := map[string]string{
+		"authentication-token-webhook-config-file":   AuthenticationConfigFile,
+		"authentication-token-webhook-cache-ttl":     "2m",
+		"authorization-webhook-cache-authorized-ttl": "5m",
+	}
+	if len(args) != len(expected) {
+		t.Errorf("expected args %v but got %v", expected, args)
+	}
+	for flag, value := range expected {
+		if args[flag] != value {
+			t.Errorf("expected %s=%q but got %q", flag, value, args[flag])
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	f, err := ioutil.TempFile("", "webhook-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("test-ca")
+	f.Close()
+
+	c := &Config{Authentication: &Authentication{Endpoint: Endpoint{Server: "https://keto-tokens", CertificateAuthority: f.Name()}}}
+	files, err := c.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("expected only the authentication kubeconfig but got %d files", len(files))
+	}
+	kubeconfig := string(files[AuthenticationConfigFile])
+	for _, expected := range []string{"server: https://keto-tokens", "certificate-authority-data: dGVzdC1jYQ=="} {
+		if !strings.Contains(kubeconfig, expected) {
+			t.Errorf("expected %q in kubeconfig:\n%s", expected, kubeconfig)
+		}
+	}
+
+	manifest, err := podspec.Transform(apiServerPod, c.Mutator())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(manifest, "mountPath: "+AuthenticationConfigFile) || strings.Contains(manifest, AuthorizationConfigFile) {
+		t.Errorf("expected only the authentication kubeconfig mounted:\n%s", manifest)
+	}
+}
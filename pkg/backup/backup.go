@@ -0,0 +1,189 @@
+package backup
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+	"github.com/UKHomeOffice/keto-k8/pkg/logging"
+)
+
+// logger is used for all the backup logs
+var logger = logging.New("backup")
+
+const (
+	// DefaultDir is where the backups of replaced files are kept
+	DefaultDir = "/var/lib/keto-k8/backups"
+	// DefaultRetention is how many backups are kept
+	DefaultRetention = 5
+	// layout names each backup directory (so they sort oldest first)
+	layout = "20060102-150405.000"
+)
+
+var (
+	// Dir is where the backups are kept (can be changed by flags)
+	Dir = DefaultDir
+	// Retention is how many backups are kept (0 to disable backups)
+	Retention = DefaultRetention
+	// IncludeKeys will back up files with key material (e.g. private keys and kubeconfigs), not backed up by default
+	IncludeKeys = false
+
+	mu sync.Mutex
+	// session is the backup for this run (created with the first file backed up)
+	session string
+	// now is replaced in tests
+	now = time.Now
+)
+
+// Save will copy the current version of files (if they exist) into the backup for this run
+// A file already in the backup for this run is kept as it was before the run started
+// Files with key material are skipped unless IncludeKeys is set
+func Save(files ...string) error {
+	if Retention <= 0 || len(Dir) == 0 {
+		return nil
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if !IncludeKeys && fileutil.IsKeyMaterial(data) {
+			logger.Debugf("Not backing up %s (key material)", file)
+			continue
+		}
+		if err = start(); err != nil {
+			return err
+		}
+		dst, err := path(file)
+		if err != nil {
+			return err
+		}
+		if fileutil.ExistFile(dst) {
+			continue
+		}
+		if err = os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+			return err
+		}
+		if err = fileutil.WriteFile(dst, data, info.Mode().Perm()); err != nil {
+			return err
+		}
+		logger.Printf("Backed up %s to %s", file, dst)
+	}
+	return nil
+}
+
+// Replacing will back up a file which is about to be replaced with different data
+func Replacing(file string, data []byte) error {
+	current, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) || (err == nil && bytes.Equal(current, data)) {
+		return nil
+	}
+	return Save(file)
+}
+
+// WriteFile will back up a file which is changing and then (atomically) write it
+func WriteFile(file string, data []byte, mode os.FileMode) error {
+	if err := Replacing(file, data); err != nil {
+		return fmt.Errorf("failed to back up %s [%v]", file, err)
+	}
+	return fileutil.WriteFile(file, data, mode)
+}
+
+// path returns where a file is kept in the backup for this run (once started)
+func path(file string) (string, error) {
+	if len(session) == 0 {
+		return "", fmt.Errorf("no backup has been started")
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(session, abs), nil
+}
+
+// List returns the backup directories (oldest first)
+func List() ([]string, error) {
+	entries, err := ioutil.ReadDir(Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, e := range entries {
+		// Only directories named by a backup are ever removed
+		if _, err := time.Parse(layout, e.Name()); err != nil || !e.IsDir() {
+			continue
+		}
+		backups = append(backups, filepath.Join(Dir, e.Name()))
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// PurgeKeys will securely remove all the files with key material from the backups (returning how many were removed)
+func PurgeKeys() (int, error) {
+	backups, err := List()
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, b := range backups {
+		err = filepath.Walk(b, func(file string, info os.FileInfo, err error) error {
+			if err != nil || !info.Mode().IsRegular() {
+				return err
+			}
+			data, err := ioutil.ReadFile(file)
+			if err != nil || !fileutil.IsKeyMaterial(data) {
+				return err
+			}
+			if err = fileutil.ShredFile(file); err != nil {
+				return err
+			}
+			purged++
+			return nil
+		})
+		if err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+// start will create the backup for this run (if not already started) and remove the oldest backups over the retention
+func start() error {
+	if len(session) > 0 {
+		return nil
+	}
+	name := filepath.Join(Dir, now().UTC().Format(layout))
+	if err := os.MkdirAll(name, 0700); err != nil {
+		return err
+	}
+	session = name
+	backups, err := List()
+	if err != nil {
+		return err
+	}
+	for len(backups) > Retention {
+		logger.Printf("Removing old backup %s", backups[0])
+		if err = os.RemoveAll(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
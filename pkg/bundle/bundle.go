@@ -0,0 +1,237 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// The files kept in a bundle
+const (
+	// KubeCaCert is the persistent kube CA cert
+	KubeCaCert = "kube-ca.crt"
+	// KubeCaKey is the persistent kube CA key
+	KubeCaKey = "kube-ca.key"
+	// EtcdCaCert is the etcd CA cert (optional)
+	EtcdCaCert = "etcd-ca.crt"
+	// EtcdCaKey is the etcd CA key (optional)
+	EtcdCaKey = "etcd-ca.key"
+	// Assets are the shared assets from etcd (as stored, missing when not yet created)
+	Assets = "assets"
+	// metadataName is the cluster metadata (json)
+	metadataName = "metadata.json"
+)
+
+const (
+	// magic starts every bundle (followed by the format version)
+	magic         = "KETOBNDL"
+	formatVersion = 1
+	// Iterations is how many PBKDF2 rounds derive the key from the passphrase
+	Iterations = 100000
+	// maxIterations bounds the rounds a bundle header can ask for (so a bad header can't hang a restore)
+	maxIterations = 10 * Iterations
+	// MinPassphraseLength is the shortest passphrase accepted
+	MinPassphraseLength = 12
+	saltSize            = 16
+	keySize             = 32
+)
+
+// ErrDecrypt is returned when a bundle can't be decrypted (the wrong passphrase or a corrupted bundle)
+var ErrDecrypt = errors.New("bundle could not be decrypted (wrong passphrase or corrupted)")
+
+// Metadata describes the cluster a bundle was exported from
+type Metadata struct {
+	ClusterName   string    `json:"clusterName,omitempty"`
+	KubeVersion   string    `json:"kubeVersion,omitempty"`
+	KetoK8Version string    `json:"ketoK8Version,omitempty"`
+	Masters       []string  `json:"masters,omitempty"`
+	Created       time.Time `json:"created"`
+}
+
+// Bundle is a cluster's identity (the CAs and shared assets) with its metadata
+type Bundle struct {
+	Metadata Metadata
+	// Files are the contents of each file (by name) e.g. KubeCaCert
+	Files map[string][]byte
+}
+
+// header is written in the clear (and authenticated) before the encrypted tarball
+type header struct {
+	Magic      [8]byte
+	Version    uint8
+	Iterations uint32
+	Salt       [saltSize]byte
+}
+
+// Write will write the bundle as a gzipped tarball encrypted (AES-256-GCM) with a key derived from the passphrase
+func (b *Bundle) Write(w io.Writer, passphrase []byte) error {
+	if len(passphrase) < MinPassphraseLength {
+		return fmt.Errorf("the passphrase must be at least %d characters", MinPassphraseLength)
+	}
+	tarball, err := b.tarball()
+	if err != nil {
+		return err
+	}
+	h := header{Version: formatVersion, Iterations: Iterations}
+	copy(h.Magic[:], magic)
+	if _, err = io.ReadFull(rand.Reader, h.Salt[:]); err != nil {
+		return err
+	}
+	var clear bytes.Buffer
+	if err = binary.Write(&clear, binary.BigEndian, h); err != nil {
+		return err
+	}
+	gcm, err := newGCM(passphrase, h)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	if _, err = w.Write(clear.Bytes()); err != nil {
+		return err
+	}
+	if _, err = w.Write(nonce); err != nil {
+		return err
+	}
+	_, err = w.Write(gcm.Seal(nil, nonce, tarball, clear.Bytes()))
+	return err
+}
+
+// Read will decrypt and read a bundle
+func Read(r io.Reader, passphrase []byte) (*Bundle, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var h header
+	headerSize := binary.Size(h)
+	if len(data) < headerSize || string(data[:len(magic)]) != magic {
+		return nil, fmt.Errorf("not a keto-k8 bundle")
+	}
+	if err = binary.Read(bytes.NewReader(data[:headerSize]), binary.BigEndian, &h); err != nil {
+		return nil, err
+	}
+	if h.Version != formatVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", h.Version)
+	}
+	if h.Iterations == 0 || h.Iterations > maxIterations {
+		return nil, fmt.Errorf("invalid bundle key derivation iterations %d", h.Iterations)
+	}
+	gcm, err := newGCM(passphrase, h)
+	if err != nil {
+		return nil, err
+	}
+	sealed := data[headerSize:]
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	tarball, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], data[:headerSize])
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return readTarball(tarball)
+}
+
+// Names returns the names of the files in the bundle (sorted)
+func (b *Bundle) Names() []string {
+	var names []string
+	for name := range b.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tarball returns the metadata and files as a gzipped tarball
+func (b *Bundle) tarball() ([]byte, error) {
+	metadata, err := json.MarshalIndent(b.Metadata, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	add := func(name string, content []byte) error {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0600,
+			Size:    int64(len(content)),
+			ModTime: b.Metadata.Created,
+		}); err != nil {
+			return err
+		}
+		_, err := tw.Write(content)
+		return err
+	}
+	if err = add(metadataName, metadata); err != nil {
+		return nil, err
+	}
+	for _, name := range b.Names() {
+		if err = add(name, b.Files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err = tw.Close(); err != nil {
+		return nil, err
+	}
+	if err = gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readTarball returns the bundle from a gzipped tarball
+func readTarball(tarball []byte) (*Bundle, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(tarball))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	b := &Bundle{Files: map[string][]byte{}}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Name == metadataName {
+			if err = json.Unmarshal(content, &b.Metadata); err != nil {
+				return nil, fmt.Errorf("invalid bundle metadata [%v]", err)
+			}
+			continue
+		}
+		b.Files[hdr.Name] = content
+	}
+	return b, nil
+}
+
+// newGCM returns the cipher for the key derived from the passphrase
+func newGCM(passphrase []byte, h header) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2.Key(passphrase, h.Salt[:], int(h.Iterations), keySize, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,80 @@
+package bundle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testPassphrase = []byte("correct horse battery staple")
+
+func testBundle() *Bundle {
+	return &Bundle{
+		Metadata: Metadata{
+			ClusterName: "test",
+			KubeVersion: "v1.7.0",
+			Masters:     []string{"master1", "master2"},
+			Created:     time.Date(2017, 7, 1, 12, 0, 0, 0, time.UTC),
+		},
+		Files: map[string][]byte{
+			KubeCaCert: []byte("cert"),
+			KubeCaKey:  []byte("key"),
+			Assets:     []byte("{}"),
+		},
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	var buf bytes.Buffer
+	b := testBundle()
+	if err := b.Write(&buf, testPassphrase); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("master1")) {
+		t.Error("expected the bundle to be encrypted")
+	}
+	read, err := Read(bytes.NewReader(buf.Bytes()), testPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, b) {
+		t.Errorf("expected %+v but got %+v", b, read)
+	}
+
+	if _, err = Read(bytes.NewReader(buf.Bytes()), []byte("the wrong passphrase")); err != ErrDecrypt {
+		t.Errorf("expected a decrypt error for the wrong passphrase but got %v", err)
+	}
+	// The header is authenticated too
+	tampered := append([]byte{}, buf.Bytes()...)
+	tampered[len(magic)+2] ^= 1
+	if _, err = Read(bytes.NewReader(tampered), testPassphrase); err != ErrDecrypt {
+		t.Errorf("expected a decrypt error for a tampered bundle but got %v", err)
+	}
+	if _, err = Read(bytes.NewReader([]byte("not a bundle")), testPassphrase); err == nil {
+		t.Error("expected an error for a file which isn't a bundle")
+	}
+}
+
+func TestWriteShortPassphrase(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testBundle().Write(&buf, []byte("short")); err == nil {
+		t.Error("expected an error for a short passphrase")
+	}
+}
+
+func TestReadInvalidIterations(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testBundle().Write(&buf, testPassphrase); err != nil {
+		t.Fatalf("unexpected error writing the bundle: %v", err)
+	}
+	for _, iterations := range []uint32{0, maxIterations + 1} {
+		data := append([]byte(nil), buf.Bytes()...)
+		// the iterations follow the magic and the version in the header
+		binary.BigEndian.PutUint32(data[len(magic)+1:], iterations)
+		if _, err := Read(bytes.NewReader(data), testPassphrase); err == nil {
+			t.Errorf("expected an error for %d iterations", iterations)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package certmanager
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+
+	certutil "github.com/UKHomeOffice/keto-k8/pkg/client-go/util/cert"
+	"github.com/UKHomeOffice/keto-k8/pkg/constants"
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// DefaultIssuer is the name of the CA ClusterIssuer (and its secret)
+	DefaultIssuer = "keto-ca"
+
+	// Namespace is where cert-manager looks for the secrets of cluster issuers
+	Namespace = "cert-manager"
+
+	// IssuerNameAnnotation and IssuerKindAnnotation are set by cert-manager on the secrets it issues
+	IssuerNameAnnotation = "certmanager.k8s.io/issuer-name"
+	IssuerKindAnnotation = "certmanager.k8s.io/issuer-kind"
+
+	// MigrateAnnotation marks keto-k8 secrets to be re-issued by cert-manager (with a Certificate for the secret)
+	MigrateAnnotation = "keto-k8/migrate-to-cert-manager"
+)
+
+// intermediateValidity is how long an intermediate CA is valid for (never longer than the cluster CA)
+var intermediateValidity = 5 * 365 * 24 * time.Hour
+
+// Config is the cert-manager hand-off (from the config file), once bootstrapped cert-manager is deployed with a CA
+// ClusterIssuer for the cluster CA
+type Config struct {
+	// Issuer is the name of the ClusterIssuer (DefaultIssuer when not set)
+	Issuer string `json:"issuer,omitempty"`
+	// Intermediate signs an intermediate CA for the issuer instead of handing it the cluster CA key (required when the
+	// CA key is ephemeral)
+	Intermediate bool `json:"intermediate,omitempty"`
+	// SkipMigration doesn't annotate the keto-k8 managed TLS secrets for migration
+	SkipMigration bool `json:"skipMigration,omitempty"`
+}
+
+// IssuerName returns the name of the ClusterIssuer
+func (c *Config) IssuerName() string {
+	if len(c.Issuer) > 0 {
+		return c.Issuer
+	}
+	return DefaultIssuer
+}
+
+// IssuerCA returns the cert (with any chain) and key the issuer signs with, the cluster CA or a new intermediate
+// signed by it. The bundle is the complete cluster CA file.
+func (c *Config) IssuerCA(caCert *x509.Certificate, caKey *rsa.PrivateKey, bundle []byte) (cert, key []byte, err error) {
+	if !c.Intermediate {
+		return bundle, certutil.EncodePrivateKeyPEM(caKey), nil
+	}
+	intermediateKey, err := certutil.NewPrivateKey()
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create the issuer private key [%v]", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).SetInt64(math.MaxInt64))
+	if err != nil {
+		return nil, nil, err
+	}
+	notAfter := time.Now().Add(intermediateValidity)
+	if caCert.NotAfter.Before(notAfter) {
+		notAfter = caCert.NotAfter
+	}
+	template := x509.Certificate{
+		Subject:               pkix.Name{CommonName: c.IssuerName()},
+		SerialNumber:          serial,
+		NotBefore:             time.Now().UTC(),
+		NotAfter:              notAfter.UTC(),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		// Only leaf certs can be issued
+		MaxPathLenZero: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, caCert, intermediateKey.Public(), caKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to sign the issuer intermediate CA [%v]", err)
+	}
+	cert = append(certutil.EncodeCertPEM(&x509.Certificate{Raw: der}), bundle...)
+	return cert, certutil.EncodePrivateKeyPEM(intermediateKey), nil
+}
+
+// IssuerResources returns the secret and CA ClusterIssuer for the issuer cert and key
+func (c *Config) IssuerResources(cert, key []byte) (string, error) {
+	labels := map[string]string{constants.ManagedByLabel: constants.ManagedByValue}
+	secret, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"type":       "kubernetes.io/tls",
+		"metadata":   map[string]interface{}{"name": c.IssuerName(), "namespace": Namespace, "labels": labels},
+		"data": map[string]string{
+			"tls.crt": base64.StdEncoding.EncodeToString(cert),
+			"tls.key": base64.StdEncoding.EncodeToString(key),
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	issuer, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion": "certmanager.k8s.io/v1alpha1",
+		"kind":       "ClusterIssuer",
+		"metadata":   map[string]interface{}{"name": c.IssuerName(), "labels": labels},
+		"spec":       map[string]interface{}{"ca": map[string]string{"secretName": c.IssuerName()}},
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(secret) + "---\n" + string(issuer), nil
+}
+
+// MigrationPatch returns the patch annotating a keto-k8 secret for migration to the issuer
+func (c *Config) MigrationPatch() string {
+	return fmt.Sprintf(`{"metadata":{"annotations":{%q:%q,%q:"ClusterIssuer",%q:"true"}}}`,
+		IssuerNameAnnotation, c.IssuerName(), IssuerKindAnnotation, MigrateAnnotation)
+}
@@ -0,0 +1,96 @@
+package certmanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	certutil "github.com/UKHomeOffice/keto-k8/pkg/client-go/util/cert"
+)
+
+func TestIssuerCA(t *testing.T) {
+	caKey, err := certutil.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := certutil.NewSelfSignedCACert(certutil.Config{CommonName: "kubernetes"}, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := certutil.EncodeCertPEM(caCert)
+
+	cert, key, err := (&Config{}).IssuerCA(caCert, caKey, bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cert, bundle) || !bytes.Equal(key, certutil.EncodePrivateKeyPEM(caKey)) {
+		t.Errorf("expected the cluster CA without an intermediate")
+	}
+
+	c := &Config{Intermediate: true}
+	cert, key, err = c.IssuerCA(caCert, caKey, bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := certutil.ParseCertsPEM(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 {
+		t.Fatalf("expected the intermediate and the cluster CA but got %d certs", len(certs))
+	}
+	intermediate := certs[0]
+	if !intermediate.IsCA || intermediate.MaxPathLen != 0 || !intermediate.MaxPathLenZero {
+		t.Errorf("expected an intermediate CA only able to sign leaf certs")
+	}
+	if intermediate.Subject.CommonName != DefaultIssuer {
+		t.Errorf("expected the intermediate common name %s but got %s", DefaultIssuer, intermediate.Subject.CommonName)
+	}
+	if err = intermediate.CheckSignatureFrom(caCert); err != nil {
+		t.Errorf("expected the intermediate to be signed by the cluster CA: %v", err)
+	}
+	if intermediate.NotAfter.After(caCert.NotAfter) {
+		t.Errorf("expected the intermediate not to outlive the cluster CA (%s) but got %s", caCert.NotAfter, intermediate.NotAfter)
+	}
+	if intermediate.NotAfter.Before(time.Now().Add(364 * 24 * time.Hour)) {
+		t.Errorf("expected the intermediate to be valid for years but got %s", intermediate.NotAfter)
+	}
+	if bytes.Contains(key, certutil.EncodePrivateKeyPEM(caKey)) {
+		t.Errorf("expected the intermediate key not to be the cluster CA key")
+	}
+}
+
+func TestIssuerResources(t *testing.T) {
+	resources, err := (&Config{Issuer: "platform-ca"}).IssuerResources([]byte("cert"), []byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := strings.Split(resources, "---\n")
+	if len(docs) != 2 {
+		t.Fatalf("expected a secret and an issuer but got:\n%s", resources)
+	}
+	for _, expected := range []string{"kind: Secret", "name: platform-ca", "namespace: " + Namespace, "tls.crt: Y2VydA=="} {
+		if !strings.Contains(docs[0], expected) {
+			t.Errorf("expected the secret to contain %q but got:\n%s", expected, docs[0])
+		}
+	}
+	for _, expected := range []string{"kind: ClusterIssuer", "secretName: platform-ca"} {
+		if !strings.Contains(docs[1], expected) {
+			t.Errorf("expected the issuer to contain %q but got:\n%s", expected, docs[1])
+		}
+	}
+}
+
+func TestMigrationPatch(t *testing.T) {
+	patch := map[string]map[string]map[string]string{}
+	if err := json.Unmarshal([]byte((&Config{}).MigrationPatch()), &patch); err != nil {
+		t.Fatalf("expected a valid json patch: %v", err)
+	}
+	annotations := patch["metadata"]["annotations"]
+	if annotations[IssuerNameAnnotation] != DefaultIssuer || annotations[IssuerKindAnnotation] != "ClusterIssuer" ||
+		annotations[MigrateAnnotation] != "true" {
+		t.Errorf("unexpected migration annotations %v", annotations)
+	}
+}
@@ -22,6 +22,8 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
 )
 
 // CanReadCertAndKey returns true if the certificate and key files already exists,
@@ -66,7 +68,7 @@ func WriteCert(certPath string, data []byte) error {
 	if err := os.MkdirAll(filepath.Dir(certPath), os.FileMode(0755)); err != nil {
 		return err
 	}
-	if err := ioutil.WriteFile(certPath, data, os.FileMode(0644)); err != nil {
+	if err := fileutil.WriteFile(certPath, data, os.FileMode(0644)); err != nil {
 		return err
 	}
 	return nil
@@ -80,7 +82,7 @@ func WriteKey(keyPath string, data []byte) error {
 	if err := os.MkdirAll(filepath.Dir(keyPath), os.FileMode(0755)); err != nil {
 		return err
 	}
-	if err := ioutil.WriteFile(keyPath, data, os.FileMode(0600)); err != nil {
+	if err := fileutil.WriteFile(keyPath, data, os.FileMode(0600)); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,162 @@
+package cloudsignal
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/logging"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/autoscaling/autoscalingiface"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+)
+
+// The auto scaling lifecycle action results
+const (
+	lifecycleContinue = "CONTINUE"
+	lifecycleAbandon  = "ABANDON"
+)
+
+var logger = logging.New("cloudsignal")
+
+var (
+	// Stack is the CloudFormation stack (name or id) signalled once bootstrapped, as cfn-signal does
+	Stack string
+	// Resource is the logical id of the stack resource waiting for the signal (the auto scaling group or instance with
+	// a CreationPolicy or an UpdatePolicy)
+	Resource string
+	// LifecycleHook is the launch lifecycle hook of the auto scaling group completed once bootstrapped
+	LifecycleHook string
+	// Region of the stack and auto scaling group, from the instance metadata when not set
+	Region string
+	// Timeout for each request
+	Timeout = 30 * time.Second
+
+	// newCloudFormation returns the CloudFormation api for a region (replaced in tests)
+	newCloudFormation = func(region string) cloudformationiface.CloudFormationAPI {
+		return cloudformation.New(session.New(awsConfig(region)))
+	}
+	// newAutoScaling returns the auto scaling api for a region (replaced in tests)
+	newAutoScaling = func(region string) autoscalingiface.AutoScalingAPI {
+		return autoscaling.New(session.New(awsConfig(region)))
+	}
+	// instance returns the id and region of this instance (replaced in tests)
+	instance = func() (string, string, error) {
+		metadata := ec2metadata.New(session.New(awsConfig("")))
+		id, err := metadata.GetMetadata("instance-id")
+		if err != nil {
+			return "", "", err
+		}
+		region, err := metadata.Region()
+		return id, region, err
+	}
+)
+
+// Enabled is true when the stack or the auto scaling group is waiting for a signal
+func Enabled() bool {
+	return len(Stack) > 0 || len(LifecycleHook) > 0
+}
+
+// Validate will check the stack is set with the resource to signal
+func Validate() error {
+	if len(Stack) > 0 && len(Resource) == 0 {
+		return fmt.Errorf("the CloudFormation stack %s needs the logical id of the resource to signal", Stack)
+	}
+	if len(Resource) > 0 && len(Stack) == 0 {
+		return fmt.Errorf("the CloudFormation resource %s needs the stack to signal", Resource)
+	}
+	return nil
+}
+
+// Send will signal the bootstrap result (success unless there's an error) to the stack and complete the lifecycle
+// hook, so stacks and rolling updates wait for the node to be ready rather than the instance to launch. Both are tried
+// even when one fails.
+func Send(bootstrapErr error) error {
+	if !Enabled() {
+		return nil
+	}
+	id, region, err := instance()
+	if err != nil {
+		return fmt.Errorf("error getting the instance id and region from the instance metadata [%v]", err)
+	}
+	if len(Region) > 0 {
+		region = Region
+	}
+	var failed []string
+	if len(Stack) > 0 {
+		if err = signalStack(newCloudFormation(region), id, bootstrapErr); err != nil {
+			failed = append(failed, fmt.Sprintf("stack %s [%v]", Stack, err))
+		}
+	}
+	if len(LifecycleHook) > 0 {
+		if err = completeLifecycleAction(newAutoScaling(region), id, bootstrapErr); err != nil {
+			failed = append(failed, fmt.Sprintf("lifecycle hook %s [%v]", LifecycleHook, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("error signalling the bootstrap result: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// signalStack will send the stack resource a success or failure signal for this instance
+func signalStack(client cloudformationiface.CloudFormationAPI, id string, bootstrapErr error) error {
+	status := cloudformation.ResourceSignalStatusSuccess
+	if bootstrapErr != nil {
+		status = cloudformation.ResourceSignalStatusFailure
+	}
+	_, err := client.SignalResource(&cloudformation.SignalResourceInput{
+		StackName:         aws.String(Stack),
+		LogicalResourceId: aws.String(Resource),
+		UniqueId:          aws.String(id),
+		Status:            aws.String(status),
+	})
+	if err != nil {
+		return err
+	}
+	logger.Printf("Signalled %s to the %s resource of stack %s", status, Resource, Stack)
+	return nil
+}
+
+// completeLifecycleAction will continue the launch of this instance (or abandon it on failure)
+func completeLifecycleAction(client autoscalingiface.AutoScalingAPI, id string, bootstrapErr error) error {
+	out, err := client.DescribeAutoScalingInstances(&autoscaling.DescribeAutoScalingInstancesInput{
+		InstanceIds: []*string{aws.String(id)},
+	})
+	if err != nil {
+		return err
+	}
+	if len(out.AutoScalingInstances) == 0 {
+		return fmt.Errorf("instance %s isn't in an auto scaling group", id)
+	}
+	group := aws.StringValue(out.AutoScalingInstances[0].AutoScalingGroupName)
+	result := lifecycleContinue
+	if bootstrapErr != nil {
+		result = lifecycleAbandon
+	}
+	_, err = client.CompleteLifecycleAction(&autoscaling.CompleteLifecycleActionInput{
+		AutoScalingGroupName:  aws.String(group),
+		LifecycleHookName:     aws.String(LifecycleHook),
+		InstanceId:            aws.String(id),
+		LifecycleActionResult: aws.String(result),
+	})
+	if err != nil {
+		return err
+	}
+	logger.Printf("Completed the %s lifecycle hook of auto scaling group %s with %s", LifecycleHook, group, result)
+	return nil
+}
+
+// awsConfig returns the config for a region (the instance metadata when empty) with the request timeout
+func awsConfig(region string) *aws.Config {
+	cfg := &aws.Config{HTTPClient: &http.Client{Timeout: Timeout}}
+	if len(region) > 0 {
+		cfg.Region = aws.String(region)
+	}
+	return cfg
+}
@@ -0,0 +1,123 @@
+package cloudsignal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/autoscaling/autoscalingiface"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+)
+
+// fakeCloudFormation records the resource signals
+type fakeCloudFormation struct {
+	cloudformationiface.CloudFormationAPI
+	region  string
+	signals []*cloudformation.SignalResourceInput
+}
+
+func (f *fakeCloudFormation) SignalResource(in *cloudformation.SignalResourceInput) (*cloudformation.SignalResourceOutput, error) {
+	if aws.StringValue(in.StackName) != "keto-compute" {
+		return nil, errors.New("ValidationError: Stack with id keto does not exist")
+	}
+	f.signals = append(f.signals, in)
+	return &cloudformation.SignalResourceOutput{}, nil
+}
+
+// fakeAutoScaling records the completed lifecycle actions
+type fakeAutoScaling struct {
+	autoscalingiface.AutoScalingAPI
+	actions []*autoscaling.CompleteLifecycleActionInput
+}
+
+func (f *fakeAutoScaling) DescribeAutoScalingInstances(in *autoscaling.DescribeAutoScalingInstancesInput) (*autoscaling.DescribeAutoScalingInstancesOutput, error) {
+	return &autoscaling.DescribeAutoScalingInstancesOutput{
+		AutoScalingInstances: []*autoscaling.InstanceDetails{
+			{InstanceId: in.InstanceIds[0], AutoScalingGroupName: aws.String("keto-compute-asg")},
+		},
+	}, nil
+}
+
+func (f *fakeAutoScaling) CompleteLifecycleAction(in *autoscaling.CompleteLifecycleActionInput) (*autoscaling.CompleteLifecycleActionOutput, error) {
+	f.actions = append(f.actions, in)
+	return &autoscaling.CompleteLifecycleActionOutput{}, nil
+}
+
+func TestValidate(t *testing.T) {
+	defer func(s, r string) { Stack, Resource = s, r }(Stack, Resource)
+	for _, c := range []struct {
+		stack, resource string
+		valid           bool
+	}{
+		{"", "", true},
+		{"keto-compute", "ComputeGroup", true},
+		{"keto-compute", "", false},
+		{"", "ComputeGroup", false},
+	} {
+		Stack, Resource = c.stack, c.resource
+		if err := Validate(); (err == nil) != c.valid {
+			t.Errorf("expected stack %q and resource %q valid %v but got %v", c.stack, c.resource, c.valid, err)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	defer func(s, r, h, rg string) { Stack, Resource, LifecycleHook, Region = s, r, h, rg }(Stack, Resource, LifecycleHook, Region)
+	defer func(cf func(string) cloudformationiface.CloudFormationAPI, as func(string) autoscalingiface.AutoScalingAPI,
+		i func() (string, string, error)) {
+		newCloudFormation, newAutoScaling, instance = cf, as, i
+	}(newCloudFormation, newAutoScaling, instance)
+	cfn := &fakeCloudFormation{}
+	asg := &fakeAutoScaling{}
+	newCloudFormation = func(region string) cloudformationiface.CloudFormationAPI {
+		cfn.region = region
+		return cfn
+	}
+	newAutoScaling = func(string) autoscalingiface.AutoScalingAPI { return asg }
+	instance = func() (string, string, error) { return "i-0123456789", "eu-west-2", nil }
+
+	Stack, Resource, LifecycleHook, Region = "", "", "", ""
+	if err := Send(nil); err != nil || len(cfn.signals) != 0 || len(asg.actions) != 0 {
+		t.Fatalf("expected nothing signalled when disabled but got %v", err)
+	}
+
+	Stack, Resource, LifecycleHook = "keto-compute", "ComputeGroup", "keto-launch"
+	if err := Send(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := Send(errors.New("error joining the cluster")); err != nil {
+		t.Fatal(err)
+	}
+	if cfn.region != "eu-west-2" {
+		t.Errorf("expected the instance region but got %q", cfn.region)
+	}
+	if len(cfn.signals) != 2 || aws.StringValue(cfn.signals[0].Status) != "SUCCESS" ||
+		aws.StringValue(cfn.signals[1].Status) != "FAILURE" {
+		t.Fatalf("unexpected signals %v", cfn.signals)
+	}
+	if aws.StringValue(cfn.signals[0].UniqueId) != "i-0123456789" ||
+		aws.StringValue(cfn.signals[0].LogicalResourceId) != "ComputeGroup" {
+		t.Errorf("unexpected signal %v", cfn.signals[0])
+	}
+	if len(asg.actions) != 2 || aws.StringValue(asg.actions[0].LifecycleActionResult) != "CONTINUE" ||
+		aws.StringValue(asg.actions[1].LifecycleActionResult) != "ABANDON" {
+		t.Fatalf("unexpected lifecycle actions %v", asg.actions)
+	}
+	if aws.StringValue(asg.actions[0].AutoScalingGroupName) != "keto-compute-asg" {
+		t.Errorf("unexpected auto scaling group %q", aws.StringValue(asg.actions[0].AutoScalingGroupName))
+	}
+
+	// A failed signal doesn't stop the lifecycle hook being completed
+	Stack, Region = "keto", "eu-west-1"
+	err := Send(nil)
+	if err == nil || !strings.Contains(err.Error(), "stack keto") {
+		t.Errorf("expected the stack signal to fail but got %v", err)
+	}
+	if len(asg.actions) != 3 || cfn.region != "eu-west-1" {
+		t.Errorf("expected the lifecycle hook completed in the set region but got %d actions in %q", len(asg.actions),
+			cfn.region)
+	}
+}
@@ -0,0 +1,188 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/logging"
+	"github.com/UKHomeOffice/keto-k8/pkg/profile"
+)
+
+// DefaultTimeouts are how long kubeadm and kubectl can run for (other commands have no timeout unless set)
+const DefaultTimeouts = "kubeadm=5m,kubectl=2m"
+
+var (
+	mu sync.Mutex
+	// defaultTimeout is for any command without its own timeout (0 for no timeout)
+	defaultTimeout time.Duration
+	timeouts       = map[string]time.Duration{}
+)
+
+func init() {
+	SetTimeouts(DefaultTimeouts)
+}
+
+// TimeoutError is returned when a command is killed for running longer than its timeout
+type TimeoutError struct {
+	Name    string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %v", e.Name, e.Timeout)
+}
+
+// SetTimeouts sets the timeouts from a spec, optionally per command e.g. 10m,kubectl=2m (0 for no timeout)
+func SetTimeouts(spec string) error {
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name := ""
+		value := item
+		if parts := strings.SplitN(item, "=", 2); len(parts) == 2 {
+			name, value = parts[0], parts[1]
+		}
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid command timeout %q: %v", item, err)
+		}
+		SetTimeout(name, timeout)
+	}
+	return nil
+}
+
+// SetTimeout sets the timeout for a command (or the default timeout when the name is empty)
+func SetTimeout(name string, timeout time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	if name == "" {
+		defaultTimeout = timeout
+		return
+	}
+	timeouts[name] = timeout
+}
+
+// Timeout returns the timeout for a command (0 for no timeout)
+func Timeout(name string) time.Duration {
+	mu.Lock()
+	defer mu.Unlock()
+	if timeout, ok := timeouts[name]; ok {
+		return timeout
+	}
+	return defaultTimeout
+}
+
+// newCommand returns the command and a cancel func which must be called once it's finished
+// The command is killed once its timeout passes
+func newCommand(name string, args ...string) (*exec.Cmd, context.Context, context.CancelFunc) {
+	ctx, cancel := context.Background(), func() {}
+	if timeout := Timeout(name); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	return exec.CommandContext(ctx, name, args...), ctx, cancel
+}
+
+// run will run the command recording the time taken (e.g. "kubectl apply") when profiling
+func run(cmd *exec.Cmd) error {
+	started := time.Now()
+	err := cmd.Run()
+	var cpu time.Duration
+	if cmd.ProcessState != nil {
+		cpu = cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()
+	}
+	name := cmd.Args[0]
+	if len(cmd.Args) > 1 {
+		name += " " + cmd.Args[1]
+	}
+	profile.Record(name, time.Since(started), cpu)
+	return err
+}
+
+// timeoutError returns a TimeoutError when the command was killed for timing out (otherwise err)
+func timeoutError(ctx context.Context, name string, err error) error {
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return &TimeoutError{Name: name, Timeout: Timeout(name)}
+	}
+	return err
+}
+
+// Run will run a command logging each line of output as it's written (prefixed with the command name)
+// The combined output is also returned e.g. for error messages
+// A TimeoutError is returned if the command is killed for running longer than its timeout
+func Run(logger *logging.Logger, stdin, name string, args ...string) (string, error) {
+	var out bytes.Buffer
+	w := &lineWriter{logger: logger, prefix: name, out: &out}
+
+	cmd, ctx, cancel := newCommand(name, args...)
+	defer cancel()
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	err := run(cmd)
+	w.flush()
+	return out.String(), timeoutError(ctx, name, err)
+}
+
+// Output will run a command only logging stderr as it's written
+// Use where stdout is data rather than progress (e.g. json or credentials)
+// Stdout is returned and stderr is included in any error
+func Output(logger *logging.Logger, stdin, name string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	w := &lineWriter{logger: logger, prefix: name, out: &stderr}
+
+	cmd, ctx, cancel := newCommand(name, args...)
+	defer cancel()
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = w
+	err := run(cmd)
+	w.flush()
+	if err = timeoutError(ctx, name, err); err != nil {
+		if _, timedOut := err.(*TimeoutError); timedOut {
+			return stdout.String(), err
+		}
+		return stdout.String(), fmt.Errorf("%s failed [%v]:%s", name, err, stderr.String())
+	}
+	return stdout.String(), nil
+}
+
+// lineWriter logs complete lines and keeps a copy of everything written
+type lineWriter struct {
+	logger  *logging.Logger
+	prefix  string
+	out     *bytes.Buffer
+	partial []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.out.Write(p)
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.log(w.partial[:i])
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush will log any output without a trailing newline
+func (w *lineWriter) flush() {
+	if len(w.partial) > 0 {
+		w.log(w.partial)
+		w.partial = nil
+	}
+}
+
+func (w *lineWriter) log(line []byte) {
+	w.logger.Printf("[%s] %s", w.prefix, strings.TrimRight(string(line), "\r"))
+}
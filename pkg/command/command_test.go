@@ -0,0 +1,77 @@
+package command
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/logging"
+)
+
+func TestRun(t *testing.T) {
+	var b bytes.Buffer
+	logging.SetOutput(&b)
+	defer logging.SetOutput(os.Stderr)
+
+	out, err := Run(logging.New("test"), "in", "sh", "-c", "cat; echo; echo line2; printf partial >&2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "in\nline2\npartial" {
+		t.Errorf("unexpected output %q", out)
+	}
+	logs := b.String()
+	for _, expected := range []string{"[sh] in", "[sh] line2", "[sh] partial"} {
+		if !strings.Contains(logs, expected) {
+			t.Errorf("expected %q to be logged but got:\n%s", expected, logs)
+		}
+	}
+}
+
+func TestOutput(t *testing.T) {
+	var b bytes.Buffer
+	logging.SetOutput(&b)
+	defer logging.SetOutput(os.Stderr)
+
+	out, err := Output(logging.New("test"), "", "sh", "-c", "echo secret; echo progress >&2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "secret\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+	if strings.Contains(b.String(), "secret") || !strings.Contains(b.String(), "[sh] progress") {
+		t.Errorf("expected only stderr to be logged but got:\n%s", b.String())
+	}
+
+	if _, err = Output(logging.New("test"), "", "sh", "-c", "echo failed >&2; exit 1"); err == nil || !strings.Contains(err.Error(), "failed") {
+		t.Errorf("expected an error with stderr but got %v", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	defer SetTimeouts("0," + DefaultTimeouts)
+	if err := SetTimeouts("1m,sleep=50ms"); err != nil {
+		t.Fatal(err)
+	}
+	if Timeout("kubectl") != 2*time.Minute || Timeout("docker") != time.Minute {
+		t.Errorf("expected the kubectl and default timeouts but got %v and %v", Timeout("kubectl"), Timeout("docker"))
+	}
+
+	started := time.Now()
+	_, err := Run(logging.New("test"), "", "sleep", "5")
+	if e, ok := err.(*TimeoutError); !ok || e.Name != "sleep" {
+		t.Errorf("expected a timeout error but got %v", err)
+	}
+	if _, err = Output(logging.New("test"), "", "sleep", "5"); err == nil || err.Error() != "sleep timed out after 50ms" {
+		t.Errorf("expected a timeout error but got %v", err)
+	}
+	if time.Since(started) > 2*time.Second {
+		t.Error("expected sleep to be killed")
+	}
+	if err = SetTimeouts("kubectl=later"); err == nil {
+		t.Error("expected an error for an invalid timeout")
+	}
+}
@@ -20,4 +20,19 @@ const (
 
 	// KubeletUnitFileName is the location to save the systemd file for the kubelet
 	KubeletUnitFileName = "/etc/systemd/system/kubelet.service"
+
+	// ManagedByLabel is set on all the cluster resources deployed by keto-k8
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+
+	// ManagedByValue is the value of the ManagedByLabel
+	ManagedByValue = "keto-k8"
+
+	// AddonLabel is set to the name of the keto-k8 addon a resource belongs to
+	AddonLabel = "keto-k8/addon"
+
+	// GPULabel is set on compute nodes with GPUs to the GPU vendor (the device plugin addon is scheduled by it)
+	GPULabel = "keto-k8/gpu"
+
+	// GPUTaint keeps pods which don't request GPUs off GPU nodes
+	GPUTaint = "nvidia.com/gpu"
 )
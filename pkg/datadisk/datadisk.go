@@ -0,0 +1,139 @@
+package datadisk
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/command"
+	"github.com/UKHomeOffice/keto-k8/pkg/logging"
+)
+
+// DefaultMountPoint is where the data disk is mounted
+const DefaultMountPoint = "/mnt/keto-k8-data"
+
+var (
+	// Device is an instance-store (or extra EBS) volume for the kubelet and container runtime data (empty to not use one)
+	Device string
+	// MountPoint is where the device is mounted
+	MountPoint = DefaultMountPoint
+	// FSType is the filesystem a device without one is formatted with
+	FSType = "ext4"
+	// KubeletDir is the kubelet root moved onto the device
+	KubeletDir = "/var/lib/kubelet"
+	// RuntimeDir is the container runtime root moved onto the device
+	RuntimeDir = "/var/lib/docker"
+	// RuntimeUnit is the container runtime stopped while its root is moved
+	RuntimeUnit = "docker.service"
+
+	logger = logging.New("datadisk")
+
+	// procMounts lists what's mounted (replaced by tests)
+	procMounts = "/proc/mounts"
+
+	// run runs the commands to inspect, format and mount devices (replaced by tests)
+	run = func(name string, args ...string) (string, error) {
+		return command.Output(logger, "", name, args...)
+	}
+)
+
+// Prepare will format the device (only when it has no filesystem), mount it and bind mount the kubelet and container
+// runtime roots onto it. It must run before the kubelet starts and is safe to re-run e.g. on every boot (an
+// instance-store volume is empty again after a stop / start). Nothing is done without a device.
+func Prepare() error {
+	if len(Device) == 0 {
+		return nil
+	}
+	// The device may be a link e.g. /dev/disk/by-id/... (mounts list the device itself)
+	device, err := filepath.EvalSymlinks(Device)
+	if err != nil {
+		return fmt.Errorf("data disk %s not found [%v]", Device, err)
+	}
+	mounts, err := readMounts()
+	if err != nil {
+		return err
+	}
+	if source, ok := mounts[MountPoint]; ok && source != device {
+		return fmt.Errorf("%s already has %s mounted (not the data disk %s)", MountPoint, source, Device)
+	}
+	if _, ok := mounts[MountPoint]; !ok {
+		if err = format(); err != nil {
+			return err
+		}
+		if err = os.MkdirAll(MountPoint, 0755); err != nil {
+			return err
+		}
+		logger.Printf("Mounting the data disk %s on %s", Device, MountPoint)
+		if _, err = run("mount", Device, MountPoint); err != nil {
+			return err
+		}
+	}
+	if err = relocate(KubeletDir, mounts, ""); err != nil {
+		return err
+	}
+	return relocate(RuntimeDir, mounts, RuntimeUnit)
+}
+
+// format will make a filesystem on the device unless it already has one (so data isn't lost when re-run)
+func format() error {
+	fsType, err := run("lsblk", "--nodeps", "--noheadings", "--output", "FSTYPE", Device)
+	if err != nil {
+		return err
+	}
+	if fsType = strings.TrimSpace(fsType); len(fsType) > 0 {
+		logger.Printf("The data disk %s already has a %s filesystem", Device, fsType)
+		return nil
+	}
+	logger.Printf("Formatting the data disk %s (%s)", Device, FSType)
+	_, err = run("mkfs."+FSType, Device)
+	return err
+}
+
+// relocate will bind mount a directory on the data disk onto a path (unless already mounted), the unit using the
+// path is stopped while it's mounted
+func relocate(path string, mounts map[string]string, unit string) error {
+	if _, ok := mounts[path]; ok {
+		return nil
+	}
+	dir := filepath.Join(MountPoint, filepath.Base(path))
+	for _, d := range []string{dir, path} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return err
+		}
+	}
+	if len(unit) > 0 {
+		logger.Printf("Stopping %s to move %s to the data disk", unit, path)
+		if _, err := run("systemctl", "stop", unit); err != nil {
+			return err
+		}
+	}
+	logger.Printf("Bind mounting %s on %s", dir, path)
+	if _, err := run("mount", "--bind", dir, path); err != nil {
+		return err
+	}
+	if len(unit) > 0 {
+		if _, err := run("systemctl", "start", unit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readMounts returns the source of each mount point
+func readMounts() (map[string]string, error) {
+	f, err := os.Open(procMounts)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	mounts := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 1 {
+			mounts[fields[1]] = fields[0]
+		}
+	}
+	return mounts, scanner.Err()
+}
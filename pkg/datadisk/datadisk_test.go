@@ -0,0 +1,106 @@
+package datadisk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrepare(t *testing.T) {
+	dir, err := ioutil.TempDir("", "datadisk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(device, mountPoint, kubeletDir, runtimeDir, mounts string, r func(string, ...string) (string, error)) {
+		Device, MountPoint, KubeletDir, RuntimeDir, procMounts, run = device, mountPoint, kubeletDir, runtimeDir, mounts, r
+	}(Device, MountPoint, KubeletDir, RuntimeDir, procMounts, run)
+
+	// Nothing to do without a device
+	Device = ""
+	if err = Prepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	Device = filepath.Join(dir, "nvme1n1")
+	MountPoint = filepath.Join(dir, "mnt")
+	KubeletDir = filepath.Join(dir, "var", "lib", "kubelet")
+	RuntimeDir = filepath.Join(dir, "var", "lib", "docker")
+	procMounts = filepath.Join(dir, "mounts")
+	if err = Prepare(); err == nil {
+		t.Error("expected an error for a missing device")
+	}
+	if err = ioutil.WriteFile(Device, []byte{}, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The commands are faked, mounts are recorded in the mounts file
+	var commands []string
+	fsType := ""
+	run = func(name string, args ...string) (string, error) {
+		commands = append(commands, name+" "+strings.Join(args, " "))
+		switch name {
+		case "lsblk":
+			return fsType + "\n", nil
+		case "mount":
+			f, err := os.OpenFile(procMounts, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+			if err != nil {
+				return "", err
+			}
+			defer f.Close()
+			_, err = fmt.Fprintf(f, "%s %s ext4 rw 0 0\n", args[len(args)-2], args[len(args)-1])
+			return "", err
+		}
+		return "", nil
+	}
+	if err = ioutil.WriteFile(procMounts, []byte("/dev/xvda1 / ext4 rw 0 0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"lsblk --nodeps --noheadings --output FSTYPE " + Device,
+		"mkfs.ext4 " + Device,
+		"mount " + Device + " " + MountPoint,
+		"mount --bind " + filepath.Join(MountPoint, "kubelet") + " " + KubeletDir,
+		"systemctl stop docker.service",
+		"mount --bind " + filepath.Join(MountPoint, "docker") + " " + RuntimeDir,
+		"systemctl start docker.service",
+	}
+	if strings.Join(commands, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected commands:\n%s\nbut got:\n%s", strings.Join(expected, "\n"), strings.Join(commands, "\n"))
+	}
+
+	// Re-running does nothing once mounted
+	commands = nil
+	if err = Prepare(); err != nil || len(commands) != 0 {
+		t.Errorf("expected nothing to be done when already prepared but got %v %v", commands, err)
+	}
+
+	// A device with a filesystem (e.g. an EBS volume after a reboot) isn't formatted
+	commands = nil
+	fsType = "ext4"
+	if err = ioutil.WriteFile(procMounts, []byte{}, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range commands {
+		if strings.HasPrefix(c, "mkfs") {
+			t.Errorf("expected a device with a filesystem not to be formatted but got %v", commands)
+		}
+	}
+
+	// Another device on the mount point is an error
+	if err = ioutil.WriteFile(procMounts, []byte("/dev/xvdf "+MountPoint+" ext4 rw 0 0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = Prepare(); err == nil {
+		t.Error("expected an error when another device is mounted on the mount point")
+	}
+}
@@ -0,0 +1,155 @@
+package drift
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+)
+
+// ArtifactName is the manifest of written files saved in the artifacts directory
+const ArtifactName = "written-files.json"
+
+// Changes found by Verify
+const (
+	// Modified files have different content
+	Modified = "modified"
+	// Removed files no longer exist
+	Removed = "removed"
+	// ModeChanged files have the same content but different permissions
+	ModeChanged = "mode changed"
+)
+
+// CheckInterval is how often a running kmm verifies the written files (0 to disable)
+var CheckInterval time.Duration
+
+// Entry is a written file
+type Entry struct {
+	Path   string      `json:"path"`
+	SHA256 string      `json:"sha256"`
+	Mode   os.FileMode `json:"mode"`
+}
+
+// Manifest is every file written with its checksum
+type Manifest struct {
+	Created time.Time `json:"created"`
+	Files   []Entry   `json:"files"`
+}
+
+// Change is a file modified or removed since it was written
+type Change struct {
+	Path   string
+	Change string
+}
+
+func (c Change) String() string {
+	return c.Path + " " + c.Change
+}
+
+// Record will save the checksums of all the files matching the patterns to a manifest file (sorted, symlinks are
+// followed)
+func Record(file string, patterns ...string) (*Manifest, error) {
+	m := &Manifest{Created: time.Now().UTC(), Files: []Entry{}}
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			if seen[match] {
+				continue
+			}
+			seen[match] = true
+			e, err := entry(match)
+			if err != nil {
+				return nil, err
+			}
+			if e.Mode.IsDir() {
+				continue
+			}
+			m.Files = append(m.Files, e)
+		}
+	}
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Path < m.Files[j].Path })
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return nil, err
+	}
+	if err = fileutil.WriteFile(file, data, 0600); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Load returns a saved manifest
+func Load(file string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{}
+	if err = json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s [%v]", file, err)
+	}
+	return m, nil
+}
+
+// Verify returns the files in a saved manifest which have changed since they were written
+// Files created since aren't reported
+func Verify(file string) ([]Change, error) {
+	m, err := Load(file)
+	if err != nil {
+		return nil, err
+	}
+	return m.Changes()
+}
+
+// Changes returns the files which are different to the manifest
+func (m *Manifest) Changes() ([]Change, error) {
+	var changes []Change
+	for _, expected := range m.Files {
+		current, err := entry(expected.Path)
+		if os.IsNotExist(err) {
+			changes = append(changes, Change{Path: expected.Path, Change: Removed})
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if current.SHA256 != expected.SHA256 {
+			changes = append(changes, Change{Path: expected.Path, Change: Modified})
+		} else if current.Mode != expected.Mode {
+			changes = append(changes, Change{Path: expected.Path, Change: ModeChanged})
+		}
+	}
+	return changes, nil
+}
+
+// entry returns the checksum and mode of a file (only the mode of a directory)
+func entry(file string) (Entry, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return Entry{}, err
+	}
+	e := Entry{Path: file, Mode: info.Mode()}
+	if info.IsDir() {
+		return e, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return Entry{}, err
+	}
+	sum := sha256.Sum256(data)
+	e.SHA256 = hex.EncodeToString(sum[:])
+	return e, nil
+}
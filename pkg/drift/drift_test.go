@@ -0,0 +1,53 @@
+package drift
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRecordVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drift")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "state", "written-files.json")
+
+	files := map[string]string{"admin.conf": "admin", "kubelet.conf": "kubelet", "sa.key": "key", "ca.crt": "ca"}
+	for name, data := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := Record(file, filepath.Join(dir, "*.conf"), filepath.Join(dir, "sa.*"), filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each file once (the state dir isn't a file)
+	if len(m.Files) != 4 || m.Files[0].Path != filepath.Join(dir, "admin.conf") {
+		t.Errorf("expected each file once (sorted) but got %+v", m.Files)
+	}
+	if changes, err := Verify(file); err != nil || len(changes) != 0 {
+		t.Errorf("expected no changes but got %v [%v]", changes, err)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "admin.conf"), []byte("changed"), 0600)
+	os.Remove(filepath.Join(dir, "sa.key"))
+	os.Chmod(filepath.Join(dir, "ca.crt"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "new.conf"), []byte("new"), 0600)
+	changes, err := Verify(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Change{
+		{Path: filepath.Join(dir, "admin.conf"), Change: Modified},
+		{Path: filepath.Join(dir, "ca.crt"), Change: ModeChanged},
+		{Path: filepath.Join(dir, "sa.key"), Change: Removed},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected %v but got %v", expected, changes)
+	}
+}
@@ -0,0 +1,243 @@
+// Package e2e runs real keto-k8 bootstraps in docker (kind style) for integration tests
+// A privileged node container (with systemd and docker in docker) runs the master bootstrap
+// against a throwaway etcd container on a dedicated docker network
+package e2e
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/command"
+	"github.com/UKHomeOffice/keto-k8/pkg/kmm"
+	"github.com/UKHomeOffice/keto-k8/pkg/logging"
+)
+
+// Default images
+const (
+	DefaultNodeImage   = "quay.io/ukhomeofficedigital/keto-k8-e2e:latest"
+	DefaultKetoK8Image = "quay.io/ukhomeofficedigital/keto-k8"
+	DefaultEtcdImage   = "quay.io/coreos/etcd:v3.1.3"
+)
+
+// Paths in the node container (as expected by keto-k8)
+const (
+	nodeCADir   = "/data/ca/kube"
+	nodeCACert  = nodeCADir + "/ca.crt"
+	nodeCAKey   = nodeCADir + "/ca.key"
+	etcdAddress = "etcd"
+)
+
+// ReadyTimeout is how long to wait for systemd and docker in the node container
+var ReadyTimeout = 2 * time.Minute
+
+// logger is used for all the e2e logs
+var logger = logging.New("e2e")
+
+// Driver will create and bootstrap a node (and etcd) in docker
+type Driver struct {
+	// Name prefixes the docker network and containers (must be unique per run)
+	Name string
+	// NodeImage must run systemd and include docker (see tests/e2e-container)
+	NodeImage string
+	// KetoK8Image is the keto-k8 image to test (must exist locally as it's copied into the node)
+	KetoK8Image string
+	// EtcdImage is for the throwaway etcd
+	EtcdImage string
+	// KubeVersion to bootstrap e.g. v1.7.0
+	KubeVersion string
+	// NetworkProvider e.g. flannel
+	NetworkProvider string
+	// ExtraArgs are added to the keto-k8 master command
+	ExtraArgs []string
+
+	up bool
+}
+
+// New returns a driver with the default images
+func New(name, kubeVersion string) *Driver {
+	return &Driver{
+		Name:            name,
+		NodeImage:       DefaultNodeImage,
+		KetoK8Image:     DefaultKetoK8Image,
+		EtcdImage:       DefaultEtcdImage,
+		KubeVersion:     kubeVersion,
+		NetworkProvider: "flannel",
+	}
+}
+
+// NodeName is the name of the node container (and kubernetes node)
+func (d *Driver) NodeName() string {
+	return d.Name + "-node"
+}
+
+func (d *Driver) etcdName() string {
+	return d.Name + "-etcd"
+}
+
+// Up will start etcd and the node containers ready for a bootstrap
+func (d *Driver) Up() (err error) {
+	if d.Name == "" || d.KubeVersion == "" {
+		return fmt.Errorf("a name and kube version are required")
+	}
+	d.up = true
+	if _, err = docker("network", "create", d.Name); err != nil {
+		return err
+	}
+	// No TLS or persistent data - thrown away with the run
+	if _, err = docker("run", "-d",
+		"--name", d.etcdName(),
+		"--network", d.Name,
+		"--network-alias", etcdAddress,
+		"--tmpfs", "/var/lib/etcd",
+		d.EtcdImage,
+		"etcd",
+		"--data-dir=/var/lib/etcd",
+		"--listen-client-urls=http://0.0.0.0:2379",
+		"--advertise-client-urls=http://"+etcdAddress+":2379"); err != nil {
+		return err
+	}
+	if _, err = docker("run", "-d",
+		"--name", d.NodeName(),
+		"--hostname", d.NodeName(),
+		"--network", d.Name,
+		"--privileged",
+		"--security-opt", "seccomp:unconfined",
+		"--cap-add=SYS_ADMIN",
+		"-v", "/sys/fs/cgroup:/sys/fs/cgroup:ro",
+		"--tmpfs", "/run",
+		d.NodeImage); err != nil {
+		return err
+	}
+	if err = d.waitFor("systemctl status", "systemd"); err != nil {
+		return err
+	}
+	if _, err = d.Exec("systemctl start docker dnsmasq"); err != nil {
+		return err
+	}
+	if err = d.waitFor("docker info", "docker"); err != nil {
+		return err
+	}
+	if err = d.prepareNode(); err != nil {
+		return err
+	}
+	return d.loadImage()
+}
+
+// prepareNode will create the kubelet wrapper dependencies and kube CA (as a cloud provider would)
+func (d *Driver) prepareNode() error {
+	// The kubelet must see the same hostname as this container (resolved by dnsmasq)
+	if _, err := d.Exec(strings.Join([]string{
+		"mkdir -p /etc/systemd/system/kubelet.service.d " + nodeCADir + " /run/kubeapiserver /etc/kubernetes /usr/share/ca-certificates /lib/modules",
+		`printf '[Service]\nEnvironment="RKT_RUN_ARGS=--no-overlay --volume etc-hosts,kind=host,source=/etc/hosts --mount volume=etc-hosts,target=/etc/hosts"\n' > /etc/systemd/system/kubelet.service.d/10-mount-hosts.conf`,
+		"grep -q 'nameserver 127.0.0.1' /etc/resolv.conf || echo 'nameserver 127.0.0.1' >> /etc/resolv.conf",
+		"echo COREOS_PRIVATE_IPV4=" + d.NodeName() + " > /etc/environment",
+	}, " && ")); err != nil {
+		return err
+	}
+	dir, err := ioutil.TempDir("", d.Name)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if err = kmm.EnsureLocalCA(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")); err != nil {
+		return err
+	}
+	for _, f := range []string{"ca.crt", "ca.key"} {
+		if _, err = docker("cp", filepath.Join(dir, f), d.NodeName()+":"+nodeCADir+"/"+f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadImage will copy the keto-k8 image into the docker daemon of the node
+func (d *Driver) loadImage() error {
+	_, err := command.Run(logger, "", "sh", "-c",
+		fmt.Sprintf("docker save %s | docker exec -i %s docker load", d.KetoK8Image, d.NodeName()))
+	return err
+}
+
+// Bootstrap will run the keto-k8 master bootstrap in the node (to completion)
+func (d *Driver) Bootstrap() error {
+	args := append([]string{
+		"docker", "run", "--rm", "--net=host",
+		"-v", "/sys/fs/cgroup:/sys/fs/cgroup",
+		"-v", nodeCADir + ":" + nodeCADir,
+		"-v", "/run/kubeapiserver:/run/kubeapiserver",
+		"-v", "/etc/kubernetes/:/etc/kubernetes/",
+		"-v", "/var/run/dbus/:/var/run/dbus/",
+		"-v", "/etc/systemd/system/:/etc/systemd/system/",
+		"-e", "COREOS_PRIVATE_IPV4=" + d.NodeName(),
+		d.KetoK8Image,
+		"master",
+		"--cloud-provider=",
+		"--etcd-endpoints=http://" + etcdAddress + ":2379",
+		"--etcd-cluster-hostnames=" + d.NodeName(),
+		"--kube-ca-cert=" + nodeCACert,
+		"--kube-ca-key=" + nodeCAKey,
+		"--kube-server=https://" + d.NodeName(),
+		"--kube-version=" + d.KubeVersion,
+		"--network-provider=" + d.NetworkProvider,
+		"--exit-on-completion",
+	}, d.ExtraArgs...)
+	_, err := d.Exec(strings.Join(args, " "))
+	return err
+}
+
+// Kubectl will run kubectl (from the keto-k8 image) in the node with the admin kubeconfig
+func (d *Driver) Kubectl(args ...string) (string, error) {
+	return d.Exec(strings.Join(append([]string{
+		"docker", "run", "--rm", "--net=host", "--entrypoint=kubectl",
+		"-v", "/etc/kubernetes/:/etc/kubernetes/",
+		d.KetoK8Image,
+	}, args...), " "))
+}
+
+// Exec will run a shell command in the node container
+func (d *Driver) Exec(cmd string) (string, error) {
+	return docker("exec", d.NodeName(), "sh", "-c", cmd)
+}
+
+// Logs returns the logs of the kubelet (and any containers) on the node e.g. to report a failed bootstrap
+func (d *Driver) Logs() string {
+	out, _ := d.Exec("journalctl --no-pager -u kubelet; for c in $(docker ps -aq); do docker logs $c 2>&1; done")
+	return out
+}
+
+// Down will remove the containers and network (errors are only logged)
+func (d *Driver) Down() {
+	if !d.up {
+		return
+	}
+	for _, args := range [][]string{
+		{"rm", "-f", "-v", d.NodeName(), d.etcdName()},
+		{"network", "rm", d.Name},
+	} {
+		if _, err := docker(args...); err != nil {
+			logger.Warnf("error removing e2e resources: %v", err)
+		}
+	}
+	d.up = false
+}
+
+// waitFor will retry a command in the node until it succeeds
+func (d *Driver) waitFor(cmd, what string) error {
+	deadline := time.Now().Add(ReadyTimeout)
+	for {
+		if _, err := docker("exec", d.NodeName(), "sh", "-c", cmd+" >/dev/null 2>&1"); err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for %s in %s", what, d.NodeName())
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func docker(args ...string) (string, error) {
+	return command.Run(logger, "", "docker", args...)
+}
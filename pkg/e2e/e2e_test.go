@@ -0,0 +1,37 @@
+package e2e
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestMasterBootstrap requires docker and a local keto-k8 image e.g.
+// KETO_K8_E2E=true KETO_K8_IMAGE=quay.io/ukhomeofficedigital/keto-k8:latest go test ./pkg/e2e/
+func TestMasterBootstrap(t *testing.T) {
+	if testing.Short() || os.Getenv("KETO_K8_E2E") != "true" {
+		t.Skip("skipping e2e test (set KETO_K8_E2E=true to run)")
+	}
+	d := New("ketok8e2e", os.Getenv("K8S_VERSION"))
+	if d.KubeVersion == "" {
+		d.KubeVersion = "v1.7.0"
+	}
+	if image := os.Getenv("KETO_K8_IMAGE"); image != "" {
+		d.KetoK8Image = image
+	}
+	defer d.Down()
+
+	if err := d.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Bootstrap(); err != nil {
+		t.Fatalf("bootstrap failed: %v\n%s", err, d.Logs())
+	}
+	nodes, err := d.Kubectl("get", "nodes", "-o", "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(nodes, d.NodeName()) {
+		t.Errorf("expected node %s to be registered but got %s", d.NodeName(), nodes)
+	}
+}
@@ -0,0 +1,212 @@
+package etcd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Discovery sources
+const (
+	// ServiceSource resolves the endpoints of a Service e.g. service/etcd/shared-etcd:client
+	ServiceSource = "service"
+	// EtcdClusterSource resolves the client Service of an etcd-operator EtcdCluster e.g. etcdcluster/etcd/shared
+	EtcdClusterSource = "etcdcluster"
+
+	// etcdOperatorClientPort is the client port of the etcd-operator client Service
+	etcdOperatorClientPort = 2379
+)
+
+// servicePort is a port of a Service (or its endpoints)
+type servicePort struct {
+	Name string `json:"name"`
+	Port int    `json:"port"`
+}
+
+// apiGetter returns the body of an api GET request (replaced in tests)
+type apiGetter func(uri string) ([]byte, error)
+
+// Discover returns the etcd endpoints (comma separated) from a Service or etcd-operator EtcdCluster in a management
+// cluster, for when the shared etcd isn't reachable at static endpoints or by DNS SRV. The source is
+// service/<namespace>/<name>[:<port name>] or etcdcluster/<namespace>/<name> and the kubeconfig is for the
+// management cluster. The endpoints use the scheme e.g. https with client certs.
+func Discover(kubeConfig, source, scheme string) (string, error) {
+	if err := ValidateDiscoverySource(source); err != nil {
+		return "", err
+	}
+	if len(kubeConfig) == 0 {
+		return "", fmt.Errorf("a kubeconfig for the management cluster is required to discover the etcd endpoints")
+	}
+	config, err := clientcmd.BuildConfigFromFlags("", kubeConfig)
+	if err != nil {
+		return "", fmt.Errorf("error loading the etcd discovery kubeconfig %s [%v]", kubeConfig, err)
+	}
+	transport, err := rest.TransportFor(config)
+	if err != nil {
+		return "", err
+	}
+	client := &http.Client{Transport: transport, Timeout: Timeout}
+	get := func(uri string) ([]byte, error) {
+		resp, err := client.Get(strings.TrimSuffix(config.Host, "/") + uri)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s returned %s: %s", uri, resp.Status, body)
+		}
+		return body, nil
+	}
+	endpoints, err := discoverEndpoints(get, source, scheme)
+	if err != nil {
+		return "", fmt.Errorf("error discovering the etcd endpoints from %s [%v]", source, err)
+	}
+	logger.Printf("Discovered etcd endpoints %s from %s", endpoints, source)
+	return endpoints, nil
+}
+
+// ValidateDiscoverySource will check the source is a known kind with a namespace and name
+func ValidateDiscoverySource(source string) error {
+	_, _, _, _, err := parseSource(source)
+	return err
+}
+
+// discoverEndpoints resolves the endpoints of a source
+func discoverEndpoints(get apiGetter, source, scheme string) (string, error) {
+	kind, namespace, name, port, err := parseSource(source)
+	if err != nil {
+		return "", err
+	}
+	if kind == EtcdClusterSource {
+		if name, err = etcdClusterService(get, namespace, name); err != nil {
+			return "", err
+		}
+	}
+	addresses, err := serviceAddresses(get, namespace, name, port)
+	if err != nil {
+		return "", err
+	}
+	if len(addresses) == 0 {
+		return "", fmt.Errorf("service %s/%s has no load balancer address yet", namespace, name)
+	}
+	for i, a := range addresses {
+		addresses[i] = scheme + "://" + a
+	}
+	return strings.Join(addresses, ","), nil
+}
+
+// parseSource returns the kind, namespace, name and any port name of a source
+func parseSource(source string) (kind, namespace, name, port string, err error) {
+	parts := strings.Split(source, "/")
+	if len(parts) != 3 || len(parts[1]) == 0 || len(parts[2]) == 0 {
+		return "", "", "", "", fmt.Errorf("invalid etcd discovery %q, must be %s/<namespace>/<name>[:<port name>] or %s/<namespace>/<name>",
+			source, ServiceSource, EtcdClusterSource)
+	}
+	kind, namespace, name = parts[0], parts[1], parts[2]
+	if i := strings.Index(name, ":"); i >= 0 {
+		name, port = name[:i], name[i+1:]
+	}
+	switch kind {
+	case ServiceSource:
+	case EtcdClusterSource:
+		if len(port) > 0 {
+			return "", "", "", "", fmt.Errorf("invalid etcd discovery %q, an %s has a single client port", source, EtcdClusterSource)
+		}
+	default:
+		return "", "", "", "", fmt.Errorf("invalid etcd discovery kind %q, must be %s or %s", kind, ServiceSource, EtcdClusterSource)
+	}
+	return kind, namespace, name, port, nil
+}
+
+// etcdClusterService returns the client Service of an etcd-operator EtcdCluster (once it's running)
+func etcdClusterService(get apiGetter, namespace, name string) (string, error) {
+	body, err := get("/apis/etcd.database.coreos.com/v1beta2/namespaces/" + namespace + "/etcdclusters/" + name)
+	if err != nil {
+		return "", err
+	}
+	var cluster struct {
+		Status struct {
+			Phase       string `json:"phase"`
+			ServiceName string `json:"serviceName"`
+		} `json:"status"`
+	}
+	if err = json.Unmarshal(body, &cluster); err != nil {
+		return "", err
+	}
+	if cluster.Status.Phase != "Running" {
+		return "", fmt.Errorf("etcdcluster %s/%s isn't running (phase %q)", namespace, name, cluster.Status.Phase)
+	}
+	if len(cluster.Status.ServiceName) > 0 {
+		return cluster.Status.ServiceName, nil
+	}
+	return name + "-client", nil
+}
+
+// serviceAddresses returns the host:port of a Service's load balancer, the pod IPs of its endpoints aren't used as
+// they're rarely reachable from outside the management cluster (or in the etcd server certs)
+func serviceAddresses(get apiGetter, namespace, name, portName string) ([]string, error) {
+	body, err := get("/api/v1/namespaces/" + namespace + "/services/" + name)
+	if err != nil {
+		return nil, err
+	}
+	var service struct {
+		Spec struct {
+			Type  string        `json:"type"`
+			Ports []servicePort `json:"ports"`
+		} `json:"spec"`
+		Status struct {
+			LoadBalancer struct {
+				Ingress []struct {
+					IP       string `json:"ip"`
+					Hostname string `json:"hostname"`
+				} `json:"ingress"`
+			} `json:"loadBalancer"`
+		} `json:"status"`
+	}
+	if err = json.Unmarshal(body, &service); err != nil {
+		return nil, err
+	}
+	if service.Spec.Type != "LoadBalancer" {
+		return nil, fmt.Errorf("service %s/%s must be a LoadBalancer to be reachable (not %q)", namespace, name, service.Spec.Type)
+	}
+	port := selectPort(service.Spec.Ports, portName)
+	if port == 0 {
+		return nil, fmt.Errorf("service %s/%s has no port %q", namespace, name, portName)
+	}
+	var addresses []string
+	for _, i := range service.Status.LoadBalancer.Ingress {
+		host := i.Hostname
+		if len(host) == 0 {
+			host = i.IP
+		}
+		addresses = append(addresses, net.JoinHostPort(host, strconv.Itoa(port)))
+	}
+	sort.Strings(addresses)
+	return addresses, nil
+}
+
+// selectPort returns the named port, without a name the etcd client port or the first port (0 when not found)
+func selectPort(ports []servicePort, name string) int {
+	port := 0
+	for _, p := range ports {
+		if len(name) > 0 && p.Name == name {
+			return p.Port
+		}
+		if len(name) == 0 && (port == 0 || p.Port == etcdOperatorClientPort) {
+			port = p.Port
+		}
+	}
+	return port
+}
@@ -0,0 +1,116 @@
+package etcd
+
+import (
+	"fmt"
+	"testing"
+)
+
+// fakeAPI returns the body of each known uri
+func fakeAPI(bodies map[string]string) apiGetter {
+	return func(uri string) ([]byte, error) {
+		body, ok := bodies[uri]
+		if !ok {
+			return nil, fmt.Errorf("%s returned 404 Not Found", uri)
+		}
+		return []byte(body), nil
+	}
+}
+
+func TestDiscoverEndpoints(t *testing.T) {
+	loadBalancer := `{"spec":{"type":"LoadBalancer","ports":[{"name":"peer","port":2380},{"name":"client","port":2379}]},
+		"status":{"loadBalancer":{"ingress":[{"ip":"10.0.0.2"},{"ip":"10.0.0.1"},{"hostname":"etcd.example.com"}]}}}`
+	tests := []struct {
+		source   string
+		scheme   string
+		bodies   map[string]string
+		expected string
+		err      bool
+	}{
+		{
+			source:   "service/etcd/shared-etcd:client",
+			scheme:   "https",
+			bodies:   map[string]string{"/api/v1/namespaces/etcd/services/shared-etcd": loadBalancer},
+			expected: "https://10.0.0.1:2379,https://10.0.0.2:2379,https://etcd.example.com:2379",
+		},
+		{
+			source:   "service/etcd/shared-etcd",
+			scheme:   "http",
+			bodies:   map[string]string{"/api/v1/namespaces/etcd/services/shared-etcd": loadBalancer},
+			expected: "http://10.0.0.1:2379,http://10.0.0.2:2379,http://etcd.example.com:2379",
+		},
+		{
+			source: "service/etcd/shared-etcd:metrics",
+			scheme: "https",
+			bodies: map[string]string{"/api/v1/namespaces/etcd/services/shared-etcd": loadBalancer},
+			err:    true,
+		},
+		{
+			source: "etcdcluster/etcd/shared",
+			scheme: "https",
+			bodies: map[string]string{
+				"/apis/etcd.database.coreos.com/v1beta2/namespaces/etcd/etcdclusters/shared": `{"status":{"phase":"Running"}}`,
+				"/api/v1/namespaces/etcd/services/shared-client":                             loadBalancer,
+			},
+			expected: "https://10.0.0.1:2379,https://10.0.0.2:2379,https://etcd.example.com:2379",
+		},
+		{
+			source: "etcdcluster/etcd/shared",
+			scheme: "https",
+			bodies: map[string]string{
+				"/apis/etcd.database.coreos.com/v1beta2/namespaces/etcd/etcdclusters/shared": `{"status":{"phase":"Creating"}}`,
+			},
+			err: true,
+		},
+		{
+			// Pod IPs aren't used (not reachable or in the etcd certs)
+			source: "service/etcd/shared-etcd",
+			scheme: "https",
+			bodies: map[string]string{
+				"/api/v1/namespaces/etcd/services/shared-etcd":  `{"spec":{"type":"ClusterIP","ports":[{"name":"client","port":2379}]}}`,
+				"/api/v1/namespaces/etcd/endpoints/shared-etcd": `{"subsets":[{"addresses":[{"ip":"10.1.0.1"}],"ports":[{"name":"client","port":2379}]}]}`,
+			},
+			err: true,
+		},
+		{
+			source: "service/etcd/shared-etcd",
+			scheme: "https",
+			bodies: map[string]string{
+				"/api/v1/namespaces/etcd/services/shared-etcd": `{"spec":{"type":"LoadBalancer","ports":[{"name":"client","port":2379}]}}`,
+			},
+			err: true,
+		},
+	}
+	for _, test := range tests {
+		result, err := discoverEndpoints(fakeAPI(test.bodies), test.source, test.scheme)
+		if test.err {
+			if err == nil {
+				t.Errorf("expected an error discovering %s but got %q", test.source, result)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error discovering %s: %v", test.source, err)
+			continue
+		}
+		if result != test.expected {
+			t.Errorf("expected %q from %s but got %q", test.expected, test.source, result)
+		}
+	}
+}
+
+func TestValidateDiscoverySource(t *testing.T) {
+	for source, valid := range map[string]bool{
+		"service/etcd/shared-etcd":        true,
+		"service/etcd/shared-etcd:client": true,
+		"etcdcluster/etcd/shared":         true,
+		"etcdcluster/etcd/shared:client":  false,
+		"service/shared-etcd":             false,
+		"service//shared-etcd":            false,
+		"pod/etcd/shared-etcd":            false,
+		"":                                false,
+	} {
+		if err := ValidateDiscoverySource(source); (err == nil) != valid {
+			t.Errorf("expected %q valid to be %v but got %v", source, valid, err)
+		}
+	}
+}
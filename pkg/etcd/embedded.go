@@ -0,0 +1,64 @@
+package etcd
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/coreos/etcd/embed"
+)
+
+// EmbeddedStartTimeout is how long to wait for an embedded etcd to be ready
+var EmbeddedStartTimeout = 60 * time.Second
+
+// Embedded is a single member etcd run in process (for local clusters only - no TLS)
+type Embedded struct {
+	etcd *embed.Etcd
+}
+
+// StartEmbedded will start a single member etcd storing data in dir
+// e.g. clientURL http://127.0.0.1:2379 and peerURL http://127.0.0.1:2380
+func StartEmbedded(dir, clientURL, peerURL string) (*Embedded, error) {
+	cURL, err := url.Parse(clientURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing embedded etcd client url %s [%v]", clientURL, err)
+	}
+	pURL, err := url.Parse(peerURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing embedded etcd peer url %s [%v]", peerURL, err)
+	}
+	cfg := embed.NewConfig()
+	cfg.Name = "keto-k8-local"
+	cfg.Dir = dir
+	cfg.LCUrls = []url.URL{*cURL}
+	cfg.ACUrls = []url.URL{*cURL}
+	cfg.LPUrls = []url.URL{*pURL}
+	cfg.APUrls = []url.URL{*pURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	logger.Printf("Starting embedded etcd on %s (data in %s)...", clientURL, dir)
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error starting embedded etcd [%v]", err)
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+		logger.Printf("Embedded etcd ready")
+	case err = <-e.Err():
+		e.Close()
+		return nil, fmt.Errorf("embedded etcd failed [%v]", err)
+	case <-time.After(EmbeddedStartTimeout):
+		e.Server.Stop()
+		e.Close()
+		return nil, fmt.Errorf("timed out waiting for embedded etcd to start")
+	}
+	return &Embedded{etcd: e}, nil
+}
+
+// Stop will stop the embedded etcd (the data is kept)
+func (e *Embedded) Stop() {
+	if e != nil && e.etcd != nil {
+		e.etcd.Close()
+		e.etcd = nil
+	}
+}
@@ -1,10 +1,16 @@
 package etcd
 
 import (
+	"fmt"
 	"strings"
+	"sync"
 	"time"
 
-	log "github.com/Sirupsen/logrus"
+	"github.com/UKHomeOffice/keto-k8/pkg/failure"
+	"github.com/UKHomeOffice/keto-k8/pkg/faults"
+	"github.com/UKHomeOffice/keto-k8/pkg/logging"
+	"github.com/UKHomeOffice/keto-k8/pkg/notify"
+	"github.com/UKHomeOffice/keto-k8/pkg/tlsconfig"
 	"github.com/coreos/etcd/clientv3"
 	"github.com/coreos/etcd/clientv3/clientv3util"
 	"github.com/coreos/etcd/pkg/transport"
@@ -20,6 +26,18 @@ type Client struct {
 	ClientCertFileName string
 	ClientKeyFileName  string
 	LockTTL            time.Duration
+	TLS                tlsconfig.Config
+	// KeyPrefix is added to every key (e.g. /keto-k8/<cluster>/) so clusters sharing etcd have their own keys
+	KeyPrefix string
+	// conn is shared by all the operations (and copies) of a client created with New
+	conn *connection
+}
+
+// connection is an etcd client dialled once and reused for every operation
+// The etcd client keeps the connection alive, reconnects and fails over between the endpoints
+type connection struct {
+	mu  sync.Mutex
+	cli *clientv3.Client
 }
 
 // Clienter allows for mocking out this lib for testing
@@ -27,36 +45,98 @@ type Clienter interface {
 	Get(key string) (value string, err error)
 	GetOrCreateLock(key string, lockKeyTTL time.Duration) (mylock bool, err error)
 	PutTx(key string, value string) (err error)
+	Put(key string, value string) (err error)
+	PutWithTTL(key string, value string, ttl time.Duration) (err error)
+	GetPrefix(prefix string) (values map[string]string, err error)
 	Delete(key string) (err error)
 }
 
 // Verify the implementation here satisfies the abstract interface
 var _ Clienter = (*Client)(nil)
 
+// logger is used for all the etcd logs
+var logger = logging.New("etcd")
+
 var (
 	// Timeout - For now a constant
 	Timeout = 5 * time.Second
+	// KeepAliveTime is how often an idle connection is checked (so a dead endpoint is found before the next operation)
+	KeepAliveTime = 30 * time.Second
 )
 
 // New creates a new etcd client from configuration
+// The connection is only dialled on first use and is then shared by all operations until closed
 func New(cfg Client) *Client {
+	cfg.conn = &connection{}
 	return &cfg
 }
 
+// Close will close the shared connection (a new connection is dialled if the client is used again)
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	c.conn.mu.Lock()
+	defer c.conn.mu.Unlock()
+	if c.conn.cli == nil {
+		return nil
+	}
+	err := c.conn.cli.Close()
+	c.conn.cli = nil
+	return err
+}
+
+// SetEndpoints will change the endpoints (comma separated) e.g. when the etcd members are replaced, a shared connection
+// switches over without being closed
+func (c *Client) SetEndpoints(endpoints string) {
+	if c.conn == nil {
+		c.Endpoints = endpoints
+		return
+	}
+	c.conn.mu.Lock()
+	defer c.conn.mu.Unlock()
+	c.Endpoints = endpoints
+	if c.conn.cli != nil {
+		c.conn.cli.SetEndpoints(strings.Split(endpoints, ",")...)
+	}
+}
+
+// client returns the etcd client for an operation, release must be called once the operation has finished
+// Clients not created with New dial a connection for each operation
+func (c *Client) client() (cli *clientv3.Client, release func(), err error) {
+	if c.conn == nil {
+		if cli, err = getEtcdClient(*c, Timeout); err != nil {
+			return nil, nil, err
+		}
+		return cli, func() { cli.Close() }, nil
+	}
+	c.conn.mu.Lock()
+	defer c.conn.mu.Unlock()
+	if c.conn.cli == nil {
+		// Failures aren't kept so the next operation will dial again
+		if c.conn.cli, err = getEtcdClient(*c, Timeout); err != nil {
+			return nil, nil, err
+		}
+	}
+	return c.conn.cli, func() {}, nil
+}
+
 // Get - Will return:
 // - The the string value for a given key if present
 // - Will return an err for all other occasions
 func (c *Client) Get(key string) (value string, err error) {
+	op := startOperation("Get", key, "")
+	defer func() { op.end(value, err) }()
 
 	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
-	cli, err := getEtcdClient(*c, Timeout)
+	cli, release, err := c.client()
 	if err != nil {
-		log.Printf("Error getting client:%q", err)
+		logger.Printf("Error getting client:%q", err)
 		return "", err
 	}
-	defer cli.Close()
+	defer release()
 
-	getresp, err := cli.Get(ctx, key)
+	getresp, err := cli.Get(ctx, c.KeyPrefix+key)
 	if err != nil {
 		return "", err
 	}
@@ -64,11 +144,11 @@ func (c *Client) Get(key string) (value string, err error) {
 		return "", ErrKeyMissing
 	}
 	for _, ev := range getresp.Kvs {
-		log.Debugf("%q values: key: %q = %q, version=%q\n", key, ev.Key, ev.Value, ev.Version)
+		// Values can be shared assets (keys), only ever log their length and fingerprint
+		logger.Debugf("Got key %q version %d %s", ev.Key, ev.Version, Fingerprint(string(ev.Value)))
 		value = string(ev.Value[:])
 		break
 	}
-	//log.Printf("%q key has specific value: %q\n", key, value)
 	cancel() // context
 	return value, err
 }
@@ -77,6 +157,11 @@ func (c *Client) Get(key string) (value string, err error) {
 // If TTL expired, will obtain lock (reset TTL)
 // If TTL not expired will return false
 func (c *Client) GetOrCreateLock(key string, lockKeyTTL time.Duration) (mylock bool, err error) {
+	op := startOperation("GetOrCreateLock", key, "")
+	defer func() {
+		op.span.SetTag("lock.obtained", mylock)
+		op.end("", err)
+	}()
 	mylock = false
 
 	// TODO: make this a hash for each key (not needed for current use cases)
@@ -85,12 +170,12 @@ func (c *Client) GetOrCreateLock(key string, lockKeyTTL time.Duration) (mylock b
 	err = c.SetLock(key)
 	if err != nil {
 		if err == ErrKeyAlreadyExists {
-			log.Printf("Lock allready created...")
+			logger.Printf("Lock allready created...")
 			// Need to check TTL and if required, transactionally re-create Lock..
 			mylock, err = c.TryRecreateLock(key)
 		}
 	} else {
-		log.Printf("Lock obtained...")
+		logger.Printf("Lock obtained...")
 		mylock = true
 	}
 	return mylock, err
@@ -113,7 +198,7 @@ func (c *Client) TryRecreateLock(key string) (recreated bool, err error) {
 	othersTTLString, err := c.Get(key)
 	if err != nil {
 		// Shouldn't get this unless terminal...
-		log.Printf("Lock (key - %q) not obtained, Can't get key:%q", key, err)
+		logger.Printf("Lock (key - %q) not obtained, Can't get key:%q", key, err)
 		return false, err
 	}
 
@@ -123,7 +208,7 @@ func (c *Client) TryRecreateLock(key string) (recreated bool, err error) {
 		othersTTLString)
 	if e != nil {
 		// Error parsing lock, corrupt, overwrite and get lock
-		log.Printf("Error parsing lock:%q, error:%q", othersTTLString, e)
+		logger.Printf("Error parsing lock:%q, error:%q", othersTTLString, e)
 		if err := c.OverWriteLock(key); err != nil {
 			return false, err
 		}
@@ -132,13 +217,15 @@ func (c *Client) TryRecreateLock(key string) (recreated bool, err error) {
 	// See if TTL has passed and we should assume lock...
 	now := time.Now()
 	if now.After(otherTTLTime) {
-		log.Printf("TTL exists but time passed so overwriting")
+		logger.Printf("TTL exists but time passed so overwriting")
+		notify.Send(notify.LockTakeover, notify.Warning,
+			fmt.Sprintf("lock %q expired at %s and was taken over", key, othersTTLString))
 		if err := c.OverWriteLock(key); err != nil {
 			return false, err
 		}
 		return true, nil
 	}
-	log.Printf("Lock (key - %q) not obtained, TTL exists:%q", key, othersTTLString)
+	logger.Printf("Lock (key - %q) not obtained, TTL exists:%q", key, othersTTLString)
 	return false, nil
 }
 
@@ -147,41 +234,110 @@ func (c *Client) TryRecreateLock(key string) (recreated bool, err error) {
 func (c *Client) OverWriteLock(key string) (err error) {
 	err = c.Delete(key)
 	if err != nil {
-		log.Printf("Failed deleteing lock:%q", key)
+		logger.Printf("Failed deleteing lock:%q", key)
+	}
+	if err = faults.Inject(faults.LockRenewal); err != nil {
+		return err
 	}
 	err = c.SetLock(key)
 	if err != nil {
-		log.Printf("Failed creating lock:%q", key)
+		logger.Printf("Failed creating lock:%q", key)
 	}
 	return err
 }
 
 // Delete - will remove a key from etcd
 func (c *Client) Delete(key string) (err error) {
+	op := startOperation("Delete", key, "")
+	defer func() { op.end("", err) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	cli, release, err := c.client()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	_, err = cli.Delete(ctx, c.KeyPrefix+key)
+	cancel()
+	return err
+}
+
+// Put - will create or overwrite a key
+func (c *Client) Put(key string, value string) (err error) {
+	op := startOperation("Put", key, value)
+	defer func() { op.end("", err) }()
 
 	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
-	cli, err := getEtcdClient(*c, Timeout)
+	cli, release, err := c.client()
 	if err != nil {
 		return err
 	}
-	defer cli.Close()
+	defer release()
 
-	_, err = cli.Delete(ctx, key)
+	_, err = cli.Put(ctx, c.KeyPrefix+key, value)
 	cancel()
 	return err
 }
 
+// PutWithTTL - will create or overwrite a key which expires after the TTL (unless put again)
+func (c *Client) PutWithTTL(key string, value string, ttl time.Duration) (err error) {
+	op := startOperation("PutWithTTL", key, value)
+	defer func() { op.end("", err) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	cli, release, err := c.client()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	lease, err := cli.Grant(ctx, int64(ttl.Seconds()))
+	if err != nil {
+		return err
+	}
+	_, err = cli.Put(ctx, c.KeyPrefix+key, value, clientv3.WithLease(lease.ID))
+	return err
+}
+
+// GetPrefix - will return all the keys (and values) with a prefix (the keys don't include the KeyPrefix)
+func (c *Client) GetPrefix(prefix string) (values map[string]string, err error) {
+	op := startOperation("GetPrefix", prefix, "")
+	defer func() { op.end("", err) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	cli, release, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	getresp, err := cli.Get(ctx, c.KeyPrefix+prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	values = map[string]string{}
+	for _, kv := range getresp.Kvs {
+		values[strings.TrimPrefix(string(kv.Key), c.KeyPrefix)] = string(kv.Value)
+	}
+	return values, nil
+}
+
 // PutTx - Puts with a transaction (will NOT create new revision)
 // Will ensure only a single version is ever stored.
 // Returns error if key already existed
 func (c *Client) PutTx(key string, value string) (err error) {
+	op := startOperation("PutTx", key, value)
+	defer func() { op.end("", err) }()
 
 	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
-	cli, err := getEtcdClient(*c, Timeout)
+	cli, release, err := c.client()
 	if err != nil {
 		return err
 	}
-	defer cli.Close()
+	defer release()
 
 	kvc := clientv3.NewKV(cli)
 
@@ -190,18 +346,18 @@ func (c *Client) PutTx(key string, value string) (err error) {
 	// the existing key which would generate potentially unwanted events,
 	// unless of course you wanted to do an overwrite no matter what.
 	txRet, err := kvc.Txn(ctx).
-		If(clientv3util.KeyMissing(key)).
-		Then(clientv3.OpPut(key, value)).
+		If(clientv3util.KeyMissing(c.KeyPrefix + key)).
+		Then(clientv3.OpPut(c.KeyPrefix+key, value)).
 		Commit()
 
 	cancel() // context
 
 	if !txRet.Succeeded {
 		// We didn't create the lock - indicate with dedicated error:
-		log.Printf("Transaction didn't succeed - we didn't create lock!")
+		logger.Printf("Transaction didn't succeed - we didn't create lock!")
 		err = ErrKeyAlreadyExists
 	} else {
-		log.Debugf("Created item:%q...", value)
+		logger.Debugf("Created key %q %s", key, Fingerprint(value))
 	}
 	return err
 }
@@ -210,11 +366,13 @@ func getEtcdClient(config Client, timeout time.Duration) (cli *clientv3.Client,
 
 	endPoints := strings.Split(config.Endpoints, ",")
 	cfg := clientv3.Config{
-		Endpoints:   endPoints,
-		DialTimeout: timeout,
+		Endpoints:            endPoints,
+		DialTimeout:          timeout,
+		DialKeepAliveTime:    KeepAliveTime,
+		DialKeepAliveTimeout: timeout,
 	}
 	if config.CaFileName == "" {
-		log.Printf("No ca file specified. not using client certs")
+		logger.Printf("No ca file specified. not using client certs")
 	} else {
 		tlsInfo := transport.TLSInfo{
 			CertFile: config.ClientCertFileName,
@@ -223,13 +381,18 @@ func getEtcdClient(config Client, timeout time.Duration) (cli *clientv3.Client,
 		}
 		tlsConfig, err := tlsInfo.ClientConfig()
 		if err != nil {
+			return nil, failure.Wrap(err, "error loading the etcd client certs",
+				"check the keto infra provisioned the --etcd-client-ca, --etcd-client-cert and --etcd-client-key files")
+		}
+		if err = config.TLS.Apply(tlsConfig); err != nil {
 			return nil, err
 		}
 		cfg.TLS = tlsConfig
 	}
 	cli, err = clientv3.New(cfg)
 	if err != nil {
-		return nil, err
+		return nil, failure.Wrap(err, "error connecting to etcd "+config.Endpoints,
+			"check the --etcd-endpoints resolve and accept connections from this node")
 	}
 	return cli, nil
 }
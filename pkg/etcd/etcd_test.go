@@ -174,6 +174,80 @@ func TestGetOrCreateLock(t *testing.T) {
 	}
 }
 
+func TestSharedConnection(t *testing.T) {
+	const testSharedKey string = "testshared"
+
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	e := getETCDClient()
+	defer e.Close()
+
+	if err := e.Put(testSharedKey, "value"); err != nil {
+		t.Fatal(err)
+	}
+	cli := e.conn.cli
+	if cli == nil {
+		t.Fatal(fmt.Errorf("expected a shared connection after the first operation"))
+	}
+	if _, err := e.Get(testSharedKey); err != nil {
+		t.Error(err)
+	}
+	if e.conn.cli != cli {
+		t.Error(fmt.Errorf("expected the connection to be reused"))
+	}
+
+	// A closed client will dial again when next used
+	if err := e.Close(); err != nil {
+		t.Error(err)
+	}
+	if err := e.Delete(testSharedKey); err != nil {
+		t.Error(err)
+	}
+	if e.conn.cli == nil || e.conn.cli == cli {
+		t.Error(fmt.Errorf("expected a new connection after close"))
+	}
+}
+
+func TestKeyPrefix(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	cfg := getClientCfg()
+	cfg.KeyPrefix = ClusterKeyPrefix("", "test")
+	e := New(cfg)
+	defer e.Close()
+	other := getETCDClient()
+	defer other.Close()
+
+	if err := e.Put("testprefix/a", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := other.Get(cfg.KeyPrefix + "testprefix/a"); err != nil || value != "value" {
+		t.Errorf("expected the key under the prefix but got %q, %v", value, err)
+	}
+	if _, err := other.Get("testprefix/a"); err != ErrKeyMissing {
+		t.Errorf("expected no key without the prefix but got %v", err)
+	}
+	values, err := e.GetPrefix("testprefix/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["testprefix/a"] != "value" {
+		t.Errorf("expected the keys without the key prefix but got %v", values)
+	}
+	names, err := other.ListChildren(ClustersRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "test" {
+		t.Errorf("expected the test cluster under %s but got %v", ClustersRoot, names)
+	}
+	if err = e.Delete("testprefix/a"); err != nil {
+		t.Error(err)
+	}
+}
+
 func getETCDClient() *Client {
 	return New(getClientCfg())
 }
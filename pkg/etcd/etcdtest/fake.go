@@ -0,0 +1,214 @@
+// Package etcdtest provides an in memory etcd.Clienter for testing code which shares state through etcd
+package etcdtest
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/etcd"
+)
+
+// Fake is a map backed etcd.Clienter
+// Locks behave like the real client (the value is the RFC3339 expiry time) unless LockFunc is set
+type Fake struct {
+	// LockFunc (when set) decides if GetOrCreateLock obtains a lock e.g. to simulate contention
+	LockFunc func(key string, ttl time.Duration) (bool, error)
+	// Hook (when set) is called after every operation e.g. to simulate another node
+	Hook func(method, key string)
+	// Now is used for lock and key expiry (defaults to time.Now)
+	Now func() time.Time
+
+	mu      sync.Mutex
+	values  map[string]string
+	expires map[string]time.Time
+	errors  map[string]error
+	calls   []string
+}
+
+// Verify the fake satisfies the abstract interface
+var _ etcd.Clienter = (*Fake)(nil)
+
+// New returns an empty fake
+func New() *Fake {
+	return &Fake{
+		values:  map[string]string{},
+		expires: map[string]time.Time{},
+		errors:  map[string]error{},
+	}
+}
+
+// Set will store a key without recording a call (e.g. assets created by another node)
+func (f *Fake) Set(key, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.values[key] = value
+	delete(f.expires, key)
+}
+
+// Value returns a stored key without recording a call
+func (f *Fake) Value(key string) (value string, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expire(key)
+	value, ok = f.values[key]
+	return value, ok
+}
+
+// FailOn will return err for an operation (method) on a key, an empty key fails the method for all keys
+func (f *Fake) FailOn(method, key string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil {
+		delete(f.errors, method+" "+key)
+		return
+	}
+	f.errors[method+" "+key] = err
+}
+
+// Calls returns every operation made as "Method key"
+func (f *Fake) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.calls...)
+}
+
+// Get will return a key or etcd.ErrKeyMissing
+func (f *Fake) Get(key string) (value string, err error) {
+	defer f.hook("Get", key)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err = f.call("Get", key); err != nil {
+		return "", err
+	}
+	f.expire(key)
+	value, ok := f.values[key]
+	if !ok {
+		return "", etcd.ErrKeyMissing
+	}
+	return value, nil
+}
+
+// GetOrCreateLock obtains a lock (true) when missing or expired
+func (f *Fake) GetOrCreateLock(key string, lockKeyTTL time.Duration) (mylock bool, err error) {
+	defer f.hook("GetOrCreateLock", key)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err = f.call("GetOrCreateLock", key); err != nil {
+		return false, err
+	}
+	if f.LockFunc != nil {
+		return f.LockFunc(key, lockKeyTTL)
+	}
+	now := f.now()
+	if existing, ok := f.values[key]; ok {
+		// Unparsable locks are overwritten as with the real client
+		if ttl, e := time.Parse(time.RFC3339, existing); e == nil && !now.After(ttl) {
+			return false, nil
+		}
+	}
+	f.values[key] = now.Add(lockKeyTTL).Format(time.RFC3339)
+	return true, nil
+}
+
+// PutTx will only create a key (etcd.ErrKeyAlreadyExists when present)
+func (f *Fake) PutTx(key string, value string) (err error) {
+	defer f.hook("PutTx", key)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err = f.call("PutTx", key); err != nil {
+		return err
+	}
+	f.expire(key)
+	if _, ok := f.values[key]; ok {
+		return etcd.ErrKeyAlreadyExists
+	}
+	f.values[key] = value
+	return nil
+}
+
+// Put will create or overwrite a key
+func (f *Fake) Put(key string, value string) (err error) {
+	return f.PutWithTTL(key, value, 0)
+}
+
+// PutWithTTL will create or overwrite a key which expires after the TTL (never when 0)
+func (f *Fake) PutWithTTL(key string, value string, ttl time.Duration) (err error) {
+	method := "Put"
+	if ttl > 0 {
+		method = "PutWithTTL"
+	}
+	defer f.hook(method, key)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err = f.call(method, key); err != nil {
+		return err
+	}
+	f.values[key] = value
+	delete(f.expires, key)
+	if ttl > 0 {
+		f.expires[key] = f.now().Add(ttl)
+	}
+	return nil
+}
+
+// GetPrefix will return all the keys (and values) with a prefix
+func (f *Fake) GetPrefix(prefix string) (values map[string]string, err error) {
+	defer f.hook("GetPrefix", prefix)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err = f.call("GetPrefix", prefix); err != nil {
+		return nil, err
+	}
+	values = map[string]string{}
+	for key := range f.values {
+		f.expire(key)
+		if value, ok := f.values[key]; ok && strings.HasPrefix(key, prefix) {
+			values[key] = value
+		}
+	}
+	return values, nil
+}
+
+// Delete will remove a key (if present)
+func (f *Fake) Delete(key string) (err error) {
+	defer f.hook("Delete", key)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err = f.call("Delete", key); err != nil {
+		return err
+	}
+	delete(f.values, key)
+	delete(f.expires, key)
+	return nil
+}
+
+// call records an operation and returns any injected error (must hold the lock)
+func (f *Fake) call(method, key string) error {
+	f.calls = append(f.calls, method+" "+key)
+	if err, ok := f.errors[method+" "+key]; ok {
+		return err
+	}
+	return f.errors[method+" "]
+}
+
+// expire will remove a key after its TTL (must hold the lock)
+func (f *Fake) expire(key string) {
+	if expires, ok := f.expires[key]; ok && f.now().After(expires) {
+		delete(f.values, key)
+		delete(f.expires, key)
+	}
+}
+
+func (f *Fake) now() time.Time {
+	if f.Now != nil {
+		return f.Now()
+	}
+	return time.Now()
+}
+
+func (f *Fake) hook(method, key string) {
+	if f.Hook != nil {
+		f.Hook(method, key)
+	}
+}
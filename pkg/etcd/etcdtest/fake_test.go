@@ -0,0 +1,88 @@
+package etcdtest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/etcd"
+)
+
+func TestFakeLock(t *testing.T) {
+	now := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	f := New()
+	f.Now = func() time.Time { return now }
+
+	for _, expected := range []bool{true, false} {
+		if mylock, err := f.GetOrCreateLock("lock", time.Minute); err != nil || mylock != expected {
+			t.Errorf("expected lock %t but got %t, %v", expected, mylock, err)
+		}
+	}
+	// Expired locks are taken over
+	now = now.Add(2 * time.Minute)
+	if mylock, _ := f.GetOrCreateLock("lock", time.Minute); !mylock {
+		t.Error("expected an expired lock to be obtained")
+	}
+
+	f.LockFunc = func(key string, ttl time.Duration) (bool, error) { return false, nil }
+	if err := f.Delete("lock"); err != nil {
+		t.Fatal(err)
+	}
+	if mylock, _ := f.GetOrCreateLock("lock", time.Minute); mylock {
+		t.Error("expected the lock func to decide")
+	}
+}
+
+func TestFakeKeys(t *testing.T) {
+	now := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	f := New()
+	f.Now = func() time.Time { return now }
+
+	if _, err := f.Get("assets"); err != etcd.ErrKeyMissing {
+		t.Errorf("expected a missing key but got %v", err)
+	}
+	if err := f.PutTx("assets", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.PutTx("assets", "b"); err != etcd.ErrKeyAlreadyExists {
+		t.Errorf("expected the key to exist but got %v", err)
+	}
+	if err := f.PutWithTTL("members/node1", "1", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	f.Set("members/node2", "2")
+	if values, _ := f.GetPrefix("members/"); len(values) != 2 {
+		t.Errorf("expected two members but got %v", values)
+	}
+	now = now.Add(2 * time.Minute)
+	if values, _ := f.GetPrefix("members/"); !reflect.DeepEqual(values, map[string]string{"members/node2": "2"}) {
+		t.Errorf("expected the TTL key to expire but got %v", values)
+	}
+
+	expected := []string{"Get assets", "PutTx assets", "PutTx assets", "PutWithTTL members/node1", "GetPrefix members/", "GetPrefix members/"}
+	if !reflect.DeepEqual(f.Calls(), expected) {
+		t.Errorf("expected calls %v but got %v", expected, f.Calls())
+	}
+}
+
+func TestFakeFailOn(t *testing.T) {
+	f := New()
+	failed := errors.New("timeout")
+	f.FailOn("Put", "summary", failed)
+	f.FailOn("Delete", "", failed)
+
+	if err := f.Put("summary", "x"); err != failed {
+		t.Errorf("expected the injected error but got %v", err)
+	}
+	if err := f.Put("other", "x"); err != nil {
+		t.Error(err)
+	}
+	if err := f.Delete("other"); err != failed {
+		t.Errorf("expected the injected error for all keys but got %v", err)
+	}
+	f.FailOn("Delete", "", nil)
+	if err := f.Delete("other"); err != nil {
+		t.Error(err)
+	}
+}
@@ -6,9 +6,9 @@ import (
 	"fmt"
 	"net"
 
-	log "github.com/Sirupsen/logrus"
 	certutil "github.com/UKHomeOffice/keto-k8/pkg/client-go/util/cert"
 
+	"github.com/UKHomeOffice/keto-k8/pkg/failure"
 	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
 	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm/pkiutil"
 )
@@ -66,9 +66,10 @@ func GenCerts(cfg ServerConfig) (err error) {
 		if err != nil || caKey == nil {
 			return fmt.Errorf("CA key existed but could not be loaded properly %q", cfg.CaKeyFileName)
 		}
-		log.Printf("Found and verified CA certificate %q and key %q", cfg.ClientConfig.CaFileName, cfg.CaKeyFileName)
+		logger.Printf("Found and verified CA certificate %q and key %q", cfg.ClientConfig.CaFileName, cfg.CaKeyFileName)
 	} else {
-		return fmt.Errorf("etcd CA key %q and cert %q must both exist before certs can be created", cfg.CaKeyFileName, cfg.ClientConfig.CaFileName)
+		return failure.New(fmt.Sprintf("etcd CA key %q and cert %q must both exist before certs can be created", cfg.CaKeyFileName, cfg.ClientConfig.CaFileName),
+			"check the keto infra provisioned the etcd CA and --etcd-ca-key and --etcd-client-ca are its paths")
 	}
 
 	// Generate the ETCD server cert and key file (if required)
@@ -139,7 +140,7 @@ func checkOrCreateCert(certFile, keyFile string, caCert *x509.Certificate, caKey
 			return fmt.Errorf("key existed but they could not be loaded properly %q", keyFile)
 		}
 
-		log.Printf("Using cert:%q and key %q", certFile, keyFile)
+		logger.Printf("Using cert:%q and key %q", certFile, keyFile)
 	} else {
 		// The certificate and / or the key did NOT exist, let's generate them now
 		cert, key, err := pkiutil.NewCertAndKey(caCert, caKey, config)
@@ -152,8 +153,8 @@ func checkOrCreateCert(certFile, keyFile string, caCert *x509.Certificate, caKey
 		if err = certutil.WriteKey(keyFile, certutil.EncodePrivateKeyPEM(key)); err != nil {
 			return fmt.Errorf("failure while saving key %q [%v]", keyFile, err)
 		}
-		log.Printf("Generated cert %q.", certFile)
-		log.Printf("Generated key %q.", keyFile)
+		logger.Printf("Generated cert %q.", certFile)
+		logger.Printf("Generated key %q.", keyFile)
 	}
 	return nil
 }
@@ -0,0 +1,166 @@
+package etcd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/failure"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	"golang.org/x/net/context"
+)
+
+// ClustersRoot is the parent of the cluster key prefixes e.g. /keto-k8/<cluster>/
+const ClustersRoot = "/keto-k8/"
+
+// DefaultRegistryPrefix is where the apiserver keeps the cluster data (its --etcd-prefix default)
+const DefaultRegistryPrefix = "/registry"
+
+// ClusterKeyPrefix returns the key prefix for a cluster under a root (ClustersRoot when empty)
+func ClusterKeyPrefix(root, cluster string) string {
+	if len(root) == 0 {
+		root = ClustersRoot
+	}
+	return root + cluster + "/"
+}
+
+// ValidateKeyPrefix checks a key prefix is an absolute path ending in / e.g. /keto-k8/prod/ (empty is no prefix)
+func ValidateKeyPrefix(prefix string) error {
+	if len(prefix) == 0 {
+		return nil
+	}
+	if prefix == "/" || !strings.HasPrefix(prefix, "/") || !strings.HasSuffix(prefix, "/") || strings.Contains(prefix, "//") {
+		return fmt.Errorf("invalid etcd key prefix %q, expecting a path ending in / e.g. %s", prefix, ClusterKeyPrefix("", "prod"))
+	}
+	return nil
+}
+
+// RegistryPrefix returns the apiserver --etcd-prefix, the cluster data is kept under the key prefix when set
+func (c *Client) RegistryPrefix() string {
+	if len(c.KeyPrefix) == 0 {
+		return DefaultRegistryPrefix
+	}
+	return c.KeyPrefix + strings.TrimPrefix(DefaultRegistryPrefix, "/")
+}
+
+// Provision will create a role with read and write access to the key prefix only and grant it to the user, the user of
+// a client cert is its common name (needs root credentials)
+func (c *Client) Provision(role, user string) (err error) {
+	if len(c.KeyPrefix) == 0 {
+		return fmt.Errorf("an etcd key prefix is required to provision a cluster role")
+	}
+	op := startOperation("Provision", c.KeyPrefix, role)
+	defer func() { op.end("", err) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	cli, release, err := c.client()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if _, err = cli.RoleAdd(ctx, role); err != nil && err != rpctypes.ErrRoleAlreadyExist {
+		return fmt.Errorf("error adding etcd role %s [%v]", role, err)
+	}
+	if _, err = cli.RoleGrantPermission(ctx, role, c.KeyPrefix, prefixRangeEnd(c.KeyPrefix),
+		clientv3.PermissionType(clientv3.PermReadWrite)); err != nil {
+		return fmt.Errorf("error granting etcd role %s access to %s [%v]", role, c.KeyPrefix, err)
+	}
+	// Users authenticated with a client cert don't use a password (a random one stops password logins)
+	password := make([]byte, 32)
+	if _, err = rand.Read(password); err != nil {
+		return err
+	}
+	if _, err = cli.UserAdd(ctx, user, hex.EncodeToString(password)); err != nil && err != rpctypes.ErrUserAlreadyExist {
+		return fmt.Errorf("error adding etcd user %s [%v]", user, err)
+	}
+	if _, err = cli.UserGrantRole(ctx, user, role); err != nil {
+		return fmt.Errorf("error granting etcd role %s to user %s [%v]", role, user, err)
+	}
+	logger.Printf("Provisioned etcd role %s for %s with access to %s only", role, user, c.KeyPrefix)
+	return nil
+}
+
+// ValidateIsolation checks the credentials can read the key prefix but nothing outside it, so clusters sharing etcd
+// can't read each other's assets (etcd authentication must be enabled)
+func (c *Client) ValidateIsolation() (err error) {
+	if len(c.KeyPrefix) == 0 {
+		return fmt.Errorf("an etcd key prefix is required for isolation")
+	}
+	op := startOperation("ValidateIsolation", c.KeyPrefix, "")
+	defer func() { op.end("", err) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	cli, release, err := c.client()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if _, err = cli.Get(ctx, c.KeyPrefix, clientv3.WithPrefix(), clientv3.WithKeysOnly(), clientv3.WithLimit(1)); err != nil {
+		return failure.Wrap(err, "the etcd credentials can't read the key prefix "+c.KeyPrefix,
+			"check the etcd client cert user has been granted the cluster role (kmm clusters provision)")
+	}
+	// The whole keyspace
+	_, err = cli.Get(ctx, "\x00", clientv3.WithFromKey(), clientv3.WithKeysOnly(), clientv3.WithLimit(1))
+	if err == rpctypes.ErrPermissionDenied {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return failure.New("the etcd credentials can read keys outside the key prefix "+c.KeyPrefix,
+		"enable etcd authentication and provision the cluster role (kmm clusters provision)")
+}
+
+// ListChildren returns the names under a prefix (the first path element of each key) e.g. the clusters under
+// ClustersRoot, only one key is read for each name
+func (c *Client) ListChildren(prefix string) (names []string, err error) {
+	op := startOperation("ListChildren", prefix, "")
+	defer func() { op.end("", err) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	cli, release, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	key, end := prefix, prefixRangeEnd(prefix)
+	for {
+		resp, err := cli.Get(ctx, key, clientv3.WithRange(end), clientv3.WithKeysOnly(), clientv3.WithLimit(1))
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Kvs) == 0 {
+			return names, nil
+		}
+		name := strings.TrimPrefix(string(resp.Kvs[0].Key), prefix)
+		if i := strings.Index(name, "/"); i >= 0 {
+			name = name[:i]
+			// Skip to the key after every key under the name ('0' follows '/')
+			key = prefix + name + "0"
+		} else {
+			key = prefix + name + "\x00"
+		}
+		names = append(names, name)
+	}
+}
+
+// prefixRangeEnd returns the end of the range of keys with a prefix
+func prefixRangeEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	// The prefix is all 0xff, the range is to the end of the keyspace
+	return "\x00"
+}
@@ -0,0 +1,45 @@
+package etcd
+
+import (
+	"testing"
+)
+
+func TestValidateKeyPrefix(t *testing.T) {
+	for prefix, valid := range map[string]bool{
+		"":               true,
+		"/keto-k8/prod/": true,
+		"/prod/":         true,
+		"/":              false,
+		"keto-k8/prod/":  false,
+		"/keto-k8/prod":  false,
+		"/keto-k8//":     false,
+	} {
+		if err := ValidateKeyPrefix(prefix); (err == nil) != valid {
+			t.Errorf("expected key prefix %q valid to be %v but got %v", prefix, valid, err)
+		}
+	}
+	if prefix := ClusterKeyPrefix("", "prod"); prefix != "/keto-k8/prod/" || ValidateKeyPrefix(prefix) != nil {
+		t.Errorf("expected a valid default cluster key prefix but got %q", prefix)
+	}
+}
+
+func TestRegistryPrefix(t *testing.T) {
+	if prefix := (&Client{}).RegistryPrefix(); prefix != DefaultRegistryPrefix {
+		t.Errorf("expected the apiserver default %s without a key prefix but got %s", DefaultRegistryPrefix, prefix)
+	}
+	if prefix := (&Client{KeyPrefix: "/keto-k8/prod/"}).RegistryPrefix(); prefix != "/keto-k8/prod/registry" {
+		t.Errorf("expected the registry under the key prefix but got %s", prefix)
+	}
+}
+
+func TestPrefixRangeEnd(t *testing.T) {
+	for prefix, expected := range map[string]string{
+		"/keto-k8/prod/": "/keto-k8/prod0",
+		"a\xff":          "b",
+		"\xff\xff":       "\x00",
+	} {
+		if end := prefixRangeEnd(prefix); end != expected {
+			t.Errorf("expected the range end of %q to be %q but got %q", prefix, expected, end)
+		}
+	}
+}
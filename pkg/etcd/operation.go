@@ -0,0 +1,84 @@
+package etcd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/logging"
+	"github.com/UKHomeOffice/keto-k8/pkg/profile"
+	"github.com/UKHomeOffice/keto-k8/pkg/tracing"
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// auditLogger records every etcd operation (a separate component so the level can be set independently)
+var auditLogger = logging.New("etcd-audit")
+
+// operation is a traced and audited etcd request
+type operation struct {
+	name    string
+	key     string
+	value   string
+	started time.Time
+	span    opentracing.Span
+}
+
+// startOperation will start tracing an operation on a key (value is set for writes)
+func startOperation(name, key, value string) *operation {
+	span := tracing.Start("etcd." + name)
+	span.SetTag("etcd.key", key)
+	return &operation{
+		name:    name,
+		key:     key,
+		value:   value,
+		started: time.Now(),
+		span:    span,
+	}
+}
+
+// end will finish the operation span and write the audit log entry (and profile the operation)
+// Values are never logged, only fingerprinted
+func (o *operation) end(readValue string, err error) {
+	result := auditResult(err)
+	value := o.value
+	if value == "" {
+		value = readValue
+	}
+	duration := time.Since(o.started)
+	auditLogger.WithFields(map[string]interface{}{
+		"op":       o.name,
+		"key":      o.key,
+		"value":    Fingerprint(value),
+		"result":   result,
+		"duration": duration.String(),
+	}).Info("etcd operation")
+	profile.Record("etcd "+o.name, duration, 0)
+
+	// Missing and existing keys are expected so not failures
+	if err == ErrKeyMissing || err == ErrKeyAlreadyExists {
+		o.span.SetTag("etcd.result", result)
+		err = nil
+	}
+	tracing.End(o.span, err)
+}
+
+// Fingerprint returns a redacted representation of a value (empty when there's no value)
+func Fingerprint(value string) string {
+	if value == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(value))
+	return fmt.Sprintf("sha256:%x (%d bytes)", sum[:8], len(value))
+}
+
+func auditResult(err error) string {
+	switch err {
+	case nil:
+		return "ok"
+	case ErrKeyMissing:
+		return "missing"
+	case ErrKeyAlreadyExists:
+		return "exists"
+	}
+	return "error: " + err.Error()
+}
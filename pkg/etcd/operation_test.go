@@ -0,0 +1,33 @@
+package etcd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	if Fingerprint("") != "" {
+		t.Error("expected no fingerprint for an empty value")
+	}
+	f := Fingerprint("secret assets")
+	if strings.Contains(f, "secret") || !strings.HasPrefix(f, "sha256:") || !strings.HasSuffix(f, "(13 bytes)") {
+		t.Errorf("unexpected fingerprint %q", f)
+	}
+	if f != Fingerprint("secret assets") || f == Fingerprint("other assets") {
+		t.Error("expected fingerprints to identify values")
+	}
+}
+
+func TestAuditResult(t *testing.T) {
+	for err, expected := range map[error]string{
+		nil:                 "ok",
+		ErrKeyMissing:       "missing",
+		ErrKeyAlreadyExists: "exists",
+		errors.New("boom"):  "error: boom",
+	} {
+		if result := auditResult(err); result != expected {
+			t.Errorf("expected %q but got %q", expected, result)
+		}
+	}
+}
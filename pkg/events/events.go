@@ -0,0 +1,96 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/constants"
+	"github.com/UKHomeOffice/keto-k8/pkg/k8client"
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+)
+
+const (
+	// Normal is the type for milestone events
+	Normal = "Normal"
+	// Warning is the type for failure events
+	Warning = "Warning"
+
+	// Namespace is where all keto-k8 events are recorded
+	Namespace = "kube-system"
+)
+
+// Reasons for the bootstrap milestones
+const (
+	AssetsCreated    = "AssetsCreated"
+	MasterJoined     = "MasterJoined"
+	NetworkInstalled = "NetworkInstalled"
+	TokensDeployed   = "TokensDeployed"
+	AddonsDeployed   = "AddonsDeployed"
+	BootstrapFailed  = "BootstrapFailed"
+	StepRetrying     = "StepRetrying"
+	StepFailed       = "StepFailed"
+)
+
+// Recorder will post events about this node
+type Recorder interface {
+	Event(eventType, reason, message string)
+}
+
+// kubectlRecorder posts events with kubectl (so requires an admin kubeconfig)
+type kubectlRecorder struct {
+	node string
+}
+
+// New returns a Recorder for a node (the hostname is used when node is empty)
+func New(node string) Recorder {
+	if node == "" {
+		node, _ = os.Hostname()
+	}
+	return &kubectlRecorder{node: node}
+}
+
+// Event will record an event against the node
+// Events are best effort and errors are only logged (the apiserver may not be up)
+func (r *kubectlRecorder) Event(eventType, reason, message string) {
+	b, err := json.Marshal(NewEvent(r.node, eventType, reason, message, time.Now()))
+	if err != nil {
+		log.Warnf("error encoding event %s: %v", reason, err)
+		return
+	}
+	if err = k8client.Create(string(b)); err != nil {
+		log.Warnf("error recording event %s: %v", reason, err)
+	}
+}
+
+// NewEvent returns an event resource for a node
+func NewEvent(node, eventType, reason, message string, now time.Time) podspec.Object {
+	timestamp := now.UTC().Format(time.RFC3339)
+	return podspec.Object{
+		"apiVersion": "v1",
+		"kind":       "Event",
+		"metadata": map[string]interface{}{
+			// Same naming as the kubernetes event recorder
+			"name":      fmt.Sprintf("%s.%x", node, now.UnixNano()),
+			"namespace": Namespace,
+		},
+		"involvedObject": map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Node",
+			"name":       node,
+		},
+		"type":    eventType,
+		"reason":  reason,
+		"message": message,
+		"source": map[string]interface{}{
+			"component": constants.ManagedByValue,
+			"host":      node,
+		},
+		"count":          1,
+		"firstTimestamp": timestamp,
+		"lastTimestamp":  timestamp,
+	}
+}
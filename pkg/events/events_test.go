@@ -0,0 +1,28 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewEvent(t *testing.T) {
+	now := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	e := NewEvent("node1", Warning, BootstrapFailed, "failed", now)
+
+	if e.Kind() != "Event" || e.Namespace() != Namespace {
+		t.Errorf("expected an Event in %s but got %s in %s", Namespace, e.Kind(), e.Namespace())
+	}
+	if e.Name() != "node1.1505df2f8ce03200" {
+		t.Errorf("unexpected event name %s", e.Name())
+	}
+	involved, _ := e["involvedObject"].(map[string]interface{})
+	if involved["kind"] != "Node" || involved["name"] != "node1" {
+		t.Errorf("expected the node as the involved object but got %v", involved)
+	}
+	if e["type"] != Warning || e["reason"] != BootstrapFailed {
+		t.Errorf("unexpected type / reason %v / %v", e["type"], e["reason"])
+	}
+	if e["firstTimestamp"] != "2018-01-02T03:04:05Z" {
+		t.Errorf("unexpected timestamp %v", e["firstTimestamp"])
+	}
+}
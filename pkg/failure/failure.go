@@ -0,0 +1,92 @@
+// Package failure has the errors that stop a bootstrap, each with what failed, the underlying cause, the bootstrap
+// phase it failed in and a hint on how to fix it (reported in the logs, status and summary)
+package failure
+
+import (
+	"fmt"
+)
+
+// Error is a failure with a remediation hint, the message and hint of the outermost error are reported
+type Error struct {
+	// Phase is the bootstrap phase that failed (set once the failure stops the bootstrap)
+	Phase string
+	// Message is what failed e.g. "etcd CA file missing at /x", the cause message is used when empty
+	Message string
+	// Cause is the underlying error (if any)
+	Cause error
+	// Hint is how to fix the failure e.g. "check the keto infra provisioned the etcd CA"
+	Hint string
+}
+
+// Error returns the message with the cause e.g. "error connecting to etcd [context deadline exceeded]"
+func (e *Error) Error() string {
+	if len(e.Message) == 0 && e.Cause != nil {
+		return e.Cause.Error()
+	}
+	if e.Cause != nil {
+		return fmt.Sprintf("%s [%v]", e.Message, e.Cause)
+	}
+	return e.Message
+}
+
+// New returns a failure with a remediation hint
+func New(message, hint string) error {
+	return &Error{Message: message, Hint: hint}
+}
+
+// Wrap returns a failure caused by an error with a remediation hint (nil when there's no error)
+func Wrap(err error, message, hint string) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Message: message, Cause: err, Hint: hint}
+}
+
+// WithPhase returns the error with the bootstrap phase it failed in (unless it already has one)
+func WithPhase(err error, phase string) error {
+	if err == nil || len(Phase(err)) > 0 {
+		return err
+	}
+	return &Error{Phase: phase, Cause: err}
+}
+
+// Hint returns the first hint of an error or its causes (empty when there isn't one)
+func Hint(err error) string {
+	for e, ok := err.(*Error); ok; e, ok = e.Cause.(*Error) {
+		if len(e.Hint) > 0 {
+			return e.Hint
+		}
+	}
+	return ""
+}
+
+// Phase returns the phase an error failed in (empty when not known)
+func Phase(err error) string {
+	for e, ok := err.(*Error); ok; e, ok = e.Cause.(*Error) {
+		if len(e.Phase) > 0 {
+			return e.Phase
+		}
+	}
+	return ""
+}
+
+// Cause returns the underlying error of a failure (the error itself for any other error) e.g. to compare with the
+// errors a package exports
+func Cause(err error) error {
+	for e, ok := err.(*Error); ok && e.Cause != nil; e, ok = err.(*Error) {
+		err = e.Cause
+	}
+	return err
+}
+
+// Describe returns the error with the hint (if any) for the logs and notifications e.g. "etcd CA file missing at /x:
+// check the keto infra provisioned the etcd CA"
+func Describe(err error) string {
+	if err == nil {
+		return ""
+	}
+	if hint := Hint(err); len(hint) > 0 {
+		return err.Error() + ": " + hint
+	}
+	return err.Error()
+}
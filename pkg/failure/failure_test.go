@@ -0,0 +1,47 @@
+package failure
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	cause := errors.New("context deadline exceeded")
+	err := Wrap(cause, "error connecting to etcd https://etcd0:2379", "check the etcd endpoints resolve")
+	if err.Error() != "error connecting to etcd https://etcd0:2379 [context deadline exceeded]" {
+		t.Errorf("unexpected error %q", err)
+	}
+	if Describe(err) != err.Error()+": check the etcd endpoints resolve" {
+		t.Errorf("unexpected description %q", Describe(err))
+	}
+	if Wrap(nil, "error connecting to etcd", "check") != nil {
+		t.Error("expected no failure without an error")
+	}
+	if Describe(cause) != cause.Error() {
+		t.Errorf("expected an error without a hint to be described as is but got %q", Describe(cause))
+	}
+}
+
+func TestWithPhase(t *testing.T) {
+	sentinel := New("deadline exceeded waiting for the shared assets", "check the primary master")
+	err := WithPhase(sentinel, "assets")
+	if err.Error() != sentinel.Error() {
+		t.Errorf("expected the phase to leave the message but got %q", err)
+	}
+	if Phase(err) != "assets" || Hint(err) != "check the primary master" {
+		t.Errorf("unexpected phase %q and hint %q", Phase(err), Hint(err))
+	}
+	if Cause(err) != sentinel {
+		t.Errorf("expected the cause to be the sentinel error but got %v", Cause(err))
+	}
+	if again := WithPhase(err, "hardening"); Phase(again) != "assets" {
+		t.Errorf("expected the first phase to be kept but got %q", Phase(again))
+	}
+	plain := errors.New("failed")
+	if Phase(plain) != "" || Hint(plain) != "" || Cause(plain) != plain {
+		t.Error("expected a plain error to have no phase or hint")
+	}
+	if WithPhase(nil, "assets") != nil {
+		t.Error("expected no failure without an error")
+	}
+}
@@ -0,0 +1,126 @@
+package faults
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/logging"
+)
+
+// logger is used for all the faults logs
+var logger = logging.New("faults")
+
+// Injection points
+const (
+	// AfterCreatePKI is after the primary master has created the cluster PKI (before it's shared)
+	AfterCreatePKI = "after-create-pki"
+	// BeforePutTx is before the primary master saves the assets to etcd
+	BeforePutTx = "before-put-tx"
+	// LockRenewal is while an expired lock is re-created (after the old lock is deleted)
+	LockRenewal = "lock-renewal"
+)
+
+// Actions
+const (
+	// Fail will return an error from the injection point
+	Fail = "fail"
+	// Exit will exit the process (as if killed) at the injection point
+	Exit = "exit"
+)
+
+var points = []string{AfterCreatePKI, BeforePutTx, LockRenewal}
+
+// fault is a failure or delay at an injection point
+type fault struct {
+	action string
+	delay  time.Duration
+}
+
+var (
+	mu     sync.Mutex
+	faults map[string][]fault
+	// exit is replaced in tests
+	exit = os.Exit
+)
+
+// Configure will set the faults to inject from a spec e.g. after-create-pki=30s,before-put-tx=fail
+// Each fault is a point and an action (fail, exit or a delay duration) and faults at the same point are injected in
+// order. An empty spec disables all faults.
+func Configure(spec string) error {
+	configured := map[string][]fault{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid fault %q, expecting point=action", item)
+		}
+		point, action := parts[0], parts[1]
+		if !validPoint(point) {
+			return fmt.Errorf("invalid fault point %q, must be one of: %s", point, strings.Join(points, ", "))
+		}
+		f := fault{action: action}
+		if action != Fail && action != Exit {
+			delay, err := time.ParseDuration(action)
+			if err != nil {
+				return fmt.Errorf("invalid fault action %q, must be %s, %s or a delay e.g. 30s", action, Fail, Exit)
+			}
+			f = fault{delay: delay}
+		}
+		configured[point] = append(configured[point], f)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	faults = configured
+	return nil
+}
+
+// Configured returns the points with faults to inject (sorted)
+func Configured() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	configured := []string{}
+	for point := range faults {
+		configured = append(configured, point)
+	}
+	sort.Strings(configured)
+	return configured
+}
+
+// Inject will carry out any faults configured for a point
+// An error is only returned for a fail action (nothing is done when no faults are configured)
+func Inject(point string) error {
+	mu.Lock()
+	pointFaults := faults[point]
+	mu.Unlock()
+	for _, f := range pointFaults {
+		switch {
+		case f.delay > 0:
+			logger.Warnf("Injecting a %v delay at %s", f.delay, point)
+			time.Sleep(f.delay)
+		case f.action == Fail:
+			logger.Warnf("Injecting a failure at %s", point)
+			return fmt.Errorf("injected failure at %s", point)
+		case f.action == Exit:
+			logger.Warnf("Injecting an exit at %s", point)
+			exit(1)
+		}
+	}
+	return nil
+}
+
+func validPoint(point string) bool {
+	for _, p := range points {
+		if p == point {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package faults
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInject(t *testing.T) {
+	exited := 0
+	exit = func(int) { exited++ }
+	defer func() {
+		exit = os.Exit
+		Configure("")
+	}()
+
+	if err := Configure("after-create-pki=10ms,after-create-pki=fail,lock-renewal=exit"); err != nil {
+		t.Fatal(err)
+	}
+	if configured := Configured(); !reflect.DeepEqual(configured, []string{AfterCreatePKI, LockRenewal}) {
+		t.Errorf("unexpected configured points %v", configured)
+	}
+
+	started := time.Now()
+	if err := Inject(AfterCreatePKI); err == nil {
+		t.Error("expected an injected failure")
+	}
+	if time.Since(started) < 10*time.Millisecond {
+		t.Error("expected the delay to be injected before the failure")
+	}
+	if err := Inject(LockRenewal); err != nil || exited != 1 {
+		t.Errorf("expected an exit but got %v (exited %d)", err, exited)
+	}
+	if err := Inject(BeforePutTx); err != nil {
+		t.Errorf("expected no fault at %s but got %v", BeforePutTx, err)
+	}
+}
+
+func TestConfigureInvalid(t *testing.T) {
+	defer Configure("")
+	for _, spec := range []string{"after-create-pki", "unknown=fail", "before-put-tx=later"} {
+		if err := Configure(spec); err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
@@ -2,7 +2,7 @@ package fileutil
 
 import (
     "fmt"
-    "io"
+    "io/ioutil"
     "os"
     "strings"
 )
@@ -101,28 +101,17 @@ func SymlinkFile(tgt, ln string) (err error) {
 }
 
 // copyFileContents copies the contents of the file named src to the file named
-// by dst. The file will be created if it does not already exist. If the
-// destination file exists, all it's contents will be replaced by the contents
-// of the source file.
+// by dst (with the same mode). The file will be created if it does not already exist.
+// If the destination file exists, all it's contents will be replaced (atomically)
+// by the contents of the source file.
 func copyFileContents(src, dst string) (err error) {
-    in, err := os.Open(src)
+    info, err := os.Stat(src)
     if err != nil {
         return
     }
-    defer in.Close()
-    out, err := os.Create(dst)
+    data, err := ioutil.ReadFile(src)
     if err != nil {
         return
     }
-    defer func() {
-        cerr := out.Close()
-        if err == nil {
-            err = cerr
-        }
-    }()
-    if _, err = io.Copy(out, in); err != nil {
-        return
-    }
-    err = out.Sync()
-    return
-}
\ No newline at end of file
+    return WriteFile(dst, data, info.Mode().Perm())
+}
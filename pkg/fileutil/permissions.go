@@ -0,0 +1,136 @@
+package fileutil
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Expected is the mode (and root ownership) expected for files matching a pattern
+type Expected struct {
+	Pattern string
+	Mode    os.FileMode
+}
+
+// Discrepancy records a file which didn't have the expected mode or owner (and has been fixed)
+type Discrepancy struct {
+	File   string
+	Detail string
+}
+
+// WriteFile will atomically write data to a file with exactly the mode specified (even if the file already exists)
+// The data is written and synced to a temporary file which is then renamed so the file is never readable with the
+// wrong mode and a crash part way through never leaves a truncated file (e.g. a key) behind
+func WriteFile(fileName string, data []byte, mode os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(fileName), "."+filepath.Base(fileName))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err = tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), fileName); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(fileName))
+}
+
+// syncDir will sync a directory so a rename within it survives a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// ShredFile will overwrite a file with zeros (synced to disk) before removing it e.g. for a key which mustn't be left
+// on disk. A symlink is only removed (the file it links to is left as is) and a missing file isn't an error.
+func ShredFile(fileName string) error {
+	info, err := os.Lstat(fileName)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if info.Mode().IsRegular() {
+		f, err := os.OpenFile(fileName, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		if _, err = f.Write(make([]byte, info.Size())); err != nil {
+			f.Close()
+			return err
+		}
+		if err = f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+		if err = f.Close(); err != nil {
+			return err
+		}
+	}
+	return os.Remove(fileName)
+}
+
+// IsKeyMaterial is true for data with a private key e.g. a PEM key or a kubeconfig with an embedded client key
+func IsKeyMaterial(data []byte) bool {
+	return bytes.Contains(data, []byte("PRIVATE KEY-----")) || bytes.Contains(data, []byte("client-key-data:"))
+}
+
+// EnforcePermissions will set the expected mode and root ownership for all matching files
+// returning any discrepancies found
+func EnforcePermissions(expected []Expected) ([]Discrepancy, error) {
+	var discrepancies []Discrepancy
+	for _, e := range expected {
+		files, err := filepath.Glob(e.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			info, err := os.Stat(file)
+			if err != nil {
+				return nil, err
+			}
+			if mode := info.Mode().Perm(); mode != e.Mode {
+				if err = os.Chmod(file, e.Mode); err != nil {
+					return nil, fmt.Errorf("failed to set mode of %s [%v]", file, err)
+				}
+				discrepancies = append(discrepancies, Discrepancy{
+					File:   file,
+					Detail: fmt.Sprintf("mode %#o changed to %#o", mode, e.Mode),
+				})
+			}
+			// Ownership can only be changed when running as root
+			stat, ok := info.Sys().(*syscall.Stat_t)
+			if !ok || os.Geteuid() != 0 || (stat.Uid == 0 && stat.Gid == 0) {
+				continue
+			}
+			if err = os.Chown(file, 0, 0); err != nil {
+				return nil, fmt.Errorf("failed to set owner of %s [%v]", file, err)
+			}
+			discrepancies = append(discrepancies, Discrepancy{
+				File:   file,
+				Detail: fmt.Sprintf("owner %d:%d changed to root", stat.Uid, stat.Gid),
+			})
+		}
+	}
+	return discrepancies, nil
+}
@@ -0,0 +1,78 @@
+package hardening
+
+import (
+	"strings"
+)
+
+// strongCiphers are the TLS cipher suites recommended by the CIS benchmark
+var strongCiphers = strings.Join([]string{
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305",
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305",
+}, ",")
+
+// probeReason is why some checks can't be enforced with kubeadm manifests
+const probeReason = "not set, the kubeadm liveness probes depend on it"
+
+// cisProfile is based on the CIS Kubernetes Benchmark
+var cisProfile = &Profile{
+	Name: "cis",
+	Checks: []Check{
+		// Master node - API server
+		{ID: "1.1.1", Description: "Ensure anonymous-auth is false", Component: APIServer, Flag: "anonymous-auth",
+			Expect: func(v string, set bool) bool { return set && v == "false" }, Reason: probeReason},
+		{ID: "1.1.2", Description: "Ensure basic-auth-file is not set", Component: APIServer, Flag: "basic-auth-file", Expect: notSet},
+		{ID: "1.1.3", Description: "Ensure insecure-allow-any-token is not set", Component: APIServer, Flag: "insecure-allow-any-token", Expect: notSet},
+		{ID: "1.1.4", Description: "Ensure kubelet-https is true", Component: APIServer, Flag: "kubelet-https",
+			Expect: func(v string, set bool) bool { return !set || v == "true" }},
+		{ID: "1.1.5", Description: "Ensure insecure-bind-address is not set", Component: APIServer, Flag: "insecure-bind-address", Expect: notSet},
+		{ID: "1.1.6", Description: "Ensure insecure-port is 0", Component: APIServer, Flag: "insecure-port",
+			Expect: func(v string, set bool) bool { return set && v == "0" }, Reason: probeReason},
+		{ID: "1.1.8", Description: "Ensure profiling is false", Component: APIServer, Flag: "profiling", Value: "false"},
+		{ID: "1.1.10", Description: "Ensure authorization-mode is not AlwaysAllow", Component: APIServer, Flag: "authorization-mode",
+			Expect: func(v string, set bool) bool { return set && !strings.Contains(v, "AlwaysAllow") }},
+		{ID: "1.1.21", Description: "Ensure kubelet-certificate-authority is set", Component: APIServer, Flag: "kubelet-certificate-authority",
+			Expect: isSet, Reason: "requires kubelet serving certificates signed by the cluster CA"},
+		{ID: "1.1.22", Description: "Ensure kubelet-client-certificate is set", Component: APIServer, Flag: "kubelet-client-certificate", Expect: isSet},
+		{ID: "1.1.23", Description: "Ensure service-account-lookup is true", Component: APIServer, Flag: "service-account-lookup", Value: "true"},
+		{ID: "1.1.25", Description: "Ensure service-account-key-file is set", Component: APIServer, Flag: "service-account-key-file", Expect: isSet},
+		{ID: "1.1.26", Description: "Ensure etcd-certfile is set", Component: APIServer, Flag: "etcd-certfile", Expect: isSet},
+		{ID: "1.1.27", Description: "Ensure etcd-keyfile is set", Component: APIServer, Flag: "etcd-keyfile", Expect: isSet},
+		{ID: "1.1.28", Description: "Ensure etcd-cafile is set", Component: APIServer, Flag: "etcd-cafile", Expect: isSet},
+		{ID: "1.1.29", Description: "Ensure tls-cert-file is set", Component: APIServer, Flag: "tls-cert-file", Expect: isSet},
+		{ID: "1.1.30", Description: "Ensure client-ca-file is set", Component: APIServer, Flag: "client-ca-file", Expect: isSet},
+		{ID: "1.1.31", Description: "Ensure strong TLS ciphers are used", Component: APIServer, Flag: "tls-cipher-suites", Value: strongCiphers},
+		// Master node - scheduler
+		{ID: "1.2.1", Description: "Ensure profiling is false", Component: Scheduler, Flag: "profiling", Value: "false"},
+		// Master node - controller manager
+		{ID: "1.3.1", Description: "Ensure terminated-pod-gc-threshold is set", Component: ControllerManager, Flag: "terminated-pod-gc-threshold", Value: "10"},
+		{ID: "1.3.2", Description: "Ensure profiling is false", Component: ControllerManager, Flag: "profiling", Value: "false"},
+		{ID: "1.3.3", Description: "Ensure use-service-account-credentials is true", Component: ControllerManager, Flag: "use-service-account-credentials", Value: "true"},
+		{ID: "1.3.4", Description: "Ensure service-account-private-key-file is set", Component: ControllerManager, Flag: "service-account-private-key-file", Expect: isSet},
+		{ID: "1.3.5", Description: "Ensure root-ca-file is set", Component: ControllerManager, Flag: "root-ca-file", Expect: isSet},
+		// Worker node - kubelet
+		// (anonymous-auth, authorization-mode, client-ca-file and read-only-port are kubelet defaults for keto-k8)
+		{ID: "2.1.1", Description: "Ensure anonymous-auth is false", Component: Kubelet, Flag: "anonymous-auth",
+			Expect: func(v string, set bool) bool { return set && v == "false" }},
+		{ID: "2.1.2", Description: "Ensure authorization-mode is not AlwaysAllow", Component: Kubelet, Flag: "authorization-mode",
+			Expect: func(v string, set bool) bool { return set && !strings.Contains(v, "AlwaysAllow") }},
+		{ID: "2.1.3", Description: "Ensure client-ca-file is set", Component: Kubelet, Flag: "client-ca-file", Expect: isSet},
+		{ID: "2.1.4", Description: "Ensure read-only-port is 0", Component: Kubelet, Flag: "read-only-port",
+			Expect: func(v string, set bool) bool { return set && v == "0" }},
+		{ID: "2.1.5", Description: "Ensure streaming-connection-idle-timeout is not 0", Component: Kubelet, Flag: "streaming-connection-idle-timeout", Value: "5m"},
+		{ID: "2.1.7", Description: "Ensure make-iptables-util-chains is true", Component: Kubelet, Flag: "make-iptables-util-chains", Value: "true"},
+		{ID: "2.1.14", Description: "Ensure strong TLS ciphers are used", Component: Kubelet, Flag: "tls-cipher-suites", Value: strongCiphers},
+	},
+	FileChecks: []FileCheck{
+		{ID: "1.4.1", Description: "Ensure static pod manifests are 644 or more restrictive", Pattern: "/etc/kubernetes/manifests/*.yaml", MaxMode: 0644},
+		{ID: "1.4.13", Description: "Ensure admin.conf is 644 or more restrictive", Pattern: "/etc/kubernetes/admin.conf", MaxMode: 0644},
+		{ID: "1.4.15", Description: "Ensure scheduler.conf is 644 or more restrictive", Pattern: "/etc/kubernetes/scheduler.conf", MaxMode: 0644},
+		{ID: "1.4.17", Description: "Ensure controller-manager.conf is 644 or more restrictive", Pattern: "/etc/kubernetes/controller-manager.conf", MaxMode: 0644},
+		{ID: "1.4.21", Description: "Ensure PKI keys are 600", Pattern: "/etc/kubernetes/pki/*.key", MaxMode: 0600},
+		{ID: "2.2.1", Description: "Ensure kubelet.conf is 644 or more restrictive", Pattern: "/etc/kubernetes/kubelet.conf", MaxMode: 0644},
+		{ID: "2.2.3", Description: "Ensure the kubelet unit is 644 or more restrictive", Pattern: "/etc/systemd/system/kubelet.service", MaxMode: 0644},
+	},
+}
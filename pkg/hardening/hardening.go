@@ -0,0 +1,206 @@
+package hardening
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The components a check can apply to
+const (
+	APIServer         = "kube-apiserver"
+	ControllerManager = "kube-controller-manager"
+	Scheduler         = "kube-scheduler"
+	Kubelet           = "kubelet"
+)
+
+// Check is a single benchmark recommendation for a component flag
+type Check struct {
+	ID          string
+	Description string
+	Component   string
+	Flag        string
+	// Value is set by the profile and is the value expected (empty for report only checks)
+	Value string
+	// Expect will validate the configured value for report only checks
+	Expect func(value string, set bool) bool
+	// Reason explains why a report only check isn't set by the profile
+	Reason string
+}
+
+// FileCheck is a benchmark recommendation for file permissions
+type FileCheck struct {
+	ID          string
+	Description string
+	Pattern     string
+	MaxMode     os.FileMode
+}
+
+// Profile is a named set of checks
+type Profile struct {
+	Name       string
+	Checks     []Check
+	FileChecks []FileCheck
+}
+
+// Result is the outcome of a check
+type Result struct {
+	ID          string
+	Description string
+	Satisfied   bool
+	Detail      string
+}
+
+// Profiles are the supported hardening profiles by name
+var Profiles = map[string]*Profile{
+	cisProfile.Name: cisProfile,
+}
+
+// Get returns a profile by name (nil when no profile is required)
+func Get(name string) (*Profile, error) {
+	if len(name) == 0 {
+		return nil, nil
+	}
+	p, ok := Profiles[name]
+	if !ok {
+		var names []string
+		for n := range Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("invalid hardening profile %q, must be one of: %s", name, strings.Join(names, ", "))
+	}
+	return p, nil
+}
+
+// Args returns the flags the profile sets for a component
+func (p *Profile) Args(component string) map[string]string {
+	args := map[string]string{}
+	if p == nil {
+		return args
+	}
+	for _, c := range p.Checks {
+		if c.Component == component && len(c.Value) > 0 {
+			args[c.Flag] = c.Value
+		}
+	}
+	return args
+}
+
+// ArgsString returns the flags for a component as a command line e.g. for a systemd unit
+func (p *Profile) ArgsString(component string) string {
+	args := p.Args(component)
+	var flags []string
+	for k, v := range args {
+		flags = append(flags, "--"+k+"="+v)
+	}
+	sort.Strings(flags)
+	return strings.Join(flags, " ")
+}
+
+// Evaluate will check the actual flags of each component present (by component name)
+func (p *Profile) Evaluate(flags map[string]map[string]string) []Result {
+	var results []Result
+	for _, c := range p.Checks {
+		componentFlags, ok := flags[c.Component]
+		if !ok {
+			continue
+		}
+		value, set := componentFlags[c.Flag]
+		r := Result{
+			ID:          c.ID,
+			Description: c.Description,
+		}
+		if c.Expect != nil {
+			r.Satisfied = c.Expect(value, set)
+		} else {
+			r.Satisfied = set && value == c.Value
+		}
+		if set {
+			r.Detail = fmt.Sprintf("%s --%s=%s", c.Component, c.Flag, value)
+		} else {
+			r.Detail = fmt.Sprintf("%s --%s not set", c.Component, c.Flag)
+		}
+		if !r.Satisfied && len(c.Reason) > 0 {
+			r.Detail = r.Detail + " (" + c.Reason + ")"
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// HardenFiles will remove any permissions beyond those recommended and report on each file
+func (p *Profile) HardenFiles() ([]Result, error) {
+	var results []Result
+	for _, fc := range p.FileChecks {
+		files, err := filepath.Glob(fc.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			info, err := os.Stat(file)
+			if err != nil {
+				return nil, err
+			}
+			mode := info.Mode().Perm()
+			if mode&^fc.MaxMode != 0 {
+				mode = mode & fc.MaxMode
+				if err = os.Chmod(file, mode); err != nil {
+					return nil, fmt.Errorf("failed to set permissions on %s [%v]", file, err)
+				}
+			}
+			results = append(results, Result{
+				ID:          fc.ID,
+				Description: fc.Description,
+				Satisfied:   true,
+				Detail:      fmt.Sprintf("%s %#o", file, mode),
+			})
+		}
+	}
+	return results, nil
+}
+
+// Report will format results as text
+func Report(profile string, results []Result) string {
+	var lines []string
+	satisfied := 0
+	for _, r := range results {
+		status := "FAIL"
+		if r.Satisfied {
+			status = "PASS"
+			satisfied++
+		}
+		lines = append(lines, fmt.Sprintf("[%s] %s %s: %s", status, r.ID, r.Description, r.Detail))
+	}
+	header := fmt.Sprintf("Hardening profile %s: %d of %d checks satisfied", profile, satisfied, len(results))
+	return header + "\n" + strings.Join(lines, "\n") + "\n"
+}
+
+// ParseFlags will return the --flag=value arguments from a command line
+func ParseFlags(args []string) map[string]string {
+	flags := map[string]string{}
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--") {
+			continue
+		}
+		kv := strings.SplitN(strings.TrimPrefix(arg, "--"), "=", 2)
+		if len(kv) == 2 {
+			flags[kv[0]] = strings.Trim(kv[1], `"`)
+		} else {
+			flags[kv[0]] = ""
+		}
+	}
+	return flags
+}
+
+// isSet is used for report only checks where any value is acceptable
+func isSet(value string, set bool) bool {
+	return set && len(value) > 0
+}
+
+// notSet is used for report only checks where a flag must not be used
+func notSet(value string, set bool) bool {
+	return !set
+}
@@ -0,0 +1,55 @@
+package hardening
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	if p, err := Get(""); p != nil || err != nil {
+		t.Errorf("expected no profile and no error when not set")
+	}
+	if _, err := Get("unknown"); err == nil {
+		t.Errorf("expected an error for an unknown profile")
+	}
+	p, err := Get("cis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Args(Scheduler)["profiling"] != "false" {
+		t.Errorf("expected the cis profile to disable scheduler profiling")
+	}
+	if _, ok := p.Args(APIServer)["anonymous-auth"]; ok {
+		t.Errorf("didn't expect report only checks to be set")
+	}
+}
+
+func TestNilProfileArgs(t *testing.T) {
+	var p *Profile
+	if len(p.Args(APIServer)) != 0 || p.ArgsString(Kubelet) != "" {
+		t.Errorf("expected no args without a profile")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	p, _ := Get("cis")
+	flags := map[string]map[string]string{
+		Scheduler: ParseFlags([]string{"kube-scheduler", "--profiling=false", "--leader-elect=true"}),
+	}
+	results := p.Evaluate(flags)
+	if len(results) != 1 {
+		t.Fatalf("expected only the scheduler check to be evaluated but got %v", results)
+	}
+	if !results[0].Satisfied {
+		t.Errorf("expected the scheduler check to be satisfied: %v", results[0])
+	}
+	report := Report(p.Name, results)
+	if !strings.HasPrefix(report, "Hardening profile cis: 1 of 1 checks satisfied") {
+		t.Errorf("unexpected report:\n%s", report)
+	}
+
+	flags[Scheduler]["profiling"] = "true"
+	if p.Evaluate(flags)[0].Satisfied {
+		t.Errorf("expected the scheduler check to fail with profiling enabled")
+	}
+}
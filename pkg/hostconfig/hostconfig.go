@@ -0,0 +1,170 @@
+package hostconfig
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/command"
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+	"github.com/UKHomeOffice/keto-k8/pkg/logging"
+)
+
+// header is the first line of the files written (so they aren't mistaken for the image's own)
+const header = "# Written by keto-k8, changes will be overwritten\n"
+
+var (
+	// Enabled will load the kernel modules and set the sysctls (the host is assumed to be prepared when not)
+	Enabled bool
+	// NetworkProvider selects the extra kernel modules the network provider needs
+	NetworkProvider string
+	// ConntrackMax is the conntrack table size for kube-proxy (the kernel default when zero)
+	ConntrackMax int
+	// Sysctls are any extra sysctls to set, they take precedence over the required sysctls
+	Sysctls map[string]string
+
+	// SysctlFile persists the sysctls (read by systemd-sysctl on boot)
+	SysctlFile = "/etc/sysctl.d/90-keto-k8.conf"
+	// ModulesFile persists the kernel modules (read by systemd-modules-load on boot)
+	ModulesFile = "/etc/modules-load.d/keto-k8.conf"
+
+	logger = logging.New("hostconfig")
+
+	// procSys is where the sysctls are set (replaced by tests)
+	procSys = "/proc/sys"
+
+	// run loads the kernel modules (replaced by tests)
+	run = func(name string, args ...string) (string, error) {
+		return command.Run(logger, "", name, args...)
+	}
+)
+
+// baseModules are needed by the kubelet, kube-proxy (in iptables mode) and the container runtime on every node
+var baseModules = []string{"br_netfilter", "overlay", "nf_conntrack"}
+
+// providerModules are the extra modules each network provider needs
+var providerModules = map[string][]string{
+	"flannel": {"vxlan"},
+	"canal":   {"vxlan", "ip_set", "xt_set"},
+	"weave":   {"ip_set", "xt_set"},
+}
+
+// requiredSysctls are needed on every node, pods are routed and bridged traffic must pass through the kube-proxy rules
+var requiredSysctls = map[string]string{
+	"net.ipv4.ip_forward":                 "1",
+	"net.bridge.bridge-nf-call-iptables":  "1",
+	"net.bridge.bridge-nf-call-ip6tables": "1",
+}
+
+// Modules returns the kernel modules needed on a node with the network provider
+func Modules(networkProvider string) []string {
+	return append(append([]string{}, baseModules...), providerModules[networkProvider]...)
+}
+
+// RequiredSysctls returns the sysctls to set (by key) with the conntrack table size and any extra sysctls
+func RequiredSysctls() map[string]string {
+	sysctls := map[string]string{}
+	for k, v := range requiredSysctls {
+		sysctls[k] = v
+	}
+	if ConntrackMax > 0 {
+		sysctls["net.netfilter.nf_conntrack_max"] = strconv.Itoa(ConntrackMax)
+	}
+	for k, v := range Sysctls {
+		sysctls[k] = v
+	}
+	return sysctls
+}
+
+// Validate will check the conntrack table size and that the extra sysctls are keys with values
+func Validate() error {
+	if ConntrackMax < 0 {
+		return fmt.Errorf("invalid conntrack max %d", ConntrackMax)
+	}
+	for k, v := range Sysctls {
+		if len(k) == 0 || strings.ContainsAny(k, "/ ") || strings.HasPrefix(k, ".") {
+			return fmt.Errorf("invalid sysctl %q", k)
+		}
+		if len(v) == 0 {
+			return fmt.Errorf("sysctl %q needs a value", k)
+		}
+	}
+	return nil
+}
+
+// Configure will load the kernel modules and set the sysctls, both are persisted so they survive a reboot. The modules
+// are loaded first as the bridge sysctls only exist once br_netfilter is loaded. It's safe to re-run.
+func Configure() error {
+	if !Enabled {
+		return nil
+	}
+	modules := Modules(NetworkProvider)
+	if err := writeIfChanged(ModulesFile, header+strings.Join(modules, "\n")+"\n"); err != nil {
+		return err
+	}
+	for _, module := range modules {
+		if _, err := run("modprobe", module); err != nil {
+			return fmt.Errorf("failed to load the kernel module %s, install the kernel modules package for the "+
+				"running kernel [%v]", module, err)
+		}
+	}
+
+	sysctls := RequiredSysctls()
+	keys := make([]string, 0, len(sysctls))
+	for k := range sysctls {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var conf bytes.Buffer
+	conf.WriteString(header)
+	for _, k := range keys {
+		fmt.Fprintf(&conf, "%s = %s\n", k, sysctls[k])
+	}
+	if err := writeIfChanged(SysctlFile, conf.String()); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := setSysctl(k, sysctls[k]); err != nil {
+			return err
+		}
+	}
+	logger.Printf("Host configured with the kernel modules %s and %d sysctls", strings.Join(modules, ", "), len(keys))
+	return nil
+}
+
+// setSysctl will set a sysctl on the running kernel (unless it's already set)
+func setSysctl(key, value string) error {
+	path := filepath.Join(procSys, strings.Replace(key, ".", "/", -1))
+	current, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("sysctl %s not found, is the kernel module loaded? [%v]", key, err)
+	}
+	if strings.TrimSpace(string(current)) == value {
+		return nil
+	}
+	logger.Printf("Setting sysctl %s = %s", key, value)
+	if err = ioutil.WriteFile(path, []byte(value+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to set sysctl %s [%v]", key, err)
+	}
+	return nil
+}
+
+// writeIfChanged will write a file unless it already has the contents
+func writeIfChanged(fileName, contents string) error {
+	current, err := ioutil.ReadFile(fileName)
+	if err == nil && string(current) == contents {
+		return nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return err
+	}
+	return fileutil.WriteFile(fileName, []byte(contents), 0644)
+}
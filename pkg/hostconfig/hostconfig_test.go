@@ -0,0 +1,124 @@
+package hostconfig
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeHost will replace the host files with files under dir and record the modules loaded
+func fakeHost(t *testing.T, dir string, sysctls ...string) *[]string {
+	SysctlFile = filepath.Join(dir, "sysctl.d", "90-keto-k8.conf")
+	ModulesFile = filepath.Join(dir, "modules-load.d", "keto-k8.conf")
+	procSys = filepath.Join(dir, "proc")
+	for _, key := range sysctls {
+		path := filepath.Join(procSys, strings.Replace(key, ".", "/", -1))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("0\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	loaded := &[]string{}
+	run = func(name string, args ...string) (string, error) {
+		if args[0] == "missing" {
+			return "", fmt.Errorf("module missing not found")
+		}
+		*loaded = append(*loaded, args[0])
+		return "", nil
+	}
+	return loaded
+}
+
+func TestModules(t *testing.T) {
+	if modules := Modules("canal"); !reflect.DeepEqual(modules, []string{"br_netfilter", "overlay", "nf_conntrack", "vxlan", "ip_set", "xt_set"}) {
+		t.Errorf("unexpected canal modules %v", modules)
+	}
+	if modules := Modules(""); !reflect.DeepEqual(modules, baseModules) {
+		t.Errorf("unexpected modules without a network provider %v", modules)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hostconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(enabled bool, provider string, conntrack int, sysctls map[string]string, sysctlFile, modulesFile, proc string, r func(string, ...string) (string, error)) {
+		Enabled, NetworkProvider, ConntrackMax, Sysctls, SysctlFile, ModulesFile, procSys, run = enabled, provider, conntrack, sysctls, sysctlFile, modulesFile, proc, r
+	}(Enabled, NetworkProvider, ConntrackMax, Sysctls, SysctlFile, ModulesFile, procSys, run)
+
+	loaded := fakeHost(t, dir, "net.ipv4.ip_forward", "net.bridge.bridge-nf-call-iptables",
+		"net.bridge.bridge-nf-call-ip6tables", "net.netfilter.nf_conntrack_max", "vm.max_map_count")
+
+	// Nothing is done unless enabled
+	if err = Configure(); err != nil || len(*loaded) > 0 {
+		t.Fatalf("expected the host to be left alone but loaded %v [%v]", *loaded, err)
+	}
+
+	Enabled = true
+	NetworkProvider = "flannel"
+	ConntrackMax = 262144
+	Sysctls = map[string]string{"vm.max_map_count": "262144"}
+	if err = Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err = Configure(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*loaded, Modules("flannel")) {
+		t.Errorf("expected the flannel modules to be loaded but got %v", *loaded)
+	}
+	if modules, _ := ioutil.ReadFile(ModulesFile); !strings.Contains(string(modules), "\nbr_netfilter\noverlay\nnf_conntrack\nvxlan\n") {
+		t.Errorf("unexpected modules file:\n%s", modules)
+	}
+	conf, err := ioutil.ReadFile(SysctlFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"net.ipv4.ip_forward = 1\n", "net.netfilter.nf_conntrack_max = 262144\n", "vm.max_map_count = 262144\n"} {
+		if !strings.Contains(string(conf), expected) {
+			t.Errorf("expected %q in the sysctl file:\n%s", expected, conf)
+		}
+	}
+	if value, _ := ioutil.ReadFile(filepath.Join(procSys, "net", "bridge", "bridge-nf-call-iptables")); string(value) != "1\n" {
+		t.Errorf("expected the bridge sysctl to be set but got %q", value)
+	}
+
+	// A sysctl the kernel doesn't have is an error
+	Sysctls = map[string]string{"net.unknown": "1"}
+	if err = Configure(); err == nil {
+		t.Error("expected an error for an unknown sysctl")
+	}
+	Sysctls = nil
+	baseModules = append(baseModules, "missing")
+	defer func() { baseModules = baseModules[:len(baseModules)-1] }()
+	if err = Configure(); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("expected an error for a missing module but got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	defer func(conntrack int, sysctls map[string]string) { ConntrackMax, Sysctls = conntrack, sysctls }(ConntrackMax, Sysctls)
+	for _, invalid := range []map[string]string{
+		{"net/ipv4/ip_forward": "1"},
+		{"net.ipv4.ip_forward": ""},
+		{"": "1"},
+	} {
+		Sysctls = invalid
+		if err := Validate(); err == nil {
+			t.Errorf("expected %v to be invalid", invalid)
+		}
+	}
+	Sysctls = nil
+	ConntrackMax = -1
+	if err := Validate(); err == nil {
+		t.Error("expected a negative conntrack max to be invalid")
+	}
+}
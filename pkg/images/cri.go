@@ -0,0 +1,44 @@
+package images
+
+import (
+	"encoding/json"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/command"
+)
+
+// CRIPuller pulls images with crictl (the timeout is the crictl command timeout)
+type CRIPuller struct {
+	// Endpoint is the CRI socket (crictl's default when empty)
+	Endpoint string
+}
+
+// Pull will pull an image
+func (c *CRIPuller) Pull(image string) error {
+	_, err := command.Run(logger, "", "crictl", append(c.args(), "pull", image)...)
+	return err
+}
+
+// Digest returns the registry digest of a pulled image (from the repo digests crictl inspects)
+func (c *CRIPuller) Digest(image string) (string, error) {
+	out, err := command.Output(logger, "", "crictl", append(c.args(), "inspecti", "--output", "json", image)...)
+	if err != nil {
+		return "", err
+	}
+	var inspect struct {
+		Status struct {
+			RepoDigests []string `json:"repoDigests"`
+		} `json:"status"`
+	}
+	if err = json.Unmarshal([]byte(out), &inspect); err != nil {
+		return "", err
+	}
+	return repoDigest(image, inspect.Status.RepoDigests)
+}
+
+// args are the crictl args for the endpoint
+func (c *CRIPuller) args() []string {
+	if len(c.Endpoint) > 0 {
+		return []string{"--runtime-endpoint", c.Endpoint}
+	}
+	return nil
+}
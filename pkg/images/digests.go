@@ -0,0 +1,101 @@
+package images
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+)
+
+// digestPattern is the format of an image digest
+var digestPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// Resolver is implemented by the pullers which can find the digest of an image they've pulled
+type Resolver interface {
+	Digest(image string) (string, error)
+}
+
+// ValidateDigests will check the digests (by image e.g. name:tag => sha256:<hex>)
+func ValidateDigests(digests map[string]string) error {
+	for image, digest := range digests {
+		if strings.Contains(image, "@") {
+			return fmt.Errorf("image %q is already pinned to a digest", image)
+		}
+		if !digestPattern.MatchString(digest) {
+			return fmt.Errorf("invalid digest %q for image %q, expected sha256:<64 hex characters>", digest, image)
+		}
+	}
+	return nil
+}
+
+// Resolve returns the digest of each image (already pulled) by the puller, images already pinned are skipped
+func Resolve(p Puller, images []string) (map[string]string, error) {
+	resolver, ok := p.(Resolver)
+	if !ok {
+		return nil, fmt.Errorf("the image runtime can't resolve image digests")
+	}
+	digests := map[string]string{}
+	for _, image := range images {
+		if _, seen := digests[image]; seen || strings.Contains(image, "@") {
+			continue
+		}
+		digest, err := resolver.Digest(image)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve the digest of image %s: %v", image, err)
+		}
+		if !digestPattern.MatchString(digest) {
+			return nil, fmt.Errorf("unexpected digest %q for image %s", digest, image)
+		}
+		digests[image] = digest
+	}
+	return digests, nil
+}
+
+// Pin returns the image by digest when it has one e.g. name:tag => name@sha256:<hex>
+func Pin(image string, digests map[string]string) string {
+	digest, ok := digests[image]
+	if !ok {
+		return image
+	}
+	name, _ := splitImage(image)
+	return name + "@" + digest
+}
+
+// PinMutator will pin the images of all the containers with a digest
+func PinMutator(digests map[string]string) podspec.Mutator {
+	return func(o podspec.Object) error {
+		if len(digests) == 0 || !o.HasPodSpec() {
+			return nil
+		}
+		for _, c := range o.Containers() {
+			if image, ok := c["image"].(string); ok {
+				c["image"] = Pin(image, digests)
+			}
+		}
+		return nil
+	}
+}
+
+// PinPatch returns the (strategic merge) patch pinning the images of a deployed workload, empty when there are none
+func PinPatch(o podspec.Object, digests map[string]string) (string, error) {
+	var containers []map[string]interface{}
+	for _, c := range o.Containers() {
+		image, _ := c["image"].(string)
+		if pinned := Pin(image, digests); pinned != image {
+			containers = append(containers, map[string]interface{}{"name": c["name"], "image": pinned})
+		}
+	}
+	if len(containers) == 0 {
+		return "", nil
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{"containers": containers},
+			},
+		},
+	})
+	return string(patch), err
+}
@@ -0,0 +1,120 @@
+package images
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultPullTimeout is how long a single image pull can take with the docker engine API
+const DefaultPullTimeout = 10 * time.Minute
+
+// DockerPuller pulls images with the docker engine API on a unix socket
+type DockerPuller struct {
+	Socket string
+	// Timeout for each pull (defaults to DefaultPullTimeout)
+	Timeout time.Duration
+}
+
+// pullMessage is a message from the progress stream of a pull
+type pullMessage struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+}
+
+// Pull will pull an image (the docker engine reports failures part way through in the progress stream)
+func (d *DockerPuller) Pull(image string) error {
+	name, tag := splitImage(image)
+	query := url.Values{"fromImage": {name}, "tag": {tag}}
+	resp, err := d.client().Post("http://docker/images/create?"+query.Encode(), "text/plain", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("docker returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var msg pullMessage
+		if err = decoder.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if len(msg.Error) > 0 {
+			return fmt.Errorf("%s", msg.Error)
+		}
+		logger.Debugf("Pulling %s: %s", image, msg.Status)
+	}
+}
+
+// Digest returns the registry digest of a pulled image (from the repo digests docker recorded when pulling it)
+func (d *DockerPuller) Digest(image string) (string, error) {
+	resp, err := d.client().Get("http://docker/images/" + image + "/json")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("docker returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var inspect struct {
+		RepoDigests []string `json:"RepoDigests"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&inspect); err != nil {
+		return "", err
+	}
+	return repoDigest(image, inspect.RepoDigests)
+}
+
+// client returns the docker engine API client (on the unix socket)
+func (d *DockerPuller) client() *http.Client {
+	timeout := d.Timeout
+	if timeout <= 0 {
+		timeout = DefaultPullTimeout
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Dial: func(_, _ string) (net.Conn, error) {
+				return net.Dial("unix", d.Socket)
+			},
+		},
+	}
+}
+
+// repoDigest returns the digest from the repo digests (name@sha256:<hex>) for the image name, the only digest is used
+// when the runtime records the name differently e.g. with a docker.io/ prefix
+func repoDigest(image string, repoDigests []string) (string, error) {
+	name, _ := splitImage(image)
+	for _, rd := range repoDigests {
+		if repo, digest := splitImage(rd); repo == name {
+			return digest, nil
+		}
+	}
+	if len(repoDigests) == 1 {
+		_, digest := splitImage(repoDigests[0])
+		return digest, nil
+	}
+	return "", fmt.Errorf("no repo digest for %s (found %s)", image, strings.Join(repoDigests, ", "))
+}
+
+// splitImage returns the image name and the tag (or digest) e.g. registry:5000/name:tag => registry:5000/name, tag
+func splitImage(image string) (name, tag string) {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return image[:i], image[i+1:]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:]
+	}
+	return image, "latest"
+}
@@ -0,0 +1,151 @@
+package images
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/logging"
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+	"github.com/UKHomeOffice/keto-k8/pkg/profile"
+	"k8s.io/kubernetes/pkg/util/version"
+)
+
+// Runtimes which can pull images
+const (
+	// Docker pulls with the docker engine API
+	Docker = "docker"
+	// CRI pulls with crictl (for any CRI runtime e.g. containerd or cri-o)
+	CRI = "cri"
+	// None won't pre-pull any images
+	None = "none"
+)
+
+const (
+	// Registry is where kubeadm gets the control plane images from
+	Registry = "gcr.io/google_containers"
+	// Arch of the control plane images
+	Arch = "amd64"
+	// DefaultDockerEndpoint is the docker engine socket
+	DefaultDockerEndpoint = "unix:///var/run/docker.sock"
+)
+
+var logger = logging.New("images")
+
+// dnsVersions are the kube-dns versions deployed by kubeadm (from the kubernetes minor version)
+var dnsVersions = []struct {
+	Min     *version.Version
+	Version string
+}{
+	{Min: version.MustParseGeneric("v1.10.0"), Version: "1.14.8"},
+	{Min: version.MustParseGeneric("v1.9.0"), Version: "1.14.7"},
+	{Min: version.MustParseGeneric("v1.8.0"), Version: "1.14.5"},
+	{Min: version.MustParseGeneric("v1.0.0"), Version: "1.14.4"},
+}
+
+// pauseVersions are the pause (pod sandbox) versions used by the kubelet
+var pauseVersions = []struct {
+	Min     *version.Version
+	Version string
+}{
+	{Min: version.MustParseGeneric("v1.10.0"), Version: "3.1"},
+	{Min: version.MustParseGeneric("v1.0.0"), Version: "3.0"},
+}
+
+// Puller will pull an image onto the node
+type Puller interface {
+	Pull(image string) error
+}
+
+// NewPuller returns the puller for a runtime (nil when not pre-pulling images)
+// The endpoint is the runtime socket e.g. unix:///var/run/docker.sock (defaults for the runtime when empty)
+func NewPuller(runtime, endpoint string) (Puller, error) {
+	switch runtime {
+	case Docker:
+		if len(endpoint) == 0 {
+			endpoint = DefaultDockerEndpoint
+		}
+		return &DockerPuller{Socket: strings.TrimPrefix(endpoint, "unix://")}, nil
+	case CRI:
+		return &CRIPuller{Endpoint: endpoint}, nil
+	case None, "":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown image runtime %q (expecting %s, %s or %s)", runtime, Docker, CRI, None)
+}
+
+// ControlPlane returns the images kubeadm runs the control plane, kube-proxy and kube-dns with for a kubernetes version
+// (and the pause image the kubelet needs for every pod)
+func ControlPlane(kubeVersion string) ([]string, error) {
+	v, err := version.ParseGeneric(kubeVersion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kubernetes version %q: %v", kubeVersion, err)
+	}
+	tag := "v" + strings.TrimPrefix(kubeVersion, "v")
+	var images []string
+	for _, component := range []string{"apiserver", "controller-manager", "scheduler", "proxy"} {
+		images = append(images, fmt.Sprintf("%s/kube-%s-%s:%s", Registry, component, Arch, tag))
+	}
+	for _, dns := range dnsVersions {
+		if v.AtLeast(dns.Min) {
+			for _, component := range []string{"kube-dns", "dnsmasq-nanny", "sidecar"} {
+				images = append(images, fmt.Sprintf("%s/k8s-dns-%s-%s:%s", Registry, component, Arch, dns.Version))
+			}
+			break
+		}
+	}
+	for _, pause := range pauseVersions {
+		if v.AtLeast(pause.Min) {
+			images = append(images, fmt.Sprintf("%s/pause-%s:%s", Registry, Arch, pause.Version))
+			break
+		}
+	}
+	return images, nil
+}
+
+// FromManifests returns the images of all the containers in the resources (yaml documents)
+func FromManifests(doc string) ([]string, error) {
+	objs, err := podspec.Decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	var images []string
+	for _, o := range objs {
+		if !o.HasPodSpec() {
+			continue
+		}
+		for _, c := range o.Containers() {
+			if image, ok := c["image"].(string); ok && len(image) > 0 {
+				images = append(images, image)
+			}
+		}
+	}
+	return images, nil
+}
+
+// PrePull will pull all the (unique) images in order, an error is returned listing any images which couldn't be pulled
+// Pulling carries on after a failure so as many images as possible are present before they're needed
+func PrePull(p Puller, images []string) error {
+	var failed []string
+	seen := map[string]bool{}
+	for _, image := range images {
+		if seen[image] {
+			continue
+		}
+		seen[image] = true
+		logger.Printf("Pulling image %s", image)
+		started := time.Now()
+		err := p.Pull(image)
+		profile.Record("pull image", time.Since(started), 0)
+		if err != nil {
+			logger.Warnf("Failed to pull image %s: %v", image, err)
+			failed = append(failed, image)
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("failed to pull images: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package images
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+)
+
+type fakePuller struct {
+	pulled []string
+	fail   map[string]bool
+}
+
+func (f *fakePuller) Pull(image string) error {
+	f.pulled = append(f.pulled, image)
+	if f.fail[image] {
+		return fmt.Errorf("pull failed")
+	}
+	return nil
+}
+
+func TestControlPlane(t *testing.T) {
+	images, err := ControlPlane("v1.7.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"gcr.io/google_containers/kube-apiserver-amd64:v1.7.0",
+		"gcr.io/google_containers/kube-controller-manager-amd64:v1.7.0",
+		"gcr.io/google_containers/kube-scheduler-amd64:v1.7.0",
+		"gcr.io/google_containers/kube-proxy-amd64:v1.7.0",
+		"gcr.io/google_containers/k8s-dns-kube-dns-amd64:1.14.4",
+		"gcr.io/google_containers/k8s-dns-dnsmasq-nanny-amd64:1.14.4",
+		"gcr.io/google_containers/k8s-dns-sidecar-amd64:1.14.4",
+		"gcr.io/google_containers/pause-amd64:3.0",
+	}
+	if !reflect.DeepEqual(images, expected) {
+		t.Errorf("expected %v but got %v", expected, images)
+	}
+
+	if images, err = ControlPlane("1.10.2"); err != nil {
+		t.Fatal(err)
+	}
+	if images[0] != "gcr.io/google_containers/kube-apiserver-amd64:v1.10.2" ||
+		images[4] != "gcr.io/google_containers/k8s-dns-kube-dns-amd64:1.14.8" ||
+		images[7] != "gcr.io/google_containers/pause-amd64:3.1" {
+		t.Errorf("unexpected images for v1.10 %v", images)
+	}
+
+	if _, err = ControlPlane("latest"); err == nil {
+		t.Error("expected an error for an invalid version")
+	}
+}
+
+func TestFromManifests(t *testing.T) {
+	doc := `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: flannel
+---
+apiVersion: extensions/v1beta1
+kind: DaemonSet
+metadata:
+  name: kube-flannel-ds
+spec:
+  template:
+    spec:
+      containers:
+      - name: kube-flannel
+        image: quay.io/coreos/flannel:v0.7.1-amd64
+      - name: install-cni
+        image: quay.io/coreos/flannel:v0.7.1-amd64
+`
+	images, err := FromManifests(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"quay.io/coreos/flannel:v0.7.1-amd64", "quay.io/coreos/flannel:v0.7.1-amd64"}
+	if !reflect.DeepEqual(images, expected) {
+		t.Errorf("expected %v but got %v", expected, images)
+	}
+}
+
+func TestPrePull(t *testing.T) {
+	p := &fakePuller{fail: map[string]bool{"b": true}}
+	err := PrePull(p, []string{"a", "b", "a", "c"})
+	if err == nil || err.Error() != "failed to pull images: b" {
+		t.Errorf("expected the failed image to be reported but got %v", err)
+	}
+	if !reflect.DeepEqual(p.pulled, []string{"a", "b", "c"}) {
+		t.Errorf("expected each image to be pulled once (after failures) but pulled %v", p.pulled)
+	}
+}
+
+func TestNewPuller(t *testing.T) {
+	p, err := NewPuller(Docker, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, ok := p.(*DockerPuller); !ok || d.Socket != "/var/run/docker.sock" {
+		t.Errorf("expected a docker puller on the default socket but got %#v", p)
+	}
+	if p, err = NewPuller(None, ""); err != nil || p != nil {
+		t.Errorf("expected no puller but got %v, %v", p, err)
+	}
+	if _, err = NewPuller("rkt", ""); err == nil {
+		t.Error("expected an error for an unknown runtime")
+	}
+}
+
+func TestDockerPuller(t *testing.T) {
+	dir, err := ioutil.TempDir("", "images")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pulled []string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/images/create" {
+			http.NotFound(w, r)
+			return
+		}
+		image := r.URL.Query().Get("fromImage") + ":" + r.URL.Query().Get("tag")
+		pulled = append(pulled, image)
+		fmt.Fprintln(w, `{"status":"Pulling from `+image+`"}`)
+		if image == "missing:v1" {
+			fmt.Fprintln(w, `{"error":"manifest for missing:v1 not found"}`)
+		}
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	d := &DockerPuller{Socket: socket}
+	if err = d.Pull("registry:5000/name:v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Pull("name"); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Pull("missing:v1"); err == nil || err.Error() != "manifest for missing:v1 not found" {
+		t.Errorf("expected the error from the progress stream but got %v", err)
+	}
+	expected := []string{"registry:5000/name:v1", "name:latest", "missing:v1"}
+	if !reflect.DeepEqual(pulled, expected) {
+		t.Errorf("expected %v to be pulled but got %v", expected, pulled)
+	}
+}
+
+// fakeResolver resolves the digests of the images pulled
+type fakeResolver struct {
+	fakePuller
+	digests map[string]string
+}
+
+func (f *fakeResolver) Digest(image string) (string, error) {
+	if digest, ok := f.digests[image]; ok {
+		return digest, nil
+	}
+	return "", fmt.Errorf("image %s not pulled", image)
+}
+
+func TestResolveAndPin(t *testing.T) {
+	apiserver := "gcr.io/google_containers/kube-apiserver-amd64:v1.10.2"
+	flannel := "quay.io/coreos/flannel:v0.7.1-amd64"
+	digest := fmt.Sprintf("sha256:%064x", 1)
+	r := &fakeResolver{digests: map[string]string{apiserver: digest, flannel: digest}}
+	digests, err := Resolve(r, []string{apiserver, flannel, flannel, "weave@" + digest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(digests, map[string]string{apiserver: digest, flannel: digest}) {
+		t.Errorf("unexpected digests %v", digests)
+	}
+	if err = ValidateDigests(digests); err != nil {
+		t.Error(err)
+	}
+	if _, err = Resolve(r, []string{"missing:v1"}); err == nil {
+		t.Error("expected an error resolving an image not pulled")
+	}
+	if _, err = Resolve(&fakePuller{}, []string{apiserver}); err == nil {
+		t.Error("expected an error resolving with a puller which can't")
+	}
+
+	if pinned := Pin(apiserver, digests); pinned != "gcr.io/google_containers/kube-apiserver-amd64@"+digest {
+		t.Errorf("unexpected pinned image %s", pinned)
+	}
+	if pinned := Pin("other:v1", digests); pinned != "other:v1" {
+		t.Errorf("expected an image without a digest to be unchanged but got %s", pinned)
+	}
+	doc, err := podspec.Transform(`
+apiVersion: extensions/v1beta1
+kind: DaemonSet
+metadata:
+  name: kube-flannel-ds
+spec:
+  template:
+    spec:
+      containers:
+      - name: kube-flannel
+        image: quay.io/coreos/flannel:v0.7.1-amd64
+      - name: other
+        image: other:v1
+`, PinMutator(digests))
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := FromManifests(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(list, []string{"quay.io/coreos/flannel@" + digest, "other:v1"}) {
+		t.Errorf("expected the flannel image to be pinned but got %v", list)
+	}
+
+	for digests, valid := range map[string]bool{
+		`{"name:v1": "` + digest + `"}`:             true,
+		`{"name:v1": "sha256:abc"}`:                 false,
+		`{"name@` + digest + `": "` + digest + `"}`: false,
+	} {
+		m := map[string]string{}
+		if err = json.Unmarshal([]byte(digests), &m); err != nil {
+			t.Fatal(err)
+		}
+		if err = ValidateDigests(m); (err == nil) != valid {
+			t.Errorf("expected %s valid %v but got %v", digests, valid, err)
+		}
+	}
+}
+
+func TestPinPatch(t *testing.T) {
+	digest := fmt.Sprintf("sha256:%064x", 1)
+	o := podspec.Object{
+		"kind": "Deployment",
+		"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{"name": "kubedns", "image": "k8s-dns-kube-dns-amd64:1.14.8"},
+				map[string]interface{}{"name": "sidecar", "image": "k8s-dns-sidecar-amd64:1.14.8"},
+			},
+		}}},
+	}
+	patch, err := PinPatch(o, map[string]string{"k8s-dns-kube-dns-amd64:1.14.8": digest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"spec":{"template":{"spec":{"containers":[{"image":"k8s-dns-kube-dns-amd64@` + digest + `","name":"kubedns"}]}}}}`
+	if patch != expected {
+		t.Errorf("expected %s but got %s", expected, patch)
+	}
+	if patch, err = PinPatch(o, nil); err != nil || len(patch) > 0 {
+		t.Errorf("expected no patch without digests but got %q [%v]", patch, err)
+	}
+}
+
+func TestDockerDigest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "images")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := fmt.Sprintf("sha256:%064x", 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/images/registry:5000/name:v1/json":
+			fmt.Fprintf(w, `{"RepoDigests":["mirror/name@sha256:%064x","registry:5000/name@%s"]}`, 2, digest)
+		case "/images/weaveworks/weave-kube:1.9.5/json":
+			fmt.Fprintf(w, `{"RepoDigests":["docker.io/weaveworks/weave-kube@%s"]}`, digest)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	d := &DockerPuller{Socket: socket}
+	for _, image := range []string{"registry:5000/name:v1", "weaveworks/weave-kube:1.9.5"} {
+		if resolved, err := d.Digest(image); err != nil || resolved != digest {
+			t.Errorf("expected the digest of %s but got %q [%v]", image, resolved, err)
+		}
+	}
+	if _, err = d.Digest("missing:v1"); err == nil {
+		t.Error("expected an error for an image not pulled")
+	}
+}
@@ -1,15 +1,21 @@
 package k8client
 
 import (
-	"os/exec"
+	"encoding/json"
 	"strings"
 	"fmt"
-	log "github.com/Sirupsen/logrus"
 
+	"github.com/UKHomeOffice/keto-k8/pkg/command"
+	"github.com/UKHomeOffice/keto-k8/pkg/logging"
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+	"github.com/UKHomeOffice/keto-k8/pkg/tracing"
 )
 
 const cmdKubectl string = "kubectl"
 
+// logger is used for all the k8client logs
+var logger = logging.New("k8client")
+
 // Apply - Will take a yaml string and deploy it to the API...
 // TODO: Use API, remove kubectl (add parse yaml and use appropriate type - maybe?)
 func Apply(resource string) (error) {
@@ -21,20 +27,115 @@ func Apply(resource string) (error) {
 
 	output, err :=	runKubectl(args, resource)
 	if err != nil {
-		return fmt.Errorf("Error running kubectl:%s", output)
+		return fmt.Errorf("Error running kubectl [%v]:%s", err, output)
+	}
+	return nil
+}
+
+// Create - Will take a yaml (or json) string and create it (for resources never updated e.g. events)
+func Create(resource string) (error) {
+	var args = []string {
+		"create",
+		"-f",
+		"-",
+	}
+
+	output, err := runKubectl(args, resource)
+	if err != nil {
+		return fmt.Errorf("Error running kubectl [%v]:%s", err, output)
+	}
+	return nil
+}
+
+// Patch - Will apply a patch to an existing resource
+func Patch(kind, name, namespace, patch string) (error) {
+	var args = []string {
+		"patch",
+		kind,
+		name,
+		"--namespace",
+		namespace,
+		"--patch",
+		patch,
+	}
+
+	output, err := runKubectl(args, "")
+	if err != nil {
+		return fmt.Errorf("Error running kubectl [%v]:%s", err, output)
 	}
 	return nil
 }
 
+// List - Will return all resources of the kinds specified matching a label selector (in all namespaces)
+func List(kinds []string, selector string) ([]podspec.Object, error) {
+	var args = []string {
+		"get",
+		strings.Join(kinds, ","),
+		"--all-namespaces",
+		"--selector",
+		selector,
+		"--output",
+		"json",
+	}
+
+	// The resources are returned on stdout so aren't logged
+	output, err := runKubectlOutput(args)
+	if err != nil {
+		return nil, fmt.Errorf("Error running kubectl:%v", err)
+	}
+	list := struct {
+		Items []podspec.Object `json:"items"`
+	}{}
+	if err = json.Unmarshal([]byte(output), &list); err != nil {
+		return nil, fmt.Errorf("Error parsing kubectl output [%v]:%s", err, output)
+	}
+	return list.Items, nil
+}
+
+// Delete - Will delete a resource (if it exists)
+func Delete(kind, name, namespace string) (error) {
+	var args = []string {
+		"delete",
+		kind,
+		name,
+		"--ignore-not-found",
+	}
+	if len(namespace) > 0 {
+		args = append(args, "--namespace", namespace)
+	}
+
+	output, err := runKubectl(args, "")
+	if err != nil {
+		return fmt.Errorf("Error running kubectl [%v]:%s", err, output)
+	}
+	return nil
+}
+
+// ApproveCSR - Will approve a certificate signing request (for requests the controller-manager doesn't approve itself)
+func ApproveCSR(name string) error {
+	output, err := runKubectl([]string{"certificate", "approve", name}, "")
+	if err != nil {
+		return fmt.Errorf("Error running kubectl [%v]:%s", err, output)
+	}
+	return nil
+}
+
+// runKubectl will run kubectl streaming all output to the logs
 func runKubectl(cmdArgs []string, stdIn string) (out string, err error) {
-	var cmdOut []byte
+	cmdName := cmdKubectl
+	logger.Printf("Running:%v %v", cmdName, strings.Join(cmdArgs, " "))
+	span := tracing.Start(cmdName + " " + cmdArgs[0])
+	span.SetTag("args", strings.Join(cmdArgs, " "))
+	defer func() { tracing.End(span, err) }()
+	return command.Run(logger, stdIn, cmdName, cmdArgs...)
+}
 
+// runKubectlOutput will run kubectl returning stdout (only stderr is logged)
+func runKubectlOutput(cmdArgs []string) (out string, err error) {
 	cmdName := cmdKubectl
-	log.Printf("Running:%v %v", cmdName, strings.Join(cmdArgs, " "))
-	cmd := exec.Command(cmdName, cmdArgs...)
-	cmd.Stdin = strings.NewReader(stdIn)
-	if cmdOut, err = cmd.CombinedOutput(); err != nil {
-		return string(cmdOut[:]), err
-	}
-	return string(cmdOut[:]), nil
+	logger.Printf("Running:%v %v", cmdName, strings.Join(cmdArgs, " "))
+	span := tracing.Start(cmdName + " " + cmdArgs[0])
+	span.SetTag("args", strings.Join(cmdArgs, " "))
+	defer func() { tracing.End(span, err) }()
+	return command.Output(logger, "", cmdName, cmdArgs...)
 }
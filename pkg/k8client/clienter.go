@@ -0,0 +1,48 @@
+package k8client
+
+import (
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+)
+
+// Clienter allows for mocking out this lib for testing (or using another applier e.g. client-go)
+type Clienter interface {
+	Apply(resource string) error
+	Create(resource string) error
+	Patch(kind, name, namespace, patch string) error
+	List(kinds []string, selector string) ([]podspec.Object, error)
+	Delete(kind, name, namespace string) error
+}
+
+// kubectlClient is the Clienter using kubectl (the package functions)
+type kubectlClient struct{}
+
+// Kubectl is the default Clienter
+var Kubectl Clienter = &kubectlClient{}
+
+// Or returns the client unless nil when the default is returned
+func Or(client Clienter) Clienter {
+	if client == nil {
+		return Kubectl
+	}
+	return client
+}
+
+func (c *kubectlClient) Apply(resource string) error {
+	return Apply(resource)
+}
+
+func (c *kubectlClient) Create(resource string) error {
+	return Create(resource)
+}
+
+func (c *kubectlClient) Patch(kind, name, namespace, patch string) error {
+	return Patch(kind, name, namespace, patch)
+}
+
+func (c *kubectlClient) List(kinds []string, selector string) ([]podspec.Object, error) {
+	return List(kinds, selector)
+}
+
+func (c *kubectlClient) Delete(kind, name, namespace string) error {
+	return Delete(kind, name, namespace)
+}
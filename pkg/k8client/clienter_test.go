@@ -0,0 +1,17 @@
+package k8client
+
+//go:generate mockery -dir $GOPATH/src/github.com/UKHomeOffice/keto-k8/pkg/k8client -name=Clienter
+
+import (
+	"testing"
+)
+
+func TestOr(t *testing.T) {
+	if Or(nil) != Kubectl {
+		t.Error("expected the kubectl client by default")
+	}
+	client := &kubectlClient{}
+	if Or(client) != client {
+		t.Error("expected the client specified")
+	}
+}
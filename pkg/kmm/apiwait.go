@@ -0,0 +1,125 @@
+package kmm
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/failure"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm"
+	kubeadmconstants "github.com/UKHomeOffice/keto-k8/pkg/kubeadm/constants"
+)
+
+// APIWaitTimeout is how long a compute node waits for the api server before starting the kubelet (0 to not wait)
+var APIWaitTimeout = 5 * time.Minute
+
+// LocalAPIWaitTimeout is how long the primary master waits for its local api server (and etcd through it) after
+// starting the kubelet, before deploying the addons and sharing the assets (0 to not wait)
+var LocalAPIWaitTimeout = 5 * time.Minute
+
+// apiWaitInterval is how often the api server health is checked (replaced in tests)
+var apiWaitInterval = 5 * time.Second
+
+// waitForAPIServer will wait until the api server /healthz responds (through the load balancer) or the timeout
+func (k *ConfigType) waitForAPIServer() error {
+	if APIWaitTimeout <= 0 || k.KubeadmCfg.APIServer == nil {
+		return nil
+	}
+	if err := waitForHealthz(k.KubeadmCfg.APIServer.String()+"/healthz", apiTLSConfig(), APIWaitTimeout); err != nil {
+		return failure.Wrap(err, fmt.Sprintf("the api server wasn't available after %v", APIWaitTimeout),
+			"check the load balancer health checks and the kube-apiserver logs on the masters")
+	}
+	logger.Printf("The api server %s is available", k.KubeadmCfg.APIServer)
+	return nil
+}
+
+// waitForLocalAPIServer will wait until the local api server /healthz responds and it can read from etcd, so nothing
+// races the api server static pod starting
+func (k *ConfigType) waitForLocalAPIServer() error {
+	if LocalAPIWaitTimeout <= 0 || k.KubeadmCfg == nil || k.KubeadmCfg.APIServer == nil {
+		return nil
+	}
+	started := time.Now()
+	local, tlsConfig := k.localAPIServer()
+	if err := waitForHealthz(local+"/healthz", tlsConfig, LocalAPIWaitTimeout); err != nil {
+		return failure.Wrap(err, fmt.Sprintf("the local api server wasn't healthy after %v", LocalAPIWaitTimeout),
+			"check the kube-apiserver static pod is running and its logs, and the kubelet logs")
+	}
+	// The apiserver kubelet client is in the masters group, anonymous requests can't read anything
+	cert, err := tls.LoadX509KeyPair(
+		path.Join(kubeadm.PkiDir, kubeadmconstants.APIServerKubeletClientCertName),
+		path.Join(kubeadm.PkiDir, kubeadmconstants.APIServerKubeletClientKeyName))
+	if err != nil {
+		logger.Warnf("Not checking the local api server can reach etcd, no client cert: %v", err)
+		return nil
+	}
+	tlsConfig.Certificates = []tls.Certificate{cert}
+	// Reading a namespace goes through to etcd (not every api server version has a /healthz/etcd check)
+	if err = waitForResponse(local+"/api/v1/namespaces/kube-system", tlsConfig, LocalAPIWaitTimeout-time.Since(started),
+		http.StatusOK); err != nil {
+		return failure.Wrap(err, fmt.Sprintf("the local api server couldn't read from etcd after %v", LocalAPIWaitTimeout),
+			"check etcd is healthy and the kube-apiserver --etcd-servers and etcd client certs")
+	}
+	logger.Printf("The local api server is healthy and connected to etcd")
+	return nil
+}
+
+// localAPIServer returns the url of the api server on this master and the TLS config to check it
+func (k *ConfigType) localAPIServer() (string, *tls.Config) {
+	port := k.KubeadmCfg.APIServer.Port()
+	if len(port) == 0 {
+		port = "443"
+	}
+	// The api server cert is for the load balancer name, not localhost
+	tlsConfig := apiTLSConfig()
+	tlsConfig.ServerName = k.KubeadmCfg.APIServer.Hostname()
+	return "https://127.0.0.1:" + port, tlsConfig
+}
+
+// waitForHealthz will wait until an api server /healthz responds or the timeout
+// An unauthorized or forbidden response is available (anonymous requests are disabled by some hardening profiles)
+func waitForHealthz(url string, tlsConfig *tls.Config, timeout time.Duration) error {
+	return waitForResponse(url, tlsConfig, timeout, http.StatusOK, http.StatusUnauthorized, http.StatusForbidden)
+}
+
+// waitForResponse will wait until an api server url responds with one of the statuses or the timeout
+func waitForResponse(url string, tlsConfig *tls.Config, timeout time.Duration, statuses ...int) error {
+	client := &http.Client{
+		Timeout:   apiWaitInterval,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			for _, status := range statuses {
+				if resp.StatusCode == status {
+					return nil
+				}
+			}
+			err = fmt.Errorf("%s returned %s", url, resp.Status)
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		logger.Printf("Waiting for the api server: %v", err)
+		time.Sleep(apiWaitInterval)
+	}
+}
+
+// apiTLSConfig trusts the kube CA when it's on the node, otherwise the api server cert isn't verified (the health
+// check is only to know the api server is available, nothing is sent to it)
+func apiTLSConfig() *tls.Config {
+	ca, err := ioutil.ReadFile(kubeadm.CaCertFile)
+	if err != nil {
+		return &tls.Config{InsecureSkipVerify: true}
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+	return &tls.Config{RootCAs: pool}
+}
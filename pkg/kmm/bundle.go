@@ -0,0 +1,177 @@
+package kmm
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/backup"
+	"github.com/UKHomeOffice/keto-k8/pkg/bundle"
+	"github.com/UKHomeOffice/keto-k8/pkg/etcd"
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+	"github.com/UKHomeOffice/keto-k8/pkg/version"
+)
+
+// BundleFiles are where the persistent CA files are kept (the etcd CA is optional)
+type BundleFiles struct {
+	KubeCaCert string
+	KubeCaKey  string
+	EtcdCaCert string
+	EtcdCaKey  string
+}
+
+// bundleFile is a persistent file and its name in a bundle
+type bundleFile struct {
+	name     string
+	path     string
+	mode     os.FileMode
+	required bool
+}
+
+// list returns the files which can be in a bundle
+func (f BundleFiles) list() []bundleFile {
+	return []bundleFile{
+		{name: bundle.KubeCaCert, path: f.KubeCaCert, mode: 0644, required: true},
+		{name: bundle.KubeCaKey, path: f.KubeCaKey, mode: 0600, required: true},
+		{name: bundle.EtcdCaCert, path: f.EtcdCaCert, mode: 0644},
+		{name: bundle.EtcdCaKey, path: f.EtcdCaKey, mode: 0600},
+	}
+}
+
+// ExportBundle returns a bundle of the persistent CAs, the shared assets (once created) and the cluster metadata
+// The kube version and masters are taken from the member heartbeats when not set
+func ExportBundle(files BundleFiles, client etcd.Clienter, metadata bundle.Metadata) (*bundle.Bundle, error) {
+	b := &bundle.Bundle{Metadata: metadata, Files: map[string][]byte{}}
+	for _, f := range files.list() {
+		if len(f.path) == 0 {
+			if f.required {
+				return nil, fmt.Errorf("the %s file must be specified", f.name)
+			}
+			continue
+		}
+		data, err := ioutil.ReadFile(f.path)
+		if err != nil {
+			return nil, err
+		}
+		b.Files[f.name] = data
+	}
+	if err := validateBundleCAs(b); err != nil {
+		return nil, err
+	}
+
+	assets, err := client.Get(assetKey)
+	if err == nil {
+		b.Files[bundle.Assets] = []byte(assets)
+	} else if err != etcd.ErrKeyMissing {
+		return nil, err
+	} else {
+		logger.Warnf("No shared assets in etcd yet, only exporting the CAs")
+	}
+
+	members, err := ListMembers(client)
+	if err != nil {
+		logger.Warnf("Not adding the members to the bundle metadata: %v", err)
+	}
+	for _, m := range members {
+		if m.Role != "master" {
+			continue
+		}
+		b.Metadata.Masters = append(b.Metadata.Masters, m.Node)
+		if len(b.Metadata.KubeVersion) == 0 {
+			b.Metadata.KubeVersion = m.KubeVersion
+		}
+	}
+	b.Metadata.KetoK8Version = version.Get().Version
+	b.Metadata.Created = time.Now().UTC()
+	return b, nil
+}
+
+// ImportBundle will save the CAs of a bundle to the persistent files and share its assets in etcd
+// Nothing is changed when any existing file or the shared assets are different unless forced (files are backed up)
+func ImportBundle(b *bundle.Bundle, files BundleFiles, client etcd.Clienter, force bool) error {
+	if err := validateBundleCAs(b); err != nil {
+		return err
+	}
+	var writes []bundleFile
+	for _, f := range files.list() {
+		data, ok := b.Files[f.name]
+		if !ok {
+			if f.required {
+				return fmt.Errorf("the bundle has no %s", f.name)
+			}
+			continue
+		}
+		if len(f.path) == 0 {
+			if f.required {
+				return fmt.Errorf("the %s file must be specified", f.name)
+			}
+			logger.Warnf("Not importing %s (no file specified)", f.name)
+			continue
+		}
+		current, err := ioutil.ReadFile(f.path)
+		if os.IsNotExist(err) {
+			writes = append(writes, f)
+			continue
+		} else if err != nil {
+			return err
+		}
+		if bytes.Equal(current, data) {
+			continue
+		}
+		if !force {
+			return fmt.Errorf("%s already exists and is different to the bundle %s (use --force to replace it)", f.path, f.name)
+		}
+		writes = append(writes, f)
+	}
+
+	assets, hasAssets := b.Files[bundle.Assets]
+	current, err := client.Get(assetKey)
+	if err != nil && err != etcd.ErrKeyMissing {
+		return err
+	}
+	missing := err == etcd.ErrKeyMissing
+	if hasAssets && !missing && current != string(assets) && !force {
+		return fmt.Errorf("the shared assets in etcd are different to the bundle (use --force to replace them)")
+	}
+
+	for _, f := range writes {
+		if err = backup.Save(f.path); err != nil {
+			return err
+		}
+		if err = fileutil.WriteFile(f.path, b.Files[f.name], f.mode); err != nil {
+			return err
+		}
+		logger.Printf("Imported %s to %s", f.name, f.path)
+	}
+	if !hasAssets || (!missing && current == string(assets)) {
+		return nil
+	}
+	if missing {
+		err = client.PutTx(assetKey, string(assets))
+	} else {
+		err = client.Put(assetKey, string(assets))
+	}
+	if err != nil {
+		return err
+	}
+	logger.Printf("Imported the shared assets to etcd")
+	return nil
+}
+
+// validateBundleCAs will check each CA cert and key in a bundle are a pair
+func validateBundleCAs(b *bundle.Bundle) error {
+	for _, pair := range [][2]string{{bundle.KubeCaCert, bundle.KubeCaKey}, {bundle.EtcdCaCert, bundle.EtcdCaKey}} {
+		cert, hasCert := b.Files[pair[0]]
+		key, hasKey := b.Files[pair[1]]
+		if !hasCert && !hasKey {
+			continue
+		}
+		if _, err := tls.X509KeyPair(cert, key); err != nil {
+			return fmt.Errorf("%s and %s aren't a valid cert and key [%v]", pair[0], pair[1], err)
+		}
+	}
+	return nil
+}
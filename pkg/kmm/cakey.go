@@ -0,0 +1,82 @@
+package kmm
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm"
+)
+
+// caKeyMode returns how the CA key is made available to kubeadm
+func (k *ConfigType) caKeyMode() string {
+	if k.KubeadmCfg == nil || len(k.KubeadmCfg.CaKeyMode) == 0 {
+		return kubeadm.CaKeySymlink
+	}
+	return k.KubeadmCfg.CaKeyMode
+}
+
+// installCaKey will link or copy the persistent CA key to where kubeadm expects it (depending on the CA key mode)
+func (k *ConfigType) installCaKey() error {
+	mode := k.caKeyMode()
+	switch mode {
+	case kubeadm.CaKeySymlink:
+		if err := backupCa(k.KubePersistentCaKey, kubeadm.CaKeyFile); err != nil {
+			return err
+		}
+		// A copy of the same key (e.g. from the copy mode) is replaced by the link
+		if err := removeCopy(k.KubePersistentCaKey, kubeadm.CaKeyFile); err != nil {
+			return err
+		}
+		return fileutil.SymlinkFile(k.KubePersistentCaKey, kubeadm.CaKeyFile)
+	case kubeadm.CaKeyCopy, kubeadm.CaKeyEphemeral:
+		// An ephemeral key is never backed up (it mustn't be left on disk)
+		if mode == kubeadm.CaKeyCopy {
+			if err := backupCa(k.KubePersistentCaKey, kubeadm.CaKeyFile); err != nil {
+				return err
+			}
+		}
+		key, err := ioutil.ReadFile(k.KubePersistentCaKey)
+		if err != nil {
+			return err
+		}
+		return fileutil.WriteFile(kubeadm.CaKeyFile, key, 0600)
+	}
+	return kubeadm.ValidateCaKeyMode(mode)
+}
+
+// removeEphemeralCaKey will securely remove the CA key once the master certs are signed (ephemeral mode only)
+func (k *ConfigType) removeEphemeralCaKey() error {
+	if k.caKeyMode() != kubeadm.CaKeyEphemeral || !fileutil.ExistFile(kubeadm.CaKeyFile) {
+		return nil
+	}
+	logger.Printf("Removing the ephemeral CA key %s", kubeadm.CaKeyFile)
+	if err := fileutil.ShredFile(kubeadm.CaKeyFile); err != nil {
+		return fmt.Errorf("failed to remove the CA key %s [%v]", kubeadm.CaKeyFile, err)
+	}
+	return nil
+}
+
+// removeCopy will remove a regular file which is a copy of the persistent file
+func removeCopy(persistent, file string) error {
+	info, err := os.Lstat(file)
+	if os.IsNotExist(err) || (err == nil && !info.Mode().IsRegular()) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	current, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	expected, err := ioutil.ReadFile(persistent)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(current, expected) {
+		return nil
+	}
+	return os.Remove(file)
+}
@@ -0,0 +1,332 @@
+package kmm
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/backup"
+	certutil "github.com/UKHomeOffice/keto-k8/pkg/client-go/util/cert"
+	"github.com/UKHomeOffice/keto-k8/pkg/etcd"
+	"github.com/UKHomeOffice/keto-k8/pkg/failure"
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm/pkiutil"
+)
+
+// CaRotationKey is the etcd key of the kube CA rotation in progress
+const CaRotationKey = "kmm-ca-rotation"
+
+// CaRotationNodePrefix is the etcd key prefix for the rotation phase each master has applied
+const CaRotationNodePrefix = "kmm-ca-rotation-nodes/"
+
+// RotatingCaKeySuffix is added to the persistent CA key path for where the new CA key is delivered to each master
+// The new CA key is never shared through etcd, only the cert
+const RotatingCaKeySuffix = ".new"
+
+// The CA rotation phases (in order), each one is applied by the masters when kmm is restarted:
+// trust - the new CA is trusted alongside the old CA (which still signs the certs)
+// sign - the new CA signs the master certs (the old CA is still trusted)
+// complete - the new CA replaces the old CA in the persistent files (only the new CA is trusted)
+const (
+	CaRotationTrust    = "trust"
+	CaRotationSign     = "sign"
+	CaRotationComplete = "complete"
+)
+
+var caRotationPhases = []string{CaRotationTrust, CaRotationSign, CaRotationComplete}
+
+// CaRotation is the new kube CA cert shared by the masters and the rotation phase they should apply
+type CaRotation struct {
+	Phase   string    `json:"phase"`
+	CaCert  string    `json:"caCert"`
+	Updated time.Time `json:"updated"`
+}
+
+// GetCaRotation returns the CA rotation in progress (nil when there isn't one)
+func GetCaRotation(client etcd.Clienter) (*CaRotation, error) {
+	value, err := client.Get(CaRotationKey)
+	if err == etcd.ErrKeyMissing {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	r := &CaRotation{}
+	if err = json.Unmarshal([]byte(value), r); err != nil {
+		return nil, fmt.Errorf("invalid CA rotation in etcd [%v]", err)
+	}
+	return r, nil
+}
+
+// StartCaRotation will share a new kube CA cert for the masters to trust (once no other rotation is in progress)
+// The key is only checked against the cert, it must be copied to RotatingCaKeyFile on each master before the sign phase
+func StartCaRotation(client etcd.Clienter, certFile, keyFile string) error {
+	if err := kubeadm.ValidateCaFiles(certFile, keyFile); err != nil {
+		return err
+	}
+	cert, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(CaRotation{
+		Phase:   CaRotationTrust,
+		CaCert:  string(cert),
+		Updated: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	if err = client.PutTx(CaRotationKey, string(value)); err == etcd.ErrKeyAlreadyExists {
+		return fmt.Errorf("a CA rotation is already in progress")
+	}
+	return err
+}
+
+// CaRotationNodes returns the rotation phase applied by each master
+func CaRotationNodes(client etcd.Clienter) (map[string]string, error) {
+	return rotationNodes(client, CaRotationNodePrefix)
+}
+
+// PendingCaRotation returns the masters which haven't applied the current rotation phase and bootstrapped since
+func PendingCaRotation(client etcd.Clienter, r *CaRotation) ([]string, error) {
+	return pendingRotation(client, CaRotationNodePrefix, r.Phase)
+}
+
+// AdvanceCaRotation will move the CA rotation to its next phase once every master has applied the current phase
+// (unless forced), the rotation is removed after the complete phase. The new phase is returned.
+func AdvanceCaRotation(client etcd.Clienter, force bool) (string, error) {
+	r, err := GetCaRotation(client)
+	if err != nil {
+		return "", err
+	}
+	if r == nil {
+		return "", fmt.Errorf("no CA rotation is in progress")
+	}
+	if !force {
+		pending, err := PendingCaRotation(client, r)
+		if err != nil {
+			return "", err
+		}
+		if len(pending) > 0 {
+			return "", fmt.Errorf("the masters %s haven't applied the %s phase yet (restart kmm on them)",
+				strings.Join(pending, ", "), r.Phase)
+		}
+	}
+	if r.Phase == CaRotationComplete {
+		return "", finishRotation(client, CaRotationKey, CaRotationNodePrefix)
+	}
+	for i, phase := range caRotationPhases {
+		if phase == r.Phase {
+			r.Phase = caRotationPhases[i+1]
+			break
+		}
+	}
+	r.Updated = time.Now().UTC()
+	value, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	return r.Phase, client.Put(CaRotationKey, string(value))
+}
+
+// caRotation returns the CA rotation this master should apply (nil without one or an etcd client)
+func (k *ConfigType) caRotation() (*CaRotation, error) {
+	if k.Etcd == nil {
+		return nil, nil
+	}
+	r, err := GetCaRotation(k.Etcd)
+	if err != nil {
+		return nil, err
+	}
+	if r != nil {
+		logger.Printf("Applying the %s phase of the kube CA rotation", r.Phase)
+	}
+	return r, nil
+}
+
+// RotatingCaKeyFile returns where the new CA key is delivered to a master for a rotation (next to the persistent key)
+func RotatingCaKeyFile(persistentKey string) string {
+	return persistentKey + RotatingCaKeySuffix
+}
+
+// rotatingCaKey returns the new CA key delivered to this master, it must be the key of the shared new CA cert
+func (k *ConfigType) rotatingCaKey(r *CaRotation) ([]byte, error) {
+	file := RotatingCaKeyFile(k.KubePersistentCaKey)
+	key, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, failure.New("the new kube CA key isn't at "+file,
+			"copy the --new-ca-key the rotation was started with to "+file+" on each master")
+	} else if err != nil {
+		return nil, err
+	}
+	chain, err := certutil.ParseCertsPEM([]byte(r.CaCert))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA rotation cert in etcd [%v]", err)
+	}
+	parsed, err := certutil.ParsePrivateKeyPEM(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid new kube CA key %s [%v]", file, err)
+	}
+	rsaKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("the new kube CA key %s isn't an RSA key", file)
+	}
+	if err = pkiutil.ValidateCAChain(chain, rsaKey); err != nil {
+		return nil, failure.Wrap(err, "invalid new kube CA key "+file,
+			"check "+file+" is the --new-ca-key the rotation was started with")
+	}
+	return key, nil
+}
+
+// replacePersistentCa will replace the persistent CA files with the new CA (once the rotation is complete), the
+// delivered new key is removed once it's the persistent key
+func (k *ConfigType) replacePersistentCa(r *CaRotation) error {
+	if current, err := ioutil.ReadFile(k.KubePersistentCaCert); err == nil && string(current) == r.CaCert {
+		return fileutil.ShredFile(RotatingCaKeyFile(k.KubePersistentCaKey))
+	}
+	key, err := k.rotatingCaKey(r)
+	if err != nil {
+		return err
+	}
+	// The cert is replaced last so the key is replaced again should kmm stop in between
+	for _, f := range []struct {
+		file string
+		data []byte
+		mode os.FileMode
+	}{
+		{file: k.KubePersistentCaKey, data: key, mode: 0600},
+		{file: k.KubePersistentCaCert, data: []byte(r.CaCert), mode: 0644},
+	} {
+		current, err := ioutil.ReadFile(f.file)
+		if err == nil && bytes.Equal(current, f.data) {
+			continue
+		}
+		logger.Printf("Replacing the persistent kube CA file %s with the new CA", f.file)
+		if err = backup.WriteFile(f.file, f.data, f.mode); err != nil {
+			return err
+		}
+	}
+	return fileutil.ShredFile(RotatingCaKeyFile(k.KubePersistentCaKey))
+}
+
+// installRotatingCa will install the CA bundle (old and new CAs) and the signing key for the trust or sign phase
+// The first cert in the bundle is the CA which signs the master certs
+func (k *ConfigType) installRotatingCa(r *CaRotation) error {
+	persistent, err := ioutil.ReadFile(k.KubePersistentCaCert)
+	if err != nil {
+		return err
+	}
+	caBundle := joinPEM(persistent, []byte(r.CaCert))
+	if r.Phase == CaRotationSign {
+		caBundle = joinPEM([]byte(r.CaCert), persistent)
+	}
+	if err = backup.WriteFile(kubeadm.CaCertFile, caBundle, 0644); err != nil {
+		return err
+	}
+	if r.Phase == CaRotationTrust {
+		return k.installCaKey()
+	}
+	// The new key replaces any link to the persistent key (until the rotation is complete)
+	key, err := k.rotatingCaKey(r)
+	if err != nil {
+		return err
+	}
+	if err = backup.Replacing(kubeadm.CaKeyFile, key); err != nil {
+		return err
+	}
+	return fileutil.WriteFile(kubeadm.CaKeyFile, key, 0600)
+}
+
+// trustRotatingCa will add the new CA of a rotation in progress to the CA a compute node's kubelet trusts, so it
+// keeps verifying the api server once the masters are signed by the new CA
+func (k *ConfigType) trustRotatingCa() error {
+	if len(k.KubeadmCfg.EtcdClientConfig.Endpoints) == 0 {
+		return nil
+	}
+	r, err := k.caRotation()
+	if err != nil || r == nil {
+		return err
+	}
+	current, err := ioutil.ReadFile(kubeadm.CaCertFile)
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(current, bytes.TrimSpace([]byte(r.CaCert))) {
+		return nil
+	}
+	logger.Printf("Trusting the new kube CA alongside the current CA %s", kubeadm.CaCertFile)
+	return fileutil.WriteFile(kubeadm.CaCertFile, joinPEM(current, []byte(r.CaCert)), 0644)
+}
+
+// recordCaRotation will record the rotation phase this master has applied
+func (k *ConfigType) recordCaRotation(r *CaRotation) error {
+	if r == nil {
+		return nil
+	}
+	return k.Etcd.Put(CaRotationNodePrefix+k.nodeName(), r.Phase)
+}
+
+// rotationNodes returns the rotation phase applied by each master (recorded under the prefix)
+func rotationNodes(client etcd.Clienter, prefix string) (map[string]string, error) {
+	values, err := client.GetPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	nodes := map[string]string{}
+	for key, phase := range values {
+		nodes[strings.TrimPrefix(key, prefix)] = phase
+	}
+	return nodes, nil
+}
+
+// pendingRotation returns the masters which haven't applied a rotation phase and bootstrapped since
+func pendingRotation(client etcd.Clienter, prefix, phase string) ([]string, error) {
+	members, err := ListMembers(client)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := rotationNodes(client, prefix)
+	if err != nil {
+		return nil, err
+	}
+	pending := []string{}
+	for _, m := range members {
+		if m.Role != "master" {
+			continue
+		}
+		if nodes[m.Node] != phase || m.State != MemberReady {
+			pending = append(pending, m.Node)
+		}
+	}
+	sort.Strings(pending)
+	return pending, nil
+}
+
+// finishRotation will remove a rotation and the phases the masters applied
+func finishRotation(client etcd.Clienter, key, prefix string) error {
+	nodes, err := rotationNodes(client, prefix)
+	if err != nil {
+		return err
+	}
+	for node := range nodes {
+		if err = client.Delete(prefix + node); err != nil {
+			return err
+		}
+	}
+	return client.Delete(key)
+}
+
+// joinPEM returns the PEM data of both files (separated by a new line if the first doesn't end with one)
+func joinPEM(first, second []byte) []byte {
+	joined := append([]byte{}, first...)
+	if len(joined) > 0 && joined[len(joined)-1] != '\n' {
+		joined = append(joined, '\n')
+	}
+	return append(joined, second...)
+}
@@ -0,0 +1,77 @@
+package kmm
+
+import (
+	"io/ioutil"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/certmanager"
+	"github.com/UKHomeOffice/keto-k8/pkg/constants"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm"
+	kubeadmconstants "github.com/UKHomeOffice/keto-k8/pkg/kubeadm/constants"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm/pkiutil"
+)
+
+var (
+	// certManagerRetries is how many times the ClusterIssuer is applied while cert-manager's resources are registered
+	certManagerRetries = 12
+	// certManagerRetryInterval is how long to wait between applying the ClusterIssuer (replaced in tests)
+	certManagerRetryInterval = 5 * time.Second
+)
+
+// certManagerIssuer returns the CA ClusterIssuer resources for the cert-manager hand-off (empty when not configured)
+// The CA key must be on disk, so it's called before an ephemeral key is removed
+func (k *ConfigType) certManagerIssuer() (string, error) {
+	if k.CertManager == nil {
+		return "", nil
+	}
+	caCert, caKey, err := pkiutil.TryLoadCertAndKeyFromDisk(kubeadm.PkiDir, kubeadmconstants.CACertAndKeyBaseName)
+	if err != nil {
+		return "", err
+	}
+	bundle, err := ioutil.ReadFile(kubeadm.CaCertFile)
+	if err != nil {
+		return "", err
+	}
+	cert, key, err := k.CertManager.IssuerCA(caCert, caKey, bundle)
+	if err != nil {
+		return "", err
+	}
+	return k.CertManager.IssuerResources(cert, key)
+}
+
+// handOffToCertManager will create the CA ClusterIssuer (once the cert-manager addon is deployed) and annotate the
+// keto-k8 managed TLS secrets for migration, so ongoing certificate issuance moves to cert-manager
+func (k *ConfigType) handOffToCertManager(issuer string) (err error) {
+	if len(issuer) == 0 {
+		return nil
+	}
+	// The cert-manager resource definitions were only just created by the addon
+	for i := 0; i < certManagerRetries; i++ {
+		if err = k.K8Client.Apply(issuer); err == nil {
+			break
+		}
+		logger.Printf("Waiting for cert-manager to create the %s ClusterIssuer: %v", k.CertManager.IssuerName(), err)
+		time.Sleep(certManagerRetryInterval)
+	}
+	if err != nil {
+		return err
+	}
+	logger.Printf("Created the cert-manager ClusterIssuer %s", k.CertManager.IssuerName())
+	if k.CertManager.SkipMigration {
+		return nil
+	}
+	secrets, err := k.K8Client.List([]string{"secrets"}, constants.ManagedByLabel+"="+constants.ManagedByValue)
+	if err != nil {
+		return err
+	}
+	for _, s := range secrets {
+		if s["type"] != "kubernetes.io/tls" || s.Namespace() == certmanager.Namespace && s.Name() == k.CertManager.IssuerName() {
+			continue
+		}
+		if err = k.K8Client.Patch("secret", s.Name(), s.Namespace(), k.CertManager.MigrationPatch()); err != nil {
+			return err
+		}
+		logger.Printf("Annotated secret %s/%s for migration to cert-manager", s.Namespace(), s.Name())
+	}
+	return nil
+}
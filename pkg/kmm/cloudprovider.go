@@ -7,7 +7,7 @@ import (
 	"path/filepath"
 
 	dl "log"
-	log "github.com/Sirupsen/logrus"
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
 	"github.com/UKHomeOffice/keto/pkg/cloudprovider"
 )
 
@@ -58,13 +58,13 @@ func SaveCloudAssets(cloudprovider, etcdCa, etcdCaKey, kubeCa, kubeCaKey string)
 				}
 			}
 			// Only write a file if it didn't exist
-			err = ioutil.WriteFile(file.FileName, file.Value, file.Mode)
+			err = fileutil.WriteFile(file.FileName, file.Value, file.Mode)
 			if err != nil {
 				return fmt.Errorf("Cloud Asset [%q] could not saved [%v]", file.FileName, err)
 			}
-			log.Printf("Saved Cloud Asset [%q]", file.FileName)
+			logger.Printf("Saved Cloud Asset [%q]", file.FileName)
 		} else {
-			log.Printf("Cloud Asset [%q] exists already", file.FileName)
+			logger.Printf("Cloud Asset [%q] exists already", file.FileName)
 		}
 	}
 
@@ -80,7 +80,7 @@ func getNodeInterface(cloudName string) (node cloudprovider.Node, err error) {
 	var supported = false
 	node, supported = cloud.Node()
 	if supported {
-		log.Printf("Cloud Provider Initialized [%q]", cloud.ProviderName())
+		logger.Printf("Cloud Provider Initialized [%q]", cloud.ProviderName())
 	} else {
 		return nil, fmt.Errorf("Cloud Provider set [%q] but node interface not supported", cloud.ProviderName())
 	}
@@ -0,0 +1,86 @@
+package kmm
+
+import (
+	"github.com/UKHomeOffice/keto-k8/pkg/etcd"
+)
+
+// ClusterInfo is a cluster found under the clusters root in a shared etcd
+type ClusterInfo struct {
+	Name      string `json:"name"`
+	KeyPrefix string `json:"keyPrefix"`
+	// Assets is true once the primary master has shared the assets
+	Assets      bool   `json:"assets"`
+	Masters     int    `json:"masters"`
+	Computes    int    `json:"computes"`
+	KubeVersion string `json:"kubeVersion,omitempty"`
+}
+
+// ClustersResult is the machine readable list of clusters (--output json)
+type ClustersResult struct {
+	SchemaVersion string        `json:"schemaVersion"`
+	Clusters      []ClusterInfo `json:"clusters"`
+}
+
+// validateEtcdIsolation will check the etcd credentials can't read the keys of other clusters (when strict)
+func (k *ConfigType) validateEtcdIsolation() error {
+	if !k.EtcdStrictIsolation {
+		return nil
+	}
+	if err := k.KubeadmCfg.EtcdClientConfig.ValidateIsolation(); err != nil {
+		return err
+	}
+	logger.Printf("Verified the etcd credentials only have access to %s", k.KubeadmCfg.EtcdClientConfig.KeyPrefix)
+	return nil
+}
+
+// ListClusters returns the clusters with keys under a root (etcd.ClustersRoot when empty) with the members of each
+// The client config needs access to the whole root (e.g. root credentials), any key prefix is ignored
+func ListClusters(cfg etcd.Client, root string) ([]ClusterInfo, error) {
+	if len(root) == 0 {
+		root = etcd.ClustersRoot
+	}
+	cfg.KeyPrefix = ""
+	client := etcd.New(cfg)
+	defer client.Close()
+	names, err := client.ListChildren(root)
+	if err != nil {
+		return nil, err
+	}
+	clusters := []ClusterInfo{}
+	for _, name := range names {
+		cfg.KeyPrefix = etcd.ClusterKeyPrefix(root, name)
+		clusterClient := etcd.New(cfg)
+		info, err := clusterInfo(clusterClient, name, cfg.KeyPrefix)
+		clusterClient.Close()
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, info)
+	}
+	return clusters, nil
+}
+
+// clusterInfo returns the state of a cluster from its keys
+func clusterInfo(client etcd.Clienter, name, keyPrefix string) (ClusterInfo, error) {
+	info := ClusterInfo{Name: name, KeyPrefix: keyPrefix}
+	if _, err := client.Get(assetKey); err == nil {
+		info.Assets = true
+	} else if err != etcd.ErrKeyMissing {
+		return info, err
+	}
+	members, err := ListMembers(client)
+	if err != nil {
+		return info, err
+	}
+	for _, m := range members {
+		if m.Role == "master" {
+			info.Masters++
+			if len(info.KubeVersion) == 0 {
+				info.KubeVersion = m.KubeVersion
+			}
+		} else {
+			info.Computes++
+		}
+	}
+	return info, nil
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	log "github.com/Sirupsen/logrus"
+	"github.com/UKHomeOffice/keto-k8/pkg/kmm"
 	"github.com/spf13/cobra"
 )
 
@@ -11,16 +12,20 @@ var AddonsCmd = &cobra.Command{
 	Short: "Will deploy cluster resources",
 	Long:  "Will deploy / redeploy essential cluster resources",
 	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := getKmmConfig(cmd)
+		kmmCfg, err := getKmmConfig(cmd)
 		if err != nil {
 			log.Fatal(err)
 		}
+		cfg := kmm.New(kmmCfg)
 		if err = cfg.Kmm.UpdateCloudCfg(); err != nil {
 			log.Fatal(err)
 		}
 		if err = cfg.Kubeadm.Addons(); err != nil {
 			log.Fatal(err)
 		}
+		if err = cfg.Kmm.AddonsDeploy(); err != nil {
+			log.Fatal(err)
+		}
 	},
 }
 
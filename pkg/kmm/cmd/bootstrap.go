@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/UKHomeOffice/keto-k8/pkg/kmm"
+	"github.com/spf13/cobra"
+)
+
+// bootstrapCmd runs the master or compute bootstrap for the role of the node
+var bootstrapCmd = &cobra.Command{
+	Use:   "bootstrap",
+	Short: "Will bootstrap a master or compute node (the role detected from the cloud metadata)",
+	Long: "Will bootstrap a master or compute node, the role detected from the node labels (cloud tags or node data) " +
+		"so every node pool can share the same user-data. Takes both the master and setup-compute flags.",
+	Run: func(c *cobra.Command, args []string) {
+		bootstrap(c)
+	},
+}
+
+func bootstrap(c *cobra.Command) {
+	role := c.Flag("role").Value.String()
+	if role == "auto" {
+		kmm.RoleLabel = c.Flag("role-label").Value.String()
+		var err error
+		if role, err = kmm.DetectRole(c.Flag("cloud-provider").Value.String(), c.Flag("node-data-file").Value.String()); err != nil {
+			log.Fatal(err)
+		}
+	}
+	switch role {
+	case kmm.RoleMaster:
+		runKmm(c)
+	case kmm.RoleCompute:
+		setupCompute(c)
+	default:
+		log.Fatalf("invalid role %q, must be auto, %s or %s", role, kmm.RoleMaster, kmm.RoleCompute)
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(bootstrapCmd)
+
+	bootstrapCmd.Flags().String(
+		"role",
+		getDefaultFromEnvs([]string{"KMM_ROLE"}, "auto"),
+		"The role of the node: auto (from the role label), master or compute (defaults: KMM_ROLE, auto)")
+	bootstrapCmd.Flags().String(
+		"role-label",
+		kmm.DefaultRoleLabel,
+		"The node label (from the cloud tags or node data) which is master on masters")
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/UKHomeOffice/keto-k8/pkg/bundle"
+	"github.com/UKHomeOffice/keto-k8/pkg/etcd"
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+	"github.com/UKHomeOffice/keto-k8/pkg/kmm"
+	"github.com/spf13/cobra"
+)
+
+// bundleCmd groups the commands to archive or restore a cluster's identity
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Export or import the cluster identity as an encrypted bundle",
+	Long: "Export or import the persistent CAs (--kube-ca-cert, --kube-ca-key and optionally --etcd-client-ca and " +
+		"--etcd-ca-key), the shared assets in etcd and the cluster metadata as a single encrypted tarball e.g. to " +
+		"archive a cluster, move it between regions or seed a DR standby",
+}
+
+var bundleExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the cluster identity to an encrypted bundle",
+	Long:  "Export the cluster identity to an encrypted bundle (the shared assets are only included once created)",
+	Run: func(c *cobra.Command, args []string) {
+		if err := exportBundle(c); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var bundleImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import the cluster identity from an encrypted bundle",
+	Long: "Import the cluster identity from an encrypted bundle before the masters are started. Existing CA files " +
+		"or shared assets which are different are only replaced with --force (the files are backed up first)",
+	Run: func(c *cobra.Command, args []string) {
+		if err := importBundle(c); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func exportBundle(c *cobra.Command) error {
+	passphrase, err := getBundlePassphrase(c)
+	if err != nil {
+		return err
+	}
+	file, err := getBundleFile(c)
+	if err != nil {
+		return err
+	}
+	client, err := getBundleEtcdClient(c)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	b, err := kmm.ExportBundle(getBundleFiles(c), client, bundle.Metadata{
+		ClusterName: c.Flag("cluster-name").Value.String(),
+		KubeVersion: c.Flag("kube-version").Value.String(),
+	})
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err = b.Write(&buf, passphrase); err != nil {
+		return err
+	}
+	if err = fileutil.WriteFile(file, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	log.Printf("Exported %s to %s", strings.Join(b.Names(), ", "), file)
+	return nil
+}
+
+func importBundle(c *cobra.Command) error {
+	passphrase, err := getBundlePassphrase(c)
+	if err != nil {
+		return err
+	}
+	file, err := getBundleFile(c)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	b, err := bundle.Read(f, passphrase)
+	if err != nil {
+		return err
+	}
+	log.Printf("Importing bundle of cluster %q (kubernetes %s, created %v by keto-k8 %s, masters %v)",
+		b.Metadata.ClusterName, b.Metadata.KubeVersion, b.Metadata.Created, b.Metadata.KetoK8Version, b.Metadata.Masters)
+	client, err := getBundleEtcdClient(c)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	force, _ := c.Flags().GetBool("force")
+	return kmm.ImportBundle(b, getBundleFiles(c), client, force)
+}
+
+// getBundlePassphrase reads the passphrase from the passphrase file (or KMM_BUNDLE_PASSPHRASE)
+func getBundlePassphrase(c *cobra.Command) ([]byte, error) {
+	passphrase := []byte(os.Getenv("KMM_BUNDLE_PASSPHRASE"))
+	if file := c.Flag("passphrase-file").Value.String(); len(file) > 0 {
+		var err error
+		if passphrase, err = ioutil.ReadFile(file); err != nil {
+			return nil, err
+		}
+	}
+	passphrase = bytes.TrimRight(passphrase, "\r\n")
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("a passphrase must be specified with --passphrase-file or KMM_BUNDLE_PASSPHRASE")
+	}
+	return passphrase, nil
+}
+
+func getBundleFile(c *cobra.Command) (string, error) {
+	file := c.Flag("file").Value.String()
+	if len(file) == 0 {
+		return "", fmt.Errorf("the bundle --file must be specified")
+	}
+	return file, nil
+}
+
+func getBundleFiles(c *cobra.Command) kmm.BundleFiles {
+	return kmm.BundleFiles{
+		KubeCaCert: c.Flag("kube-ca-cert").Value.String(),
+		KubeCaKey:  c.Flag("kube-ca-key").Value.String(),
+		EtcdCaCert: c.Flag("etcd-client-ca").Value.String(),
+		EtcdCaKey:  c.Flag("etcd-ca-key").Value.String(),
+	}
+}
+
+func getBundleEtcdClient(c *cobra.Command) (*etcd.Client, error) {
+	etcdCfg, err := getEtcdClientConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	if etcdCfg.TLS, err = getTLSConfig(c); err != nil {
+		return nil, err
+	}
+	return etcd.New(etcdCfg), nil
+}
+
+func init() {
+	for _, c := range []*cobra.Command{bundleExportCmd, bundleImportCmd} {
+		c.Flags().String("file", "", "The bundle file")
+		c.Flags().String(
+			"passphrase-file",
+			os.Getenv("KMM_BUNDLE_PASSPHRASE_FILE"),
+			fmt.Sprintf("File with the passphrase (at least %d characters) the bundle is encrypted with "+
+				"(defaults: KMM_BUNDLE_PASSPHRASE_FILE, or the passphrase in KMM_BUNDLE_PASSPHRASE)", bundle.MinPassphraseLength))
+		bundleCmd.AddCommand(c)
+	}
+	bundleExportCmd.Flags().String("cluster-name", "", "The cluster name to record in the bundle metadata")
+	bundleImportCmd.Flags().Bool("force", false, "Replace existing CA files and shared assets which are different")
+	RootCmd.AddCommand(bundleCmd)
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/UKHomeOffice/keto-k8/pkg/kmm"
+	"github.com/spf13/cobra"
+)
+
+// caRotationCmd groups the commands to rotate the kube CA across the masters
+var caRotationCmd = &cobra.Command{
+	Use:   "ca-rotation",
+	Short: "Rotate the kube CA across the masters",
+	Long: "Rotate the kube CA in phases coordinated through etcd: trust (the new CA is trusted alongside the old one), " +
+		"sign (the new CA signs the master certs) and complete (the new CA replaces the persistent CA). Each master " +
+		"applies the current phase when kmm is restarted, advance to the next phase once they all have",
+}
+
+var caRotationStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start a kube CA rotation with a new CA",
+	Run: func(c *cobra.Command, args []string) {
+		if err := startCaRotation(c); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var caRotationAdvanceCmd = &cobra.Command{
+	Use:   "advance",
+	Short: "Move the kube CA rotation to its next phase",
+	Long: "Move the kube CA rotation to its next phase once every master has applied the current phase (or with " +
+		"--force), the rotation is finished after the complete phase",
+	Run: func(c *cobra.Command, args []string) {
+		if err := advanceCaRotation(c); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var caRotationStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the kube CA rotation phase applied by each master",
+	Run: func(c *cobra.Command, args []string) {
+		if err := caRotationStatus(c); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func startCaRotation(c *cobra.Command) error {
+	certFile := c.Flag("new-ca-cert").Value.String()
+	keyFile := c.Flag("new-ca-key").Value.String()
+	if len(certFile) == 0 || len(keyFile) == 0 {
+		return fmt.Errorf("the --new-ca-cert and --new-ca-key must be specified")
+	}
+	client, err := getBundleEtcdClient(c)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if err = kmm.StartCaRotation(client, certFile, keyFile); err != nil {
+		return err
+	}
+	log.Printf("Started the kube CA rotation, restart kmm on each master to apply the %s phase", kmm.CaRotationTrust)
+	log.Printf("Copy the new CA key to the --kube-ca-key path with a %s suffix on each master before the %s phase",
+		kmm.RotatingCaKeySuffix, kmm.CaRotationSign)
+	return nil
+}
+
+func advanceCaRotation(c *cobra.Command) error {
+	client, err := getBundleEtcdClient(c)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	force, _ := c.Flags().GetBool("force")
+	phase, err := kmm.AdvanceCaRotation(client, force)
+	if err != nil {
+		return err
+	}
+	if len(phase) == 0 {
+		log.Printf("The kube CA rotation is finished")
+		return nil
+	}
+	log.Printf("Advanced the kube CA rotation, restart kmm on each master to apply the %s phase", phase)
+	return nil
+}
+
+func caRotationStatus(c *cobra.Command) error {
+	client, err := getBundleEtcdClient(c)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	r, err := kmm.GetCaRotation(client)
+	if err != nil {
+		return err
+	}
+	if r == nil {
+		fmt.Println("No kube CA rotation in progress")
+		return nil
+	}
+	nodes, err := kmm.CaRotationNodes(client)
+	if err != nil {
+		return err
+	}
+	pending, err := kmm.PendingCaRotation(client, r)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Phase: %s (since %s ago)\n", r.Phase, time.Since(r.Updated)/time.Second*time.Second)
+	fmt.Printf("Pending: %s\n", strings.Join(pending, ", "))
+	names := make([]string, 0, len(nodes))
+	for node := range nodes {
+		names = append(names, node)
+	}
+	sort.Strings(names)
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tAPPLIED PHASE")
+	for _, node := range names {
+		fmt.Fprintf(w, "%s\t%s\n", node, nodes[node])
+	}
+	return w.Flush()
+}
+
+func init() {
+	caRotationStartCmd.Flags().String("new-ca-cert", "", "The new kube CA cert (or chain)")
+	caRotationStartCmd.Flags().String("new-ca-key", "", "The new kube CA key (checked against the cert, it isn't shared through etcd)")
+	caRotationAdvanceCmd.Flags().Bool("force", false, "Advance even when some masters haven't applied the current phase")
+	caRotationCmd.AddCommand(caRotationStartCmd, caRotationAdvanceCmd, caRotationStatusCmd)
+	RootCmd.AddCommand(caRotationCmd)
+}
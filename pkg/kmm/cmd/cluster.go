@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/UKHomeOffice/keto-k8/pkg/etcd"
+	"github.com/UKHomeOffice/keto-k8/pkg/kmm"
+	"github.com/spf13/cobra"
+)
+
+// clusterCmd groups the commands to inspect the cluster
+var clusterCmd = &cobra.Command{
+	Use:   "cluster",
+	Short: "Inspect the cluster state kept in etcd",
+	Long:  "Inspect the cluster state kept in etcd",
+}
+
+// membersCmd lists the nodes with a current heartbeat
+var membersCmd = &cobra.Command{
+	Use:   "members",
+	Short: "List the nodes which believe they're part of the cluster",
+	Long:  "List the masters (and compute nodes with --compute-heartbeat) with a current heartbeat in etcd",
+	Run: func(c *cobra.Command, args []string) {
+		listMembers(c)
+	},
+}
+
+func listMembers(c *cobra.Command) {
+	etcdCfg, err := getEtcdClientConfig(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+	members, err := kmm.ListMembers(etcd.New(etcdCfg))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if kmm.OutputJSON {
+		if members == nil {
+			members = []kmm.Member{}
+		}
+		b, err := json.MarshalIndent(kmm.MembersResult{SchemaVersion: kmm.ResultSchemaVersion, Members: members}, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(b))
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tROLE\tSTATE\tKUBE VERSION\tKETO-K8 VERSION\tLAST SEEN")
+	for _, m := range members {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s ago\n",
+			m.Node, m.Role, m.State, m.KubeVersion, m.KetoK8Version,
+			time.Since(m.Updated)/time.Second*time.Second)
+	}
+	w.Flush()
+}
+
+func init() {
+	clusterCmd.AddCommand(membersCmd)
+	RootCmd.AddCommand(clusterCmd)
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+
+	log "github.com/Sirupsen/logrus"
+	certutil "github.com/UKHomeOffice/keto-k8/pkg/client-go/util/cert"
+	"github.com/UKHomeOffice/keto-k8/pkg/etcd"
+	"github.com/UKHomeOffice/keto-k8/pkg/kmm"
+	"github.com/spf13/cobra"
+)
+
+// clustersCmd groups the commands for clusters sharing etcd (each with its own --etcd-key-prefix)
+var clustersCmd = &cobra.Command{
+	Use:   "clusters",
+	Short: "Manage clusters sharing etcd",
+	Long:  "List, provision and validate the isolation of clusters sharing etcd (each with its own --etcd-key-prefix)",
+}
+
+// clustersListCmd lists the clusters under the root
+var clustersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the clusters found under the key prefix root",
+	Long:  "List the clusters with keys under the --root (the parent of the --etcd-key-prefix), needs access to the whole root",
+	Run: func(c *cobra.Command, args []string) {
+		listClusters(c)
+	},
+}
+
+// clustersProvisionCmd creates the etcd role and user of a cluster
+var clustersProvisionCmd = &cobra.Command{
+	Use:   "provision",
+	Short: "Provision the etcd role and user of a cluster",
+	Long: "Create an etcd role with access to the --etcd-key-prefix only and grant it to the cluster etcd user " +
+		"(the common name of its client cert), run with etcd root credentials",
+	Run: func(c *cobra.Command, args []string) {
+		provisionCluster(c)
+	},
+}
+
+// clustersValidateCmd checks the credentials of a cluster are isolated
+var clustersValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the etcd credentials can't read outside the key prefix",
+	Long:  "Check the etcd client credentials can read the --etcd-key-prefix but nothing outside it",
+	Run: func(c *cobra.Command, args []string) {
+		validateCluster(c)
+	},
+}
+
+func listClusters(c *cobra.Command) {
+	etcdCfg, err := getEtcdClientConfig(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+	root := c.Flag("root").Value.String()
+	if len(root) == 0 && len(etcdCfg.KeyPrefix) > 0 {
+		if root = path.Dir(strings.TrimSuffix(etcdCfg.KeyPrefix, "/")); root != "/" {
+			root += "/"
+		}
+	}
+	clusters, err := kmm.ListClusters(etcdCfg, root)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if kmm.OutputJSON {
+		b, err := json.MarshalIndent(kmm.ClustersResult{SchemaVersion: kmm.ResultSchemaVersion, Clusters: clusters}, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(b))
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "CLUSTER\tKEY PREFIX\tASSETS\tMASTERS\tCOMPUTES\tKUBE VERSION")
+	for _, cl := range clusters {
+		fmt.Fprintf(w, "%s\t%s\t%v\t%d\t%d\t%s\n", cl.Name, cl.KeyPrefix, cl.Assets, cl.Masters, cl.Computes, cl.KubeVersion)
+	}
+	w.Flush()
+}
+
+func provisionCluster(c *cobra.Command) {
+	etcdCfg, err := getEtcdClientConfig(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(etcdCfg.KeyPrefix) == 0 {
+		log.Fatal(fmt.Errorf("the --etcd-key-prefix of the cluster must be specified"))
+	}
+	user := c.Flag("user").Value.String()
+	if userCert := c.Flag("user-cert").Value.String(); len(user) == 0 && len(userCert) > 0 {
+		certs, err := certutil.CertsFromFile(userCert)
+		if err != nil {
+			log.Fatal(err)
+		}
+		user = certs[0].Subject.CommonName
+	}
+	if len(user) == 0 {
+		log.Fatal(fmt.Errorf("the cluster etcd --user or --user-cert must be specified"))
+	}
+	role := c.Flag("role").Value.String()
+	if len(role) == 0 {
+		role = "keto-k8-" + path.Base(etcdCfg.KeyPrefix)
+	}
+	client := etcd.New(etcdCfg)
+	defer client.Close()
+	if err = client.Provision(role, user); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func validateCluster(c *cobra.Command) {
+	etcdCfg, err := getEtcdClientConfig(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+	client := etcd.New(etcdCfg)
+	defer client.Close()
+	if err = client.ValidateIsolation(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("The etcd credentials only have access to %s\n", etcdCfg.KeyPrefix)
+}
+
+func init() {
+	clustersListCmd.Flags().String("root", "", "Key prefix root the clusters are under (defaults: the parent of the --etcd-key-prefix, "+etcd.ClustersRoot+")")
+	clustersProvisionCmd.Flags().String("user", "", "etcd user of the cluster (the common name of its etcd client cert)")
+	clustersProvisionCmd.Flags().String("user-cert", "", "etcd client cert of the cluster to take the user from")
+	clustersProvisionCmd.Flags().String("role", "", "etcd role to create (defaults: keto-k8-<last element of the key prefix>)")
+	clustersCmd.AddCommand(clustersListCmd)
+	clustersCmd.AddCommand(clustersProvisionCmd)
+	clustersCmd.AddCommand(clustersValidateCmd)
+	RootCmd.AddCommand(clustersCmd)
+}
@@ -1,8 +1,17 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
 	log "github.com/Sirupsen/logrus"
+	"github.com/UKHomeOffice/keto-k8/pkg/datadisk"
 	"github.com/UKHomeOffice/keto-k8/pkg/kmm"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm"
+	"github.com/UKHomeOffice/keto-k8/pkg/notify"
+	"github.com/UKHomeOffice/keto-k8/pkg/statedir"
 	"github.com/spf13/cobra"
 )
 
@@ -18,10 +27,82 @@ var computeCmd = &cobra.Command{
 
 func setupCompute(c *cobra.Command) {
 	exitOnCompletion, _ := c.Flags().GetBool(ExitOnCompletionFlagName)
-	err := kmm.SetupCompute(
-		c.Flag("cloud-provider").Value.String(),
-		exitOnCompletion,
-	)
+	setGlobals(c)
+	if err := statedir.Link(); err != nil {
+		log.Fatal(err)
+	}
+	tlsCfg, err := getTLSConfig(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var kubeletCfg *kubeadm.KubeletConfig
+	fileCfg, err := loadFileConfig(c, userDataConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if fileCfg != nil {
+		if err = notify.Configure(fileCfg.Notifications); err != nil {
+			log.Fatal(err)
+		}
+		kubeletCfg = fileCfg.Kubelet
+		kmm.NodePools = fileCfg.NodePools
+	}
+	nodeCfg := kubeadm.Config{
+		CloudProvider:    c.Flag("cloud-provider").Value.String(),
+		HardeningProfile: c.Flag("hardening-profile").Value.String(),
+		TLS:              tlsCfg,
+		Kubelet:          kubeletCfg,
+
+		ComputeJoinMode:            c.Flag("join-mode").Value.String(),
+		BootstrapToken:             c.Flag("bootstrap-token").Value.String(),
+		BootstrapCACertFile:        c.Flag("bootstrap-ca-cert").Value.String(),
+		DiscoveryTokenCACertHashes: deleteEmpty(strings.Split(c.Flag("discovery-token-ca-cert-hash").Value.String(), ",")),
+	}
+	if err = kubeadm.ValidateComputeJoinMode(nodeCfg.ComputeJoinMode); err != nil {
+		log.Fatal(err)
+	}
+	if nodeCfg.TokenJoin() && len(nodeCfg.BootstrapToken) == 0 {
+		log.Fatal(fmt.Errorf("the %s join mode needs a --bootstrap-token", kubeadm.ComputeJoinModeToken))
+	}
+	if len(nodeCfg.BootstrapToken) > 0 {
+		if err = kubeadm.ValidateBootstrap(nodeCfg.BootstrapToken, nodeCfg.BootstrapCACertFile, nodeCfg.DiscoveryTokenCACertHashes); err != nil {
+			log.Fatal(err)
+		}
+	}
+	var heartbeatInterval time.Duration
+	if computeHeartbeat, _ := c.Flags().GetBool("compute-heartbeat"); computeHeartbeat {
+		if nodeCfg.EtcdClientConfig, err = getEtcdClientConfig(c); err != nil {
+			log.Fatal(err)
+		}
+		nodeCfg.EtcdClientConfig.TLS = tlsCfg
+		heartbeatInterval, _ = c.Flags().GetDuration("heartbeat-interval")
+	}
+	skipKubeletStart, _ := c.Flags().GetBool("skip-kubelet-start")
+	kmm.APIWaitTimeout, _ = c.Flags().GetDuration("api-wait-timeout")
+	kmm.NodeReadyTimeout, _ = c.Flags().GetDuration("node-ready-timeout")
+	kmm.GPU = c.Flag("gpu").Value.String()
+	if err = kmm.ValidateGPU(kmm.GPU); err != nil {
+		log.Fatal(err)
+	}
+	kmm.NvidiaRuntimePath = c.Flag("nvidia-runtime").Value.String()
+	if kmm.CNIPlugins, err = getCNIPlugins(c); err != nil {
+		log.Fatal(err)
+	}
+	if err = setHostPrerequisites(c); err != nil {
+		log.Fatal(err)
+	}
+	if err = setHostConfig(c); err != nil {
+		log.Fatal(err)
+	}
+	if err = setCloudSignal(c); err != nil {
+		log.Fatal(err)
+	}
+	datadisk.Device = c.Flag("data-disk").Value.String()
+	datadisk.MountPoint = c.Flag("data-disk-mount").Value.String()
+	kmm.TerminationCheckInterval, _ = c.Flags().GetDuration("termination-check-interval")
+	kmm.DrainGracePeriod, _ = c.Flags().GetDuration("drain-grace-period")
+	kmm.DrainTimeout, _ = c.Flags().GetDuration("drain-timeout")
+	err = kmm.SetupCompute(nodeCfg, heartbeatInterval, exitOnCompletion, skipKubeletStart)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -29,4 +110,56 @@ func setupCompute(c *cobra.Command) {
 
 func init() {
 	RootCmd.AddCommand(computeCmd)
+
+	computeCmd.Flags().Bool(
+		"skip-kubelet-start",
+		false,
+		"Write the kubelet unit and config but don't start the kubelet (e.g. to validate images)")
+	computeCmd.Flags().Duration(
+		"api-wait-timeout",
+		kmm.APIWaitTimeout,
+		"How long to wait for the api server /healthz before starting the kubelet (0 to not wait)")
+	computeCmd.Flags().Duration(
+		"node-ready-timeout",
+		kmm.NodeReadyTimeout,
+		"How long to wait for the node to register and be ready once the kubelet is started (0 to not wait)")
+	computeCmd.Flags().String(
+		"bootstrap-ca-cert",
+		"",
+		"The kube CA cert the bootstrap kubeconfig and kubelet trust (discovered from the cluster-info with a --bootstrap-token, otherwise read from the keto-tokens kubeconfig or the CA already on the node when not set)")
+	computeCmd.Flags().String(
+		"discovery-token-ca-cert-hash",
+		"",
+		"Comma separated sha256:<hex> hashes of the kube CA public key the discovered (or specified) CA must match")
+	computeCmd.Flags().String(
+		"gpu",
+		os.Getenv("KMM_GPU"),
+		"Set up NVIDIA GPUs (label, taint and container runtime): auto (when found) or nvidia (defaults: KMM_GPU)")
+	computeCmd.Flags().String(
+		"nvidia-runtime",
+		kmm.NvidiaRuntimePath,
+		"The NVIDIA container runtime made the docker default on GPU nodes")
+	computeCmd.Flags().String(
+		"data-disk",
+		os.Getenv("KMM_DATA_DISK"),
+		"Instance-store or extra EBS device to format (when empty) and move the kubelet and docker data onto (defaults: KMM_DATA_DISK)")
+	computeCmd.Flags().String(
+		"data-disk-mount",
+		datadisk.DefaultMountPoint,
+		"Where the data disk is mounted")
+	computeCmd.Flags().Duration(
+		"termination-check-interval",
+		kmm.TerminationCheckInterval,
+		"How often to check the instance metadata for a spot or scale-in termination notice to drain the node (0 to not check)")
+	computeCmd.Flags().Duration(
+		"drain-grace-period",
+		kmm.DrainGracePeriod,
+		"The grace period of each pod evicted when the node is terminating (negative for the pod's own)")
+	computeCmd.Flags().Duration(
+		"drain-timeout",
+		kmm.DrainTimeout,
+		"How long to evict pods for when the node is terminating (before it's deregistered anyway)")
+
+	// bootstrap runs setup-compute on compute nodes so takes the same flags
+	bootstrapCmd.Flags().AddFlagSet(computeCmd.Flags())
 }
@@ -4,12 +4,37 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/UKHomeOffice/keto-k8/pkg/artifacts"
+	"github.com/UKHomeOffice/keto-k8/pkg/backup"
+	"github.com/UKHomeOffice/keto-k8/pkg/command"
+	"github.com/UKHomeOffice/keto-k8/pkg/constants"
+	"github.com/UKHomeOffice/keto-k8/pkg/drift"
+	"github.com/UKHomeOffice/keto-k8/pkg/etcd"
+	"github.com/UKHomeOffice/keto-k8/pkg/faults"
+	"github.com/UKHomeOffice/keto-k8/pkg/hardening"
+	"github.com/UKHomeOffice/keto-k8/pkg/hostconfig"
+	"github.com/UKHomeOffice/keto-k8/pkg/images"
 	"github.com/UKHomeOffice/keto-k8/pkg/kmm"
+	"github.com/UKHomeOffice/keto-k8/pkg/kms"
 	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm"
+	"github.com/UKHomeOffice/keto-k8/pkg/lbregister"
+	"github.com/UKHomeOffice/keto-k8/pkg/lock"
+	"github.com/UKHomeOffice/keto-k8/pkg/logging"
 	"github.com/UKHomeOffice/keto-k8/pkg/network"
+	"github.com/UKHomeOffice/keto-k8/pkg/prereq"
+	"github.com/UKHomeOffice/keto-k8/pkg/profile"
+	"github.com/UKHomeOffice/keto-k8/pkg/secprofile"
+	"github.com/UKHomeOffice/keto-k8/pkg/selinux"
+	"github.com/UKHomeOffice/keto-k8/pkg/statedir"
+	"github.com/UKHomeOffice/keto-k8/pkg/status"
+	"github.com/UKHomeOffice/keto-k8/pkg/tlsconfig"
+	"github.com/UKHomeOffice/keto-k8/pkg/tracing"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 // ExitOnCompletionFlagName is the syntax for the flag
@@ -28,6 +53,55 @@ var (
 			}
 			return c.Usage()
 		},
+		PersistentPreRunE: func(c *cobra.Command, args []string) error {
+			// The user data can set any flag so it's applied before the flags are used
+			var err error
+			if userDataConfig, err = applyUserData(c); err != nil {
+				return err
+			}
+			if err := logging.SetLevels(c.Flag("log-level").Value.String()); err != nil {
+				return err
+			}
+			if err := command.SetTimeouts(c.Flag("command-timeouts").Value.String()); err != nil {
+				return err
+			}
+			if err := faults.Configure(c.Flag("inject-faults").Value.String()); err != nil {
+				return err
+			}
+			switch output := c.Flag("output").Value.String(); output {
+			case "text":
+			case "json":
+				kmm.OutputJSON = true
+			default:
+				return fmt.Errorf("invalid output %q, must be text or json", output)
+			}
+			if points := faults.Configured(); len(points) > 0 {
+				log.Warnf("Fault injection enabled at: %s", strings.Join(points, ", "))
+			}
+			if profileBootstrap, _ := c.Flags().GetBool("profile-bootstrap"); profileBootstrap {
+				profile.Enable()
+			}
+			kubeadm.Plugin = c.Flag("kubeadm-plugin").Value.String()
+			kubeadm.PluginArgs = pluginArgs(c)
+			statusServer.Address = c.Flag("status-address").Value.String()
+			statusServer.Pprof, _ = c.Flags().GetBool("status-pprof")
+			if err := statusServer.Start(); err != nil {
+				return err
+			}
+			return tracing.Init(c.Flag("tracing-jaeger-agent").Value.String(), c.Name())
+		},
+		PersistentPostRunE: func(c *cobra.Command, args []string) error {
+			statusServer.Stop()
+			return tracing.Close()
+		},
+	}
+
+	// userDataConfig is the config file sections from the user data (set before any command runs)
+	userDataConfig *kmm.FileConfig
+
+	// statusServer is started for all commands when an address is set
+	statusServer = &status.Server{
+		Status: func() interface{} { return kmm.CurrentStatus() },
 	}
 )
 
@@ -40,7 +114,7 @@ func Execute() {
 }
 
 func init() {
-	log.SetFormatter(&log.TextFormatter{
+	logging.SetFormatter(&log.TextFormatter{
 		DisableTimestamp: true,
 		DisableSorting:   true,
 	})
@@ -49,12 +123,177 @@ func init() {
 	RootCmd.Flags().BoolP("help", "h", false, "Help message")
 	RootCmd.Flags().BoolP("version", "v", false, "Print version")
 
+	RootCmd.PersistentFlags().String(
+		"log-level",
+		getDefaultFromEnvs([]string{"KMM_LOG_LEVEL"}, "info"),
+		"Log level, optionally per component (kmm, kubeadm, k8client, etcd, etcd-audit) e.g. info,etcd=debug (defaults: KMM_LOG_LEVEL, info)")
+
+	RootCmd.PersistentFlags().StringP(
+		"output",
+		"o",
+		getDefaultFromEnvs([]string{"KMM_OUTPUT"}, "text"),
+		"Output format of the bootstrap result and status commands: text or json (on stdout, logs stay on stderr) (defaults: KMM_OUTPUT, text)")
+
+	RootCmd.PersistentFlags().String(
+		"tracing-jaeger-agent",
+		os.Getenv("KMM_TRACING_JAEGER_AGENT"),
+		"Report bootstrap traces to a jaeger agent e.g. localhost:6831 (defaults: KMM_TRACING_JAEGER_AGENT)")
+
+	RootCmd.PersistentFlags().String(
+		"command-timeouts",
+		getDefaultFromEnvs([]string{"KMM_COMMAND_TIMEOUTS"}, command.DefaultTimeouts),
+		"How long commands can run for, optionally per command e.g. 10m,kubectl=2m (defaults: KMM_COMMAND_TIMEOUTS, "+command.DefaultTimeouts+")")
+
+	RootCmd.PersistentFlags().String(
+		"status-address",
+		os.Getenv("KMM_STATUS_ADDRESS"),
+		"Address to serve the status endpoints on e.g. 127.0.0.1:10260 (defaults: KMM_STATUS_ADDRESS, disabled)")
+
+	RootCmd.PersistentFlags().Bool(
+		"profile-bootstrap",
+		false,
+		"Print the wall-clock and CPU time taken by each phase and subprocess (e.g. kubeadm, kubectl and etcd) once bootstrapped")
+
+	RootCmd.PersistentFlags().Bool(
+		"status-pprof",
+		false,
+		"Also serve the pprof and runtime (expvar) endpoints under /debug/ on the status address")
+
+	// Only for testing e.g. the multi-master races and clean up (see README)
+	RootCmd.PersistentFlags().String(
+		"inject-faults",
+		os.Getenv("KMM_INJECT_FAULTS"),
+		"Faults to inject e.g. after-create-pki=30s,before-put-tx=fail (defaults: KMM_INJECT_FAULTS)")
+	RootCmd.PersistentFlags().MarkHidden("inject-faults")
+	RootCmd.PersistentFlags().String(
+		"pki-fixture-dir",
+		os.Getenv("KMM_PKI_FIXTURE_DIR"),
+		"Directory of pre-generated PKI and kubeconfigs to use instead of generating them (defaults: KMM_PKI_FIXTURE_DIR)")
+	RootCmd.PersistentFlags().MarkHidden("pki-fixture-dir")
+
+	RootCmd.PersistentFlags().String(
+		"kubeadm-plugin",
+		getDefaultFromEnvs([]string{"KMM_KUBEADM_PLUGIN"}, kubeadm.Plugin),
+		"Full keto-k8 binary to run the kubeadm phases with (slim builds only) (defaults: KMM_KUBEADM_PLUGIN, "+kubeadm.Plugin+")")
+
+	RootCmd.PersistentFlags().String(
+		"config",
+		os.Getenv("KMM_CONFIG"),
+		"Config file (yaml) e.g. for addon values (defaults: KMM_CONFIG)")
+	RootCmd.PersistentFlags().String(
+		"user-data",
+		os.Getenv("KMM_USER_DATA"),
+		"Read the "+kmm.UserDataKey+" section of the instance user data, from the "+kmm.UserDataEC2+" instance metadata or a file, "+
+			"for any flags not set and the config file sections not in --config (defaults: KMM_USER_DATA)")
+
+	RootCmd.PersistentFlags().String(
+		"artifacts-dir",
+		getDefaultFromEnvs([]string{"KMM_ARTIFACTS_DIR"}, artifacts.DefaultDir),
+		"Directory to save generated manifests e.g. RBAC (defaults: KMM_ARTIFACTS_DIR, "+artifacts.DefaultDir+")")
+	RootCmd.PersistentFlags().String(
+		"backup-dir",
+		getDefaultFromEnvs([]string{"KMM_BACKUP_DIR"}, backup.DefaultDir),
+		"Directory to back up the shared PKI, CA and static pod manifest files to before they're replaced (defaults: KMM_BACKUP_DIR, "+backup.DefaultDir+")")
+	RootCmd.PersistentFlags().Int(
+		"backup-retention",
+		backup.DefaultRetention,
+		"How many backups (one per run which replaces files) to keep, 0 to disable backups")
+	RootCmd.PersistentFlags().Bool(
+		"backup-keys",
+		false,
+		"Also back up files with key material e.g. private keys and kubeconfigs (not backed up by default)")
+
+	RootCmd.PersistentFlags().String(
+		"selinux-file-type",
+		getDefaultFromEnvs([]string{"KMM_SELINUX_FILE_TYPE"}, selinux.DefaultFileType),
+		"SELinux type to label generated files with when enforcing e.g. svirt_sandbox_file_t (defaults: KMM_SELINUX_FILE_TYPE)")
+
+	RootCmd.PersistentFlags().Duration(
+		"drift-check-interval",
+		5*time.Minute,
+		"How often a running kmm checks the files it wrote for changes made out-of-band (0 disables)")
+
+	RootCmd.PersistentFlags().String(
+		"state-dir",
+		os.Getenv("KMM_STATE_DIR"),
+		"Writable state volume for a read-only root filesystem, the --state-paths are linked to it (defaults: KMM_STATE_DIR)")
+	RootCmd.PersistentFlags().String(
+		"state-paths",
+		getDefaultFromEnvs([]string{"KMM_STATE_PATHS"}, strings.Join(statedir.DefaultPaths, ",")),
+		"Directories written to which are kept in the --state-dir, comma separated (defaults: KMM_STATE_PATHS, "+strings.Join(statedir.DefaultPaths, ",")+")")
+	RootCmd.PersistentFlags().String(
+		"kubelet-unit-file",
+		getDefaultFromEnvs([]string{"KMM_KUBELET_UNIT_FILE"}, constants.KubeletUnitFileName),
+		"Where to save the kubelet systemd unit e.g. /run/systemd/system/kubelet.service on a read-only /etc (defaults: KMM_KUBELET_UNIT_FILE, "+constants.KubeletUnitFileName+")")
+	RootCmd.PersistentFlags().String(
+		"host-prerequisites",
+		getDefaultFromEnvs([]string{"KMM_HOST_PREREQUISITES"}, prereq.ModeWarn),
+		"How missing host tools (iptables, conntrack, ebtables, socat and any the network provider needs), a skewed clock, low disk "+
+			"and unreachable etcd or api endpoints are dealt with: "+
+			"warn, check (fail the bootstrap) or install (with the host package manager) (defaults: KMM_HOST_PREREQUISITES, "+prereq.ModeWarn+")")
+	RootCmd.PersistentFlags().String(
+		"ntp-server",
+		os.Getenv("KMM_NTP_SERVER"),
+		"NTP server the clock is checked against with the host prerequisites e.g. 169.254.169.123 on AWS (defaults: KMM_NTP_SERVER, not checked when empty)")
+	RootCmd.PersistentFlags().Duration(
+		"max-clock-skew",
+		prereq.DefaultMaxClockSkew,
+		"The largest offset from the --ntp-server allowed")
+	RootCmd.PersistentFlags().Uint64(
+		"min-free-disk-mb",
+		prereq.DefaultMinFreeDiskMB,
+		"The least free space (MiB) on the filesystems of /etc/kubernetes, the kubelet, the container runtime and the etcd client certs")
+	RootCmd.PersistentFlags().Uint64(
+		"min-free-inodes",
+		prereq.DefaultMinFreeInodes,
+		"The least free inodes on the filesystems checked for free space")
+	RootCmd.PersistentFlags().Bool(
+		"configure-host",
+		false,
+		"Load the kernel modules (br_netfilter, overlay, nf_conntrack and any the network provider needs) and set the ip_forward and "+
+			"bridge-nf-call sysctls before the kubelet starts, persisted to "+hostconfig.ModulesFile+" and "+hostconfig.SysctlFile)
+	RootCmd.PersistentFlags().Int(
+		"conntrack-max",
+		0,
+		"The conntrack table size (net.netfilter.nf_conntrack_max) set with --configure-host (the kernel default when zero)")
+	RootCmd.PersistentFlags().String(
+		"host-sysctls",
+		os.Getenv("KMM_HOST_SYSCTLS"),
+		"Extra sysctls set with --configure-host, comma separated e.g. vm.max_map_count=262144 (defaults: KMM_HOST_SYSCTLS)")
+	RootCmd.PersistentFlags().Bool(
+		"install-cni-plugins",
+		false,
+		"Install the loopback, bridge, host-local, portmap and network provider CNI plugins into "+network.PluginsDir+" before the kubelet starts")
+	RootCmd.PersistentFlags().String(
+		"cni-plugins-url",
+		getDefaultFromEnvs([]string{"KMM_CNI_PLUGINS_URL"}, network.DefaultPluginsURL),
+		"The CNI plugins .tgz (http(s):// or file://) the plugins are installed from (defaults: KMM_CNI_PLUGINS_URL, "+network.DefaultPluginsURL+")")
+	RootCmd.PersistentFlags().String(
+		"cni-plugins-sha256",
+		os.Getenv("KMM_CNI_PLUGINS_SHA256"),
+		"The sha256 the CNI plugins .tgz must match, the checksum published alongside it is used when not set (defaults: KMM_CNI_PLUGINS_SHA256)")
+
 	// etcd flags
 	RootCmd.PersistentFlags().String(
 		"etcd-endpoints",
 		getDefaultFromEnvs([]string{"KMM_ETCD_ENDPOINTS", "ETCD_ADVERTISE_CLIENT_URLS"}, "http://127.0.0.1:2380"),
 		"ETCD endpoints (defaults: KMM_ETCD_ENDPOINTS, ETCD_ADVERTISE_CLIENT_URLS, http://127.0.0.1:2380)")
 
+	RootCmd.PersistentFlags().String(
+		"etcd-discovery",
+		os.Getenv("KMM_ETCD_DISCOVERY"),
+		"Discover the etcd endpoints from a management cluster instead: service/<namespace>/<name>[:<port name>] or etcdcluster/<namespace>/<name> (defaults: KMM_ETCD_DISCOVERY)")
+
+	RootCmd.PersistentFlags().String(
+		"etcd-discovery-kubeconfig",
+		os.Getenv("KMM_ETCD_DISCOVERY_KUBECONFIG"),
+		"Kubeconfig of the management cluster the etcd endpoints are discovered from (defaults: KMM_ETCD_DISCOVERY_KUBECONFIG)")
+
+	RootCmd.PersistentFlags().Duration(
+		"etcd-discovery-interval",
+		time.Minute,
+		"How often masters discover the etcd endpoints again (re-writing the manifests when they change), 0 to disable")
+
 	RootCmd.PersistentFlags().String(
 		"etcd-client-ca",
 		getDefaultFromEnvs([]string{"KMM_ETCD_CLIENT_CA", "ETCD_CA_FILE"}, ""),
@@ -70,15 +309,59 @@ func init() {
 		os.Getenv("KMM_ETCD_CLIENT_KEY"),
 		"ETCD client key file (defaults: KMM_ETCD_CLIENT_KEY)")
 
+	RootCmd.PersistentFlags().String(
+		"etcd-key-prefix",
+		os.Getenv("KMM_ETCD_KEY_PREFIX"),
+		"Prefix for all the cluster keys (including the apiserver data) when clusters share etcd e.g. "+etcd.ClusterKeyPrefix("", "<cluster>")+" (defaults: KMM_ETCD_KEY_PREFIX)")
+
+	RootCmd.PersistentFlags().Bool(
+		"etcd-strict-isolation",
+		false,
+		"Masters check the etcd credentials can't read outside the --etcd-key-prefix before bootstrapping")
+
 	// kubeadm flags
 	RootCmd.PersistentFlags().String("kube-server", os.Getenv("KMM_KUBE_SERVER"), "Kubernetes API Server")
 
 	// Do NOT specify a default here - this will be set by the cloud provider
 	RootCmd.PersistentFlags().String("kube-version", "", "Kubernetes version")
 	RootCmd.PersistentFlags().String("cloud-provider", "", "Cloud provider (see keto)")
+	RootCmd.PersistentFlags().String(
+		"node-data-file",
+		os.Getenv("KMM_NODE_DATA_FILE"),
+		"Yaml file with the node data (cluster name, kube version, api server etc.) to use instead of a cloud provider (defaults: KMM_NODE_DATA_FILE)")
 	RootCmd.PersistentFlags().String("kube-kubeletid", os.Getenv("KMM_KUBELETID"), "Kubernetes Kubelet ID")
 	RootCmd.PersistentFlags().String("kube-ca-cert", os.Getenv("KMM_KUBE_CA_CERT"), "Kubernetes CA cert")
 	RootCmd.PersistentFlags().String("kube-ca-key", os.Getenv("KMM_KUBE_CA_KEY"), "Kubernetes CA key")
+	RootCmd.PersistentFlags().String(
+		"kube-ca-key-mode",
+		getDefaultFromEnvs([]string{"KMM_KUBE_CA_KEY_MODE"}, kubeadm.CaKeySymlink),
+		"How the Kubernetes CA key is made available to kubeadm: symlink, copy (mode 0600) or ephemeral (removed once the "+
+			"master certs are signed, disables the controller-manager CSR signer) (defaults: KMM_KUBE_CA_KEY_MODE, "+kubeadm.CaKeySymlink+")")
+	RootCmd.PersistentFlags().String(
+		"cluster-signing-mode",
+		getDefaultFromEnvs([]string{"KMM_CLUSTER_SIGNING_MODE"}, kubeadm.ClusterSigningKubeCA),
+		"The CA the controller-manager signs certificate requests (e.g. kubelet TLS bootstrapping) with: kube-ca or "+
+			"dedicated (a signing CA created by the primary master and shared in the assets, the CSR signer works with an "+
+			"ephemeral CA key) (defaults: KMM_CLUSTER_SIGNING_MODE, "+kubeadm.ClusterSigningKubeCA+")")
+	RootCmd.PersistentFlags().String(
+		"master-join-mode",
+		getDefaultFromEnvs([]string{"KMM_MASTER_JOIN_MODE"}, kubeadm.JoinModeAssets),
+		"How secondary masters get the shared assets: assets (shared through etcd) or kubeadm (uploaded with kubeadm "+
+			"encrypted with --certificate-key, requires kubernetes v1.15+) (defaults: KMM_MASTER_JOIN_MODE, "+kubeadm.JoinModeAssets+")")
+	RootCmd.PersistentFlags().String(
+		"join-mode",
+		getDefaultFromEnvs([]string{"KMM_JOIN_MODE"}, kubeadm.ComputeJoinModeKetoTokens),
+		"How compute nodes join: keto-tokens or token (with the --bootstrap-token only, keto-tokens isn't deployed) "+
+			"(defaults: KMM_JOIN_MODE, "+kubeadm.ComputeJoinModeKetoTokens+")")
+	RootCmd.PersistentFlags().String(
+		"bootstrap-token",
+		os.Getenv("KMM_BOOTSTRAP_TOKEN"),
+		"Bootstrap token compute kubelets join with instead of using keto-tokens, masters create it in the token join mode "+
+			"(defaults: KMM_BOOTSTRAP_TOKEN)")
+	RootCmd.PersistentFlags().String(
+		"certificate-key",
+		os.Getenv("KMM_CERTIFICATE_KEY"),
+		"Key (64 hex characters, the same on all masters) the assets are encrypted with in the kubeadm join mode (defaults: KMM_CERTIFICATE_KEY)")
 	RootCmd.PersistentFlags().String(
 		"etcd-ca-key",
 		getDefaultFromEnvs([]string{"KMM_ETCD_CA_KEY", ""}, ""),
@@ -88,6 +371,146 @@ func init() {
 		getDefaultFromEnvs([]string{"KMM_ETCD_CLUSTER_HOSTNAMES"}, ""),
 		"ETCD hostnames (defaults: KMM_ETCD_CLUSTER_HOSTNAMES or parsed from ETCD_INITIAL_CLUSTER)")
 	RootCmd.PersistentFlags().String("network-provider", "flannel", "Network Provider (flannel / weave / canal)")
+	RootCmd.PersistentFlags().Bool(
+		"pod-security-policy",
+		false,
+		"Enable the PodSecurityPolicy admission plugin with baseline policies (privileged for kube-system, restricted elsewhere)")
+	RootCmd.PersistentFlags().String(
+		"kms-key-arn",
+		os.Getenv("KMM_KMS_KEY_ARN"),
+		"AWS KMS key ARN to encrypt secrets with (defaults: KMM_KMS_KEY_ARN, requires kubernetes v1.10+)")
+	RootCmd.PersistentFlags().String(
+		"kms-plugin-image",
+		getDefaultFromEnvs([]string{"KMM_KMS_PLUGIN_IMAGE"}, kms.DefaultImage),
+		"AWS KMS plugin image run with the apiserver (defaults: KMM_KMS_PLUGIN_IMAGE)")
+	RootCmd.PersistentFlags().Int(
+		"api-proxy-port",
+		0,
+		"Also serve the apiserver on this port on each master (e.g. 6443 when it listens on 443) with a haproxy static pod, 0 to disable")
+	RootCmd.PersistentFlags().String(
+		"api-proxy-image",
+		getDefaultFromEnvs([]string{"KMM_API_PROXY_IMAGE"}, kubeadm.DefaultAPIProxyImage),
+		"haproxy image of the apiserver proxy (defaults: KMM_API_PROXY_IMAGE)")
+	RootCmd.PersistentFlags().Bool(
+		"kubelet-serving-certs",
+		false,
+		"Kubelets serve with certs signed by the cluster (masters by the kube CA, compute kubelets request them from the "+
+			"controller-manager and masters approve them) and the apiserver verifies them for logs and exec")
+	RootCmd.PersistentFlags().String(
+		"hardening-profile",
+		os.Getenv("KMM_HARDENING_PROFILE"),
+		"Set benchmark recommended flags for all components and report on the checks satisfied e.g. cis (defaults: KMM_HARDENING_PROFILE)")
+	RootCmd.PersistentFlags().Bool(
+		"runtime-security-profiles",
+		true,
+		"Add the runtime default seccomp (and AppArmor where available) profiles to control plane and addon pods (disable for debugging)")
+	RootCmd.PersistentFlags().String(
+		"tls-min-version",
+		os.Getenv("KMM_TLS_MIN_VERSION"),
+		"Minimum TLS version for the apiserver, kubelet and etcd client e.g. VersionTLS12 (defaults: KMM_TLS_MIN_VERSION)")
+	RootCmd.PersistentFlags().String(
+		"tls-cipher-suites",
+		os.Getenv("KMM_TLS_CIPHER_SUITES"),
+		"Allowed TLS cipher suites for the apiserver, kubelet and etcd client, comma separated (defaults: KMM_TLS_CIPHER_SUITES)")
+	RootCmd.PersistentFlags().Bool("default-storage-class", false, "Create a default StorageClass for the cloud provider")
+	RootCmd.PersistentFlags().String(
+		"enable-addons",
+		os.Getenv("KMM_ENABLE_ADDONS"),
+		"Optional addons to deploy, comma separated e.g. ingress-nginx (defaults: KMM_ENABLE_ADDONS)")
+	RootCmd.PersistentFlags().String(
+		"storage-class-params",
+		os.Getenv("KMM_STORAGE_CLASS_PARAMS"),
+		"Default StorageClass parameters e.g. type=io1,iopsPerGB=10 (defaults: KMM_STORAGE_CLASS_PARAMS)")
+	RootCmd.PersistentFlags().Bool(
+		"summary-to-etcd",
+		false,
+		"Also save the bootstrap summary of each master to etcd (under kmm-summary/<node>)")
+	RootCmd.PersistentFlags().Bool(
+		"publish-cluster-info",
+		true,
+		"Publish the kube-public cluster-info (the kube CA and api server) for kubeadm token discovery")
+	RootCmd.PersistentFlags().Bool(
+		"publish-kubeadm-config",
+		true,
+		"Publish the kube-system kubeadm-config and kubelet-config for kubeadm upgrade plan and other tooling (from v1.13)")
+	RootCmd.PersistentFlags().Duration(
+		"heartbeat-interval",
+		30*time.Second,
+		"How often masters update their member key in etcd (see cluster members), 0 to disable")
+	RootCmd.PersistentFlags().Bool(
+		"compute-heartbeat",
+		false,
+		"Also keep a member key in etcd for compute nodes (requires the etcd client flags)")
+	RootCmd.PersistentFlags().Duration(
+		"master-poll-interval",
+		20*time.Second,
+		"How often secondary masters check etcd for the shared assets")
+	RootCmd.PersistentFlags().Duration(
+		"master-wait-deadline",
+		0,
+		fmt.Sprintf("How long masters wait for the shared assets before exiting with code %d, 0 to wait forever", kmm.ExitCodeAssetsWaitDeadline))
+	RootCmd.PersistentFlags().String(
+		"image-runtime",
+		getDefaultFromEnvs([]string{"KMM_IMAGE_RUNTIME"}, images.Docker),
+		"Runtime to pre-pull the control plane and CNI images with on masters (docker / cri / none) (defaults: KMM_IMAGE_RUNTIME, "+images.Docker+")")
+	RootCmd.PersistentFlags().String(
+		"image-runtime-endpoint",
+		os.Getenv("KMM_IMAGE_RUNTIME_ENDPOINT"),
+		"Socket of the image runtime e.g. unix:///run/containerd/containerd.sock (defaults: KMM_IMAGE_RUNTIME_ENDPOINT, the runtime default)")
+	RootCmd.PersistentFlags().Bool(
+		"pin-image-digests",
+		false,
+		"Run the control plane, DNS and CNI images by the digests the first master resolves their tags to (needs an --image-runtime)")
+	RootCmd.PersistentFlags().String(
+		"lb-target-groups",
+		os.Getenv("KMM_LB_TARGET_GROUPS"),
+		"Load balancer target group ARNs (comma separated) a master registers with once bootstrapped and its api server is healthy, deregistering when stopped (aws only) (defaults: KMM_LB_TARGET_GROUPS)")
+	RootCmd.PersistentFlags().String(
+		"cfn-signal-stack",
+		os.Getenv("KMM_CFN_SIGNAL_STACK"),
+		"The CloudFormation stack sent a SUCCESS or FAILURE signal for this instance once bootstrapped, as cfn-signal does (defaults: KMM_CFN_SIGNAL_STACK)")
+	RootCmd.PersistentFlags().String(
+		"cfn-signal-resource",
+		os.Getenv("KMM_CFN_SIGNAL_RESOURCE"),
+		"The logical id of the --cfn-signal-stack resource waiting for the signal e.g. the auto scaling group (defaults: KMM_CFN_SIGNAL_RESOURCE)")
+	RootCmd.PersistentFlags().String(
+		"lifecycle-hook",
+		os.Getenv("KMM_LIFECYCLE_HOOK"),
+		"The launch lifecycle hook of the auto scaling group completed with CONTINUE once bootstrapped or ABANDON on failure (defaults: KMM_LIFECYCLE_HOOK)")
+	RootCmd.PersistentFlags().String(
+		"signal-region",
+		os.Getenv("KMM_SIGNAL_REGION"),
+		"The region of the --cfn-signal-stack and auto scaling group (defaults: KMM_SIGNAL_REGION, the instance region)")
+	RootCmd.PersistentFlags().String(
+		"lock-backend",
+		getDefaultFromEnvs([]string{"KMM_LOCK_BACKEND"}, lock.BackendEtcd),
+		"Where the primary master lock is kept: etcd, dynamodb://<table> (with a LockKey string partition key) or "+
+			"s3://<bucket>[/<prefix>] (with versioning and object lock), add ?region=<region> for another region "+
+			"(defaults: KMM_LOCK_BACKEND, "+lock.BackendEtcd+")")
+	RootCmd.PersistentFlags().Duration(
+		"lb-health-timeout",
+		kmm.LoadBalancerHealthTimeout,
+		"How long a master waits for its local api server /healthz before registering with the load balancer target groups")
+	RootCmd.PersistentFlags().Duration(
+		"local-api-wait-timeout",
+		kmm.LocalAPIWaitTimeout,
+		"How long the primary master waits for its local api server /healthz and etcd reads through it before deploying the addons and sharing the assets (0 to not wait)")
+	RootCmd.PersistentFlags().Int(
+		"parallelism",
+		3,
+		"How many independent bootstrap steps (e.g. network, keto-tokens and addons) to run at once, 1 to run in order")
+	RootCmd.PersistentFlags().Duration(
+		"post-core-retry-timeout",
+		30*time.Minute,
+		"How long a failed network, keto-tokens or addon step is retried in the background once the control plane is healthy "+
+			"(the assets are still shared), 0 to fail the bootstrap instead")
+	RootCmd.PersistentFlags().String(
+		"failure-cleanup",
+		getDefaultFromEnvs([]string{"KMM_FAILURE_CLEANUP"}, kmm.FailureCleanupKeepForDebug),
+		"What's removed when the primary master fails, the lock is always released: "+kmm.FailureCleanupKeepForDebug+
+			" (keep the files and etcd keys written), "+kmm.FailureCleanupWipeLocal+" (remove the files written to the node) or "+
+			kmm.FailureCleanupWipeAll+" (also remove the assets and etcd keys written by the node) (defaults: KMM_FAILURE_CLEANUP, "+
+			kmm.FailureCleanupKeepForDebug+")")
 	RootCmd.PersistentFlags().Bool(
 		ExitOnCompletionFlagName,
 		false,
@@ -102,6 +525,11 @@ func getKmmConfig(cmd *cobra.Command) (cfg kmm.Config, err error) {
 	if err != nil {
 		return cfg, err
 	}
+	tlsCfg, err := getTLSConfig(cmd)
+	if err != nil {
+		return cfg, err
+	}
+	etcdConfig.TLS = tlsCfg
 	apiServer := cmd.Flag("kube-server").Value.String()
 	var url *url.URL
 	if len(apiServer) > 0 {
@@ -114,25 +542,160 @@ func getKmmConfig(cmd *cobra.Command) (cfg kmm.Config, err error) {
 	if masterHosts, err = GetEtcdHostNames(cmd, []string{}); err != nil {
 		return cfg, err
 	}
+	podSecurityPolicy, _ := cmd.Flags().GetBool("pod-security-policy")
 	kubeadmConfig := kubeadm.Config{
-		APIServer:        url,
-		KubeVersion:      cmd.Flag("kube-version").Value.String(),
-		KubeletID:        cmd.Flag("kube-kubeletid").Value.String(),
-		CloudProvider:    cmd.Flag("cloud-provider").Value.String(),
-		EtcdClientConfig: etcdConfig,
-		MasterCount:      uint(len(masterHosts)),
+		APIServer:         url,
+		KubeVersion:       cmd.Flag("kube-version").Value.String(),
+		KubeletID:         cmd.Flag("kube-kubeletid").Value.String(),
+		CloudProvider:     cmd.Flag("cloud-provider").Value.String(),
+		EtcdClientConfig:  etcdConfig,
+		MasterCount:       uint(len(masterHosts)),
+		PodSecurityPolicy: podSecurityPolicy,
+		HardeningProfile:  cmd.Flag("hardening-profile").Value.String(),
+		TLS:               tlsCfg,
+		PKIFixtureDir:     cmd.Flag("pki-fixture-dir").Value.String(),
+		CaKeyMode:         cmd.Flag("kube-ca-key-mode").Value.String(),
+		JoinMode:          cmd.Flag("master-join-mode").Value.String(),
+		CertificateKey:    cmd.Flag("certificate-key").Value.String(),
+		ComputeJoinMode:   cmd.Flag("join-mode").Value.String(),
+		BootstrapToken:    cmd.Flag("bootstrap-token").Value.String(),
+		KMS: kms.Config{
+			KeyARN: cmd.Flag("kms-key-arn").Value.String(),
+			Image:  cmd.Flag("kms-plugin-image").Value.String(),
+		},
+		ClusterSigningMode: cmd.Flag("cluster-signing-mode").Value.String(),
+	}
+	kubeadmConfig.APIProxy.Port, _ = cmd.Flags().GetInt("api-proxy-port")
+	kubeadmConfig.APIProxy.Image = cmd.Flag("api-proxy-image").Value.String()
+	kubeadmConfig.KubeletServingCerts, _ = cmd.Flags().GetBool("kubelet-serving-certs")
+	setGlobals(cmd)
+	if err = statedir.Link(); err != nil {
+		return cfg, err
+	}
+	if _, err = hardening.Get(kubeadmConfig.HardeningProfile); err != nil {
+		return cfg, err
+	}
+	if err = kubeadm.ValidateCaKeyMode(kubeadmConfig.CaKeyMode); err != nil {
+		return cfg, err
+	}
+	if err = kubeadm.ValidateJoinMode(kubeadmConfig.JoinMode, kubeadmConfig.CertificateKey); err != nil {
+		return cfg, err
+	}
+	if err = kubeadm.ValidateClusterSigningMode(kubeadmConfig.ClusterSigningMode, kubeadmConfig.JoinMode); err != nil {
+		return cfg, err
+	}
+	if err = kubeadmConfig.ValidateKubeletServingCerts(); err != nil {
+		return cfg, err
+	}
+	if err = kubeadm.ValidateComputeJoinMode(kubeadmConfig.ComputeJoinMode); err != nil {
+		return cfg, err
+	}
+	if len(kubeadmConfig.BootstrapToken) > 0 {
+		if err = kubeadm.ValidateBootstrapToken(kubeadmConfig.BootstrapToken); err != nil {
+			return cfg, err
+		}
 	}
 	// False is default if not parsed
 	exitOnCompletion, _ := cmd.Flags().GetBool(ExitOnCompletionFlagName)
+	defaultStorageClass, _ := cmd.Flags().GetBool("default-storage-class")
+	summaryToEtcd, _ := cmd.Flags().GetBool("summary-to-etcd")
+	publishClusterInfo, _ := cmd.Flags().GetBool("publish-cluster-info")
+	publishKubeadmConfig, _ := cmd.Flags().GetBool("publish-kubeadm-config")
+	heartbeatInterval, _ := cmd.Flags().GetDuration("heartbeat-interval")
+	parallelism, _ := cmd.Flags().GetInt("parallelism")
+	postCoreRetryTimeout, _ := cmd.Flags().GetDuration("post-core-retry-timeout")
+	masterPollInterval, _ := cmd.Flags().GetDuration("master-poll-interval")
+	masterWaitDeadline, _ := cmd.Flags().GetDuration("master-wait-deadline")
+	kmm.LoadBalancerHealthTimeout, _ = cmd.Flags().GetDuration("lb-health-timeout")
+	kmm.LocalAPIWaitTimeout, _ = cmd.Flags().GetDuration("local-api-wait-timeout")
+	var etcdDiscovery *kmm.EtcdDiscovery
+	if source := cmd.Flag("etcd-discovery").Value.String(); len(source) > 0 {
+		etcdDiscovery = &kmm.EtcdDiscovery{
+			Source:     source,
+			KubeConfig: cmd.Flag("etcd-discovery-kubeconfig").Value.String(),
+			Scheme:     "http",
+		}
+		if len(etcdConfig.CaFileName) > 0 {
+			etcdDiscovery.Scheme = "https"
+		}
+		etcdDiscovery.Interval, _ = cmd.Flags().GetDuration("etcd-discovery-interval")
+	}
+	etcdStrictIsolation, _ := cmd.Flags().GetBool("etcd-strict-isolation")
+	if etcdStrictIsolation && len(etcdConfig.KeyPrefix) == 0 {
+		return cfg, fmt.Errorf("--etcd-strict-isolation requires an --etcd-key-prefix")
+	}
+	lbTargetGroups := deleteEmpty(strings.Split(cmd.Flag("lb-target-groups").Value.String(), ","))
+	if len(lbTargetGroups) > 0 && kubeadmConfig.CloudProvider != "aws" {
+		return cfg, fmt.Errorf("--lb-target-groups is only supported with the aws cloud provider")
+	}
+	if err = lbregister.ValidateTargetGroups(lbTargetGroups); err != nil {
+		return cfg, err
+	}
+	if err = lock.Validate(cmd.Flag("lock-backend").Value.String()); err != nil {
+		return cfg, err
+	}
+	if err = kmm.ValidateFailureCleanup(cmd.Flag("failure-cleanup").Value.String()); err != nil {
+		return cfg, err
+	}
+	if kmm.CNIPlugins, err = getCNIPlugins(cmd); err != nil {
+		return cfg, err
+	}
+	if err = setHostPrerequisites(cmd); err != nil {
+		return cfg, err
+	}
+	if err = setHostConfig(cmd); err != nil {
+		return cfg, err
+	}
+	if err = setCloudSignal(cmd); err != nil {
+		return cfg, err
+	}
+	imagePuller, err := images.NewPuller(
+		cmd.Flag("image-runtime").Value.String(),
+		cmd.Flag("image-runtime-endpoint").Value.String())
+	if err != nil {
+		return cfg, err
+	}
+	pinImageDigests, _ := cmd.Flags().GetBool("pin-image-digests")
+	if pinImageDigests && imagePuller == nil {
+		return cfg, fmt.Errorf("--pin-image-digests needs an --image-runtime to resolve the digests")
+	}
 	cfg = kmm.Config{
 		ConfigType: kmm.ConfigType{
 			KubeadmCfg:           &kubeadmConfig,
 			KubePersistentCaCert: cmd.Flag("kube-ca-cert").Value.String(),
 			KubePersistentCaKey:  cmd.Flag("kube-ca-key").Value.String(),
 			NetworkProvider:      cmd.Flag("network-provider").Value.String(),
+			MasterBackOffTime:    masterPollInterval,
+			MasterWaitDeadline:   masterWaitDeadline,
 			ExitOnCompletion:     exitOnCompletion,
+			DefaultStorageClass:  defaultStorageClass,
+			StorageClassParams:   cmd.Flag("storage-class-params").Value.String(),
+			EnabledAddons:        deleteEmpty(strings.Split(cmd.Flag("enable-addons").Value.String(), ",")),
+			SummaryToEtcd:        summaryToEtcd,
+			HeartbeatInterval:    heartbeatInterval,
+			Parallelism:          parallelism,
+			PostCoreRetryTimeout: postCoreRetryTimeout,
+			FailureCleanup:       cmd.Flag("failure-cleanup").Value.String(),
+			ImagePuller:          imagePuller,
+			PinImageDigests:      pinImageDigests,
+			NodeDataFile:         cmd.Flag("node-data-file").Value.String(),
+			LBTargetGroups:       lbTargetGroups,
+			EtcdStrictIsolation:  etcdStrictIsolation,
+			PublishClusterInfo:   publishClusterInfo,
+			PublishKubeadmConfig: publishKubeadmConfig,
+			EtcdDiscovery:        etcdDiscovery,
+			LockBackend:          cmd.Flag("lock-backend").Value.String(),
 		},
 	}
+	fileCfg, err := loadFileConfig(cmd, userDataConfig)
+	if err != nil {
+		return cfg, err
+	}
+	if fileCfg != nil {
+		if err = cfg.ApplyFileConfig(fileCfg); err != nil {
+			return cfg, err
+		}
+	}
 	var np network.Provider
 	if np, err = network.CreateProvider(cfg.NetworkProvider); err != nil {
 		return cfg, err
@@ -147,3 +710,55 @@ func getKmmConfig(cmd *cobra.Command) (cfg kmm.Config, err error) {
 	}
 	return cfg, nil
 }
+
+// setGlobals will set the package settings used when running with a kmm (or kubeadm) config
+func setGlobals(cmd *cobra.Command) {
+	artifacts.Dir = cmd.Flag("artifacts-dir").Value.String()
+	backup.Dir = cmd.Flag("backup-dir").Value.String()
+	backup.Retention, _ = cmd.Flags().GetInt("backup-retention")
+	backup.IncludeKeys, _ = cmd.Flags().GetBool("backup-keys")
+	selinux.FileType = cmd.Flag("selinux-file-type").Value.String()
+	statedir.Dir = cmd.Flag("state-dir").Value.String()
+	statedir.Paths = deleteEmpty(strings.Split(cmd.Flag("state-paths").Value.String(), ","))
+	kmm.KubeletUnitFile = cmd.Flag("kubelet-unit-file").Value.String()
+	drift.CheckInterval, _ = cmd.Flags().GetDuration("drift-check-interval")
+	secprofile.Enabled, _ = cmd.Flags().GetBool("runtime-security-profiles")
+}
+
+// pluginArgs returns the global flags set for a command to pass on to the kubeadm plugin
+// The status server isn't started by the plugin (the address is already in use)
+func pluginArgs(cmd *cobra.Command) []string {
+	args := []string{}
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if RootCmd.PersistentFlags().Lookup(f.Name) == nil || strings.HasPrefix(f.Name, "status-") {
+			return
+		}
+		// Slice flags render as [a,b] so are passed once per element
+		var values []string
+		switch f.Value.Type() {
+		case "stringSlice":
+			values, _ = cmd.Flags().GetStringSlice(f.Name)
+		case "stringArray":
+			values, _ = cmd.Flags().GetStringArray(f.Name)
+		default:
+			if strings.HasSuffix(f.Value.Type(), "Slice") {
+				values = strings.Split(strings.Trim(f.Value.String(), "[]"), ",")
+			} else {
+				values = []string{f.Value.String()}
+			}
+		}
+		for _, value := range values {
+			args = append(args, "--"+f.Name+"="+value)
+		}
+	})
+	return args
+}
+
+// getTLSConfig will return the validated TLS settings
+func getTLSConfig(cmd *cobra.Command) (tlsconfig.Config, error) {
+	tlsCfg := tlsconfig.Config{
+		MinVersion:   cmd.Flag("tls-min-version").Value.String(),
+		CipherSuites: deleteEmpty(strings.Split(cmd.Flag("tls-cipher-suites").Value.String(), ",")),
+	}
+	return tlsCfg, tlsCfg.Validate()
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm"
+	"github.com/spf13/cobra"
+)
+
+// kubeadmPluginCmd runs the kubeadm phases for a slim build
+var kubeadmPluginCmd = &cobra.Command{
+	Use:    kubeadm.PluginCommand + " [phase]",
+	Short:  "Runs a kubeadm phase for a slim build",
+	Long:   "Runs a kubeadm phase (manifests, addons, master-role or upload-config) with the kubeadm config (json) read from stdin",
+	Hidden: true,
+	Run: func(c *cobra.Command, args []string) {
+		runKubeadmPlugin(c, args)
+	},
+}
+
+func runKubeadmPlugin(c *cobra.Command, args []string) {
+	if len(args) != 1 {
+		log.Fatalf("expecting a single kubeadm phase e.g. %s", kubeadm.PluginManifests)
+	}
+	var cfg kubeadm.Config
+	if err := json.NewDecoder(os.Stdin).Decode(&cfg); err != nil {
+		log.Fatalf("error reading the kubeadm config: %v", err)
+	}
+	setGlobals(c)
+	if err := cfg.RunPhase(args[0]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(kubeadmPluginCmd)
+}
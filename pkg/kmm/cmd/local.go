@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/UKHomeOffice/keto-k8/pkg/etcd"
+	"github.com/UKHomeOffice/keto-k8/pkg/kmm"
+	"github.com/spf13/cobra"
+)
+
+// LocalSubCommand is the sub command syntax
+const LocalSubCommand string = "local"
+
+// localCmd represents the local command
+var localCmd = &cobra.Command{
+	Use:   LocalSubCommand,
+	Short: "Will bootstrap a single node local cluster",
+	Long: "Will bootstrap a single node cluster with an embedded etcd and a self signed CA (without a cloud provider) " +
+		"e.g. to test the full bootstrap on a laptop or in CI. Not for production use.",
+	Run: func(c *cobra.Command, args []string) {
+		if err := runLocal(c); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func runLocal(c *cobra.Command) error {
+	dir := c.Flag("local-dir").Value.String()
+	clientURL := c.Flag("local-etcd-client-url").Value.String()
+
+	// The embedded etcd is always used unless another is specified explicitly
+	if !c.Flag("etcd-endpoints").Changed {
+		if err := c.Flag("etcd-endpoints").Value.Set(clientURL); err != nil {
+			return err
+		}
+	}
+	// Local defaults for anything not set (by flag or environment)
+	if err := setDefaultFlags(c, map[string]string{
+		"etcd-cluster-hostnames": "127.0.0.1",
+		"kube-ca-cert":           filepath.Join(dir, "kube-ca.crt"),
+		"kube-ca-key":            filepath.Join(dir, "kube-ca.key"),
+		"kube-server":            "https://127.0.0.1:6443",
+	}); err != nil {
+		return err
+	}
+	if c.Flag("kube-version").Value.String() == "" && c.Flag("node-data-file").Value.String() == "" {
+		return fmt.Errorf("--kube-version or --node-data-file must be specified for a local cluster")
+	}
+
+	embedded, err := etcd.StartEmbedded(filepath.Join(dir, "etcd"), clientURL, c.Flag("local-etcd-peer-url").Value.String())
+	if err != nil {
+		return err
+	}
+	defer embedded.Stop()
+
+	if err = kmm.EnsureLocalCA(c.Flag("kube-ca-cert").Value.String(), c.Flag("kube-ca-key").Value.String()); err != nil {
+		return err
+	}
+	cfg, err := getKmmConfig(c)
+	if err != nil {
+		return err
+	}
+	return kmm.New(cfg).CreateOrGetSharedAssets()
+}
+
+// setDefaultFlags will set any empty flag values
+func setDefaultFlags(c *cobra.Command, defaults map[string]string) error {
+	for name, value := range defaults {
+		flag := c.Flag(name)
+		if flag.Value.String() != "" {
+			continue
+		}
+		if err := flag.Value.Set(value); err != nil {
+			return fmt.Errorf("error setting --%s to %s [%v]", name, value, err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	localCmd.Flags().String(
+		"local-dir",
+		getDefaultFromEnvs([]string{"KMM_LOCAL_DIR"}, "/var/lib/keto-k8/local"),
+		"Directory for the local etcd data and self signed CA (defaults: KMM_LOCAL_DIR)")
+	localCmd.Flags().String(
+		"local-etcd-client-url",
+		"http://127.0.0.1:2379",
+		"Client URL for the embedded etcd")
+	localCmd.Flags().String(
+		"local-etcd-peer-url",
+		"http://127.0.0.1:2380",
+		"Peer URL for the embedded etcd")
+	RootCmd.AddCommand(localCmd)
+}
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"os"
+
 	log "github.com/Sirupsen/logrus"
 
 	"github.com/UKHomeOffice/keto-k8/pkg/kmm"
@@ -27,7 +29,10 @@ func runKmm(c *cobra.Command) {
 		log.Fatal(err)
 	}
 	k := kmm.New(cfg)
-	if err = k.CreateOrGetSharedAssets(); err != nil {
+	if err = k.CreateOrGetSharedAssets(); err == kmm.ErrAssetsWaitDeadline {
+		log.Error(err)
+		os.Exit(kmm.ExitCodeAssetsWaitDeadline)
+	} else if err != nil {
 		log.Fatal(err)
 	}
 	return
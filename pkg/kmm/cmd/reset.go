@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/UKHomeOffice/keto-k8/pkg/kmm"
+	"github.com/spf13/cobra"
+)
+
+// resetCmd removes the files written to a node
+var resetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Remove the PKI, kubeconfigs and manifests written to this node",
+	Long: "Remove the PKI, kubeconfigs, static pod manifests and other config written to this node. Key material is " +
+		"overwritten before it's removed (a linked CA key is only unlinked) and purged from the backups unless " +
+		"--keep-key-backups is set",
+	Run: func(c *cobra.Command, args []string) {
+		setGlobals(c)
+		keep, _ := c.Flags().GetBool("keep-key-backups")
+		if err := kmm.Reset(keep); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	resetCmd.Flags().Bool("keep-key-backups", false, "Keep the key material in the backups")
+	RootCmd.AddCommand(resetCmd)
+}
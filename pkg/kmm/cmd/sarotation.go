@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/UKHomeOffice/keto-k8/pkg/kmm"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm"
+	"github.com/spf13/cobra"
+)
+
+// saRotationCmd groups the commands to rotate the service account key across the masters
+var saRotationCmd = &cobra.Command{
+	Use:   "sa-rotation",
+	Short: "Rotate the service account key across the masters",
+	Long: "Rotate the service account signing key in phases coordinated through etcd: trust (the apiservers trust the " +
+		"new key alongside the old one), sign (the controller-managers sign tokens with the new key) and complete (the " +
+		"new key replaces the old key in the shared assets, the old key is no longer trusted). Each master applies the " +
+		"current phase when kmm is restarted, advance to the next phase once they all have",
+}
+
+var saRotationStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start a service account key rotation with a new key",
+	Run: func(c *cobra.Command, args []string) {
+		if err := startSARotation(c); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var saRotationAdvanceCmd = &cobra.Command{
+	Use:   "advance",
+	Short: "Move the service account key rotation to its next phase",
+	Long: "Move the service account key rotation to its next phase once every master has applied the current phase " +
+		"(or with --force), the rotation is finished after the complete phase",
+	Run: func(c *cobra.Command, args []string) {
+		if err := advanceSARotation(c); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var saRotationStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the service account key rotation phase applied by each master",
+	Run: func(c *cobra.Command, args []string) {
+		if err := saRotationStatus(c); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func startSARotation(c *cobra.Command) error {
+	client, err := getBundleEtcdClient(c)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if err = kmm.StartSARotation(client, c.Flag("new-sa-key").Value.String()); err != nil {
+		return err
+	}
+	log.Printf("Started the service account key rotation, restart kmm on each master to apply the %s phase",
+		kubeadm.SARotationTrust)
+	return nil
+}
+
+func advanceSARotation(c *cobra.Command) error {
+	client, err := getBundleEtcdClient(c)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	force, _ := c.Flags().GetBool("force")
+	phase, err := kmm.AdvanceSARotation(client, force)
+	if err != nil {
+		return err
+	}
+	if len(phase) == 0 {
+		log.Printf("The service account key rotation is finished")
+		return nil
+	}
+	log.Printf("Advanced the service account key rotation, restart kmm on each master to apply the %s phase", phase)
+	return nil
+}
+
+func saRotationStatus(c *cobra.Command) error {
+	client, err := getBundleEtcdClient(c)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	r, err := kmm.GetSARotation(client)
+	if err != nil {
+		return err
+	}
+	if r == nil {
+		fmt.Println("No service account key rotation in progress")
+		return nil
+	}
+	nodes, err := kmm.SARotationNodes(client)
+	if err != nil {
+		return err
+	}
+	pending, err := kmm.PendingSARotation(client, r)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Phase: %s (since %s ago)\n", r.Phase, time.Since(r.Updated)/time.Second*time.Second)
+	fmt.Printf("Pending: %s\n", strings.Join(pending, ", "))
+	names := make([]string, 0, len(nodes))
+	for node := range nodes {
+		names = append(names, node)
+	}
+	sort.Strings(names)
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tAPPLIED PHASE")
+	for _, node := range names {
+		fmt.Fprintf(w, "%s\t%s\n", node, nodes[node])
+	}
+	return w.Flush()
+}
+
+func init() {
+	saRotationStartCmd.Flags().String("new-sa-key", "", "The new service account RSA key (a new key is generated if not specified)")
+	saRotationAdvanceCmd.Flags().Bool("force", false, "Advance even when some masters haven't applied the current phase")
+	saRotationCmd.AddCommand(saRotationStartCmd, saRotationAdvanceCmd, saRotationStatusCmd)
+	RootCmd.AddCommand(saRotationCmd)
+}
@@ -5,10 +5,18 @@ import (
 	"net"
 	"net/url"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/UKHomeOffice/keto-k8/pkg/cloudsignal"
 	"github.com/UKHomeOffice/keto-k8/pkg/etcd"
+	"github.com/UKHomeOffice/keto-k8/pkg/hostconfig"
+	"github.com/UKHomeOffice/keto-k8/pkg/kmm"
+	"github.com/UKHomeOffice/keto-k8/pkg/network"
+	"github.com/UKHomeOffice/keto-k8/pkg/prereq"
 )
 
 // EtcdCertsCmdName the command name to use to invoke kmm for generating etcd certs
@@ -22,6 +30,21 @@ func getEtcdClientConfig(cmd *cobra.Command) (cfg etcd.Client, err error) {
 		CaFileName: 		cmd.Flag("etcd-client-ca").Value.String(),
 		ClientCertFileName:	cmd.Flag("etcd-client-cert").Value.String(),
 		ClientKeyFileName:	cmd.Flag("etcd-client-key").Value.String(),
+		KeyPrefix:		cmd.Flag("etcd-key-prefix").Value.String(),
+	}
+	if err = etcd.ValidateKeyPrefix(etcdConfig.KeyPrefix); err != nil {
+		return cfg, err
+	}
+
+	// The endpoints are discovered from a management cluster instead e.g. for an etcd-operator cluster
+	if discovery := cmd.Flag("etcd-discovery").Value.String(); len(discovery) > 0 && cmd.Use != EtcdCertsCmdName {
+		scheme := "http"
+		if len(etcdConfig.CaFileName) > 0 {
+			scheme = "https"
+		}
+		if etcdConfig.Endpoints, err = etcd.Discover(cmd.Flag("etcd-discovery-kubeconfig").Value.String(), discovery, scheme); err != nil {
+			return cfg, err
+		}
 	}
 
 	if len(etcdConfig.CaFileName) > 0 {
@@ -87,6 +110,131 @@ func GetHostNamesFromUrls(urls string, minimalDefault []string) ([]string, error
 	return hosts, nil
 }
 
+// getCNIPlugins returns the validated CNI plugins to install (nil when not installing them)
+func getCNIPlugins(cmd *cobra.Command) (*network.Plugins, error) {
+	if install, _ := cmd.Flags().GetBool("install-cni-plugins"); !install {
+		return nil, nil
+	}
+	provider, err := network.CreateProvider(cmd.Flag("network-provider").Value.String())
+	if err != nil {
+		return nil, err
+	}
+	plugins := &network.Plugins{
+		URL:    cmd.Flag("cni-plugins-url").Value.String(),
+		SHA256: cmd.Flag("cni-plugins-sha256").Value.String(),
+		Names:  network.PluginNames(provider),
+	}
+	return plugins, plugins.Validate()
+}
+
+// setHostPrerequisites will set how missing host prerequisites (clock skew and low disk) are dealt with
+func setHostPrerequisites(cmd *cobra.Command) error {
+	prereq.Mode = cmd.Flag("host-prerequisites").Value.String()
+	prereq.NetworkProvider = cmd.Flag("network-provider").Value.String()
+	prereq.NTPServer = cmd.Flag("ntp-server").Value.String()
+	prereq.MaxClockSkew, _ = cmd.Flags().GetDuration("max-clock-skew")
+	prereq.MinFreeDiskMB, _ = cmd.Flags().GetUint64("min-free-disk-mb")
+	prereq.MinFreeInodes, _ = cmd.Flags().GetUint64("min-free-inodes")
+	for _, flag := range []string{"etcd-client-ca", "etcd-client-cert", "etcd-client-key"} {
+		if file := cmd.Flag(flag).Value.String(); len(file) > 0 {
+			prereq.DiskPaths = append(prereq.DiskPaths, filepath.Dir(file))
+		}
+	}
+	return prereq.ValidateMode(prereq.Mode)
+}
+
+// setHostConfig will set the kernel modules and sysctls configured before the kubelet starts
+func setHostConfig(cmd *cobra.Command) error {
+	hostconfig.Enabled, _ = cmd.Flags().GetBool("configure-host")
+	hostconfig.NetworkProvider = cmd.Flag("network-provider").Value.String()
+	hostconfig.ConntrackMax, _ = cmd.Flags().GetInt("conntrack-max")
+	hostconfig.Sysctls = map[string]string{}
+	for _, sysctl := range deleteEmpty(strings.Split(cmd.Flag("host-sysctls").Value.String(), ",")) {
+		kv := strings.SplitN(strings.TrimSpace(sysctl), "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid --host-sysctls %q, must be key=value", sysctl)
+		}
+		hostconfig.Sysctls[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return hostconfig.Validate()
+}
+
+// setCloudSignal will set the CloudFormation stack and lifecycle hook signalled with the bootstrap result
+func setCloudSignal(cmd *cobra.Command) error {
+	cloudsignal.Stack = cmd.Flag("cfn-signal-stack").Value.String()
+	cloudsignal.Resource = cmd.Flag("cfn-signal-resource").Value.String()
+	cloudsignal.LifecycleHook = cmd.Flag("lifecycle-hook").Value.String()
+	cloudsignal.Region = cmd.Flag("signal-region").Value.String()
+	return cloudsignal.Validate()
+}
+
+// applyUserData will set the flags in the keto-k8 section of the user data (--user-data) which aren't set on the
+// command line and returns its config file sections (nil without user data)
+func applyUserData(cmd *cobra.Command) (*kmm.FileConfig, error) {
+	source := cmd.Flag("user-data").Value.String()
+	if len(source) == 0 {
+		return nil, nil
+	}
+	ud, err := kmm.LoadUserData(source)
+	if err != nil || ud == nil {
+		return nil, err
+	}
+	values, err := ud.FlagValues()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := cmd.Flags().Lookup(name)
+		if f == nil {
+			// The user data can be shared by commands e.g. the setup-compute flags when running kmm on a master
+			if !isCommandFlag(cmd.Root(), name) {
+				return nil, fmt.Errorf("unknown flag %q in the %s user data", name, source)
+			}
+			log.Debugf("--%s isn't a %s flag, ignoring the %s user data value", name, cmd.Name(), source)
+			continue
+		}
+		if f.Changed {
+			log.Debugf("--%s is set, ignoring the %s user data value", name, source)
+			continue
+		}
+		if err = cmd.Flags().Set(name, values[name]); err != nil {
+			return nil, fmt.Errorf("invalid --%s in the %s user data [%v]", name, source, err)
+		}
+	}
+	log.Printf("Using %d flags and the config from the %s user data", len(names), source)
+	return &ud.FileConfig, nil
+}
+
+// isCommandFlag is true when any command has the flag
+func isCommandFlag(cmd *cobra.Command, name string) bool {
+	if cmd.Flags().Lookup(name) != nil || cmd.PersistentFlags().Lookup(name) != nil {
+		return true
+	}
+	for _, c := range cmd.Commands() {
+		if isCommandFlag(c, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadFileConfig returns the --config file with any sections it doesn't set from the user data (nil with neither)
+func loadFileConfig(cmd *cobra.Command, userDataCfg *kmm.FileConfig) (*kmm.FileConfig, error) {
+	var fileCfg *kmm.FileConfig
+	if configFile := cmd.Flag("config").Value.String(); len(configFile) > 0 {
+		var err error
+		if fileCfg, err = kmm.LoadFileConfig(configFile); err != nil {
+			return nil, err
+		}
+	}
+	return kmm.MergeFileConfig(fileCfg, userDataCfg)
+}
+
 func deleteEmpty (s []string) []string {
 	var r []string
 	for _, str := range s {
@@ -2,9 +2,15 @@ package cmd
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/kmm"
+	"github.com/spf13/cobra"
 )
 
 func TestGetHostNamesFromUrls(t *testing.T) {
@@ -61,6 +67,47 @@ func TestGetUrlsFromInitialClusterString(t *testing.T) {
 
 }
 
+func TestUserDataPreRunFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kmm-user-data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	userData := filepath.Join(dir, "user-data.txt")
+	// api-wait-timeout is a setup-compute flag, ignored when running another command
+	content := "#cloud-config\nketo-k8:\n  flags:\n    output: json\n    api-wait-timeout: 1m\n"
+	if err = ioutil.WriteFile(userData, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		kmm.OutputJSON = false
+		for _, name := range []string{"output", "user-data"} {
+			f := RootCmd.PersistentFlags().Lookup(name)
+			f.Value.Set(f.DefValue)
+			f.Changed = false
+		}
+		RootCmd.SetArgs(nil)
+	}()
+
+	// --output is used before any command runs so must be set from the user data first
+	RootCmd.SetArgs([]string{"version", "--user-data", userData})
+	if err = RootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if !kmm.OutputJSON {
+		t.Error("expected the json output from the user data to be used")
+	}
+
+	content = "keto-k8:\n  flags:\n    no-such-flag: true\n"
+	if err = ioutil.WriteFile(userData, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	RootCmd.SetArgs([]string{"version", "--user-data", userData})
+	if err = RootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "no-such-flag") {
+		t.Errorf("expected an unknown flag error but got %v", err)
+	}
+}
+
 func testAString(initialString string, expectedString string, expectdNumber int) (error) {
 	urls, err := GetUrlsFromInitialClusterString(initialString)
 	if err != nil {
@@ -82,3 +129,25 @@ func testAString(initialString string, expectedString string, expectdNumber int)
 	}
 	return nil
 }
+
+func TestPluginArgs(t *testing.T) {
+	RootCmd.PersistentFlags().StringSlice("test-plugin-slice", nil, "")
+	RootCmd.PersistentFlags().String("test-plugin-string", "", "")
+	cmd := &cobra.Command{Use: "test"}
+	cmd.Flags().AddFlagSet(RootCmd.PersistentFlags())
+	cmd.Flags().String("test-local", "", "")
+	for name, value := range map[string]string{
+		"test-plugin-slice":  "a,b",
+		"test-plugin-string": "c",
+		"test-local":         "d",
+	} {
+		if err := cmd.Flags().Set(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	args := strings.Join(pluginArgs(cmd), " ")
+	expected := "--test-plugin-slice=a --test-plugin-slice=b --test-plugin-string=c"
+	if args != expected {
+		t.Errorf("expected the plugin args %q but got %q", expected, args)
+	}
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/UKHomeOffice/keto-k8/pkg/artifacts"
+	"github.com/UKHomeOffice/keto-k8/pkg/drift"
+	"github.com/spf13/cobra"
+)
+
+// verifyCmd reports configuration drift on a node
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Report files modified or removed since they were written",
+	Long: "Compare the files written to this node with the checksums recorded at the end of the bootstrap " +
+		"(the " + drift.ArtifactName + " artifact) and list any modified or removed out-of-band, exits 1 when any have changed",
+	Run: func(c *cobra.Command, args []string) {
+		verify(c)
+	},
+}
+
+func verify(c *cobra.Command) {
+	setGlobals(c)
+	file := artifacts.Path(drift.ArtifactName)
+	changes, err := drift.Verify(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+	if len(changes) > 0 {
+		os.Exit(1)
+	}
+	log.Printf("No files changed since they were recorded in %s", file)
+}
+
+func init() {
+	RootCmd.AddCommand(verifyCmd)
+}
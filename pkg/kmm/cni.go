@@ -0,0 +1,15 @@
+package kmm
+
+import "github.com/UKHomeOffice/keto-k8/pkg/network"
+
+// CNIPlugins are installed on masters and compute nodes before the kubelet starts (nil to not install any), the
+// provider DaemonSets only install their own plugin so the ones they delegate to must already be on the host
+var CNIPlugins *network.Plugins
+
+// installCNIPlugins will install the CNI plugins when set
+func installCNIPlugins() error {
+	if CNIPlugins == nil {
+		return nil
+	}
+	return CNIPlugins.Install()
+}
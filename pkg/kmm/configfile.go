@@ -0,0 +1,238 @@
+package kmm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/addons"
+	"github.com/UKHomeOffice/keto-k8/pkg/audit"
+	"github.com/UKHomeOffice/keto-k8/pkg/authwebhook"
+	"github.com/UKHomeOffice/keto-k8/pkg/certmanager"
+	"github.com/UKHomeOffice/keto-k8/pkg/images"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm"
+	"github.com/UKHomeOffice/keto-k8/pkg/notify"
+	"github.com/UKHomeOffice/keto-k8/pkg/oidc"
+	"github.com/UKHomeOffice/keto-k8/pkg/placement"
+	"github.com/UKHomeOffice/keto-k8/pkg/publish"
+	"github.com/ghodss/yaml"
+)
+
+// FileConfig is the optional yaml configuration file for settings too rich for flags
+type FileConfig struct {
+	// Addons are the template values for each addon (by addon / network provider name) e.g.
+	// addons:
+	//   flannel:
+	//     image: quay.io/coreos/flannel:v0.8.0-amd64
+	// Any nodeSelector, tolerations and affinity values (including for kube-dns) place the addon pods
+	Addons map[string]map[string]interface{} `json:"addons,omitempty"`
+	// Placement is where all the keto-k8 workloads (the CNI, DNS, keto-tokens and addons) are scheduled e.g.
+	// placement:
+	//   tolerations:
+	//   - key: dedicated
+	//     operator: Exists
+	Placement *placement.Placement `json:"placement,omitempty"`
+	// Audit configures an apiserver audit webhook backend e.g.
+	// audit:
+	//   webhook:
+	//     server: https://audit.example.com/events
+	Audit *audit.Config `json:"audit,omitempty"`
+	// OIDC configures the apiserver OpenID Connect authenticator for SSO e.g.
+	// oidc:
+	//   issuerURL: https://sso.example.com/auth/realms/keto
+	//   clientID: kubernetes
+	//   usernameClaim: email
+	//   groupsClaim: groups
+	//   groupsPrefix: "oidc:"
+	OIDC *oidc.Config `json:"oidc,omitempty"`
+	// Webhooks configures apiserver token authentication and authorization webhooks e.g.
+	// webhooks:
+	//   authentication:
+	//     server: https://keto-tokens.example.com/authenticate
+	//     certificateAuthority: /etc/ssl/keto-tokens-ca.pem
+	//     cacheTTL: 2m
+	//   authorization:
+	//     server: https://authz.example.com/authorize
+	//     cacheAuthorizedTTL: 5m
+	//     cacheUnauthorizedTTL: 30s
+	Webhooks *authwebhook.Config `json:"webhooks,omitempty"`
+	// Notifications are the sinks for alerts e.g. bootstrap failures
+	// notifications:
+	//   slack:
+	//     webhookURL: https://hooks.slack.com/services/...
+	Notifications *notify.Config `json:"notifications,omitempty"`
+	// Kubelet are the kubelet resource reservations and max pods, overridden per node pool (by the pool node label
+	// from the cloud metadata) e.g.
+	// kubelet:
+	//   maxPods: 60
+	//   systemReserved:
+	//     memory: 500Mi
+	//   evictionHard:
+	//     memory.available: 200Mi
+	//   pools:
+	//     gpu:
+	//       maxPods: 20
+	Kubelet *kubeadm.KubeletConfig `json:"kubelet,omitempty"`
+	// NodePools are the compute node profiles, the first matching the node labels is used e.g.
+	// nodePools:
+	// - name: gpu
+	//   match:
+	//     pool: gpu
+	//   taints:
+	//     dedicated: gpu:NoSchedule
+	//   gpu: nvidia
+	//   kubelet:
+	//     maxPods: 20
+	NodePools []NodePool `json:"nodePools,omitempty"`
+	// Publish is where the primary master publishes the admin (or an operator) kubeconfig e.g.
+	// publish:
+	//   kmsKeyID: alias/keto-k8
+	//   s3:
+	//     bucket: my-cluster-access
+	//   operator:
+	//     clusterRole: view
+	Publish *publish.Config `json:"publish,omitempty"`
+	// CertManager hands certificate issuance to cert-manager once bootstrapped, the cert-manager addon is deployed with
+	// a CA ClusterIssuer for the cluster CA (or an intermediate signed by it) e.g.
+	// certManager:
+	//   issuer: keto-ca
+	//   intermediate: true
+	CertManager *certmanager.Config `json:"certManager,omitempty"`
+	// ExtraVolumes are host paths mounted into the apiserver and controller manager static pods, the files must already
+	// be on the masters e.g.
+	// extraVolumes:
+	//   apiServer:
+	//   - name: audit-log
+	//     hostPath: /var/log/kubernetes/audit
+	//     mountPath: /var/log/kubernetes/audit
+	//     pathType: DirectoryOrCreate
+	//   controllerManager:
+	//   - name: cloud-config
+	//     hostPath: /etc/kubernetes/cloud.conf
+	//     mountPath: /etc/kubernetes/cloud.conf
+	//     readOnly: true
+	ExtraVolumes *kubeadm.ExtraVolumes `json:"extraVolumes,omitempty"`
+	// ImageDigests pin the control plane, DNS and CNI images (by the image they replace) to a digest e.g.
+	// imageDigests:
+	//   gcr.io/google_containers/kube-apiserver-amd64:v1.10.3: sha256:<hex>
+	ImageDigests map[string]string `json:"imageDigests,omitempty"`
+	// StaticPodLogs is how the control plane static pods log, to files under a host directory (for a log shipper) and
+	// the container log rotation e.g.
+	// staticPodLogs:
+	//   dir: /var/log/kubernetes
+	//   alsoToStderr: true
+	//   maxSizeMB: 100
+	//   maxFiles: 5
+	StaticPodLogs *kubeadm.StaticPodLogs `json:"staticPodLogs,omitempty"`
+}
+
+// LoadFileConfig will parse a configuration file
+func LoadFileConfig(fileName string) (*FileConfig, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file %q [%v]", fileName, err)
+	}
+	cfg := &FileConfig{}
+	if err = yaml.Unmarshal(b, cfg); err != nil {
+		return nil, fmt.Errorf("error parsing config file %q [%v]", fileName, err)
+	}
+	if err = cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("error in config file %q [%v]", fileName, err)
+	}
+	return cfg, nil
+}
+
+// Validate will check each section of the configuration
+func (fc *FileConfig) Validate() error {
+	if err := fc.Kubelet.Validate(); err != nil {
+		return err
+	}
+	if err := ValidateNodePools(fc.NodePools); err != nil {
+		return err
+	}
+	if err := fc.Webhooks.Validate(); err != nil {
+		return err
+	}
+	if err := fc.Publish.Validate(); err != nil {
+		return err
+	}
+	if err := fc.ExtraVolumes.Validate(); err != nil {
+		return err
+	}
+	if err := images.ValidateDigests(fc.ImageDigests); err != nil {
+		return err
+	}
+	if err := fc.StaticPodLogs.Validate(); err != nil {
+		return err
+	}
+	if err := fc.Placement.Validate(); err != nil {
+		return fmt.Errorf("placement: %v", err)
+	}
+	for name, values := range fc.Addons {
+		if _, err := placement.FromValues(values); err != nil {
+			return fmt.Errorf("addon %q: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// MergeFileConfig returns the configuration with any sections it doesn't set taken from the defaults (either may be
+// nil) e.g. a config file with the sections from the user data
+func MergeFileConfig(fc, defaults *FileConfig) (*FileConfig, error) {
+	if fc == nil || defaults == nil {
+		if fc == nil {
+			return defaults, nil
+		}
+		return fc, nil
+	}
+	sections := map[string]json.RawMessage{}
+	for _, c := range []*FileConfig{defaults, fc} {
+		b, err := json.Marshal(c)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(b, &sections); err != nil {
+			return nil, err
+		}
+	}
+	b, err := json.Marshal(sections)
+	if err != nil {
+		return nil, err
+	}
+	merged := &FileConfig{}
+	if err = json.Unmarshal(b, merged); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// ApplyFileConfig will set any configuration specified in a config file
+func (c *ConfigType) ApplyFileConfig(fc *FileConfig) error {
+	c.AddonValues = fc.Addons
+	placement.Default = fc.Placement
+	c.Publish = fc.Publish
+	c.CertManager = fc.CertManager
+	if c.CertManager != nil {
+		if !(addons.Config{Enabled: c.EnabledAddons}).IsEnabled(addons.CertManagerAddon) {
+			c.EnabledAddons = append(c.EnabledAddons, addons.CertManagerAddon)
+		}
+		if !c.CertManager.Intermediate && c.KubeadmCfg != nil && c.KubeadmCfg.CaKeyMode == kubeadm.CaKeyEphemeral {
+			return fmt.Errorf("certManager needs an intermediate with the %s CA key mode", kubeadm.CaKeyEphemeral)
+		}
+	}
+	if c.KubeadmCfg != nil {
+		c.KubeadmCfg.Audit = fc.Audit
+		c.KubeadmCfg.OIDC = fc.OIDC
+		c.KubeadmCfg.Webhooks = fc.Webhooks
+		c.KubeadmCfg.Kubelet = fc.Kubelet
+		c.KubeadmCfg.ExtraVolumes = fc.ExtraVolumes
+		c.KubeadmCfg.ImageDigests = fc.ImageDigests
+		c.KubeadmCfg.StaticPodLogs = fc.StaticPodLogs
+		dns, err := placement.For(fc.Addons[kubeadm.DNSAddonName])
+		if err != nil {
+			return fmt.Errorf("addon %q: %v", kubeadm.DNSAddonName, err)
+		}
+		c.KubeadmCfg.DNSPlacement = dns
+	}
+	return notify.Configure(fc.Notifications)
+}
@@ -0,0 +1,67 @@
+package kmm
+
+import (
+	"strings"
+)
+
+// dockerLogDrivers are the docker log drivers rotated by the max-size and max-file log options
+var dockerLogDrivers = []string{"", "json-file", "local"}
+
+// remoteRuntime is true when the kubelet runs containers with a CRI runtime (not docker)
+func (k *Kmm) remoteRuntime() bool {
+	for _, arg := range strings.Fields(k.KubeletExtraArgs) {
+		if arg == "--container-runtime=remote" {
+			return true
+		}
+	}
+	return false
+}
+
+// containerLogArgs returns the kubelet flags rotating the container logs of a CRI runtime
+func (k *Kmm) containerLogArgs() string {
+	if k.KubeadmCfg == nil || !k.remoteRuntime() {
+		return ""
+	}
+	return k.KubeadmCfg.StaticPodLogs.KubeletArgs()
+}
+
+// setupContainerLogRotation will add the log rotation to the docker config (a CRI runtime is rotated by the kubelet),
+// docker is only restarted when the config has changed
+func (k *Kmm) setupContainerLogRotation() error {
+	if k.KubeadmCfg == nil || !k.KubeadmCfg.StaticPodLogs.Rotated() || k.remoteRuntime() {
+		return nil
+	}
+	config, _, err := readDockerConfig()
+	if err != nil {
+		return err
+	}
+	driver, _ := config["log-driver"].(string)
+	if !rotatedLogDriver(driver) {
+		logger.Warnf("Container logs not rotated, the docker %s log driver doesn't support rotation", driver)
+		return nil
+	}
+	changed, err := updateDockerConfig("the container log rotation", func(config map[string]interface{}) {
+		opts, _ := config["log-opts"].(map[string]interface{})
+		if opts == nil {
+			opts = map[string]interface{}{}
+		}
+		for name, value := range k.KubeadmCfg.StaticPodLogs.DockerLogOpts() {
+			opts[name] = value
+		}
+		config["log-opts"] = opts
+	})
+	if err != nil || !changed || k.SkipKubeletStart {
+		return err
+	}
+	return restartDocker("the container log rotation")
+}
+
+// rotatedLogDriver is true for a docker log driver rotated by the log options
+func rotatedLogDriver(driver string) bool {
+	for _, d := range dockerLogDrivers {
+		if driver == d {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package kmm
+
+import (
+	"strings"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm"
+	"github.com/UKHomeOffice/keto-k8/pkg/summary"
+)
+
+// updateClusterInfo will publish the kube-public cluster-info so kubeadm token discovery (and any tooling relying on
+// it) works, every master updates it so it follows a kube CA rotation
+func (k *ConfigType) updateClusterInfo() error {
+	if !k.PublishClusterInfo {
+		return nil
+	}
+	resources, hashes, err := k.KubeadmCfg.ClusterInfo()
+	if err != nil {
+		return err
+	}
+	if err = k.K8Client.Apply(resources); err != nil {
+		return err
+	}
+	summary.Update(func(s *summary.Summary) {
+		s.CACertHashes = hashes
+	})
+	logger.Printf("Published the %s/%s, discovery CA cert hashes: %s",
+		kubeadm.ClusterInfoNamespace, kubeadm.ClusterInfoName, strings.Join(hashes, ","))
+	return nil
+}
+
+// uploadKubeadmConfig will write the kubeadm-config and kubelet-config configmaps so kubeadm upgrade plan (and other
+// tooling expecting a kubeadm built cluster) works, every master updates them to advertise its api server
+func (k *ConfigType) uploadKubeadmConfig() error {
+	if !k.PublishKubeadmConfig {
+		return nil
+	}
+	if !kubeadm.UploadConfigSupported(k.KubeadmCfg.KubeVersion) {
+		logger.Printf("Not uploading the kubeadm config, kubeadm only reads it from v1.13 (not %s)", k.KubeadmCfg.KubeVersion)
+		return nil
+	}
+	if err := k.KubeadmCfg.UploadConfig(); err != nil {
+		return err
+	}
+	logger.Printf("Uploaded the kubeadm config to kube-system/%s", kubeadm.KubeadmConfigName)
+	return nil
+}
+
+// createBootstrapToken will create the bootstrap token compute nodes join with in the token join mode (when the token
+// is set on the masters, otherwise tokens are created with kubeadm token create)
+func (k *ConfigType) createBootstrapToken() error {
+	if !k.KubeadmCfg.TokenJoin() || len(k.KubeadmCfg.BootstrapToken) == 0 {
+		return nil
+	}
+	secret, err := kubeadm.BootstrapTokenSecret(k.KubeadmCfg.BootstrapToken)
+	if err != nil {
+		return err
+	}
+	if err = k.K8Client.Apply(secret); err != nil {
+		return err
+	}
+	logger.Printf("Created the bootstrap token for compute nodes to join with")
+	return nil
+}
@@ -0,0 +1,64 @@
+package kmm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+	"github.com/coreos/go-systemd/dbus"
+)
+
+// updateDockerConfig will change the docker config (keeping any other config) and returns true when it has changed
+func updateDockerConfig(reason string, update func(config map[string]interface{})) (bool, error) {
+	config, current, err := readDockerConfig()
+	if err != nil {
+		return false, err
+	}
+	update(config)
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	data = append(data, '\n')
+	if bytes.Equal(current, data) {
+		return false, nil
+	}
+	logger.Printf("Adding %s to %s", reason, DockerDaemonConfig)
+	return true, fileutil.WriteFile(DockerDaemonConfig, data, 0644)
+}
+
+// readDockerConfig returns the parsed docker config and its contents (empty when there isn't one)
+func readDockerConfig() (map[string]interface{}, []byte, error) {
+	config := map[string]interface{}{}
+	current, err := ioutil.ReadFile(DockerDaemonConfig)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	if len(bytes.TrimSpace(current)) > 0 {
+		if err = json.Unmarshal(current, &config); err != nil {
+			return nil, nil, fmt.Errorf("invalid docker config %s [%v]", DockerDaemonConfig, err)
+		}
+	}
+	return config, current, nil
+}
+
+// restartDocker will restart docker so it reads a changed config (docker only reads its config when it starts)
+func restartDocker(reason string) error {
+	conn, err := dbus.New()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	reschan := make(chan string)
+	logger.Printf("Restarting %s for %s", dockerUnit, reason)
+	if _, err = conn.RestartUnit(dockerUnit, "replace", reschan); err != nil {
+		return fmt.Errorf("Can't restart unit [%v] - [%v]", dockerUnit, err)
+	}
+	if job := <-reschan; job != "done" {
+		return fmt.Errorf("Error restarting [%v] (%s)", dockerUnit, job)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package kmm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/artifacts"
+	"github.com/UKHomeOffice/keto-k8/pkg/drift"
+	"github.com/UKHomeOffice/keto-k8/pkg/notify"
+)
+
+// RecordWrittenFiles will save the checksums of every file written to this node so drift can be detected
+func (k *ConfigType) RecordWrittenFiles() error {
+	if k.KubeadmCfg == nil {
+		return nil
+	}
+	var patterns []string
+	for _, expected := range expectedFiles() {
+		patterns = append(patterns, expected.Pattern)
+	}
+	m, err := drift.Record(artifacts.Path(drift.ArtifactName), patterns...)
+	if err != nil {
+		return fmt.Errorf("failed to record the written files [%v]", err)
+	}
+	logger.Printf("Recorded the checksums of %d written files (see %s)", len(m.Files), artifacts.Path(drift.ArtifactName))
+	return nil
+}
+
+// checkDrift will report files changed out-of-band since they were written
+// Only changes different to the last reported (returned) are notified
+func checkDrift(reported string) string {
+	changes, err := drift.Verify(artifacts.Path(drift.ArtifactName))
+	if err != nil {
+		logger.Warnf("Failed to check the written files: %v", err)
+		return reported
+	}
+	var lines []string
+	for _, c := range changes {
+		lines = append(lines, c.String())
+	}
+	current := strings.Join(lines, ", ")
+	if len(current) == 0 || current == reported {
+		return current
+	}
+	logger.Warnf("Configuration drift detected: %s", current)
+	notify.Send(notify.ConfigDrift, notify.Warning, "written files changed: "+current)
+	return current
+}
@@ -0,0 +1,73 @@
+package kmm
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/etcd"
+	"github.com/UKHomeOffice/keto-k8/pkg/notify"
+)
+
+// EtcdDiscovery re-discovers the etcd endpoints from a management cluster while a master keeps running (see
+// etcd.Discover) so replacing etcd members doesn't need the masters changing by hand
+type EtcdDiscovery struct {
+	// Source is the Service or EtcdCluster the endpoints are discovered from
+	Source string
+	// KubeConfig is for the management cluster
+	KubeConfig string
+	// Scheme of the endpoints (https with client certs)
+	Scheme string
+	// Interval is how often the endpoints are discovered again, 0 to disable
+	Interval time.Duration
+}
+
+// discoverEtcdEndpoints returns the current etcd endpoints (replaced in tests)
+var discoverEtcdEndpoints = etcd.Discover
+
+// enabled is true when the endpoints are discovered again
+func (d *EtcdDiscovery) enabled() bool {
+	return d != nil && len(d.Source) > 0 && d.Interval > 0
+}
+
+// reconcileEtcdEndpoints will re-write the control plane manifests when the discovered etcd endpoints change, the
+// kubelet then restarts the apiserver with the new --etcd-servers (and the kmm etcd client switches over)
+func (k *ConfigType) reconcileEtcdEndpoints() error {
+	d := k.EtcdDiscovery
+	endpoints, err := discoverEtcdEndpoints(d.KubeConfig, d.Source, d.Scheme)
+	if err != nil {
+		return err
+	}
+	current := k.KubeadmCfg.EtcdClientConfig.Endpoints
+	if sameEndpoints(current, endpoints) {
+		return nil
+	}
+	logger.Printf("The etcd endpoints have changed from %s to %s, re-writing the manifests", current, endpoints)
+	k.KubeadmCfg.EtcdClientConfig.Endpoints = endpoints
+	if err = k.Kubeadm.WriteManifests(); err != nil {
+		// Tried again on the next check
+		k.KubeadmCfg.EtcdClientConfig.Endpoints = current
+		notify.Send(notify.ReconcileFailed, notify.Warning, "re-writing the manifests for the etcd endpoints failed: "+err.Error())
+		return err
+	}
+	if c, ok := k.Etcd.(interface {
+		SetEndpoints(endpoints string)
+	}); ok {
+		c.SetEndpoints(endpoints)
+	}
+	if err = k.uploadKubeadmConfig(); err != nil {
+		logger.Warnf("Failed to upload the kubeadm config with the etcd endpoints: %v", err)
+	}
+	// The re-written manifests aren't drift
+	return k.RecordWrittenFiles()
+}
+
+// sameEndpoints is true when two comma separated endpoint lists have the same endpoints (in any order)
+func sameEndpoints(a, b string) bool {
+	sorted := func(endpoints string) string {
+		s := strings.Split(endpoints, ",")
+		sort.Strings(s)
+		return strings.Join(s, ",")
+	}
+	return sorted(a) == sorted(b)
+}
@@ -0,0 +1,110 @@
+package kmm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/backup"
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+)
+
+// Failure cleanup policies, what's removed when the primary master fails to create the assets (the lock is always
+// released so another master can take over)
+const (
+	// FailureCleanupKeepForDebug keeps the files and etcd keys written so far for debugging
+	FailureCleanupKeepForDebug = "keep-for-debug"
+	// FailureCleanupWipeLocal removes the files written to this node (as a reset does)
+	FailureCleanupWipeLocal = "wipe-local"
+	// FailureCleanupWipeAll removes the files and the etcd keys written by this node
+	FailureCleanupWipeAll = "wipe-all"
+)
+
+// failureCleanupPolicies are the valid failure cleanup policies
+var failureCleanupPolicies = []string{FailureCleanupKeepForDebug, FailureCleanupWipeLocal, FailureCleanupWipeAll}
+
+// ValidateFailureCleanup will check the failure cleanup policy is known (empty is keep-for-debug)
+func ValidateFailureCleanup(policy string) error {
+	if len(policy) == 0 {
+		return nil
+	}
+	for _, p := range failureCleanupPolicies {
+		if policy == p {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid failure cleanup policy %q, must be one of %s", policy,
+		strings.Join(failureCleanupPolicies, ", "))
+}
+
+// nodeKeys returns the etcd keys this node writes while bootstrapping (the member key expires by itself and the image
+// digests are shared with the other masters so neither are removed)
+func (k *ConfigType) nodeKeys() []string {
+	return []string{CaRotationNodePrefix + k.nodeName(), SARotationNodePrefix + k.nodeName()}
+}
+
+// cleanUpFailure will release the asset lock once the primary master has failed and remove what the failure cleanup
+// policy says, anything kept is logged so it can be found. Cleanup errors are only logged as the bootstrap error is
+// the one returned. The assets are what this node tried to share (empty when it didn't), the shared assets are only
+// removed when they're the ones this node wrote.
+func (k *Config) cleanUpFailure(assets string) {
+	policy := k.FailureCleanup
+	if len(policy) == 0 {
+		policy = FailureCleanupKeepForDebug
+	}
+	wipeLocal := policy == FailureCleanupWipeLocal || policy == FailureCleanupWipeAll
+	wipeAll := policy == FailureCleanupWipeAll
+	logger.Printf("Cleaning up the failed bootstrap (%s)", policy)
+
+	if err := k.Kmm.CleanUp(true, wipeAll && k.wroteAssets(assets)); err != nil {
+		logger.Errorf("Failed to clean up the lock and assets: %v", err)
+	}
+
+	if wipeLocal {
+		// The key backups are the last good state of the node so they're kept
+		if err := Reset(true); err != nil {
+			logger.Errorf("Failed to remove the files written to this node: %v", err)
+		}
+		logger.Printf("Kept the backups under %s", backup.Dir)
+	} else if files, err := resetFiles(); err != nil {
+		logger.Errorf("Failed to list the files written to this node: %v", err)
+	} else {
+		var kept []string
+		for _, file := range files {
+			if fileutil.ExistFile(file) {
+				kept = append(kept, file)
+			}
+		}
+		if len(kept) > 0 {
+			logger.Printf("Kept %d files for debugging: %s", len(kept), strings.Join(kept, ", "))
+		}
+	}
+
+	var kept []string
+	for _, key := range k.nodeKeys() {
+		if _, err := k.Etcd.Get(key); err != nil {
+			continue
+		}
+		if !wipeAll {
+			kept = append(kept, key)
+			continue
+		}
+		logger.Printf("Removing the etcd key %s", key)
+		if err := k.Etcd.Delete(key); err != nil {
+			logger.Errorf("Failed to remove the etcd key %s: %v", key, err)
+			kept = append(kept, key)
+		}
+	}
+	if len(kept) > 0 {
+		logger.Printf("Kept the etcd keys %s", strings.Join(kept, ", "))
+	}
+}
+
+// wroteAssets is true when the shared assets in etcd are the ones this node tried to write (e.g. a put which failed
+// after it was applied), never when another master shared its assets first
+func (k *Config) wroteAssets(assets string) bool {
+	if len(assets) == 0 {
+		return false
+	}
+	current, err := k.Etcd.Get(assetKey)
+	return err == nil && current == assets
+}
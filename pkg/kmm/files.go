@@ -0,0 +1,62 @@
+package kmm
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/artifacts"
+	"github.com/UKHomeOffice/keto-k8/pkg/audit"
+	"github.com/UKHomeOffice/keto-k8/pkg/constants"
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+	"github.com/UKHomeOffice/keto-k8/pkg/kms"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm"
+	"github.com/UKHomeOffice/keto-k8/pkg/oidc"
+	"github.com/UKHomeOffice/keto-k8/pkg/selinux"
+)
+
+// filePermissionsReportName is the artifact recording any permissions fixed
+const filePermissionsReportName = "file-permissions-report.txt"
+
+// expectedFiles returns the modes for every file keto-k8 (and kubeadm) writes - all must be owned by root
+func expectedFiles() []fileutil.Expected {
+	return []fileutil.Expected{
+		{Pattern: filepath.Join(kubeadm.PkiDir, "*.key"), Mode: 0600},
+		{Pattern: filepath.Join(kubeadm.PkiDir, "*.crt"), Mode: 0644},
+		{Pattern: filepath.Join(kubeadm.PkiDir, "*.pub"), Mode: 0644},
+		{Pattern: filepath.Join(filepath.Dir(kubeadm.PkiDir), "*.conf"), Mode: 0600},
+		{Pattern: filepath.Join(kubeadm.ManifestsDir, "*.yaml"), Mode: 0600},
+		{Pattern: kms.ConfigFile, Mode: 0600},
+		{Pattern: filepath.Join(audit.Dir, "*"), Mode: 0600},
+		{Pattern: filepath.Join(oidc.Dir, "*"), Mode: 0600},
+		{Pattern: filepath.Join(kubeadm.APIProxyDir, "*"), Mode: 0600},
+		{Pattern: constants.KetoTokenEnvName, Mode: 0644},
+		{Pattern: KubeletUnitFile, Mode: 0644},
+		{Pattern: filepath.Join(kubeadm.KubeConfigDir, kubeadm.KubeletConfigFileName), Mode: 0644},
+	}
+}
+
+// EnforceFilePermissions will fix the mode and owner of all generated assets, reporting any discrepancies
+func (k *ConfigType) EnforceFilePermissions() error {
+	if k.KubeadmCfg == nil {
+		return nil
+	}
+	discrepancies, err := fileutil.EnforcePermissions(expectedFiles())
+	if err != nil {
+		return err
+	}
+	var lines []string
+	for _, d := range discrepancies {
+		logger.Warnf("Fixed permissions of %s: %s", d.File, d.Detail)
+		lines = append(lines, fmt.Sprintf("%s: %s", d.File, d.Detail))
+	}
+	// Label anything written since the kubelet started
+	if err = selinux.Relabel(selinux.Paths...); err != nil {
+		return err
+	}
+	report := fmt.Sprintf("%d file permission discrepancies fixed\n", len(discrepancies))
+	if len(lines) > 0 {
+		report = report + strings.Join(lines, "\n") + "\n"
+	}
+	return artifacts.Save(filePermissionsReportName, report)
+}
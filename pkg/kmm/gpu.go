@@ -0,0 +1,117 @@
+package kmm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/constants"
+	"k8s.io/kubernetes/pkg/util/version"
+)
+
+const (
+	// GPUAuto will set up NVIDIA GPUs when any are found
+	GPUAuto = "auto"
+	// GPUNvidia will set up NVIDIA GPUs and fail when none are found
+	GPUNvidia = "nvidia"
+
+	nvidiaRuntimeName = "nvidia"
+	dockerUnit        = "docker.service"
+)
+
+// GPU is how compute nodes set up GPUs (empty to not, GPUAuto or GPUNvidia)
+var GPU = ""
+
+// NvidiaRuntimePath is the NVIDIA container runtime (runc with the hook which adds the GPUs to containers)
+var NvidiaRuntimePath = "/usr/bin/nvidia-container-runtime"
+
+// DockerDaemonConfig is the docker config the NVIDIA runtime and container log rotation are added to
+var DockerDaemonConfig = "/etc/docker/daemon.json"
+
+// nvidiaDeviceGlob matches the device of each NVIDIA GPU (replaced in tests)
+var nvidiaDeviceGlob = "/dev/nvidia[0-9]*"
+
+// minDevicePluginsDefaultVersion is the first version with the DevicePlugins feature enabled by default
+var minDevicePluginsDefaultVersion = version.MustParseGeneric("v1.10.0")
+
+// ValidateGPU will check the GPU mode
+func ValidateGPU(mode string) error {
+	switch mode {
+	case "", GPUAuto, GPUNvidia:
+		return nil
+	}
+	return fmt.Errorf("invalid gpu %q, must be one of: %s, %s", mode, GPUAuto, GPUNvidia)
+}
+
+// setupGPU will label and taint a compute node with NVIDIA GPUs, enable device plugins for the kubelet and make the
+// NVIDIA runtime the docker default (so the device plugin and GPU pods get the GPUs)
+func (k *Kmm) setupGPU() error {
+	if len(GPU) == 0 {
+		return nil
+	}
+	devices, err := filepath.Glob(nvidiaDeviceGlob)
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		if GPU == GPUNvidia {
+			return fmt.Errorf("no NVIDIA GPUs found (%s)", nvidiaDeviceGlob)
+		}
+		logger.Printf("No NVIDIA GPUs found, not setting up GPUs")
+		return nil
+	}
+	logger.Printf("Found %d NVIDIA GPUs, setting up GPUs", len(devices))
+	if k.NodeLabels == nil {
+		k.NodeLabels = map[string]string{}
+	}
+	k.NodeLabels[constants.GPULabel] = GPUNvidia
+	if k.NodeTaints == nil {
+		k.NodeTaints = map[string]string{}
+	}
+	k.NodeTaints[constants.GPUTaint] = "present:NoSchedule"
+	if v, err := version.ParseGeneric(k.KubeadmCfg.KubeVersion); err == nil && !v.AtLeast(minDevicePluginsDefaultVersion) {
+		k.KubeletExtraArgs = addFeatureGate(k.KubeletExtraArgs, "DevicePlugins=true")
+	}
+
+	changed, err := addNvidiaRuntime()
+	if err != nil {
+		return err
+	}
+	if !changed || k.SkipKubeletStart {
+		return nil
+	}
+	return restartDocker("the NVIDIA runtime")
+}
+
+// addNvidiaRuntime will add the NVIDIA runtime to the docker config as the default runtime (keeping any other config)
+// and returns true when the config has changed
+func addNvidiaRuntime() (bool, error) {
+	if _, err := os.Stat(NvidiaRuntimePath); err != nil {
+		return false, fmt.Errorf("the NVIDIA container runtime is required for GPUs [%v]", err)
+	}
+	return updateDockerConfig("the NVIDIA runtime", func(config map[string]interface{}) {
+		runtimes, _ := config["runtimes"].(map[string]interface{})
+		if runtimes == nil {
+			runtimes = map[string]interface{}{}
+		}
+		runtimes[nvidiaRuntimeName] = map[string]interface{}{"path": NvidiaRuntimePath, "runtimeArgs": []interface{}{}}
+		config["runtimes"] = runtimes
+		config["default-runtime"] = nvidiaRuntimeName
+	})
+}
+
+// addFeatureGate will add a feature gate to any --feature-gates in the args (the kubelet only uses the last one)
+func addFeatureGate(args, gate string) string {
+	fields := strings.Fields(args)
+	for i, f := range fields {
+		if !strings.HasPrefix(f, "--feature-gates=") {
+			continue
+		}
+		if !strings.Contains(f, strings.Split(gate, "=")[0]+"=") {
+			fields[i] = f + "," + gate
+		}
+		return strings.Join(fields, " ")
+	}
+	return strings.Join(append(fields, "--feature-gates="+gate), " ")
+}
@@ -0,0 +1,98 @@
+package kmm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/artifacts"
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+	"github.com/UKHomeOffice/keto-k8/pkg/hardening"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm"
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+)
+
+// hardeningReportName is the artifact for the report of checks satisfied
+const hardeningReportName = "hardening-report.txt"
+
+// HardeningReport will tighten file permissions and save a report of the hardening checks satisfied on this node
+func (k *ConfigType) HardeningReport() error {
+	if k.KubeadmCfg == nil {
+		return nil
+	}
+	profile, err := hardening.Get(k.KubeadmCfg.HardeningProfile)
+	if err != nil || profile == nil {
+		return err
+	}
+	flags, err := nodeComponentFlags()
+	if err != nil {
+		return err
+	}
+	results := profile.Evaluate(flags)
+	fileResults, err := profile.HardenFiles()
+	if err != nil {
+		return err
+	}
+	report := hardening.Report(profile.Name, append(results, fileResults...))
+	if err = artifacts.Save(hardeningReportName, report); err != nil {
+		return err
+	}
+	logger.Printf("%s (see %s)", strings.SplitN(report, "\n", 2)[0], artifacts.Path(hardeningReportName))
+	return nil
+}
+
+// nodeComponentFlags returns the flags for the components configured on this node (by component name)
+func nodeComponentFlags() (map[string]map[string]string, error) {
+	flags := map[string]map[string]string{}
+	for _, name := range kubeadm.StaticPods {
+		fileName := filepath.Join(kubeadm.ManifestsDir, name+".yaml")
+		if !fileutil.ExistFile(fileName) {
+			continue
+		}
+		manifest, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		objs, err := podspec.Decode(string(manifest))
+		if err != nil {
+			return nil, err
+		}
+		if len(objs) == 0 || objs[0].Container(name) == nil {
+			return nil, fmt.Errorf("no %s container in %s", name, fileName)
+		}
+		var args []string
+		command, _ := objs[0].Container(name)["command"].([]interface{})
+		for _, arg := range command {
+			args = append(args, fmt.Sprintf("%v", arg))
+		}
+		flags[name] = hardening.ParseFlags(args)
+	}
+	if fileutil.ExistFile(KubeletUnitFile) {
+		unit, err := ioutil.ReadFile(KubeletUnitFile)
+		if err != nil {
+			return nil, err
+		}
+		flags[hardening.Kubelet] = hardening.ParseFlags(kubeletArgs(string(unit)))
+	}
+	return flags, nil
+}
+
+// kubeletArgs returns the arguments of the kubelet command from a systemd unit
+func kubeletArgs(unit string) []string {
+	var args []string
+	inExecStart := false
+	for _, line := range strings.Split(unit, "\n") {
+		if strings.HasPrefix(line, "ExecStart=") {
+			inExecStart = true
+		}
+		if !inExecStart {
+			continue
+		}
+		args = append(args, strings.Fields(strings.TrimSuffix(strings.TrimSpace(line), `\`))...)
+		if !strings.HasSuffix(strings.TrimSpace(line), `\`) {
+			break
+		}
+	}
+	return args
+}
@@ -0,0 +1,88 @@
+package kmm
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/etcd"
+	"github.com/UKHomeOffice/keto-k8/pkg/images"
+)
+
+// ImageDigestsKey is the etcd key of the image digests resolved by the first master (so every master runs the same images)
+const ImageDigestsKey = "kmm-image-digests"
+
+// pinImageDigests will pin the control plane, DNS and CNI images to the digests recorded in etcd, the first master
+// resolves the tags of the images it pulled and records them (digests set in the config file are always used)
+func (k *ConfigType) pinImageDigests() error {
+	if !k.PinImageDigests || k.KubeadmCfg == nil {
+		return nil
+	}
+	recorded, err := k.recordedImageDigests()
+	if err != nil {
+		return err
+	}
+	if recorded == nil {
+		if recorded, err = k.recordImageDigests(); err != nil {
+			return err
+		}
+	}
+	digests := map[string]string{}
+	for image, digest := range recorded {
+		digests[image] = digest
+	}
+	for image, digest := range k.KubeadmCfg.ImageDigests {
+		digests[image] = digest
+	}
+	k.KubeadmCfg.ImageDigests = digests
+	logger.Printf("Pinned %d images to their digests", len(digests))
+	return nil
+}
+
+// recordedImageDigests returns the image digests in etcd (nil when none have been recorded)
+func (k *ConfigType) recordedImageDigests() (map[string]string, error) {
+	value, err := k.Etcd.Get(ImageDigestsKey)
+	if err == etcd.ErrKeyMissing {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	digests := map[string]string{}
+	if err = json.Unmarshal([]byte(value), &digests); err != nil {
+		return nil, fmt.Errorf("invalid image digests in etcd [%v]", err)
+	}
+	return digests, images.ValidateDigests(digests)
+}
+
+// recordImageDigests will resolve the digests of the bootstrap images and record them unless another master already
+// has (when its digests are used)
+func (k *ConfigType) recordImageDigests() (map[string]string, error) {
+	if k.ImagePuller == nil {
+		return nil, fmt.Errorf("pinning image digests needs an image runtime to resolve them")
+	}
+	list, err := k.bootstrapImages()
+	if err != nil {
+		return nil, err
+	}
+	var unpinned []string
+	for _, image := range list {
+		if _, ok := k.KubeadmCfg.ImageDigests[image]; !ok {
+			unpinned = append(unpinned, image)
+		}
+	}
+	digests, err := images.Resolve(k.ImagePuller, unpinned)
+	if err != nil {
+		return nil, err
+	}
+	value, err := json.Marshal(digests)
+	if err != nil {
+		return nil, err
+	}
+	if err = k.Etcd.PutTx(ImageDigestsKey, string(value)); err == etcd.ErrKeyAlreadyExists {
+		logger.Printf("Image digests already recorded by another master")
+		return k.recordedImageDigests()
+	} else if err != nil {
+		return nil, err
+	}
+	logger.Printf("Recorded the digests of %d images", len(digests))
+	return digests, nil
+}
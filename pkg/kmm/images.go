@@ -0,0 +1,56 @@
+package kmm
+
+import (
+	"github.com/UKHomeOffice/keto-k8/pkg/images"
+	"github.com/UKHomeOffice/keto-k8/pkg/network"
+)
+
+// prePullImages will pull the control plane and CNI images (when a puller is set) before the manifests are written
+// Failures are only logged as the kubelet will retry the pulls
+func (k *ConfigType) prePullImages() error {
+	if k.ImagePuller == nil || k.KubeadmCfg == nil {
+		return nil
+	}
+	list, err := k.bootstrapImages()
+	if err != nil {
+		logger.Warnf("Not pre-pulling images: %v", err)
+		return nil
+	}
+	if err = images.PrePull(k.ImagePuller, list); err != nil {
+		logger.Warnf("%v, the kubelet will retry", err)
+	}
+	return nil
+}
+
+// bootstrapImages returns the images a master needs to bootstrap for the kubernetes version and network provider
+func (k *ConfigType) bootstrapImages() ([]string, error) {
+	list, err := images.ControlPlane(k.KubeadmCfg.KubeVersion)
+	if err != nil {
+		return nil, err
+	}
+	if k.KubeadmCfg.EncryptionEnabled() {
+		list = append(list, k.KubeadmCfg.KMS.ImageName())
+	}
+	if k.KubeadmCfg.APIProxy.Enabled() {
+		list = append(list, k.KubeadmCfg.APIProxy.ImageName())
+	}
+	if len(k.NetworkProvider) == 0 {
+		return list, nil
+	}
+	np, err := k.networkProvider()
+	if err != nil {
+		return nil, err
+	}
+	doc, err := np.Render(network.Options{
+		KubeVersion: k.KubeadmCfg.KubeVersion,
+		Values:      k.AddonValues[k.NetworkProvider],
+	})
+	if err != nil {
+		return nil, err
+	}
+	cni, err := images.FromManifests(doc)
+	if err != nil {
+		return nil, err
+	}
+	return append(list, cni...), nil
+}
@@ -0,0 +1,24 @@
+package kmm
+
+import (
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm"
+)
+
+// joinAssets returns the assets the primary master shares through etcd, in the kubeadm join mode they're uploaded to
+// the cluster with kubeadm and only the join details are shared (the kubeadm config is uploaded too unless published)
+func (k *ConfigType) joinAssets(assets string) (string, error) {
+	if k.KubeadmCfg == nil || k.KubeadmCfg.JoinMode != kubeadm.JoinModeKubeadm {
+		return assets, nil
+	}
+	return k.KubeadmCfg.UploadCerts(!k.PublishKubeadmConfig)
+}
+
+// saveAssets will save the assets shared by the primary master to disk, downloading them with kubeadm when the
+// primary used the kubeadm join mode (the mode of the primary is always followed)
+func (k *ConfigType) saveAssets(assets string) error {
+	if !kubeadm.IsJoinAssets(assets) {
+		return k.Kubeadm.SaveAssets(assets)
+	}
+	logger.Printf("Downloading the assets with kubeadm...")
+	return k.KubeadmCfg.DownloadCerts(assets)
+}
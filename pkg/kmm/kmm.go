@@ -1,35 +1,81 @@
 package kmm
 
 import (
-	"errors"
 	"fmt"
-	log "github.com/Sirupsen/logrus"
+	"io/ioutil"
 	"net/url"
 	"os"
+	"os/signal"
+	"path"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/UKHomeOffice/keto-k8/pkg/addons"
+	"github.com/UKHomeOffice/keto-k8/pkg/backup"
+	"github.com/UKHomeOffice/keto-k8/pkg/certmanager"
+	"github.com/UKHomeOffice/keto-k8/pkg/datadisk"
+	"github.com/UKHomeOffice/keto-k8/pkg/drift"
 	"github.com/UKHomeOffice/keto-k8/pkg/etcd"
+	"github.com/UKHomeOffice/keto-k8/pkg/events"
+	"github.com/UKHomeOffice/keto-k8/pkg/failure"
+	"github.com/UKHomeOffice/keto-k8/pkg/faults"
 	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+	"github.com/UKHomeOffice/keto-k8/pkg/images"
+	"github.com/UKHomeOffice/keto-k8/pkg/k8client"
 	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm"
+	kubeadmconstants "github.com/UKHomeOffice/keto-k8/pkg/kubeadm/constants"
+	"github.com/UKHomeOffice/keto-k8/pkg/lock"
+	"github.com/UKHomeOffice/keto-k8/pkg/logging"
 	"github.com/UKHomeOffice/keto-k8/pkg/network"
+	"github.com/UKHomeOffice/keto-k8/pkg/notify"
+	"github.com/UKHomeOffice/keto-k8/pkg/prereq"
+	"github.com/UKHomeOffice/keto-k8/pkg/publish"
+	"github.com/UKHomeOffice/keto-k8/pkg/steps"
+	"github.com/UKHomeOffice/keto-k8/pkg/summary"
 	"github.com/UKHomeOffice/keto-k8/pkg/tokens"
+	"github.com/UKHomeOffice/keto-k8/pkg/tracing"
+	"github.com/UKHomeOffice/keto-k8/pkg/version"
 	"github.com/UKHomeOffice/keto/pkg/cloudprovider"
 )
 
+// logger is used for all the kmm logs
+var logger = logging.New("kmm")
+
 const assetKey string = "kmm-asset-key"
 const assetLockKey string = "kmm-asset-lock"
 const defaultBackOff time.Duration = 20 * time.Second
 const defaultLockTTL time.Duration = 120 * time.Second
 
+// ErrAssetsWaitDeadline is returned when a master has waited longer than the MasterWaitDeadline for the shared assets
+var ErrAssetsWaitDeadline = failure.New("deadline exceeded waiting for the shared assets",
+	"check the logs and status of the master holding the asset lock, the primary master may have stalled")
+
+// ExitCodeAssetsWaitDeadline is the exit code used for ErrAssetsWaitDeadline (so a stalled cluster can be told apart)
+const ExitCodeAssetsWaitDeadline = 3
+
+// BootstrapCondition is the node condition set once keto-k8 has completely bootstrapped a node
+const BootstrapCondition string = "KetoBootstrapComplete"
+
+// bootstrapFailedConditionTimeout limits how long a failed bootstrap waits to set the condition (the node may never
+// register)
+const bootstrapFailedConditionTimeout = 30 * time.Second
+
+// maxConditionMessage is the longest error kept in a node condition message
+const maxConditionMessage = 1024
+
 // Interface defined to enable testing of core functions without dependencies
 type Interface interface {
 	CleanUp(releaseLock, deleteAssets bool) (err error)
 	CopyKubeCa() (err error)
 	InstallNetwork() (err error)
 	TokensDeploy() error
+	AddonsDeploy() error
 	UpdateCloudCfg() (err error)
 	CreateAndStartKubelet(master bool) error
+	WaitForNodeReady() error
+	SetBootstrapCondition() error
+	SetBootstrapFailedCondition(cause error) error
 }
 
 // ConfigType is the complete configuration provided for all kmm use
@@ -39,14 +85,52 @@ type ConfigType struct {
 	KubePersistentCaKey  string
 	ClusterName          string
 	NetworkProvider      string
+	NetworkProviders     network.Registry
 	MasterBackOffTime    time.Duration
+	MasterWaitDeadline   time.Duration
 	ExitOnCompletion     bool
 	Etcd                 etcd.Clienter
 	Kubeadm              kubeadm.Kubeadmer
 	Kmm                  Interface
+	Events               events.Recorder
+	K8Client             k8client.Clienter
+	Tokens               tokens.Interface
 	KubeletExtraArgs     string
 	NodeLabels           map[string]string
 	NodeTaints           map[string]string
+	DefaultStorageClass  bool
+	StorageClassParams   string
+	AddonValues          map[string]map[string]interface{}
+	EnabledAddons        []string
+	SummaryToEtcd        bool
+	HeartbeatInterval    time.Duration
+	NodeDataFile         string
+	SkipKubeletStart     bool
+	Parallelism          int
+	// PostCoreRetryTimeout is how long failed post-core steps are retried in the background (they fail the bootstrap
+	// when not set)
+	PostCoreRetryTimeout time.Duration
+	// FailureCleanup is what's removed when the primary master fails (see failurecleanup.go)
+	FailureCleanup       string
+	ImagePuller          images.Puller
+	PinImageDigests      bool
+	Publish              *publish.Config
+	LBTargetGroups       []string
+	CertManager          *certmanager.Config
+	EtcdStrictIsolation  bool
+	PublishClusterInfo   bool
+	PublishKubeadmConfig bool
+	EtcdDiscovery        *EtcdDiscovery
+	LockBackend          string
+	Lock                 lock.Locker
+	heartbeat            *heartbeat
+	// shared is set by New so the Config and Kmm (each with a copy of the ConfigType) see the node data
+	shared *shared
+}
+
+// shared is the state loaded during the bootstrap which is needed by both the Config and the Kmm
+type shared struct {
+	clusterName string
 }
 
 // Both structs here use the same config but are bound to different methods...
@@ -62,38 +146,131 @@ type Kmm struct {
 }
 
 // SetupCompute will configure a compute node - currently just saves an env file
-func SetupCompute(cloud string, exitOnCompletion bool) (err error) {
+// Only the cloud provider, kubelet and etcd client settings of the node config are used
+// A heartbeat is only kept in etcd when the interval is set
+// When skipKubeletStart is set everything is written but the kubelet isn't started (e.g. to validate images)
+func SetupCompute(nodeCfg kubeadm.Config, heartbeatInterval time.Duration, exitOnCompletion, skipKubeletStart bool) (err error) {
 
 	cfg := Config{}
 	cfg.ConfigType.ExitOnCompletion = exitOnCompletion
-	cfg.ConfigType.KubeadmCfg = &kubeadm.Config{
-		CloudProvider:	cloud,
-	}
+	cfg.ConfigType.SkipKubeletStart = skipKubeletStart
+	cfg.ConfigType.KubeadmCfg = &nodeCfg
+	cfg.ConfigType.HeartbeatInterval = heartbeatInterval
 	k := New(cfg)
+	summary.Start("compute")
+	k.startHeartbeat("compute")
+	err = k.setupCompute()
+	k.saveSummary(err)
+	k.reportProfile()
+	if err != nil {
+		k.reportFailure("compute", failure.WithPhase(err, currentPhase()))
+		signalCompletion(err)
+		if cerr := k.Kmm.SetBootstrapFailedCondition(err); cerr != nil {
+			logger.Warnf("error setting the failed %s node condition: %v", BootstrapCondition, cerr)
+		}
+		k.stopHeartbeat()
+		return err
+	}
+	k.setMemberState(MemberReady)
+	signalCompletion(nil)
+
+	logger.Printf("Compute bootstrapped")
+	if cerr := tracing.Close(); cerr != nil {
+		logger.Warnf("error flushing traces: %v", cerr)
+	}
+	if ! k.ExitOnCompletion {
+		// Without a kubelet the node never registered so there's nothing to drain
+		var terminations <-chan string
+		if !k.SkipKubeletStart {
+			terminations = watchTermination()
+		}
+		k.waitForSignal(false, terminations)
+	}
+	k.stopHeartbeat()
+	return nil
+}
+
+// setupCompute will carry out all the actions on a compute node
+func (k *Config) setupCompute() (err error) {
+	k.phase("compute")
+	if err = prereq.Check(k.prereqTargets(false)...); err != nil {
+		return err
+	}
 	// Get data from cloud provider
 	if err = k.Kmm.UpdateCloudCfg(); err != nil {
 		return err
 	}
-	// TODO: make testable interface here too
-	if err = tokens.WriteKetoTokenEnv(cloud, cfg.KubeadmCfg.APIServer.String()); err != nil {
-		return fmt.Errorf("error saving KetoTokenEnv: %q", err)
+	k.setMemberCluster()
+	// Joining with the bootstrap token only, keto-tokens isn't used
+	if !k.KubeadmCfg.TokenJoin() {
+		if err = tokens.Or(k.Tokens).WriteEnv(k.KubeadmCfg.CloudProvider, k.KubeadmCfg.APIServer.String()); err != nil {
+			return fmt.Errorf("error saving KetoTokenEnv: %q", err)
+		}
 	}
 
-	k.Kmm.CreateAndStartKubelet(false)
-
-	log.Printf("Compute bootstrapped")
-	if ! k.ExitOnCompletion {
-		for true {}
+	// The kubelet would crash-loop until it can reach the api server
+	if !k.SkipKubeletStart {
+		if err = k.waitForAPIServer(); err != nil {
+			return err
+		}
+	}
+	// With a bootstrap token the kubelet joins with standard TLS bootstrapping (not the keto-tokens kubeconfig)
+	// The kubelet verifies the api server client cert with the kube CA the bootstrap kubeconfig trusts
+	if len(k.KubeadmCfg.BootstrapToken) > 0 {
+		if err = k.KubeadmCfg.WriteBootstrapKubeConfig(); err != nil {
+			return err
+		}
+	} else if err = k.KubeadmCfg.WriteClientCA(); err != nil {
+		return err
+	}
+	// The kubelet keeps verifying the api server while the masters change over to a new CA
+	if err = k.trustRotatingCa(); err != nil {
+		return err
+	}
+	// The kubelet and container runtime data must be moved to any data disk before the kubelet starts
+	if !k.SkipKubeletStart {
+		if err = datadisk.Prepare(); err != nil {
+			return err
+		}
+	}
+	if err = k.Kmm.CreateAndStartKubelet(false); err != nil {
+		return err
 	}
+	if err = k.EnforceFilePermissions(); err != nil {
+		return err
+	}
+	if err = k.HardeningReport(); err != nil {
+		return err
+	}
+	if err = k.RecordWrittenFiles(); err != nil {
+		return err
+	}
+	if k.SkipKubeletStart {
+		// The node will never register without a kubelet
+		return nil
+	}
+	// Only bootstrapped once the node has actually joined
+	if err = k.Kmm.WaitForNodeReady(); err != nil {
+		return err
+	}
+	k.setBootstrapCondition()
 	return nil
 }
 
 // New creates a new kmm struct with live interface from configuration
 func New(cfg Config) *Config {
-	cfg.MasterBackOffTime = defaultBackOff
+	if cfg.MasterBackOffTime <= 0 {
+		cfg.MasterBackOffTime = defaultBackOff
+	}
 
 	cfg.Etcd = etcd.New(cfg.KubeadmCfg.EtcdClientConfig)
 	cfg.Kubeadm = cfg.KubeadmCfg
+	cfg.Events = events.New(cfg.nodeName())
+	cfg.K8Client = k8client.Kubectl
+	cfg.Tokens = tokens.Tokens{}
+	logging.SetNode(cfg.nodeName())
+	logging.SetCluster(cfg.ClusterName)
+	cfg.shared = &shared{clusterName: cfg.ClusterName}
 
 	// Wire up the concrete implementation with the same data
 	kmm := &Kmm{}
@@ -106,78 +283,289 @@ func New(cfg Config) *Config {
 // CreateOrGetSharedAssets core logic
 func (k *Config) CreateOrGetSharedAssets() (err error) {
 
-	log.Printf("Determin if primary master...")
-	if err = k.Kmm.UpdateCloudCfg(); err != nil {
+	summary.Start("master")
+	k.startHeartbeat("master")
+	err = k.bootstrapMaster()
+	k.saveSummary(err)
+	k.reportProfile()
+	if err != nil {
+		k.reportFailure("master", failure.WithPhase(err, currentPhase()))
+		signalCompletion(err)
+		k.stopHeartbeat()
 		return err
 	}
-	if err = k.Kmm.CopyKubeCa(); err != nil {
+	k.setMemberState(MemberReady)
+	// The result is only signalled once any post-core steps being retried are done (or given up on)
+	signalled := make(chan struct{})
+	go func() {
+		waitForPostCoreSteps()
+		signalCompletion(postCoreFailure())
+		close(signalled)
+	}()
+	// TODO: Will need a retry loop if we implement run-time keto-k8 upgrades...
+	logger.Printf("Master bootstrapped")
+	if cerr := tracing.Close(); cerr != nil {
+		logger.Warnf("error flushing traces: %v", cerr)
+	}
+	if ! k.ExitOnCompletion {
+		k.waitForSignal(true, nil)
+		k.deregisterLoadBalancer()
+	} else {
+		// Any post-core steps still being retried would be lost
+		<-signalled
+	}
+	k.stopHeartbeat()
+	return nil
+}
+
+// waitForSignal will keep running (and heartbeating) until kmm is stopped
+// The written files are checked for drift every drift.CheckInterval (when set)
+// A master re-writes its manifests when the discovered etcd endpoints change (when discovered again)
+// A master approves the kubelet serving cert requests (when kubelets serve with certs signed by the cluster)
+// A compute node is drained and deregistered when a termination notice is received (then kmm stops)
+func (k *ConfigType) waitForSignal(master bool, terminations <-chan string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	var checks <-chan time.Time
+	if drift.CheckInterval > 0 && k.KubeadmCfg != nil {
+		ticker := time.NewTicker(drift.CheckInterval)
+		defer ticker.Stop()
+		checks = ticker.C
+	}
+	var etcdChecks <-chan time.Time
+	if k.EtcdDiscovery.enabled() && k.KubeadmCfg != nil {
+		ticker := time.NewTicker(k.EtcdDiscovery.Interval)
+		defer ticker.Stop()
+		etcdChecks = ticker.C
+	}
+	var csrChecks <-chan time.Time
+	if master && k.servingCSRsEnabled() {
+		ticker := time.NewTicker(servingCSRCheckInterval)
+		defer ticker.Stop()
+		csrChecks = ticker.C
+	}
+	reported := ""
+	for {
+		select {
+		case sig := <-signals:
+			logger.Printf("Received %v, stopping", sig)
+			return
+		case <-checks:
+			reported = checkDrift(reported)
+		case <-etcdChecks:
+			if err := k.reconcileEtcdEndpoints(); err != nil {
+				logger.Warnf("Failed to reconcile the etcd endpoints: %v", err)
+			}
+		case <-csrChecks:
+			if err := k.approveServingCSRs(); err != nil {
+				logger.Warnf("Failed to approve the kubelet serving cert requests: %v", err)
+			}
+		case reason := <-terminations:
+			k.shutdownCompute(reason)
+			return
+		}
+	}
+}
+
+// prereqTargets are the etcd endpoints and api server checked before bootstrapping, the api load balancer is only
+// resolved on masters (it has no healthy masters before the first is up) and isn't needed without a kubelet
+func (k *ConfigType) prereqTargets(master bool) []prereq.Target {
+	if k.KubeadmCfg == nil {
+		return nil
+	}
+	targets := prereq.EtcdTargets(k.KubeadmCfg.EtcdClientConfig.Endpoints)
+	if master || !k.SkipKubeletStart {
+		targets = append(targets, prereq.APITarget(k.KubeadmCfg.APIServer, master)...)
+	}
+	return targets
+}
+
+// newLocker returns the lock for a backend (replaced in tests)
+var newLocker = lock.New
+
+// locker returns the primary master lock (in etcd unless another backend is set)
+func (k *ConfigType) locker() (lock.Locker, error) {
+	if k.Lock != nil {
+		return k.Lock, nil
+	}
+	return newLocker(k.LockBackend, k.Etcd, k.clusterName())
+}
+
+// clusterName returns the name of the cluster (from the node data once it's loaded)
+func (k *ConfigType) clusterName() string {
+	if k.shared != nil {
+		return k.shared.clusterName
+	}
+	return k.ClusterName
+}
+
+// setClusterName will set the name of the cluster for both the Config and the Kmm
+func (k *ConfigType) setClusterName(name string) {
+	k.ClusterName = name
+	if k.shared != nil {
+		k.shared.clusterName = name
+	}
+	logging.SetCluster(name)
+}
+
+// bootstrapMaster will create (as the primary) or re-use the shared assets to bootstrap a master
+func (k *Config) bootstrapMaster() (err error) {
+	// Normally removed as soon as the certs are signed, this is for when the bootstrap fails first
+	defer func() {
+		if rerr := k.removeEphemeralCaKey(); rerr != nil {
+			logger.Errorf("Failed to remove the ephemeral CA key: %v", rerr)
+		}
+	}()
+
+	k.phase("prepare")
+	logger.Printf("Determin if primary master...")
+	if err = k.validateEtcdIsolation(); err != nil {
 		return err
 	}
-	if err = k.Kubeadm.WriteManifests(); err != nil {
+	if err = prereq.Check(k.prereqTargets(true)...); err != nil {
 		return err
 	}
+	// The manifests need the node data from the cloud provider, the CA waits for it too as both use the KubeadmCfg the
+	// node data is written to
+	// The images are pulled first so the kubelet can start the static pods straight away (for the kube version in the
+	// node data)
+	if err = steps.Run(k.Parallelism,
+		steps.Step{Name: "cloud", Run: k.Kmm.UpdateCloudCfg},
+		steps.Step{Name: "ca", DependsOn: []string{"cloud"}, Run: k.Kmm.CopyKubeCa},
+		steps.Step{Name: "images", DependsOn: []string{"cloud"}, Run: k.prePullImages},
+		steps.Step{Name: "sa-rotation", Run: k.loadSARotation},
+		// The digests recorded by the first master are used by every master so must be for the node data kube version
+		steps.Step{Name: "image-digests", DependsOn: []string{"cloud", "images"}, Run: k.pinImageDigests},
+		// The manifests are annotated with the CA (so the control plane restarts when it changes)
+		steps.Step{Name: "manifests", DependsOn: []string{"cloud", "ca", "images", "sa-rotation", "image-digests"}, Run: k.writeManifests},
+	); err != nil {
+		return err
+	}
+	k.setMemberCluster()
 
-	// Keep trying to get Assets
+	// Keep trying to get Assets (until the deadline when set)
+	waitStarted := time.Now()
 	for true {
 		assets, err := k.Etcd.Get(assetKey)
 		if err == etcd.ErrKeyMissing {
-			log.Printf("Assets not present in etcd...\n")
+			logger.Printf("Assets not present in etcd...\n")
 			// obtain lock...
 			// TODO: pass in lock TTL from here
-			mylock, err := k.Etcd.GetOrCreateLock(assetLockKey, defaultLockTTL)
+			locker, err := k.locker()
 			if err != nil {
-				// May need to add retry logic?
 				return err
 			}
+			mylock, err := locker.GetOrCreateLock(assetLockKey, defaultLockTTL)
+			if err != nil {
+				// May need to add retry logic?
+				return wrapFailure(err, "error getting the primary master lock",
+					"check the --lock-backend is reachable and the instance role or etcd credentials can use it")
+			}
 			if mylock {
-				log.Printf("Obtained lock, creating assets...")
+				k.phase("primary")
+				summary.Update(func(s *summary.Summary) {
+					s.Assets = summary.AssetsCreated
+				})
+				logger.Printf("Obtained lock, creating assets...")
 				if assets, err = k.BootstrapOnce(); err != nil {
-					k.Kmm.CleanUp(true, false)
+					k.event(events.Warning, events.BootstrapFailed, err.Error())
+					k.cleanUpFailure("")
 					return err
 				}
 				// Only share assets when all done OK!
-				log.Printf("Saving assets to etcd...")
-				if err = k.Etcd.PutTx(assetKey, assets); err != nil {
-					k.Kmm.CleanUp(true, false)
+				logger.Printf("Saving assets to etcd...")
+				if err = faults.Inject(faults.BeforePutTx); err != nil {
+					k.cleanUpFailure("")
 					return err
 				}
-				log.Printf("Assets shared to etcd")
+				if err = k.Etcd.PutTx(assetKey, assets); err != nil {
+					// Assets already there were shared by another master so must be kept
+					if err == etcd.ErrKeyAlreadyExists {
+						k.cleanUpFailure("")
+					} else {
+						k.cleanUpFailure(assets)
+					}
+					return wrapFailure(err, "error sharing the assets to etcd",
+						"check etcd is healthy, the lock is released so another master can create the assets")
+				}
+				logger.Printf("Assets shared to etcd")
+				k.event(events.Normal, events.AssetsCreated, "Cluster assets created and shared to etcd")
+				// The cluster is up without operator access, so a failure is only reported
+				if err = k.publishKubeConfig(); err != nil {
+					logger.Errorf("Failed to publish the kubeconfig: %v", err)
+					notify.Send(notify.PublishFailed, notify.Warning, "publishing the kubeconfig failed: "+err.Error())
+				}
 				break
 			}
 			// We need to try and get the assets again after a back off
+			if k.MasterWaitDeadline > 0 && time.Since(waitStarted) >= k.MasterWaitDeadline {
+				logger.Errorf("No assets shared after %v, is the primary master stalled?", k.MasterWaitDeadline)
+				return ErrAssetsWaitDeadline
+			}
 			time.Sleep(k.MasterBackOffTime)
 		} else if err != nil {
-			return err
+			return wrapFailure(err, "error getting the shared assets from etcd",
+				"check etcd is healthy and the etcd credentials can read the key prefix")
 		} else {
 			// Assets present in etcd so save assets and boot secondary master...
+			k.phase("secondary")
+			summary.Update(func(s *summary.Summary) {
+				s.Assets = summary.AssetsReused
+			})
 			if err = k.BootstrapSecondaryMaster(assets); err != nil {
+				k.event(events.Warning, events.BootstrapFailed, err.Error())
 				return err
 			}
+			k.event(events.Normal, events.MasterJoined, "Secondary master joined the cluster")
 			break
 		}
 	}
-	// TODO: For now...
-	//       Will make loop optional so we can run as a cli for e2e tests
-	//       Will need a retry loop if we implement run-time keto-k8 upgrades...
-	log.Printf("Master bootstrapped")
-	if ! k.ExitOnCompletion {
-		for true {}
+	k.phase("hardening")
+	if err = k.EnforceFilePermissions(); err != nil {
+		return err
 	}
-	return nil
+	if err = k.HardeningReport(); err != nil {
+		return err
+	}
+	if err = k.RecordWrittenFiles(); err != nil {
+		return err
+	}
+	if err = k.updateClusterInfo(); err != nil {
+		return err
+	}
+	if err = k.uploadKubeadmConfig(); err != nil {
+		return err
+	}
+	if err = k.createBootstrapToken(); err != nil {
+		return err
+	}
+	if err = k.recordSARotation(); err != nil {
+		return err
+	}
+	k.setBootstrapCondition()
+	return k.registerLoadBalancer()
 }
 
 // BootstrapSecondaryMaster will start a secondary master (cluster unique assets not created here)
 func (k *Config) BootstrapSecondaryMaster(assets string) (error) {
 	// We have the shared assets, now re-create anything missing...
-	log.Printf("Not primary master (in this run)...")
-	log.Printf("Saving assets to disk...")
-	if err := k.Kubeadm.SaveAssets(assets); err != nil {
-		return err
-	}
-	if err := k.Kubeadm.CreatePKI(); err != nil {
-		return err
+	logger.Printf("Not primary master (in this run)...")
+	if k.Kubeadm.AssetsUpToDate(assets) {
+		// e.g. after a reboot
+		logger.Printf("Assets, certs and kubeconfigs on disk are up to date, skipping...")
+	} else {
+		logger.Printf("Saving assets to disk...")
+		if err := k.saveAssets(assets); err != nil {
+			return err
+		}
+		if err := k.createPKI(); err != nil {
+			return err
+		}
+		if err := k.createKubeConfig(); err != nil {
+			return err
+		}
 	}
-	if err := k.Kubeadm.CreateKubeConfig(); err != nil {
+	if err := k.removeEphemeralCaKey(); err != nil {
 		return err
 	}
 	if err := k.Kmm.CreateAndStartKubelet(true); err != nil {
@@ -186,55 +574,170 @@ func (k *Config) BootstrapSecondaryMaster(assets string) (error) {
 	if err := k.Kubeadm.UpdateMasterRoleLabelsAndTaints(); err != nil {
 		return err
 	}
+	if err := k.Kubeadm.VerifyEncryption(); err != nil {
+		return err
+	}
 	return nil
 }
 
+// createPKI will create the master certs (signed by the kube CA)
+func (k *Config) createPKI() error {
+	return wrapFailure(k.Kubeadm.CreatePKI(), "error creating the master certs",
+		"check the kube CA cert and key are a valid pair and the api server url (--kube-server or the node data) is valid")
+}
+
+// createKubeConfig will create the master kubeconfigs (signed while the CA key is on disk)
+func (k *Config) createKubeConfig() error {
+	return wrapFailure(k.Kubeadm.CreateKubeConfig(), "error creating the master kubeconfigs",
+		"check the kube CA key is on disk (with --kube-ca-key-mode ephemeral it's removed once the certs are signed)")
+}
+
+// writeManifests will write the control plane static pod manifests (and their config files)
+func (k *Config) writeManifests() error {
+	return wrapFailure(k.Kubeadm.WriteManifests(), "error writing the static pod manifests",
+		"check the config file settings for the control plane and that /etc/kubernetes is writable")
+}
+
 // BootstrapOnce will carry out all the actions on a primary master
 // TODO: ensure these are all repeatable - blocked, see issue:
 //       https://github.com/UKHomeOffice/keto-k8/issues/33
 func (k *Config) BootstrapOnce() (assets string, err error) {
-	log.Printf("Bootstrapping master...")
+	logger.Printf("Bootstrapping master...")
 
 	// We can create the master assets here
-	if err = k.Kubeadm.CreatePKI(); err != nil {
+	if err = k.createPKI(); err != nil {
+		return "", err
+	}
+	if err = faults.Inject(faults.AfterCreatePKI); err != nil {
 		return "", err
 	}
 	// Load assets off disk and serialise
 	assets, err = k.Kubeadm.LoadAndSerializeAssets()
 
 	// We have the assets but we must NOT proceed until we've finish bootstrapping / sharing...
-	if err = k.Kubeadm.CreateKubeConfig(); err != nil {
+	if err = k.createKubeConfig(); err != nil {
+		return "", err
+	}
+	// The cert-manager issuer is signed while the CA key is still on disk
+	issuer, err := k.certManagerIssuer()
+	if err != nil {
+		return "", err
+	}
+	if err = k.removeEphemeralCaKey(); err != nil {
 		return "", err
 	}
 	if err = k.Kmm.CreateAndStartKubelet(true); err != nil {
 		return "", err
 	}
+	// Nothing can be deployed (or the assets shared) until the api server static pod is up
+	if err = k.waitForLocalAPIServer(); err != nil {
+		return "", err
+	}
 	// Note: Addons will call the same underlying kubeadmapi UpdateMasterRoleLabelsAndTaints
 	if err = k.Kubeadm.Addons(); err != nil {
 		return "", err
 	}
-	if err = k.Kmm.InstallNetwork(); err != nil {
+	if err = k.Kubeadm.VerifyEncryption(); err != nil {
 		return "", err
 	}
-	if err = k.Kmm.TokensDeploy(); err != nil {
+	// Once the apiserver is up the network, keto-tokens and addons are independent
+	if err = k.runPostCoreSteps(
+		steps.Step{Name: "network", Run: func() error {
+			if err := k.Kmm.InstallNetwork(); err != nil {
+				return err
+			}
+			k.event(events.Normal, events.NetworkInstalled, "Network provider "+k.NetworkProvider+" installed")
+			return nil
+		}},
+		steps.Step{Name: "tokens", Run: func() error {
+			if k.KubeadmCfg.TokenJoin() {
+				logger.Printf("Not deploying keto-tokens, compute nodes join with a bootstrap token")
+				return nil
+			}
+			if err := k.Kmm.TokensDeploy(); err != nil {
+				return err
+			}
+			k.event(events.Normal, events.TokensDeployed, "keto-tokens deployed")
+			return nil
+		}},
+		steps.Step{Name: "addons", Run: func() error {
+			if err := k.Kmm.AddonsDeploy(); err != nil {
+				return err
+			}
+			k.event(events.Normal, events.AddonsDeployed, "Addons deployed")
+			return nil
+		}},
+		steps.Step{Name: "cert-manager", DependsOn: []string{"addons"}, Run: func() error {
+			return k.handOffToCertManager(issuer)
+		}},
+	); err != nil {
 		return "", err
 	}
-	log.Printf("Master bootstrapped!")
+	if assets, err = k.joinAssets(assets); err != nil {
+		return "", err
+	}
+	logger.Printf("Master bootstrapped!")
 	return assets, nil
 }
 
+// event will record a bootstrap milestone (when a recorder is configured)
+func (k *ConfigType) event(eventType, reason, message string) {
+	if k.Events != nil {
+		k.Events.Event(eventType, reason, message)
+	}
+}
+
+// setBootstrapCondition will mark the node as bootstrapped
+// Only logged on failure as the node itself has bootstrapped OK
+func (k *Config) setBootstrapCondition() {
+	if err := k.Kmm.SetBootstrapCondition(); err != nil {
+		logger.Warnf("error setting %s node condition: %v", BootstrapCondition, err)
+	}
+}
+
+// SetBootstrapCondition will set the bootstrap complete condition (with the keto-k8 version) on this node
+func (k *Kmm) SetBootstrapCondition() error {
+	return kubeadm.SetNodeCondition(k.nodeName(), kubeadm.NodeCondition{
+		Type:    BootstrapCondition,
+		Reason:  "KetoBootstrapped",
+		Message: "keto-k8 " + version.Get().Version + " bootstrap complete",
+	})
+}
+
+// SetBootstrapFailedCondition will set the bootstrap complete condition to False with the failure on this node
+// Nothing can be set until the kubelet has bootstrapped (so the node is registered and can update its status)
+func (k *Kmm) SetBootstrapFailedCondition(cause error) error {
+	if _, err := os.Stat(path.Join(kubeadm.KubeConfigDir, kubeadmconstants.KubeletKubeConfigFileName)); err != nil {
+		return fmt.Errorf("the kubelet hasn't bootstrapped [%v]", err)
+	}
+	message := cause.Error()
+	if len(message) > maxConditionMessage {
+		message = message[:maxConditionMessage] + "..."
+	}
+	return kubeadm.SetNodeConditionWithin(k.nodeName(), kubeadm.NodeCondition{
+		Type:    BootstrapCondition,
+		Status:  "False",
+		Reason:  "KetoBootstrapFailed",
+		Message: message,
+	}, bootstrapFailedConditionTimeout)
+}
+
 // CleanUp - will optionally clean all etcd resources
 func (k *Kmm) CleanUp(releaseLock, deleteAssets bool) (err error) {
 
 	if releaseLock {
-		log.Printf("Releasing lock...")
-		if err = k.Etcd.Delete(assetLockKey); err != nil {
+		logger.Printf("Releasing lock...")
+		var locker lock.Locker
+		if locker, err = k.locker(); err != nil {
+			return err
+		}
+		if err = locker.Release(assetLockKey); err != nil {
 			return err
 		}
-		log.Printf("Released lock")
+		logger.Printf("Released lock")
 	}
 	if deleteAssets {
-		log.Printf("Releasing assets...")
+		logger.Printf("Releasing assets...")
 		if err = k.Etcd.Delete(assetKey); err != nil {
 			return err
 		}
@@ -245,44 +748,121 @@ func (k *Kmm) CleanUp(releaseLock, deleteAssets bool) (err error) {
 // InstallNetwork will create the CNI network resources from a named template
 func (k *Kmm) InstallNetwork() (err error) {
 	var np network.Provider
-	if np, err = network.CreateProvider(k.NetworkProvider); err != nil {
+	if np, err = k.networkProvider(); err != nil {
 		return err
 	}
-	return np.Create()
+	opts := network.Options{
+		Values: k.AddonValues[k.NetworkProvider],
+		Client: k.K8Client,
+	}
+	if k.KubeadmCfg != nil {
+		opts.KubeVersion = k.KubeadmCfg.KubeVersion
+		opts.ImageDigests = k.KubeadmCfg.ImageDigests
+	}
+	return np.Create(opts)
+}
+
+// networkProvider returns the configured provider (from the default providers unless a registry is set)
+func (k *ConfigType) networkProvider() (network.Provider, error) {
+	if k.NetworkProviders != nil {
+		return k.NetworkProviders.CreateProvider(k.NetworkProvider)
+	}
+	return network.CreateProvider(k.NetworkProvider)
 }
 
-// CopyKubeCa will copy Kube CA and link CA key to kubeadm expected locations (if not there already)
+// CopyKubeCa will copy Kube CA and link (or copy) CA key to kubeadm expected locations (if not there already)
+// During a CA rotation the old and new CAs are installed for the current phase (see carotation.go)
 func (k *Kmm) CopyKubeCa() (err error) {
+	rotation, err := k.caRotation()
+	if err != nil {
+		return err
+	}
+	if rotation != nil && rotation.Phase == CaRotationComplete {
+		if err = k.replacePersistentCa(rotation); err != nil {
+			return err
+		}
+	}
 	// First check for CA file...
 	if _, err := os.Stat(k.KubePersistentCaCert); os.IsNotExist(err) {
-		return errors.New("kube CA cert not found at: " + k.KubePersistentCaCert)
+		return failure.New("kube CA cert not found at: "+k.KubePersistentCaCert,
+			"check the keto infra provisioned the kube CA and --kube-ca-cert is its path")
 	}
 	if _, err := os.Stat(k.KubePersistentCaKey); os.IsNotExist(err) {
-		return errors.New("kube CA key not found at: " + k.KubePersistentCaKey)
+		return failure.New("kube CA key not found at: "+k.KubePersistentCaKey,
+			"check the keto infra provisioned the kube CA and --kube-ca-key is its path")
+	}
+	if err = kubeadm.ValidateCaFiles(k.KubePersistentCaCert, k.KubePersistentCaKey); err != nil {
+		return err
+	}
+	if err = kubeadm.CheckCAExpiry(k.KubePersistentCaCert); err != nil {
+		return err
 	}
 	if _, err = os.Stat(kubeadm.PkiDir); os.IsNotExist(err) {
-		os.Mkdir(kubeadm.PkiDir, os.ModePerm)
+		os.Mkdir(kubeadm.PkiDir, 0700)
+	}
+
+	if rotation != nil && rotation.Phase != CaRotationComplete {
+		if err = k.installRotatingCa(rotation); err != nil {
+			return err
+		}
+		return k.recordCaRotation(rotation)
 	}
 
+	// Keep the CA currently in use when it's being replaced
+	if err = backupCa(k.KubePersistentCaCert, kubeadm.CaCertFile); err != nil {
+		return err
+	}
 	err = fileutil.CopyFile(k.KubePersistentCaCert, kubeadm.CaCertFile)
 	if err != nil {
 		return err
 	}
-	err = fileutil.SymlinkFile(k.KubePersistentCaKey, kubeadm.CaKeyFile)
+	if err = k.installCaKey(); err != nil {
+		return err
+	}
+	return k.recordCaRotation(rotation)
+}
+
+// backupCa will back up a CA file when the persistent version is different
+func backupCa(persistent, file string) error {
+	data, err := ioutil.ReadFile(persistent)
 	if err != nil {
 		return err
 	}
-	return nil
+	return backup.Replacing(file, data)
 }
 
 // TokensDeploy method calls the dependancy with the correct configuration
 // It allows the dependancy to be mocked.
 func (k *Kmm) TokensDeploy() error {
-	return tokens.Deploy(k.ClusterName)
+	return tokens.Or(k.Tokens).Deploy(k.K8Client, k.ClusterName, k.KubeadmCfg.KubeVersion, k.AddonValues[tokens.AddonName])
+}
+
+// AddonsDeploy will deploy the keto-k8 managed addons
+func (k *Kmm) AddonsDeploy() error {
+	return addons.Deploy(addons.Config{
+		CloudProvider:       k.KubeadmCfg.CloudProvider,
+		KubeVersion:         k.KubeadmCfg.KubeVersion,
+		ClusterName:         k.ClusterName,
+		DefaultStorageClass: k.DefaultStorageClass,
+		PodSecurityPolicy:   k.KubeadmCfg.PodSecurityPolicy,
+		StorageClassParams:  stringToMap(k.StorageClassParams),
+		Values:              k.AddonValues,
+		Enabled:             k.EnabledAddons,
+		Client:              k.K8Client,
+	})
 }
 
-// UpdateCloudCfg config based on cloud provider, if specified
+// UpdateCloudCfg config based on cloud provider (or static node data file), if specified
 func (k *Kmm) UpdateCloudCfg() (err error) {
+	// Static node data is used instead of a cloud provider e.g. for local clusters
+	if k.NodeDataFile != "" {
+		var s *StaticNodeData
+		if s, err = LoadStaticNodeData(k.NodeDataFile); err != nil {
+			return err
+		}
+		logger.Printf("Loaded static node data from %s", k.NodeDataFile)
+		return k.updateNodeData(s.NodeData())
+	}
 	// Now get the cloud provider to get the kubeapi url and k8 version:
 	if k.KubeadmCfg.CloudProvider != "" {
 		var node cloudprovider.Node
@@ -291,32 +871,39 @@ func (k *Kmm) UpdateCloudCfg() (err error) {
 		}
 		nd, err := node.GetNodeData()
 		if err != nil {
-			return fmt.Errorf("error getting node data from cloud provider: %q", err)
+			return failure.Wrap(err, "error getting node data from the cloud provider",
+				"check the instance role allows the cloud provider calls and the instance has the keto tags (or use --node-data-file)")
 		}
-		k.ClusterName = nd.ClusterName
-		apiURL, err := url.Parse(nd.KubeAPIURL)
-		if err != nil {
-			return fmt.Errorf("error parsing Api server %s [%v]", nd.KubeAPIURL, err)
-		}
-		if len(nd.KubeAPIURL) > 0 {
-			k.KubeadmCfg.APIServer = apiURL
-		} else {
-			// url.Parse seems to always parse without error!
-			return fmt.Errorf("empty API server [%s] obtained from cloud provider", nd.KubeAPIURL)
-		}
-		k.KubeadmCfg.KubeVersion = nd.KubeVersion
-		if len(k.KubeadmCfg.KubeVersion) == 0 {
-			return fmt.Errorf("error parsing kubeversion %s", k.KubeadmCfg.KubeVersion)
-		}
-		k.NodeLabels = nd.Labels
-		k.NodeTaints = nd.Taints
-		k.KubeadmCfg.APIServerExtraArgs = stringToMap(nd.KubeArgs.APIServerExtraArgs)
-		k.KubeadmCfg.ControllerManagerExtraArgs = stringToMap(nd.KubeArgs.ControllerManagerExtraArgs)
-		k.KubeadmCfg.SchedulerExtraArgs = stringToMap(nd.KubeArgs.SchedulerExtraArgs)
-		k.KubeletExtraArgs = nd.KubeArgs.KubeletExtraArgs
+		return k.updateNodeData(nd)
+	}
+	logger.Printf("No cloud provider specified - not loading...")
+	return nil
+}
+
+// updateNodeData will set the cluster and kubernetes settings for this node
+func (k *Kmm) updateNodeData(nd cloudprovider.NodeData) error {
+	k.setClusterName(nd.ClusterName)
+	apiURL, err := url.Parse(nd.KubeAPIURL)
+	if err != nil {
+		return fmt.Errorf("error parsing Api server %s [%v]", nd.KubeAPIURL, err)
+	}
+	if len(nd.KubeAPIURL) > 0 {
+		k.KubeadmCfg.APIServer = apiURL
 	} else {
-		log.Printf("No cloud provider specified - not loading...")
+		// url.Parse seems to always parse without error!
+		return fmt.Errorf("empty API server [%s] obtained from cloud provider", nd.KubeAPIURL)
+	}
+	k.KubeadmCfg.KubeVersion = nd.KubeVersion
+	if len(k.KubeadmCfg.KubeVersion) == 0 {
+		return fmt.Errorf("error parsing kubeversion %s", k.KubeadmCfg.KubeVersion)
 	}
+	k.NodeLabels = nd.Labels
+	k.NodeTaints = nd.Taints
+	k.KubeadmCfg.APIServerExtraArgs = stringToMap(nd.KubeArgs.APIServerExtraArgs)
+	k.KubeadmCfg.ControllerManagerExtraArgs = stringToMap(nd.KubeArgs.ControllerManagerExtraArgs)
+	k.KubeadmCfg.SchedulerExtraArgs = stringToMap(nd.KubeArgs.SchedulerExtraArgs)
+	k.KubeletExtraArgs = nd.KubeArgs.KubeletExtraArgs
+	k.applyNodePool()
 	return nil
 }
 
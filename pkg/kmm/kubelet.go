@@ -2,99 +2,114 @@ package kmm
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"sort"
 	"strings"
 	"text/template"
 
 	"github.com/UKHomeOffice/keto-k8/pkg/constants"
 	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+	"github.com/UKHomeOffice/keto-k8/pkg/hardening"
+	"github.com/UKHomeOffice/keto-k8/pkg/hostconfig"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm"
+	"github.com/UKHomeOffice/keto-k8/pkg/selinux"
 	"github.com/coreos/go-systemd/dbus"
 )
 
+// KubeletUnitFile is where the kubelet unit is saved e.g. /run/systemd/system/kubelet.service when /etc is read-only
+var KubeletUnitFile = constants.KubeletUnitFileName
+
 // CreateAndStartKubelet will create Kubelet
 // CreateAndStartKubelet will call the CreateAndStartKubelet method with the correct configuration
+// It's safe to re-run (e.g. on every boot) as a running kubelet is only restarted when its unit (or env) has changed
 func (k *Kmm) CreateAndStartKubelet(master bool) error {
-
-	s := []string{}
-	for k, v := range k.NodeLabels {
-		s = append(s, fmt.Sprintf("%s=%s", k, v))
+	// Static pods can't read their config on SELinux enforcing hosts without the correct labels
+	if err := selinux.Relabel(selinux.Paths...); err != nil {
+		return err
 	}
-	nodeLabels := strings.Join(s, ",")
-	s = []string{}
-	for k, v := range k.NodeTaints {
-		s = append(s, fmt.Sprintf("%s=%s", k, v))
+	if !master {
+		if err := k.setupGPU(); err != nil {
+			return err
+		}
 	}
-	nodeTaints := strings.Join(s, ",")
-
-	// Render kubelet.service
-	data := struct {
-		CloudProviderName string
-		IsMaster          bool
-		KubeVersion       string
-		KubeletExtraArgs  string
-		NodeLabels        string
-		NodeTaints        string
-	}{
-		CloudProviderName: k.KubeadmCfg.CloudProvider,
-		IsMaster:          master,
-		KubeVersion:       k.KubeadmCfg.KubeVersion,
-		KubeletExtraArgs:  k.KubeletExtraArgs,
-		NodeLabels:        nodeLabels,
-		NodeTaints:        nodeTaints,
+	// The kubelet, kube-proxy and CNI need the kernel modules and sysctls before any pods start
+	if err := hostconfig.Configure(); err != nil {
+		return err
 	}
-	t := template.Must(template.New("kubeletUnit").Parse(kubeletTemplate))
-	var b bytes.Buffer
-	if err := t.Execute(&b, data); err != nil {
-		return fmt.Errorf("Error generating kubelet unit [%v] from template:\n%v", err, kubeletTemplate)
+	// Docker only rotates the logs of containers created after its config has changed
+	if err := k.setupContainerLogRotation(); err != nil {
+		return err
+	}
+	// The network pods can't start without the plugins (and the node isn't ready until they have)
+	if err := installCNIPlugins(); err != nil {
+		return err
 	}
 
-	// Get D-bus connection
-	target := path.Base(constants.KubeletUnitFileName)
-	conn, err := dbus.New()
+	unit, err := k.kubeletUnit(master)
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
-
 	// Manage unit file
-	if fileutil.ExistFile(constants.KubeletUnitFileName) {
-		// Tidy up existing file...
-		oldUnit, err := ioutil.ReadFile(constants.KubeletUnitFileName)
-		if err != nil {
-			return fmt.Errorf("Error [%v] reading existing unit [%v]", err, kubeletTemplate)
-		}
-		if string(oldUnit) != b.String() {
-			// delete file
-			if err := os.Remove(constants.KubeletUnitFileName); err != nil {
-				return fmt.Errorf("Error [%v] removing existing kubelet unit [%v]",
-					err,
-					constants.KubeletUnitFileName)
-			}
-			// TODO: stop unit if already running
-		} else {
-			// TODO: return IF kubelet already running, return here (no change)
-
-		}
+	oldUnit, err := ioutil.ReadFile(KubeletUnitFile)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Error [%v] reading existing unit [%v]", err, KubeletUnitFile)
 	}
-	if !fileutil.ExistFile(constants.KubeletUnitFileName) {
-		// Create unit
-		if err := ioutil.WriteFile(constants.KubeletUnitFileName, []byte(b.Bytes()), 0644); err != nil {
+	configChanged, err := k.writeKubeletConfig()
+	if err != nil {
+		return err
+	}
+	changed := !bytes.Equal(oldUnit, unit)
+	if changed {
+		if err := fileutil.WriteFile(KubeletUnitFile, unit, 0644); err != nil {
 			return fmt.Errorf("Can't save unit file [%v]: [%v]",
-				constants.KubeletUnitFileName,
+				KubeletUnitFile,
 				err)
 		}
 	}
-	// Daemon-reload TODO: make reload unit specific
-	if err := conn.Reload(); err != nil {
-		return fmt.Errorf("Problem reloading systemd units after adding %q; [%v]", target, err)
+	if k.SkipKubeletStart {
+		logger.Printf("Not starting the kubelet, unit saved to %q", KubeletUnitFile)
+		return nil
+	}
+
+	// Get D-bus connection
+	target := path.Base(KubeletUnitFile)
+	conn, err := dbus.New()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	active := false
+	if prop, err := conn.GetUnitProperty(target, "ActiveState"); err == nil {
+		active = prop.Value.Value() == "active"
+	}
+	if !changed && !configChanged && active {
+		logger.Printf("The kubelet unit %q is unchanged and running, not restarting it", target)
+		return nil
 	}
 
-	// Start / restart unit
 	reschan := make(chan string)
-	if _, err := conn.StartUnit(target, "replace", reschan); err != nil {
+	if changed {
+		// Daemon-reload TODO: make reload unit specific
+		if err := conn.Reload(); err != nil {
+			return fmt.Errorf("Problem reloading systemd units after adding %q; [%v]", target, err)
+		}
+		// Restart unit (started if it isn't running)
+		logger.Printf("The kubelet unit %q has changed, (re)starting it", target)
+		if _, err := conn.RestartUnit(target, "replace", reschan); err != nil {
+			return fmt.Errorf("Can't restart unit [%v] - [%v]", target, err)
+		}
+	} else if configChanged && active {
+		logger.Printf("The kubelet config has changed, restarting %q", target)
+		if _, err := conn.RestartUnit(target, "replace", reschan); err != nil {
+			return fmt.Errorf("Can't restart unit [%v] - [%v]", target, err)
+		}
+	} else if _, err := conn.StartUnit(target, "replace", reschan); err != nil {
 		return fmt.Errorf("Can't start unit [%v] - [%v]", target, err)
 	}
 	job := <-reschan
@@ -105,3 +120,116 @@ func (k *Kmm) CreateAndStartKubelet(master bool) error {
 	// TODO: enable unit (link if required)
 	return nil
 }
+
+// kubeletConfigFile is where the kubelet config file is saved
+func (k *Kmm) kubeletConfigFile() string {
+	return path.Join(kubeadm.KubeConfigDir, kubeadm.KubeletConfigFileName)
+}
+
+// writeKubeletConfig will save the kubelet config file with the resources for this node (when the kubelet reads one)
+// and returns true when it has changed
+func (k *Kmm) writeKubeletConfig() (bool, error) {
+	if !kubeadm.KubeletConfigFileSupported(k.KubeadmCfg.KubeVersion) {
+		return false, nil
+	}
+	config, err := k.KubeadmCfg.Kubelet.Resources(k.NodeLabels).ConfigFile()
+	if err != nil {
+		return false, err
+	}
+	file := k.kubeletConfigFile()
+	if current, err := ioutil.ReadFile(file); err == nil && bytes.Equal(current, config) {
+		return false, nil
+	}
+	logger.Printf("Saving the kubelet config %s", file)
+	return true, fileutil.WriteFile(file, config, 0644)
+}
+
+// kubeletUnit renders the kubelet unit
+// A compute unit includes a hash of the keto-tokens env it reads, so the kubelet is restarted when the env changes
+func (k *Kmm) kubeletUnit(master bool) ([]byte, error) {
+	// Sorted so the unit is the same every run
+	s := []string{}
+	for k, v := range k.NodeLabels {
+		s = append(s, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(s)
+	nodeLabels := strings.Join(s, ",")
+	s = []string{}
+	for k, v := range k.NodeTaints {
+		s = append(s, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(s)
+	nodeTaints := strings.Join(s, ",")
+
+	// Any hardening flags come first so explicit extra args take precedence
+	profile, err := hardening.Get(k.KubeadmCfg.HardeningProfile)
+	if err != nil {
+		return nil, err
+	}
+	// The resource reservations are in the kubelet config file when the kubelet reads one, otherwise flags
+	kubeletConfigFile := ""
+	resourceArgs := ""
+	if kubeadm.KubeletConfigFileSupported(k.KubeadmCfg.KubeVersion) {
+		kubeletConfigFile = k.kubeletConfigFile()
+	} else {
+		resourceArgs = k.KubeadmCfg.Kubelet.Resources(k.NodeLabels).Args()
+	}
+	kubeletArgs := strings.Join(strings.Fields(
+		profile.ArgsString(hardening.Kubelet)+" "+
+			k.KubeadmCfg.TLS.ArgsString()+" "+
+			resourceArgs+" "+
+			k.KubeadmCfg.KubeletServingArgs(master)+" "+
+			k.containerLogArgs()+" "+
+			k.KubeletExtraArgs), " ")
+
+	// Without keto-tokens the kubelet reads the bootstrap kubeconfig written from the bootstrap token
+	ketoTokens := !master && !k.KubeadmCfg.TokenJoin()
+	bootstrapKubeConfig := "${KETO_TOKENS_KUBELET_CONF}"
+	if !ketoTokens {
+		bootstrapKubeConfig = path.Join(kubeadm.KubeConfigDir, kubeadm.BootstrapKubeConfigFileName)
+	}
+	envHash := ""
+	if ketoTokens {
+		env, err := ioutil.ReadFile(constants.KetoTokenEnvName)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		sum := sha256.Sum256(env)
+		envHash = hex.EncodeToString(sum[:8])
+	}
+
+	// Render kubelet.service
+	data := struct {
+		BootstrapKubeConfig string
+		CloudProviderName   string
+		ClientCAFile        string
+		EnvHash             string
+		IsMaster            bool
+		KetoTokens          bool
+		KubeVersion         string
+		KubeletConfigFile   string
+		KubeletExtraArgs    string
+		NodeLabels          string
+		NodeTaints          string
+		PkiDir              string
+	}{
+		BootstrapKubeConfig: bootstrapKubeConfig,
+		CloudProviderName:   k.KubeadmCfg.CloudProvider,
+		ClientCAFile:        kubeadm.CaCertFile,
+		EnvHash:             envHash,
+		IsMaster:            master,
+		KetoTokens:          ketoTokens,
+		KubeVersion:         k.KubeadmCfg.KubeVersion,
+		KubeletConfigFile:   kubeletConfigFile,
+		KubeletExtraArgs:    kubeletArgs,
+		NodeLabels:          nodeLabels,
+		NodeTaints:          nodeTaints,
+		PkiDir:              kubeadm.PkiDir,
+	}
+	t := template.Must(template.New("kubeletUnit").Parse(kubeletTemplate))
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return nil, fmt.Errorf("Error generating kubelet unit [%v] from template:\n%v", err, kubeletTemplate)
+	}
+	return b.Bytes(), nil
+}
@@ -16,8 +16,9 @@ Environment="RKT_OPTS=\
 --volume var-log,kind=host,source=/var/log --mount volume=var-log,target=/var/log \
 --volume var-lib-cni,kind=host,source=/var/lib/cni --mount volume=var-lib-cni,target=/var/lib/cni"
 EnvironmentFile=/etc/environment
-{{ if not .IsMaster }}
+{{ if .KetoTokens }}
 EnvironmentFile=/etc/kubernetes/keto-token.env
+# keto-token.env hash (the kubelet is restarted when it changes): {{ .EnvHash }}
 {{ end }}
 ExecStartPre=/bin/mkdir -p /etc/kubernetes/manifests
 ExecStartPre=/bin/mkdir -p /etc/cni/net.d
@@ -25,18 +26,23 @@ ExecStartPre=/bin/mkdir -p /opt/cni/bin
 ExecStartPre=/bin/mkdir -p /etc/kubernetes/checkpoint-secrets
 ExecStartPre=/bin/mkdir -p /srv/kubernetes/manifests
 ExecStartPre=/bin/mkdir -p /var/lib/cni
+ExecStartPre=/bin/mkdir -p {{ .PkiDir }}
 ExecStartPre=/usr/bin/rkt fetch ${KUBELET_IMAGE_URL}:${KUBELET_IMAGE_TAG} --trust-keys-from-https
 
 ExecStartPre=-/usr/bin/rkt rm --uuid-file=/var/run/kubelet-pod.uuid
 ExecStart=/usr/lib/coreos/kubelet-wrapper \
 --allow-privileged=true \
+--anonymous-auth=false \
+--authentication-token-webhook=true \
+--authorization-mode=Webhook \
+--client-ca-file={{ .ClientCAFile }} \
 --cloud-config=/etc/kubernetes/cloud-config \
 --cloud-provider={{ .CloudProviderName }} \
 --cluster-dns=10.96.0.10 \
 --cluster-domain=cluster.local \
 --cni-conf-dir=/etc/cni/net.d \
 {{ if not .IsMaster }} \
---experimental-bootstrap-kubeconfig=${KETO_TOKENS_KUBELET_CONF} \
+--experimental-bootstrap-kubeconfig={{ .BootstrapKubeConfig }} \
 {{ end }} \
 --hostname-override="${COREOS_PRIVATE_IPV4}" \
 --image-gc-high-threshold=60 \
@@ -50,12 +56,15 @@ ExecStart=/usr/lib/coreos/kubelet-wrapper \
 --register-with-taints={{ .NodeTaints }} \
 {{ end }} \
 --pod-manifest-path=/etc/kubernetes/manifests \
+--read-only-port=0 \
 {{ if .IsMaster }} \
 --register-schedulable=false \
 {{ end }} \
+{{ if .KubeletConfigFile }} \
+--config={{ .KubeletConfigFile }} \
+{{ end }} \
 {{ .KubeletExtraArgs }} \
---require-kubeconfig=true \
---system-reserved=cpu=50m,memory=100Mi
+--require-kubeconfig=true
 
 ExecStop=-/usr/bin/rkt stop --uuid-file=/var/run/kubelet-pod.uuid
 Restart=always
@@ -0,0 +1,45 @@
+package kmm
+
+import (
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/k8client"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm"
+)
+
+// servingCSRCheckInterval is how often a master approves the pending kubelet serving cert requests
+const servingCSRCheckInterval = 30 * time.Second
+
+// approveCSR approves a certificate signing request (replaced in tests)
+var approveCSR = k8client.ApproveCSR
+
+// servingCSRsEnabled is true when compute kubelets request serving certs for a master to approve
+func (k *ConfigType) servingCSRsEnabled() bool {
+	return k.KubeadmCfg != nil && k.KubeadmCfg.KubeletServingCerts && k.K8Client != nil
+}
+
+// approveServingCSRs will approve the pending kubelet serving cert requests for the addresses of the requesting
+// node, the controller-manager only approves client certs so anything else is left for an operator
+func (k *ConfigType) approveServingCSRs() error {
+	csrs, err := k.K8Client.List([]string{"certificatesigningrequests"}, "")
+	if err != nil {
+		return err
+	}
+	if len(csrs) == 0 {
+		return nil
+	}
+	nodes, err := k.K8Client.List([]string{"nodes"}, "")
+	if err != nil {
+		return err
+	}
+	for _, csr := range csrs {
+		if verr := kubeadm.ValidateServingCSR(csr, nodes); verr != nil {
+			continue
+		}
+		logger.Printf("Approving the kubelet serving cert request %s", csr.Name())
+		if err = approveCSR(csr.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
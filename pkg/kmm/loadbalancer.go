@@ -0,0 +1,34 @@
+package kmm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/lbregister"
+)
+
+// LoadBalancerHealthTimeout is how long a master waits for its local api server to be healthy before registering with
+// the load balancer target groups
+var LoadBalancerHealthTimeout = 5 * time.Minute
+
+// registerLoadBalancer will add a bootstrapped master to the load balancer target groups once its local api server
+// /healthz responds, so the load balancer only routes to masters which have completed the bootstrap
+func (k *ConfigType) registerLoadBalancer() error {
+	if len(k.LBTargetGroups) == 0 {
+		return nil
+	}
+	k.phase("register")
+	local, tlsConfig := k.localAPIServer()
+	if err := waitForHealthz(local+"/healthz", tlsConfig, LoadBalancerHealthTimeout); err != nil {
+		return fmt.Errorf("the local api server wasn't healthy after %v, not registering with the load balancer: %v",
+			LoadBalancerHealthTimeout, err)
+	}
+	return lbregister.Register(k.LBTargetGroups)
+}
+
+// deregisterLoadBalancer will remove a stopping master from the load balancer target groups
+func (k *ConfigType) deregisterLoadBalancer() {
+	if err := lbregister.Deregister(k.LBTargetGroups); err != nil {
+		logger.Errorf("Failed to deregister from the load balancer: %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package kmm
+
+import (
+	"os"
+	"path/filepath"
+
+	certutil "github.com/UKHomeOffice/keto-k8/pkg/client-go/util/cert"
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm/pkiutil"
+)
+
+// EnsureLocalCA will create a self signed kube CA when the cert and key don't exist
+// Only for local clusters - a cloud provider (or keto) normally supplies the CA
+func EnsureLocalCA(certFile, keyFile string) error {
+	if fileutil.ExistFile(certFile) && fileutil.ExistFile(keyFile) {
+		logger.Printf("Using existing kube CA %s", certFile)
+		return nil
+	}
+	caCert, caKey, err := pkiutil.NewCertificateAuthority()
+	if err != nil {
+		return err
+	}
+	for _, dir := range []string{filepath.Dir(certFile), filepath.Dir(keyFile)} {
+		if err = os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+	if err = certutil.WriteKey(keyFile, certutil.EncodePrivateKeyPEM(caKey)); err != nil {
+		return err
+	}
+	if err = certutil.WriteCert(certFile, certutil.EncodeCertPEM(caCert)); err != nil {
+		return err
+	}
+	logger.Printf("Created self signed kube CA %s", certFile)
+	return nil
+}
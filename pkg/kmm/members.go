@@ -0,0 +1,213 @@
+package kmm
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/etcd"
+	"github.com/UKHomeOffice/keto-k8/pkg/failure"
+	"github.com/UKHomeOffice/keto-k8/pkg/summary"
+	"github.com/UKHomeOffice/keto-k8/pkg/version"
+)
+
+// MemberKeyPrefix is the etcd key prefix for the heartbeat of each node
+const MemberKeyPrefix = "kmm-members/"
+
+// Member states
+const (
+	MemberBootstrapping = "bootstrapping"
+	MemberReady         = "ready"
+	MemberFailed        = "failed"
+	MemberTerminating   = "terminating"
+)
+
+// Member is the heartbeat a node keeps in etcd while it's part of the cluster
+type Member struct {
+	Node          string    `json:"node"`
+	Role          string    `json:"role"`
+	Cluster       string    `json:"cluster,omitempty"`
+	State         string    `json:"state"`
+	Phase         string    `json:"phase,omitempty"`
+	KubeVersion   string    `json:"kubeVersion,omitempty"`
+	KetoK8Version string    `json:"ketoK8Version,omitempty"`
+	Updated       time.Time `json:"updated"`
+	// Error and Hint are why a failed bootstrap failed and how to fix it
+	Error string `json:"error,omitempty"`
+	Hint  string `json:"hint,omitempty"`
+}
+
+// heartbeat keeps the member key for this node up to date
+type heartbeat struct {
+	mu     sync.Mutex
+	member Member
+	stop   chan struct{}
+}
+
+// local is the member state of this node (served on the status endpoint even without a heartbeat)
+var local = struct {
+	sync.Mutex
+	member Member
+}{}
+
+// startHeartbeat will put the member key every interval (expiring after three missed beats)
+// Nothing is put in etcd when the interval isn't set
+func (k *ConfigType) startHeartbeat(role string) {
+	member := Member{
+		Node:          k.nodeName(),
+		Role:          role,
+		Cluster:       k.clusterName(),
+		State:         MemberBootstrapping,
+		KetoK8Version: version.Get().Version,
+	}
+	updateLocalMember(func(m *Member) { *m = member })
+	if k.HeartbeatInterval <= 0 || k.Etcd == nil {
+		return
+	}
+	k.heartbeat = &heartbeat{
+		member: member,
+		stop:   make(chan struct{}),
+	}
+	go func(h *heartbeat) {
+		ticker := time.NewTicker(k.HeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			k.beat(h)
+			select {
+			case <-ticker.C:
+			case <-h.stop:
+				return
+			}
+		}
+	}(k.heartbeat)
+}
+
+// setMemberState will update the state (and versions) of this node and beat straight away
+func (k *ConfigType) setMemberState(state string) {
+	k.updateMember(func(m *Member) {
+		m.State = state
+		if k.KubeadmCfg != nil {
+			m.KubeVersion = k.KubeadmCfg.KubeVersion
+		}
+	})
+}
+
+// setMemberFailed will set the failed state with the error and its remediation hint and beat straight away
+func (k *ConfigType) setMemberFailed(err error) {
+	k.updateMember(func(m *Member) {
+		m.State = MemberFailed
+		m.Error = err.Error()
+		m.Hint = failure.Hint(err)
+	})
+}
+
+// setMemberCluster will set the cluster of this node once the node data is loaded and beat straight away
+func (k *ConfigType) setMemberCluster() {
+	k.updateMember(func(m *Member) {
+		m.Cluster = k.clusterName()
+	})
+}
+
+// setMemberPhase will update the bootstrap phase of this node (so its progress can be followed) and beat straight away
+func (k *ConfigType) setMemberPhase(phase string) {
+	k.updateMember(func(m *Member) {
+		m.Phase = phase
+	})
+}
+
+// updateMember will update the member of this node (locally and in etcd with a heartbeat)
+func (k *ConfigType) updateMember(update func(m *Member)) {
+	updateLocalMember(update)
+	h := k.heartbeat
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	update(&h.member)
+	h.mu.Unlock()
+	k.beat(h)
+}
+
+// updateLocalMember will update the member state of this node
+func updateLocalMember(update func(m *Member)) {
+	local.Lock()
+	defer local.Unlock()
+	update(&local.member)
+	local.member.Updated = time.Now().UTC()
+}
+
+// NodeStatus is the bootstrap progress of this node served on the status endpoint for the keto CLI, the same schema as
+// the member key with the phases run so far
+type NodeStatus struct {
+	SchemaVersion string `json:"schemaVersion"`
+	Member
+	Phases []summary.Phase `json:"phases"`
+	// PostCoreSteps are the network, keto-tokens and addon steps of a primary master (any failures are retried)
+	PostCoreSteps []PostCoreStep `json:"postCoreSteps,omitempty"`
+}
+
+// CurrentStatus returns the bootstrap progress of this node (nothing but the schema before a bootstrap starts)
+func CurrentStatus() NodeStatus {
+	local.Lock()
+	member := local.member
+	local.Unlock()
+	return NodeStatus{
+		SchemaVersion: ResultSchemaVersion,
+		Member:        member,
+		Phases:        summary.Current().Phases,
+		PostCoreSteps: PostCoreSteps(),
+	}
+}
+
+// stopHeartbeat will stop updating the member key (which then expires)
+func (k *ConfigType) stopHeartbeat() {
+	if k.heartbeat != nil {
+		close(k.heartbeat.stop)
+		k.heartbeat = nil
+	}
+}
+
+// beat will put the member key (errors are only logged)
+func (k *ConfigType) beat(h *heartbeat) {
+	h.mu.Lock()
+	h.member.Updated = time.Now().UTC()
+	b, err := json.Marshal(h.member)
+	node := h.member.Node
+	h.mu.Unlock()
+	if err != nil {
+		logger.Warnf("error encoding heartbeat: %v", err)
+		return
+	}
+	if err = k.Etcd.PutWithTTL(MemberKeyPrefix+node, string(b), 3*k.HeartbeatInterval); err != nil {
+		logger.Warnf("error saving heartbeat: %v", err)
+	}
+}
+
+// ListMembers returns the nodes with a current heartbeat (sorted by role and node)
+func ListMembers(client etcd.Clienter) ([]Member, error) {
+	values, err := client.GetPrefix(MemberKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	members := []Member{}
+	for key, value := range values {
+		var m Member
+		if err := json.Unmarshal([]byte(value), &m); err != nil {
+			logger.Warnf("ignoring invalid member %s: %v", key, err)
+			continue
+		}
+		if m.Node == "" {
+			m.Node = strings.TrimPrefix(key, MemberKeyPrefix)
+		}
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Role != members[j].Role {
+			return members[i].Role < members[j].Role
+		}
+		return members[i].Node < members[j].Node
+	})
+	return members, nil
+}
@@ -0,0 +1,106 @@
+package kmm
+
+import (
+	"fmt"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/datadisk"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm"
+)
+
+// NodePool is a compute node profile selected at boot by the labels the node has from the cloud tags (or node data)
+// so every pool can share the same launch config
+type NodePool struct {
+	Name string `json:"name"`
+	// Match are the node labels a node must have to be in the pool (a pool without any matches every node)
+	Match map[string]string `json:"match,omitempty"`
+	// Labels and Taints are added to those from the cloud provider
+	Labels map[string]string `json:"labels,omitempty"`
+	Taints map[string]string `json:"taints,omitempty"`
+	// Kubelet resources override those in the kubelet section
+	Kubelet          *kubeadm.KubeletResources `json:"kubelet,omitempty"`
+	KubeletExtraArgs string                    `json:"kubeletExtraArgs,omitempty"`
+	// GPU and DataDisk override --gpu and --data-disk
+	GPU      string `json:"gpu,omitempty"`
+	DataDisk string `json:"dataDisk,omitempty"`
+}
+
+// NodePools are the compute node profiles, the first matching a node is used
+var NodePools []NodePool
+
+// ValidateNodePools will check each pool is named (once) with valid settings
+func ValidateNodePools(pools []NodePool) error {
+	names := map[string]bool{}
+	for _, pool := range pools {
+		if len(pool.Name) == 0 {
+			return fmt.Errorf("node pools must have a name")
+		}
+		if names[pool.Name] {
+			return fmt.Errorf("node pool %s is specified more than once", pool.Name)
+		}
+		names[pool.Name] = true
+		if err := ValidateGPU(pool.GPU); err != nil {
+			return fmt.Errorf("invalid node pool %s [%v]", pool.Name, err)
+		}
+		if pool.Kubelet != nil {
+			if err := (&kubeadm.KubeletConfig{KubeletResources: *pool.Kubelet}).Validate(); err != nil {
+				return fmt.Errorf("invalid node pool %s [%v]", pool.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// matchNodePool returns the first pool matching the node labels (nil when none do)
+func matchNodePool(pools []NodePool, labels map[string]string) *NodePool {
+	for i, pool := range pools {
+		matched := true
+		for k, v := range pool.Match {
+			if value, ok := labels[k]; !ok || value != v {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return &pools[i]
+		}
+	}
+	return nil
+}
+
+// applyNodePool will add the settings of the node pool matching this node (once its node data is known)
+func (k *Kmm) applyNodePool() {
+	pool := matchNodePool(NodePools, k.NodeLabels)
+	if pool == nil {
+		if len(NodePools) > 0 {
+			logger.Printf("No node pool matches labels %v", k.NodeLabels)
+		}
+		return
+	}
+	logger.Printf("Using node pool %s", pool.Name)
+	k.NodeLabels = mergeLabels(k.NodeLabels, pool.Labels)
+	k.NodeTaints = mergeLabels(k.NodeTaints, pool.Taints)
+	if pool.Kubelet != nil {
+		k.KubeadmCfg.Kubelet = k.KubeadmCfg.Kubelet.Override(*pool.Kubelet)
+	}
+	if len(pool.KubeletExtraArgs) > 0 {
+		k.KubeletExtraArgs = k.KubeletExtraArgs + " " + pool.KubeletExtraArgs
+	}
+	if len(pool.GPU) > 0 {
+		GPU = pool.GPU
+	}
+	if len(pool.DataDisk) > 0 {
+		datadisk.Device = pool.DataDisk
+	}
+}
+
+// mergeLabels returns a copy of the labels (or taints) with any added
+func mergeLabels(labels, added map[string]string) map[string]string {
+	merged := map[string]string{}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	for k, v := range added {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,32 @@
+package kmm
+
+import (
+	"path"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/command"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm"
+)
+
+// NodeReadyTimeout is how long a compute node waits to register and be ready once the kubelet is started (0 to not wait)
+var NodeReadyTimeout = 10 * time.Minute
+
+// kubeletJournalLines is how much of the kubelet journal is logged when the node doesn't become ready
+const kubeletJournalLines = "50"
+
+// WaitForNodeReady will wait until this node has registered and is ready, the end of the kubelet journal is logged
+// when it doesn't (to see why without logging in to the node)
+func (k *Kmm) WaitForNodeReady() error {
+	if NodeReadyTimeout <= 0 {
+		return nil
+	}
+	err := kubeadm.WaitForNodeReady(k.nodeName(), NodeReadyTimeout)
+	if err == nil {
+		return nil
+	}
+	logger.Errorf("Node %s didn't become ready, the last %s lines of the kubelet journal follow", k.nodeName(), kubeletJournalLines)
+	if _, jerr := command.Run(logger, "", "journalctl", "--no-pager", "-n", kubeletJournalLines, "-u", path.Base(KubeletUnitFile)); jerr != nil {
+		logger.Warnf("Couldn't read the kubelet journal: %v", jerr)
+	}
+	return err
+}
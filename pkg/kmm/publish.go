@@ -0,0 +1,31 @@
+package kmm
+
+import (
+	"io/ioutil"
+	"path"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm"
+	kubeadmconstants "github.com/UKHomeOffice/keto-k8/pkg/kubeadm/constants"
+	"github.com/UKHomeOffice/keto-k8/pkg/publish"
+)
+
+// publishKubeConfig will publish the admin kubeconfig (or an operator kubeconfig with its group bound to a reduced
+// privilege role) so operators can reach a new cluster without logging in to a master
+func (k *Config) publishKubeConfig() (err error) {
+	if k.Publish == nil {
+		return nil
+	}
+	var kubeconfig []byte
+	if o := k.Publish.Operator; o != nil {
+		if err = k.K8Client.Apply(o.ClusterRoleBinding()); err != nil {
+			return err
+		}
+		kubeconfig, err = k.KubeadmCfg.OperatorKubeConfig(o.UserName(), o.GroupName())
+	} else {
+		kubeconfig, err = ioutil.ReadFile(path.Join(kubeadm.KubeConfigDir, kubeadmconstants.AdminKubeConfigFileName))
+	}
+	if err != nil {
+		return err
+	}
+	return publish.Publish(k.Publish, k.clusterName(), kubeconfig)
+}
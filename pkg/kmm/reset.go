@@ -0,0 +1,93 @@
+package kmm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/audit"
+	"github.com/UKHomeOffice/keto-k8/pkg/backup"
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+	"github.com/UKHomeOffice/keto-k8/pkg/kms"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm"
+	"github.com/UKHomeOffice/keto-k8/pkg/oidc"
+)
+
+// resetFiles returns the files written to a node by keto-k8 (and kubeadm) which are removed by a reset
+func resetFiles() ([]string, error) {
+	var files []string
+	err := filepath.Walk(kubeadm.PkiDir, func(file string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files = append(files, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, pattern := range []string{
+		filepath.Join(kubeadm.KubeConfigDir, "*.conf"),
+		filepath.Join(kubeadm.ManifestsDir, "*.yaml"),
+		filepath.Join(audit.Dir, "*"),
+		filepath.Join(oidc.Dir, "*"),
+		filepath.Join(kubeadm.APIProxyDir, "*"),
+	} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	return append(files, kms.ConfigFile), nil
+}
+
+// Reset will remove the PKI, kubeconfigs, manifests and other config written to this node
+// Any key material (including kubeconfigs with embedded keys) is overwritten before it's removed, a linked CA key
+// is only unlinked (the persistent key is kept). Keys are also purged from the backups unless keepKeyBackups is set.
+func Reset(keepKeyBackups bool) error {
+	files, err := resetFiles()
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		info, err := os.Lstat(file)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			if fileutil.IsKeyMaterial(data) {
+				logger.Printf("Securely removing %s", file)
+				if err = fileutil.ShredFile(file); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		logger.Printf("Removing %s", file)
+		if err = os.Remove(file); err != nil {
+			return err
+		}
+	}
+	if keepKeyBackups {
+		return nil
+	}
+	purged, err := backup.PurgeKeys()
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		logger.Printf("Securely removed %d backed up key files", purged)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package kmm
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm"
+	"github.com/UKHomeOffice/keto-k8/pkg/summary"
+)
+
+// ResultSchemaVersion identifies the schema of the machine readable output (only changed by incompatible changes)
+const ResultSchemaVersion = "keto-k8/v1"
+
+// Bootstrap result states
+const (
+	ResultComplete = "complete"
+	ResultFailed   = "failed"
+)
+
+// OutputJSON will print the bootstrap result as json to stdout (with the logs still on stderr)
+var OutputJSON = false
+
+// resultOutput is where the result is printed (replaced in tests)
+var resultOutput io.Writer = os.Stdout
+
+// Result is the machine readable result of a bootstrap for infrastructure tooling (--output json)
+type Result struct {
+	SchemaVersion string `json:"schemaVersion"`
+	Cluster       string `json:"cluster"`
+	APIEndpoint   string `json:"apiEndpoint"`
+	// CAFingerprint is the hash of the kube CA public key (the same as a --discovery-token-ca-cert-hash)
+	CAFingerprint string `json:"caFingerprint"`
+	Node          string `json:"node"`
+	Role          string `json:"role"`
+	State         string `json:"state"`
+	Error         string `json:"error,omitempty"`
+	// Hint is how to fix the failure (when known)
+	Hint          string `json:"hint,omitempty"`
+	KubeVersion   string `json:"kubeVersion"`
+	KetoK8Version string `json:"ketoK8Version"`
+}
+
+// printResult will print the result of a bootstrap from its summary when json output is enabled
+func (k *ConfigType) printResult(s summary.Summary) {
+	if !OutputJSON {
+		return
+	}
+	r := Result{
+		SchemaVersion: ResultSchemaVersion,
+		Cluster:       s.Cluster,
+		Node:          s.Node,
+		Role:          s.Role,
+		State:         ResultComplete,
+		KubeVersion:   s.KubeVersion,
+		KetoK8Version: s.KetoK8Version,
+	}
+	if !s.Success {
+		r.State = ResultFailed
+		if len(s.Errors) > 0 {
+			r.Error = s.Errors[len(s.Errors)-1]
+		}
+		for _, p := range s.Phases {
+			if len(p.Hint) > 0 {
+				r.Hint = p.Hint
+			}
+		}
+	}
+	if k.KubeadmCfg != nil && k.KubeadmCfg.APIServer != nil {
+		r.APIEndpoint = k.KubeadmCfg.APIServer.String()
+	}
+	var err error
+	if r.CAFingerprint, err = caFingerprint(kubeadm.CaCertFile); err != nil && !os.IsNotExist(err) {
+		logger.Warnf("error reading the kube CA fingerprint: %v", err)
+	}
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		logger.Warnf("error encoding the bootstrap result: %v", err)
+		return
+	}
+	fmt.Fprintln(resultOutput, string(b))
+}
+
+// caFingerprint returns the hash of the first cert in a CA file (the CA itself in a chain)
+func caFingerprint(file string) (string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return "", fmt.Errorf("no certificate in %s", file)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+	return kubeadm.CACertHash(cert), nil
+}
+
+// MembersResult is the machine readable list of cluster members (kmm cluster members --output json)
+type MembersResult struct {
+	SchemaVersion string   `json:"schemaVersion"`
+	Members       []Member `json:"members"`
+}
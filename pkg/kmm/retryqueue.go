@@ -0,0 +1,210 @@
+package kmm
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/events"
+	"github.com/UKHomeOffice/keto-k8/pkg/notify"
+	"github.com/UKHomeOffice/keto-k8/pkg/steps"
+)
+
+// Post-core step states
+const (
+	StepDone     = "done"
+	StepRetrying = "retrying"
+	StepFailed   = "failed"
+)
+
+// postCoreRetryInterval is how long to wait between retrying the failed post-core steps (replaced in tests)
+var postCoreRetryInterval = 10 * time.Second
+
+// PostCoreStep is the state of a step run once the control plane is healthy (the network, keto-tokens and addons)
+type PostCoreStep struct {
+	Name      string `json:"name"`
+	State     string `json:"state"`
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+// retryQueue retries the failed post-core steps in the background, a step is only retried once the steps it depends
+// on are done
+type retryQueue struct {
+	mu    sync.Mutex
+	steps []steps.Step
+	state map[string]*PostCoreStep
+	done  chan struct{}
+}
+
+// postCore is the retry queue of this node (served on the status endpoint)
+var postCore = struct {
+	sync.Mutex
+	queue *retryQueue
+}{}
+
+// runPostCoreSteps will run the post-core steps, without a retry timeout the first failure fails the bootstrap as
+// before. Otherwise each step is tried once and any failures (and the steps depending on them) are retried in the
+// background so the core assets are still shared and the secondary masters aren't blocked.
+func (k *Config) runPostCoreSteps(postCoreSteps ...steps.Step) error {
+	if k.PostCoreRetryTimeout <= 0 {
+		return steps.Run(k.Parallelism, postCoreSteps...)
+	}
+	q := newRetryQueue(postCoreSteps)
+	postCore.Lock()
+	postCore.queue = q
+	postCore.Unlock()
+
+	// The failures are recorded rather than returned so every step is tried
+	attempts := make([]steps.Step, len(postCoreSteps))
+	for i, s := range postCoreSteps {
+		attempts[i] = steps.Step{Name: s.Name, DependsOn: s.DependsOn, Run: q.attempter(s)}
+	}
+	if err := steps.Run(k.Parallelism, attempts...); err != nil {
+		return err
+	}
+	pending := q.pending()
+	if len(pending) == 0 {
+		close(q.done)
+		return nil
+	}
+	message := fmt.Sprintf("Retrying the %s steps in the background for up to %v", strings.Join(pending, ", "), k.PostCoreRetryTimeout)
+	logger.Warnf("%s", message)
+	k.event(events.Warning, events.StepRetrying, message)
+	go k.retryPostCoreSteps(q, time.Now().Add(k.PostCoreRetryTimeout))
+	return nil
+}
+
+// retryPostCoreSteps will retry the failed steps every interval until they're all done or the deadline passes, the
+// steps still failing then are reported
+func (k *Config) retryPostCoreSteps(q *retryQueue, deadline time.Time) {
+	defer close(q.done)
+	for len(q.pending()) > 0 {
+		if time.Now().After(deadline) {
+			for _, name := range q.giveUp() {
+				state := q.status(name)
+				message := fmt.Sprintf("%s step failed after %d attempts: %s", name, state.Attempts, state.LastError)
+				logger.Errorf("%s", message)
+				k.event(events.Warning, events.StepFailed, message)
+				notify.Send(notify.StepFailed, notify.Warning, message)
+			}
+			return
+		}
+		time.Sleep(postCoreRetryInterval)
+		for _, s := range q.steps {
+			q.attempter(s)()
+		}
+	}
+	logger.Printf("All post-core steps done")
+}
+
+// waitForPostCoreSteps will wait for any background retries to finish (before kmm exits)
+func waitForPostCoreSteps() {
+	postCore.Lock()
+	q := postCore.queue
+	postCore.Unlock()
+	if q != nil {
+		<-q.done
+	}
+}
+
+// PostCoreSteps returns the state of the post-core steps of this node (none before the control plane is healthy)
+func PostCoreSteps() []PostCoreStep {
+	postCore.Lock()
+	q := postCore.queue
+	postCore.Unlock()
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var states []PostCoreStep
+	for _, s := range q.steps {
+		states = append(states, *q.state[s.Name])
+	}
+	return states
+}
+
+// postCoreFailure returns an error naming the post-core steps given up on (nil when they're all done)
+func postCoreFailure() error {
+	var failed []string
+	for _, s := range PostCoreSteps() {
+		if s.State == StepFailed {
+			failed = append(failed, s.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("gave up retrying the post-core steps: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// newRetryQueue returns a queue with every step still to run
+func newRetryQueue(postCoreSteps []steps.Step) *retryQueue {
+	q := &retryQueue{steps: postCoreSteps, state: map[string]*PostCoreStep{}, done: make(chan struct{})}
+	for _, s := range postCoreSteps {
+		q.state[s.Name] = &PostCoreStep{Name: s.Name, State: StepRetrying}
+	}
+	return q
+}
+
+// attempter returns a func which will run a step (unless it's done, given up or waiting on another step) and record
+// the result
+func (q *retryQueue) attempter(s steps.Step) func() error {
+	return func() error {
+		q.mu.Lock()
+		ready := q.state[s.Name].State == StepRetrying
+		for _, d := range s.DependsOn {
+			ready = ready && q.state[d].State == StepDone
+		}
+		q.mu.Unlock()
+		if !ready {
+			return nil
+		}
+		err := s.Run()
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		state := q.state[s.Name]
+		state.Attempts++
+		if err != nil {
+			logger.Warnf("%s step failed (attempt %d): %v", s.Name, state.Attempts, err)
+			state.LastError = err.Error()
+			return nil
+		}
+		state.State = StepDone
+		state.LastError = ""
+		return nil
+	}
+}
+
+// pending returns the names of the steps not done yet (in order)
+func (q *retryQueue) pending() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var names []string
+	for _, s := range q.steps {
+		if q.state[s.Name].State == StepRetrying {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+// giveUp will mark the steps not done yet as failed and returns their names
+func (q *retryQueue) giveUp() []string {
+	names := q.pending()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, name := range names {
+		q.state[name].State = StepFailed
+	}
+	return names
+}
+
+// status returns a copy of the state of a step
+func (q *retryQueue) status(name string) PostCoreStep {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return *q.state[name]
+}
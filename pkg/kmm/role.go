@@ -0,0 +1,54 @@
+package kmm
+
+import (
+	"fmt"
+
+	"github.com/UKHomeOffice/keto/pkg/cloudprovider"
+)
+
+// Node roles
+const (
+	RoleMaster  = "master"
+	RoleCompute = "compute"
+)
+
+// DefaultRoleLabel is the node label (from the cloud tags or node data) with the role of a node
+const DefaultRoleLabel = "role"
+
+// RoleLabel is the node label the role is detected from
+var RoleLabel = DefaultRoleLabel
+
+// DetectRole returns the role of this node from its labels (so masters and compute nodes can share the same user-data),
+// a node is a master when labelled master and compute otherwise
+func DetectRole(cloudProvider, nodeDataFile string) (string, error) {
+	var nd cloudprovider.NodeData
+	switch {
+	case nodeDataFile != "":
+		s, err := LoadStaticNodeData(nodeDataFile)
+		if err != nil {
+			return "", err
+		}
+		nd = s.NodeData()
+	case cloudProvider != "":
+		node, err := getNodeInterface(cloudProvider)
+		if err != nil {
+			return "", err
+		}
+		if nd, err = node.GetNodeData(); err != nil {
+			return "", fmt.Errorf("error getting node data from cloud provider: %q", err)
+		}
+	default:
+		return "", fmt.Errorf("a cloud provider or node data file is required to detect the node role")
+	}
+	return roleFromLabels(nd.Labels), nil
+}
+
+// roleFromLabels returns the role of a node with the labels
+func roleFromLabels(labels map[string]string) string {
+	if labels[RoleLabel] == RoleMaster {
+		logger.Printf("Node labelled %s=%s, bootstrapping a master", RoleLabel, RoleMaster)
+		return RoleMaster
+	}
+	logger.Printf("Node not labelled %s=%s, bootstrapping a compute node", RoleLabel, RoleMaster)
+	return RoleCompute
+}
@@ -0,0 +1,169 @@
+package kmm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/etcd"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm"
+)
+
+// SARotationKey is the etcd key of the service account key rotation in progress
+const SARotationKey = "kmm-sa-rotation"
+
+// SARotationNodePrefix is the etcd key prefix for the rotation phase each master has applied
+const SARotationNodePrefix = "kmm-sa-rotation-nodes/"
+
+// saRotationPhases are the service account key rotation phases in order (see kubeadm.SARotationTrust)
+var saRotationPhases = []string{kubeadm.SARotationTrust, kubeadm.SARotationSign, kubeadm.SARotationComplete}
+
+// SARotation is the new service account key shared by the masters and the rotation phase they should apply
+type SARotation struct {
+	Phase   string    `json:"phase"`
+	OldPub  string    `json:"oldPub"`
+	Pub     string    `json:"pub"`
+	Key     string    `json:"key"`
+	Updated time.Time `json:"updated"`
+}
+
+// GetSARotation returns the service account key rotation in progress (nil when there isn't one)
+func GetSARotation(client etcd.Clienter) (*SARotation, error) {
+	value, err := client.Get(SARotationKey)
+	if err == etcd.ErrKeyMissing {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	r := &SARotation{}
+	if err = json.Unmarshal([]byte(value), r); err != nil {
+		return nil, fmt.Errorf("invalid service account key rotation in etcd [%v]", err)
+	}
+	return r, nil
+}
+
+// StartSARotation will share a new service account key (from the key file or generated) for the masters to trust
+// (once no other rotation is in progress)
+func StartSARotation(client etcd.Clienter, keyFile string) error {
+	assets, err := client.Get(assetKey)
+	if err == etcd.ErrKeyMissing {
+		return fmt.Errorf("there are no shared assets to rotate the service account key of")
+	} else if err != nil {
+		return err
+	}
+	oldPub, err := kubeadm.ServiceAccountPub(assets)
+	if err != nil {
+		return err
+	}
+	key, pub, err := kubeadm.NewServiceAccountKey(keyFile)
+	if err != nil {
+		return err
+	}
+	if pub == oldPub {
+		return fmt.Errorf("the new service account key is the current key")
+	}
+	value, err := json.Marshal(SARotation{
+		Phase:   kubeadm.SARotationTrust,
+		OldPub:  oldPub,
+		Pub:     pub,
+		Key:     key,
+		Updated: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	if err = client.PutTx(SARotationKey, string(value)); err == etcd.ErrKeyAlreadyExists {
+		return fmt.Errorf("a service account key rotation is already in progress")
+	}
+	return err
+}
+
+// SARotationNodes returns the rotation phase applied by each master
+func SARotationNodes(client etcd.Clienter) (map[string]string, error) {
+	return rotationNodes(client, SARotationNodePrefix)
+}
+
+// PendingSARotation returns the masters which haven't applied the current rotation phase and bootstrapped since
+func PendingSARotation(client etcd.Clienter, r *SARotation) ([]string, error) {
+	return pendingRotation(client, SARotationNodePrefix, r.Phase)
+}
+
+// AdvanceSARotation will move the service account key rotation to its next phase once every master has applied the
+// current phase (unless forced), the new key replaces the old key in the shared assets for the complete phase and the
+// rotation is removed after it. The new phase is returned.
+func AdvanceSARotation(client etcd.Clienter, force bool) (string, error) {
+	r, err := GetSARotation(client)
+	if err != nil {
+		return "", err
+	}
+	if r == nil {
+		return "", fmt.Errorf("no service account key rotation is in progress")
+	}
+	if !force {
+		pending, err := PendingSARotation(client, r)
+		if err != nil {
+			return "", err
+		}
+		if len(pending) > 0 {
+			return "", fmt.Errorf("the masters %s haven't applied the %s phase yet (restart kmm on them)",
+				strings.Join(pending, ", "), r.Phase)
+		}
+	}
+	if r.Phase == kubeadm.SARotationComplete {
+		return "", finishRotation(client, SARotationKey, SARotationNodePrefix)
+	}
+	for i, phase := range saRotationPhases {
+		if phase == r.Phase {
+			r.Phase = saRotationPhases[i+1]
+			break
+		}
+	}
+	if r.Phase == kubeadm.SARotationComplete {
+		// Masters (re)joining from now on get the new key
+		assets, err := client.Get(assetKey)
+		if err != nil {
+			return "", err
+		}
+		if assets, err = kubeadm.ReplaceServiceAccountKey(assets, r.Key, r.Pub); err != nil {
+			return "", err
+		}
+		if err = client.Put(assetKey, assets); err != nil {
+			return "", err
+		}
+	}
+	r.Updated = time.Now().UTC()
+	value, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	return r.Phase, client.Put(SARotationKey, string(value))
+}
+
+// loadSARotation will set the service account key rotation this master should apply (none without an etcd client
+// or a kubeadm config)
+func (k *ConfigType) loadSARotation() error {
+	if k.Etcd == nil || k.KubeadmCfg == nil {
+		return nil
+	}
+	r, err := GetSARotation(k.Etcd)
+	if err != nil || r == nil {
+		return err
+	}
+	logger.Printf("Applying the %s phase of the service account key rotation", r.Phase)
+	k.KubeadmCfg.ServiceAccountRotation = &kubeadm.ServiceAccountRotation{
+		Phase:  r.Phase,
+		OldPub: r.OldPub,
+		Pub:    r.Pub,
+		Key:    r.Key,
+	}
+	return nil
+}
+
+// recordSARotation will record the rotation phase this master has applied
+func (k *ConfigType) recordSARotation() error {
+	if k.KubeadmCfg == nil || k.KubeadmCfg.ServiceAccountRotation == nil {
+		return nil
+	}
+	return k.Etcd.Put(SARotationNodePrefix+k.nodeName(), k.KubeadmCfg.ServiceAccountRotation.Phase)
+}
@@ -0,0 +1,51 @@
+package kmm
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/UKHomeOffice/keto/pkg/cloudprovider"
+	"github.com/ghodss/yaml"
+)
+
+// StaticNodeData is the node data normally supplied by a cloud provider, loaded from a yaml file instead
+// (e.g. for local clusters without any cloud infrastructure)
+type StaticNodeData struct {
+	ClusterName                string            `json:"clusterName"`
+	KubeAPIURL                 string            `json:"kubeAPIURL"`
+	KubeVersion                string            `json:"kubeVersion"`
+	Labels                     map[string]string `json:"labels,omitempty"`
+	Taints                     map[string]string `json:"taints,omitempty"`
+	APIServerExtraArgs         string            `json:"apiServerExtraArgs,omitempty"`
+	ControllerManagerExtraArgs string            `json:"controllerManagerExtraArgs,omitempty"`
+	SchedulerExtraArgs         string            `json:"schedulerExtraArgs,omitempty"`
+	KubeletExtraArgs           string            `json:"kubeletExtraArgs,omitempty"`
+}
+
+// LoadStaticNodeData will read the node data from a yaml file
+func LoadStaticNodeData(fileName string) (*StaticNodeData, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading node data file %s [%v]", fileName, err)
+	}
+	nd := &StaticNodeData{}
+	if err = yaml.Unmarshal(b, nd); err != nil {
+		return nil, fmt.Errorf("error parsing node data file %s [%v]", fileName, err)
+	}
+	return nd, nil
+}
+
+// NodeData returns the data as if from a cloud provider
+func (s *StaticNodeData) NodeData() cloudprovider.NodeData {
+	var nd cloudprovider.NodeData
+	nd.ClusterName = s.ClusterName
+	nd.KubeAPIURL = s.KubeAPIURL
+	nd.KubeVersion = s.KubeVersion
+	nd.Labels = s.Labels
+	nd.Taints = s.Taints
+	nd.KubeArgs.APIServerExtraArgs = s.APIServerExtraArgs
+	nd.KubeArgs.ControllerManagerExtraArgs = s.ControllerManagerExtraArgs
+	nd.KubeArgs.SchedulerExtraArgs = s.SchedulerExtraArgs
+	nd.KubeArgs.KubeletExtraArgs = s.KubeletExtraArgs
+	return nd
+}
@@ -0,0 +1,103 @@
+package kmm
+
+import (
+	"os"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/artifacts"
+	"github.com/UKHomeOffice/keto-k8/pkg/cloudsignal"
+	"github.com/UKHomeOffice/keto-k8/pkg/failure"
+	"github.com/UKHomeOffice/keto-k8/pkg/notify"
+	"github.com/UKHomeOffice/keto-k8/pkg/profile"
+	"github.com/UKHomeOffice/keto-k8/pkg/summary"
+	"github.com/UKHomeOffice/keto-k8/pkg/tracing"
+	"github.com/UKHomeOffice/keto-k8/pkg/version"
+)
+
+// summaryKeyPrefix is the etcd key prefix for the summary of each node (when enabled)
+const summaryKeyPrefix = "kmm-summary/"
+
+// phase will start a new bootstrap phase (for the logs, traces, summary, profile and member state)
+func (k *ConfigType) phase(name string) {
+	tracing.Phase(name)
+	summary.StartPhase(name)
+	profile.StartPhase(name)
+	k.setMemberPhase(name)
+}
+
+// currentPhase returns the bootstrap phase being run (empty before the first phase)
+func currentPhase() string {
+	phases := summary.Current().Phases
+	if len(phases) == 0 {
+		return ""
+	}
+	return phases[len(phases)-1].Name
+}
+
+// wrapFailure returns a failure with what failed and a hint, the hint of the error is kept when it already has one (it's
+// more specific)
+func wrapFailure(err error, message, hint string) error {
+	if len(failure.Hint(err)) > 0 {
+		hint = ""
+	}
+	return failure.Wrap(err, message, hint)
+}
+
+// reportFailure will log and notify a failed bootstrap with the remediation hint and set the failed member state
+func (k *ConfigType) reportFailure(role string, err error) {
+	logger.WithField("hint", failure.Hint(err)).Errorf("%s bootstrap failed in the %s phase: %v", role, failure.Phase(err), err)
+	notify.Send(notify.BootstrapFailed, notify.Critical, role+" bootstrap failed: "+failure.Describe(err))
+	k.setMemberFailed(err)
+}
+
+// signalCompletion will signal the bootstrap result to the CloudFormation stack and auto scaling group (when
+// configured), failures are only logged as the stack or lifecycle hook will time out anyway
+func signalCompletion(bootstrapErr error) {
+	if err := cloudsignal.Send(bootstrapErr); err != nil {
+		logger.Warnf("%v", err)
+	}
+}
+
+// reportProfile will print the time taken by each phase (with the logs) when profiling
+func (k *ConfigType) reportProfile() {
+	if profile.Enabled() {
+		profile.Report(os.Stderr)
+	}
+}
+
+// saveSummary will save the bootstrap summary to the artifacts directory (and optionally etcd) and print the result
+// Failures are only logged so the bootstrap result is never changed
+func (k *ConfigType) saveSummary(bootstrapErr error) {
+	node := k.nodeName()
+	summary.Update(func(s *summary.Summary) {
+		s.Node = node
+		s.Cluster = k.clusterName()
+		s.KetoK8Version = version.Get().Version
+		if k.KubeadmCfg != nil {
+			s.KubeVersion = k.KubeadmCfg.KubeVersion
+		}
+	})
+	finished := summary.Finish(bootstrapErr)
+	k.printResult(finished)
+	content, err := finished.JSON()
+	if err != nil {
+		logger.Warnf("error encoding bootstrap summary: %v", err)
+		return
+	}
+	if err = artifacts.Save(summary.ArtifactName, content); err != nil {
+		logger.Warnf("error saving bootstrap summary: %v", err)
+	}
+	if k.SummaryToEtcd && k.Etcd != nil {
+		if err = k.Etcd.Put(summaryKeyPrefix+node, content); err != nil {
+			logger.Warnf("error saving bootstrap summary to etcd: %v", err)
+		}
+	}
+}
+
+// nodeName returns the name used to identify this node (the kubelet ID or hostname)
+func (k *ConfigType) nodeName() string {
+	if k.KubeadmCfg != nil && k.KubeadmCfg.KubeletID != "" {
+		return k.KubeadmCfg.KubeletID
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
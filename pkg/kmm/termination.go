@@ -0,0 +1,119 @@
+package kmm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm"
+	"github.com/coreos/go-systemd/dbus"
+)
+
+var (
+	// TerminationCheckInterval is how often a compute node checks the instance metadata for a spot termination or
+	// auto scaling group scale-in notice (0 to not check)
+	TerminationCheckInterval = 5 * time.Second
+	// DrainGracePeriod is the grace period of each pod evicted when terminating (negative for the pod's own)
+	DrainGracePeriod = -1 * time.Second
+	// DrainTimeout is how long pods are evicted for when terminating (a spot notice gives two minutes)
+	DrainTimeout = 90 * time.Second
+
+	// metadataURL is the EC2 instance metadata (replaced in tests)
+	metadataURL = "http://169.254.169.254/latest/meta-data"
+)
+
+// terminationNotice returns why the instance is about to terminate (empty when it isn't)
+func terminationNotice(client *http.Client) (string, error) {
+	// A spot interruption is only in the metadata once notified
+	status, action, err := getMetadata(client, "spot/instance-action")
+	if err != nil {
+		return "", err
+	}
+	if status == http.StatusOK {
+		return "spot interruption " + action, nil
+	}
+	// The lifecycle state is only in the metadata for instances in an auto scaling group
+	status, state, err := getMetadata(client, "autoscaling/target-lifecycle-state")
+	if err != nil {
+		return "", err
+	}
+	if status == http.StatusOK && state == "Terminated" {
+		return "auto scaling group scale-in", nil
+	}
+	return "", nil
+}
+
+// getMetadata returns the status and value of an instance metadata path
+func getMetadata(client *http.Client, metadataPath string) (int, string, error) {
+	resp, err := client.Get(metadataURL + "/" + metadataPath)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, strings.TrimSpace(string(body)), err
+}
+
+// watchTermination returns a channel sent the reason once the instance is about to terminate (nil when not checking)
+func watchTermination() <-chan string {
+	if TerminationCheckInterval <= 0 {
+		return nil
+	}
+	notices := make(chan string, 1)
+	go func() {
+		client := &http.Client{Timeout: TerminationCheckInterval}
+		reported := false
+		for {
+			reason, err := terminationNotice(client)
+			if err != nil && !reported {
+				// Not on EC2 (or the metadata isn't reachable), keep checking but don't fill the logs
+				logger.Warnf("Can't check the instance metadata for termination notices: %v", err)
+				reported = true
+			}
+			if len(reason) > 0 {
+				notices <- reason
+				return
+			}
+			time.Sleep(TerminationCheckInterval)
+		}
+	}()
+	return notices
+}
+
+// shutdownCompute will move the workloads off a terminating node and deregister it: cordon and drain, stop the
+// kubelet (or it would register the node again) and delete the node. Each step is tried even when one before fails.
+func (k *ConfigType) shutdownCompute(reason string) {
+	logger.Printf("Node %s is terminating (%s), draining it", k.nodeName(), reason)
+	k.setMemberState(MemberTerminating)
+	if err := kubeadm.DrainNode(k.nodeName(), DrainGracePeriod, DrainTimeout); err != nil {
+		logger.Errorf("Error draining node %s: %v", k.nodeName(), err)
+	}
+	if err := stopKubelet(); err != nil {
+		logger.Errorf("Error stopping the kubelet: %v", err)
+	}
+	if err := kubeadm.DeleteNode(k.nodeName()); err != nil {
+		logger.Errorf("Error deleting node %s: %v", k.nodeName(), err)
+	}
+}
+
+// stopKubelet will stop the kubelet unit
+func stopKubelet() error {
+	target := path.Base(KubeletUnitFile)
+	conn, err := dbus.New()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	reschan := make(chan string)
+	logger.Printf("Stopping %q", target)
+	if _, err = conn.StopUnit(target, "replace", reschan); err != nil {
+		return fmt.Errorf("Can't stop unit [%v] - [%v]", target, err)
+	}
+	if job := <-reschan; job != "done" {
+		return fmt.Errorf("Error stopping [%v] (%s)", target, job)
+	}
+	return nil
+}
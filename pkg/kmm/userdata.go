@@ -0,0 +1,149 @@
+package kmm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+)
+
+// UserDataKey is the section of the instance user data with the keto-k8 configuration
+const UserDataKey = "keto-k8"
+
+// UserDataEC2 is the user data source read from the EC2 instance metadata (any other source is a file)
+const UserDataEC2 = "ec2"
+
+var (
+	// userDataURL is the EC2 instance user data (replaced in tests)
+	userDataURL = "http://169.254.169.254/latest/user-data"
+	// userDataTimeout is how long to wait for the instance metadata
+	userDataTimeout = 10 * time.Second
+)
+
+// UserData is the keto-k8 section of the instance user data (json or yaml), the flags and the config file sections so
+// orchestration layers can pass the whole configuration with the instance
+type UserData struct {
+	// Flags are the values of any kmm flags not set on the command line, lists are comma separated e.g.
+	// keto-k8:
+	//   flags:
+	//     network-provider: canal
+	//     enable-addons: [kube-state-metrics]
+	//   nodePools:
+	//   - name: gpu
+	//     match:
+	//       pool: gpu
+	Flags map[string]interface{} `json:"flags,omitempty"`
+	FileConfig
+}
+
+// LoadUserData will read the keto-k8 section of the user data from a source, the EC2 instance metadata or a file e.g.
+// /var/lib/cloud/instance/user-data.txt (nil when there's no keto-k8 section)
+func LoadUserData(source string) (*UserData, error) {
+	data, err := readUserData(source)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the %s user data [%v]", source, err)
+	}
+	ud, err := ParseUserData(data)
+	if err != nil {
+		return nil, fmt.Errorf("error in the %s user data [%v]", source, err)
+	}
+	if ud == nil {
+		logger.Printf("No %s section in the %s user data", UserDataKey, source)
+	}
+	return ud, nil
+}
+
+// ParseUserData returns the keto-k8 section of the user data (nil when there isn't one e.g. a shell script), the user
+// data can be gzipped
+func ParseUserData(data []byte) (*UserData, error) {
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = ioutil.ReadAll(r); err != nil {
+			return nil, err
+		}
+	}
+	doc := map[string]json.RawMessage{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		logger.Debugf("The user data isn't json or yaml: %v", err)
+		return nil, nil
+	}
+	section, ok := doc[UserDataKey]
+	if !ok {
+		return nil, nil
+	}
+	ud := &UserData{}
+	if err := json.Unmarshal(section, ud); err != nil {
+		return nil, err
+	}
+	if _, err := ud.FlagValues(); err != nil {
+		return nil, err
+	}
+	if err := ud.FileConfig.Validate(); err != nil {
+		return nil, err
+	}
+	return ud, nil
+}
+
+// FlagValues returns the flag values as strings, lists are joined with commas as the list flags expect
+func (ud *UserData) FlagValues() (map[string]string, error) {
+	values := map[string]string{}
+	for name, value := range ud.Flags {
+		switch v := value.(type) {
+		case string:
+			values[name] = v
+		case bool:
+			values[name] = strconv.FormatBool(v)
+		case float64:
+			values[name] = strconv.FormatFloat(v, 'f', -1, 64)
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			values[name] = strings.Join(items, ",")
+		case map[string]interface{}:
+			// e.g. node labels, the same key=value pairs as the flags
+			pairs := make([]string, 0, len(v))
+			for key, item := range v {
+				pairs = append(pairs, fmt.Sprintf("%s=%v", key, item))
+			}
+			sort.Strings(pairs)
+			values[name] = strings.Join(pairs, ",")
+		default:
+			return nil, fmt.Errorf("flag %q has an invalid value %v", name, value)
+		}
+	}
+	return values, nil
+}
+
+// readUserData returns the raw user data from the EC2 instance metadata or a file
+func readUserData(source string) ([]byte, error) {
+	if source != UserDataEC2 {
+		return ioutil.ReadFile(source)
+	}
+	client := &http.Client{Timeout: userDataTimeout}
+	resp, err := client.Get(userDataURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	// An instance launched without user data has none
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", userDataURL, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,196 @@
+package kms
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+	"github.com/UKHomeOffice/keto-k8/pkg/render"
+	"k8s.io/kubernetes/pkg/util/version"
+)
+
+const (
+	// ProviderName is the name of the KMS provider in the encryption config
+	ProviderName = "aws-encryption-provider"
+
+	// DefaultImage is the AWS KMS plugin image run alongside the apiserver
+	DefaultImage = "quay.io/ukhomeofficedigital/aws-encryption-provider:v0.0.1"
+
+	// SocketDir is shared between the plugin and the apiserver (and kmm for health checks)
+	SocketDir = "/var/run/kmsplugin"
+
+	// SocketFile is the unix socket the plugin serves on
+	SocketFile = SocketDir + "/socket.sock"
+
+	// ConfigDir holds the encryption config (mounted into the apiserver)
+	ConfigDir = "/etc/kubernetes/encryption"
+
+	// ConfigFile is the apiserver encryption provider config
+	ConfigFile = ConfigDir + "/config.yaml"
+
+	// EncryptedPrefix is how values encrypted by the plugin are stored in etcd
+	EncryptedPrefix = "k8s:enc:kms:v1:" + ProviderName
+
+	apiServerContainer = "kube-apiserver"
+	pluginContainer    = "kms-plugin"
+	socketVolume       = "kms-socket"
+	configVolume       = "encryption-config"
+)
+
+var (
+	// First version with the KMS encryption provider
+	minKMSVersion = version.MustParseGeneric("v1.10.0")
+	// First version where the encryption provider flag isn't experimental
+	minGAFlagVersion = version.MustParseGeneric("v1.13.0")
+)
+
+// Config for encrypting secrets with an AWS KMS key
+type Config struct {
+	KeyARN string
+	Image  string
+}
+
+const encryptionConfigTemplate = `kind: EncryptionConfig
+apiVersion: v1
+resources:
+- resources:
+  - secrets
+  providers:
+  - kms:
+      name: {{ .Name }}
+      endpoint: unix://{{ .Socket }}
+      cachesize: 1000
+  # Allows reading secrets written before encryption was enabled
+  - identity: {}
+`
+
+// Validate checks KMS can be used at a kubernetes version with this key
+func (c Config) Validate(kubeVersion string) error {
+	v, err := version.ParseGeneric(kubeVersion)
+	if err != nil {
+		return fmt.Errorf("couldn't parse kubernetes version %q: %v", kubeVersion, err)
+	}
+	if v.LessThan(minKMSVersion) {
+		return fmt.Errorf("KMS encryption requires kubernetes %s or later (not %s)", minKMSVersion, kubeVersion)
+	}
+	_, err = c.Region()
+	return err
+}
+
+// Region returns the AWS region from the key ARN e.g. arn:aws:kms:eu-west-2:111122223333:key/1234abcd
+func (c Config) Region() (string, error) {
+	parts := strings.Split(c.KeyARN, ":")
+	if len(parts) < 6 || parts[0] != "arn" || parts[2] != "kms" || len(parts[3]) == 0 {
+		return "", fmt.Errorf("invalid KMS key ARN %q", c.KeyARN)
+	}
+	return parts[3], nil
+}
+
+// APIServerArgs returns the apiserver flags to enable encryption
+func APIServerArgs(kubeVersion string) map[string]string {
+	flag := "experimental-encryption-provider-config"
+	if v, err := version.ParseGeneric(kubeVersion); err == nil && v.AtLeast(minGAFlagVersion) {
+		flag = "encryption-provider-config"
+	}
+	return map[string]string{flag: ConfigFile}
+}
+
+// RenderConfig returns the encryption config (saved to ConfigFile)
+func RenderConfig() (string, error) {
+	data := struct {
+		Name   string
+		Socket string
+	}{
+		Name:   ProviderName,
+		Socket: SocketFile,
+	}
+	return render.Template("encryptionConfig", encryptionConfigTemplate, data)
+}
+
+// WriteConfig will save the encryption config for the apiserver
+func WriteConfig() error {
+	cfg, err := RenderConfig()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(ConfigDir, 0700); err != nil {
+		return err
+	}
+	return fileutil.WriteFile(ConfigFile, []byte(cfg), 0600)
+}
+
+// ImageName returns the plugin image (the default unless set)
+func (c Config) ImageName() string {
+	if len(c.Image) == 0 {
+		return DefaultImage
+	}
+	return c.Image
+}
+
+// Mutator returns a podspec.Mutator adding the plugin as a sidecar of the apiserver static pod
+func (c Config) Mutator() podspec.Mutator {
+	return func(o podspec.Object) error {
+		if o.Container(apiServerContainer) == nil {
+			return nil
+		}
+		region, err := c.Region()
+		if err != nil {
+			return err
+		}
+		image := c.ImageName()
+		o.AddVolume(map[string]interface{}{
+			"name":     socketVolume,
+			"hostPath": map[string]interface{}{"path": SocketDir},
+		})
+		o.AddVolume(map[string]interface{}{
+			"name":     configVolume,
+			"hostPath": map[string]interface{}{"path": ConfigDir},
+		})
+		o.AddContainer(map[string]interface{}{
+			"name":  pluginContainer,
+			"image": image,
+			"command": []interface{}{
+				"/aws-encryption-provider",
+				"--key=" + c.KeyARN,
+				"--region=" + region,
+				"--listen=" + SocketFile,
+			},
+			"volumeMounts": []interface{}{
+				map[string]interface{}{"name": socketVolume, "mountPath": SocketDir},
+			},
+		})
+		if err := o.AddVolumeMount(apiServerContainer, map[string]interface{}{
+			"name":      socketVolume,
+			"mountPath": SocketDir,
+		}); err != nil {
+			return err
+		}
+		return o.AddVolumeMount(apiServerContainer, map[string]interface{}{
+			"name":      configVolume,
+			"mountPath": ConfigDir,
+			"readOnly":  true,
+		})
+	}
+}
+
+// WaitForPlugin will wait until the plugin is accepting connections
+func WaitForPlugin(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.DialTimeout("unix", SocketFile, time.Second)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("KMS plugin not available at %s after %v: %v", SocketFile, timeout, err)
+		}
+		log.Printf("Waiting for KMS plugin at %s...", SocketFile)
+		time.Sleep(2 * time.Second)
+	}
+}
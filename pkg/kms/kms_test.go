@@ -0,0 +1,76 @@
+package kms
+
+import (
+	"testing"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+)
+
+const testKeyARN = "arn:aws:kms:eu-west-2:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+
+const testAPIServer = `apiVersion: v1
+kind: Pod
+metadata:
+  name: kube-apiserver
+  namespace: kube-system
+spec:
+  containers:
+  - name: kube-apiserver
+    image: gcr.io/google_containers/kube-apiserver-amd64:v1.10.0
+    volumeMounts:
+    - name: k8s
+      mountPath: /etc/kubernetes/
+      readOnly: true
+  volumes:
+  - name: k8s
+    hostPath:
+      path: /etc/kubernetes
+`
+
+func TestValidate(t *testing.T) {
+	cfg := Config{KeyARN: testKeyARN}
+	if err := cfg.Validate("v1.10.2"); err != nil {
+		t.Errorf("expected a valid config but got %v", err)
+	}
+	if err := cfg.Validate("v1.9.3"); err == nil {
+		t.Errorf("expected an error for an unsupported version")
+	}
+	if err := (Config{KeyARN: "alias/keto"}).Validate("v1.10.2"); err == nil {
+		t.Errorf("expected an error for a key without an ARN")
+	}
+	if region, _ := cfg.Region(); region != "eu-west-2" {
+		t.Errorf("expected region eu-west-2 but got %q", region)
+	}
+}
+
+func TestMutator(t *testing.T) {
+	out, err := podspec.Transform(testAPIServer, Config{KeyARN: testKeyARN}.Mutator())
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs, err := podspec.Decode(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod := objs[0]
+	if pod.Container(pluginContainer) == nil {
+		t.Errorf("expected the plugin container to be added:\n%s", out)
+	}
+	mounts, _ := pod.Container(apiServerContainer)["volumeMounts"].([]interface{})
+	if len(mounts) != 3 {
+		t.Errorf("expected 3 apiserver volume mounts but got %v", mounts)
+	}
+	volumes, _ := pod.PodSpec()["volumes"].([]interface{})
+	if len(volumes) != 3 {
+		t.Errorf("expected 3 volumes but got %v", volumes)
+	}
+}
+
+func TestAPIServerArgs(t *testing.T) {
+	if _, ok := APIServerArgs("v1.10.0")["experimental-encryption-provider-config"]; !ok {
+		t.Errorf("expected the experimental flag for v1.10")
+	}
+	if _, ok := APIServerArgs("v1.13.1")["encryption-provider-config"]; !ok {
+		t.Errorf("expected the GA flag for v1.13")
+	}
+}
@@ -1,9 +1,18 @@
+// +build !slim
+
 package kubeadm
 
 import (
 	"fmt"
 	"path"
 
+	"github.com/UKHomeOffice/keto-k8/pkg/images"
+	"github.com/UKHomeOffice/keto-k8/pkg/k8client"
+	"github.com/UKHomeOffice/keto-k8/pkg/placement"
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+	"github.com/UKHomeOffice/keto-k8/pkg/priority"
+	"github.com/UKHomeOffice/keto-k8/pkg/psp"
+	"github.com/UKHomeOffice/keto-k8/pkg/rbac"
 	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
 	kubeadmconstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
 	kubemaster "k8s.io/kubernetes/cmd/kubeadm/app/master"
@@ -12,6 +21,16 @@ import (
 	"k8s.io/kubernetes/pkg/util/version"
 )
 
+// criticalAddons are the kubeadm essential addons to be marked with a priority class
+var criticalAddons = []struct {
+	Kind  string
+	Name  string
+	Class string
+}{
+	{Kind: "deployment", Name: "kube-dns", Class: priority.ClusterCritical},
+	{Kind: "daemonset", Name: "kube-proxy", Class: priority.NodeCritical},
+}
+
 // Addons - deploys the essential addons
 func (k *Config) Addons() error {
 
@@ -48,8 +67,130 @@ func (k *Config) Addons() error {
 		return err
 	}
 
+	// Any priority classes must exist before the addons reference them
+	classes, err := priority.CustomClassesYaml(k.KubeVersion)
+	if err != nil {
+		return err
+	}
+	if len(classes) > 0 {
+		if err = k8client.Apply(classes); err != nil {
+			return err
+		}
+	}
+
+	// With the admission plugin enabled, no pods can start until policies exist
+	if k.PodSecurityPolicy {
+		if err = deployPodSecurityPolicies(k.KubeVersion); err != nil {
+			return err
+		}
+	}
+
 	if err := addonsphase.CreateEssentialAddons(kubeadmapiCfg, client); err != nil {
 		return err
 	}
+	if err = markCriticalAddons(k.KubeVersion); err != nil {
+		return err
+	}
+	if err = pinAddonImages(k.ImageDigests); err != nil {
+		return err
+	}
+	return placeDNS(k.DNSPlacement)
+}
+
+// UploadConfig will write the kubeadm-config and kubelet-config configmaps to kube-system as kubeadm init phase
+// upload-config would, so kubeadm upgrade plan (and other tooling reading them) works with keto-k8 clusters
+func (k *Config) UploadConfig() error {
+	cfg, err := upstreamClusterConfig(*k)
+	if err != nil {
+		return err
+	}
+	masters, err := k8client.List([]string{"nodes"}, masterRoleLabel)
+	if err != nil {
+		return err
+	}
+	resources, err := k.uploadConfigResources(cfg, masters)
+	if err != nil {
+		return err
+	}
+	return k8client.Apply(resources)
+}
+
+// deployPodSecurityPolicies will create the baseline policies and the RBAC to use them
+func deployPodSecurityPolicies(kubeVersion string) error {
+	policies, err := psp.Yaml(kubeVersion)
+	if err != nil {
+		return err
+	}
+	objs, err := podspec.Decode(policies)
+	if err != nil {
+		return err
+	}
+	if err = rbac.Save("pod-security-policy", objs); err != nil {
+		return err
+	}
+	return k8client.Apply(policies)
+}
+
+// pinAddonImages will patch the kubeadm created addons to run their images by digest (when they have one)
+func pinAddonImages(digests map[string]string) error {
+	if len(digests) == 0 {
+		return nil
+	}
+	for _, addon := range criticalAddons {
+		objs, err := k8client.List([]string{addon.Kind}, "k8s-app="+addon.Name)
+		if err != nil {
+			return err
+		}
+		for _, o := range objs {
+			patch, err := images.PinPatch(o, digests)
+			if err != nil {
+				return err
+			}
+			if len(patch) == 0 {
+				continue
+			}
+			if err = k8client.Patch(addon.Kind, o.Name(), o.Namespace(), patch); err != nil {
+				return fmt.Errorf("couldn't pin the images of addon %s/%s: %v", addon.Kind, addon.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// placeDNS will patch the kubeadm created DNS to schedule where it's placed (when it has a placement)
+func placeDNS(p *placement.Placement) error {
+	if p == nil {
+		return nil
+	}
+	objs, err := k8client.List([]string{"deployment"}, "k8s-app="+DNSAddonName)
+	if err != nil {
+		return err
+	}
+	for _, o := range objs {
+		patch, err := p.Patch(o)
+		if err != nil {
+			return err
+		}
+		if len(patch) == 0 {
+			continue
+		}
+		if err = k8client.Patch("deployment", o.Name(), o.Namespace(), patch); err != nil {
+			return fmt.Errorf("couldn't place addon deployment/%s: %v", o.Name(), err)
+		}
+	}
+	return nil
+}
+
+// markCriticalAddons will patch the kubeadm created addons so they survive node pressure
+func markCriticalAddons(kubeVersion string) error {
+	for _, addon := range criticalAddons {
+		patch, err := priority.Patch(kubeVersion, addon.Class)
+		if err != nil {
+			return err
+		}
+		if err = k8client.Patch(addon.Kind, addon.Name, "kube-system", patch); err != nil {
+			return fmt.Errorf("couldn't set priority for addon %s/%s: %v", addon.Kind, addon.Name, err)
+		}
+	}
 	return nil
 }
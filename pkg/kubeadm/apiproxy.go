@@ -0,0 +1,159 @@
+package kubeadm
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+	"github.com/UKHomeOffice/keto-k8/pkg/priority"
+	"github.com/UKHomeOffice/keto-k8/pkg/secprofile"
+)
+
+const (
+	// APIProxyName is the static pod serving the api server on the additional port
+	APIProxyName = "kube-apiserver-proxy"
+	// DefaultAPIProxyImage is the haproxy image of the api server proxy
+	DefaultAPIProxyImage = "haproxy:1.8-alpine"
+	// apiProxyConfigMount is where the haproxy image reads its config from
+	apiProxyConfigMount = "/usr/local/etc/haproxy"
+)
+
+var (
+	// APIProxyDir has the haproxy config of the api server proxy (the directory is mounted so the config can be
+	// replaced)
+	APIProxyDir = KubeConfigDir + "/apiserver-proxy"
+	// APIProxyConfigFile is the haproxy config of the api server proxy
+	APIProxyConfigFile = APIProxyDir + "/haproxy.cfg"
+)
+
+// apiProxyConfig passes TCP connections through to the local api server (TLS is still terminated by the api server so
+// its cert and client cert authentication work the same on both ports)
+var apiProxyConfig = template.Must(template.New("haproxy").Parse(`global
+  maxconn 4000
+
+defaults
+  mode tcp
+  timeout connect 5s
+  timeout client 1h
+  timeout server 1h
+
+frontend kube-apiserver
+  bind *:{{ .Port }}
+  default_backend kube-apiserver
+
+backend kube-apiserver
+  server local 127.0.0.1:{{ .BindPort }} check
+`))
+
+// APIProxy serves the api server on an additional port on each master (e.g. 6443 for local tooling when the api
+// server listens on 443 for the load balancer) with a haproxy static pod
+type APIProxy struct {
+	// Port is the additional port, 0 disables the proxy
+	Port int
+	// Image is the haproxy image (DefaultAPIProxyImage unless set)
+	Image string
+}
+
+// Enabled is true when the api server is served on an additional port
+func (p APIProxy) Enabled() bool {
+	return p.Port > 0
+}
+
+// Validate will check the additional port is valid and isn't the port the api server listens on
+func (p APIProxy) Validate(bindPort int) error {
+	if !p.Enabled() {
+		return nil
+	}
+	if p.Port > 65535 {
+		return fmt.Errorf("invalid api server proxy port %d", p.Port)
+	}
+	if p.Port == bindPort {
+		return fmt.Errorf("the api server proxy port %d is the port the api server listens on", p.Port)
+	}
+	return nil
+}
+
+// ImageName returns the haproxy image (the default unless set)
+func (p APIProxy) ImageName() string {
+	if len(p.Image) == 0 {
+		return DefaultAPIProxyImage
+	}
+	return p.Image
+}
+
+// RenderConfig returns the haproxy config forwarding the additional port to the api server
+func (p APIProxy) RenderConfig(bindPort int) (string, error) {
+	var b bytes.Buffer
+	if err := apiProxyConfig.Execute(&b, map[string]int{"Port": p.Port, "BindPort": bindPort}); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// RenderManifest returns the api server proxy static pod manifest (critical and with the runtime security profile the
+// same as the control plane pods)
+func (p APIProxy) RenderManifest(kubeVersion string) (string, error) {
+	pod := podspec.Object{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata": map[string]interface{}{
+			"name":      APIProxyName,
+			"namespace": "kube-system",
+			"labels":    map[string]interface{}{"component": APIProxyName, "tier": "control-plane"},
+		},
+		"spec": map[string]interface{}{
+			"hostNetwork": true,
+			"containers": []interface{}{
+				map[string]interface{}{
+					"name":    "haproxy",
+					"image":   p.ImageName(),
+					"command": []interface{}{"haproxy", "-f", apiProxyConfigMount + "/haproxy.cfg"},
+					"livenessProbe": map[string]interface{}{
+						"tcpSocket":           map[string]interface{}{"host": "127.0.0.1", "port": p.Port},
+						"initialDelaySeconds": 15,
+						"timeoutSeconds":      15,
+					},
+					"resources": map[string]interface{}{
+						"requests": map[string]interface{}{"cpu": "25m", "memory": "32Mi"},
+					},
+					"volumeMounts": []interface{}{
+						map[string]interface{}{"name": "config", "mountPath": apiProxyConfigMount, "readOnly": true},
+					},
+				},
+			},
+			"volumes": []interface{}{
+				map[string]interface{}{"name": "config", "hostPath": map[string]interface{}{"path": APIProxyDir}},
+			},
+		},
+	}
+	manifest, err := podspec.Encode([]podspec.Object{pod})
+	if err != nil {
+		return "", err
+	}
+	return podspec.Transform(manifest, priority.StaticPodMutator(kubeVersion), secprofile.Mutator(kubeVersion))
+}
+
+// WriteConfig will save the haproxy config of the api server proxy (the manifest is written with the control plane)
+func (p APIProxy) WriteConfig(bindPort int) error {
+	config, err := p.RenderConfig(bindPort)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(APIProxyDir, 0700); err != nil {
+		return err
+	}
+	return fileutil.WriteFile(APIProxyConfigFile, []byte(config), 0600)
+}
+
+// RemoveAPIProxy will remove the api server proxy static pod (when no longer enabled) so the kubelet stops it
+func RemoveAPIProxy() error {
+	err := os.Remove(filepath.Join(ManifestsDir, APIProxyName+".yaml"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package kubeadm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+)
+
+func TestAPIProxyValidate(t *testing.T) {
+	if err := (APIProxy{}).Validate(443); err != nil {
+		t.Errorf("expected a disabled proxy to be valid but got %v", err)
+	}
+	if err := (APIProxy{Port: 6443}).Validate(443); err != nil {
+		t.Error(err)
+	}
+	for _, port := range []int{443, 70000} {
+		if err := (APIProxy{Port: port}).Validate(443); err == nil {
+			t.Errorf("expected port %d to be invalid", port)
+		}
+	}
+}
+
+func TestAPIProxyRender(t *testing.T) {
+	p := APIProxy{Port: 6443}
+	config, err := p.RenderConfig(443)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"mode tcp", "bind *:6443", "server local 127.0.0.1:443"} {
+		if !strings.Contains(config, expected) {
+			t.Errorf("expected the haproxy config to contain %q but got:\n%s", expected, config)
+		}
+	}
+
+	manifest, err := p.RenderManifest("v1.8.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs, err := podspec.Decode(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 1 || objs[0].Name() != APIProxyName || objs[0].PodSpec()["hostNetwork"] != true {
+		t.Fatalf("expected the %s static pod on the host network but got:\n%s", APIProxyName, manifest)
+	}
+	haproxy := objs[0].Container("haproxy")
+	if haproxy == nil || haproxy["image"] != DefaultAPIProxyImage {
+		t.Errorf("expected the default haproxy image but got:\n%s", manifest)
+	}
+	for _, expected := range []string{"path: " + APIProxyDir, "mountPath: " + apiProxyConfigMount, "port: 6443"} {
+		if !strings.Contains(manifest, expected) {
+			t.Errorf("expected the manifest to contain %q but got:\n%s", expected, manifest)
+		}
+	}
+
+	p.Image = "registry.example.com/haproxy:1.8"
+	if manifest, err = p.RenderManifest("v1.8.4"); err != nil || !strings.Contains(manifest, "image: registry.example.com/haproxy:1.8") {
+		t.Errorf("expected the haproxy image to be set but got %v:\n%s", err, manifest)
+	}
+}
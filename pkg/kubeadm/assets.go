@@ -0,0 +1,46 @@
+package kubeadm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// compressedAssetsPrefix marks gzip compressed assets (assets shared by older versions are plain json)
+const compressedAssetsPrefix = "kmm-gzip:"
+
+// compressAssets returns the serialized assets gzip compressed (with the prefix)
+func compressAssets(assets []byte) (string, error) {
+	var b bytes.Buffer
+	b.WriteString(compressedAssetsPrefix)
+	w, err := gzip.NewWriterLevel(&b, gzip.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err = w.Write(assets); err != nil {
+		return "", err
+	}
+	if err = w.Close(); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// decompressAssets returns the serialized assets whether compressed or not
+func decompressAssets(assets string) ([]byte, error) {
+	if !strings.HasPrefix(assets, compressedAssetsPrefix) {
+		return []byte(assets), nil
+	}
+	r, err := gzip.NewReader(strings.NewReader(strings.TrimPrefix(assets, compressedAssetsPrefix)))
+	if err != nil {
+		return nil, fmt.Errorf("compressed assets could not be read [%v]", err)
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("compressed assets could not be read [%v]", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,34 @@
+package kubeadm
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompressAssets(t *testing.T) {
+	golden, err := ioutil.ReadFile(filepath.Join(pkiFixtureDir, "assets.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := compressAssets(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(compressed, compressedAssetsPrefix) || len(compressed) >= len(golden) {
+		t.Errorf("expected smaller prefixed assets but got %d bytes from %d", len(compressed), len(golden))
+	}
+	for _, assets := range []string{compressed, string(golden)} {
+		decompressed, err := decompressAssets(assets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(decompressed) != string(golden) {
+			t.Errorf("expected the original assets but got %s", decompressed)
+		}
+	}
+	if _, err = decompressAssets(compressedAssetsPrefix + "{}"); err == nil {
+		t.Error("expected an error for invalid compressed assets")
+	}
+}
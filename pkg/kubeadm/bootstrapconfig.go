@@ -0,0 +1,331 @@
+package kubeadm
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	certutil "github.com/UKHomeOffice/keto-k8/pkg/client-go/util/cert"
+	"github.com/UKHomeOffice/keto-k8/pkg/constants"
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+	"github.com/ghodss/yaml"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// BootstrapKubeConfigFileName is the kubelet bootstrap kubeconfig (where the keto-tokens env points the kubelet)
+const BootstrapKubeConfigFileName = "bootstrap-kubelet.conf"
+
+// bootstrapUser is the kubeconfig user of the bootstrap token (the same as kubeadm join)
+const bootstrapUser = "tls-bootstrap-token-user"
+
+// Compute join modes set how compute kubelets get the kubeconfig to TLS bootstrap with
+const (
+	// ComputeJoinModeKetoTokens has keto-tokens issue a token for each node (the default)
+	ComputeJoinModeKetoTokens = "keto-tokens"
+	// ComputeJoinModeToken only uses the bootstrap token, keto-tokens isn't deployed
+	ComputeJoinModeToken = "token"
+)
+
+// defaultNodeGroup is the group of bootstrap tokens for joining nodes (the same as kubeadm)
+const defaultNodeGroup = "system:bootstrappers:kubeadm:default-node-token"
+
+// bootstrapTokenRegexp is the format of a bootstrap token (<token id>.<token secret>)
+var bootstrapTokenRegexp = regexp.MustCompile(`^([a-z0-9]{6})\.([a-z0-9]{16})$`)
+
+// caCertHashRegexp is the format of a CA cert hash (the same as kubeadm --discovery-token-ca-cert-hash)
+var caCertHashRegexp = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// discoveryTimeout is how long the cluster-info request can take
+const discoveryTimeout = 10 * time.Second
+
+// ValidateBootstrap will check the bootstrap token, CA cert hashes and that the CA can be trusted
+func ValidateBootstrap(token, caCertFile string, caCertHashes []string) error {
+	if err := ValidateBootstrapToken(token); err != nil {
+		return err
+	}
+	for _, hash := range caCertHashes {
+		if !caCertHashRegexp.MatchString(hash) {
+			return fmt.Errorf("invalid CA cert hash %q (expecting sha256:<hex>)", hash)
+		}
+	}
+	if len(caCertFile) == 0 && len(caCertHashes) == 0 {
+		return fmt.Errorf("a bootstrap CA cert file or CA cert hash must be specified to trust the api server")
+	}
+	return nil
+}
+
+// ValidateBootstrapToken will check the format of a bootstrap token
+func ValidateBootstrapToken(token string) error {
+	if !bootstrapTokenRegexp.MatchString(token) {
+		return fmt.Errorf("the bootstrap token must be of the form [a-z0-9]{6}.[a-z0-9]{16}")
+	}
+	return nil
+}
+
+// ValidateComputeJoinMode will check the compute join mode is known (empty is the default)
+func ValidateComputeJoinMode(mode string) error {
+	switch mode {
+	case "", ComputeJoinModeKetoTokens, ComputeJoinModeToken:
+		return nil
+	}
+	return fmt.Errorf("unknown join mode %q (expecting %s or %s)", mode, ComputeJoinModeKetoTokens, ComputeJoinModeToken)
+}
+
+// TokenJoin returns true when compute kubelets join with the bootstrap token only (without keto-tokens)
+func (k *Config) TokenJoin() bool {
+	return k != nil && k.ComputeJoinMode == ComputeJoinModeToken
+}
+
+// BootstrapTokenSecret returns the kube-system secret for a bootstrap token (as kubeadm token create would), it
+// doesn't expire and signs the cluster-info for discovery
+func BootstrapTokenSecret(token string) (string, error) {
+	if err := ValidateBootstrapToken(token); err != nil {
+		return "", err
+	}
+	parts := bootstrapTokenRegexp.FindStringSubmatch(token)
+	data := map[string]string{}
+	for k, v := range map[string]string{
+		"description":                    "keto-k8 compute join",
+		"token-id":                       parts[1],
+		"token-secret":                   parts[2],
+		"usage-bootstrap-authentication": "true",
+		"usage-bootstrap-signing":        "true",
+		"auth-extra-groups":              defaultNodeGroup,
+	} {
+		data[k] = base64.StdEncoding.EncodeToString([]byte(v))
+	}
+	secret, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"type":       "bootstrap.kubernetes.io/token",
+		"metadata": map[string]interface{}{
+			"name":      "bootstrap-token-" + parts[1],
+			"namespace": "kube-system",
+			"labels":    map[string]string{constants.ManagedByLabel: constants.ManagedByValue},
+		},
+		"data": data,
+	})
+	return string(secret), err
+}
+
+// CACertHash returns the hash of a CA cert public key (as printed by kubeadm token create --print-join-command)
+func CACertHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// WriteBootstrapKubeConfig will write the kubelet bootstrap kubeconfig for the bootstrap token so the kubelet can
+// join with standard TLS bootstrapping. The CA is read from the CA cert file, otherwise it's discovered from the
+// cluster-info (signed by the token) and must match one of the CA cert hashes. The CA is also written for the kubelet
+// to verify the api server client cert with.
+func (k *Config) WriteBootstrapKubeConfig() error {
+	if err := ValidateBootstrap(k.BootstrapToken, k.BootstrapCACertFile, k.DiscoveryTokenCACertHashes); err != nil {
+		return err
+	}
+	if k.APIServer == nil {
+		return fmt.Errorf("the api server must be known to write the bootstrap kubeconfig")
+	}
+	var caData []byte
+	var err error
+	if len(k.BootstrapCACertFile) > 0 {
+		if caData, err = ioutil.ReadFile(k.BootstrapCACertFile); err != nil {
+			return err
+		}
+		if err = checkCACertHashes(caData, k.DiscoveryTokenCACertHashes); err != nil {
+			return err
+		}
+	} else if caData, err = discoverCA(k.APIServer.String(), k.BootstrapToken, k.DiscoveryTokenCACertHashes); err != nil {
+		return err
+	}
+	if err = writeClientCA(caData); err != nil {
+		return err
+	}
+
+	config := &clientcmdapi.Config{
+		Clusters: map[string]*clientcmdapi.Cluster{
+			kubeConfigClusterName: {
+				Server:                   k.APIServer.String(),
+				CertificateAuthorityData: caData,
+			},
+		},
+		Contexts: map[string]*clientcmdapi.Context{
+			bootstrapUser + "@" + kubeConfigClusterName: {
+				Cluster:  kubeConfigClusterName,
+				AuthInfo: bootstrapUser,
+			},
+		},
+		AuthInfos: map[string]*clientcmdapi.AuthInfo{
+			bootstrapUser: {Token: k.BootstrapToken},
+		},
+		CurrentContext: bootstrapUser + "@" + kubeConfigClusterName,
+	}
+	data, err := clientcmd.Write(*config)
+	if err != nil {
+		return err
+	}
+	file := path.Join(KubeConfigDir, BootstrapKubeConfigFileName)
+	if current, err := ioutil.ReadFile(file); err == nil && string(current) == string(data) {
+		return nil
+	}
+	logger.Printf("Writing the kubelet bootstrap kubeconfig %s", file)
+	return fileutil.WriteFile(file, data, 0600)
+}
+
+// WriteClientCA will write the CA the kubelet verifies the api server client cert with (when joining without a
+// bootstrap token) from the bootstrap CA cert file, otherwise from the keto-tokens kubeconfig. A CA already on the node
+// is kept when neither is available. It must match one of the CA cert hashes when there are any.
+func (k *Config) WriteClientCA() error {
+	var caData []byte
+	var err error
+	if len(k.BootstrapCACertFile) > 0 {
+		if caData, err = ioutil.ReadFile(k.BootstrapCACertFile); err != nil {
+			return err
+		}
+	} else if caData, err = ketoTokensCA(); err != nil {
+		return err
+	} else if len(caData) == 0 {
+		if caData, err = ioutil.ReadFile(CaCertFile); err != nil {
+			return fmt.Errorf("no kube CA in the keto-tokens kubeconfig or at %s, the bootstrap CA cert file must be "+
+				"specified for the kubelet to verify the api server", CaCertFile)
+		}
+		logger.Printf("Using the kube CA already on the node %s", CaCertFile)
+	}
+	if err = checkCACertHashes(caData, k.DiscoveryTokenCACertHashes); err != nil {
+		return err
+	}
+	return writeClientCA(caData)
+}
+
+// ketoTokensCA returns the CA of the kubeconfig written by keto-tokens (nothing when it hasn't been written)
+func ketoTokensCA() ([]byte, error) {
+	file := path.Join(KubeConfigDir, BootstrapKubeConfigFileName)
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil, nil
+	}
+	config, err := clientcmd.LoadFromFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid keto-tokens kubeconfig %s [%v]", file, err)
+	}
+	for _, cluster := range config.Clusters {
+		if len(cluster.CertificateAuthorityData) > 0 {
+			return cluster.CertificateAuthorityData, nil
+		}
+		if len(cluster.CertificateAuthority) > 0 {
+			return ioutil.ReadFile(cluster.CertificateAuthority)
+		}
+	}
+	return nil, nil
+}
+
+// writeClientCA will save the kube CA (unless unchanged)
+func writeClientCA(caData []byte) error {
+	if current, err := ioutil.ReadFile(CaCertFile); err == nil && string(current) == string(caData) {
+		return nil
+	}
+	if err := os.MkdirAll(path.Dir(CaCertFile), 0700); err != nil {
+		return err
+	}
+	logger.Printf("Writing the kube CA %s", CaCertFile)
+	return fileutil.WriteFile(CaCertFile, caData, 0644)
+}
+
+// checkCACertHashes will check any of the CA certs match one of the hashes (when there are any)
+func checkCACertHashes(caData []byte, hashes []string) error {
+	certs, err := certutil.ParseCertsPEM(caData)
+	if err != nil {
+		return fmt.Errorf("invalid bootstrap CA [%v]", err)
+	}
+	if len(hashes) == 0 {
+		return nil
+	}
+	for _, cert := range certs {
+		for _, hash := range hashes {
+			if CACertHash(cert) == hash {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("the bootstrap CA doesn't match any of the CA cert hashes %v", hashes)
+}
+
+// discoverCA returns the CA from the cluster-info in kube-public once its signature by the token and the CA cert
+// hashes are verified (the api server can't be trusted until then)
+func discoverCA(server, token string, hashes []string) ([]byte, error) {
+	client := &http.Client{
+		Timeout:   discoveryTimeout,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	resp, err := client.Get(server + "/api/v1/namespaces/kube-public/configmaps/cluster-info")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get the cluster-info [%v]", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("couldn't get the cluster-info, the api server returned %s", resp.Status)
+	}
+	var clusterInfo struct {
+		Data map[string]string `json:"data"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&clusterInfo); err != nil {
+		return nil, fmt.Errorf("invalid cluster-info [%v]", err)
+	}
+	kubeConfig := clusterInfo.Data["kubeconfig"]
+	parts := bootstrapTokenRegexp.FindStringSubmatch(token)
+	signature, ok := clusterInfo.Data["jws-kubeconfig-"+parts[1]]
+	if !ok {
+		return nil, fmt.Errorf("the cluster-info isn't signed for bootstrap token %s", parts[1])
+	}
+	if !validDetachedJWS(signature, kubeConfig, parts[2]) {
+		return nil, fmt.Errorf("the cluster-info signature isn't valid for bootstrap token %s", parts[1])
+	}
+	config, err := clientcmd.Load([]byte(kubeConfig))
+	if err != nil {
+		return nil, fmt.Errorf("invalid cluster-info kubeconfig [%v]", err)
+	}
+	for _, cluster := range config.Clusters {
+		if err = checkCACertHashes(cluster.CertificateAuthorityData, hashes); err != nil {
+			return nil, err
+		}
+		return cluster.CertificateAuthorityData, nil
+	}
+	return nil, fmt.Errorf("the cluster-info kubeconfig has no cluster")
+}
+
+// validDetachedJWS returns true when the detached JWS (header..signature) is a HS256 signature of the payload by the
+// token secret (how the bootstrap signer signs the cluster-info)
+func validDetachedJWS(jws, payload, secret string) bool {
+	parts := strings.Split(jws, ".")
+	if len(parts) != 3 || len(parts[1]) != 0 {
+		return false
+	}
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return false
+	}
+	var h struct {
+		Alg string `json:"alg"`
+	}
+	if err = json.Unmarshal(header, &h); err != nil || h.Alg != "HS256" {
+		return false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(payload))))
+	return hmac.Equal(signature, mac.Sum(nil))
+}
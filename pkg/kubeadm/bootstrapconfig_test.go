@@ -0,0 +1,244 @@
+package kubeadm
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	certutil "github.com/UKHomeOffice/keto-k8/pkg/client-go/util/cert"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm/pkiutil"
+	"github.com/ghodss/yaml"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+const testBootstrapToken = "abcdef.0123456789abcdef"
+
+// signDetached returns the detached HS256 JWS of the payload (as the bootstrap signer does)
+func signDetached(payload, secret string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","kid":"abcdef"}`))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(header + "." + base64.RawURLEncoding.EncodeToString([]byte(payload))))
+	return header + ".." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestValidateBootstrap(t *testing.T) {
+	hash := "sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	for _, c := range []struct {
+		token  string
+		caFile string
+		hashes []string
+		valid  bool
+	}{
+		{token: testBootstrapToken, caFile: "ca.crt", valid: true},
+		{token: testBootstrapToken, hashes: []string{hash}, valid: true},
+		{token: testBootstrapToken},
+		{token: "abcdef", caFile: "ca.crt"},
+		{token: testBootstrapToken, hashes: []string{"md5:1234"}},
+	} {
+		if err := ValidateBootstrap(c.token, c.caFile, c.hashes); (err == nil) != c.valid {
+			t.Errorf("expected %+v to be valid %v but got %v", c, c.valid, err)
+		}
+	}
+}
+
+func TestValidDetachedJWS(t *testing.T) {
+	jws := signDetached("payload", "0123456789abcdef")
+	if !validDetachedJWS(jws, "payload", "0123456789abcdef") {
+		t.Error("expected the signature to be valid")
+	}
+	if validDetachedJWS(jws, "changed", "0123456789abcdef") {
+		t.Error("expected the signature of a changed payload to be invalid")
+	}
+	if validDetachedJWS(jws, "payload", "fedcba9876543210") {
+		t.Error("expected the signature with another secret to be invalid")
+	}
+}
+
+func TestWriteBootstrapKubeConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeadm-bootstrap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(kubeConfigDir, caCertFile string) { KubeConfigDir, CaCertFile = kubeConfigDir, caCertFile }(KubeConfigDir, CaCertFile)
+	KubeConfigDir = dir
+	CaCertFile = filepath.Join(dir, "pki", "ca.crt")
+
+	ca, _, err := pkiutil.NewCertificateAuthority()
+	if err != nil {
+		t.Fatal(err)
+	}
+	caData := certutil.EncodeCertPEM(ca)
+	clusterInfo := clientcmdapi.NewConfig()
+	clusterInfo.Clusters[""] = &clientcmdapi.Cluster{Server: "https://kube.example.com", CertificateAuthorityData: caData}
+	kubeConfig, err := clientcmd.Write(*clusterInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/kube-public/configmaps/cluster-info" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]string{
+				"kubeconfig":            string(kubeConfig),
+				"jws-kubeconfig-abcdef": signDetached(string(kubeConfig), "0123456789abcdef"),
+			},
+		})
+	}))
+	defer server.Close()
+	apiServer, _ := url.Parse(server.URL)
+
+	k := &Config{APIServer: apiServer, BootstrapToken: testBootstrapToken}
+	k.DiscoveryTokenCACertHashes = []string{"sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"}
+	if err = k.WriteBootstrapKubeConfig(); err == nil {
+		t.Error("expected an error when the discovered CA doesn't match the hash")
+	}
+	k.DiscoveryTokenCACertHashes = []string{CACertHash(ca)}
+	if err = k.WriteBootstrapKubeConfig(); err != nil {
+		t.Fatal(err)
+	}
+	config, err := clientcmd.LoadFromFile(filepath.Join(dir, BootstrapKubeConfigFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cluster := config.Clusters[kubeConfigClusterName]; cluster == nil || cluster.Server != server.URL || string(cluster.CertificateAuthorityData) != string(caData) {
+		t.Errorf("unexpected bootstrap cluster %+v", config.Clusters)
+	}
+	if user := config.AuthInfos[bootstrapUser]; user == nil || user.Token != testBootstrapToken {
+		t.Errorf("expected the bootstrap token user but got %+v", config.AuthInfos)
+	}
+	if clientCA, err := ioutil.ReadFile(CaCertFile); err != nil || string(clientCA) != string(caData) {
+		t.Errorf("expected the discovered CA to be written for the kubelet but got %v", err)
+	}
+
+	// A token which didn't sign the cluster-info can't discover the CA
+	k.BootstrapToken = "abcdef.fedcba9876543210"
+	if err = k.WriteBootstrapKubeConfig(); err == nil {
+		t.Error("expected an error for a token which didn't sign the cluster-info")
+	}
+}
+
+func TestWriteClientCA(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeadm-client-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(kubeConfigDir, caCertFile string) { KubeConfigDir, CaCertFile = kubeConfigDir, caCertFile }(KubeConfigDir, CaCertFile)
+	KubeConfigDir = dir
+	CaCertFile = filepath.Join(dir, "pki", "ca.crt")
+
+	k := &Config{}
+	if err = k.WriteClientCA(); err == nil {
+		t.Error("expected an error without a bootstrap CA cert file, keto-tokens kubeconfig or existing CA")
+	}
+	ca, _, err := pkiutil.NewCertificateAuthority()
+	if err != nil {
+		t.Fatal(err)
+	}
+	caData := certutil.EncodeCertPEM(ca)
+	k.BootstrapCACertFile = filepath.Join(dir, "bootstrap-ca.crt")
+	if err = ioutil.WriteFile(k.BootstrapCACertFile, caData, 0644); err != nil {
+		t.Fatal(err)
+	}
+	k.DiscoveryTokenCACertHashes = []string{"sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"}
+	if err = k.WriteClientCA(); err == nil {
+		t.Error("expected an error when the CA doesn't match the hash")
+	}
+	k.DiscoveryTokenCACertHashes = []string{CACertHash(ca)}
+	if err = k.WriteClientCA(); err != nil {
+		t.Fatal(err)
+	}
+	if clientCA, err := ioutil.ReadFile(CaCertFile); err != nil || string(clientCA) != string(caData) {
+		t.Errorf("expected the bootstrap CA to be written for the kubelet but got %v", err)
+	}
+
+	// Without the flag the CA already on the node is kept
+	k.BootstrapCACertFile = ""
+	if err = k.WriteClientCA(); err != nil {
+		t.Errorf("expected the existing CA to be used but got %v", err)
+	}
+
+	// A keto-tokens kubeconfig is trusted over the existing CA
+	tokensCA, _, err := pkiutil.NewCertificateAuthority()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokensCAData := certutil.EncodeCertPEM(tokensCA)
+	kubeConfig, err := clientcmd.Write(clientcmdapi.Config{
+		Clusters: map[string]*clientcmdapi.Cluster{
+			"kubernetes": {Server: "https://kube.example.com", CertificateAuthorityData: tokensCAData},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, BootstrapKubeConfigFileName), kubeConfig, 0600); err != nil {
+		t.Fatal(err)
+	}
+	k.DiscoveryTokenCACertHashes = nil
+	if err = k.WriteClientCA(); err != nil {
+		t.Fatal(err)
+	}
+	if clientCA, err := ioutil.ReadFile(CaCertFile); err != nil || string(clientCA) != string(tokensCAData) {
+		t.Errorf("expected the keto-tokens CA to be written for the kubelet but got %v", err)
+	}
+}
+
+func TestValidateComputeJoinMode(t *testing.T) {
+	for mode, valid := range map[string]bool{
+		"":                        true,
+		ComputeJoinModeKetoTokens: true,
+		ComputeJoinModeToken:      true,
+		"kubeadm":                 false,
+	} {
+		if err := ValidateComputeJoinMode(mode); (err == nil) != valid {
+			t.Errorf("expected join mode %q valid to be %v but got %v", mode, valid, err)
+		}
+	}
+	if (&Config{}).TokenJoin() || !(&Config{ComputeJoinMode: ComputeJoinModeToken}).TokenJoin() {
+		t.Error("expected only the token join mode to join with the bootstrap token")
+	}
+}
+
+func TestBootstrapTokenSecret(t *testing.T) {
+	if _, err := BootstrapTokenSecret("abcdef"); err == nil {
+		t.Error("expected an error for an invalid token")
+	}
+	secret, err := BootstrapTokenSecret(testBootstrapToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s struct {
+		Type     string                 `json:"type"`
+		Metadata map[string]interface{} `json:"metadata"`
+		Data     map[string]string      `json:"data"`
+	}
+	if err = yaml.Unmarshal([]byte(secret), &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Type != "bootstrap.kubernetes.io/token" || s.Metadata["name"] != "bootstrap-token-abcdef" || s.Metadata["namespace"] != "kube-system" {
+		t.Errorf("unexpected bootstrap token secret:\n%s", secret)
+	}
+	for key, expected := range map[string]string{
+		"token-id":                "abcdef",
+		"token-secret":            "0123456789abcdef",
+		"usage-bootstrap-signing": "true",
+		"auth-extra-groups":       defaultNodeGroup,
+	} {
+		if value, _ := base64.StdEncoding.DecodeString(s.Data[key]); string(value) != expected {
+			t.Errorf("expected %s to be %q but got %q", key, expected, value)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package kubeadm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/backup"
+	certutil "github.com/UKHomeOffice/keto-k8/pkg/client-go/util/cert"
+	"github.com/UKHomeOffice/keto-k8/pkg/failure"
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+	kubeadmconstants "github.com/UKHomeOffice/keto-k8/pkg/kubeadm/constants"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm/pkiutil"
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+)
+
+// CaHashAnnotation is set on the control plane pods to the hash of the kube CA bundle (so they restart when it changes)
+const CaHashAnnotation = "keto-k8/ca-hash"
+
+// servingCerts are signed by the kube CA and served to clients (so need any intermediates)
+var servingCerts = []string{kubeadmconstants.APIServerCertAndKeyBaseName}
+
+// caSignedCerts are the master certs kubeadm signs with the kube CA
+var caSignedCerts = []string{
+	kubeadmconstants.APIServerCertAndKeyBaseName,
+	kubeadmconstants.APIServerKubeletClientCertAndKeyBaseName,
+}
+
+// ValidateCaFiles will check a kube CA cert file and key can sign certs
+// The cert file can be a chain with the signing (intermediate) CA first, then any other intermediates and the root
+func ValidateCaFiles(certFile, keyFile string) error {
+	chain, err := pkiutil.LoadCAChain(certFile)
+	if err != nil {
+		return err
+	}
+	key, err := pkiutil.TryLoadAnyKeyFromDisk(keyFile)
+	if err != nil {
+		return err
+	}
+	if err = pkiutil.ValidateCAChain(chain, key); err != nil {
+		return failure.Wrap(err, "invalid kube CA "+certFile,
+			"check the kube CA cert (and any intermediates) match the CA key provisioned by the keto infra")
+	}
+	if len(chain) > 1 {
+		logger.Printf("Kube CA %s is a chain of %d certs, signing with %q", certFile, len(chain), chain[0].Subject.CommonName)
+	}
+	return nil
+}
+
+// appendCaIntermediates will add the intermediates of a kube CA chain to the serving certs so clients which only
+// trust the root can verify them (nothing is changed for a self-signed CA)
+// Only the certs up to the first self-signed root are intermediates, any after it are other trusted CAs (e.g. during a
+// CA rotation)
+func appendCaIntermediates() error {
+	chain, err := pkiutil.LoadCAChain(PkiDir + "/" + kubeadmconstants.CACertAndKeyBaseName + ".crt")
+	if err != nil {
+		return err
+	}
+	var intermediates []byte
+	for _, cert := range chain {
+		if cert.CheckSignatureFrom(cert) == nil {
+			break
+		}
+		intermediates = append(intermediates, certutil.EncodeCertPEM(cert)...)
+	}
+	if len(intermediates) == 0 {
+		return nil
+	}
+	for _, name := range servingCerts {
+		file := PkiDir + "/" + name + ".crt"
+		current, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		certs, err := certutil.ParseCertsPEM(current)
+		if err != nil {
+			return fmt.Errorf("couldn't load %s [%v]", file, err)
+		}
+		served := append(certutil.EncodeCertPEM(certs[0]), intermediates...)
+		if bytes.Equal(current, served) {
+			continue
+		}
+		logger.Printf("Adding the kube CA intermediates to %s", file)
+		if err = fileutil.WriteFile(file, served, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeStaleCerts will remove the master certs which aren't signed by the current kube CA (e.g. after a CA rotation)
+// or the api server cert without the api server host so kubeadm creates them again instead of re-using them (they're
+// backed up first)
+func (k *Config) removeStaleCerts() error {
+	cas, err := certutil.CertsFromFile(PkiDir + "/" + kubeadmconstants.CACertAndKeyBaseName + ".crt")
+	if err != nil {
+		// Nothing to check until there's a CA (kubeadm creates it or fails for an invalid one)
+		return nil
+	}
+	for _, name := range caSignedCerts {
+		certs, err := certutil.CertsFromFile(PkiDir + "/" + name + ".crt")
+		if err != nil {
+			continue
+		}
+		if err = certs[0].CheckSignatureFrom(cas[0]); err == nil && name == kubeadmconstants.APIServerCertAndKeyBaseName {
+			err = k.checkAPIServerSANs(certs[0])
+		}
+		if err == nil {
+			continue
+		}
+		logger.Printf("Removing the stale %s cert and key: %v", name, err)
+		files := []string{PkiDir + "/" + name + ".crt", PkiDir + "/" + name + ".key"}
+		if err = backup.Save(files...); err != nil {
+			return err
+		}
+		for _, file := range files {
+			if err = os.Remove(file); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// caHashMutator will annotate the control plane pods with a hash of the kube CA bundle on disk (when there is one)
+func caHashMutator() podspec.Mutator {
+	bundle, err := ioutil.ReadFile(PkiDir + "/" + kubeadmconstants.CACertAndKeyBaseName + ".crt")
+	sum := sha256.Sum256(bundle)
+	return func(o podspec.Object) error {
+		if err != nil || !o.HasPodSpec() {
+			return nil
+		}
+		o.SetPodAnnotation(CaHashAnnotation, hex.EncodeToString(sum[:8]))
+		return nil
+	}
+}
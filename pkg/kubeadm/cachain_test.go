@@ -0,0 +1,143 @@
+package kubeadm
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/backup"
+	certutil "github.com/UKHomeOffice/keto-k8/pkg/client-go/util/cert"
+	kubeadmconstants "github.com/UKHomeOffice/keto-k8/pkg/kubeadm/constants"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm/pkiutil"
+)
+
+func TestCaChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeadm-ca-chain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(pkiDir string) { PkiDir = pkiDir }(PkiDir)
+	PkiDir = dir
+
+	root, rootKey, err := pkiutil.NewCertificateAuthority()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := certutil.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "intermediate"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, root, key.Public(), rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediate, _ := x509.ParseCertificate(der)
+	chain := append(certutil.EncodeCertPEM(intermediate), certutil.EncodeCertPEM(root)...)
+	if err = ioutil.WriteFile(filepath.Join(dir, "ca.crt"), chain, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = pkiutil.WriteKey(dir, "ca", key); err != nil {
+		t.Fatal(err)
+	}
+	if err = ValidateCaFiles(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")); err != nil {
+		t.Fatal(err)
+	}
+	if err = pkiutil.WriteKey(dir, "root", rootKey); err != nil {
+		t.Fatal(err)
+	}
+	if err = ValidateCaFiles(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "root.key")); err == nil {
+		t.Error("expected an error for the root key")
+	}
+
+	// The apiserver serves its cert with the intermediate (not the root), whenever the certs are created
+	apiServer, _, err := pkiutil.NewCertAndKey(intermediate, key, certutil.Config{
+		CommonName: "kube-apiserver",
+		Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pkiutil.WriteCert(dir, "apiserver", apiServer); err != nil {
+		t.Fatal(err)
+	}
+	for run := 0; run < 2; run++ {
+		if err = appendCaIntermediates(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	served, err := certutil.CertsFromFile(filepath.Join(dir, "apiserver.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(served) != 2 || !served[0].Equal(apiServer) || !served[1].Equal(intermediate) {
+		t.Errorf("expected the apiserver cert then the intermediate but got %d certs", len(served))
+	}
+}
+
+func TestRemoveStaleCerts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeadm-stale-certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(pkiDir, backupDir string) {
+		PkiDir = pkiDir
+		backup.Dir = backupDir
+	}(PkiDir, backup.Dir)
+	PkiDir = filepath.Join(dir, "pki")
+	backup.Dir = filepath.Join(dir, "backups")
+
+	apiServer, _ := url.Parse("https://kube.example.com")
+	k := &Config{APIServer: apiServer}
+	ca, caKey := writeTestCA(t, kubeadmconstants.CACertAndKeyBaseName)
+	writeTestCert(t, kubeadmconstants.APIServerCertAndKeyBaseName, ca, caKey, "kube.example.com")
+	writeTestCert(t, kubeadmconstants.APIServerKubeletClientCertAndKeyBaseName, ca, caKey)
+	if err = k.removeStaleCerts(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(PkiDir, "apiserver.crt")); err != nil {
+		t.Errorf("expected the certs signed by the CA to be kept: %v", err)
+	}
+
+	// A changed api server
+	moved, _ := url.Parse("https://moved.example.com")
+	if err = (&Config{APIServer: moved}).removeStaleCerts(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(PkiDir, "apiserver.crt")); !os.IsNotExist(err) {
+		t.Errorf("expected the api server cert without the api server name to be removed")
+	}
+	if _, err = os.Stat(filepath.Join(PkiDir, "apiserver-kubelet-client.crt")); err != nil {
+		t.Errorf("expected the other certs signed by the CA to be kept: %v", err)
+	}
+	writeTestCert(t, kubeadmconstants.APIServerCertAndKeyBaseName, ca, caKey, "kube.example.com")
+
+	// A rotated CA
+	writeTestCA(t, kubeadmconstants.CACertAndKeyBaseName)
+	if err = k.removeStaleCerts(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range caSignedCerts {
+		for _, ext := range []string{".crt", ".key"} {
+			if _, err = os.Stat(filepath.Join(PkiDir, name+ext)); !os.IsNotExist(err) {
+				t.Errorf("expected %s%s to be removed", name, ext)
+			}
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package kubeadm
+
+import (
+	"fmt"
+)
+
+// CA key modes set how the persistent kube CA key is made available to kubeadm (as CaKeyFile)
+const (
+	// CaKeySymlink links to the persistent key (the default)
+	CaKeySymlink = "symlink"
+	// CaKeyCopy copies the key with mode 0600 e.g. when the persistent key is on another mount
+	CaKeyCopy = "copy"
+	// CaKeyEphemeral copies the key and securely removes it once the master certs are signed
+	// The controller-manager can't sign certificate requests (e.g. kubelet TLS bootstrapping) without the key
+	CaKeyEphemeral = "ephemeral"
+)
+
+// ValidateCaKeyMode will check the CA key mode is known (empty is the default)
+func ValidateCaKeyMode(mode string) error {
+	switch mode {
+	case "", CaKeySymlink, CaKeyCopy, CaKeyEphemeral:
+		return nil
+	}
+	return fmt.Errorf("unknown CA key mode %q (expecting %s, %s or %s)", mode, CaKeySymlink, CaKeyCopy, CaKeyEphemeral)
+}
+
+// caKeyControllerManagerArgs disables the CSR signer when the CA key won't be present
+func caKeyControllerManagerArgs(mode string) map[string]string {
+	if mode != CaKeyEphemeral {
+		return nil
+	}
+	return map[string]string{"controllers": "*,-csrsigning"}
+}
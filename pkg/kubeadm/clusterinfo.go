@@ -0,0 +1,109 @@
+package kubeadm
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	certutil "github.com/UKHomeOffice/keto-k8/pkg/client-go/util/cert"
+	"github.com/UKHomeOffice/keto-k8/pkg/constants"
+	"github.com/ghodss/yaml"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+const (
+	// ClusterInfoName and ClusterInfoNamespace are the configmap read by kubeadm token discovery
+	ClusterInfoName      = "cluster-info"
+	ClusterInfoNamespace = "kube-public"
+
+	// clusterInfoRole lets anonymous clients read the cluster-info only (the same role as kubeadm)
+	clusterInfoRole = "kubeadm:bootstrap-signer-clusterinfo"
+)
+
+// ClusterInfo returns the cluster-info resources (the kube CA and api server, readable without credentials) and the
+// CA cert hashes for --discovery-token-ca-cert-hash. The bootstrap signer (in the controller-manager) signs the
+// cluster-info for each bootstrap token so clients can trust it.
+func (k *Config) ClusterInfo() (resources string, hashes []string, err error) {
+	if k.APIServer == nil {
+		return "", nil, fmt.Errorf("the api server must be known to publish the cluster-info")
+	}
+	caData, err := ioutil.ReadFile(CaCertFile)
+	if err != nil {
+		return "", nil, err
+	}
+	certs, err := certutil.ParseCertsPEM(caData)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid kube CA [%v]", err)
+	}
+	for _, cert := range certs {
+		hashes = append(hashes, CACertHash(cert))
+	}
+	resources, err = clusterInfoResources(k.APIServer.String(), caData)
+	return resources, hashes, err
+}
+
+// clusterInfoResources returns the cluster-info configmap with a kubeconfig for the api server (the same as kubeadm,
+// a single unnamed cluster without any users) and the RBAC for anonymous clients to read it
+func clusterInfoResources(server string, caData []byte) (string, error) {
+	kubeConfig, err := clientcmd.Write(clientcmdapi.Config{
+		Clusters: map[string]*clientcmdapi.Cluster{
+			"": {
+				Server:                   server,
+				CertificateAuthorityData: caData,
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	labels := map[string]string{constants.ManagedByLabel: constants.ManagedByValue}
+	metadata := func(name string) map[string]interface{} {
+		return map[string]interface{}{"name": name, "namespace": ClusterInfoNamespace, "labels": labels}
+	}
+	docs := []map[string]interface{}{
+		{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   metadata(ClusterInfoName),
+			"data":       map[string]string{"kubeconfig": string(kubeConfig)},
+		},
+		{
+			"apiVersion": "rbac.authorization.k8s.io/v1beta1",
+			"kind":       "Role",
+			"metadata":   metadata(clusterInfoRole),
+			"rules": []map[string]interface{}{{
+				"apiGroups":     []string{""},
+				"resources":     []string{"configmaps"},
+				"resourceNames": []string{ClusterInfoName},
+				"verbs":         []string{"get"},
+			}},
+		},
+		{
+			"apiVersion": "rbac.authorization.k8s.io/v1beta1",
+			"kind":       "RoleBinding",
+			"metadata":   metadata(clusterInfoRole),
+			"roleRef": map[string]string{
+				"apiGroup": "rbac.authorization.k8s.io",
+				"kind":     "Role",
+				"name":     clusterInfoRole,
+			},
+			"subjects": []map[string]string{{
+				"apiGroup": "rbac.authorization.k8s.io",
+				"kind":     "User",
+				"name":     "system:anonymous",
+			}},
+		},
+	}
+	var resources string
+	for i, doc := range docs {
+		data, err := yaml.Marshal(doc)
+		if err != nil {
+			return "", err
+		}
+		if i > 0 {
+			resources += "---\n"
+		}
+		resources += string(data)
+	}
+	return resources, nil
+}
@@ -0,0 +1,90 @@
+package kubeadm
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	certutil "github.com/UKHomeOffice/keto-k8/pkg/client-go/util/cert"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm/pkiutil"
+	"github.com/ghodss/yaml"
+)
+
+func TestClusterInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeadm-cluster-info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(caCertFile string) { CaCertFile = caCertFile }(CaCertFile)
+	CaCertFile = filepath.Join(dir, "ca.crt")
+
+	ca, _, err := pkiutil.NewCertificateAuthority()
+	if err != nil {
+		t.Fatal(err)
+	}
+	caData := certutil.EncodeCertPEM(ca)
+	if err = ioutil.WriteFile(CaCertFile, caData, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = (&Config{}).ClusterInfo(); err == nil {
+		t.Error("expected an error without an api server")
+	}
+
+	var kubeConfig string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// As signed by the bootstrap signer
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]string{
+				"kubeconfig":            kubeConfig,
+				"jws-kubeconfig-abcdef": signDetached(kubeConfig, "0123456789abcdef"),
+			},
+		})
+	}))
+	defer server.Close()
+	apiServer, _ := url.Parse(server.URL)
+
+	resources, hashes, err := (&Config{APIServer: apiServer}).ClusterInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 1 || hashes[0] != CACertHash(ca) {
+		t.Errorf("expected the CA cert hash %s but got %v", CACertHash(ca), hashes)
+	}
+	docs := strings.Split(resources, "---\n")
+	if len(docs) != 3 {
+		t.Fatalf("expected the cluster-info, role and binding but got:\n%s", resources)
+	}
+	var configMap struct {
+		Kind     string                 `json:"kind"`
+		Metadata map[string]interface{} `json:"metadata"`
+		Data     map[string]string      `json:"data"`
+	}
+	if err = yaml.Unmarshal([]byte(docs[0]), &configMap); err != nil {
+		t.Fatal(err)
+	}
+	if configMap.Kind != "ConfigMap" || configMap.Metadata["name"] != ClusterInfoName || configMap.Metadata["namespace"] != ClusterInfoNamespace {
+		t.Errorf("expected the cluster-info configmap but got:\n%s", docs[0])
+	}
+	for _, expected := range []string{"kind: RoleBinding", "name: system:anonymous", "name: " + clusterInfoRole} {
+		if !strings.Contains(docs[2], expected) {
+			t.Errorf("expected the binding to contain %q but got:\n%s", expected, docs[2])
+		}
+	}
+
+	// The published cluster-info works for token discovery
+	kubeConfig = configMap.Data["kubeconfig"]
+	discovered, err := discoverCA(server.URL, testBootstrapToken, hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(discovered) != string(caData) {
+		t.Errorf("expected the kube CA to be discovered but got:\n%s", discovered)
+	}
+}
@@ -0,0 +1,108 @@
+package kubeadm
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/backup"
+	certutil "github.com/UKHomeOffice/keto-k8/pkg/client-go/util/cert"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm/pkiutil"
+)
+
+// Cluster signing modes set the CA the controller-manager signs certificate requests with (e.g. the kubelet client
+// and serving certs from TLS bootstrapping)
+const (
+	// ClusterSigningKubeCA signs with the kube CA (the default)
+	ClusterSigningKubeCA = "kube-ca"
+	// ClusterSigningDedicated signs with a dedicated CA created by the primary master and shared in the assets, the
+	// apiserver trusts client certs signed by it (and the kube CA)
+	ClusterSigningDedicated = "dedicated"
+)
+
+const (
+	// ClusterSigningCABaseName is the dedicated signing CA cert and key in the pki dir
+	ClusterSigningCABaseName = "cluster-signing-ca"
+	// clusterSigningCommonName is the subject of the dedicated signing CA
+	clusterSigningCommonName = "kubernetes-signing"
+	// clientCABundleName is the kube CA bundle and the dedicated signing CA trusted by the apiserver for client certs
+	clientCABundleName = "client-ca-bundle.crt"
+)
+
+// ValidateClusterSigningMode will check the cluster signing mode is known (empty is the default), the dedicated signing
+// CA is only shared with the secondary masters in the assets join mode
+func ValidateClusterSigningMode(mode, joinMode string) error {
+	switch mode {
+	case "", ClusterSigningKubeCA:
+		return nil
+	case ClusterSigningDedicated:
+		if joinMode == JoinModeKubeadm {
+			return fmt.Errorf("the %s cluster signing CA can't be shared in the %s join mode", ClusterSigningDedicated, JoinModeKubeadm)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown cluster signing mode %q (expecting %s or %s)", mode, ClusterSigningKubeCA, ClusterSigningDedicated)
+}
+
+// DedicatedSigningCA is true when certificate requests are signed with the dedicated signing CA
+func (k *Config) DedicatedSigningCA() bool {
+	return k != nil && k.ClusterSigningMode == ClusterSigningDedicated
+}
+
+// clusterSigningControllerManagerArgs are the controller-manager flags for the CA signing certificate requests, the
+// CSR signer is disabled when it's the kube CA and the key won't be present
+func clusterSigningControllerManagerArgs(k Config) map[string]string {
+	if k.DedicatedSigningCA() {
+		return map[string]string{
+			"cluster-signing-cert-file": PkiDir + "/" + ClusterSigningCABaseName + ".crt",
+			"cluster-signing-key-file":  PkiDir + "/" + ClusterSigningCABaseName + ".key",
+		}
+	}
+	if args := caKeyControllerManagerArgs(k.CaKeyMode); args != nil {
+		return args
+	}
+	return map[string]string{
+		"cluster-signing-cert-file": CaCertFile,
+		"cluster-signing-key-file":  CaKeyFile,
+	}
+}
+
+// clientCABundleFile is the apiserver client CA file with the dedicated signing CA
+func clientCABundleFile() string {
+	return PkiDir + "/" + clientCABundleName
+}
+
+// createClusterSigningCA will create the dedicated signing CA on the primary master (unless it's already on disk)
+func createClusterSigningCA() error {
+	if pkiutil.CertOrKeyExist(PkiDir, ClusterSigningCABaseName) {
+		_, _, err := pkiutil.TryLoadCertAndKeyFromDisk(PkiDir, ClusterSigningCABaseName)
+		return err
+	}
+	key, err := certutil.NewPrivateKey()
+	if err != nil {
+		return fmt.Errorf("unable to create the cluster signing CA key [%v]", err)
+	}
+	cert, err := certutil.NewSelfSignedCACert(certutil.Config{CommonName: clusterSigningCommonName}, key)
+	if err != nil {
+		return fmt.Errorf("unable to create the cluster signing CA [%v]", err)
+	}
+	if err = pkiutil.WriteCertAndKey(PkiDir, ClusterSigningCABaseName, cert, key); err != nil {
+		return err
+	}
+	logger.Printf("Created the cluster signing CA %s", PkiDir+"/"+ClusterSigningCABaseName+".crt")
+	return nil
+}
+
+// writeClientCABundle will write the kube CA bundle with the dedicated signing CA, every run as the kube CA may have
+// been replaced
+func writeClientCABundle() error {
+	bundle, err := ioutil.ReadFile(CaCertFile)
+	if err != nil {
+		return err
+	}
+	signingCA, err := pkiutil.TryLoadCertFromDisk(PkiDir, ClusterSigningCABaseName)
+	if err != nil {
+		return fmt.Errorf("the cluster signing CA could not be loaded [%v]", err)
+	}
+	bundle = append(bundle, certutil.EncodeCertPEM(signingCA)...)
+	return backup.WriteFile(clientCABundleFile(), bundle, 0644)
+}
@@ -0,0 +1,108 @@
+package kubeadm
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	certutil "github.com/UKHomeOffice/keto-k8/pkg/client-go/util/cert"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm/pkiutil"
+)
+
+func TestValidateClusterSigningMode(t *testing.T) {
+	for _, mode := range []string{"", ClusterSigningKubeCA, ClusterSigningDedicated} {
+		if err := ValidateClusterSigningMode(mode, JoinModeAssets); err != nil {
+			t.Errorf("expected mode %q to be valid but got %v", mode, err)
+		}
+	}
+	if err := ValidateClusterSigningMode("intermediate", JoinModeAssets); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+	if err := ValidateClusterSigningMode(ClusterSigningDedicated, JoinModeKubeadm); err == nil {
+		t.Error("expected an error as kubeadm doesn't share the dedicated signing CA")
+	}
+}
+
+func TestClusterSigningControllerManagerArgs(t *testing.T) {
+	args := clusterSigningControllerManagerArgs(Config{})
+	if args["cluster-signing-cert-file"] != CaCertFile || args["cluster-signing-key-file"] != CaKeyFile {
+		t.Errorf("expected to sign with the kube CA by default but got %v", args)
+	}
+	args = clusterSigningControllerManagerArgs(Config{CaKeyMode: CaKeyEphemeral})
+	if args["controllers"] != "*,-csrsigning" || len(args["cluster-signing-cert-file"]) > 0 {
+		t.Errorf("expected the CSR signer to be disabled without the kube CA key but got %v", args)
+	}
+	// The dedicated signing CA stays on disk
+	args = clusterSigningControllerManagerArgs(Config{CaKeyMode: CaKeyEphemeral, ClusterSigningMode: ClusterSigningDedicated})
+	if args["cluster-signing-cert-file"] != PkiDir+"/cluster-signing-ca.crt" || len(args["controllers"]) > 0 {
+		t.Errorf("expected to sign with the dedicated CA but got %v", args)
+	}
+}
+
+func TestClusterSigningCA(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeadm-cluster-signing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(pkiDir, caCertFile string) { PkiDir, CaCertFile = pkiDir, caCertFile }(PkiDir, CaCertFile)
+	PkiDir = dir
+	CaCertFile = dir + "/ca.crt"
+
+	ca, _, err := pkiutil.NewCertificateAuthority()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pkiutil.WriteCert(dir, "ca", ca); err != nil {
+		t.Fatal(err)
+	}
+	if err = createClusterSigningCA(); err != nil {
+		t.Fatal(err)
+	}
+	signingCA, err := pkiutil.TryLoadCertFromDisk(dir, ClusterSigningCABaseName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !signingCA.IsCA || signingCA.Subject.CommonName != clusterSigningCommonName {
+		t.Errorf("expected the dedicated signing CA but got %q", signingCA.Subject.CommonName)
+	}
+	// An existing signing CA (e.g. saved from the assets) is kept
+	if err = createClusterSigningCA(); err != nil {
+		t.Fatal(err)
+	}
+	if existing, _ := pkiutil.TryLoadCertFromDisk(dir, ClusterSigningCABaseName); !existing.Equal(signingCA) {
+		t.Error("expected the existing signing CA to be kept")
+	}
+
+	if err = writeClientCABundle(); err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := certutil.CertsFromFile(clientCABundleFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bundle) != 2 || !bundle[0].Equal(ca) || !bundle[1].Equal(signingCA) {
+		t.Errorf("expected the client CA bundle to have the kube CA and the signing CA but got %d certs", len(bundle))
+	}
+
+	// A kubelet client cert signed by the dedicated CA is trusted by the client CA bundle
+	key, err := pkiutil.TryLoadKeyFromDisk(dir, ClusterSigningCABaseName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _, err := pkiutil.NewCertAndKey(signingCA, key, certutil.Config{
+		CommonName: "system:node:compute0",
+		Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	for _, c := range bundle {
+		roots.AddCert(c)
+	}
+	if _, err = cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Errorf("expected the kubelet client cert to be trusted [%v]", err)
+	}
+}
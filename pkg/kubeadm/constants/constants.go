@@ -0,0 +1,63 @@
+/*
+Taken from  https://github.com/kubernetes/kubernetes/blob/v1.7.0/cmd/kubeadm/app/constants/constants.go
+
+Only the file, cert and user names used by keto-k8 so the core (e.g. compute nodes) doesn't import k8s.io/kubernetes
+*/
+
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package constants
+
+const (
+	// KubernetesDir is the directory kubeadm writes all its config to
+	KubernetesDir = "/etc/kubernetes"
+	// ManifestsSubDirName is the sub directory of the KubernetesDir for the static pod manifests
+	ManifestsSubDirName = "manifests"
+
+	CACertAndKeyBaseName = "ca"
+
+	APIServerCertAndKeyBaseName = "apiserver"
+
+	APIServerKubeletClientCertAndKeyBaseName = "apiserver-kubelet-client"
+	APIServerKubeletClientCertName           = "apiserver-kubelet-client.crt"
+	APIServerKubeletClientKeyName            = "apiserver-kubelet-client.key"
+
+	ServiceAccountKeyBaseName    = "sa"
+	ServiceAccountPublicKeyName  = "sa.pub"
+	ServiceAccountPrivateKeyName = "sa.key"
+
+	FrontProxyCACertAndKeyBaseName = "front-proxy-ca"
+	FrontProxyCACertName           = "front-proxy-ca.crt"
+	FrontProxyCAKeyName            = "front-proxy-ca.key"
+
+	FrontProxyClientCertAndKeyBaseName = "front-proxy-client"
+
+	AdminKubeConfigFileName             = "admin.conf"
+	KubeletKubeConfigFileName           = "kubelet.conf"
+	ControllerManagerKubeConfigFileName = "controller-manager.conf"
+	SchedulerKubeConfigFileName         = "scheduler.conf"
+
+	// AuthorizationWebhookConfigPath is set by kubeadm as the apiserver webhook authorizer config
+	AuthorizationWebhookConfigPath = KubernetesDir + "/webhook_authz.conf"
+
+	// Some well-known users and groups in the core Kubernetes authorization system
+
+	ControllerManagerUser = "system:kube-controller-manager"
+	SchedulerUser         = "system:kube-scheduler"
+	MastersGroup          = "system:masters"
+	NodesGroup            = "system:nodes"
+)
@@ -0,0 +1,196 @@
+package kubeadm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	kubeadmconstants "github.com/UKHomeOffice/keto-k8/pkg/kubeadm/constants"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// drainRetry is how often evictions blocked by a disruption budget are retried (replaced in tests)
+var drainRetry = 5 * time.Second
+
+// mirrorPodAnnotation is set on the api server copies of static pods (which can't be evicted)
+const mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+// drainPod is the part of a pod needed to drain it
+type drainPod struct {
+	Metadata struct {
+		Name            string            `json:"name"`
+		Namespace       string            `json:"namespace"`
+		Annotations     map[string]string `json:"annotations"`
+		OwnerReferences []struct {
+			Kind string `json:"kind"`
+		} `json:"ownerReferences"`
+	} `json:"metadata"`
+	Status struct {
+		Phase string `json:"phase"`
+	} `json:"status"`
+}
+
+// nodeClient makes api requests with the kubelet credentials (allowed to cordon, drain and delete its own node)
+type nodeClient struct {
+	host   string
+	client *http.Client
+}
+
+func newNodeClient(kubeConfigPath string) (*nodeClient, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := rest.TransportFor(config)
+	if err != nil {
+		return nil, err
+	}
+	return &nodeClient{host: config.Host, client: &http.Client{Transport: transport, Timeout: nodeConditionRetry}}, nil
+}
+
+// do will make a request returning the status and body
+func (c *nodeClient) do(method, uri, contentType string, body []byte) (int, []byte, error) {
+	req, err := http.NewRequest(method, c.host+uri, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, data, err
+}
+
+// DrainNode will cordon a node and evict its pods (except daemonset and static pods), waiting until they've gone or
+// the timeout. Each pod gets the grace period (its own when negative) and evictions blocked by a disruption budget are
+// retried until the timeout.
+func DrainNode(node string, gracePeriod, timeout time.Duration) error {
+	c, err := newNodeClient(path.Join(KubeConfigDir, kubeadmconstants.KubeletKubeConfigFileName))
+	if err != nil {
+		return err
+	}
+	return c.drain(node, gracePeriod, timeout)
+}
+
+// DeleteNode will deregister a node (the kubelet must be stopped first or it'll register the node again)
+func DeleteNode(node string) error {
+	c, err := newNodeClient(path.Join(KubeConfigDir, kubeadmconstants.KubeletKubeConfigFileName))
+	if err != nil {
+		return err
+	}
+	status, body, err := c.do("DELETE", "/api/v1/nodes/"+node, "", nil)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK && status != http.StatusNotFound {
+		return fmt.Errorf("error deleting node %s, status %d: %s", node, status, body)
+	}
+	logger.Printf("Deleted node %s", node)
+	return nil
+}
+
+func (c *nodeClient) drain(node string, gracePeriod, timeout time.Duration) error {
+	status, body, err := c.do("PATCH", "/api/v1/nodes/"+node, "application/strategic-merge-patch+json",
+		[]byte(`{"spec":{"unschedulable":true}}`))
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("error cordoning node %s, status %d: %s", node, status, body)
+	}
+	logger.Printf("Cordoned node %s", node)
+
+	deadline := time.Now().Add(timeout)
+	for {
+		pods, err := c.podsToEvict(node)
+		if err != nil {
+			return err
+		}
+		if len(pods) == 0 {
+			logger.Printf("Drained node %s", node)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out draining node %s, %d pods left", node, len(pods))
+		}
+		for _, pod := range pods {
+			if err = c.evict(pod, gracePeriod); err != nil {
+				logger.Warnf("Can't evict pod %s/%s yet: %v", pod.Metadata.Namespace, pod.Metadata.Name, err)
+			}
+		}
+		time.Sleep(drainRetry)
+	}
+}
+
+// podsToEvict returns the running pods on a node which are moved by a drain (not daemonset or static pods)
+func (c *nodeClient) podsToEvict(node string) ([]drainPod, error) {
+	status, body, err := c.do("GET", "/api/v1/pods?fieldSelector="+url.QueryEscape("spec.nodeName="+node), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("error listing the pods on node %s, status %d: %s", node, status, body)
+	}
+	var list struct {
+		Items []drainPod `json:"items"`
+	}
+	if err = json.Unmarshal(body, &list); err != nil {
+		return nil, err
+	}
+	var pods []drainPod
+	for _, pod := range list.Items {
+		if _, mirror := pod.Metadata.Annotations[mirrorPodAnnotation]; mirror {
+			continue
+		}
+		if pod.Status.Phase == "Succeeded" || pod.Status.Phase == "Failed" {
+			continue
+		}
+		daemonSet := false
+		for _, owner := range pod.Metadata.OwnerReferences {
+			daemonSet = daemonSet || owner.Kind == "DaemonSet"
+		}
+		if !daemonSet {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+// evict will request the eviction of a pod (honouring any disruption budget)
+func (c *nodeClient) evict(pod drainPod, gracePeriod time.Duration) error {
+	eviction := map[string]interface{}{
+		"apiVersion": "policy/v1beta1",
+		"kind":       "Eviction",
+		"metadata":   map[string]string{"name": pod.Metadata.Name, "namespace": pod.Metadata.Namespace},
+	}
+	if gracePeriod >= 0 {
+		eviction["deleteOptions"] = map[string]int64{"gracePeriodSeconds": int64(gracePeriod / time.Second)}
+	}
+	data, err := json.Marshal(eviction)
+	if err != nil {
+		return err
+	}
+	status, body, err := c.do("POST", "/api/v1/namespaces/"+pod.Metadata.Namespace+"/pods/"+pod.Metadata.Name+"/eviction",
+		"application/json", data)
+	if err != nil {
+		return err
+	}
+	switch status {
+	case http.StatusOK, http.StatusCreated, http.StatusNotFound:
+		return nil
+	case http.StatusTooManyRequests:
+		return fmt.Errorf("blocked by a disruption budget")
+	}
+	return fmt.Errorf("status %d: %s", status, body)
+}
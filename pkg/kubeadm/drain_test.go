@@ -0,0 +1,103 @@
+package kubeadm
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	defer func(retry time.Duration) { drainRetry = retry }(drainRetry)
+	drainRetry = 10 * time.Millisecond
+
+	var mu sync.Mutex
+	cordoned := false
+	blocked := 1
+	pods := map[string]string{
+		"web":     `{"metadata":{"name":"web","namespace":"default"},"status":{"phase":"Running"}}`,
+		"agent":   `{"metadata":{"name":"agent","namespace":"kube-system","ownerReferences":[{"kind":"DaemonSet"}]}}`,
+		"static":  `{"metadata":{"name":"static","namespace":"kube-system","annotations":{"kubernetes.io/config.mirror":"x"}}}`,
+		"job":     `{"metadata":{"name":"job","namespace":"default"},"status":{"phase":"Succeeded"}}`,
+		"guarded": `{"metadata":{"name":"guarded","namespace":"default"},"status":{"phase":"Running"}}`,
+	}
+	var evicted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == "PATCH" && r.URL.Path == "/api/v1/nodes/node1":
+			cordoned = true
+		case r.Method == "GET" && r.URL.Path == "/api/v1/pods":
+			if r.URL.Query().Get("fieldSelector") != "spec.nodeName=node1" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			var items []string
+			for _, pod := range pods {
+				items = append(items, pod)
+			}
+			w.Write([]byte(`{"items":[` + strings.Join(items, ",") + `]}`))
+		case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/eviction"):
+			var eviction struct {
+				Metadata struct {
+					Name string `json:"name"`
+				} `json:"metadata"`
+				DeleteOptions struct {
+					GracePeriodSeconds int64 `json:"gracePeriodSeconds"`
+				} `json:"deleteOptions"`
+			}
+			json.NewDecoder(r.Body).Decode(&eviction)
+			if eviction.DeleteOptions.GracePeriodSeconds != 30 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			// The first eviction of the guarded pod is blocked by its disruption budget
+			if eviction.Metadata.Name == "guarded" && blocked > 0 {
+				blocked--
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			evicted = append(evicted, eviction.Metadata.Name)
+			delete(pods, eviction.Metadata.Name)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := &nodeClient{host: server.URL, client: http.DefaultClient}
+	if err := c.drain("node1", 30*time.Second, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !cordoned {
+		t.Error("expected the node to be cordoned")
+	}
+	if len(evicted) != 2 || len(pods) != 3 || blocked != 0 {
+		t.Errorf("expected only the web and guarded pods to be evicted but got %v (left %d)", evicted, len(pods))
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	defer func(retry time.Duration) { drainRetry = retry }(drainRetry)
+	drainRetry = 10 * time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET":
+			w.Write([]byte(`{"items":[{"metadata":{"name":"web","namespace":"default"}}]}`))
+		case r.Method == "POST":
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+	c := &nodeClient{host: server.URL, client: http.DefaultClient}
+	if err := c.drain("node1", -1, 50*time.Millisecond); err == nil {
+		t.Error("expected a timeout when a pod can't be evicted")
+	}
+}
@@ -0,0 +1,69 @@
+package kubeadm
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/etcd"
+	"github.com/UKHomeOffice/keto-k8/pkg/k8client"
+	"github.com/UKHomeOffice/keto-k8/pkg/kms"
+)
+
+const (
+	kmsPluginTimeout = 2 * time.Minute
+
+	// encryptionCheckSecret is written to prove secrets are encrypted in etcd
+	encryptionCheckSecret = "keto-k8-encryption-check"
+)
+
+const encryptionCheckYaml = `apiVersion: v1
+kind: Secret
+metadata:
+  name: ` + encryptionCheckSecret + `
+  namespace: kube-system
+data:
+  check: %s
+`
+
+// EncryptionEnabled is true when secrets are to be encrypted with KMS
+func (k *Config) EncryptionEnabled() bool {
+	return len(k.KMS.KeyARN) > 0
+}
+
+// VerifyEncryption will check the KMS plugin is healthy and that secrets are stored encrypted
+func (k *Config) VerifyEncryption() error {
+	if !k.EncryptionEnabled() {
+		return nil
+	}
+	if err := kms.WaitForPlugin(kmsPluginTimeout); err != nil {
+		return err
+	}
+	// A new value for every check forces a re-write
+	check := base64.StdEncoding.EncodeToString([]byte(time.Now().String()))
+	if err := k8client.Apply(fmt.Sprintf(encryptionCheckYaml, check)); err != nil {
+		return fmt.Errorf("failed to write encryption check secret [%v]", err)
+	}
+	defer func() {
+		if err := k8client.Delete("secret", encryptionCheckSecret, "kube-system"); err != nil {
+			logger.Errorf("Failed to remove the encryption check secret kube-system/%s: %v", encryptionCheckSecret, err)
+		}
+	}()
+
+	// The registry prefix is the complete key (including any key prefix)
+	clientCfg := k.EtcdClientConfig
+	registry := clientCfg.RegistryPrefix()
+	clientCfg.KeyPrefix = ""
+	client := etcd.New(clientCfg)
+	defer client.Close()
+	raw, err := client.Get(registry + "/secrets/kube-system/" + encryptionCheckSecret)
+	if err != nil {
+		return fmt.Errorf("failed to read encryption check secret from etcd [%v]", err)
+	}
+	if !strings.HasPrefix(raw, kms.EncryptedPrefix) {
+		return fmt.Errorf("secrets are not being encrypted with %s", kms.ProviderName)
+	}
+	logger.Printf("Verified secrets are encrypted with %s", kms.ProviderName)
+	return nil
+}
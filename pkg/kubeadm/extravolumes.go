@@ -0,0 +1,122 @@
+package kubeadm
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+)
+
+const (
+	apiServerContainer         = "kube-apiserver"
+	controllerManagerContainer = "kube-controller-manager"
+)
+
+// hostPathTypes are the valid hostPath volume types (an empty type doesn't check the host path)
+var hostPathTypes = []string{"", "DirectoryOrCreate", "Directory", "FileOrCreate", "File", "Socket", "CharDevice", "BlockDevice"}
+
+// HostPathMount is a host path mounted into a control plane static pod (as a kubeadm extraVolume)
+type HostPathMount struct {
+	Name      string `json:"name"`
+	HostPath  string `json:"hostPath"`
+	MountPath string `json:"mountPath"`
+	ReadOnly  bool   `json:"readOnly,omitempty"`
+	PathType  string `json:"pathType,omitempty"`
+}
+
+// ExtraVolumes are the host paths supplied by users for the apiserver and controller manager e.g. audit log
+// directories, webhook kubeconfigs and cloud config files
+type ExtraVolumes struct {
+	APIServer         []HostPathMount `json:"apiServer,omitempty"`
+	ControllerManager []HostPathMount `json:"controllerManager,omitempty"`
+}
+
+// Validate will check every volume has a unique name and absolute paths
+func (v *ExtraVolumes) Validate() error {
+	if v == nil {
+		return nil
+	}
+	for component, mounts := range map[string][]HostPathMount{
+		"apiServer":         v.APIServer,
+		"controllerManager": v.ControllerManager,
+	} {
+		names := map[string]bool{}
+		for _, m := range mounts {
+			if len(m.Name) == 0 {
+				return fmt.Errorf("extraVolumes.%s: a name is required for the host path %q", component, m.HostPath)
+			}
+			if names[m.Name] {
+				return fmt.Errorf("extraVolumes.%s: duplicate volume name %q", component, m.Name)
+			}
+			names[m.Name] = true
+			if !filepath.IsAbs(m.HostPath) || !filepath.IsAbs(m.MountPath) {
+				return fmt.Errorf("extraVolumes.%s: volume %q needs an absolute hostPath and mountPath", component, m.Name)
+			}
+			if !validHostPathType(m.PathType) {
+				return fmt.Errorf("extraVolumes.%s: volume %q has an invalid pathType %q", component, m.Name, m.PathType)
+			}
+		}
+	}
+	return nil
+}
+
+// Mutator returns a podspec.Mutator mounting the extra volumes into the apiserver and controller manager static pods,
+// a volume named the same as one already in the pod is an error (rather than replacing a kubeadm or keto-k8 volume)
+func (v *ExtraVolumes) Mutator() podspec.Mutator {
+	return func(o podspec.Object) error {
+		if o.Container(apiServerContainer) != nil {
+			return addHostPathMounts(o, apiServerContainer, v.APIServer)
+		}
+		if o.Container(controllerManagerContainer) != nil {
+			return addHostPathMounts(o, controllerManagerContainer, v.ControllerManager)
+		}
+		return nil
+	}
+}
+
+// Enabled is true when any extra volumes are set
+func (v *ExtraVolumes) Enabled() bool {
+	return v != nil && (len(v.APIServer) > 0 || len(v.ControllerManager) > 0)
+}
+
+// addHostPathMounts will add each host path as a pod volume mounted into the container
+func addHostPathMounts(o podspec.Object, containerName string, mounts []HostPathMount) error {
+	volumes, _ := o.PodSpec()["volumes"].([]interface{})
+	existing := map[interface{}]bool{}
+	for _, volume := range volumes {
+		if m, ok := volume.(map[string]interface{}); ok {
+			existing[m["name"]] = true
+		}
+	}
+	for _, m := range mounts {
+		if existing[m.Name] {
+			return fmt.Errorf("extra volume %q is already a volume of %s", m.Name, o.Name())
+		}
+		hostPath := map[string]interface{}{"path": m.HostPath}
+		if len(m.PathType) > 0 {
+			hostPath["type"] = m.PathType
+		}
+		o.AddVolume(map[string]interface{}{
+			"name":     m.Name,
+			"hostPath": hostPath,
+		})
+		if err := o.AddVolumeMount(containerName, map[string]interface{}{
+			"name":      m.Name,
+			"mountPath": m.MountPath,
+			"readOnly":  m.ReadOnly,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validHostPathType returns true for a known hostPath volume type
+func validHostPathType(pathType string) bool {
+	for _, t := range hostPathTypes {
+		if pathType == t {
+			return true
+		}
+	}
+	return false
+}
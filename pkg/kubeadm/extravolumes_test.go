@@ -0,0 +1,94 @@
+package kubeadm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+)
+
+const testAPIServerPod = `apiVersion: v1
+kind: Pod
+metadata:
+  name: kube-apiserver
+  namespace: kube-system
+spec:
+  containers:
+  - name: kube-apiserver
+    image: gcr.io/google_containers/kube-apiserver-amd64:v1.8.4
+    volumeMounts:
+    - name: certs
+      mountPath: /etc/ssl/certs
+  volumes:
+  - name: certs
+    hostPath:
+      path: /etc/ssl/certs
+`
+
+func TestExtraVolumesValidate(t *testing.T) {
+	var v *ExtraVolumes
+	if err := v.Validate(); err != nil || v.Enabled() {
+		t.Errorf("expected no extra volumes to be valid and disabled but got %v", err)
+	}
+	for _, invalid := range []HostPathMount{
+		{HostPath: "/var/log/audit", MountPath: "/var/log/audit"},
+		{Name: "audit", HostPath: "var/log/audit", MountPath: "/var/log/audit"},
+		{Name: "audit", HostPath: "/var/log/audit", MountPath: "/var/log/audit", PathType: "Dir"},
+	} {
+		v = &ExtraVolumes{ControllerManager: []HostPathMount{invalid}}
+		if err := v.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", invalid)
+		}
+	}
+	audit := HostPathMount{Name: "audit", HostPath: "/var/log/audit", MountPath: "/var/log/audit", PathType: "DirectoryOrCreate"}
+	v = &ExtraVolumes{APIServer: []HostPathMount{audit, audit}}
+	if err := v.Validate(); err == nil {
+		t.Error("expected an error for duplicate volume names")
+	}
+	// The same name for each component is fine
+	v = &ExtraVolumes{APIServer: []HostPathMount{audit}, ControllerManager: []HostPathMount{audit}}
+	if err := v.Validate(); err != nil || !v.Enabled() {
+		t.Errorf("expected the extra volumes to be valid and enabled but got %v", err)
+	}
+}
+
+func TestExtraVolumesMutator(t *testing.T) {
+	v := &ExtraVolumes{
+		APIServer: []HostPathMount{{
+			Name:      "audit-log",
+			HostPath:  "/var/log/kubernetes/audit",
+			MountPath: "/var/log/audit",
+			PathType:  "DirectoryOrCreate",
+		}},
+		ControllerManager: []HostPathMount{{
+			Name:      "cloud-config",
+			HostPath:  "/etc/kubernetes/cloud.conf",
+			MountPath: "/etc/kubernetes/cloud.conf",
+			ReadOnly:  true,
+		}},
+	}
+	manifest, err := podspec.Transform(testAPIServerPod, v.Mutator())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"name: audit-log",
+		"path: /var/log/kubernetes/audit",
+		"type: DirectoryOrCreate",
+		"mountPath: /var/log/audit",
+		"mountPath: /etc/ssl/certs",
+	} {
+		if !strings.Contains(manifest, expected) {
+			t.Errorf("expected the apiserver manifest to contain %q but got:\n%s", expected, manifest)
+		}
+	}
+	if strings.Contains(manifest, "cloud-config") {
+		t.Errorf("expected only the apiserver volumes but got:\n%s", manifest)
+	}
+
+	// Existing volumes aren't replaced
+	v.APIServer[0].Name = "certs"
+	if _, err = podspec.Transform(testAPIServerPod, v.Mutator()); err == nil {
+		t.Error("expected an error for an extra volume with the name of an existing volume")
+	}
+}
@@ -0,0 +1,56 @@
+package kubeadm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+)
+
+// The layout of a PKI fixture dir mirrors the kubernetes dir:
+//   <dir>/pki/*  - the certs and keys kubeadm would create (e.g. sa.key, front-proxy-ca.crt)
+//   <dir>/*.conf - the kubeconfig files kubeadm would create (e.g. admin.conf)
+
+// createPKIFromFixtures will copy the pre-generated certs and keys instead of running kubeadm
+// As with kubeadm, existing files (e.g. the shared assets on a secondary master) are kept
+func createPKIFromFixtures(fixtureDir string) error {
+	src := filepath.Join(fixtureDir, "pki")
+	files, err := ioutil.ReadDir(src)
+	if err != nil {
+		return fmt.Errorf("error reading pki fixtures [%v]", err)
+	}
+	if err = os.MkdirAll(PkiDir, 0700); err != nil {
+		return err
+	}
+	for _, f := range files {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		dst := filepath.Join(PkiDir, f.Name())
+		if fileutil.ExistFile(dst) {
+			logger.Printf("Keeping existing:%q", dst)
+			continue
+		}
+		mode := os.FileMode(0644)
+		if strings.HasSuffix(f.Name(), ".key") {
+			mode = 0600
+		}
+		if err = copyFixture(filepath.Join(src, f.Name()), dst, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFixture will write the contents of a fixture file with the mode specified
+func copyFixture(src, dst string, mode os.FileMode) error {
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("error reading fixture [%v]", err)
+	}
+	logger.Printf("Saving fixture:%q", dst)
+	return fileutil.WriteFile(dst, data, mode)
+}
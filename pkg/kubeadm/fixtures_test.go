@@ -0,0 +1,75 @@
+package kubeadm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const pkiFixtureDir = "testdata/pki-fixtures"
+
+func TestPKIFixtures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeadm-fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(pkiDir, kubeConfigDir string) {
+		PkiDir = pkiDir
+		KubeConfigDir = kubeConfigDir
+	}(PkiDir, KubeConfigDir)
+	PkiDir = filepath.Join(dir, "primary", "pki")
+	KubeConfigDir = filepath.Join(dir, "primary")
+
+	k := &Config{PKIFixtureDir: pkiFixtureDir, KubeletID: "fixture"}
+	if err = k.CreatePKI(); err != nil {
+		t.Fatal(err)
+	}
+	assets, err := k.LoadAndSerializeAssets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden, err := ioutil.ReadFile(filepath.Join(pkiFixtureDir, "assets.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serialized, err := decompressAssets(assets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(serialized) != string(golden) {
+		t.Errorf("expected the serialized assets to match the golden file but got %s", serialized)
+	}
+
+	if err = k.CreateKubeConfig(); err != nil {
+		t.Fatal(err)
+	}
+	assertSameFile(t, filepath.Join(pkiFixtureDir, "kubelet.conf"), filepath.Join(KubeConfigDir, "kubelet.conf"))
+
+	// A secondary master saves the shared assets
+	PkiDir = filepath.Join(dir, "secondary", "pki")
+	if err = os.MkdirAll(PkiDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err = k.SaveAssets(assets); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"sa.key", "sa.pub", "front-proxy-ca.crt", "front-proxy-ca.key"} {
+		assertSameFile(t, filepath.Join(pkiFixtureDir, "pki", file), filepath.Join(PkiDir, file))
+	}
+}
+
+func assertSameFile(t *testing.T, expected, actual string) {
+	e, err := ioutil.ReadFile(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := ioutil.ReadFile(actual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(e) != string(a) {
+		t.Errorf("expected %s to match %s", actual, expected)
+	}
+}
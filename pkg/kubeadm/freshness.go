@@ -0,0 +1,188 @@
+package kubeadm
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	certutil "github.com/UKHomeOffice/keto-k8/pkg/client-go/util/cert"
+	kubeadmconstants "github.com/UKHomeOffice/keto-k8/pkg/kubeadm/constants"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm/pkiutil"
+	"github.com/UKHomeOffice/keto-k8/pkg/notify"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// CertMinValidity is how long the certs on disk must still be valid for to be re-used
+var CertMinValidity = 24 * time.Hour
+
+// CAExpiryWarning is how long before the kube CA expires a CertExpiry notification is sent (the certs signed by it are
+// re-created automatically but the CA itself has to be rotated)
+var CAExpiryWarning = 30 * 24 * time.Hour
+
+// CheckCAExpiry will send a CertExpiry notification when the kube CA cert file expires within the CAExpiryWarning
+func CheckCAExpiry(caCertFile string) error {
+	certs, err := certutil.CertsFromFile(caCertFile)
+	if err != nil {
+		return err
+	}
+	if ca := certs[0]; time.Now().Add(CAExpiryWarning).After(ca.NotAfter) {
+		message := fmt.Sprintf("the kube CA %s expires at %v, it must be rotated before then", caCertFile, ca.NotAfter)
+		logger.Warnf("Warning %s", message)
+		notify.Send(notify.CertExpiry, notify.Warning, message)
+	}
+	return nil
+}
+
+// AssetsUpToDate returns true when the shared assets on disk match the assets specified and all the certs and
+// kubeconfigs created from them are still valid (e.g. after a reboot) so they don't need to be created again
+func (k *Config) AssetsUpToDate(assets string) bool {
+	if err := k.checkAssetsUpToDate(assets); err != nil {
+		logger.Printf("Re-creating the assets on disk:%v", err)
+		return false
+	}
+	return true
+}
+
+// checkAssetsUpToDate returns why the assets on disk can't be re-used
+func (k *Config) checkAssetsUpToDate(assets string) error {
+	local, err := k.LoadAndSerializeAssets()
+	if err != nil {
+		return err
+	}
+	// Assets downloaded with kubeadm can't be compared (only the join details are shared)
+	if !IsJoinAssets(assets) {
+		shared, err := decompressAssets(assets)
+		if err != nil {
+			return err
+		}
+		onDisk, err := decompressAssets(local)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(shared, onDisk) {
+			return fmt.Errorf("the shared assets have changed")
+		}
+	}
+
+	ca, err := pkiutil.TryLoadCertFromDisk(PkiDir, kubeadmconstants.CACertAndKeyBaseName)
+	if err != nil {
+		return err
+	}
+	frontProxyCA, err := pkiutil.TryLoadCertFromDisk(PkiDir, kubeadmconstants.FrontProxyCACertAndKeyBaseName)
+	if err != nil {
+		return err
+	}
+	// The kube CA is copied from the persistent volume on every run so may have been replaced
+	for name, signer := range map[string]*x509.Certificate{
+		kubeadmconstants.APIServerCertAndKeyBaseName:              ca,
+		kubeadmconstants.APIServerKubeletClientCertAndKeyBaseName: ca,
+		kubeadmconstants.FrontProxyClientCertAndKeyBaseName:       frontProxyCA,
+	} {
+		cert, _, err := pkiutil.TryLoadCertAndKeyFromDisk(PkiDir, name)
+		if err != nil {
+			return err
+		}
+		if err = checkCert(name, cert, signer); err != nil {
+			return err
+		}
+		if name == kubeadmconstants.APIServerCertAndKeyBaseName {
+			if err = k.checkAPIServerSANs(cert); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The kubeconfigs must trust the whole CA bundle (e.g. the old and new CAs during a CA rotation)
+	caBundle, err := certutil.CertsFromFile(PkiDir + "/" + kubeadmconstants.CACertAndKeyBaseName + ".crt")
+	if err != nil {
+		return err
+	}
+	for _, file := range []string{
+		kubeadmconstants.AdminKubeConfigFileName,
+		kubeadmconstants.KubeletKubeConfigFileName,
+		kubeadmconstants.ControllerManagerKubeConfigFileName,
+		kubeadmconstants.SchedulerKubeConfigFileName,
+	} {
+		if err = k.checkKubeConfig(file, ca, caBundle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkKubeConfig will check a kubeconfig file is for the api server, trusts the CA bundle and has a client cert
+// signed by the CA
+func (k *Config) checkKubeConfig(file string, ca *x509.Certificate, caBundle []*x509.Certificate) error {
+	config, err := clientcmd.LoadFromFile(KubeConfigDir + "/" + file)
+	if err != nil {
+		return err
+	}
+	for _, cluster := range config.Clusters {
+		if k.APIServer != nil && cluster.Server != k.APIServer.String() {
+			return fmt.Errorf("%s is for server %s", file, cluster.Server)
+		}
+		if !sameCerts(cluster.CertificateAuthorityData, caBundle) {
+			return fmt.Errorf("%s doesn't trust the current CA bundle", file)
+		}
+	}
+	if len(config.AuthInfos) == 0 {
+		return fmt.Errorf("%s has no users", file)
+	}
+	for _, user := range config.AuthInfos {
+		block, _ := pem.Decode(user.ClientCertificateData)
+		if block == nil {
+			return fmt.Errorf("%s has no client cert", file)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("%s client cert could not be parsed [%v]", file, err)
+		}
+		if err = checkCert(file, cert, ca); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkAPIServerSANs will check the api server cert is valid for the api server host (it's re-created when the api
+// server name or IP changes)
+func (k *Config) checkAPIServerSANs(cert *x509.Certificate) error {
+	if k.APIServer == nil {
+		return nil
+	}
+	host, err := getHost(k.APIServer)
+	if err != nil {
+		return err
+	}
+	if err = cert.VerifyHostname(host); err != nil {
+		return fmt.Errorf("%s cert isn't valid for the api server %s [%v]", kubeadmconstants.APIServerCertAndKeyBaseName, host, err)
+	}
+	return nil
+}
+
+// checkCert will check a cert is signed by the CA and valid for at least the CertMinValidity
+func checkCert(name string, cert *x509.Certificate, ca *x509.Certificate) error {
+	if time.Now().Add(CertMinValidity).After(cert.NotAfter) {
+		return fmt.Errorf("%s cert expires at %v", name, cert.NotAfter)
+	}
+	if err := cert.CheckSignatureFrom(ca); err != nil {
+		return fmt.Errorf("%s cert not signed by the CA [%v]", name, err)
+	}
+	return nil
+}
+
+// sameCerts returns true when the PEM data has exactly the certs specified (in the same order)
+func sameCerts(data []byte, certs []*x509.Certificate) bool {
+	parsed, err := certutil.ParseCertsPEM(data)
+	if err != nil || len(parsed) != len(certs) {
+		return false
+	}
+	for i, cert := range parsed {
+		if !cert.Equal(certs[i]) {
+			return false
+		}
+	}
+	return true
+}
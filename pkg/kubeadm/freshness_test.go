@@ -0,0 +1,153 @@
+package kubeadm
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	certutil "github.com/UKHomeOffice/keto-k8/pkg/client-go/util/cert"
+	kubeadmconstants "github.com/UKHomeOffice/keto-k8/pkg/kubeadm/constants"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm/pkiutil"
+	"github.com/UKHomeOffice/keto-k8/pkg/notify"
+)
+
+func TestAssetsUpToDate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeadm-freshness")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(pkiDir, kubeConfigDir string) {
+		PkiDir = pkiDir
+		KubeConfigDir = kubeConfigDir
+	}(PkiDir, KubeConfigDir)
+	PkiDir = filepath.Join(dir, "pki")
+	KubeConfigDir = dir
+
+	ca, caKey := writeTestCA(t, kubeadmconstants.CACertAndKeyBaseName)
+	frontProxyCA, frontProxyCAKey := writeTestCA(t, kubeadmconstants.FrontProxyCACertAndKeyBaseName)
+	if err = pkiutil.WriteKey(PkiDir, kubeadmconstants.ServiceAccountKeyBaseName, caKey); err != nil {
+		t.Fatal(err)
+	}
+	if err = pkiutil.WritePublicKey(PkiDir, kubeadmconstants.ServiceAccountKeyBaseName, &caKey.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+	writeTestCert(t, kubeadmconstants.APIServerCertAndKeyBaseName, ca, caKey, "kube.example.com")
+	writeTestCert(t, kubeadmconstants.APIServerKubeletClientCertAndKeyBaseName, ca, caKey)
+	writeTestCert(t, kubeadmconstants.FrontProxyClientCertAndKeyBaseName, frontProxyCA, frontProxyCAKey)
+
+	apiServer, _ := url.Parse("https://kube.example.com")
+	k := &Config{APIServer: apiServer, KubeletID: "master1"}
+	if err = k.CreateKubeConfig(); err != nil {
+		t.Fatal(err)
+	}
+	assets, err := k.LoadAndSerializeAssets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !k.AssetsUpToDate(assets) {
+		t.Error("expected the assets on disk to be up to date")
+	}
+
+	// Changed shared assets
+	if k.AssetsUpToDate(`{"SaPub":"changed"}`) {
+		t.Error("expected the assets on disk to be out of date when the shared assets have changed")
+	}
+
+	// A different api server
+	moved, _ := url.Parse("https://moved.example.com")
+	if (&Config{APIServer: moved}).AssetsUpToDate(assets) {
+		t.Error("expected the kubeconfigs to be out of date for a different api server")
+	}
+
+	// An api server cert without the api server name
+	writeTestCert(t, kubeadmconstants.APIServerCertAndKeyBaseName, ca, caKey, "old.example.com")
+	if k.AssetsUpToDate(assets) {
+		t.Error("expected the api server cert to be out of date without the api server name")
+	}
+
+	// A replaced kube CA
+	writeTestCA(t, kubeadmconstants.CACertAndKeyBaseName)
+	if k.AssetsUpToDate(assets) {
+		t.Error("expected the certs to be out of date when the CA has been replaced")
+	}
+}
+
+func TestCheckCAExpiry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeadm-freshness")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(pkiDir string, warning time.Duration) {
+		PkiDir = pkiDir
+		CAExpiryWarning = warning
+	}(PkiDir, CAExpiryWarning)
+	PkiDir = filepath.Join(dir, "pki")
+
+	var alerts []notify.Alert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a notify.Alert
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			t.Error(err)
+		}
+		alerts = append(alerts, a)
+	}))
+	defer server.Close()
+	if err = notify.Configure(&notify.Config{Webhook: &notify.Webhook{URL: server.URL}}); err != nil {
+		t.Fatal(err)
+	}
+	defer notify.Configure(nil)
+
+	caCertFile := filepath.Join(PkiDir, kubeadmconstants.CACertAndKeyBaseName+".crt")
+	if err = CheckCAExpiry(caCertFile); err == nil {
+		t.Error("expected an error without a CA")
+	}
+	ca, _ := writeTestCA(t, kubeadmconstants.CACertAndKeyBaseName)
+	if err = CheckCAExpiry(caCertFile); err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 0 {
+		t.Errorf("expected no alerts for a new CA but got %v", alerts)
+	}
+	CAExpiryWarning = ca.NotAfter.Sub(time.Now()) + time.Hour
+	if err = CheckCAExpiry(caCertFile); err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 || alerts[0].Type != notify.CertExpiry || alerts[0].Severity != notify.Warning {
+		t.Errorf("expected a %s alert for an expiring CA but got %v", notify.CertExpiry, alerts)
+	}
+}
+
+func writeTestCA(t *testing.T, name string) (*x509.Certificate, *rsa.PrivateKey) {
+	cert, key, err := pkiutil.NewCertificateAuthority()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pkiutil.WriteCertAndKey(PkiDir, name, cert, key); err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func writeTestCert(t *testing.T, name string, ca *x509.Certificate, caKey *rsa.PrivateKey, dnsNames ...string) {
+	cert, key, err := pkiutil.NewCertAndKey(ca, caKey, certutil.Config{
+		CommonName: name,
+		AltNames:   certutil.AltNames{DNSNames: dnsNames},
+		Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pkiutil.WriteCertAndKey(PkiDir, name, cert, key); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,313 @@
+package kubeadm
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/failure"
+	kubeadmconstants "github.com/UKHomeOffice/keto-k8/pkg/kubeadm/constants"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm/pkiutil"
+	"github.com/ghodss/yaml"
+	"k8s.io/kubernetes/pkg/util/version"
+)
+
+// Join modes set how the secondary masters get the shared assets created by the primary master
+const (
+	// JoinModeAssets shares the assets through etcd (the default)
+	JoinModeAssets = "assets"
+	// JoinModeKubeadm uploads the assets to the cluster encrypted with the certificate key (kubeadm init phase
+	// upload-certs) and the secondary masters download them with kubeadm join, only the join token is shared in etcd
+	JoinModeKubeadm = "kubeadm"
+)
+
+// JoinTTL is how long the join token is valid for (the same as the kubeadm-certs secret)
+var JoinTTL = 2 * time.Hour
+
+// joinAssetsPrefix marks the join details shared in etcd instead of the assets
+const joinAssetsPrefix = "kmm-join:"
+
+// kubeadmAPIVersion is the kubeadm config version used with the join mode
+const kubeadmAPIVersion = "kubeadm.k8s.io/v1beta2"
+
+// First version with kubeadm join phase control-plane-prepare download-certs
+var minJoinVersion = version.MustParseGeneric("v1.15.0")
+
+// certificateKeyRegexp is the format of the certificate key (the same as kubeadm --certificate-key)
+var certificateKeyRegexp = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// joinAssets are the details shared in etcd for the secondary masters to join with kubeadm
+type joinAssets struct {
+	Token        string    `json:"token"`
+	CACertHashes []string  `json:"caCertHashes"`
+	Expires      time.Time `json:"expires"`
+}
+
+// ValidateJoinMode will check the join mode is known and the certificate key is set for the kubeadm mode (empty is
+// the default)
+func ValidateJoinMode(mode, certificateKey string) error {
+	switch mode {
+	case "", JoinModeAssets:
+		return nil
+	case JoinModeKubeadm:
+		if !certificateKeyRegexp.MatchString(certificateKey) {
+			return fmt.Errorf("the %s join mode needs a certificate key of 64 hex characters (the same on all masters)", mode)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown join mode %q (expecting %s or %s)", mode, JoinModeAssets, JoinModeKubeadm)
+}
+
+// IsJoinAssets is true when the shared assets are the details to join with kubeadm
+func IsJoinAssets(assets string) bool {
+	return strings.HasPrefix(assets, joinAssetsPrefix)
+}
+
+// UploadCerts will upload the shared assets to the cluster with kubeadm (encrypted with the certificate key) and
+// returns the join details to share instead of the assets
+// kubeadm join reads the cluster config from the kubeadm-config configmap, it's the same config as UploadConfig
+// publishes and is only uploaded here when it isn't published (uploadConfig)
+func (k *Config) UploadCerts(uploadConfig bool) (assets string, err error) {
+	if err = k.checkJoinVersion(); err != nil {
+		return "", err
+	}
+	ca, err := pkiutil.TryLoadCertFromDisk(PkiDir, kubeadmconstants.CACertAndKeyBaseName)
+	if err != nil {
+		return "", err
+	}
+	token, err := newBootstrapToken()
+	if err != nil {
+		return "", err
+	}
+	config, err := k.initConfig(token)
+	if err != nil {
+		return "", err
+	}
+	kubeConfig := path.Join(KubeConfigDir, kubeadmconstants.AdminKubeConfigFileName)
+	phases := [][]string{
+		{"init", "phase", "bootstrap-token"},
+		{"init", "phase", "upload-certs", "--upload-certs"},
+	}
+	if uploadConfig {
+		phases = append([][]string{{"init", "phase", "upload-config", "kubeadm"}}, phases...)
+	}
+	for _, args := range phases {
+		if err = runWithKubeadmConfig(*k, config, append(args, "--kubeconfig", kubeConfig)); err != nil {
+			return "", err
+		}
+	}
+	b, err := json.Marshal(joinAssets{
+		Token:        token,
+		CACertHashes: []string{CACertHash(ca)},
+		Expires:      time.Now().Add(JoinTTL).UTC(),
+	})
+	if err != nil {
+		return "", err
+	}
+	logger.Printf("Uploaded the certs with kubeadm, secondary masters can join until %s", time.Now().Add(JoinTTL))
+	return joinAssetsPrefix + string(b), nil
+}
+
+// DownloadCerts will download the shared assets uploaded by the primary master with kubeadm and save them to disk
+// kubeadm downloads them to the pki dir of the cluster config, only the service account key and front proxy CA are
+// used: the kube CA is always the persistent CA and this master's etcd client cert is restored
+func (k *Config) DownloadCerts(assets string) (err error) {
+	if err = k.checkJoinVersion(); err != nil {
+		return err
+	}
+	join := joinAssets{}
+	if err = json.Unmarshal([]byte(strings.TrimPrefix(assets, joinAssetsPrefix)), &join); err != nil {
+		return fmt.Errorf("join details could not be decoded [%v]", err)
+	}
+	if time.Now().After(join.Expires) {
+		return failure.New(fmt.Sprintf("the kubeadm join token expired at %s", join.Expires),
+			"restart kmm on the primary master to upload the certs again")
+	}
+	config, err := k.joinConfig(join)
+	if err != nil {
+		return err
+	}
+	restore, err := k.keepEtcdClientCert()
+	if err != nil {
+		return err
+	}
+	args := []string{"join", "phase", "control-plane-prepare", "download-certs"}
+	err = runWithKubeadmConfig(*k, config, args)
+	if rerr := restore(); err == nil {
+		err = rerr
+	}
+	if err != nil {
+		return err
+	}
+	files := map[string]*string{}
+	shared := SharedAssets{}
+	files[kubeadmconstants.ServiceAccountPublicKeyName] = &shared.SaPub
+	files[kubeadmconstants.ServiceAccountPrivateKeyName] = &shared.SaKey
+	files[kubeadmconstants.FrontProxyCACertName] = &shared.FrontProxyCa
+	files[kubeadmconstants.FrontProxyCAKeyName] = &shared.FrontProxyCaKey
+	for name, data := range files {
+		b, err := ioutil.ReadFile(path.Join(PkiDir, name))
+		if err != nil {
+			return fmt.Errorf("%s wasn't downloaded with kubeadm [%v]", name, err)
+		}
+		*data = string(b)
+	}
+	b, err := json.Marshal(shared)
+	if err != nil {
+		return err
+	}
+	return k.SaveAssets(string(b))
+}
+
+// keepEtcdClientCert returns a func to restore this master's etcd client cert and key, kubeadm download-certs
+// overwrites them with the primary's with an external etcd
+func (k *Config) keepEtcdClientCert() (restore func() error, err error) {
+	files := map[string][]byte{}
+	if len(k.EtcdClientConfig.Endpoints) > 0 {
+		for _, name := range []string{k.EtcdClientConfig.ClientCertFileName, k.EtcdClientConfig.ClientKeyFileName} {
+			if files[name], err = ioutil.ReadFile(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return func() error {
+		for name, data := range files {
+			if err := ioutil.WriteFile(name, data, 0600); err != nil {
+				return fmt.Errorf("the etcd client cert %s could not be restored [%v]", name, err)
+			}
+		}
+		return nil
+	}, nil
+}
+
+// checkJoinVersion returns an error when kubeadm can't be used to join at the kubernetes version
+func (k *Config) checkJoinVersion() error {
+	v, err := version.ParseGeneric(k.KubeVersion)
+	if err != nil {
+		return fmt.Errorf("couldn't parse kubernetes version %q: %v", k.KubeVersion, err)
+	}
+	if v.LessThan(minJoinVersion) {
+		return fmt.Errorf("the %s join mode requires kubernetes %s or later (not %s)", JoinModeKubeadm, minJoinVersion, k.KubeVersion)
+	}
+	return nil
+}
+
+// initConfig returns the kubeadm init and cluster config for the upload phases, the cluster config is the same as
+// UploadConfig publishes (with the real pki dir)
+func (k *Config) initConfig(token string) ([]byte, error) {
+	cfg, err := upstreamClusterConfig(*k)
+	if err != nil {
+		return nil, err
+	}
+	return kubeadmConfig(
+		map[string]interface{}{
+			"apiVersion":     kubeadmAPIVersion,
+			"kind":           "InitConfiguration",
+			"certificateKey": k.CertificateKey,
+			"bootstrapTokens": []interface{}{
+				map[string]interface{}{
+					"token":       token,
+					"ttl":         JoinTTL.String(),
+					"usages":      []string{"signing", "authentication"},
+					"groups":      []string{defaultNodeGroup},
+					"description": "keto-k8 master join",
+				},
+			},
+			"nodeRegistration": map[string]interface{}{"name": k.KubeletID},
+		},
+		cfg.configuration(kubeadmAPIVersion),
+	)
+}
+
+// joinConfig returns the kubeadm join config to download the certs
+func (k *Config) joinConfig(join joinAssets) ([]byte, error) {
+	endpoint, err := k.apiServerEndpoint()
+	if err != nil {
+		return nil, err
+	}
+	return kubeadmConfig(map[string]interface{}{
+		"apiVersion": kubeadmAPIVersion,
+		"kind":       "JoinConfiguration",
+		"discovery": map[string]interface{}{
+			"bootstrapToken": map[string]interface{}{
+				"token":             join.Token,
+				"apiServerEndpoint": endpoint,
+				"caCertHashes":      join.CACertHashes,
+			},
+		},
+		"controlPlane":     map[string]interface{}{"certificateKey": k.CertificateKey},
+		"nodeRegistration": map[string]interface{}{"name": k.KubeletID},
+	})
+}
+
+// apiServerEndpoint returns the api server host and port (kubeadm needs the port)
+func (k *Config) apiServerEndpoint() (string, error) {
+	if k.APIServer == nil {
+		return "", fmt.Errorf("the api server must be known to join with kubeadm")
+	}
+	if len(k.APIServer.Port()) > 0 {
+		return k.APIServer.Host, nil
+	}
+	port := "443"
+	if k.APIServer.Scheme == "http" {
+		port = "80"
+	}
+	return net.JoinHostPort(k.APIServer.Hostname(), port), nil
+}
+
+// kubeadmConfig returns the yaml documents of a kubeadm config file
+func kubeadmConfig(docs ...map[string]interface{}) ([]byte, error) {
+	var config []byte
+	for _, doc := range docs {
+		b, err := yaml.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		config = append(append(config, "---\n"...), b...)
+	}
+	return config, nil
+}
+
+// runWithKubeadmConfig will run kubeadm with a temporary config file (it has the token and certificate key)
+func runWithKubeadmConfig(cfg Config, config []byte, args []string) error {
+	f, err := ioutil.TempFile("", "kubeadm-config")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(config)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	_, err = runKubeadm(cfg, append(args, "--config", f.Name()))
+	return err
+}
+
+// newBootstrapToken returns a random bootstrap token ([a-z0-9]{6}.[a-z0-9]{16})
+func newBootstrapToken() (string, error) {
+	const chars = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, 23)
+	for i := range b {
+		if i == 6 {
+			b[i] = '.'
+			continue
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = chars[n.Int64()]
+	}
+	return string(b), nil
+}
@@ -0,0 +1,200 @@
+package kubeadm
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/etcd"
+)
+
+const testCertificateKey = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestValidateJoinMode(t *testing.T) {
+	for _, c := range []struct {
+		mode  string
+		key   string
+		valid bool
+	}{
+		{mode: "", valid: true},
+		{mode: JoinModeAssets, valid: true},
+		{mode: JoinModeKubeadm, key: testCertificateKey, valid: true},
+		{mode: JoinModeKubeadm},
+		{mode: JoinModeKubeadm, key: "not-hex"},
+		{mode: "etcd", key: testCertificateKey},
+	} {
+		if err := ValidateJoinMode(c.mode, c.key); (err == nil) != c.valid {
+			t.Errorf("expected join mode %q (key %q) valid to be %v but got %v", c.mode, c.key, c.valid, err)
+		}
+	}
+}
+
+func TestNewBootstrapToken(t *testing.T) {
+	token, err := newBootstrapToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bootstrapTokenRegexp.MatchString(token) {
+		t.Errorf("expected a valid bootstrap token but got %q", token)
+	}
+	if other, _ := newBootstrapToken(); other == token {
+		t.Errorf("expected a random bootstrap token but got %q twice", token)
+	}
+}
+
+func TestAPIServerEndpoint(t *testing.T) {
+	for server, expected := range map[string]string{
+		"https://kube-api.example.com:6443": "kube-api.example.com:6443",
+		"https://kube-api.example.com":      "kube-api.example.com:443",
+		"https://10.250.0.1":                "10.250.0.1:443",
+	} {
+		u, _ := url.Parse(server)
+		endpoint, err := (&Config{APIServer: u}).apiServerEndpoint()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if endpoint != expected {
+			t.Errorf("expected the endpoint for %s to be %s but got %s", server, expected, endpoint)
+		}
+	}
+	if _, err := (&Config{}).apiServerEndpoint(); err == nil {
+		t.Errorf("expected an error without an api server")
+	}
+}
+
+func TestJoinConfig(t *testing.T) {
+	u, _ := url.Parse("https://kube-api.example.com")
+	k := &Config{APIServer: u, CertificateKey: testCertificateKey, KubeletID: "master2"}
+	config, err := k.joinConfig(joinAssets{Token: testBootstrapToken, CACertHashes: []string{"sha256:abc"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"kind: JoinConfiguration",
+		"apiServerEndpoint: kube-api.example.com:443",
+		"token: " + testBootstrapToken,
+		"- sha256:abc",
+		"certificateKey: " + testCertificateKey,
+		"name: master2",
+	} {
+		if !strings.Contains(string(config), expected) {
+			t.Errorf("expected the join config to contain %q but got:\n%s", expected, config)
+		}
+	}
+}
+
+func TestInitConfig(t *testing.T) {
+	u, _ := url.Parse("https://kube-api.example.com:6443")
+	k := &Config{
+		APIServer:      u,
+		CertificateKey: testCertificateKey,
+		KubeVersion:    "v1.15.3",
+		PodNetworkCidr: "10.244.0.0/16",
+		EtcdClientConfig: etcd.Client{
+			Endpoints:          "https://127.0.0.1:2379",
+			ClientCertFileName: "/srv/etcd/client.crt",
+		},
+	}
+	config, err := k.initConfig(testBootstrapToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := strings.Split(strings.TrimPrefix(string(config), "---\n"), "---\n")
+	if len(docs) != 2 {
+		t.Fatalf("expected an init and cluster config but got:\n%s", config)
+	}
+	for _, expected := range []string{"kind: InitConfiguration", "token: " + testBootstrapToken, "ttl: 2h0m0s"} {
+		if !strings.Contains(docs[0], expected) {
+			t.Errorf("expected the init config to contain %q but got:\n%s", expected, docs[0])
+		}
+	}
+	for _, expected := range []string{
+		"kind: ClusterConfiguration",
+		"certificatesDir: /etc/kubernetes/pki",
+		"controlPlaneEndpoint: kube-api.example.com:6443",
+		"kubernetesVersion: v1.15.3",
+		"podSubnet: 10.244.0.0/16",
+		"certFile: /srv/etcd/client.crt",
+	} {
+		if !strings.Contains(docs[1], expected) {
+			t.Errorf("expected the cluster config to contain %q but got:\n%s", expected, docs[1])
+		}
+	}
+	// The same cluster config as published to the kubeadm-config configmap
+	cfg, err := upstreamClusterConfig(*k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	published, err := kubeadmConfig(cfg.configuration(kubeadmAPIVersion))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if "---\n"+docs[1] != string(published) {
+		t.Errorf("expected the published cluster config:\n%s\nbut got:\n%s", published, docs[1])
+	}
+}
+
+func TestKeepEtcdClientCert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "joinmode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	k := &Config{EtcdClientConfig: etcd.Client{
+		Endpoints:          "https://127.0.0.1:2379",
+		ClientCertFileName: filepath.Join(dir, "client.crt"),
+		ClientKeyFileName:  filepath.Join(dir, "client.key"),
+	}}
+	for _, name := range []string{k.EtcdClientConfig.ClientCertFileName, k.EtcdClientConfig.ClientKeyFileName} {
+		if err = ioutil.WriteFile(name, []byte("master2"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	restore, err := k.keepEtcdClientCert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// As kubeadm download-certs would with the primary's cert
+	for _, name := range []string{k.EtcdClientConfig.ClientCertFileName, k.EtcdClientConfig.ClientKeyFileName} {
+		if err = ioutil.WriteFile(name, []byte("master1"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = restore(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{k.EtcdClientConfig.ClientCertFileName, k.EtcdClientConfig.ClientKeyFileName} {
+		if b, _ := ioutil.ReadFile(name); string(b) != "master2" {
+			t.Errorf("expected %s to be restored but got %q", name, b)
+		}
+	}
+	if _, err = (&Config{}).keepEtcdClientCert(); err != nil {
+		t.Errorf("expected nothing to keep without an etcd but got %v", err)
+	}
+}
+
+func TestDownloadCertsChecks(t *testing.T) {
+	expired, _ := json.Marshal(joinAssets{Token: testBootstrapToken, Expires: time.Now().Add(-time.Minute)})
+	for _, c := range []struct {
+		version string
+		assets  string
+		err     string
+	}{
+		{version: "v1.9.3", assets: joinAssetsPrefix + string(expired), err: "or later (not v1.9.3)"},
+		{version: "v1.15.3", assets: joinAssetsPrefix + "{", err: "could not be decoded"},
+		{version: "v1.15.3", assets: joinAssetsPrefix + string(expired), err: "expired"},
+	} {
+		k := &Config{KubeVersion: c.version, CertificateKey: testCertificateKey}
+		if err := k.DownloadCerts(c.assets); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("expected an error containing %q but got %v", c.err, err)
+		}
+	}
+	if !IsJoinAssets(joinAssetsPrefix+string(expired)) || IsJoinAssets(compressedAssetsPrefix) {
+		t.Errorf("expected only the join details to be join assets")
+	}
+}
@@ -5,32 +5,41 @@ import (
 	"crypto/x509"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net"
 	"net/url"
 	"os"
-	"os/exec"
-	"strconv"
 	"strings"
 
 	certutil "github.com/UKHomeOffice/keto-k8/pkg/client-go/util/cert"
-	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
-	kubeadmconstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+	kubeadmconstants "github.com/UKHomeOffice/keto-k8/pkg/kubeadm/constants"
 
-	log "github.com/Sirupsen/logrus"
-
-	"github.com/UKHomeOffice/keto-k8/pkg/constants"
+	"github.com/UKHomeOffice/keto-k8/pkg/audit"
+	"github.com/UKHomeOffice/keto-k8/pkg/authwebhook"
+	"github.com/UKHomeOffice/keto-k8/pkg/backup"
+	"github.com/UKHomeOffice/keto-k8/pkg/command"
 	"github.com/UKHomeOffice/keto-k8/pkg/etcd"
+	"github.com/UKHomeOffice/keto-k8/pkg/failure"
+	"github.com/UKHomeOffice/keto-k8/pkg/kms"
 	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm/pkiutil"
+	"github.com/UKHomeOffice/keto-k8/pkg/logging"
+	"github.com/UKHomeOffice/keto-k8/pkg/oidc"
+	"github.com/UKHomeOffice/keto-k8/pkg/placement"
+	"github.com/UKHomeOffice/keto-k8/pkg/tlsconfig"
+	"github.com/UKHomeOffice/keto-k8/pkg/tracing"
 )
 
 // TODO: Add mockable interface for testing this package without reference to the real kubeadm
 
 const cmdKubeadm string = "kubeadm"
 
+// DNSAddonName is the name used for the kube-dns values in the config file
+const DNSAddonName = "kube-dns"
+
+// logger is used for all the kubeadm logs
+var logger = logging.New("kubeadm")
+
 var (
-	cmdOptsCerts      = []string{"alpha", "phase", "certs", "selfsign", "--apiserver-advertise-address", "0.0.0.0", "--cert-altnames"}
-	cmdOptsKubeconfig = []string{"alpha", "phase", "kubeconfig", "client-certs"}
+	cmdOptsCerts = []string{"alpha", "phase", "certs", "selfsign", "--apiserver-advertise-address", "0.0.0.0", "--cert-altnames"}
 
 	// PkiDir - The directory kubeadm will store all pki assets
 	PkiDir string = kubeadmconstants.KubernetesDir + "/pki"
@@ -40,6 +49,15 @@ var (
 
 	// CaKeyFile the file name of Kube CA key file (as used by kubeadm)
 	CaKeyFile string = kubeadmconstants.KubernetesDir + "/pki" + "/" + kubeadmconstants.CACertAndKeyBaseName + ".key"
+
+	// KubeConfigDir - The directory the kubeconfig files are written to
+	KubeConfigDir string = kubeadmconstants.KubernetesDir
+
+	// ManifestsDir - The directory kubeadm will write the static pod manifests to
+	ManifestsDir string = kubeadmconstants.KubernetesDir + "/" + kubeadmconstants.ManifestsSubDirName
+
+	// StaticPods - the names of the control plane static pods written by kubeadm
+	StaticPods = []string{"kube-apiserver", "kube-controller-manager", "kube-scheduler"}
 )
 
 // Config represents runtime params cfg structure.
@@ -56,31 +74,83 @@ type Config struct {
 	APIServerExtraArgs         map[string]string
 	ControllerManagerExtraArgs map[string]string
 	SchedulerExtraArgs         map[string]string
+	PodSecurityPolicy          bool
+	// KMS will encrypt secrets when a key is set
+	KMS kms.Config
+	// HardeningProfile sets benchmark recommended flags e.g. cis
+	HardeningProfile string
+	// Audit configures the apiserver audit webhook backend (when set)
+	Audit *audit.Config
+	// OIDC configures the apiserver OpenID Connect authenticator (when set)
+	OIDC *oidc.Config
+	// Webhooks configures the apiserver authentication and authorization webhooks (when set)
+	Webhooks *authwebhook.Config
+	// TLS restricts the apiserver (and kubelet) TLS versions and ciphers
+	TLS tlsconfig.Config
+	// PKIFixtureDir has pre-generated certs, keys and kubeconfigs to use instead of kubeadm (for testing only)
+	PKIFixtureDir string
+	// CaKeyMode is how the CA key is made available (see CaKeySymlink, CaKeyCopy and CaKeyEphemeral)
+	CaKeyMode string
+	// BootstrapToken is used by compute kubelets to TLS bootstrap (instead of the keto-tokens kubeconfig) when set
+	BootstrapToken string
+	// BootstrapCACertFile is the kube CA trusted by the bootstrap kubeconfig (otherwise it's discovered)
+	BootstrapCACertFile string
+	// ComputeJoinMode is how compute kubelets join (see ComputeJoinModeKetoTokens and ComputeJoinModeToken)
+	ComputeJoinMode string
+	// DiscoveryTokenCACertHashes pin the kube CA discovered from the cluster-info (sha256:<hex> of the public key)
+	DiscoveryTokenCACertHashes []string
+	// Kubelet are the kubelet resource reservations and limits (per node pool)
+	Kubelet *KubeletConfig
+	// JoinMode is how the secondary masters get the shared assets (see JoinModeAssets and JoinModeKubeadm)
+	JoinMode string
+	// CertificateKey encrypts the certs uploaded with kubeadm in the kubeadm join mode (the same on all masters)
+	CertificateKey string
+	// ExtraVolumes are host paths mounted into the apiserver and controller manager (when set)
+	ExtraVolumes *ExtraVolumes
+	// ClusterSigningMode is the CA the controller-manager signs certificate requests with (see ClusterSigningKubeCA and
+	// ClusterSigningDedicated)
+	ClusterSigningMode string
+	// APIProxy serves the api server on an additional port (when set)
+	APIProxy APIProxy
+	// KubeletServingCerts has the kubelets serve with certs signed by the cluster (verified by the apiserver)
+	KubeletServingCerts bool
+	// ServiceAccountRotation is the service account key rotation phase to apply (when one is in progress)
+	ServiceAccountRotation *ServiceAccountRotation
+	// ImageDigests pin the control plane, DNS and CNI images (by name:tag) to a digest
+	ImageDigests map[string]string
+	// DNSPlacement is where the kubeadm created DNS pods are scheduled (when set)
+	DNSPlacement *placement.Placement
+	// StaticPodLogs is how the control plane static pods log (to stderr when not set)
+	StaticPodLogs *StaticPodLogs
 }
 
 // SharedAssets - the data to be shared between all kubernetes masters
 type SharedAssets struct {
-	FrontProxyCa    string
-	FrontProxyCaKey string
-	SaPub           string
-	SaKey           string
+	FrontProxyCa        string
+	FrontProxyCaKey     string
+	SaPub               string
+	SaKey               string
+	ClusterSigningCa    string `json:",omitempty"`
+	ClusterSigningCaKey string `json:",omitempty"`
 }
 
 // Kubeadmer allows for mocking out this lib for testing
 type Kubeadmer interface {
 	Addons() error
+	AssetsUpToDate(assets string) bool
 	CreateKubeConfig() (err error)
 	CreatePKI() (err error)
 	LoadAndSerializeAssets() (assets string, err error)
 	SaveAssets(assets string) (err error)
 	UpdateMasterRoleLabelsAndTaints() error
+	VerifyEncryption() error
 	WriteManifests() (err error)
 }
 
 // verify the concrete implementation satisfies the abstract interface
 var _ Kubeadmer = (*Config)(nil)
 
-// LoadAndSerializeAssets getting assets off disk into a serialized string
+// LoadAndSerializeAssets getting assets off disk into a serialized (compressed) string
 // Return an error if there are no assets (and empty string)
 func (k *Config) LoadAndSerializeAssets() (assets string, err error) {
 	assets = ""
@@ -116,153 +186,139 @@ func (k *Config) LoadAndSerializeAssets() (assets string, err error) {
 		FrontProxyCa:    string(certutil.EncodeCertPEM(frontProxyCACert)[:]),
 		FrontProxyCaKey: string(certutil.EncodePrivateKeyPEM(frontProxyCAKey)[:]),
 	}
+	if k.DedicatedSigningCA() {
+		signingCACert, signingCAKey, err := pkiutil.TryLoadCertAndKeyFromDisk(PkiDir, ClusterSigningCABaseName)
+		if err != nil {
+			return "", fmt.Errorf("cluster signing CA could not be loaded properly [%v]", err)
+		}
+		sharedAssets.ClusterSigningCa = string(certutil.EncodeCertPEM(signingCACert))
+		sharedAssets.ClusterSigningCaKey = string(certutil.EncodePrivateKeyPEM(signingCAKey))
+	}
 
-	// Now json encode the structure
+	// Now json encode (and compress) the structure
 	assetsBytes, _ := json.Marshal(sharedAssets)
-	assets = string(assetsBytes)
-
-	return assets, nil
+	return compressAssets(assetsBytes)
 }
 
 // SaveAssets - will persist assets to disk
 func (k *Config) SaveAssets(assets string) (err error) {
 	pkiDir := PkiDir + "/"
 	sharedAssets := SharedAssets{}
-	json.Unmarshal([]byte(assets), &sharedAssets)
+	assetsBytes, err := decompressAssets(assets)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(assetsBytes, &sharedAssets); err != nil {
+		return failure.Wrap(err, "assets could not be decoded", "check every master runs the same keto-k8 version")
+	}
 
-	// Now save each of the pem files...
-	err = ioutil.WriteFile(pkiDir+kubeadmconstants.ServiceAccountPublicKeyName, []byte(sharedAssets.SaPub), 0644)
+	// Now save each of the pem files (backing up any which are changing)...
+	err = backup.WriteFile(pkiDir+kubeadmconstants.ServiceAccountPublicKeyName, []byte(sharedAssets.SaPub), 0644)
 	if err != nil {
 		return fmt.Errorf("Service Account public key could not saved [%v]", err)
 	}
-	err = ioutil.WriteFile(pkiDir+kubeadmconstants.ServiceAccountPrivateKeyName, []byte(sharedAssets.SaKey), 0600)
+	err = backup.WriteFile(pkiDir+kubeadmconstants.ServiceAccountPrivateKeyName, []byte(sharedAssets.SaKey), 0600)
 	if err != nil {
 		return fmt.Errorf("Service Account private key could not saved [%v]", err)
 	}
-	err = ioutil.WriteFile(pkiDir+kubeadmconstants.FrontProxyCACertName, []byte(sharedAssets.FrontProxyCa), 0644)
+	err = backup.WriteFile(pkiDir+kubeadmconstants.FrontProxyCACertName, []byte(sharedAssets.FrontProxyCa), 0644)
 	if err != nil {
 		return fmt.Errorf("Front proxy public ca cert could not saved [%v]", err)
 	}
-	err = ioutil.WriteFile(pkiDir+kubeadmconstants.FrontProxyCAKeyName, []byte(sharedAssets.FrontProxyCaKey), 0600)
+	err = backup.WriteFile(pkiDir+kubeadmconstants.FrontProxyCAKeyName, []byte(sharedAssets.FrontProxyCaKey), 0600)
 	if err != nil {
 		return fmt.Errorf("Front proxy private key could not saved [%v]", err)
 	}
+	if k.DedicatedSigningCA() {
+		if len(sharedAssets.ClusterSigningCa) == 0 {
+			return failure.New("the shared assets have no cluster signing CA",
+				fmt.Sprintf("check the primary master is in the %s cluster signing mode", ClusterSigningDedicated))
+		}
+		err = backup.WriteFile(pkiDir+ClusterSigningCABaseName+".crt", []byte(sharedAssets.ClusterSigningCa), 0644)
+		if err != nil {
+			return fmt.Errorf("Cluster signing CA cert could not saved [%v]", err)
+		}
+		err = backup.WriteFile(pkiDir+ClusterSigningCABaseName+".key", []byte(sharedAssets.ClusterSigningCaKey), 0600)
+		if err != nil {
+			return fmt.Errorf("Cluster signing CA key could not saved [%v]", err)
+		}
+	}
 
 	return nil
 }
 
 // CreatePKI - generates all PKI assests on to disk
 func (k *Config) CreatePKI() (err error) {
+	if k.PKIFixtureDir != "" {
+		return createPKIFromFixtures(k.PKIFixtureDir)
+	}
 	apiHost := ""
 	if apiHost, err = getHost(k.APIServer); err != nil {
 		return err
 	}
-	log.Printf("Using host:%q", apiHost)
+	logger.Printf("Using host:%q", apiHost)
+	if err = k.removeStaleCerts(); err != nil {
+		return err
+	}
 	args := append(cmdOptsCerts, apiHost)
-	kubeadmOut, err := runKubeadm(*k, args)
-	log.Printf("Output:\n" + kubeadmOut)
-	return err
+	if _, err = runKubeadm(*k, args); err != nil {
+		return err
+	}
+	if k.DedicatedSigningCA() {
+		if err = createClusterSigningCA(); err != nil {
+			return err
+		}
+	}
+	return appendCaIntermediates()
 }
 
 // CreateKubeConfig - Creates all the kubeconfig files requires for masters
+// The client certs are signed in process (the same as kubeadm) so the CA is only loaded once for all the files
 func (k *Config) CreateKubeConfig() (err error) {
 	if k.KubeletID == "" {
 		if k.KubeletID, err = os.Hostname(); err != nil {
 			return err
 		}
 	}
-	if err = createAKubeCfg(*k, kubeadmconstants.AdminKubeConfigFileName,
+	var ca *clientCA
+	if k.PKIFixtureDir == "" {
+		if ca, err = loadClientCA(); err != nil {
+			return err
+		}
+	}
+	if err = createAKubeCfg(*k, ca, kubeadmconstants.AdminKubeConfigFileName,
 		"kubernetes-admin", kubeadmconstants.MastersGroup); err != nil {
 
 		return err
 	}
-	if err = createAKubeCfg(*k, kubeadmconstants.KubeletKubeConfigFileName,
+	if err = createAKubeCfg(*k, ca, kubeadmconstants.KubeletKubeConfigFileName,
 		"system:node:"+k.KubeletID, kubeadmconstants.NodesGroup); err != nil {
 
 		return err
 	}
-	if err = createAKubeCfg(*k, kubeadmconstants.ControllerManagerKubeConfigFileName,
+	if err = createAKubeCfg(*k, ca, kubeadmconstants.ControllerManagerKubeConfigFileName,
 		kubeadmconstants.ControllerManagerUser, ""); err != nil {
 
 		return err
 	}
-	if err = createAKubeCfg(*k, kubeadmconstants.SchedulerKubeConfigFileName,
+	if err = createAKubeCfg(*k, ca, kubeadmconstants.SchedulerKubeConfigFileName,
 		kubeadmconstants.SchedulerUser, ""); err != nil {
 		return err
 	}
-	return nil
-}
-
-// GetKubeadmCfg - will transfer config from kmm to a config struct as used by kubeadm internaly
-// TODO: This is a hack until we can use kubeadm cmd directly...
-func GetKubeadmCfg(kmmCfg Config) (cfg *kubeadmapi.MasterConfiguration, err error) {
-	cfg = &kubeadmapi.MasterConfiguration{}
-	port := kmmCfg.APIServer.Port()
-	if port == "" {
-		cfg.API.BindPort = 443
-	} else {
-		// Parse the port
-		var i64 int64
-		if i64, err = strconv.ParseInt(port, 10, 32); err != nil {
-			return cfg, err
-		}
-		cfg.API.BindPort = int32(i64)
-	}
-	if cfg.API.AdvertiseAddress, err = getHost(kmmCfg.APIServer); err != nil {
-		return cfg, err
-	}
-
-	if len(kmmCfg.EtcdClientConfig.Endpoints) > 0 {
-		cfg.Etcd.Endpoints = strings.Split(kmmCfg.EtcdClientConfig.Endpoints, ",")
-		cfg.Etcd.CAFile = kmmCfg.EtcdClientConfig.CaFileName
-		cfg.Etcd.CertFile = kmmCfg.EtcdClientConfig.ClientCertFileName
-		cfg.Etcd.KeyFile = kmmCfg.EtcdClientConfig.ClientKeyFileName
-	}
-
-	if kmmCfg.KubeVersion != "" {
-		cfg.KubernetesVersion = kmmCfg.KubeVersion
-	}
-	cfg.CertificatesDir = kubeadmconstants.KubernetesDir + "/pki"
-	cfg.CloudProvider = kmmCfg.CloudProvider
-	cfg.Networking.DNSDomain = constants.DefaultServiceDNSDomain
-	cfg.Networking.ServiceSubnet = constants.DefaultServicesSubnet
-	cfg.Networking.PodSubnet = kmmCfg.PodNetworkCidr
-	cfg.APIServerExtraArgs = kmmCfg.APIServerExtraArgs
-	cfg.ControllerManagerExtraArgs = kmmCfg.ControllerManagerExtraArgs
-	cfg.SchedulerExtraArgs = kmmCfg.SchedulerExtraArgs
-	return cfg, nil
-}
-
-// Run kubeadm to create a kubeconfig file...
-func createAKubeCfg(cfg Config, file string, cn string, org string) (err error) {
-	args := append(cmdOptsKubeconfig,
-		"--client-name", cn,
-		"--server", cfg.APIServer.String())
-
-	if len(org) > 0 {
-		args = append(args,
-			"--organization", org)
-	}
-
-	kubecfgContents, err := runKubeadm(cfg, args)
-	if err != nil {
-		return fmt.Errorf("Error running kubeadm:%s", kubecfgContents)
+	if k.KubeletServingCerts && ca != nil {
+		return createKubeletServingCert(ca, k.KubeletID)
 	}
-	filePath := kubeadmconstants.KubernetesDir + "/" + file
-	log.Printf("Saving:%q", filePath)
-	err = ioutil.WriteFile(filePath, []byte(kubecfgContents), 0600)
-	return err
+	return nil
 }
 
+// runKubeadm will run kubeadm streaming all output to the logs
 func runKubeadm(cfg Config, cmdArgs []string) (out string, err error) {
-	var cmdOut []byte
-
 	cmdName := cmdKubeadm
-	log.Printf("Running:%v %v", cmdName, strings.Join(cmdArgs, " "))
-	if cmdOut, err = exec.Command(cmdName, cmdArgs...).CombinedOutput(); err != nil {
-		return string(cmdOut[:]), err
-	}
-	return string(cmdOut[:]), nil
+	logger.Printf("Running:%v %v", cmdName, strings.Join(cmdArgs, " "))
+	span := tracing.Start(cmdName)
+	span.SetTag("args", strings.Join(cmdArgs, " "))
+	defer func() { tracing.End(span, err) }()
+	return command.Run(logger, "", cmdName, cmdArgs...)
 }
 
 func getHost(url *url.URL) (host string, err error) {
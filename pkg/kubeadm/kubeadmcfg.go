@@ -0,0 +1,194 @@
+// +build !slim
+
+package kubeadm
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/constants"
+	"github.com/UKHomeOffice/keto-k8/pkg/hardening"
+	"github.com/UKHomeOffice/keto-k8/pkg/kms"
+	"github.com/UKHomeOffice/keto-k8/pkg/psp"
+	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
+	kubeadmconstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+)
+
+// slim is set when the kubeadm internals aren't built in
+const slim = false
+
+// defaultAuthorizationModes are the kubeadm authorization modes, kubelets are limited to their own node's resources
+var defaultAuthorizationModes = []string{"Node", "RBAC"}
+
+// GetKubeadmCfg - will transfer config from kmm to a config struct as used by kubeadm internaly
+// TODO: This is a hack until we can use kubeadm cmd directly...
+func GetKubeadmCfg(kmmCfg Config) (cfg *kubeadmapi.MasterConfiguration, err error) {
+	cfg = &kubeadmapi.MasterConfiguration{}
+	port := kmmCfg.APIServer.Port()
+	if port == "" {
+		cfg.API.BindPort = 443
+	} else {
+		// Parse the port
+		var i64 int64
+		if i64, err = strconv.ParseInt(port, 10, 32); err != nil {
+			return cfg, err
+		}
+		cfg.API.BindPort = int32(i64)
+	}
+	if cfg.API.AdvertiseAddress, err = getHost(kmmCfg.APIServer); err != nil {
+		return cfg, err
+	}
+
+	if len(kmmCfg.EtcdClientConfig.Endpoints) > 0 {
+		cfg.Etcd.Endpoints = strings.Split(kmmCfg.EtcdClientConfig.Endpoints, ",")
+		cfg.Etcd.CAFile = kmmCfg.EtcdClientConfig.CaFileName
+		cfg.Etcd.CertFile = kmmCfg.EtcdClientConfig.ClientCertFileName
+		cfg.Etcd.KeyFile = kmmCfg.EtcdClientConfig.ClientKeyFileName
+	}
+
+	if kmmCfg.KubeVersion != "" {
+		cfg.KubernetesVersion = kmmCfg.KubeVersion
+	}
+	cfg.CertificatesDir = kubeadmconstants.KubernetesDir + "/pki"
+	cfg.CloudProvider = kmmCfg.CloudProvider
+	cfg.Networking.DNSDomain = constants.DefaultServiceDNSDomain
+	cfg.Networking.ServiceSubnet = constants.DefaultServicesSubnet
+	cfg.Networking.PodSubnet = kmmCfg.PodNetworkCidr
+	if kmmCfg.Webhooks.AuthorizationEnabled() {
+		// kubeadm sets the authorization mode flags, the webhook is consulted after the node and RBAC authorizers
+		cfg.AuthorizationModes = withAuthorizationMode(cfg.AuthorizationModes, "Webhook")
+	}
+	profile, err := hardening.Get(kmmCfg.HardeningProfile)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.APIServerExtraArgs = apiServerArgs(kmmCfg, profile)
+	_, saRotationArgs := serviceAccountRotationArgs(kmmCfg.ServiceAccountRotation)
+	cfg.ControllerManagerExtraArgs = mergeArgs(
+		profile.Args(hardening.ControllerManager),
+		clusterSigningControllerManagerArgs(kmmCfg),
+		kmmCfg.StaticPodLogs.Args("kube-controller-manager"),
+		kmmCfg.ControllerManagerExtraArgs,
+		saRotationArgs)
+	cfg.SchedulerExtraArgs = mergeArgs(
+		profile.Args(hardening.Scheduler),
+		kmmCfg.StaticPodLogs.Args("kube-scheduler"),
+		kmmCfg.SchedulerExtraArgs)
+	return cfg, nil
+}
+
+// withAuthorizationMode returns the authorization modes (the kubeadm defaults when not set) with a mode appended
+func withAuthorizationMode(modes []string, mode string) []string {
+	if len(modes) == 0 {
+		modes = defaultAuthorizationModes
+	}
+	for _, m := range modes {
+		if m == mode {
+			return modes
+		}
+	}
+	return append(append([]string{}, modes...), mode)
+}
+
+// mergeArgs returns a copy of the args with any overrides (later maps take precedence)
+func mergeArgs(args ...map[string]string) map[string]string {
+	merged := map[string]string{}
+	for _, a := range args {
+		for k, v := range a {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// kubeletClientArgs are the apiserver flags for authenticating to kubelets (which only trust the cluster CA)
+func kubeletClientArgs() map[string]string {
+	return map[string]string{
+		"kubelet-client-certificate": PkiDir + "/" + kubeadmconstants.APIServerKubeletClientCertName,
+		"kubelet-client-key":         PkiDir + "/" + kubeadmconstants.APIServerKubeletClientKeyName,
+	}
+}
+
+// apiServerArgs returns the apiserver extra args with any keto-k8 settings added
+// Explicit extra args take precedence over a hardening profile
+func apiServerArgs(kmmCfg Config, profile *hardening.Profile) map[string]string {
+	args := mergeArgs(kubeletClientArgs(), profile.Args(hardening.APIServer), kmmCfg.TLS.Args(),
+		kmmCfg.StaticPodLogs.Args("kube-apiserver"), kmmCfg.APIServerExtraArgs)
+	if kmmCfg.PodSecurityPolicy {
+		admissionControl, ok := args["admission-control"]
+		if !ok {
+			admissionControl = kubeadmconstants.DefaultAdmissionControl
+		}
+		args["admission-control"] = psp.AddAdmissionPlugin(admissionControl)
+	}
+	if len(kmmCfg.EtcdClientConfig.KeyPrefix) > 0 {
+		// The cluster data is kept under the key prefix (the etcd credentials may only have access to the prefix)
+		args["etcd-prefix"] = kmmCfg.EtcdClientConfig.RegistryPrefix()
+	}
+	if kmmCfg.DedicatedSigningCA() {
+		// Kubelet client certs are signed by the dedicated signing CA
+		args["client-ca-file"] = clientCABundleFile()
+	}
+	if kmmCfg.KubeletServingCerts {
+		args = mergeArgs(kubeletServingAPIServerArgs(kmmCfg), args)
+	}
+	if kmmCfg.ServiceAccountRotation != nil {
+		// The rotation keys take precedence so every apiserver trusts the keys of the phase
+		saRotationArgs, _ := serviceAccountRotationArgs(kmmCfg.ServiceAccountRotation)
+		args = mergeArgs(args, saRotationArgs)
+	}
+	if kmmCfg.EncryptionEnabled() {
+		args = mergeArgs(args, kms.APIServerArgs(kmmCfg.KubeVersion))
+	}
+	if kmmCfg.Audit.Enabled() {
+		args = mergeArgs(args, kmmCfg.Audit.APIServerArgs(kmmCfg.KubeVersion))
+	}
+	if kmmCfg.OIDC.Enabled() {
+		args = mergeArgs(args, kmmCfg.OIDC.APIServerArgs())
+	}
+	if kmmCfg.Webhooks.Enabled() {
+		args = mergeArgs(args, kmmCfg.Webhooks.APIServerArgs())
+	}
+	return args
+}
+
+// upstreamClusterConfig returns the kubeadm config in the upstream ClusterConfiguration layout (where the cloud provider
+// and authorization modes are component args)
+func upstreamClusterConfig(kmmCfg Config) (config clusterConfig, err error) {
+	cfg, err := GetKubeadmCfg(kmmCfg)
+	if err != nil {
+		return config, err
+	}
+	endpoint, err := kmmCfg.apiServerEndpoint()
+	if err != nil {
+		return config, err
+	}
+	config = clusterConfig{
+		KubernetesVersion:     cfg.KubernetesVersion,
+		ControlPlaneEndpoint:  endpoint,
+		CertificatesDir:       cfg.CertificatesDir,
+		PodSubnet:             cfg.Networking.PodSubnet,
+		ServiceSubnet:         cfg.Networking.ServiceSubnet,
+		DNSDomain:             cfg.Networking.DNSDomain,
+		EtcdEndpoints:         cfg.Etcd.Endpoints,
+		EtcdCAFile:            cfg.Etcd.CAFile,
+		EtcdCertFile:          cfg.Etcd.CertFile,
+		EtcdKeyFile:           cfg.Etcd.KeyFile,
+		APIServerArgs:         mergeArgs(cfg.APIServerExtraArgs),
+		ControllerManagerArgs: mergeArgs(cfg.ControllerManagerExtraArgs),
+		SchedulerArgs:         mergeArgs(cfg.SchedulerExtraArgs),
+		BindPort:              cfg.API.BindPort,
+	}
+	if len(cfg.CloudProvider) > 0 {
+		config.APIServerArgs["cloud-provider"] = cfg.CloudProvider
+		config.ControllerManagerArgs["cloud-provider"] = cfg.CloudProvider
+	}
+	if len(cfg.AuthorizationModes) > 0 {
+		config.APIServerArgs["authorization-mode"] = strings.Join(cfg.AuthorizationModes, ",")
+	}
+	if kmmCfg.ExtraVolumes != nil {
+		config.APIServerVolumes = kmmCfg.ExtraVolumes.APIServer
+		config.ControllerManagerVolumes = kmmCfg.ExtraVolumes.ControllerManager
+	}
+	return config, nil
+}
@@ -0,0 +1,121 @@
+package kubeadm
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	certutil "github.com/UKHomeOffice/keto-k8/pkg/client-go/util/cert"
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+	kubeadmconstants "github.com/UKHomeOffice/keto-k8/pkg/kubeadm/constants"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm/pkiutil"
+	"github.com/UKHomeOffice/keto-k8/pkg/tracing"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// kubeConfigClusterName is the cluster name kubeadm uses in kubeconfig files
+const kubeConfigClusterName = "kubernetes"
+
+// clientCA signs the client certs of the kubeconfig files
+type clientCA struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+	// bundle is the complete CA file (including any intermediates and the root) for the kubeconfig CA data
+	bundle []byte
+}
+
+// loadClientCA will load the kube CA (as kubeadm alpha phase kubeconfig client-certs would)
+func loadClientCA() (*clientCA, error) {
+	cert, key, err := pkiutil.TryLoadCertAndKeyFromDisk(PkiDir, kubeadmconstants.CACertAndKeyBaseName)
+	if err != nil {
+		return nil, fmt.Errorf("kube CA could not be loaded [%v]", err)
+	}
+	bundle, err := ioutil.ReadFile(PkiDir + "/" + kubeadmconstants.CACertAndKeyBaseName + ".crt")
+	if err != nil {
+		return nil, err
+	}
+	return &clientCA{cert: cert, key: key, bundle: bundle}, nil
+}
+
+// createAKubeCfg will create a kubeconfig file with a new client cert (or copy it from the fixtures)
+func createAKubeCfg(cfg Config, ca *clientCA, file string, cn string, org string) (err error) {
+	filePath := KubeConfigDir + "/" + file
+	if cfg.PKIFixtureDir != "" {
+		return copyFixture(cfg.PKIFixtureDir+"/"+file, filePath, 0600)
+	}
+	span := tracing.Start("kubeconfig")
+	span.SetTag("file", file)
+	defer func() { tracing.End(span, err) }()
+
+	kubecfgContents, err := kubeConfig(cfg.APIServer.String(), ca, cn, org)
+	if err != nil {
+		return fmt.Errorf("Error creating kubeconfig %s:%v", file, err)
+	}
+	logger.Printf("Saving:%q", filePath)
+	return fileutil.WriteFile(filePath, kubecfgContents, 0600)
+}
+
+// OperatorKubeConfig returns a kubeconfig with a new client cert for an operator in a group (to bind to a reduced
+// privilege role), it's only published not saved on the node
+func (k *Config) OperatorKubeConfig(user, group string) ([]byte, error) {
+	ca, err := loadClientCA()
+	if err != nil {
+		return nil, err
+	}
+	return kubeConfig(k.APIServer.String(), ca, user, group)
+}
+
+// kubeConfig returns the contents of a kubeconfig file for a client signed by the CA
+func kubeConfig(server string, ca *clientCA, cn string, org string) ([]byte, error) {
+	certCfg := certutil.Config{
+		CommonName: cn,
+		Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if len(org) > 0 {
+		certCfg.Organization = []string{org}
+	}
+	cert, key, err := pkiutil.NewCertAndKey(ca.cert, ca.key, certCfg)
+	if err != nil {
+		return nil, err
+	}
+	caData := ca.bundle
+	if len(caData) == 0 {
+		caData = certutil.EncodeCertPEM(ca.cert)
+	}
+	config := kubeConfigWithCerts(
+		server,
+		kubeConfigClusterName,
+		cn,
+		caData,
+		certutil.EncodePrivateKeyPEM(key),
+		certutil.EncodeCertPEM(cert))
+	return clientcmd.Write(*config)
+}
+
+// kubeConfigWithCerts returns a kubeconfig for a single user and cluster (the same as kubeadm's CreateWithCerts)
+func kubeConfigWithCerts(server, clusterName, userName string, caCert, clientKey, clientCert []byte) *clientcmdapi.Config {
+	contextName := fmt.Sprintf("%s@%s", userName, clusterName)
+	return &clientcmdapi.Config{
+		Clusters: map[string]*clientcmdapi.Cluster{
+			clusterName: {
+				Server:                   server,
+				CertificateAuthorityData: caCert,
+			},
+		},
+		Contexts: map[string]*clientcmdapi.Context{
+			contextName: {
+				Cluster:  clusterName,
+				AuthInfo: userName,
+			},
+		},
+		AuthInfos: map[string]*clientcmdapi.AuthInfo{
+			userName: {
+				ClientKeyData:         clientKey,
+				ClientCertificateData: clientCert,
+			},
+		},
+		CurrentContext: contextName,
+	}
+}
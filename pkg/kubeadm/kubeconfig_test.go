@@ -0,0 +1,115 @@
+package kubeadm
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm/pkiutil"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func TestCreateKubeConfigInProcess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeadm-kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(pkiDir, kubeConfigDir string) {
+		PkiDir = pkiDir
+		KubeConfigDir = kubeConfigDir
+	}(PkiDir, KubeConfigDir)
+	PkiDir = filepath.Join(dir, "pki")
+	KubeConfigDir = dir
+
+	caCert, caKey, err := pkiutil.NewCertificateAuthority()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pkiutil.WriteCertAndKey(PkiDir, "ca", caCert, caKey); err != nil {
+		t.Fatal(err)
+	}
+	apiServer, _ := url.Parse("https://kube.example.com")
+	k := &Config{APIServer: apiServer, KubeletID: "master1"}
+	if err = k.CreateKubeConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := clientcmd.LoadFromFile(filepath.Join(dir, "kubelet.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Clusters["kubernetes"] == nil || config.Clusters["kubernetes"].Server != "https://kube.example.com" {
+		t.Errorf("unexpected clusters %v", config.Clusters)
+	}
+	user := config.AuthInfos["system:node:master1"]
+	if user == nil {
+		t.Fatalf("expected the node user but got %v", config.AuthInfos)
+	}
+	block, _ := pem.Decode(user.ClientCertificateData)
+	if block == nil {
+		t.Fatal("expected a client certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Subject.CommonName != "system:node:master1" || len(cert.Subject.Organization) != 1 || cert.Subject.Organization[0] != "system:nodes" {
+		t.Errorf("unexpected subject %v", cert.Subject)
+	}
+	if err = cert.CheckSignatureFrom(caCert); err != nil {
+		t.Errorf("expected the client cert to be signed by the CA: %v", err)
+	}
+	for _, file := range []string{"admin.conf", "controller-manager.conf", "scheduler.conf"} {
+		if _, err = os.Stat(filepath.Join(dir, file)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestOperatorKubeConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeadm-kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(pkiDir string) { PkiDir = pkiDir }(PkiDir)
+	PkiDir = dir
+
+	caCert, caKey, err := pkiutil.NewCertificateAuthority()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pkiutil.WriteCertAndKey(PkiDir, "ca", caCert, caKey); err != nil {
+		t.Fatal(err)
+	}
+	apiServer, _ := url.Parse("https://kube.example.com")
+	k := &Config{APIServer: apiServer}
+	data, err := k.OperatorKubeConfig("operator", "keto:operators")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := clientcmd.Load(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := config.AuthInfos["operator"]
+	if user == nil {
+		t.Fatalf("expected the operator user but got %v", config.AuthInfos)
+	}
+	block, _ := pem.Decode(user.ClientCertificateData)
+	if block == nil {
+		t.Fatal("expected a client certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.Subject.Organization) != 1 || cert.Subject.Organization[0] != "keto:operators" {
+		t.Errorf("expected the operator group but got %v", cert.Subject)
+	}
+}
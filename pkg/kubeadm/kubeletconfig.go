@@ -0,0 +1,221 @@
+package kubeadm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/kubernetes/pkg/util/version"
+)
+
+// KubeletConfigFileName is the KubeletConfiguration the kubelet is started with (from v1.10)
+const KubeletConfigFileName = "kubelet-config.yaml"
+
+// DefaultPoolLabel is the node label (from the cloud metadata) naming the node pool
+const DefaultPoolLabel = "pool"
+
+// minKubeletConfigFileVersion is the first version with the kubelet --config file, before it the resources are flags
+var minKubeletConfigFileVersion = version.MustParseGeneric("v1.10.0")
+
+// defaultSystemReserved is reserved for the OS unless configured
+var defaultSystemReserved = map[string]string{"cpu": "50m", "memory": "100Mi"}
+
+// reservedResources and evictionSignals are the keys the kubelet accepts
+var (
+	reservedResources = []string{"cpu", "memory", "ephemeral-storage", "pid"}
+	evictionSignals   = []string{"memory.available", "nodefs.available", "nodefs.inodesFree", "imagefs.available",
+		"imagefs.inodesFree", "pid.available"}
+)
+
+// KubeletResources are the resources the kubelet reserves for the system and kubernetes daemons and its pod limits
+type KubeletResources struct {
+	MaxPods        int32             `json:"maxPods,omitempty"`
+	KubeReserved   map[string]string `json:"kubeReserved,omitempty"`
+	SystemReserved map[string]string `json:"systemReserved,omitempty"`
+	// EvictionHard and EvictionSoft are the eviction thresholds by signal e.g. memory.available: 100Mi
+	EvictionHard            map[string]string `json:"evictionHard,omitempty"`
+	EvictionSoft            map[string]string `json:"evictionSoft,omitempty"`
+	EvictionSoftGracePeriod map[string]string `json:"evictionSoftGracePeriod,omitempty"`
+}
+
+// KubeletConfig is the kubelet resources of every node, overridden for any node pools (by the value of the pool
+// label the node has from the cloud metadata)
+type KubeletConfig struct {
+	KubeletResources
+	// PoolLabel is the node label naming the node pool (DefaultPoolLabel when not set)
+	PoolLabel string                      `json:"poolLabel,omitempty"`
+	Pools     map[string]KubeletResources `json:"pools,omitempty"`
+}
+
+// kubeletConfiguration is the part of the KubeletConfiguration type keto-k8 sets
+type kubeletConfiguration struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	KubeletResources
+}
+
+// Validate will check the resources of every pool
+func (c *KubeletConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	// Pools are validated with the resources they override
+	base := KubeletResources{}.merge(c.KubeletResources)
+	if err := base.validate(); err != nil {
+		return fmt.Errorf("invalid kubelet config [%v]", err)
+	}
+	for name, pool := range c.Pools {
+		if err := base.merge(pool).validate(); err != nil {
+			return fmt.Errorf("invalid kubelet config for pool %s [%v]", name, err)
+		}
+	}
+	return nil
+}
+
+// Resources returns the kubelet resources of a node from its labels (the defaults when there's no config)
+func (c *KubeletConfig) Resources(labels map[string]string) KubeletResources {
+	r := KubeletResources{SystemReserved: defaultSystemReserved}
+	if c == nil {
+		return r
+	}
+	r = r.merge(c.KubeletResources)
+	label := c.PoolLabel
+	if len(label) == 0 {
+		label = DefaultPoolLabel
+	}
+	if name, ok := labels[label]; ok {
+		if pool, ok := c.Pools[name]; ok {
+			r = r.merge(pool)
+		}
+	}
+	return r
+}
+
+// Override returns a copy of the config with the resources overriding those for every node (any pool resources still
+// take precedence)
+func (c *KubeletConfig) Override(r KubeletResources) *KubeletConfig {
+	o := &KubeletConfig{}
+	if c != nil {
+		*o = *c
+	}
+	o.KubeletResources = o.KubeletResources.merge(r)
+	return o
+}
+
+// KubeletConfigFileSupported returns true when the kubelet of a version reads the resources from its config file
+func KubeletConfigFileSupported(kubeVersion string) bool {
+	v, err := version.ParseGeneric(kubeVersion)
+	return err == nil && v.AtLeast(minKubeletConfigFileVersion)
+}
+
+// ConfigFile renders the KubeletConfiguration with the resources
+func (r KubeletResources) ConfigFile() ([]byte, error) {
+	return yaml.Marshal(kubeletConfiguration{
+		APIVersion:       "kubelet.config.k8s.io/v1beta1",
+		Kind:             "KubeletConfiguration",
+		KubeletResources: r,
+	})
+}
+
+// Args returns the kubelet flags for the resources (for kubelets without a config file)
+func (r KubeletResources) Args() string {
+	var args []string
+	if r.MaxPods > 0 {
+		args = append(args, fmt.Sprintf("--max-pods=%d", r.MaxPods))
+	}
+	for _, a := range []struct {
+		flag, sep string
+		values    map[string]string
+	}{
+		{"--kube-reserved", "=", r.KubeReserved},
+		{"--system-reserved", "=", r.SystemReserved},
+		{"--eviction-hard", "<", r.EvictionHard},
+		{"--eviction-soft", "<", r.EvictionSoft},
+		{"--eviction-soft-grace-period", "=", r.EvictionSoftGracePeriod},
+	} {
+		if len(a.values) > 0 {
+			args = append(args, a.flag+"="+joinSorted(a.values, a.sep))
+		}
+	}
+	return strings.Join(args, " ")
+}
+
+// merge returns the resources with any set in o replacing them
+func (r KubeletResources) merge(o KubeletResources) KubeletResources {
+	if o.MaxPods != 0 {
+		r.MaxPods = o.MaxPods
+	}
+	r.KubeReserved = mergeValues(r.KubeReserved, o.KubeReserved)
+	r.SystemReserved = mergeValues(r.SystemReserved, o.SystemReserved)
+	r.EvictionHard = mergeValues(r.EvictionHard, o.EvictionHard)
+	r.EvictionSoft = mergeValues(r.EvictionSoft, o.EvictionSoft)
+	r.EvictionSoftGracePeriod = mergeValues(r.EvictionSoftGracePeriod, o.EvictionSoftGracePeriod)
+	return r
+}
+
+func (r KubeletResources) validate() error {
+	if r.MaxPods < 0 {
+		return fmt.Errorf("maxPods can't be negative")
+	}
+	for _, reserved := range []map[string]string{r.KubeReserved, r.SystemReserved} {
+		for name := range reserved {
+			if !contains(reservedResources, name) {
+				return fmt.Errorf("unknown reserved resource %q, must be one of: %s", name, strings.Join(reservedResources, ", "))
+			}
+		}
+	}
+	for _, thresholds := range []map[string]string{r.EvictionHard, r.EvictionSoft, r.EvictionSoftGracePeriod} {
+		for signal := range thresholds {
+			if !contains(evictionSignals, signal) {
+				return fmt.Errorf("unknown eviction signal %q, must be one of: %s", signal, strings.Join(evictionSignals, ", "))
+			}
+		}
+	}
+	for signal, period := range r.EvictionSoftGracePeriod {
+		if _, err := time.ParseDuration(period); err != nil {
+			return fmt.Errorf("invalid eviction soft grace period for %s [%v]", signal, err)
+		}
+	}
+	for signal := range r.EvictionSoft {
+		if _, ok := r.EvictionSoftGracePeriod[signal]; !ok {
+			return fmt.Errorf("the soft eviction threshold for %s needs a grace period", signal)
+		}
+	}
+	return nil
+}
+
+// mergeValues returns a copy of the values with any overrides
+func mergeValues(values, overrides map[string]string) map[string]string {
+	if len(values) == 0 && len(overrides) == 0 {
+		return nil
+	}
+	merged := map[string]string{}
+	for k, v := range values {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	return merged
+}
+
+// joinSorted returns key<sep>value pairs sorted by key and comma separated
+func joinSorted(values map[string]string, sep string) string {
+	pairs := make([]string, 0, len(values))
+	for k, v := range values {
+		pairs = append(pairs, k+sep+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
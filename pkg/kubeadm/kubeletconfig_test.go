@@ -0,0 +1,113 @@
+package kubeadm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+func TestKubeletConfigResources(t *testing.T) {
+	var none *KubeletConfig
+	if r := none.Resources(nil); r.SystemReserved["memory"] != "100Mi" || r.MaxPods != 0 {
+		t.Errorf("expected the default resources without config but got %+v", r)
+	}
+
+	c := &KubeletConfig{
+		KubeletResources: KubeletResources{
+			MaxPods:        60,
+			SystemReserved: map[string]string{"memory": "500Mi"},
+			EvictionHard:   map[string]string{"memory.available": "200Mi"},
+		},
+		Pools: map[string]KubeletResources{
+			"gpu": {MaxPods: 20, KubeReserved: map[string]string{"cpu": "500m"}},
+		},
+	}
+	r := c.Resources(map[string]string{"pool": "compute"})
+	if r.MaxPods != 60 || r.SystemReserved["memory"] != "500Mi" || r.SystemReserved["cpu"] != "50m" || len(r.KubeReserved) != 0 {
+		t.Errorf("unexpected resources for a node without a configured pool %+v", r)
+	}
+	r = c.Resources(map[string]string{"pool": "gpu"})
+	if r.MaxPods != 20 || r.KubeReserved["cpu"] != "500m" || r.EvictionHard["memory.available"] != "200Mi" {
+		t.Errorf("unexpected resources for a gpu pool node %+v", r)
+	}
+	if args := r.Args(); args != "--max-pods=20 --kube-reserved=cpu=500m --system-reserved=cpu=50m,memory=500Mi --eviction-hard=memory.available<200Mi" {
+		t.Errorf("unexpected kubelet args %q", args)
+	}
+
+	// The pool label can be changed
+	c.PoolLabel = "keto/pool"
+	if r = c.Resources(map[string]string{"pool": "gpu"}); r.MaxPods != 60 {
+		t.Errorf("expected the pool label to be used but got %+v", r)
+	}
+	if r = c.Resources(map[string]string{"keto/pool": "gpu"}); r.MaxPods != 20 {
+		t.Errorf("expected the gpu pool resources but got %+v", r)
+	}
+}
+
+func TestKubeletConfigFile(t *testing.T) {
+	r := KubeletResources{MaxPods: 30, SystemReserved: map[string]string{"cpu": "100m"}}
+	data, err := r.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config map[string]interface{}
+	if err = yaml.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	if config["kind"] != "KubeletConfiguration" || config["maxPods"] != float64(30) {
+		t.Errorf("unexpected kubelet config:\n%s", data)
+	}
+	if strings.Contains(string(data), "evictionHard") {
+		t.Errorf("expected unset resources to be left to the kubelet defaults:\n%s", data)
+	}
+	for v, supported := range map[string]bool{"v1.7.0": false, "v1.9.3": false, "v1.10.0": true, "v1.11.2": true, "": false} {
+		if KubeletConfigFileSupported(v) != supported {
+			t.Errorf("expected config file support for %q to be %v", v, supported)
+		}
+	}
+}
+
+func TestKubeletConfigValidate(t *testing.T) {
+	for _, c := range []struct {
+		config *KubeletConfig
+		valid  bool
+	}{
+		{config: nil, valid: true},
+		{config: &KubeletConfig{KubeletResources: KubeletResources{MaxPods: 50}}, valid: true},
+		{config: &KubeletConfig{KubeletResources: KubeletResources{MaxPods: -1}}},
+		{config: &KubeletConfig{KubeletResources: KubeletResources{KubeReserved: map[string]string{"gpu": "1"}}}},
+		{config: &KubeletConfig{KubeletResources: KubeletResources{EvictionHard: map[string]string{"memory": "1Gi"}}}},
+		{config: &KubeletConfig{KubeletResources: KubeletResources{EvictionSoft: map[string]string{"memory.available": "1Gi"}}}},
+		{config: &KubeletConfig{
+			KubeletResources: KubeletResources{EvictionSoftGracePeriod: map[string]string{"memory.available": "1m"}},
+			Pools:            map[string]KubeletResources{"gpu": {EvictionSoft: map[string]string{"memory.available": "1Gi"}}},
+		}, valid: true},
+		{config: &KubeletConfig{Pools: map[string]KubeletResources{"gpu": {EvictionSoftGracePeriod: map[string]string{"memory.available": "soon"}}}}},
+	} {
+		if err := c.config.Validate(); (err == nil) != c.valid {
+			t.Errorf("expected %+v to be valid %v but got %v", c.config, c.valid, err)
+		}
+	}
+}
+
+func TestKubeletConfigOverride(t *testing.T) {
+	var none *KubeletConfig
+	if r := none.Override(KubeletResources{MaxPods: 30}).Resources(nil); r.MaxPods != 30 || r.SystemReserved["cpu"] != "50m" {
+		t.Errorf("unexpected overridden resources %+v", r)
+	}
+	c := &KubeletConfig{
+		KubeletResources: KubeletResources{MaxPods: 60, KubeReserved: map[string]string{"cpu": "100m"}},
+		Pools:            map[string]KubeletResources{"gpu": {MaxPods: 20}},
+	}
+	o := c.Override(KubeletResources{MaxPods: 30, KubeReserved: map[string]string{"memory": "1Gi"}})
+	if r := o.Resources(nil); r.MaxPods != 30 || r.KubeReserved["cpu"] != "100m" || r.KubeReserved["memory"] != "1Gi" {
+		t.Errorf("unexpected overridden resources %+v", r)
+	}
+	if r := o.Resources(map[string]string{"pool": "gpu"}); r.MaxPods != 20 {
+		t.Errorf("expected the pool resources to take precedence but got %+v", r)
+	}
+	if c.MaxPods != 60 || len(c.KubeReserved) != 1 {
+		t.Errorf("expected the config to be unchanged but got %+v", c)
+	}
+}
@@ -0,0 +1,204 @@
+package kubeadm
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	certutil "github.com/UKHomeOffice/keto-k8/pkg/client-go/util/cert"
+	kubeadmconstants "github.com/UKHomeOffice/keto-k8/pkg/kubeadm/constants"
+	"github.com/UKHomeOffice/keto-k8/pkg/kubeadm/pkiutil"
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+	"k8s.io/kubernetes/pkg/util/version"
+)
+
+// KubeletServingCertBaseName is the master kubelet serving cert and key signed by the kube CA in the pki dir
+const KubeletServingCertBaseName = "kubelet-serving"
+
+// nodeUserPrefix is the user of a kubelet (followed by the node name)
+const nodeUserPrefix = "system:node:"
+
+var (
+	// minRotateServerCertificatesVersion is the first kubelet with --rotate-server-certificates (before then the
+	// feature gate alone requests serving certs)
+	minRotateServerCertificatesVersion = version.MustParseGeneric("v1.11.0")
+	// minServerCertificateGateDefaultVersion is the first kubelet with the RotateKubeletServerCertificate gate on
+	minServerCertificateGateDefaultVersion = version.MustParseGeneric("v1.12.0")
+)
+
+// servingCSRUsages are the usages a kubelet requests for its serving cert
+var servingCSRUsages = []string{"digital signature", "key encipherment", "server auth"}
+
+// ValidateKubeletServingCerts will check compute kubelets can get serving certs, they're signed by the controller-manager
+// so the CSR signer must be enabled
+func (k *Config) ValidateKubeletServingCerts() error {
+	if !k.KubeletServingCerts || k.DedicatedSigningCA() || k.CaKeyMode != CaKeyEphemeral {
+		return nil
+	}
+	return fmt.Errorf("kubelet serving certs need the controller-manager CSR signer, use the %s cluster signing mode with the %s CA key mode",
+		ClusterSigningDedicated, CaKeyEphemeral)
+}
+
+// kubeletServingAPIServerArgs has the apiserver verify kubelets (for logs, exec and port-forward) with the CA signing
+// their serving certs
+func kubeletServingAPIServerArgs(k Config) map[string]string {
+	if !k.KubeletServingCerts {
+		return nil
+	}
+	if k.DedicatedSigningCA() {
+		// The master kubelets are signed by the kube CA and compute kubelets by the signing CA
+		return map[string]string{"kubelet-certificate-authority": clientCABundleFile()}
+	}
+	return map[string]string{"kubelet-certificate-authority": CaCertFile}
+}
+
+// KubeletServingArgs returns the kubelet flags for its serving cert, a master kubelet uses the cert signed by the kube
+// CA and a compute kubelet requests (and rotates) one from the controller-manager
+func (k *Config) KubeletServingArgs(master bool) string {
+	if !k.KubeletServingCerts {
+		return ""
+	}
+	if master {
+		return fmt.Sprintf("--tls-cert-file=%s/%s.crt --tls-private-key-file=%s/%s.key",
+			PkiDir, KubeletServingCertBaseName, PkiDir, KubeletServingCertBaseName)
+	}
+	v, err := version.ParseGeneric(k.KubeVersion)
+	if err != nil {
+		return ""
+	}
+	var args []string
+	if !v.AtLeast(minServerCertificateGateDefaultVersion) {
+		args = append(args, "--feature-gates=RotateKubeletServerCertificate=true")
+	}
+	if v.AtLeast(minRotateServerCertificatesVersion) {
+		args = append(args, "--rotate-server-certificates=true")
+	}
+	return strings.Join(args, " ")
+}
+
+// createKubeletServingCert will sign the master kubelet serving cert with the kube CA, for the node name, hostname
+// and host addresses
+func createKubeletServingCert(ca *clientCA, nodeName string) error {
+	altNames := certutil.AltNames{DNSNames: []string{nodeName}}
+	if hostname, err := os.Hostname(); err == nil && hostname != nodeName {
+		altNames.DNSNames = append(altNames.DNSNames, hostname)
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
+			altNames.IPs = append(altNames.IPs, ipNet.IP)
+		}
+	}
+	cert, key, err := pkiutil.NewCertAndKey(ca.cert, ca.key, certutil.Config{
+		CommonName:   nodeUserPrefix + nodeName,
+		Organization: []string{kubeadmconstants.NodesGroup},
+		AltNames:     altNames,
+		Usages:       []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sign the kubelet serving cert [%v]", err)
+	}
+	return pkiutil.WriteCertAndKey(PkiDir, KubeletServingCertBaseName, cert, key)
+}
+
+// ValidateServingCSR will check a pending CSR is a kubelet serving cert request for the node of the requesting
+// kubelet (with only the addresses of its node), the controller-manager never approves them itself
+func ValidateServingCSR(csr podspec.Object, nodes []podspec.Object) error {
+	spec, _ := csr["spec"].(map[string]interface{})
+	username, _ := spec["username"].(string)
+	if !strings.HasPrefix(username, nodeUserPrefix) {
+		return fmt.Errorf("not requested by a kubelet")
+	}
+	if !sameStrings(interfaceStrings(spec["usages"]), servingCSRUsages) {
+		return fmt.Errorf("not for a serving cert")
+	}
+	status, _ := csr["status"].(map[string]interface{})
+	if conditions, _ := status["conditions"].([]interface{}); len(conditions) > 0 {
+		return fmt.Errorf("already approved or denied")
+	}
+	request, _ := spec["request"].(string)
+	der, err := base64.StdEncoding.DecodeString(request)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(der)
+	if block == nil {
+		return fmt.Errorf("no certificate request")
+	}
+	req, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return err
+	}
+	if req.Subject.CommonName != username || !sameStrings(req.Subject.Organization, []string{kubeadmconstants.NodesGroup}) {
+		return fmt.Errorf("the subject %q isn't the requesting kubelet %q", req.Subject.CommonName, username)
+	}
+	if len(req.EmailAddresses) > 0 || len(req.DNSNames)+len(req.IPAddresses) == 0 {
+		return fmt.Errorf("only the node addresses can be requested")
+	}
+	addresses := map[string]bool{}
+	nodeName := strings.TrimPrefix(username, nodeUserPrefix)
+	for _, node := range nodes {
+		if node.Name() != nodeName {
+			continue
+		}
+		status, _ := node["status"].(map[string]interface{})
+		list, _ := status["addresses"].([]interface{})
+		for _, a := range list {
+			address, _ := a.(map[string]interface{})
+			if s, ok := address["address"].(string); ok {
+				addresses[s] = true
+			}
+		}
+	}
+	if len(addresses) == 0 {
+		return fmt.Errorf("node %s not found", nodeName)
+	}
+	for _, name := range req.DNSNames {
+		if !addresses[name] {
+			return fmt.Errorf("%s isn't an address of node %s", name, nodeName)
+		}
+	}
+	for _, ip := range req.IPAddresses {
+		if !addresses[ip.String()] {
+			return fmt.Errorf("%s isn't an address of node %s", ip, nodeName)
+		}
+	}
+	return nil
+}
+
+// interfaceStrings returns the strings of a decoded list
+func interfaceStrings(list interface{}) []string {
+	items, _ := list.([]interface{})
+	var s []string
+	for _, item := range items {
+		if str, ok := item.(string); ok {
+			s = append(s, str)
+		}
+	}
+	return s
+}
+
+// sameStrings is true when two lists have the same strings (in any order)
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := map[string]int{}
+	for _, s := range a {
+		counts[s]++
+	}
+	for _, s := range b {
+		if counts[s] == 0 {
+			return false
+		}
+		counts[s]--
+	}
+	return true
+}
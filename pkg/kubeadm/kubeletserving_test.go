@@ -0,0 +1,112 @@
+package kubeadm
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+)
+
+func TestKubeletServingArgs(t *testing.T) {
+	k := &Config{KubeVersion: "v1.10.5"}
+	if args := k.KubeletServingArgs(true); args != "" {
+		t.Errorf("expected no args when disabled but got %q", args)
+	}
+	k.KubeletServingCerts = true
+	if args := k.KubeletServingArgs(true); !strings.Contains(args, "--tls-cert-file="+PkiDir+"/kubelet-serving.crt") {
+		t.Errorf("expected a master to serve with the signed cert but got %q", args)
+	}
+	for kubeVersion, expected := range map[string]string{
+		"v1.10.5": "--feature-gates=RotateKubeletServerCertificate=true",
+		"v1.11.2": "--feature-gates=RotateKubeletServerCertificate=true --rotate-server-certificates=true",
+		"v1.13.0": "--rotate-server-certificates=true",
+	} {
+		k.KubeVersion = kubeVersion
+		if args := k.KubeletServingArgs(false); args != expected {
+			t.Errorf("expected %q for a %s compute kubelet but got %q", expected, kubeVersion, args)
+		}
+	}
+}
+
+func TestValidateKubeletServingCerts(t *testing.T) {
+	k := &Config{KubeletServingCerts: true, CaKeyMode: CaKeyEphemeral}
+	if err := k.ValidateKubeletServingCerts(); err == nil {
+		t.Error("expected an error without the CSR signer")
+	}
+	k.ClusterSigningMode = ClusterSigningDedicated
+	if err := k.ValidateKubeletServingCerts(); err != nil {
+		t.Error(err)
+	}
+	if args := kubeletServingAPIServerArgs(*k); args["kubelet-certificate-authority"] != clientCABundleFile() {
+		t.Errorf("expected kubelets verified with the client CA bundle but got %v", args)
+	}
+	k.ClusterSigningMode = ""
+	if args := kubeletServingAPIServerArgs(*k); args["kubelet-certificate-authority"] != CaCertFile {
+		t.Errorf("expected kubelets verified with the kube CA but got %v", args)
+	}
+}
+
+// servingCSR returns a CSR object as listed by kubectl
+func servingCSR(t *testing.T, username, cn string, dnsNames []string, ips []net.IP) podspec.Object {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: cn, Organization: []string{"system:nodes"}},
+		DNSNames:    dnsNames,
+		IPAddresses: ips,
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+	return podspec.Object{
+		"metadata": map[string]interface{}{"name": "csr-1"},
+		"spec": map[string]interface{}{
+			"username": username,
+			"usages":   []interface{}{"digital signature", "key encipherment", "server auth"},
+			"request":  base64.StdEncoding.EncodeToString(request),
+		},
+	}
+}
+
+func TestValidateServingCSR(t *testing.T) {
+	nodes := []podspec.Object{{
+		"metadata": map[string]interface{}{"name": "ip-10-0-1-5"},
+		"status": map[string]interface{}{"addresses": []interface{}{
+			map[string]interface{}{"type": "Hostname", "address": "ip-10-0-1-5"},
+			map[string]interface{}{"type": "InternalIP", "address": "10.0.1.5"},
+		}},
+	}}
+	user := "system:node:ip-10-0-1-5"
+	csr := servingCSR(t, user, user, []string{"ip-10-0-1-5"}, []net.IP{net.ParseIP("10.0.1.5")})
+	if err := ValidateServingCSR(csr, nodes); err != nil {
+		t.Errorf("expected the serving cert request to be approved but got %v", err)
+	}
+
+	invalid := map[string]podspec.Object{
+		"another node address": servingCSR(t, user, user, nil, []net.IP{net.ParseIP("10.0.1.6")}),
+		"another subject":      servingCSR(t, user, "system:node:ip-10-0-1-6", []string{"ip-10-0-1-5"}, nil),
+		"an unknown node":      servingCSR(t, "system:node:ip-10-0-1-6", "system:node:ip-10-0-1-6", []string{"ip-10-0-1-6"}, nil),
+		"a non kubelet user":   servingCSR(t, "admin", user, []string{"ip-10-0-1-5"}, nil),
+	}
+	clientCSR := servingCSR(t, user, user, []string{"ip-10-0-1-5"}, nil)
+	clientCSR["spec"].(map[string]interface{})["usages"] = []interface{}{"digital signature", "key encipherment", "client auth"}
+	invalid["client usages"] = clientCSR
+	approved := servingCSR(t, user, user, []string{"ip-10-0-1-5"}, nil)
+	approved["status"] = map[string]interface{}{"conditions": []interface{}{map[string]interface{}{"type": "Approved"}}}
+	invalid["an approved request"] = approved
+	for name, csr := range invalid {
+		if err := ValidateServingCSR(csr, nodes); err == nil {
+			t.Errorf("expected a request for %s to be rejected", name)
+		}
+	}
+}
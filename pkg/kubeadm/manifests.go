@@ -1,16 +1,227 @@
+// +build !slim
+
 package kubeadm
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/backup"
+	"github.com/UKHomeOffice/keto-k8/pkg/images"
+	"github.com/UKHomeOffice/keto-k8/pkg/kms"
+	"github.com/UKHomeOffice/keto-k8/pkg/oidc"
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+	"github.com/UKHomeOffice/keto-k8/pkg/priority"
+	"github.com/UKHomeOffice/keto-k8/pkg/secprofile"
 	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
 	"k8s.io/kubernetes/cmd/kubeadm/app/master"
 )
 
 // WriteManifests - will save kubernetes master manifests from kmm config struct
 func (k *Config) WriteManifests() (err error) {
-	// Get config into kubeadm format
-	var kubeadmapiCfg *kubeadmapi.MasterConfiguration
-	if kubeadmapiCfg, err = GetKubeadmCfg(*k); err != nil {
+	// Validate the optional config before writing anything
+	if _, err = k.RenderConfigFiles(); err != nil {
+		return err
+	}
+	manifests, err := k.RenderManifests()
+	if err != nil {
+		return err
+	}
+	if k.DedicatedSigningCA() {
+		if err = writeClientCABundle(); err != nil {
+			return fmt.Errorf("failed to save the client CA bundle [%v]", err)
+		}
+	}
+	if k.ServiceAccountRotation != nil {
+		if err = k.ServiceAccountRotation.writeKeys(); err != nil {
+			return fmt.Errorf("failed to save the service account rotation keys [%v]", err)
+		}
+	} else if err = removeServiceAccountRotationKeys(); err != nil {
 		return err
 	}
-	return master.WriteStaticPodManifests(kubeadmapiCfg, k.MasterCount)
+	if err = os.MkdirAll(ManifestsDir, 0700); err != nil {
+		return fmt.Errorf("failed to create directory %q [%v]", ManifestsDir, err)
+	}
+	for name, manifest := range manifests {
+		fileName := filepath.Join(ManifestsDir, name+".yaml")
+		if err = backup.WriteFile(fileName, []byte(manifest), 0600); err != nil {
+			return fmt.Errorf("failed to save static pod manifest %q [%v]", fileName, err)
+		}
+	}
+	if k.EncryptionEnabled() {
+		if err = kms.WriteConfig(); err != nil {
+			return fmt.Errorf("failed to save encryption config [%v]", err)
+		}
+	}
+	if k.Audit.Enabled() {
+		if err = k.Audit.Write(); err != nil {
+			return fmt.Errorf("failed to save audit config [%v]", err)
+		}
+	}
+	if k.OIDC.Enabled() {
+		if err = k.OIDC.Write(); err != nil {
+			return fmt.Errorf("failed to save oidc config [%v]", err)
+		}
+	}
+	if k.Webhooks.Enabled() {
+		if err = k.Webhooks.Write(); err != nil {
+			return fmt.Errorf("failed to save webhook config [%v]", err)
+		}
+	}
+	if k.APIProxy.Enabled() {
+		if err = k.APIProxy.WriteConfig(k.bindPort()); err != nil {
+			return fmt.Errorf("failed to save api server proxy config [%v]", err)
+		}
+	} else if err = RemoveAPIProxy(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RenderManifests returns the control plane static pod manifests (by name) with all keto changes
+// Nothing is written to disk e.g. for golden file tests
+func (k *Config) RenderManifests() (map[string]string, error) {
+	if err := k.ExtraVolumes.Validate(); err != nil {
+		return nil, err
+	}
+	// Get config into kubeadm format
+	kubeadmapiCfg, err := GetKubeadmCfg(*k)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := master.RenderStaticPodManifests(kubeadmapiCfg, k.MasterCount)
+	if err != nil {
+		return nil, err
+	}
+	manifests := map[string]string{}
+	for name, manifest := range rendered {
+		manifests[name] = string(manifest)
+	}
+	mutators := k.staticPodMutators()
+	for _, name := range StaticPods {
+		manifest, ok := manifests[name]
+		if !ok {
+			return nil, fmt.Errorf("static pod manifest %q not rendered", name)
+		}
+		if manifests[name], err = podspec.Transform(manifest, mutators...); err != nil {
+			return nil, fmt.Errorf("failed to update static pod manifest %q [%v]", name, err)
+		}
+	}
+	if k.APIProxy.Enabled() {
+		if err = k.APIProxy.Validate(int(kubeadmapiCfg.API.BindPort)); err != nil {
+			return nil, err
+		}
+		if manifests[APIProxyName], err = k.APIProxy.RenderManifest(k.KubeVersion); err != nil {
+			return nil, fmt.Errorf("failed to render static pod manifest %q [%v]", APIProxyName, err)
+		}
+		if manifests[APIProxyName], err = podspec.Transform(manifests[APIProxyName], images.PinMutator(k.ImageDigests)); err != nil {
+			return nil, fmt.Errorf("failed to update static pod manifest %q [%v]", APIProxyName, err)
+		}
+	}
+	return manifests, nil
+}
+
+// RenderConfigFiles returns any other apiserver config files (by file name) e.g. the encryption, audit, oidc and webhook config
+func (k *Config) RenderConfigFiles() (map[string]string, error) {
+	files := map[string]string{}
+	if k.EncryptionEnabled() {
+		if err := k.KMS.Validate(k.KubeVersion); err != nil {
+			return nil, err
+		}
+		cfg, err := kms.RenderConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to render encryption config [%v]", err)
+		}
+		files[kms.ConfigFile] = cfg
+	}
+	if k.Audit.Enabled() {
+		if err := k.Audit.Validate(k.KubeVersion); err != nil {
+			return nil, err
+		}
+		rendered, err := k.Audit.Render()
+		if err != nil {
+			return nil, fmt.Errorf("failed to render audit config [%v]", err)
+		}
+		for name, content := range rendered {
+			files[name] = string(content)
+		}
+	}
+	if k.OIDC.Enabled() {
+		if err := k.OIDC.Validate(k.KubeVersion); err != nil {
+			return nil, err
+		}
+		rendered, err := k.OIDC.Render()
+		if err != nil {
+			return nil, fmt.Errorf("failed to render oidc config [%v]", err)
+		}
+		for name, content := range rendered {
+			files[name] = string(content)
+		}
+	}
+	if k.Webhooks.Enabled() {
+		if err := k.Webhooks.Validate(); err != nil {
+			return nil, err
+		}
+		rendered, err := k.Webhooks.Render()
+		if err != nil {
+			return nil, fmt.Errorf("failed to render webhook config [%v]", err)
+		}
+		for name, content := range rendered {
+			files[name] = string(content)
+		}
+	}
+	if k.APIProxy.Enabled() {
+		cfg, err := k.APIProxy.RenderConfig(k.bindPort())
+		if err != nil {
+			return nil, fmt.Errorf("failed to render api server proxy config [%v]", err)
+		}
+		files[APIProxyConfigFile] = cfg
+	}
+	return files, nil
+}
+
+// bindPort returns the port the api server listens on (443 unless the api server url has a port)
+func (k *Config) bindPort() int {
+	cfg, err := GetKubeadmCfg(*k)
+	if err != nil {
+		return 443
+	}
+	return int(cfg.API.BindPort)
+}
+
+// staticPodMutators are the keto specific changes made to the kubeadm manifests
+func (k *Config) staticPodMutators() []podspec.Mutator {
+	mutators := []podspec.Mutator{
+		priority.StaticPodMutator(k.KubeVersion),
+		secprofile.Mutator(k.KubeVersion),
+		caHashMutator(),
+	}
+	if k.ServiceAccountRotation != nil {
+		mutators = append(mutators, k.ServiceAccountRotation.mutator())
+	}
+	if k.EncryptionEnabled() {
+		mutators = append(mutators, k.KMS.Mutator())
+	}
+	if k.Audit.Enabled() {
+		mutators = append(mutators, k.Audit.Mutator())
+	}
+	if k.OIDC.Enabled() {
+		mutators = append(mutators, k.OIDC.Mutator())
+	}
+	if k.Webhooks.Enabled() {
+		mutators = append(mutators, k.Webhooks.Mutator())
+	}
+	if k.StaticPodLogs.Enabled() {
+		mutators = append(mutators, k.StaticPodLogs.Mutator())
+	}
+	if k.ExtraVolumes.Enabled() {
+		// Last so any volume clashing with a keto-k8 volume is caught
+		mutators = append(mutators, k.ExtraVolumes.Mutator())
+	}
+	if len(k.ImageDigests) > 0 {
+		// After any containers are added e.g. the KMS plugin
+		mutators = append(mutators, images.PinMutator(k.ImageDigests))
+	}
+	return mutators
 }
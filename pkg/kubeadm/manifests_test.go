@@ -1,7 +1,14 @@
+// +build !slim
+
 package kubeadm
 
 import (
+	"net/url"
+	"strings"
 	"testing"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/authwebhook"
+	"github.com/UKHomeOffice/keto-k8/pkg/etcd"
 )
 
 
@@ -24,3 +31,63 @@ func TestWriteManifests(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestRenderManifests(t *testing.T) {
+	apiServer, _ := url.Parse("https://localhost:6443")
+	k := &Config{
+		EtcdClientConfig: etcd.Client{Endpoints: "https://127.0.0.1:2379"},
+		APIServer:        apiServer,
+		KubeVersion:      "v1.7.0",
+		MasterCount:      3,
+	}
+	manifests, err := k.RenderManifests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifests) != len(StaticPods) {
+		t.Errorf("expected only the control plane manifests (external etcd) but got %d", len(manifests))
+	}
+	if !strings.Contains(manifests["kube-apiserver"], "--apiserver-count=3") {
+		t.Errorf("expected the master count in the apiserver manifest:\n%s", manifests["kube-apiserver"])
+	}
+	// The kubelets only accept clients with certs signed by the cluster CA
+	for _, arg := range []string{
+		"--kubelet-client-certificate=" + PkiDir + "/apiserver-kubelet-client.crt",
+		"--kubelet-client-key=" + PkiDir + "/apiserver-kubelet-client.key",
+	} {
+		if !strings.Contains(manifests["kube-apiserver"], arg) {
+			t.Errorf("expected %s in the apiserver manifest:\n%s", arg, manifests["kube-apiserver"])
+		}
+	}
+	files, err := k.RenderConfigFiles()
+	if err != nil || len(files) != 0 {
+		t.Errorf("expected no config files without encryption or audit but got %v, %v", files, err)
+	}
+}
+
+func TestRenderManifestsAuthorizationWebhook(t *testing.T) {
+	apiServer, _ := url.Parse("https://localhost:6443")
+	k := &Config{
+		EtcdClientConfig: etcd.Client{Endpoints: "https://127.0.0.1:2379"},
+		APIServer:        apiServer,
+		KubeVersion:      "v1.7.0",
+		Webhooks: &authwebhook.Config{
+			Authorization: &authwebhook.Authorization{Endpoint: authwebhook.Endpoint{Server: "https://authz"}},
+		},
+	}
+	manifests, err := k.RenderManifests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The kubelets are still limited to their own node by the node authorizer
+	if !strings.Contains(manifests["kube-apiserver"], "--authorization-mode=Node,RBAC,Webhook") {
+		t.Errorf("expected the webhook after the node and RBAC authorizers:\n%s", manifests["kube-apiserver"])
+	}
+	config, err := upstreamClusterConfig(*k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := config.APIServerArgs["authorization-mode"]; mode != "Node,RBAC,Webhook" {
+		t.Errorf("expected the node authorizer in the upstream config but got %q", mode)
+	}
+}
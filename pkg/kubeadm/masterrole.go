@@ -1,3 +1,5 @@
+// +build !slim
+
 package kubeadm
 
 import (
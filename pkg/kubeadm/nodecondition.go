@@ -0,0 +1,136 @@
+package kubeadm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"time"
+
+	kubeadmconstants "github.com/UKHomeOffice/keto-k8/pkg/kubeadm/constants"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// NodeConditionTimeout is how long to wait for a node to register before giving up on its condition
+var NodeConditionTimeout = 5 * time.Minute
+
+const nodeConditionRetry = 5 * time.Second
+
+// NodeCondition is a custom condition on a node's status
+type NodeCondition struct {
+	Type string
+	// Status is True unless set (e.g. False for a failure)
+	Status  string
+	Reason  string
+	Message string
+}
+
+// SetNodeCondition will patch a condition onto the status of a node (once the kubelet has registered it)
+// The kubelet kubeconfig is used as it exists on compute nodes too and allows a node to update its own status
+func SetNodeCondition(node string, condition NodeCondition) error {
+	return SetNodeConditionWithin(node, condition, NodeConditionTimeout)
+}
+
+// SetNodeConditionWithin will set a node condition, only waiting for the node to register until the timeout
+func SetNodeConditionWithin(node string, condition NodeCondition, timeout time.Duration) error {
+	patch, err := NodeConditionPatch(condition, time.Now())
+	if err != nil {
+		return err
+	}
+
+	kubeletKubeConfigPath := path.Join(KubeConfigDir, kubeadmconstants.KubeletKubeConfigFileName)
+	deadline := time.Now().Add(timeout)
+	for {
+		// The kubelet kubeconfig is only written on compute nodes after the TLS bootstrap
+		var registered bool
+		registered, err = patchNodeStatus(kubeletKubeConfigPath, node, patch)
+		if err == nil && registered {
+			logger.Printf("Set node condition %s on %s", condition.Type, node)
+			return nil
+		}
+		if err == nil {
+			err = fmt.Errorf("node not found")
+		}
+		if _, failed := err.(*patchError); failed {
+			return fmt.Errorf("error setting node condition %s on %s: %v", condition.Type, node, err)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for node %s to register [%v]", node, err)
+		}
+		logger.Printf("Waiting for node %s to register...", node)
+		time.Sleep(nodeConditionRetry)
+	}
+}
+
+// patchError is a patch rejected by the apiserver (rather than the apiserver or node not being ready)
+type patchError struct {
+	status int
+	body   string
+}
+
+func (e *patchError) Error() string {
+	return fmt.Sprintf("patch failed with status %d: %s", e.status, e.body)
+}
+
+// patchNodeStatus will apply a strategic merge patch to the status of a node
+// Only the client-go transport is used (not a generated clientset) to keep the kubernetes dependencies small
+// False is returned when the node hasn't registered yet
+func patchNodeStatus(kubeConfigPath, node string, patch []byte) (bool, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeConfigPath)
+	if err != nil {
+		return false, err
+	}
+	transport, err := rest.TransportFor(config)
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequest("PATCH", config.Host+"/api/v1/nodes/"+node+"/status", bytes.NewReader(patch))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/strategic-merge-patch+json")
+	client := &http.Client{Transport: transport, Timeout: nodeConditionRetry}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return false, nil
+	case resp.StatusCode >= 500:
+		// e.g. the apiserver is still starting
+		return false, fmt.Errorf("apiserver returned status %d", resp.StatusCode)
+	case resp.StatusCode >= 300:
+		return false, &patchError{status: resp.StatusCode, body: string(body)}
+	}
+	return true, nil
+}
+
+// NodeConditionPatch returns the strategic merge patch for a node status condition
+// Conditions are merged by type so any other conditions are left alone
+func NodeConditionPatch(condition NodeCondition, now time.Time) ([]byte, error) {
+	timestamp := now.UTC().Format(time.RFC3339)
+	status := condition.Status
+	if len(status) == 0 {
+		status = "True"
+	}
+	return json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []map[string]string{
+				{
+					"type":               condition.Type,
+					"status":             status,
+					"reason":             condition.Reason,
+					"message":            condition.Message,
+					"lastHeartbeatTime":  timestamp,
+					"lastTransitionTime": timestamp,
+				},
+			},
+		},
+	})
+}
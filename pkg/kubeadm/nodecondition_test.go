@@ -0,0 +1,128 @@
+package kubeadm
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestNodeConditionPatch(t *testing.T) {
+	now := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	b, err := NodeConditionPatch(NodeCondition{Type: "KetoBootstrapComplete", Reason: "Bootstrapped", Message: "done"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch := struct {
+		Status struct {
+			Conditions []map[string]string `json:"conditions"`
+		} `json:"status"`
+	}{}
+	if err = json.Unmarshal(b, &patch); err != nil {
+		t.Fatal(err)
+	}
+	if len(patch.Status.Conditions) != 1 {
+		t.Fatalf("expected a single condition but got %s", b)
+	}
+	c := patch.Status.Conditions[0]
+	if c["type"] != "KetoBootstrapComplete" || c["status"] != "True" || c["lastTransitionTime"] != "2018-01-02T03:04:05Z" {
+		t.Errorf("unexpected condition %v", c)
+	}
+
+	// A failure sets the status
+	if b, err = NodeConditionPatch(NodeCondition{Type: "KetoBootstrapComplete", Status: "False", Reason: "Failed"}, now); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"status":"False"`) {
+		t.Errorf("expected a False condition but got %s", b)
+	}
+}
+
+func TestPatchNodeStatus(t *testing.T) {
+	statuses := map[string]int{"master1": http.StatusOK, "master2": http.StatusNotFound, "master3": http.StatusUnprocessableEntity}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PATCH" || r.Header.Get("Content-Type") != "application/strategic-merge-patch+json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(statuses[filepath.Base(filepath.Dir(r.URL.Path))])
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "kubeadm-nodecondition")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	kubeConfigPath := filepath.Join(dir, "kubelet.conf")
+	config := clientcmdapi.NewConfig()
+	config.Clusters["kubernetes"] = &clientcmdapi.Cluster{Server: server.URL}
+	config.Contexts["kubelet"] = &clientcmdapi.Context{Cluster: "kubernetes"}
+	config.CurrentContext = "kubelet"
+	if err = clientcmd.WriteToFile(*config, kubeConfigPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if registered, err := patchNodeStatus(kubeConfigPath, "master1", []byte("{}")); err != nil || !registered {
+		t.Errorf("expected the patch to succeed but got %v, %v", registered, err)
+	}
+	if registered, err := patchNodeStatus(kubeConfigPath, "master2", []byte("{}")); err != nil || registered {
+		t.Errorf("expected the node to not be registered but got %v, %v", registered, err)
+	}
+	if _, err := patchNodeStatus(kubeConfigPath, "master3", []byte("{}")); err == nil {
+		t.Error("expected the rejected patch to fail")
+	} else if _, ok := err.(*patchError); !ok {
+		t.Errorf("expected a patch error but got %v", err)
+	}
+}
+
+func TestCheckNodeReady(t *testing.T) {
+	nodes := map[string]string{
+		"ready":    `{"status":{"conditions":[{"type":"OutOfDisk","status":"False"},{"type":"Ready","status":"True"}]}}`,
+		"notready": `{"status":{"conditions":[{"type":"Ready","status":"False","reason":"KubeletNotReady","message":"cni not ready"}]}}`,
+		"starting": `{"status":{}}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		node, ok := nodes[filepath.Base(r.URL.Path)]
+		if r.Method != "GET" || !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(node))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "kubeadm-nodeready")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	kubeConfigPath := filepath.Join(dir, "kubelet.conf")
+	config := clientcmdapi.NewConfig()
+	config.Clusters["kubernetes"] = &clientcmdapi.Cluster{Server: server.URL}
+	config.Contexts["kubelet"] = &clientcmdapi.Context{Cluster: "kubernetes"}
+	config.CurrentContext = "kubelet"
+	if err = clientcmd.WriteToFile(*config, kubeConfigPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = checkNodeReady(kubeConfigPath, "ready"); err != nil {
+		t.Errorf("expected the node to be ready but got %v", err)
+	}
+	for _, node := range []string{"notready", "starting", "missing"} {
+		if err = checkNodeReady(kubeConfigPath, node); err == nil {
+			t.Errorf("expected %s to not be ready", node)
+		}
+	}
+	if err = checkNodeReady(kubeConfigPath, "notready"); err == nil || !strings.Contains(err.Error(), "cni not ready") {
+		t.Errorf("expected the ready condition message but got %v", err)
+	}
+}
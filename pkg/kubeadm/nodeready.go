@@ -0,0 +1,82 @@
+package kubeadm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+
+	kubeadmconstants "github.com/UKHomeOffice/keto-k8/pkg/kubeadm/constants"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// nodeStatus is the part of a node object needed to know if it's ready
+type nodeStatus struct {
+	Status struct {
+		Conditions []struct {
+			Type    string `json:"type"`
+			Status  string `json:"status"`
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+// WaitForNodeReady will wait until a node has registered and its Ready condition is True (or the timeout)
+// The kubelet kubeconfig is used (as for SetNodeCondition) so it's only found once the kubelet has bootstrapped
+func WaitForNodeReady(node string, timeout time.Duration) error {
+	kubeletKubeConfigPath := path.Join(KubeConfigDir, kubeadmconstants.KubeletKubeConfigFileName)
+	deadline := time.Now().Add(timeout)
+	for {
+		err := checkNodeReady(kubeletKubeConfigPath, node)
+		if err == nil {
+			logger.Printf("Node %s is ready", node)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for node %s to be ready [%v]", node, err)
+		}
+		logger.Printf("Waiting for node %s to be ready: %v", node, err)
+		time.Sleep(nodeConditionRetry)
+	}
+}
+
+// checkNodeReady returns why a node isn't ready yet (nil once it is)
+func checkNodeReady(kubeConfigPath, node string) error {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeConfigPath)
+	if err != nil {
+		return err
+	}
+	transport, err := rest.TransportFor(config)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Transport: transport, Timeout: nodeConditionRetry}
+	resp, err := client.Get(config.Host + "/api/v1/nodes/" + node)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("node not registered")
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("apiserver returned status %d", resp.StatusCode)
+	}
+	var n nodeStatus
+	if err = json.NewDecoder(resp.Body).Decode(&n); err != nil {
+		return err
+	}
+	for _, c := range n.Status.Conditions {
+		if c.Type != "Ready" {
+			continue
+		}
+		if c.Status == "True" {
+			return nil
+		}
+		return fmt.Errorf("node not ready (%s: %s)", c.Reason, c.Message)
+	}
+	return fmt.Errorf("node has no Ready condition")
+}
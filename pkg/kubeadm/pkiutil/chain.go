@@ -0,0 +1,51 @@
+package pkiutil
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	certutil "github.com/UKHomeOffice/keto-k8/pkg/client-go/util/cert"
+)
+
+// LoadCAChain loads a CA file which can be a chain: the signing CA first followed by any intermediates and the root
+func LoadCAChain(certificatePath string) ([]*x509.Certificate, error) {
+	certs, err := certutil.CertsFromFile(certificatePath)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load the CA file %s: %v", certificatePath, err)
+	}
+	return certs, nil
+}
+
+// ValidateCAChain checks the key is for the first (signing) CA and each cert is a current CA signed by the next one,
+// ending with a self-signed root (a single self-signed CA is a chain of one)
+func ValidateCAChain(chain []*x509.Certificate, key *rsa.PrivateKey) error {
+	if len(chain) == 0 {
+		return fmt.Errorf("no CA certificates")
+	}
+	pub, ok := chain[0].PublicKey.(*rsa.PublicKey)
+	if !ok || pub.N.Cmp(key.N) != 0 || pub.E != key.E {
+		return fmt.Errorf("the CA key isn't for the signing CA %q (the first certificate)", chain[0].Subject.CommonName)
+	}
+	now := time.Now()
+	for i, cert := range chain {
+		if !cert.IsCA {
+			return fmt.Errorf("%q isn't a CA certificate", cert.Subject.CommonName)
+		}
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return fmt.Errorf("%q is only valid from %v to %v", cert.Subject.CommonName, cert.NotBefore, cert.NotAfter)
+		}
+		if i == len(chain)-1 {
+			if err := cert.CheckSignatureFrom(cert); err != nil {
+				return fmt.Errorf("the last certificate %q must be a self-signed root [%v]", cert.Subject.CommonName, err)
+			}
+			break
+		}
+		if err := cert.CheckSignatureFrom(chain[i+1]); err != nil {
+			return fmt.Errorf("%q isn't signed by the next certificate %q [%v]",
+				cert.Subject.CommonName, chain[i+1].Subject.CommonName, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package pkiutil
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	certutil "github.com/UKHomeOffice/keto-k8/pkg/client-go/util/cert"
+)
+
+// newIntermediateCA returns a CA signed by another CA
+func newIntermediateCA(t *testing.T, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey) {
+	key, err := certutil.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "intermediate"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestValidateCAChain(t *testing.T) {
+	root, rootKey, err := NewCertificateAuthority()
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediate, intermediateKey := newIntermediateCA(t, root, rootKey)
+	other, _, err := NewCertificateAuthority()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _, err := NewCertAndKey(root, rootKey, certutil.Config{CommonName: "leaf", Usages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name  string
+		chain []*x509.Certificate
+		key   *rsa.PrivateKey
+		valid bool
+	}{
+		{name: "self-signed", chain: []*x509.Certificate{root}, key: rootKey, valid: true},
+		{name: "intermediate", chain: []*x509.Certificate{intermediate, root}, key: intermediateKey, valid: true},
+		{name: "root key", chain: []*x509.Certificate{intermediate, root}, key: rootKey},
+		{name: "no root", chain: []*x509.Certificate{intermediate}, key: intermediateKey},
+		{name: "wrong order", chain: []*x509.Certificate{root, intermediate}, key: rootKey},
+		{name: "other root", chain: []*x509.Certificate{intermediate, other}, key: intermediateKey},
+		{name: "not a CA", chain: []*x509.Certificate{leaf, root}, key: rootKey},
+		{name: "empty", key: rootKey},
+	} {
+		if err := ValidateCAChain(test.chain, test.key); (err == nil) != test.valid {
+			t.Errorf("%s: expected valid %v but got %v", test.name, test.valid, err)
+		}
+	}
+
+	// Loaded in order from a file
+	f, err := ioutil.TempFile("", "ca-chain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Write(append(certutil.EncodeCertPEM(intermediate), certutil.EncodeCertPEM(root)...))
+	f.Close()
+	chain, err := LoadCAChain(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 2 || !chain[0].Equal(intermediate) || !chain[1].Equal(root) {
+		t.Errorf("expected the intermediate then the root but got %d certs", len(chain))
+	}
+}
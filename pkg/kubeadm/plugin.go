@@ -0,0 +1,62 @@
+package kubeadm
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/command"
+	"github.com/UKHomeOffice/keto-k8/pkg/tracing"
+)
+
+// The kubeadm phases which need the kubeadm internals (k8s.io/kubernetes) aren't built into a slim build (see the
+// slim build tag). A slim build runs them with a full keto-k8 binary (the plugin) instead, passing the config as json.
+
+// PluginCommand is the (hidden) command the plugin is run with
+const PluginCommand = "kubeadm-plugin"
+
+// Plugin phases
+const (
+	PluginManifests    = "manifests"
+	PluginAddons       = "addons"
+	PluginMasterRole   = "master-role"
+	PluginUploadConfig = "upload-config"
+)
+
+var (
+	// Plugin is the full keto-k8 binary run by a slim build
+	Plugin = "kmm"
+	// PluginArgs are passed to the plugin before the phase e.g. the global flags
+	PluginArgs []string
+)
+
+// RunPhase will run a kubeadm phase in process (i.e. as the plugin)
+func (k *Config) RunPhase(phase string) error {
+	if slim {
+		return fmt.Errorf("the kubeadm phases aren't built into this binary, the plugin must be a full build")
+	}
+	switch phase {
+	case PluginManifests:
+		return k.WriteManifests()
+	case PluginAddons:
+		return k.Addons()
+	case PluginMasterRole:
+		return k.UpdateMasterRoleLabelsAndTaints()
+	case PluginUploadConfig:
+		return k.UploadConfig()
+	}
+	return fmt.Errorf("unknown kubeadm phase %q", phase)
+}
+
+// runPlugin will run a kubeadm phase with the plugin
+func (k *Config) runPlugin(phase string) (err error) {
+	cfg, err := json.Marshal(k)
+	if err != nil {
+		return err
+	}
+	args := append(append([]string{PluginCommand}, PluginArgs...), phase)
+	logger.Printf("Running:%v %v %v", Plugin, PluginCommand, phase)
+	span := tracing.Start(Plugin + " " + phase)
+	defer func() { tracing.End(span, err) }()
+	_, err = command.Run(logger, string(cfg), Plugin, args...)
+	return err
+}
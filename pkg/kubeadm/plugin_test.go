@@ -0,0 +1,57 @@
+package kubeadm
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunPlugin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeadm-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(plugin string, args []string) {
+		Plugin = plugin
+		PluginArgs = args
+	}(Plugin, PluginArgs)
+
+	// The fake plugin saves its args and the config it was given
+	Plugin = filepath.Join(dir, "kmm")
+	script := "#!/bin/sh\necho \"$@\" > " + dir + "/args\ncat > " + dir + "/config\n"
+	if err = ioutil.WriteFile(Plugin, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	PluginArgs = []string{"--log-level=debug"}
+
+	k := &Config{KubeVersion: "v1.7.0", MasterCount: 3}
+	if err = k.runPlugin(PluginManifests); err != nil {
+		t.Fatal(err)
+	}
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(args)) != PluginCommand+" --log-level=debug "+PluginManifests {
+		t.Errorf("unexpected plugin args %q", args)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg Config
+	if err = json.Unmarshal(b, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.KubeVersion != k.KubeVersion || cfg.MasterCount != k.MasterCount {
+		t.Errorf("expected the plugin to be given the config but got %s", b)
+	}
+
+	if err = k.RunPhase("unknown"); err == nil {
+		t.Error("expected an error for an unknown phase")
+	}
+}
@@ -0,0 +1,168 @@
+package kubeadm
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	certutil "github.com/UKHomeOffice/keto-k8/pkg/client-go/util/cert"
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+)
+
+// The service account key rotation phases (in order), each one is applied by the masters when kmm is restarted:
+// trust - the new public key is trusted by the apiservers alongside the old one (which still signs the tokens)
+// sign - the new key signs the tokens (the old public key is still trusted)
+// complete - the new key replaces the old key in the shared assets (only the new public key is trusted)
+const (
+	SARotationTrust    = "trust"
+	SARotationSign     = "sign"
+	SARotationComplete = "complete"
+)
+
+// SARotationAnnotation is set on the control plane pods to the service account key rotation phase (so they restart
+// with the keys of each phase)
+const SARotationAnnotation = "keto-k8/sa-rotation"
+
+const (
+	// saRotationPubName has the public keys the apiserver trusts during a rotation
+	saRotationPubName = "sa-rotation.pub"
+	// saRotationKeyName is the key the controller-manager signs with during a rotation
+	saRotationKeyName = "sa-rotation.key"
+)
+
+// ServiceAccountRotation is the new service account key and the rotation phase a master applies, the rotation keys
+// are kept in their own files so the shared assets on disk are unchanged until the complete phase
+type ServiceAccountRotation struct {
+	// Phase is SARotationTrust, SARotationSign or SARotationComplete
+	Phase string
+	// OldPub is the public key being replaced (from the shared assets)
+	OldPub string
+	// Pub and Key are the new key pair
+	Pub string
+	Key string
+}
+
+// NewServiceAccountKey returns the PEM encoded key pair from a key file (or a new key if no file is specified)
+func NewServiceAccountKey(keyFile string) (key, pub string, err error) {
+	var rsaKey *rsa.PrivateKey
+	if len(keyFile) == 0 {
+		if rsaKey, err = certutil.NewPrivateKey(); err != nil {
+			return "", "", err
+		}
+	} else {
+		data, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return "", "", err
+		}
+		parsed, err := certutil.ParsePrivateKeyPEM(data)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid service account key %s [%v]", keyFile, err)
+		}
+		var ok bool
+		if rsaKey, ok = parsed.(*rsa.PrivateKey); !ok {
+			return "", "", fmt.Errorf("the service account key %s isn't in RSA format", keyFile)
+		}
+	}
+	pubBytes, err := certutil.EncodePublicKeyPEM(&rsaKey.PublicKey)
+	if err != nil {
+		return "", "", err
+	}
+	return string(certutil.EncodePrivateKeyPEM(rsaKey)), string(pubBytes), nil
+}
+
+// ServiceAccountPub returns the service account public key from the shared assets
+func ServiceAccountPub(assets string) (string, error) {
+	sharedAssets, err := decodeSharedAssets(assets)
+	if err != nil {
+		return "", err
+	}
+	return sharedAssets.SaPub, nil
+}
+
+// ReplaceServiceAccountKey returns the shared assets with a new service account key pair
+func ReplaceServiceAccountKey(assets, key, pub string) (string, error) {
+	sharedAssets, err := decodeSharedAssets(assets)
+	if err != nil {
+		return "", err
+	}
+	sharedAssets.SaKey = key
+	sharedAssets.SaPub = pub
+	assetsBytes, err := json.Marshal(sharedAssets)
+	if err != nil {
+		return "", err
+	}
+	return compressAssets(assetsBytes)
+}
+
+// decodeSharedAssets returns the shared assets (not the kubeadm join details, which don't have the keys)
+func decodeSharedAssets(assets string) (*SharedAssets, error) {
+	if IsJoinAssets(assets) {
+		return nil, fmt.Errorf("the service account key is uploaded with kubeadm in the %s join mode", JoinModeKubeadm)
+	}
+	assetsBytes, err := decompressAssets(assets)
+	if err != nil {
+		return nil, err
+	}
+	sharedAssets := &SharedAssets{}
+	if err = json.Unmarshal(assetsBytes, sharedAssets); err != nil {
+		return nil, fmt.Errorf("assets could not be decoded [%v]", err)
+	}
+	return sharedAssets, nil
+}
+
+// trustedPubs returns the public keys the apiserver verifies tokens with in the current phase
+func (r *ServiceAccountRotation) trustedPubs() []byte {
+	if r.Phase == SARotationComplete {
+		return []byte(r.Pub)
+	}
+	pubs := []byte(r.OldPub)
+	if len(pubs) > 0 && pubs[len(pubs)-1] != '\n' {
+		pubs = append(pubs, '\n')
+	}
+	return append(pubs, r.Pub...)
+}
+
+// serviceAccountRotationArgs returns the apiserver and controller-manager flags for the rotation keys (none without
+// a rotation)
+func serviceAccountRotationArgs(r *ServiceAccountRotation) (apiServer, controllerManager map[string]string) {
+	if r == nil {
+		return nil, nil
+	}
+	apiServer = map[string]string{"service-account-key-file": filepath.Join(PkiDir, saRotationPubName)}
+	if r.Phase == SARotationTrust {
+		return apiServer, nil
+	}
+	return apiServer, map[string]string{"service-account-private-key-file": filepath.Join(PkiDir, saRotationKeyName)}
+}
+
+// writeKeys will save the rotation keys for the current phase
+func (r *ServiceAccountRotation) writeKeys() error {
+	if err := fileutil.WriteFile(filepath.Join(PkiDir, saRotationPubName), r.trustedPubs(), 0644); err != nil {
+		return err
+	}
+	return fileutil.WriteFile(filepath.Join(PkiDir, saRotationKeyName), []byte(r.Key), 0600)
+}
+
+// mutator will annotate the control plane pods with the rotation phase
+func (r *ServiceAccountRotation) mutator() podspec.Mutator {
+	return func(o podspec.Object) error {
+		if o.HasPodSpec() {
+			o.SetPodAnnotation(SARotationAnnotation, r.Phase)
+		}
+		return nil
+	}
+}
+
+// removeServiceAccountRotationKeys will remove the rotation keys (once the rotation is finished)
+func removeServiceAccountRotationKeys() error {
+	for _, name := range []string{saRotationPubName, saRotationKeyName} {
+		if err := os.Remove(filepath.Join(PkiDir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package kubeadm
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReplaceServiceAccountKey(t *testing.T) {
+	oldKey, oldPub, err := NewServiceAccountKey("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assetsBytes, _ := json.Marshal(SharedAssets{SaKey: oldKey, SaPub: oldPub, FrontProxyCa: "front-proxy-ca"})
+	assets, err := compressAssets(assetsBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pub, err := ServiceAccountPub(assets); err != nil || pub != oldPub {
+		t.Errorf("expected the public key from the assets but got %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "sa-rotation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "new.key")
+	newKey, _, _ := NewServiceAccountKey("")
+	if err = ioutil.WriteFile(keyFile, []byte(newKey), 0600); err != nil {
+		t.Fatal(err)
+	}
+	key, pub, err := NewServiceAccountKey(keyFile)
+	if err != nil || key != newKey || !strings.Contains(pub, "PUBLIC KEY") {
+		t.Fatalf("expected the key pair from the key file but got %v", err)
+	}
+
+	if assets, err = ReplaceServiceAccountKey(assets, key, pub); err != nil {
+		t.Fatal(err)
+	}
+	replaced, err := decodeSharedAssets(assets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replaced.SaKey != key || replaced.SaPub != pub || replaced.FrontProxyCa != "front-proxy-ca" {
+		t.Errorf("expected only the service account key to be replaced but got %+v", replaced)
+	}
+	if _, err = ServiceAccountPub(joinAssetsPrefix + "{}"); err == nil {
+		t.Error("expected an error for the kubeadm join details")
+	}
+}
+
+func TestServiceAccountRotationKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sa-rotation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(pkiDir string) { PkiDir = pkiDir }(PkiDir)
+	PkiDir = dir
+
+	if apiServer, controllerManager := serviceAccountRotationArgs(nil); apiServer != nil || controllerManager != nil {
+		t.Errorf("expected no args without a rotation")
+	}
+	r := &ServiceAccountRotation{Phase: SARotationTrust, OldPub: "old", Pub: "new\n", Key: "key"}
+	for _, expected := range []struct {
+		phase   string
+		pubs    string
+		signing bool
+	}{
+		{phase: SARotationTrust, pubs: "old\nnew\n"},
+		{phase: SARotationSign, pubs: "old\nnew\n", signing: true},
+		{phase: SARotationComplete, pubs: "new\n", signing: true},
+	} {
+		r.Phase = expected.phase
+		if err = r.writeKeys(); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := ioutil.ReadFile(filepath.Join(dir, saRotationPubName)); string(data) != expected.pubs {
+			t.Errorf("expected the %s phase to trust %q but got %q", expected.phase, expected.pubs, data)
+		}
+		apiServer, controllerManager := serviceAccountRotationArgs(r)
+		if apiServer["service-account-key-file"] != filepath.Join(dir, saRotationPubName) {
+			t.Errorf("expected the apiserver to trust the rotation keys in the %s phase but got %v", expected.phase, apiServer)
+		}
+		if signing := controllerManager["service-account-private-key-file"] == filepath.Join(dir, saRotationKeyName); signing != expected.signing {
+			t.Errorf("expected signing with the new key %v in the %s phase but got %v", expected.signing, expected.phase, controllerManager)
+		}
+	}
+	if err = removeServiceAccountRotationKeys(); err != nil {
+		t.Error(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, saRotationKeyName)); !os.IsNotExist(err) {
+		t.Errorf("expected the rotation key to be removed but got %v", err)
+	}
+}
@@ -0,0 +1,26 @@
+// +build slim
+
+package kubeadm
+
+// slim is set when the kubeadm internals aren't built in
+const slim = true
+
+// WriteManifests - will save kubernetes master manifests (using the plugin)
+func (k *Config) WriteManifests() error {
+	return k.runPlugin(PluginManifests)
+}
+
+// Addons - deploys the essential addons (using the plugin)
+func (k *Config) Addons() error {
+	return k.runPlugin(PluginAddons)
+}
+
+// UpdateMasterRoleLabelsAndTaints will apply the master role taints and labels (using the plugin)
+func (k *Config) UpdateMasterRoleLabelsAndTaints() error {
+	return k.runPlugin(PluginMasterRole)
+}
+
+// UploadConfig will write the kubeadm-config and kubelet-config configmaps (using the plugin)
+func (k *Config) UploadConfig() error {
+	return k.runPlugin(PluginUploadConfig)
+}
@@ -0,0 +1,124 @@
+package kubeadm
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+)
+
+// staticPodLogsVolume is the volume each control plane component logs to (when logging to files)
+const staticPodLogsVolume = "keto-logs"
+
+// minContainerLogMaxFiles is the fewest rotated logs the kubelet allows (the current log and one rotated)
+const minContainerLogMaxFiles = 2
+
+// StaticPodLogs is how the control plane static pods log, to stderr (read by the container runtime) or to files under
+// a host directory for a log shipper, and when the container runtime rotates the container logs
+type StaticPodLogs struct {
+	// Dir is the host directory the components log to (in a sub directory for each), stderr only when not set
+	Dir string `json:"dir,omitempty"`
+	// AlsoToStderr keeps logging to stderr as well as the files (so kubectl logs still works)
+	AlsoToStderr bool `json:"alsoToStderr,omitempty"`
+	// MaxSizeMB is the size (in MiB) the container runtime rotates the container logs at
+	MaxSizeMB int `json:"maxSizeMB,omitempty"`
+	// MaxFiles is the number of container logs the container runtime keeps (including the current log)
+	MaxFiles int `json:"maxFiles,omitempty"`
+}
+
+// Validate will check the log directory is absolute and the rotation is one the runtimes accept
+func (l *StaticPodLogs) Validate() error {
+	if l == nil {
+		return nil
+	}
+	if len(l.Dir) > 0 && !filepath.IsAbs(l.Dir) {
+		return fmt.Errorf("staticPodLogs: dir %q must be an absolute path", l.Dir)
+	}
+	if l.AlsoToStderr && len(l.Dir) == 0 {
+		return fmt.Errorf("staticPodLogs: alsoToStderr needs a dir to log to")
+	}
+	if l.MaxSizeMB < 0 {
+		return fmt.Errorf("staticPodLogs: invalid maxSizeMB %d", l.MaxSizeMB)
+	}
+	if l.MaxFiles != 0 && l.MaxFiles < minContainerLogMaxFiles {
+		return fmt.Errorf("staticPodLogs: maxFiles must be at least %d", minContainerLogMaxFiles)
+	}
+	if l.MaxFiles > 0 && l.MaxSizeMB == 0 {
+		return fmt.Errorf("staticPodLogs: maxFiles needs a maxSizeMB to rotate at")
+	}
+	return nil
+}
+
+// Enabled is true when the components log to files
+func (l *StaticPodLogs) Enabled() bool {
+	return l != nil && len(l.Dir) > 0
+}
+
+// Rotated is true when the container runtime rotates the container logs
+func (l *StaticPodLogs) Rotated() bool {
+	return l != nil && l.MaxSizeMB > 0
+}
+
+// ComponentDir returns the host directory a component logs to
+func (l *StaticPodLogs) ComponentDir(component string) string {
+	return filepath.Join(l.Dir, component)
+}
+
+// Args returns the component flags to log to files (none when logging to stderr), glog rotates the files itself
+func (l *StaticPodLogs) Args(component string) map[string]string {
+	if !l.Enabled() {
+		return nil
+	}
+	return map[string]string{
+		"log-dir":         l.ComponentDir(component),
+		"logtostderr":     "false",
+		"alsologtostderr": strconv.FormatBool(l.AlsoToStderr),
+	}
+}
+
+// Mutator returns a podspec.Mutator mounting the component log directory into each control plane static pod
+func (l *StaticPodLogs) Mutator() podspec.Mutator {
+	return func(o podspec.Object) error {
+		for _, component := range StaticPods {
+			if o.Container(component) == nil {
+				continue
+			}
+			dir := l.ComponentDir(component)
+			o.AddVolume(map[string]interface{}{
+				"name":     staticPodLogsVolume,
+				"hostPath": map[string]interface{}{"path": dir, "type": "DirectoryOrCreate"},
+			})
+			return o.AddVolumeMount(component, map[string]interface{}{
+				"name":      staticPodLogsVolume,
+				"mountPath": dir,
+			})
+		}
+		return nil
+	}
+}
+
+// KubeletArgs returns the kubelet flags for a CRI runtime to rotate the container logs (the docker json-file logs are
+// rotated by the docker log options instead)
+func (l *StaticPodLogs) KubeletArgs() string {
+	if !l.Rotated() {
+		return ""
+	}
+	args := fmt.Sprintf("--container-log-max-size=%dMi", l.MaxSizeMB)
+	if l.MaxFiles > 0 {
+		args += fmt.Sprintf(" --container-log-max-files=%d", l.MaxFiles)
+	}
+	return args
+}
+
+// DockerLogOpts returns the docker json-file log options to rotate the container logs
+func (l *StaticPodLogs) DockerLogOpts() map[string]interface{} {
+	if !l.Rotated() {
+		return nil
+	}
+	opts := map[string]interface{}{"max-size": fmt.Sprintf("%dm", l.MaxSizeMB)}
+	if l.MaxFiles > 0 {
+		opts["max-file"] = strconv.Itoa(l.MaxFiles)
+	}
+	return opts
+}
@@ -0,0 +1,63 @@
+package kubeadm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+)
+
+func TestStaticPodLogsValidate(t *testing.T) {
+	var l *StaticPodLogs
+	if err := l.Validate(); err != nil || l.Enabled() || l.Rotated() || len(l.Args("kube-apiserver")) > 0 {
+		t.Errorf("expected no static pod logs to be valid and log to stderr but got %v", err)
+	}
+	for _, invalid := range []StaticPodLogs{
+		{Dir: "var/log/kubernetes"},
+		{AlsoToStderr: true},
+		{MaxSizeMB: -1},
+		{MaxSizeMB: 100, MaxFiles: 1},
+		{MaxFiles: 5},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", invalid)
+		}
+	}
+	l = &StaticPodLogs{MaxSizeMB: 100}
+	if err := l.Validate(); err != nil || l.Enabled() || !l.Rotated() {
+		t.Errorf("expected rotation without a log dir to be valid but got %v", err)
+	}
+}
+
+func TestStaticPodLogsArgs(t *testing.T) {
+	l := &StaticPodLogs{Dir: "/var/log/kubernetes", AlsoToStderr: true, MaxSizeMB: 100, MaxFiles: 5}
+	args := l.Args("kube-scheduler")
+	if args["log-dir"] != "/var/log/kubernetes/kube-scheduler" || args["logtostderr"] != "false" || args["alsologtostderr"] != "true" {
+		t.Errorf("unexpected scheduler log args %v", args)
+	}
+	if args := l.KubeletArgs(); args != "--container-log-max-size=100Mi --container-log-max-files=5" {
+		t.Errorf("unexpected kubelet args %q", args)
+	}
+	if opts := l.DockerLogOpts(); opts["max-size"] != "100m" || opts["max-file"] != "5" {
+		t.Errorf("unexpected docker log opts %v", opts)
+	}
+}
+
+func TestStaticPodLogsMutator(t *testing.T) {
+	l := &StaticPodLogs{Dir: "/var/log/kubernetes"}
+	manifest, err := podspec.Transform(testAPIServerPod, l.Mutator())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"name: keto-logs",
+		"path: /var/log/kubernetes/kube-apiserver",
+		"type: DirectoryOrCreate",
+		"mountPath: /var/log/kubernetes/kube-apiserver",
+		"mountPath: /etc/ssl/certs",
+	} {
+		if !strings.Contains(manifest, expected) {
+			t.Errorf("expected the apiserver manifest to contain %q but got:\n%s", expected, manifest)
+		}
+	}
+}
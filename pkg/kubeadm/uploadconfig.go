@@ -0,0 +1,242 @@
+package kubeadm
+
+import (
+	"fmt"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/constants"
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+	"github.com/ghodss/yaml"
+	"k8s.io/kubernetes/pkg/util/version"
+)
+
+// KubeadmConfigName is the kube-system configmap with the ClusterConfiguration (as kubeadm init phase upload-config)
+const KubeadmConfigName = "kubeadm-config"
+
+// masterRoleLabel is set on the master nodes (the advertised endpoints in the kubeadm ClusterStatus)
+const masterRoleLabel = "node-role.kubernetes.io/master"
+
+// nodeGroups can read the uploaded config (the same as kubeadm, so nodes can join with kubeadm)
+var nodeGroups = []string{defaultNodeGroup, "system:nodes"}
+
+var (
+	// minUploadConfigVersion is the first version with the ClusterConfiguration kind (kubeadm.k8s.io/v1beta1)
+	minUploadConfigVersion = version.MustParseGeneric("v1.13.0")
+	// kubeadm.k8s.io/v1beta2 is used from v1.15 and v1beta3 (without the ClusterStatus) from v1.22
+	minV1beta2Version = version.MustParseGeneric("v1.15.0")
+	minV1beta3Version = version.MustParseGeneric("v1.22.0")
+)
+
+// clusterConfig is the kubeadm config in the upstream ClusterConfiguration layout
+type clusterConfig struct {
+	KubernetesVersion     string
+	ControlPlaneEndpoint  string
+	CertificatesDir       string
+	PodSubnet             string
+	ServiceSubnet         string
+	DNSDomain             string
+	EtcdEndpoints         []string
+	EtcdCAFile            string
+	EtcdCertFile          string
+	EtcdKeyFile           string
+	APIServerArgs         map[string]string
+	ControllerManagerArgs map[string]string
+	SchedulerArgs         map[string]string
+	// The extra volumes of the apiserver and controller manager
+	APIServerVolumes         []HostPathMount
+	ControllerManagerVolumes []HostPathMount
+	// BindPort is the port the api server of each master listens on
+	BindPort int32
+}
+
+// UploadConfigSupported returns true when kubeadm of a version reads the uploaded ClusterConfiguration
+func UploadConfigSupported(kubeVersion string) bool {
+	v, err := version.ParseGeneric(kubeVersion)
+	return err == nil && v.AtLeast(minUploadConfigVersion)
+}
+
+// uploadConfigResources returns the kubeadm-config and kubelet-config configmaps (and the RBAC for nodes to read them)
+// as kubeadm would upload them, the ClusterStatus advertises the api server of each master node
+func (k *Config) uploadConfigResources(cfg clusterConfig, masters []podspec.Object) (string, error) {
+	v, err := version.ParseGeneric(k.KubeVersion)
+	if err != nil {
+		return "", fmt.Errorf("couldn't parse kubernetes version %q: %v", k.KubeVersion, err)
+	}
+	if !v.AtLeast(minUploadConfigVersion) {
+		return "", fmt.Errorf("the kubeadm config can only be uploaded from kubernetes %s", minUploadConfigVersion)
+	}
+	apiVersion := "kubeadm.k8s.io/v1beta1"
+	if v.AtLeast(minV1beta3Version) {
+		apiVersion = "kubeadm.k8s.io/v1beta3"
+	} else if v.AtLeast(minV1beta2Version) {
+		apiVersion = "kubeadm.k8s.io/v1beta2"
+	}
+	clusterConfiguration, err := yaml.Marshal(cfg.configuration(apiVersion))
+	if err != nil {
+		return "", err
+	}
+	kubeadmConfig := map[string]string{"ClusterConfiguration": string(clusterConfiguration)}
+	if !v.AtLeast(minV1beta3Version) {
+		clusterStatus, err := yaml.Marshal(map[string]interface{}{
+			"apiVersion":   apiVersion,
+			"kind":         "ClusterStatus",
+			"apiEndpoints": apiEndpoints(masters, cfg.BindPort),
+		})
+		if err != nil {
+			return "", err
+		}
+		kubeadmConfig["ClusterStatus"] = string(clusterStatus)
+	}
+	kubelet, err := k.upstreamKubeletConfig()
+	if err != nil {
+		return "", err
+	}
+	kubeletConfigName := fmt.Sprintf("kubelet-config-%d.%d", v.Major(), v.Minor())
+
+	var docs []map[string]interface{}
+	for _, c := range []struct {
+		name string
+		data map[string]string
+	}{
+		{name: KubeadmConfigName, data: kubeadmConfig},
+		{name: kubeletConfigName, data: map[string]string{"kubelet": string(kubelet)}},
+	} {
+		docs = append(docs, readableConfigMap(c.name, c.data)...)
+	}
+	var resources string
+	for i, doc := range docs {
+		data, err := yaml.Marshal(doc)
+		if err != nil {
+			return "", err
+		}
+		if i > 0 {
+			resources += "---\n"
+		}
+		resources += string(data)
+	}
+	return resources, nil
+}
+
+// configuration returns the ClusterConfiguration
+func (c clusterConfig) configuration(apiVersion string) map[string]interface{} {
+	config := map[string]interface{}{
+		"apiVersion":           apiVersion,
+		"kind":                 "ClusterConfiguration",
+		"clusterName":          kubeConfigClusterName,
+		"kubernetesVersion":    c.KubernetesVersion,
+		"controlPlaneEndpoint": c.ControlPlaneEndpoint,
+		"certificatesDir":      c.CertificatesDir,
+		"networking": map[string]string{
+			"podSubnet":     c.PodSubnet,
+			"serviceSubnet": c.ServiceSubnet,
+			"dnsDomain":     c.DNSDomain,
+		},
+		"apiServer":         component(c.APIServerArgs, c.APIServerVolumes),
+		"controllerManager": component(c.ControllerManagerArgs, c.ControllerManagerVolumes),
+		"scheduler":         component(c.SchedulerArgs, nil),
+	}
+	if len(c.EtcdEndpoints) > 0 {
+		config["etcd"] = map[string]interface{}{
+			"external": map[string]interface{}{
+				"endpoints": c.EtcdEndpoints,
+				"caFile":    c.EtcdCAFile,
+				"certFile":  c.EtcdCertFile,
+				"keyFile":   c.EtcdKeyFile,
+			},
+		}
+	}
+	return config
+}
+
+// component returns the ClusterConfiguration of a control plane component
+func component(args map[string]string, volumes []HostPathMount) map[string]interface{} {
+	c := map[string]interface{}{"extraArgs": args}
+	if len(volumes) > 0 {
+		c["extraVolumes"] = volumes
+	}
+	return c
+}
+
+// upstreamKubeletConfig returns the KubeletConfiguration of every node (the kubelet flags keto-k8 sets and the
+// resources before any node pool overrides)
+func (k *Config) upstreamKubeletConfig() ([]byte, error) {
+	resources, err := k.Kubelet.Resources(nil).ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	config := map[string]interface{}{}
+	if err = yaml.Unmarshal(resources, &config); err != nil {
+		return nil, err
+	}
+	config["authentication"] = map[string]interface{}{
+		"anonymous": map[string]bool{"enabled": false},
+		"webhook":   map[string]bool{"enabled": true},
+		"x509":      map[string]string{"clientCAFile": CaCertFile},
+	}
+	config["authorization"] = map[string]string{"mode": "Webhook"}
+	config["clusterDNS"] = []string{"10.96.0.10"}
+	config["clusterDomain"] = constants.DefaultServiceDNSDomain
+	config["readOnlyPort"] = 0
+	config["staticPodPath"] = KubeConfigDir + "/manifests"
+	config["imageGCHighThresholdPercent"] = 60
+	config["imageGCLowThresholdPercent"] = 40
+	return yaml.Marshal(config)
+}
+
+// apiEndpoints returns the ClusterStatus api endpoint of each master node (by its internal address)
+func apiEndpoints(masters []podspec.Object, bindPort int32) map[string]interface{} {
+	endpoints := map[string]interface{}{}
+	for _, node := range masters {
+		status, _ := node["status"].(map[string]interface{})
+		addresses, _ := status["addresses"].([]interface{})
+		for _, a := range addresses {
+			address, _ := a.(map[string]interface{})
+			if address["type"] == "InternalIP" {
+				endpoints[node.Name()] = map[string]interface{}{"advertiseAddress": address["address"], "bindPort": bindPort}
+				break
+			}
+		}
+	}
+	return endpoints
+}
+
+// readableConfigMap returns a kube-system configmap and the role and binding for nodes to read it
+func readableConfigMap(name string, data map[string]string) []map[string]interface{} {
+	labels := map[string]string{constants.ManagedByLabel: constants.ManagedByValue}
+	metadata := func(name string) map[string]interface{} {
+		return map[string]interface{}{"name": name, "namespace": "kube-system", "labels": labels}
+	}
+	role := "kubeadm:" + name
+	if name == KubeadmConfigName {
+		role = "kubeadm:nodes-" + name
+	}
+	var subjects []map[string]string
+	for _, group := range nodeGroups {
+		subjects = append(subjects, map[string]string{"apiGroup": "rbac.authorization.k8s.io", "kind": "Group", "name": group})
+	}
+	return []map[string]interface{}{
+		{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   metadata(name),
+			"data":       data,
+		},
+		{
+			"apiVersion": "rbac.authorization.k8s.io/v1",
+			"kind":       "Role",
+			"metadata":   metadata(role),
+			"rules": []map[string]interface{}{{
+				"apiGroups":     []string{""},
+				"resources":     []string{"configmaps"},
+				"resourceNames": []string{name},
+				"verbs":         []string{"get"},
+			}},
+		},
+		{
+			"apiVersion": "rbac.authorization.k8s.io/v1",
+			"kind":       "RoleBinding",
+			"metadata":   metadata(role),
+			"roleRef":    map[string]string{"apiGroup": "rbac.authorization.k8s.io", "kind": "Role", "name": role},
+			"subjects":   subjects,
+		},
+	}
+}
@@ -0,0 +1,94 @@
+package kubeadm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+	"github.com/ghodss/yaml"
+)
+
+func TestUploadConfigResources(t *testing.T) {
+	cfg := clusterConfig{
+		KubernetesVersion:    "v1.15.3",
+		ControlPlaneEndpoint: "kube-api.example.com:443",
+		CertificatesDir:      PkiDir,
+		PodSubnet:            "10.244.0.0/16",
+		EtcdEndpoints:        []string{"https://etcd0:2379"},
+		APIServerArgs:        map[string]string{"etcd-prefix": "/keto-k8/prod/registry"},
+		BindPort:             443,
+		APIServerVolumes: []HostPathMount{
+			{Name: "audit-log", HostPath: "/var/log/kubernetes/audit", MountPath: "/var/log/kubernetes/audit"},
+		},
+	}
+	masters := []podspec.Object{{
+		"metadata": map[string]interface{}{"name": "master0"},
+		"status": map[string]interface{}{"addresses": []interface{}{
+			map[string]interface{}{"type": "Hostname", "address": "master0"},
+			map[string]interface{}{"type": "InternalIP", "address": "10.250.0.10"},
+		}},
+	}}
+	k := &Config{KubeVersion: "v1.15.3", Kubelet: &KubeletConfig{KubeletResources: KubeletResources{MaxPods: 50}}}
+	resources, err := k.uploadConfigResources(cfg, masters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configMaps := map[string]map[string]string{}
+	for _, doc := range strings.Split(resources, "---\n") {
+		var o struct {
+			Kind     string                 `json:"kind"`
+			Metadata map[string]interface{} `json:"metadata"`
+			Data     map[string]string      `json:"data"`
+		}
+		if err = yaml.Unmarshal([]byte(doc), &o); err != nil {
+			t.Fatal(err)
+		}
+		if o.Kind == "ConfigMap" {
+			configMaps[o.Metadata["name"].(string)] = o.Data
+		}
+	}
+	kubeadmConfig, ok := configMaps[KubeadmConfigName]
+	if !ok {
+		t.Fatalf("expected the %s configmap but got:\n%s", KubeadmConfigName, resources)
+	}
+	for _, expected := range []string{
+		"apiVersion: kubeadm.k8s.io/v1beta2",
+		"kind: ClusterConfiguration",
+		"controlPlaneEndpoint: kube-api.example.com:443",
+		"etcd-prefix: /keto-k8/prod/registry",
+		"- https://etcd0:2379",
+		"hostPath: /var/log/kubernetes/audit",
+	} {
+		if !strings.Contains(kubeadmConfig["ClusterConfiguration"], expected) {
+			t.Errorf("expected the ClusterConfiguration to contain %q but got:\n%s", expected, kubeadmConfig["ClusterConfiguration"])
+		}
+	}
+	if !strings.Contains(kubeadmConfig["ClusterStatus"], "advertiseAddress: 10.250.0.10") {
+		t.Errorf("expected the ClusterStatus to advertise the master but got:\n%s", kubeadmConfig["ClusterStatus"])
+	}
+	kubelet := configMaps["kubelet-config-1.15"]["kubelet"]
+	for _, expected := range []string{"kind: KubeletConfiguration", "maxPods: 50", "- 10.96.0.10", "mode: Webhook"} {
+		if !strings.Contains(kubelet, expected) {
+			t.Errorf("expected the kubelet-config-1.15 to contain %q but got:\n%s", expected, kubelet)
+		}
+	}
+	if !strings.Contains(resources, "name: kubeadm:nodes-kubeadm-config") || !strings.Contains(resources, "name: kubeadm:kubelet-config-1.15") {
+		t.Errorf("expected the roles for nodes to read the config but got:\n%s", resources)
+	}
+
+	// v1beta3 has no ClusterStatus
+	k.KubeVersion = "v1.22.1"
+	if resources, err = k.uploadConfigResources(cfg, masters); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(resources, "kubeadm.k8s.io/v1beta3") || strings.Contains(resources, "ClusterStatus") {
+		t.Errorf("expected a v1beta3 ClusterConfiguration only but got:\n%s", resources)
+	}
+	k.KubeVersion = "v1.9.3"
+	if _, err = k.uploadConfigResources(cfg, masters); err == nil {
+		t.Error("expected an error before kubeadm reads the ClusterConfiguration")
+	}
+	if UploadConfigSupported("v1.9.3") || !UploadConfigSupported("v1.13.0") {
+		t.Error("expected the config to be uploaded from v1.13")
+	}
+}
@@ -0,0 +1,107 @@
+package lbregister
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/logging"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
+)
+
+var logger = logging.New("lbregister")
+
+// Timeout for each load balancer and instance metadata request
+var Timeout = 30 * time.Second
+
+var (
+	// newClient returns the ELBv2 api for a region (replaced in tests)
+	newClient = func(region string) elbv2iface.ELBV2API {
+		return elbv2.New(session.New(&aws.Config{
+			Region:     aws.String(region),
+			HTTPClient: &http.Client{Timeout: Timeout},
+		}))
+	}
+	// instanceID returns the id of this instance (replaced in tests)
+	instanceID = func() (string, error) {
+		return ec2metadata.New(session.New(&aws.Config{HTTPClient: &http.Client{Timeout: Timeout}})).GetMetadata("instance-id")
+	}
+)
+
+// ValidateTargetGroups will check each target group is an ELBv2 target group ARN
+func ValidateTargetGroups(arns []string) error {
+	for _, arn := range arns {
+		if _, err := region(arn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Register will add this instance to each target group (on the target group port)
+func Register(arns []string) error {
+	return forEachTargetGroup(arns, "Registered", func(client elbv2iface.ELBV2API, arn string, target *elbv2.TargetDescription) error {
+		_, err := client.RegisterTargets(&elbv2.RegisterTargetsInput{
+			TargetGroupArn: aws.String(arn),
+			Targets:        []*elbv2.TargetDescription{target},
+		})
+		return err
+	})
+}
+
+// Deregister will remove this instance from each target group (it's drained by the load balancer)
+func Deregister(arns []string) error {
+	return forEachTargetGroup(arns, "Deregistered", func(client elbv2iface.ELBV2API, arn string, target *elbv2.TargetDescription) error {
+		_, err := client.DeregisterTargets(&elbv2.DeregisterTargetsInput{
+			TargetGroupArn: aws.String(arn),
+			Targets:        []*elbv2.TargetDescription{target},
+		})
+		return err
+	})
+}
+
+// forEachTargetGroup will make a request for this instance to every target group, trying them all even when one fails
+func forEachTargetGroup(arns []string, action string,
+	request func(client elbv2iface.ELBV2API, arn string, target *elbv2.TargetDescription) error) error {
+
+	if len(arns) == 0 {
+		return nil
+	}
+	if err := ValidateTargetGroups(arns); err != nil {
+		return err
+	}
+	id, err := instanceID()
+	if err != nil {
+		return fmt.Errorf("error getting the instance id from the instance metadata [%v]", err)
+	}
+	target := &elbv2.TargetDescription{Id: aws.String(id)}
+	var failed []string
+	for _, arn := range arns {
+		r, _ := region(arn)
+		if err = request(newClient(r), arn, target); err != nil {
+			failed = append(failed, fmt.Sprintf("%s [%v]", arn, err))
+			continue
+		}
+		logger.Printf("%s instance %s with target group %s", action, id, arn)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("error updating the load balancer target groups: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// region returns the AWS region from the target group ARN e.g.
+// arn:aws:elasticloadbalancing:eu-west-2:111122223333:targetgroup/keto-api/73e2d6bc24d8a067
+func region(arn string) (string, error) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "elasticloadbalancing" || len(parts[3]) == 0 ||
+		!strings.HasPrefix(parts[5], "targetgroup/") {
+		return "", fmt.Errorf("invalid load balancer target group ARN %q", arn)
+	}
+	return parts[3], nil
+}
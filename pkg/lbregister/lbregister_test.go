@@ -0,0 +1,71 @@
+package lbregister
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
+)
+
+const targetGroup = "arn:aws:elasticloadbalancing:eu-west-2:111122223333:targetgroup/keto-api/73e2d6bc24d8a067"
+
+// fakeELB records the targets registered by target group
+type fakeELB struct {
+	elbv2iface.ELBV2API
+	region     string
+	registered map[string]string
+}
+
+func (f *fakeELB) RegisterTargets(in *elbv2.RegisterTargetsInput) (*elbv2.RegisterTargetsOutput, error) {
+	if aws.StringValue(in.TargetGroupArn) != targetGroup {
+		return nil, fmt.Errorf("TargetGroupNotFound")
+	}
+	f.registered[aws.StringValue(in.TargetGroupArn)] = aws.StringValue(in.Targets[0].Id)
+	return &elbv2.RegisterTargetsOutput{}, nil
+}
+
+func (f *fakeELB) DeregisterTargets(in *elbv2.DeregisterTargetsInput) (*elbv2.DeregisterTargetsOutput, error) {
+	delete(f.registered, aws.StringValue(in.TargetGroupArn))
+	return &elbv2.DeregisterTargetsOutput{}, nil
+}
+
+func TestValidateTargetGroups(t *testing.T) {
+	for arn, valid := range map[string]bool{
+		targetGroup: true,
+		"arn:aws:elasticloadbalancing:eu-west-2:111122223333:loadbalancer/app/keto-api/50dc6c495c0c9188": false,
+		"arn:aws:sns:eu-west-2:111122223333:alerts":                                                      false,
+		"keto-api": false,
+	} {
+		if err := ValidateTargetGroups([]string{arn}); (err == nil) != valid {
+			t.Errorf("expected %q valid %v but got %v", arn, valid, err)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	defer func(c func(string) elbv2iface.ELBV2API, i func() (string, error)) {
+		newClient, instanceID = c, i
+	}(newClient, instanceID)
+	elb := &fakeELB{registered: map[string]string{}}
+	newClient = func(region string) elbv2iface.ELBV2API {
+		elb.region = region
+		return elb
+	}
+	instanceID = func() (string, error) { return "i-0123456789", nil }
+
+	if err := Register([]string{targetGroup}); err != nil {
+		t.Fatal(err)
+	}
+	if elb.registered[targetGroup] != "i-0123456789" || elb.region != "eu-west-2" {
+		t.Errorf("expected the instance registered in eu-west-2 but got %v in %q", elb.registered, elb.region)
+	}
+	other := "arn:aws:elasticloadbalancing:eu-west-2:111122223333:targetgroup/other/73e2d6bc24d8a067"
+	if err := Register([]string{other, targetGroup}); err == nil {
+		t.Errorf("expected an error registering with a missing target group")
+	}
+	if err := Deregister([]string{targetGroup}); err != nil || len(elb.registered) != 0 {
+		t.Errorf("expected the instance deregistered but got %v [%v]", elb.registered, err)
+	}
+}
@@ -0,0 +1,70 @@
+package lock
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// DynamoDBKeyAttribute is the (string) partition key of the lock table
+const DynamoDBKeyAttribute = "LockKey"
+
+// dynamoDBLocker is a lock item in a DynamoDB table, obtained with a conditional write
+type dynamoDBLocker struct {
+	client  dynamodbiface.DynamoDBAPI
+	table   string
+	cluster string
+	now     func() time.Time
+}
+
+// newDynamoDB returns the locker for a table in the session region
+func newDynamoDB(sess *session.Session, table, cluster string) Locker {
+	return &dynamoDBLocker{client: dynamodb.New(sess), table: table, cluster: cluster, now: time.Now}
+}
+
+// item returns the lock item key
+func (l *dynamoDBLocker) item(key string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		DynamoDBKeyAttribute: {S: aws.String(l.cluster + "/" + key)},
+	}
+}
+
+// GetOrCreateLock writes the lock item unless it exists and hasn't expired
+func (l *dynamoDBLocker) GetOrCreateLock(key string, ttl time.Duration) (bool, error) {
+	now := l.now()
+	owner, _ := os.Hostname()
+	item := l.item(key)
+	item["Expires"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(now.Add(ttl).Unix(), 10))}
+	item["Owner"] = &dynamodb.AttributeValue{S: aws.String(owner)}
+	_, err := l.client.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String(l.table),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(" + DynamoDBKeyAttribute + ") OR Expires < :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		logger.Printf("Lock %s held in the %s table...", key, l.table)
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	logger.Printf("Lock %s obtained in the %s table...", key, l.table)
+	return true, nil
+}
+
+// Release deletes the lock item
+func (l *dynamoDBLocker) Release(key string) error {
+	_, err := l.client.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(l.table),
+		Key:       l.item(key),
+	})
+	return err
+}
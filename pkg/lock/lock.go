@@ -0,0 +1,122 @@
+package lock
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/etcd"
+	"github.com/UKHomeOffice/keto-k8/pkg/logging"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// The lock backends (see New)
+const (
+	BackendEtcd     = "etcd"
+	BackendDynamoDB = "dynamodb"
+	BackendS3       = "s3"
+)
+
+// Timeout for each request to an AWS lock backend
+var Timeout = 30 * time.Second
+
+// logger is used for all the lock logs
+var logger = logging.New("lock")
+
+// Locker obtains the lock electing the primary master, a lock is obtained by the first client or once the lock of
+// another client has expired (the TTL from when it was obtained)
+type Locker interface {
+	GetOrCreateLock(key string, ttl time.Duration) (mylock bool, err error)
+	Release(key string) error
+}
+
+// awsSession returns a session for the region (the region of the instance when not set)
+var awsSession = func(region string) (*session.Session, error) {
+	httpClient := &http.Client{Timeout: Timeout}
+	if len(region) == 0 {
+		var err error
+		if region, err = ec2metadata.New(session.New(&aws.Config{HTTPClient: httpClient})).Region(); err != nil {
+			return nil, fmt.Errorf("lock region not set and not found in the instance metadata [%v]", err)
+		}
+	}
+	return session.New(&aws.Config{
+		Region:     aws.String(region),
+		HTTPClient: httpClient,
+	}), nil
+}
+
+// Validate will check the lock backend is known e.g. etcd (or empty), dynamodb://<table> or s3://<bucket>[/<prefix>]
+// (both with an optional ?region=<region>)
+func Validate(backend string) error {
+	_, err := parse(backend)
+	return err
+}
+
+// New returns the locker for a backend (see Validate), the etcd client is used for the etcd backend and the keys are
+// prefixed with the cluster name in the AWS backends (so a table or bucket can be shared by clusters)
+func New(backend string, client etcd.Clienter, cluster string) (Locker, error) {
+	u, err := parse(backend)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return Etcd(client), nil
+	}
+	sess, err := awsSession(u.Query().Get("region"))
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case BackendDynamoDB:
+		return newDynamoDB(sess, u.Host, cluster), nil
+	default:
+		return newS3(sess, u.Host, strings.Trim(u.Path, "/"), cluster), nil
+	}
+}
+
+// parse returns the AWS backend location (nil for etcd)
+func parse(backend string) (*url.URL, error) {
+	if len(backend) == 0 || backend == BackendEtcd {
+		return nil, nil
+	}
+	u, err := url.Parse(backend)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lock backend %q [%v]", backend, err)
+	}
+	switch u.Scheme {
+	case BackendDynamoDB:
+		if len(u.Host) == 0 || len(strings.Trim(u.Path, "/")) > 0 {
+			return nil, fmt.Errorf("invalid lock backend %q, expected %s://<table>", backend, BackendDynamoDB)
+		}
+	case BackendS3:
+		if len(u.Host) == 0 {
+			return nil, fmt.Errorf("invalid lock backend %q, expected %s://<bucket>[/<prefix>]", backend, BackendS3)
+		}
+	default:
+		return nil, fmt.Errorf("unknown lock backend %q (expected %s, %s://<table> or %s://<bucket>)",
+			backend, BackendEtcd, BackendDynamoDB, BackendS3)
+	}
+	return u, nil
+}
+
+// etcdLocker is the lock in the etcd used by the masters
+type etcdLocker struct {
+	client etcd.Clienter
+}
+
+// Etcd returns the locker using the etcd client
+func Etcd(client etcd.Clienter) Locker {
+	return &etcdLocker{client: client}
+}
+
+func (l *etcdLocker) GetOrCreateLock(key string, ttl time.Duration) (bool, error) {
+	return l.client.GetOrCreateLock(key, ttl)
+}
+
+func (l *etcdLocker) Release(key string) error {
+	return l.client.Delete(key)
+}
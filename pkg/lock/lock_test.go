@@ -0,0 +1,152 @@
+package lock
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+func TestValidate(t *testing.T) {
+	for backend, valid := range map[string]bool{
+		"":                                       true,
+		"etcd":                                   true,
+		"dynamodb://keto-locks":                  true,
+		"dynamodb://keto-locks?region=eu-west-2": true,
+		"s3://keto-locks":                        true,
+		"s3://keto-locks/clusters":               true,
+		"dynamodb://":                            false,
+		"dynamodb://keto-locks/clusters":         false,
+		"s3:///clusters":                         false,
+		"consul://keto-locks":                    false,
+	} {
+		if err := Validate(backend); (err == nil) != valid {
+			t.Errorf("expected %q valid %v but got %v", backend, valid, err)
+		}
+	}
+}
+
+// fakeDynamoDB evaluates the lock condition against the items in memory
+type fakeDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+	items map[string]map[string]*dynamodb.AttributeValue
+}
+
+func (f *fakeDynamoDB) PutItem(in *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	key := aws.StringValue(in.Item[DynamoDBKeyAttribute].S)
+	if existing, ok := f.items[key]; ok {
+		expires, _ := strconv.ParseInt(aws.StringValue(existing["Expires"].N), 10, 64)
+		now, _ := strconv.ParseInt(aws.StringValue(in.ExpressionAttributeValues[":now"].N), 10, 64)
+		if expires >= now {
+			return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+		}
+	}
+	f.items[key] = in.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) DeleteItem(in *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	delete(f.items, aws.StringValue(in.Key[DynamoDBKeyAttribute].S))
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func TestDynamoDBLock(t *testing.T) {
+	now := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	fake := &fakeDynamoDB{items: map[string]map[string]*dynamodb.AttributeValue{}}
+	l := &dynamoDBLocker{client: fake, table: "keto-locks", cluster: "dev", now: func() time.Time { return now }}
+
+	testLocker(t, l, func(d time.Duration) { now = now.Add(d) })
+	if _, ok := fake.items["dev/kmm-asset-lock"]; ok {
+		t.Error("expected the lock item to be released")
+	}
+}
+
+// fakeS3 keeps every version of the objects written
+type fakeS3 struct {
+	s3iface.S3API
+	now      func() time.Time
+	versions []*s3.ObjectVersion
+	next     int
+}
+
+func (f *fakeS3) PutObject(in *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	if aws.StringValue(in.ObjectLockMode) != s3.ObjectLockModeGovernance || len(aws.StringValue(in.ContentMD5)) == 0 {
+		return nil, fmt.Errorf("expected a retained object with the MD5")
+	}
+	if _, err := ioutil.ReadAll(in.Body); err != nil {
+		return nil, err
+	}
+	f.next++
+	version := fmt.Sprintf("v%03d", f.next)
+	f.versions = append(f.versions, &s3.ObjectVersion{
+		Key:          in.Key,
+		VersionId:    aws.String(version),
+		LastModified: aws.Time(f.now()),
+	})
+	return &s3.PutObjectOutput{VersionId: aws.String(version)}, nil
+}
+
+func (f *fakeS3) ListObjectVersionsPages(in *s3.ListObjectVersionsInput, fn func(*s3.ListObjectVersionsOutput, bool) bool) error {
+	// The newest versions are listed first
+	versions := append([]*s3.ObjectVersion{}, f.versions...)
+	sort.Slice(versions, func(i, j int) bool {
+		return aws.StringValue(versions[i].VersionId) > aws.StringValue(versions[j].VersionId)
+	})
+	fn(&s3.ListObjectVersionsOutput{Versions: versions}, true)
+	return nil
+}
+
+func (f *fakeS3) DeleteObject(in *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	if !aws.BoolValue(in.BypassGovernanceRetention) {
+		return nil, fmt.Errorf("AccessDenied")
+	}
+	for i, v := range f.versions {
+		if aws.StringValue(v.VersionId) == aws.StringValue(in.VersionId) {
+			f.versions = append(f.versions[:i], f.versions[i+1:]...)
+			break
+		}
+	}
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func TestS3Lock(t *testing.T) {
+	now := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	fake := &fakeS3{now: clock}
+	l := &s3Locker{client: fake, bucket: "keto-locks", prefix: "clusters", cluster: "dev", now: clock}
+	if object := l.object("kmm-asset-lock"); object != "clusters/dev/kmm-asset-lock" {
+		t.Errorf("unexpected lock object %s", object)
+	}
+
+	testLocker(t, l, func(d time.Duration) { now = now.Add(d) })
+	if len(fake.versions) != 0 {
+		t.Errorf("expected every lock version to be released but got %d", len(fake.versions))
+	}
+}
+
+// testLocker checks a lock is obtained once until it expires (advancing the clock) or is released
+func testLocker(t *testing.T, l Locker, advance func(time.Duration)) {
+	if mylock, err := l.GetOrCreateLock("kmm-asset-lock", time.Minute); err != nil || !mylock {
+		t.Fatalf("expected the lock to be obtained but got %v [%v]", mylock, err)
+	}
+	advance(30 * time.Second)
+	if mylock, err := l.GetOrCreateLock("kmm-asset-lock", time.Minute); err != nil || mylock {
+		t.Fatalf("expected the lock to be held but got %v [%v]", mylock, err)
+	}
+	advance(time.Minute)
+	if mylock, err := l.GetOrCreateLock("kmm-asset-lock", time.Minute); err != nil || !mylock {
+		t.Fatalf("expected the expired lock to be obtained but got %v [%v]", mylock, err)
+	}
+	if err := l.Release("kmm-asset-lock"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,134 @@
+package lock
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// s3Locker is a lock object in a bucket with versioning and object lock enabled, S3 has no conditional writes so every
+// client writes a version (retained until it expires) and the earliest version which hasn't expired holds the lock
+type s3Locker struct {
+	client  s3iface.S3API
+	bucket  string
+	prefix  string
+	cluster string
+	now     func() time.Time
+}
+
+// newS3 returns the locker for a bucket in the session region
+func newS3(sess *session.Session, bucket, prefix, cluster string) Locker {
+	return &s3Locker{client: s3.New(sess), bucket: bucket, prefix: prefix, cluster: cluster, now: time.Now}
+}
+
+// object returns the lock object name
+func (l *s3Locker) object(key string) string {
+	return path.Join(l.prefix, l.cluster, key)
+}
+
+// GetOrCreateLock writes a lock version and checks it's the earliest version which hasn't expired, a version which
+// didn't obtain the lock is removed so it can't hold the lock once the earlier one expires
+func (l *s3Locker) GetOrCreateLock(key string, ttl time.Duration) (bool, error) {
+	object := l.object(key)
+	expires := l.now().Add(ttl).UTC()
+	body := expires.Format(time.RFC3339)
+	sum := md5.Sum([]byte(body))
+	out, err := l.client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(l.bucket),
+		Key:    aws.String(object),
+		Body:   strings.NewReader(body),
+		// Object lock requests must have the MD5
+		ContentMD5:                aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+		ObjectLockMode:            aws.String(s3.ObjectLockModeGovernance),
+		ObjectLockRetainUntilDate: aws.Time(expires),
+	})
+	if err != nil {
+		return false, err
+	}
+	version := aws.StringValue(out.VersionId)
+	if len(version) == 0 {
+		return false, fmt.Errorf("the lock bucket %s must have versioning and object lock enabled", l.bucket)
+	}
+	versions, err := l.versions(object)
+	if err != nil {
+		return false, err
+	}
+	var holder *s3.ObjectVersion
+	for _, v := range versions {
+		if !aws.TimeValue(v.LastModified).Add(ttl).After(l.now()) && aws.StringValue(v.VersionId) != version {
+			continue
+		}
+		if holder == nil || earlier(v, holder) {
+			holder = v
+		}
+	}
+	if holder != nil && aws.StringValue(holder.VersionId) == version {
+		logger.Printf("Lock %s obtained in the %s bucket...", key, l.bucket)
+		return true, nil
+	}
+	logger.Printf("Lock %s held in the %s bucket...", key, l.bucket)
+	if err = l.deleteVersion(object, version); err != nil {
+		logger.Warnf("Failed to remove the lock version %s (it's retained until %s): %v", version, body, err)
+	}
+	return false, nil
+}
+
+// Release deletes every lock version
+func (l *s3Locker) Release(key string) error {
+	object := l.object(key)
+	versions, err := l.versions(object)
+	if err != nil {
+		return err
+	}
+	for _, v := range versions {
+		if err = l.deleteVersion(object, aws.StringValue(v.VersionId)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// versions returns the versions of the lock object
+func (l *s3Locker) versions(object string) ([]*s3.ObjectVersion, error) {
+	var versions []*s3.ObjectVersion
+	err := l.client.ListObjectVersionsPages(&s3.ListObjectVersionsInput{
+		Bucket: aws.String(l.bucket),
+		Prefix: aws.String(object),
+	}, func(page *s3.ListObjectVersionsOutput, last bool) bool {
+		for _, v := range page.Versions {
+			if aws.StringValue(v.Key) == object {
+				versions = append(versions, v)
+			}
+		}
+		return true
+	})
+	return versions, err
+}
+
+// deleteVersion removes a lock version before it has expired (needs s3:BypassGovernanceRetention)
+func (l *s3Locker) deleteVersion(object, version string) error {
+	_, err := l.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket:                    aws.String(l.bucket),
+		Key:                       aws.String(object),
+		VersionId:                 aws.String(version),
+		BypassGovernanceRetention: aws.Bool(true),
+	})
+	return err
+}
+
+// earlier is true when a version was written before another (the version ids decide when written in the same second)
+func earlier(a, b *s3.ObjectVersion) bool {
+	at, bt := aws.TimeValue(a.LastModified), aws.TimeValue(b.LastModified)
+	if !at.Equal(bt) {
+		return at.Before(bt)
+	}
+	return aws.StringValue(a.VersionId) < aws.StringValue(b.VersionId)
+}
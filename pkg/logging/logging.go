@@ -0,0 +1,206 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// The fields set on every log entry (when known)
+const (
+	ComponentField = "component"
+	PhaseField     = "phase"
+	ClusterField   = "cluster"
+	NodeField      = "node"
+)
+
+var (
+	mu      sync.Mutex
+	fields  = log.Fields{}
+	levels  = map[string]log.Level{}
+	loggers = map[string]*log.Logger{}
+)
+
+// Logger logs for a component (package) with the shared fields
+type Logger struct {
+	component string
+}
+
+// New returns the logger for a component e.g. "etcd"
+func New(component string) *Logger {
+	return &Logger{component: component}
+}
+
+// SetCluster sets the cluster field for all components
+func SetCluster(name string) {
+	setField(ClusterField, name)
+}
+
+// SetNode sets the node field for all components
+func SetNode(name string) {
+	setField(NodeField, name)
+}
+
+// SetPhase sets the current bootstrap phase for all components
+func SetPhase(phase string) {
+	setField(PhaseField, phase)
+}
+
+// SetLevels parses and sets the default and per component levels
+// e.g. "info" or "warn,etcd=debug,kmm=info"
+func SetLevels(spec string) error {
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		component := ""
+		value := item
+		if parts := strings.SplitN(item, "=", 2); len(parts) == 2 {
+			component, value = parts[0], parts[1]
+		}
+		level, err := log.ParseLevel(value)
+		if err != nil {
+			return fmt.Errorf("invalid log level %q: %v", item, err)
+		}
+		SetLevel(component, level)
+	}
+	return nil
+}
+
+// SetLevel sets the level for a component (or the default level when the component is empty)
+func SetLevel(component string, level log.Level) {
+	mu.Lock()
+	defer mu.Unlock()
+	if component == "" {
+		log.SetLevel(level)
+	} else {
+		levels[component] = level
+	}
+	for name, componentLogger := range loggers {
+		componentLogger.Level = componentLevel(name)
+	}
+}
+
+// SetOutput sets where all the components log to
+func SetOutput(out io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	log.SetOutput(out)
+	for _, componentLogger := range loggers {
+		componentLogger.Out = out
+	}
+}
+
+// SetFormatter sets how all the components format log entries
+func SetFormatter(formatter log.Formatter) {
+	mu.Lock()
+	defer mu.Unlock()
+	log.SetFormatter(formatter)
+	for _, componentLogger := range loggers {
+		componentLogger.Formatter = formatter
+	}
+}
+
+// Fields returns a copy of the shared fields
+func Fields() log.Fields {
+	mu.Lock()
+	defer mu.Unlock()
+	copied := log.Fields{}
+	for k, v := range fields {
+		copied[k] = v
+	}
+	return copied
+}
+
+// Entry returns a log entry for the component with the shared fields
+func (l *Logger) Entry() *log.Entry {
+	entryFields := Fields()
+	entryFields[ComponentField] = l.component
+	return log.NewEntry(l.logger()).WithFields(entryFields)
+}
+
+// WithField returns a log entry with an extra field
+func (l *Logger) WithField(key string, value interface{}) *log.Entry {
+	return l.Entry().WithField(key, value)
+}
+
+// WithFields returns a log entry with extra fields
+func (l *Logger) WithFields(extra log.Fields) *log.Entry {
+	return l.Entry().WithFields(extra)
+}
+
+// Debugf logs at debug level
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.Entry().Debugf(format, args...)
+}
+
+// Printf logs at info level
+func (l *Logger) Printf(format string, args ...interface{}) {
+	l.Entry().Printf(format, args...)
+}
+
+// Infof logs at info level
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.Entry().Infof(format, args...)
+}
+
+// Warnf logs at warning level
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.Entry().Warnf(format, args...)
+}
+
+// Errorf logs at error level
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.Entry().Errorf(format, args...)
+}
+
+// Fatal logs at fatal level and exits
+func (l *Logger) Fatal(args ...interface{}) {
+	l.Entry().Fatal(args...)
+}
+
+// Fatalf logs at fatal level and exits
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	l.Entry().Fatalf(format, args...)
+}
+
+// logger returns the logrus logger for the component, created with the output, formatter and level when first used
+// and only changed by SetOutput, SetFormatter and SetLevel (the component loggers only add fields when logging)
+func (l *Logger) logger() *log.Logger {
+	mu.Lock()
+	defer mu.Unlock()
+	componentLogger, ok := loggers[l.component]
+	if !ok {
+		std := log.StandardLogger()
+		componentLogger = &log.Logger{
+			Out:       std.Out,
+			Formatter: std.Formatter,
+			Hooks:     std.Hooks,
+			Level:     componentLevel(l.component),
+		}
+		loggers[l.component] = componentLogger
+	}
+	return componentLogger
+}
+
+// componentLevel returns the level set for a component or the default level (mu must be held)
+func componentLevel(component string) log.Level {
+	if level, ok := levels[component]; ok {
+		return level
+	}
+	return log.GetLevel()
+}
+
+func setField(key, value string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if value == "" {
+		delete(fields, key)
+		return
+	}
+	fields[key] = value
+}
@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func TestLevelsAndFields(t *testing.T) {
+	var b bytes.Buffer
+	SetOutput(&b)
+	defer SetOutput(os.Stderr)
+	SetFormatter(&log.TextFormatter{DisableTimestamp: true, DisableSorting: false})
+
+	if err := SetLevels("warn,etcd=debug"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetLevels("info")
+	SetCluster("test")
+	defer SetCluster("")
+
+	New("etcd").Debugf("etcd debug")
+	New("kmm").Infof("kmm info")
+
+	out := b.String()
+	if !strings.Contains(out, "etcd debug") || !strings.Contains(out, "component=etcd") {
+		t.Errorf("expected etcd debug message with component field but got:\n%s", out)
+	}
+	if !strings.Contains(out, "cluster=test") {
+		t.Errorf("expected cluster field but got:\n%s", out)
+	}
+	if strings.Contains(out, "kmm info") {
+		t.Errorf("didn't expect kmm info message at warn level but got:\n%s", out)
+	}
+}
+
+func TestSetLevelsInvalid(t *testing.T) {
+	if err := SetLevels("etcd=loud"); err == nil {
+		t.Error("expected an error for an invalid level")
+	}
+}
+
+func TestConcurrentLogging(t *testing.T) {
+	var b bytes.Buffer
+	SetOutput(ioutil.Discard)
+	defer SetOutput(os.Stderr)
+
+	// Logging from many goroutines only reads the component loggers (run with -race)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			New("etcd").Printf("concurrent")
+			New("kmm").WithField("step", "cloud").Printf("concurrent")
+		}()
+	}
+	wg.Wait()
+
+	SetOutput(&b)
+	SetLevel("kmm", log.WarnLevel)
+	defer SetLevels("info,kmm=info")
+	New("kmm").Infof("kmm info")
+	New("etcd").Infof("etcd info")
+	if out := b.String(); strings.Contains(out, "kmm info") || !strings.Contains(out, "etcd info") {
+		t.Errorf("expected the level and output to change for the existing component loggers but got:\n%s", out)
+	}
+}
@@ -21,6 +21,11 @@ func (fnp *CanalNetworkProvider) PodNetworkCidr() string {
 }
 
 // Create - will create the K8 network resources (Canal)
-func (fnp *CanalNetworkProvider) Create() (error) {
-	return renderandDeploy(canalPodCidr, canalYaml)
+func (fnp *CanalNetworkProvider) Create(opts Options) (error) {
+	return renderandDeploy(fnp.Name(), canalPodCidr, canalYaml, opts)
+}
+
+// Render - will return the K8 network resources (Canal)
+func (fnp *CanalNetworkProvider) Render(opts Options) (string, error) {
+	return renderResources(canalPodCidr, canalYaml, opts)
 }
@@ -20,7 +20,17 @@ func (fnp *FlannelNetworkProvider) PodNetworkCidr() string {
 	return flannelPodCidr
 }
 
+// Plugins - will return the plugins Flannel delegates to (installed with the bridge and host-local plugins)
+func (fnp *FlannelNetworkProvider) Plugins() []string {
+	return []string{"flannel"}
+}
+
 // Create - will create the K8 network resources
-func (fnp *FlannelNetworkProvider) Create() (error) {
-	return renderandDeploy(flannelPodCidr, flannelYaml)
+func (fnp *FlannelNetworkProvider) Create(opts Options) (error) {
+	return renderandDeploy(fnp.Name(), flannelPodCidr, flannelYaml, opts)
+}
+
+// Render - will return the K8 network resources
+func (fnp *FlannelNetworkProvider) Render(opts Options) (string, error) {
+	return renderResources(flannelPodCidr, flannelYaml, opts)
 }
@@ -1,52 +1,95 @@
 package network
 
 import (
-	"bytes"
 	"fmt"
+	"sort"
 	"strings"
-	"text/template"
 
+	"github.com/UKHomeOffice/keto-k8/pkg/images"
 	"github.com/UKHomeOffice/keto-k8/pkg/k8client"
+	"github.com/UKHomeOffice/keto-k8/pkg/placement"
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+	"github.com/UKHomeOffice/keto-k8/pkg/priority"
+	"github.com/UKHomeOffice/keto-k8/pkg/rbac"
+	"github.com/UKHomeOffice/keto-k8/pkg/secprofile"
+	"github.com/UKHomeOffice/keto-k8/pkg/render"
 	log "github.com/Sirupsen/logrus"
 )
 
+// Options are cluster settings applied to the resources of every network provider
+type Options struct {
+	KubeVersion	string
+	// Values are made available to the provider templates e.g. {{ .Values.image }}
+	Values		map[string]interface{}
+	// Client applies the resources (defaults to kubectl)
+	Client		k8client.Clienter
+	// ImageDigests pin the provider images (by name:tag) to a digest
+	ImageDigests	map[string]string
+}
+
 // Provider is an abstract interface for Network.
 type Provider interface {
 	Name() string
-	Create() error
+	Create(opts Options) error
+	// Render returns the resources Create would deploy (without deploying anything)
+	Render(opts Options) (string, error)
 	PodNetworkCidr() string
 }
 
 // ProviderFactory - Interface definition for a network.provider implementation
 type ProviderFactory func() (Provider)
 
-// Factories - a map of provider creation factory implementations stored by name
-var Factories = make(map[string]ProviderFactory)
+// Registry - a map of provider creation factory implementations stored by name
+type Registry map[string]ProviderFactory
 
-// Register - will register a new network.Provider
+// Factories - the default registry with all the built in providers
+var Factories = make(Registry)
+
+// Register - will register a new network.Provider (in the default registry)
 func Register(factory ProviderFactory) {
+	Factories.Register(factory)
+}
+
+// CreateProvider - will return a network.Provider implementation from a name (from the default registry)
+func CreateProvider(networkProvider string) (Provider, error) {
+	return Factories.CreateProvider(networkProvider)
+}
+
+// NewRegistry - will return a registry with all the default providers (to add custom providers to)
+func NewRegistry() Registry {
+	r := make(Registry)
+	for name, factory := range Factories {
+		r[name] = factory
+	}
+	return r
+}
+
+// Register - will register a new network.Provider
+func (r Registry) Register(factory ProviderFactory) {
 
 	if factory == nil {
 		log.Panicf("NetworkProvider factory does not exist.")
 	}
 	name := factory().Name()
-	_, registered := Factories[name]
+	_, registered := r[name]
 	if registered {
 		log.Errorf("Datastore factory %s already registered. Ignoring.", name)
+		return
 	}
-	Factories[name] = factory
+	r[name] = factory
 }
 
 // CreateProvider - will return a network.Provider implementation from a name
-func CreateProvider(networkProvider string) (Provider, error) {
-	networkProviderFactory, ok := Factories[networkProvider]
+func (r Registry) CreateProvider(networkProvider string) (Provider, error) {
+	networkProviderFactory, ok := r[networkProvider]
 	if !ok {
 		// Factory has not been registered.
 		// Make a list of all available datastore factories for logging.
-		availableProviders := make([]string, len(Factories))
-		for k := range Factories {
+		availableProviders := []string{}
+		for k := range r {
 			availableProviders = append(availableProviders, k)
 		}
+		sort.Strings(availableProviders)
 		return nil,
 			fmt.Errorf("Invalid NetworkProvider name. Must be one of: %s", strings.Join(availableProviders, ", "))
 	}
@@ -60,26 +103,49 @@ func init() {
 	Register(NewCanalNetworkProvider)
 }
 
-func renderandDeploy(podNetworkCidr, cniYaml string) (error) {
-	k8Definition, err := renderCniYaml(podNetworkCidr, cniYaml)
+func renderandDeploy(name, podNetworkCidr, cniYaml string, opts Options) (error) {
+	resources, err := renderResources(podNetworkCidr, cniYaml, opts)
 	if err != nil {
 		return err
 	}
-	return k8client.Apply(string(k8Definition[:]))
+	objs, err := podspec.Decode(resources)
+	if err != nil {
+		return err
+	}
+	if err = rbac.Save(name, objs); err != nil {
+		return err
+	}
+	return k8client.Or(opts.Client).Apply(resources)
+}
+
+// renderResources returns the resources for a network with all keto changes
+func renderResources(podNetworkCidr, cniYaml string, opts Options) (string, error) {
+	k8Definition, err := renderCniYaml(podNetworkCidr, cniYaml, opts.Values)
+	if err != nil {
+		return "", err
+	}
+	place, err := placement.For(opts.Values)
+	if err != nil {
+		return "", err
+	}
+	// The CNI pods must survive node pressure
+	return podspec.Transform(
+		string(k8Definition[:]),
+		priority.Mutator(opts.KubeVersion, priority.NodeCritical),
+		secprofile.Mutator(opts.KubeVersion),
+		images.PinMutator(opts.ImageDigests),
+		place.Mutator())
 }
 
 // Grab the resources for deploying a network
-func renderCniYaml(podNetworkCidr, cniYaml string) ([]byte, error) {
+func renderCniYaml(podNetworkCidr, cniYaml string, values map[string]interface{}) ([]byte, error) {
 	data := struct {
 		Network	string
+		Values	map[string]interface{}
 	}{
 		Network: podNetworkCidr,
+		Values:  values,
 	}
-	t := template.Must(template.New("cniYaml").Parse(cniYaml))
-	var b bytes.Buffer
-	if err := t.Execute(&b, data); err != nil {
-		return b.Bytes(), err
-	}
-
-	return b.Bytes(), nil
+	cni, err := render.Template("cniYaml", cniYaml, data)
+	return []byte(cni), err
 }
@@ -0,0 +1,252 @@
+package network
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+	"github.com/UKHomeOffice/keto-k8/pkg/logging"
+)
+
+// logger is used for all the network logs
+var logger = logging.New("network")
+
+// DefaultPluginsURL is the CNI plugins release installed by default (the checksum is published alongside it)
+const DefaultPluginsURL = "https://github.com/containernetworking/plugins/releases/download/v0.7.1/cni-plugins-amd64-v0.7.1.tgz"
+
+// PluginsDir is where the kubelet finds the CNI plugin binaries
+var PluginsDir = "/opt/cni/bin"
+
+// PluginsTimeout for downloading the CNI plugins (and the published checksum)
+var PluginsTimeout = 5 * time.Minute
+
+// BasePlugins are installed for every network provider (the kubelet needs loopback even with a provider)
+var BasePlugins = []string{"loopback", "bridge", "host-local", "portmap"}
+
+// pluginsMarker records the archive checksum and plugins installed (so they're only installed once per archive)
+const pluginsMarker = ".keto-plugins"
+
+// PluginLister is implemented by the providers whose pods expect more plugins on the host than the BasePlugins
+// (providers which install their own plugins don't need to)
+type PluginLister interface {
+	Plugins() []string
+}
+
+// Plugins is a CNI plugins archive (a .tgz of the plugin binaries) and the plugins to install from it
+type Plugins struct {
+	URL string
+	// SHA256 is the archive checksum (the published <URL>.sha256 is used when empty)
+	SHA256 string
+	Names  []string
+}
+
+// PluginNames returns the base plugins and any the provider expects on the host
+func PluginNames(provider Provider) []string {
+	names := append([]string{}, BasePlugins...)
+	if lister, ok := provider.(PluginLister); ok {
+		for _, name := range lister.Plugins() {
+			if !containsString(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// Validate will check the archive can be fetched and the checksum (when set) is a sha256
+func (p Plugins) Validate() error {
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return fmt.Errorf("invalid CNI plugins url %q [%v]", p.URL, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "file":
+	default:
+		return fmt.Errorf("invalid CNI plugins url %q, expected a http(s):// or file:// url", p.URL)
+	}
+	if len(p.SHA256) > 0 {
+		if b, err := hex.DecodeString(p.SHA256); err != nil || len(b) != sha256.Size {
+			return fmt.Errorf("invalid CNI plugins sha256 %q, expected %d hex characters", p.SHA256, sha256.Size*2)
+		}
+	}
+	return nil
+}
+
+// fetch returns the content at a url (replaced in tests)
+var fetch = func(location string) (io.ReadCloser, error) {
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	transport.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+	resp, err := (&http.Client{Transport: transport, Timeout: PluginsTimeout}).Get(location)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s fetching %s", resp.Status, location)
+	}
+	return resp.Body, nil
+}
+
+// Install will download the archive, verify its checksum and extract the plugins into the PluginsDir
+// It's safe to re-run (e.g. on every boot) as nothing is downloaded when the plugins from the archive are installed
+func (p Plugins) Install() error {
+	sum, err := p.checksum()
+	if err != nil {
+		return err
+	}
+	names := append([]string{}, p.Names...)
+	sort.Strings(names)
+	marker := sum + " " + strings.Join(names, ",") + "\n"
+	if p.installed(marker) {
+		logger.Printf("CNI plugins already installed in %s", PluginsDir)
+		return nil
+	}
+	if err = os.MkdirAll(PluginsDir, 0755); err != nil {
+		return err
+	}
+	archive, err := p.download(sum)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		archive.Close()
+		os.Remove(archive.Name())
+	}()
+	if err = extractPlugins(archive, names); err != nil {
+		return fmt.Errorf("error extracting the CNI plugins from %s [%v]", p.URL, err)
+	}
+	logger.Printf("Installed the CNI plugins (%s) in %s", strings.Join(names, ", "), PluginsDir)
+	return fileutil.WriteFile(filepath.Join(PluginsDir, pluginsMarker), []byte(marker), 0644)
+}
+
+// checksum returns the expected archive sha256 (fetching the published checksum when not set)
+func (p Plugins) checksum() (string, error) {
+	if len(p.SHA256) > 0 {
+		return strings.ToLower(p.SHA256), nil
+	}
+	body, err := fetch(p.URL + ".sha256")
+	if err != nil {
+		return "", fmt.Errorf("no CNI plugins sha256 set and the published checksum can't be fetched [%v]", err)
+	}
+	defer body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(body, 1024))
+	if err != nil {
+		return "", err
+	}
+	// The same format as sha256sum i.e. <sum>  <file>
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty CNI plugins checksum at %s.sha256", p.URL)
+	}
+	published := Plugins{URL: p.URL, SHA256: fields[0]}
+	if err = published.Validate(); err != nil {
+		return "", err
+	}
+	return strings.ToLower(fields[0]), nil
+}
+
+// installed is true when every plugin exists and was installed from the same archive
+func (p Plugins) installed(marker string) bool {
+	data, err := ioutil.ReadFile(filepath.Join(PluginsDir, pluginsMarker))
+	if err != nil || string(data) != marker {
+		return false
+	}
+	for _, name := range p.Names {
+		if !fileutil.ExistFile(filepath.Join(PluginsDir, name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// download saves the archive to a temporary file, it's only returned when it matches the checksum
+func (p Plugins) download(sum string) (*os.File, error) {
+	body, err := fetch(p.URL)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading the CNI plugins [%v]", err)
+	}
+	defer body.Close()
+	archive, err := ioutil.TempFile(PluginsDir, ".download")
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(archive, hash), body); err == nil {
+		if actual := hex.EncodeToString(hash.Sum(nil)); actual != sum {
+			err = fmt.Errorf("the CNI plugins from %s have the sha256 %s, expected %s", p.URL, actual, sum)
+		}
+	}
+	if err == nil {
+		_, err = archive.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		archive.Close()
+		os.Remove(archive.Name())
+		return nil, err
+	}
+	return archive, nil
+}
+
+// extractPlugins writes the named plugins from a .tgz into the PluginsDir (all must be found)
+func extractPlugins(archive io.Reader, names []string) error {
+	gz, err := gzip.NewReader(archive)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	found := map[string]bool{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Base(hdr.Name)
+		if hdr.Typeflag != tar.TypeReg || !containsString(names, name) {
+			continue
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		if err = fileutil.WriteFile(filepath.Join(PluginsDir, name), data, 0755); err != nil {
+			return err
+		}
+		found[name] = true
+	}
+	missing := []string{}
+	for _, name := range names {
+		if !found[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("plugins not in the archive: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
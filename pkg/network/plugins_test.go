@@ -0,0 +1,129 @@
+package network
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// pluginsArchive returns a .tgz with a binary for each plugin (in a directory like the releases)
+func pluginsArchive(t *testing.T, names ...string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		data := []byte("#!/bin/sh\necho " + name + "\n")
+		if err := tw.WriteHeader(&tar.Header{Name: "./" + name, Mode: 0755, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPluginNames(t *testing.T) {
+	flannel, _ := CreateProvider("flannel")
+	if names := PluginNames(flannel); !reflect.DeepEqual(names, []string{"loopback", "bridge", "host-local", "portmap", "flannel"}) {
+		t.Errorf("unexpected flannel plugins %v", names)
+	}
+	weave, _ := CreateProvider("weave")
+	if names := PluginNames(weave); !reflect.DeepEqual(names, BasePlugins) {
+		t.Errorf("unexpected weave plugins %v", names)
+	}
+}
+
+func TestPluginsValidate(t *testing.T) {
+	for _, p := range []struct {
+		plugins Plugins
+		valid   bool
+	}{
+		{Plugins{URL: DefaultPluginsURL}, true},
+		{Plugins{URL: "file:///var/lib/cni-plugins.tgz", SHA256: fmt.Sprintf("%064x", 1)}, true},
+		{Plugins{URL: "ftp://example.com/cni-plugins.tgz"}, false},
+		{Plugins{URL: DefaultPluginsURL, SHA256: "abc"}, false},
+	} {
+		if err := p.plugins.Validate(); (err == nil) != p.valid {
+			t.Errorf("expected %+v valid %v but got %v", p.plugins, p.valid, err)
+		}
+	}
+}
+
+func TestPluginsInstall(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cni")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(d string, f func(string) (io.ReadCloser, error)) { PluginsDir, fetch = d, f }(PluginsDir, fetch)
+	PluginsDir = dir
+
+	archive := pluginsArchive(t, "loopback", "bridge", "flannel", "vlan")
+	sum := sha256.Sum256(archive)
+	downloads := 0
+	fetch = func(location string) (io.ReadCloser, error) {
+		switch location {
+		case "https://example.com/cni-plugins.tgz":
+			downloads++
+			return ioutil.NopCloser(bytes.NewReader(archive)), nil
+		case "https://example.com/cni-plugins.tgz.sha256":
+			return ioutil.NopCloser(bytes.NewBufferString(hex.EncodeToString(sum[:]) + "  cni-plugins.tgz\n")), nil
+		}
+		return nil, fmt.Errorf("unexpected url %s", location)
+	}
+
+	p := Plugins{URL: "https://example.com/cni-plugins.tgz", Names: []string{"loopback", "bridge", "flannel"}}
+	for i := 0; i < 2; i++ {
+		if err = p.Install(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if downloads != 1 {
+		t.Errorf("expected the installed plugins to be downloaded once but got %d", downloads)
+	}
+	for _, name := range p.Names {
+		if info, err := os.Stat(filepath.Join(dir, name)); err != nil || info.Mode().Perm() != 0755 {
+			t.Errorf("expected the %s plugin to be installed executable [%v]", name, err)
+		}
+	}
+	if _, err = os.Stat(filepath.Join(dir, "vlan")); !os.IsNotExist(err) {
+		t.Error("expected only the named plugins to be installed")
+	}
+
+	// A plugin removed from the host is re-installed
+	os.Remove(filepath.Join(dir, "flannel"))
+	if err = p.Install(); err != nil || downloads != 2 {
+		t.Errorf("expected the missing plugin to be re-installed but got %d downloads [%v]", downloads, err)
+	}
+
+	p.Names = append(p.Names, "portmap")
+	if err = p.Install(); err == nil {
+		t.Error("expected an error installing a plugin not in the archive")
+	}
+
+	p.SHA256 = fmt.Sprintf("%064x", 1)
+	os.Remove(filepath.Join(dir, pluginsMarker))
+	if err = p.Install(); err == nil {
+		t.Error("expected an error installing an archive with the wrong checksum")
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, ".download*"))
+	if len(files) > 0 {
+		t.Errorf("expected the downloads to be removed but found %v", files)
+	}
+}
@@ -93,6 +93,9 @@ spec:
       hostNetwork: true
       nodeSelector:
         beta.kubernetes.io/arch: amd64
+{{- if .Values.nodeSelector }}
+{{ toYaml .Values.nodeSelector | indent 8 }}
+{{- end }}
       tolerations:
       - key: node-role.kubernetes.io/master
         operator: Exists
@@ -100,7 +103,7 @@ spec:
       serviceAccountName: flannel
       containers:
       - name: kube-flannel
-        image: quay.io/coreos/flannel:v0.7.1-amd64
+        image: {{ default "quay.io/coreos/flannel:v0.7.1-amd64" .Values.image }}
         command: [ "/opt/bin/flanneld", "--ip-masq", "--kube-subnet-mgr" ]
         securityContext:
           privileged: true
@@ -119,7 +122,7 @@ spec:
         - name: flannel-cfg
           mountPath: /etc/kube-flannel/
       - name: install-cni
-        image: quay.io/coreos/flannel:v0.7.1-amd64
+        image: {{ default "quay.io/coreos/flannel:v0.7.1-amd64" .Values.image }}
         command: [ "/bin/sh", "-c", "set -e -x; cp -f /etc/kube-flannel/cni-conf.json /etc/cni/net.d/10-flannel.conf; while true; do sleep 3600; done" ]
         volumeMounts:
         - name: cni
@@ -350,7 +353,7 @@ spec:
         # container programs network policy and routes on each
         # host.
         - name: calico-node
-          image: quay.io/calico/node:v1.2.1
+          image: {{ default "quay.io/calico/node:v1.2.1" .Values.calicoNodeImage }}
           env:
             # Use Kubernetes API as the backing datastore.
             - name: DATASTORE_TYPE
@@ -397,7 +400,7 @@ spec:
         # This container installs the Calico CNI binaries
         # and CNI network config file on each node.
         - name: install-cni
-          image: quay.io/calico/cni:v1.8.3
+          image: {{ default "quay.io/calico/cni:v1.8.3" .Values.calicoCniImage }}
           command: ["/install-cni.sh"]
           env:
             # The CNI network config to install on each node.
@@ -418,7 +421,7 @@ spec:
         # This container runs flannel using the kube-subnet-mgr backend
         # for allocating subnets.
         - name: kube-flannel
-          image: quay.io/coreos/flannel:v0.7.1
+          image: {{ default "quay.io/coreos/flannel:v0.7.1" .Values.flannelImage }}
           command: [ "/opt/bin/flanneld", "--ip-masq", "--kube-subnet-mgr" ]
           securityContext:
             privileged: true
@@ -537,7 +540,7 @@ spec:
       hostPID: true
       containers:
         - name: weave
-          image: weaveworks/weave-kube:1.9.5
+          image: {{ default "weaveworks/weave-kube:1.9.5" .Values.weaveImage }}
           command:
             - /home/weave/launch.sh
           livenessProbe:
@@ -565,7 +568,7 @@ spec:
             requests:
               cpu: 10m
         - name: weave-npc
-          image: weaveworks/weave-npc:1.9.5
+          image: {{ default "weaveworks/weave-npc:1.9.5" .Values.weaveNpcImage }}
           resources:
             requests:
               cpu: 10m
@@ -22,6 +22,11 @@ func (fnp *WeaveNetworkProvider) PodNetworkCidr() string {
 }
 
 // Create - will create the K8 network resources (Weave)
-func (fnp *WeaveNetworkProvider) Create() (error) {
-	return renderandDeploy(weavePodCidr, weaveYaml)
+func (fnp *WeaveNetworkProvider) Create(opts Options) (error) {
+	return renderandDeploy(fnp.Name(), weavePodCidr, weaveYaml, opts)
+}
+
+// Render - will return the K8 network resources
+func (fnp *WeaveNetworkProvider) Render(opts Options) (string, error) {
+	return renderResources(weavePodCidr, weaveYaml, opts)
 }
@@ -0,0 +1,220 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/logging"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+var logger = logging.New("notify")
+
+// Alert types
+const (
+	BootstrapFailed = "BootstrapFailed"
+	LockTakeover    = "LockTakeover"
+	CertExpiry      = "CertExpiry"
+	ReconcileFailed = "ReconcileFailed"
+	ConfigDrift     = "ConfigDrift"
+	PublishFailed   = "PublishFailed"
+	StepFailed      = "StepFailed"
+)
+
+// Severities
+const (
+	Critical = "critical"
+	Warning  = "warning"
+)
+
+// Timeout for sending each alert
+var Timeout = 10 * time.Second
+
+// Alert is the structured notification sent to all sinks
+type Alert struct {
+	Type     string    `json:"type"`
+	Severity string    `json:"severity"`
+	Cluster  string    `json:"cluster,omitempty"`
+	Node     string    `json:"node,omitempty"`
+	Message  string    `json:"message"`
+	Time     time.Time `json:"time"`
+}
+
+// Config is the notification sinks (from the config file)
+type Config struct {
+	// Webhook will receive each alert as json
+	Webhook *Webhook `json:"webhook,omitempty"`
+	// Slack will receive each alert as a message
+	Slack *Slack `json:"slack,omitempty"`
+	// SNS will receive each alert as json
+	SNS *SNS `json:"sns,omitempty"`
+}
+
+// Webhook is a generic http endpoint
+type Webhook struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Slack is an incoming webhook
+type Slack struct {
+	WebhookURL string `json:"webhookURL"`
+	Channel    string `json:"channel,omitempty"`
+}
+
+// SNS is an AWS SNS topic (the instance role must allow sns:Publish)
+type SNS struct {
+	TopicARN string `json:"topicARN"`
+}
+
+// sink sends alerts somewhere
+type sink interface {
+	send(a Alert) error
+}
+
+var (
+	mu    sync.Mutex
+	sinks []sink
+)
+
+// Validate will check the sinks are complete
+func (c *Config) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.Webhook != nil && c.Webhook.URL == "" {
+		return fmt.Errorf("notifications webhook url is required")
+	}
+	if c.Slack != nil && c.Slack.WebhookURL == "" {
+		return fmt.Errorf("notifications slack webhookURL is required")
+	}
+	if c.SNS != nil {
+		if _, err := c.SNS.region(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Configure will set the sinks all alerts are sent to (nil disables notifications)
+func Configure(c *Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	sinks = nil
+	if c == nil {
+		return nil
+	}
+	if c.Webhook != nil {
+		sinks = append(sinks, c.Webhook)
+	}
+	if c.Slack != nil {
+		sinks = append(sinks, c.Slack)
+	}
+	if c.SNS != nil {
+		sinks = append(sinks, c.SNS)
+	}
+	return nil
+}
+
+// Send will send an alert to all the sinks
+// Alerts are best effort so failures are only logged
+func Send(alertType, severity, message string) {
+	mu.Lock()
+	configured := sinks
+	mu.Unlock()
+	if len(configured) == 0 {
+		return
+	}
+	fields := logging.Fields()
+	a := Alert{
+		Type:     alertType,
+		Severity: severity,
+		Message:  message,
+		Time:     time.Now().UTC(),
+	}
+	a.Cluster, _ = fields[logging.ClusterField].(string)
+	a.Node, _ = fields[logging.NodeField].(string)
+	for _, s := range configured {
+		if err := s.send(a); err != nil {
+			logger.Warnf("error sending %s alert: %v", alertType, err)
+		}
+	}
+}
+
+func (w *Webhook) send(a Alert) error {
+	return postJSON(w.URL, w.Headers, a)
+}
+
+func (s *Slack) send(a Alert) error {
+	msg := map[string]string{
+		"text": fmt.Sprintf("[%s] %s on %s (cluster %s): %s", strings.ToUpper(a.Severity), a.Type, a.Node, a.Cluster, a.Message),
+	}
+	if s.Channel != "" {
+		msg["channel"] = s.Channel
+	}
+	return postJSON(s.WebhookURL, nil, msg)
+}
+
+func (s *SNS) send(a Alert) error {
+	region, err := s.region()
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	svc := sns.New(session.New(&aws.Config{
+		Region:     aws.String(region),
+		HTTPClient: &http.Client{Timeout: Timeout},
+	}))
+	_, err = svc.Publish(&sns.PublishInput{
+		TopicArn: aws.String(s.TopicARN),
+		Subject:  aws.String(fmt.Sprintf("keto-k8 %s %s", a.Type, a.Node)),
+		Message:  aws.String(string(b)),
+	})
+	return err
+}
+
+// region returns the AWS region from the topic ARN e.g. arn:aws:sns:eu-west-2:111122223333:alerts
+func (s *SNS) region() (string, error) {
+	parts := strings.Split(s.TopicARN, ":")
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "sns" || len(parts[3]) == 0 {
+		return "", fmt.Errorf("invalid notifications sns topicARN %q", s.TopicARN)
+	}
+	return parts[3], nil
+}
+
+func postJSON(url string, headers map[string]string, body interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := (&http.Client{Timeout: Timeout}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/logging"
+)
+
+func TestSend(t *testing.T) {
+	var alerts []Alert
+	var slack []map[string]string
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test" {
+			t.Errorf("expected the configured header but got %v", r.Header)
+		}
+		var a Alert
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			t.Error(err)
+		}
+		alerts = append(alerts, a)
+	}))
+	defer webhook.Close()
+	slackHook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		msg := map[string]string{}
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Error(err)
+		}
+		slack = append(slack, msg)
+	}))
+	defer slackHook.Close()
+
+	logging.SetNode("master1")
+	defer logging.SetNode("")
+	err := Configure(&Config{
+		Webhook: &Webhook{URL: webhook.URL, Headers: map[string]string{"Authorization": "Bearer test"}},
+		Slack:   &Slack{WebhookURL: slackHook.URL, Channel: "#alerts"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Configure(nil)
+
+	Send(BootstrapFailed, Critical, "kubeadm failed")
+
+	if len(alerts) != 1 || alerts[0].Type != BootstrapFailed || alerts[0].Node != "master1" {
+		t.Errorf("unexpected webhook alerts %+v", alerts)
+	}
+	if len(slack) != 1 || slack[0]["channel"] != "#alerts" || !strings.Contains(slack[0]["text"], "kubeadm failed") {
+		t.Errorf("unexpected slack messages %v", slack)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (&Config{SNS: &SNS{TopicARN: "arn:aws:sns:eu-west-2:111122223333:alerts"}}).Validate(); err != nil {
+		t.Error(err)
+	}
+	for _, c := range []*Config{
+		{SNS: &SNS{TopicARN: "alerts"}},
+		{Webhook: &Webhook{}},
+		{Slack: &Slack{}},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("expected an error for %+v", c)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package oidc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+	"k8s.io/kubernetes/pkg/util/version"
+)
+
+const (
+	// Dir holds the OIDC config (mounted into the apiserver)
+	Dir = "/etc/kubernetes/oidc"
+
+	// CAFile is the copy of the issuer CA the apiserver reads
+	CAFile = Dir + "/ca.crt"
+
+	apiServerContainer = "kube-apiserver"
+	oidcVolume         = "oidc-config"
+)
+
+// First version with the username and groups prefix flags
+var minPrefixVersion = version.MustParseGeneric("v1.8.0")
+
+// Config is the apiserver OpenID Connect authenticator configuration
+type Config struct {
+	// IssuerURL is the https url of the provider, it must serve /.well-known/openid-configuration
+	IssuerURL string `json:"issuerURL"`
+	// ClientID is the audience the id tokens must be issued for
+	ClientID string `json:"clientID"`
+	// UsernameClaim is the claim used as the user name (the apiserver uses sub when empty)
+	UsernameClaim string `json:"usernameClaim,omitempty"`
+	// UsernamePrefix is added to user names (kubernetes v1.8+) e.g. "oidc:" or "-" for none
+	UsernamePrefix string `json:"usernamePrefix,omitempty"`
+	// GroupsClaim is the claim used as the user's groups
+	GroupsClaim string `json:"groupsClaim,omitempty"`
+	// GroupsPrefix is added to group names (kubernetes v1.8+)
+	GroupsPrefix string `json:"groupsPrefix,omitempty"`
+	// CAFile is a CA to verify the issuer (system roots are used when empty)
+	CAFile string `json:"caFile,omitempty"`
+}
+
+// Enabled is true when an issuer is configured
+func (c *Config) Enabled() bool {
+	return c != nil && len(c.IssuerURL) > 0
+}
+
+// Validate checks the OIDC config can be used at a kubernetes version
+func (c *Config) Validate(kubeVersion string) error {
+	u, err := url.Parse(c.IssuerURL)
+	if err != nil {
+		return fmt.Errorf("invalid oidc issuerURL %q [%v]", c.IssuerURL, err)
+	}
+	if u.Scheme != "https" || len(u.Host) == 0 || len(u.RawQuery) > 0 || len(u.Fragment) > 0 {
+		return fmt.Errorf("invalid oidc issuerURL %q, must be an https url without a query or fragment", c.IssuerURL)
+	}
+	if len(c.ClientID) == 0 {
+		return fmt.Errorf("oidc clientID is required")
+	}
+	if len(c.GroupsPrefix) > 0 && len(c.GroupsClaim) == 0 {
+		return fmt.Errorf("oidc groupsPrefix requires a groupsClaim")
+	}
+	if len(c.UsernamePrefix) > 0 || len(c.GroupsPrefix) > 0 {
+		v, err := version.ParseGeneric(kubeVersion)
+		if err != nil {
+			return fmt.Errorf("couldn't parse kubernetes version %q: %v", kubeVersion, err)
+		}
+		if v.LessThan(minPrefixVersion) {
+			return fmt.Errorf("oidc usernamePrefix and groupsPrefix require kubernetes %s or later (not %s)",
+				minPrefixVersion, kubeVersion)
+		}
+	}
+	return nil
+}
+
+// APIServerArgs returns the apiserver flags for the OIDC config
+func (c *Config) APIServerArgs() map[string]string {
+	args := map[string]string{
+		"oidc-issuer-url": c.IssuerURL,
+		"oidc-client-id":  c.ClientID,
+	}
+	optional := map[string]string{
+		"oidc-username-claim":  c.UsernameClaim,
+		"oidc-username-prefix": c.UsernamePrefix,
+		"oidc-groups-claim":    c.GroupsClaim,
+		"oidc-groups-prefix":   c.GroupsPrefix,
+	}
+	for flag, value := range optional {
+		if len(value) > 0 {
+			args[flag] = value
+		}
+	}
+	if len(c.CAFile) > 0 {
+		args["oidc-ca-file"] = CAFile
+	}
+	return args
+}
+
+// Write will save the issuer CA for the apiserver (when set)
+func (c *Config) Write() error {
+	files, err := c.Render()
+	if err != nil || len(files) == 0 {
+		return err
+	}
+	if err = os.MkdirAll(Dir, 0700); err != nil {
+		return err
+	}
+	return fileutil.WriteFile(CAFile, files[CAFile], 0600)
+}
+
+// Render returns the issuer CA for the apiserver (by file name)
+func (c *Config) Render() (map[string][]byte, error) {
+	files := map[string][]byte{}
+	if len(c.CAFile) == 0 {
+		return files, nil
+	}
+	ca, err := ioutil.ReadFile(c.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading oidc caFile %q [%v]", c.CAFile, err)
+	}
+	files[CAFile] = ca
+	return files, nil
+}
+
+// Mutator returns a podspec.Mutator mounting the OIDC config into the apiserver static pod
+func (c *Config) Mutator() podspec.Mutator {
+	return func(o podspec.Object) error {
+		if len(c.CAFile) == 0 || o.Container(apiServerContainer) == nil {
+			return nil
+		}
+		o.AddVolume(map[string]interface{}{
+			"name":     oidcVolume,
+			"hostPath": map[string]interface{}{"path": Dir},
+		})
+		return o.AddVolumeMount(apiServerContainer, map[string]interface{}{
+			"name":      oidcVolume,
+			"mountPath": Dir,
+			"readOnly":  true,
+		})
+	}
+}
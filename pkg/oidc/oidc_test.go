@@ -0,0 +1,59 @@
+package oidc
+
+import (
+	"testing"
+)
+
+func TestEnabled(t *testing.T) {
+	var c *Config
+	if c.Enabled() {
+		t.Errorf("expected a nil config not to be enabled")
+	}
+	if (&Config{ClientID: "kubernetes"}).Enabled() {
+		t.Errorf("expected a config without an issuer not to be enabled")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		config  Config
+		version string
+		valid   bool
+	}{
+		{config: Config{IssuerURL: "https://sso.example.com/auth/realms/keto", ClientID: "kubernetes"}, version: "v1.7.5", valid: true},
+		{config: Config{IssuerURL: "http://sso.example.com", ClientID: "kubernetes"}, version: "v1.9.3"},
+		{config: Config{IssuerURL: "https://sso.example.com?realm=keto", ClientID: "kubernetes"}, version: "v1.9.3"},
+		{config: Config{IssuerURL: "https://sso.example.com"}, version: "v1.9.3"},
+		{config: Config{IssuerURL: "https://sso.example.com", ClientID: "kubernetes", GroupsPrefix: "oidc:"}, version: "v1.9.3"},
+		{
+			config:  Config{IssuerURL: "https://sso.example.com", ClientID: "kubernetes", GroupsClaim: "groups", GroupsPrefix: "oidc:"},
+			version: "v1.9.3",
+			valid:   true,
+		},
+		{config: Config{IssuerURL: "https://sso.example.com", ClientID: "kubernetes", UsernamePrefix: "-"}, version: "v1.7.5"},
+	}
+	for _, test := range tests {
+		if err := test.config.Validate(test.version); (err == nil) != test.valid {
+			t.Errorf("expected %+v at %s valid to be %v but got %v", test.config, test.version, test.valid, err)
+		}
+	}
+}
+
+func TestAPIServerArgs(t *testing.T) {
+	c := &Config{IssuerURL: "https://sso.example.com", ClientID: "kubernetes", UsernameClaim: "email", CAFile: "/etc/ssl/sso-ca.pem"}
+	args := c.APIServerArgs()
+	expected := map[string]string{
+		"oidc-issuer-url":     "https://sso.example.com",
+		"oidc-client-id":      "kubernetes",
+		"oidc-username-claim": "email",
+		"oidc-ca-file":        CAFile,
+	}
+	if len(args) != len(expected) {
+		t.Errorf("expected args %v but got %v", expected, args)
+	}
+	for flag, value := range expected {
+		if args[flag] != value {
+			t.Errorf("expected %s=%q but got %q", flag, value, args[flag])
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package placement
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+)
+
+// Default is the placement of every keto-k8 workload (the CNI, DNS, keto-tokens and the addons), any placement in the
+// values of a workload takes precedence
+var Default *Placement
+
+// tolerationOperators are the valid toleration operators (an empty operator is Equal)
+var tolerationOperators = []string{"", "Exists", "Equal"}
+
+// Placement is where the pods of a workload can be scheduled e.g. a dedicated infra pool or masters with custom taints
+type Placement struct {
+	// NodeSelector labels are added to any the workload already selects
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations are added to those of the workload (unless the key is already tolerated)
+	Tolerations []map[string]interface{} `json:"tolerations,omitempty"`
+	// Affinity replaces the affinity of the workload
+	Affinity map[string]interface{} `json:"affinity,omitempty"`
+}
+
+// FromValues returns the placement in the values of a workload (nil when there isn't one)
+func FromValues(values map[string]interface{}) (*Placement, error) {
+	placement := map[string]interface{}{}
+	for _, key := range []string{"nodeSelector", "tolerations", "affinity"} {
+		if value, ok := values[key]; ok {
+			placement[key] = value
+		}
+	}
+	if len(placement) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(placement)
+	if err != nil {
+		return nil, err
+	}
+	p := &Placement{}
+	if err = json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("invalid placement %s [%v]", data, err)
+	}
+	return p, p.Validate()
+}
+
+// For returns the placement of a workload, the Default with any placement in the workload values
+func For(values map[string]interface{}) (*Placement, error) {
+	p, err := FromValues(values)
+	if err != nil {
+		return nil, err
+	}
+	return Merge(Default, p), nil
+}
+
+// Merge returns the placement with the overrides (the node selector labels and tolerations are combined and the
+// override affinity replaces any other)
+func Merge(placement, overrides *Placement) *Placement {
+	if placement == nil {
+		return overrides
+	}
+	if overrides == nil {
+		return placement
+	}
+	merged := &Placement{NodeSelector: map[string]string{}, Affinity: placement.Affinity}
+	for _, p := range []*Placement{placement, overrides} {
+		for k, v := range p.NodeSelector {
+			merged.NodeSelector[k] = v
+		}
+	}
+	merged.Tolerations = append(append([]map[string]interface{}{}, overrides.Tolerations...), placement.Tolerations...)
+	if overrides.Affinity != nil {
+		merged.Affinity = overrides.Affinity
+	}
+	return merged
+}
+
+// Validate will check the toleration operators
+func (p *Placement) Validate() error {
+	if p == nil {
+		return nil
+	}
+	for _, t := range p.Tolerations {
+		operator, _ := t["operator"].(string)
+		if !validOperator(operator) {
+			return fmt.Errorf("invalid toleration operator %q, must be Exists or Equal", operator)
+		}
+		if _, ok := t["key"]; !ok && operator != "Exists" {
+			return fmt.Errorf("a toleration without a key must use the Exists operator")
+		}
+	}
+	return nil
+}
+
+// Mutator returns a podspec.Mutator placing the pods of all workloads
+func (p *Placement) Mutator() podspec.Mutator {
+	return func(o podspec.Object) error {
+		if p == nil || !o.HasPodSpec() {
+			return nil
+		}
+		if len(p.NodeSelector) > 0 {
+			selector, _ := o.PodSpec()["nodeSelector"].(map[string]interface{})
+			if selector == nil {
+				selector = map[string]interface{}{}
+			}
+			for k, v := range p.NodeSelector {
+				selector[k] = v
+			}
+			o.SetPodSpecField("nodeSelector", selector)
+		}
+		for _, t := range p.Tolerations {
+			toleration := map[string]interface{}{}
+			for k, v := range t {
+				toleration[k] = v
+			}
+			o.AddToleration(toleration)
+		}
+		if p.Affinity != nil {
+			o.SetPodSpecField("affinity", p.Affinity)
+		}
+		return nil
+	}
+}
+
+// Patch returns a merge patch placing an existing workload (empty when there's no placement), the tolerations are
+// patched as a whole list so the workload's own are kept
+func (p *Placement) Patch(o podspec.Object) (string, error) {
+	if p == nil || !o.HasPodSpec() {
+		return "", nil
+	}
+	if err := p.Mutator()(o); err != nil {
+		return "", err
+	}
+	spec := map[string]interface{}{}
+	for _, field := range []string{"nodeSelector", "tolerations", "affinity"} {
+		if value, ok := o.PodSpec()[field]; ok {
+			spec[field] = value
+		}
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{"spec": spec},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(patch), nil
+}
+
+// validOperator returns true for a known toleration operator
+func validOperator(operator string) bool {
+	for _, o := range tolerationOperators {
+		if operator == o {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package placement
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+)
+
+const testDaemonSet = `apiVersion: extensions/v1beta1
+kind: DaemonSet
+metadata:
+  name: kube-flannel-ds
+  namespace: kube-system
+spec:
+  template:
+    spec:
+      nodeSelector:
+        beta.kubernetes.io/arch: amd64
+      tolerations:
+      - key: node-role.kubernetes.io/master
+        operator: Exists
+        effect: NoSchedule
+      containers:
+      - name: kube-flannel
+        image: quay.io/coreos/flannel:v0.7.1-amd64
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: kube-flannel-cfg
+  namespace: kube-system
+`
+
+func TestFromValues(t *testing.T) {
+	if p, err := FromValues(map[string]interface{}{"image": "flannel"}); p != nil || err != nil {
+		t.Errorf("expected no placement without placement values but got %+v %v", p, err)
+	}
+	p, err := FromValues(map[string]interface{}{
+		"nodeSelector": map[string]interface{}{"pool": "infra"},
+		"tolerations":  []interface{}{map[string]interface{}{"key": "dedicated", "operator": "Exists"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.NodeSelector["pool"] != "infra" || len(p.Tolerations) != 1 || p.Affinity != nil {
+		t.Errorf("unexpected placement %+v", p)
+	}
+	for _, invalid := range []map[string]interface{}{
+		{"nodeSelector": "pool=infra"},
+		{"tolerations": []interface{}{map[string]interface{}{"key": "dedicated", "operator": "In"}}},
+		{"tolerations": []interface{}{map[string]interface{}{"value": "infra"}}},
+	} {
+		if _, err = FromValues(invalid); err == nil {
+			t.Errorf("expected %v to be invalid", invalid)
+		}
+	}
+}
+
+func TestFor(t *testing.T) {
+	defer func(p *Placement) { Default = p }(Default)
+	Default = &Placement{
+		NodeSelector: map[string]string{"pool": "infra", "zone": "a"},
+		Tolerations:  []map[string]interface{}{{"key": "dedicated", "operator": "Equal", "value": "infra"}},
+		Affinity:     map[string]interface{}{"podAntiAffinity": map[string]interface{}{}},
+	}
+	p, err := For(map[string]interface{}{
+		"nodeSelector": map[string]interface{}{"pool": "system"},
+		"tolerations":  []interface{}{map[string]interface{}{"key": "dedicated", "operator": "Exists"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p.NodeSelector, map[string]string{"pool": "system", "zone": "a"}) {
+		t.Errorf("expected the workload node selector to take precedence but got %v", p.NodeSelector)
+	}
+	if len(p.Tolerations) != 2 || p.Tolerations[0]["operator"] != "Exists" {
+		t.Errorf("expected the workload tolerations first but got %v", p.Tolerations)
+	}
+	if p.Affinity == nil {
+		t.Error("expected the default affinity")
+	}
+	if p, err = For(nil); err != nil || p != Default {
+		t.Errorf("expected the default placement without workload values but got %+v %v", p, err)
+	}
+}
+
+func TestMutator(t *testing.T) {
+	p := &Placement{
+		NodeSelector: map[string]string{"pool": "infra"},
+		Tolerations: []map[string]interface{}{
+			{"key": "node-role.kubernetes.io/master", "operator": "Exists"},
+			{"key": "dedicated", "operator": "Equal", "value": "infra", "effect": "NoSchedule"},
+		},
+	}
+	manifest, err := podspec.Transform(testDaemonSet, p.Mutator())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"beta.kubernetes.io/arch: amd64",
+		"pool: infra",
+		"key: dedicated",
+		"value: infra",
+	} {
+		if !strings.Contains(manifest, expected) {
+			t.Errorf("expected the manifest to contain %q but got:\n%s", expected, manifest)
+		}
+	}
+	if strings.Count(manifest, "node-role.kubernetes.io/master") != 1 {
+		t.Errorf("expected a tolerated key to be left alone but got:\n%s", manifest)
+	}
+}
+
+func TestPatch(t *testing.T) {
+	objs, err := podspec.Decode(testDaemonSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p *Placement
+	if patch, err := p.Patch(objs[0]); err != nil || len(patch) > 0 {
+		t.Errorf("expected no patch without a placement but got %q %v", patch, err)
+	}
+	p = &Placement{Tolerations: []map[string]interface{}{{"key": "dedicated", "operator": "Exists"}}}
+	patch, err := p.Patch(objs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{`"key":"dedicated"`, `"key":"node-role.kubernetes.io/master"`, `"beta.kubernetes.io/arch":"amd64"`} {
+		if !strings.Contains(patch, expected) {
+			t.Errorf("expected the patch to contain %s but got %s", expected, patch)
+		}
+	}
+	if patch, err = p.Patch(objs[1]); err != nil || len(patch) > 0 {
+		t.Errorf("expected no patch for a configmap but got %q %v", patch, err)
+	}
+}
@@ -0,0 +1,228 @@
+package podspec
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+const docSeparator = "---"
+
+// Object is a single decoded kubernetes resource (as yaml / json maps)
+type Object map[string]interface{}
+
+// Mutator will change a resource in place
+type Mutator func(o Object) error
+
+// Decode will split a multi document yaml string into resources
+// Empty documents (e.g. comment only) are dropped
+func Decode(doc string) (objs []Object, err error) {
+	for _, part := range splitDocs(doc) {
+		o := Object{}
+		if err = yaml.Unmarshal([]byte(part), &o); err != nil {
+			return nil, fmt.Errorf("error parsing resource [%v]:\n%s", err, part)
+		}
+		if len(o) == 0 {
+			continue
+		}
+		objs = append(objs, o)
+	}
+	return objs, nil
+}
+
+// Encode will join resources into a multi document yaml string
+func Encode(objs []Object) (string, error) {
+	var b bytes.Buffer
+	for i, o := range objs {
+		out, err := yaml.Marshal(o)
+		if err != nil {
+			return "", err
+		}
+		if i > 0 {
+			b.WriteString(docSeparator + "\n")
+		}
+		b.Write(out)
+	}
+	return b.String(), nil
+}
+
+// Transform will decode yaml, apply all mutators to every resource and re-encode
+func Transform(doc string, mutators ...Mutator) (string, error) {
+	if len(mutators) == 0 {
+		return doc, nil
+	}
+	objs, err := Decode(doc)
+	if err != nil {
+		return "", err
+	}
+	for _, o := range objs {
+		for _, m := range mutators {
+			if err := m(o); err != nil {
+				return "", err
+			}
+		}
+	}
+	return Encode(objs)
+}
+
+// Kind returns the resource kind
+func (o Object) Kind() string {
+	kind, _ := o["kind"].(string)
+	return kind
+}
+
+// Name returns the resource name
+func (o Object) Name() string {
+	name, _ := o.Metadata()["name"].(string)
+	return name
+}
+
+// Namespace returns the resource namespace (empty for cluster resources)
+func (o Object) Namespace() string {
+	namespace, _ := o.Metadata()["namespace"].(string)
+	return namespace
+}
+
+// Label returns the value of a label
+func (o Object) Label(key string) string {
+	labels, _ := o.Metadata()["labels"].(map[string]interface{})
+	value, _ := labels[key].(string)
+	return value
+}
+
+// Metadata returns the resource metadata (created if missing)
+func (o Object) Metadata() map[string]interface{} {
+	return child(o, "metadata")
+}
+
+// SetLabel will add a label to the resource
+func (o Object) SetLabel(key, value string) {
+	child(o.Metadata(), "labels")[key] = value
+}
+
+// HasPodSpec is true for pods and for workloads with a pod template
+func (o Object) HasPodSpec() bool {
+	switch o.Kind() {
+	case "Pod", "DaemonSet", "Deployment", "ReplicaSet", "StatefulSet", "Job":
+		return true
+	}
+	return false
+}
+
+// PodMetadata returns the metadata for a pod or a workload pod template
+func (o Object) PodMetadata() map[string]interface{} {
+	if o.Kind() == "Pod" {
+		return o.Metadata()
+	}
+	return child(child(child(o, "spec"), "template"), "metadata")
+}
+
+// PodSpec returns the spec for a pod or a workload pod template
+func (o Object) PodSpec() map[string]interface{} {
+	if o.Kind() == "Pod" {
+		return child(o, "spec")
+	}
+	return child(child(child(o, "spec"), "template"), "spec")
+}
+
+// SetPodAnnotation will add an annotation to a pod (or pod template)
+func (o Object) SetPodAnnotation(key, value string) {
+	child(o.PodMetadata(), "annotations")[key] = value
+}
+
+// SetPodSpecField will set a top level field of the pod spec e.g. priorityClassName
+func (o Object) SetPodSpecField(key string, value interface{}) {
+	o.PodSpec()[key] = value
+}
+
+// AddToleration will add a toleration to a pod (or pod template) unless the key is already tolerated
+func (o Object) AddToleration(toleration map[string]interface{}) {
+	spec := o.PodSpec()
+	tolerations, _ := spec["tolerations"].([]interface{})
+	for _, t := range tolerations {
+		if existing, ok := t.(map[string]interface{}); ok && existing["key"] == toleration["key"] {
+			return
+		}
+	}
+	spec["tolerations"] = append(tolerations, toleration)
+}
+
+// Containers returns the containers of a pod (or pod template)
+func (o Object) Containers() []map[string]interface{} {
+	var containers []map[string]interface{}
+	items, _ := o.PodSpec()["containers"].([]interface{})
+	for _, item := range items {
+		if c, ok := item.(map[string]interface{}); ok {
+			containers = append(containers, c)
+		}
+	}
+	return containers
+}
+
+// Container returns a named container (nil if not present)
+func (o Object) Container(name string) map[string]interface{} {
+	for _, c := range o.Containers() {
+		if c["name"] == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// AddContainer will add (or replace) a container by name
+func (o Object) AddContainer(container map[string]interface{}) {
+	o.PodSpec()["containers"] = appendByName(o.PodSpec()["containers"], container)
+}
+
+// AddVolume will add (or replace) a pod volume by name
+func (o Object) AddVolume(volume map[string]interface{}) {
+	o.PodSpec()["volumes"] = appendByName(o.PodSpec()["volumes"], volume)
+}
+
+// AddVolumeMount will add (or replace) a volume mount for a named container
+func (o Object) AddVolumeMount(containerName string, mount map[string]interface{}) error {
+	c := o.Container(containerName)
+	if c == nil {
+		return fmt.Errorf("container %q not found in %s %s", containerName, o.Kind(), o.Name())
+	}
+	c["volumeMounts"] = appendByName(c["volumeMounts"], mount)
+	return nil
+}
+
+// appendByName will add an item to a list, replacing any item with the same name
+func appendByName(list interface{}, item map[string]interface{}) []interface{} {
+	items, _ := list.([]interface{})
+	for i, existing := range items {
+		if m, ok := existing.(map[string]interface{}); ok && m["name"] == item["name"] {
+			items[i] = item
+			return items
+		}
+	}
+	return append(items, item)
+}
+
+// child will return (and create if missing) a nested map
+func child(m map[string]interface{}, key string) map[string]interface{} {
+	if c, ok := m[key].(map[string]interface{}); ok {
+		return c
+	}
+	c := map[string]interface{}{}
+	m[key] = c
+	return c
+}
+
+func splitDocs(doc string) []string {
+	var docs []string
+	var current []string
+	for _, line := range strings.Split(doc, "\n") {
+		if strings.TrimSpace(line) == docSeparator {
+			docs = append(docs, strings.Join(current, "\n"))
+			current = []string{}
+			continue
+		}
+		current = append(current, line)
+	}
+	return append(docs, strings.Join(current, "\n"))
+}
@@ -0,0 +1,82 @@
+package podspec
+
+import (
+	"strings"
+	"testing"
+)
+
+const testDaemonSet = `# A comment only document
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: test
+---
+apiVersion: extensions/v1beta1
+kind: DaemonSet
+metadata:
+  name: test
+spec:
+  template:
+    metadata:
+      labels:
+        name: test
+    spec:
+      tolerations:
+      - key: node-role.kubernetes.io/master
+        operator: Exists
+      containers:
+      - name: test
+        image: test:v0.0.1
+`
+
+func TestDecode(t *testing.T) {
+	objs, err := Decode(testDaemonSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 2 {
+		t.Fatalf("expected 2 resources but got %d", len(objs))
+	}
+	if objs[1].Kind() != "DaemonSet" || objs[1].Name() != "test" {
+		t.Errorf("expected DaemonSet test but got %s %s", objs[1].Kind(), objs[1].Name())
+	}
+	if objs[0].HasPodSpec() {
+		t.Errorf("didn't expect a pod spec for kind %s", objs[0].Kind())
+	}
+}
+
+func TestTransform(t *testing.T) {
+	out, err := Transform(testDaemonSet, func(o Object) error {
+		if !o.HasPodSpec() {
+			return nil
+		}
+		o.SetPodAnnotation("test-annotation", "yes")
+		o.AddToleration(map[string]interface{}{"key": "CriticalAddonsOnly", "operator": "Exists"})
+		// duplicate keys must not be added
+		o.AddToleration(map[string]interface{}{"key": "node-role.kubernetes.io/master"})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs, err := Decode(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 2 {
+		t.Fatalf("expected 2 resources after transform but got %d:\n%s", len(objs), out)
+	}
+	ds := objs[1]
+	annotations, _ := ds.PodMetadata()["annotations"].(map[string]interface{})
+	if annotations["test-annotation"] != "yes" {
+		t.Errorf("expected annotation to be set but got %v", annotations)
+	}
+	tolerations, _ := ds.PodSpec()["tolerations"].([]interface{})
+	if len(tolerations) != 2 {
+		t.Errorf("expected 2 tolerations but got %v", tolerations)
+	}
+	if strings.HasPrefix(out, docSeparator) {
+		t.Errorf("didn't expect a leading document separator:\n%s", out)
+	}
+}
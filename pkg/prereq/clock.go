@@ -0,0 +1,92 @@
+package prereq
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+// DefaultMaxClockSkew is the largest offset from the NTP server allowed by default, the TLS certs are valid from when
+// they're signed and the etcd lock and lease TTLs are compared across the masters
+const DefaultMaxClockSkew = 2 * time.Second
+
+// ntpEpochOffset is the seconds from the NTP epoch (1900) to the unix epoch
+const ntpEpochOffset = 2208988800
+
+var (
+	// NTPServer is the NTP server the clock is compared with (empty to not check the clock)
+	NTPServer string
+	// MaxClockSkew is the largest offset from the NTP server allowed
+	MaxClockSkew = DefaultMaxClockSkew
+	// NTPTimeout for the NTP query
+	NTPTimeout = 5 * time.Second
+
+	// clockOffset returns the offset of the local clock from an NTP server (replaced by tests)
+	clockOffset = queryNTP
+)
+
+// clockSkew returns a remediation message when the clock is skewed from the NTP server, the clock is only reported as
+// unchecked when the server can't be queried (so an unreachable server doesn't fail the bootstrap)
+func clockSkew() string {
+	if len(NTPServer) == 0 {
+		return ""
+	}
+	offset, err := clockOffset(NTPServer)
+	if err != nil {
+		logger.Warnf("Clock not checked, failed to query the NTP server %s: %v", NTPServer, err)
+		return ""
+	}
+	logger.Debugf("Clock offset from %s is %v", NTPServer, offset)
+	if offset < 0 {
+		offset = -offset
+	}
+	if offset <= MaxClockSkew {
+		return ""
+	}
+	return fmt.Sprintf("clock is %v out from the NTP server %s (more than %v), TLS and etcd lease failures are likely: "+
+		"synchronise the clock e.g. with chronyd or systemd-timesyncd", offset/time.Millisecond*time.Millisecond, NTPServer, MaxClockSkew)
+}
+
+// queryNTP returns the offset of the local clock from an NTP server (SNTP, RFC 4330)
+func queryNTP(server string) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	conn, err := net.DialTimeout("udp", server, NTPTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if err = conn.SetDeadline(time.Now().Add(NTPTimeout)); err != nil {
+		return 0, err
+	}
+	req := make([]byte, 48)
+	// Leap indicator 0, version 3, client mode
+	req[0] = 0x1b
+	sent := time.Now()
+	if _, err = conn.Write(req); err != nil {
+		return 0, err
+	}
+	resp := make([]byte, 48)
+	n, err := conn.Read(resp)
+	if err != nil {
+		return 0, err
+	}
+	received := time.Now()
+	if n < 48 {
+		return 0, fmt.Errorf("short NTP response (%d bytes)", n)
+	}
+	if stratum := resp[1]; stratum == 0 || stratum > 15 {
+		return 0, fmt.Errorf("NTP server is unsynchronised (stratum %d)", stratum)
+	}
+	serverReceived, serverSent := ntpTime(resp[32:40]), ntpTime(resp[40:48])
+	return (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2, nil
+}
+
+// ntpTime decodes an NTP timestamp (seconds and fraction since 1900)
+func ntpTime(b []byte) time.Time {
+	seconds := int64(binary.BigEndian.Uint32(b[:4])) - ntpEpochOffset
+	fraction := int64(binary.BigEndian.Uint32(b[4:])) * int64(time.Second) >> 32
+	return time.Unix(seconds, fraction)
+}
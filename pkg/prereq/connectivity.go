@@ -0,0 +1,108 @@
+package prereq
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	// ConnectTimeout for each TCP connection to a target
+	ConnectTimeout = 5 * time.Second
+
+	// lookupHost resolves a host name (replaced by tests)
+	lookupHost = net.LookupHost
+	// dial makes a TCP connection (replaced by tests)
+	dial = func(address string) error {
+		conn, err := net.DialTimeout("tcp", address, ConnectTimeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+)
+
+// Target is an endpoint the node must reach to bootstrap
+type Target struct {
+	// Name describes the target in the remediation e.g. etcd endpoint
+	Name string
+	// Endpoint is a url or host:port
+	Endpoint string
+	// ResolveOnly won't connect to the target (e.g. the api load balancer before any master is up)
+	ResolveOnly bool
+}
+
+// EtcdTargets returns a target for each etcd endpoint (comma separated)
+func EtcdTargets(endpoints string) []Target {
+	var targets []Target
+	for _, endpoint := range strings.Split(endpoints, ",") {
+		if endpoint = strings.TrimSpace(endpoint); len(endpoint) > 0 {
+			targets = append(targets, Target{Name: "etcd endpoint", Endpoint: endpoint})
+		}
+	}
+	return targets
+}
+
+// APITarget returns the target for the api server url (none when not set)
+func APITarget(api *url.URL, resolveOnly bool) []Target {
+	if api == nil {
+		return nil
+	}
+	return []Target{{Name: "api server", Endpoint: api.String(), ResolveOnly: resolveOnly}}
+}
+
+// unreachable returns a remediation message for each target which can't be resolved or connected to
+func unreachable(targets []Target) []string {
+	var problems []string
+	for _, t := range targets {
+		if err := t.check(); err != nil {
+			problems = append(problems, fmt.Sprintf("%s %s unreachable: %v", t.Name, t.Endpoint, err))
+		}
+	}
+	return problems
+}
+
+// check will resolve the target host and connect to it (unless it's resolve only)
+func (t Target) check() error {
+	address, err := t.address()
+	if err != nil {
+		return err
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if net.ParseIP(host) == nil {
+		if _, err = lookupHost(host); err != nil {
+			return fmt.Errorf("DNS lookup failed, check the name and the node resolver [%v]", err)
+		}
+	}
+	if t.ResolveOnly {
+		return nil
+	}
+	if err = dial(address); err != nil {
+		return fmt.Errorf("TCP connection to %s failed, check the security groups and routes [%v]", address, err)
+	}
+	return nil
+}
+
+// address returns the host:port of the target (the scheme default port when a url has none)
+func (t Target) address() (string, error) {
+	if !strings.Contains(t.Endpoint, "://") {
+		return t.Endpoint, nil
+	}
+	u, err := url.Parse(t.Endpoint)
+	if err != nil {
+		return "", err
+	}
+	if len(u.Port()) > 0 {
+		return u.Host, nil
+	}
+	port := "443"
+	if u.Scheme == "http" {
+		port = "80"
+	}
+	return net.JoinHostPort(u.Hostname(), port), nil
+}
@@ -0,0 +1,112 @@
+package prereq
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// The default free space thresholds
+const (
+	DefaultMinFreeDiskMB = 2048
+	DefaultMinFreeInodes = 50000
+)
+
+// stReadOnly is the statfs flag of a read-only mount
+const stReadOnly = 0x1
+
+var (
+	// DiskPaths are the directories whose filesystems are checked (the nearest parent of any not created yet)
+	DiskPaths = []string{"/etc/kubernetes", "/var/lib/kubelet", "/var/lib/docker", "/var/lib/containerd"}
+	// MinFreeDiskMB is the least free space (in MiB) on each filesystem
+	MinFreeDiskMB uint64 = DefaultMinFreeDiskMB
+	// MinFreeInodes is the least free inodes on each filesystem (image layers use a lot of small files)
+	MinFreeInodes uint64 = DefaultMinFreeInodes
+
+	// statfs returns the filesystem stats of a path (replaced by tests)
+	statfs = syscall.Statfs
+	// device returns the device of the filesystem a path is on (replaced by tests)
+	device = func(path string) (uint64, error) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return 0, err
+		}
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return 0, fmt.Errorf("no device for %s", path)
+		}
+		return uint64(stat.Dev), nil
+	}
+)
+
+// filesystem is a filesystem backing some of the DiskPaths
+type filesystem struct {
+	paths []string
+	stat  syscall.Statfs_t
+}
+
+// lowDisk returns a remediation message for each filesystem (backing the DiskPaths) which is read-only, short of
+// space or short of inodes
+func lowDisk() []string {
+	var problems []string
+	filesystems, err := diskFilesystems()
+	if err != nil {
+		return []string{err.Error()}
+	}
+	for _, fs := range filesystems {
+		paths := strings.Join(fs.paths, ", ")
+		if fs.stat.Flags&stReadOnly != 0 {
+			problems = append(problems, fmt.Sprintf("the filesystem of %s is read-only, mount a writable volume "+
+				"(or use a --state-dir on a read-only root filesystem)", paths))
+			continue
+		}
+		// Only the blocks available to unprivileged users count (the reserved blocks are kept for root)
+		free := uint64(fs.stat.Bavail) * uint64(fs.stat.Bsize) / (1024 * 1024)
+		if free < MinFreeDiskMB {
+			problems = append(problems, fmt.Sprintf("the filesystem of %s has %dMiB free (less than %dMiB), "+
+				"free some space or grow the volume", paths, free, MinFreeDiskMB))
+		}
+		// Filesystems without a fixed inode count (e.g. btrfs) report none
+		if fs.stat.Files > 0 && uint64(fs.stat.Ffree) < MinFreeInodes {
+			problems = append(problems, fmt.Sprintf("the filesystem of %s has %d inodes free (less than %d), "+
+				"remove unused images or containers", paths, fs.stat.Ffree, MinFreeInodes))
+		}
+	}
+	return problems
+}
+
+// diskFilesystems returns the filesystems of the DiskPaths (each filesystem once, in order)
+func diskFilesystems() ([]*filesystem, error) {
+	var filesystems []*filesystem
+	byDevice := map[uint64]*filesystem{}
+	for _, path := range DiskPaths {
+		existing := existingParent(path)
+		dev, err := device(existing)
+		if err != nil {
+			return nil, fmt.Errorf("can't check the filesystem of %s [%v]", path, err)
+		}
+		if fs, ok := byDevice[dev]; ok {
+			fs.paths = append(fs.paths, path)
+			continue
+		}
+		fs := &filesystem{paths: []string{path}}
+		if err = statfs(existing, &fs.stat); err != nil {
+			return nil, fmt.Errorf("can't check the filesystem of %s [%v]", path, err)
+		}
+		byDevice[dev] = fs
+		filesystems = append(filesystems, fs)
+	}
+	return filesystems, nil
+}
+
+// existingParent returns the path or the nearest parent which exists (where the path will be created)
+func existingParent(path string) string {
+	for {
+		if _, err := os.Stat(path); err == nil || path == filepath.Dir(path) {
+			return path
+		}
+		path = filepath.Dir(path)
+	}
+}
@@ -0,0 +1,194 @@
+package prereq
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/command"
+	"github.com/UKHomeOffice/keto-k8/pkg/logging"
+)
+
+// The modes for missing host prerequisites
+const (
+	// ModeWarn logs the remediation for any missing prerequisites
+	ModeWarn = "warn"
+	// ModeCheck fails the bootstrap when any prerequisites are missing
+	ModeCheck = "check"
+	// ModeInstall installs any missing tools with the host package manager (and fails when that isn't possible)
+	ModeInstall = "install"
+)
+
+// Tool is a binary needed on the host (by the kubelet, kube-proxy or the network provider)
+type Tool struct {
+	Binary string
+	// Packages are the package names by package manager (the binary name when not listed)
+	Packages map[string]string
+	Reason   string
+}
+
+// packageManager installs packages on the host
+type packageManager struct {
+	Name    string
+	Install []string
+}
+
+var (
+	// Mode is how missing prerequisites are dealt with (empty to not check them)
+	Mode string
+	// NetworkProvider selects the extra tools the network provider needs
+	NetworkProvider string
+
+	logger = logging.New("prereq")
+
+	// lookPath finds a binary (replaced by tests)
+	lookPath = exec.LookPath
+
+	// run runs the package manager and iptables (replaced by tests)
+	run = func(name string, args ...string) (string, error) {
+		return command.Run(logger, "", name, args...)
+	}
+)
+
+// baseTools are needed on every node
+var baseTools = []Tool{
+	{Binary: "iptables", Reason: "kube-proxy and the CNI plugins program the service and pod rules with it"},
+	{Binary: "conntrack", Packages: map[string]string{"yum": "conntrack-tools", "dnf": "conntrack-tools"},
+		Reason: "kube-proxy removes stale UDP connections with it"},
+	{Binary: "ebtables", Reason: "the kubelet and bridge plugin use it for hairpin and bridge rules"},
+	{Binary: "socat", Reason: "the kubelet uses it for kubectl port-forward"},
+}
+
+// providerTools are the extra tools each network provider needs
+var providerTools = map[string][]Tool{
+	"weave": {{Binary: "ipset", Reason: "the weave network policy controller uses ipsets"}},
+	"canal": {{Binary: "ipset", Reason: "the calico network policy agent uses ipsets"}},
+}
+
+// packageManagers are tried in order to install missing tools
+var packageManagers = []packageManager{
+	{Name: "apt-get", Install: []string{"install", "-y", "--no-install-recommends"}},
+	{Name: "dnf", Install: []string{"install", "-y"}},
+	{Name: "yum", Install: []string{"install", "-y"}},
+	{Name: "zypper", Install: []string{"--non-interactive", "install"}},
+}
+
+// ValidateMode will check the mode for missing prerequisites
+func ValidateMode(mode string) error {
+	switch mode {
+	case "", ModeWarn, ModeCheck, ModeInstall:
+		return nil
+	}
+	return fmt.Errorf("invalid host prerequisites mode %q, must be one of: %s, %s, %s", mode, ModeWarn, ModeCheck, ModeInstall)
+}
+
+// Tools returns the tools needed on a node with the network provider
+func Tools(networkProvider string) []Tool {
+	return append(append([]Tool{}, baseTools...), providerTools[networkProvider]...)
+}
+
+// Check will find any missing prerequisites (a skewed clock, low disk or unreachable targets) and deal with them by
+// the Mode
+func Check(targets ...Target) error {
+	if len(Mode) == 0 {
+		return nil
+	}
+	problems := Missing(Tools(NetworkProvider))
+	if Mode == ModeInstall && len(problems) > 0 {
+		if err := install(missingTools(Tools(NetworkProvider))); err != nil {
+			return err
+		}
+		problems = Missing(Tools(NetworkProvider))
+	}
+	if skew := clockSkew(); len(skew) > 0 {
+		problems = append(problems, skew)
+	}
+	problems = append(problems, lowDisk()...)
+	problems = append(problems, unreachable(targets)...)
+	if len(problems) == 0 {
+		logger.Printf("Host prerequisites found")
+		return nil
+	}
+	if Mode == ModeWarn {
+		for _, p := range problems {
+			logger.Warnf("Host prerequisite missing: %s", p)
+		}
+		return nil
+	}
+	return fmt.Errorf("host prerequisites missing:\n%s", strings.Join(problems, "\n"))
+}
+
+// Missing returns a remediation message for each missing tool and for an iptables using the nf_tables backend
+func Missing(tools []Tool) []string {
+	var problems []string
+	for _, t := range missingTools(tools) {
+		problems = append(problems, fmt.Sprintf("%s not found (%s), install the %s package", t.Binary, t.Reason, t.packageNames()))
+	}
+	if _, err := lookPath("iptables"); err == nil {
+		// kube-proxy writes the legacy tables so rules added with the nf_tables backend are never seen
+		if out, err := run("iptables", "--version"); err == nil && strings.Contains(out, "nf_tables") {
+			problems = append(problems, "iptables uses the nf_tables backend which kube-proxy doesn't support, switch to "+
+				"the legacy backend e.g. update-alternatives --set iptables /usr/sbin/iptables-legacy")
+		}
+	}
+	return problems
+}
+
+// missingTools returns the tools not found on the path
+func missingTools(tools []Tool) []Tool {
+	var missing []Tool
+	for _, t := range tools {
+		if _, err := lookPath(t.Binary); err != nil {
+			missing = append(missing, t)
+		}
+	}
+	return missing
+}
+
+// install will install the packages of the tools with the first package manager found
+func install(tools []Tool) error {
+	if len(tools) == 0 {
+		return nil
+	}
+	for _, pm := range packageManagers {
+		if _, err := lookPath(pm.Name); err != nil {
+			continue
+		}
+		var packages []string
+		for _, t := range tools {
+			packages = append(packages, t.packageName(pm.Name))
+		}
+		logger.Printf("Installing host prerequisites with %s: %s", pm.Name, strings.Join(packages, ", "))
+		if _, err := run(pm.Name, append(append([]string{}, pm.Install...), packages...)...); err != nil {
+			return fmt.Errorf("failed to install the host prerequisites with %s [%v]", pm.Name, err)
+		}
+		return nil
+	}
+	names := make([]string, 0, len(packageManagers))
+	for _, pm := range packageManagers {
+		names = append(names, pm.Name)
+	}
+	return fmt.Errorf("no package manager (%s) to install the host prerequisites with", strings.Join(names, ", "))
+}
+
+// packageName returns the package providing the tool for a package manager
+func (t Tool) packageName(manager string) string {
+	if name, ok := t.Packages[manager]; ok {
+		return name
+	}
+	return t.Binary
+}
+
+// packageNames lists the package for each package manager (when they differ) for a remediation message
+func (t Tool) packageNames() string {
+	if len(t.Packages) == 0 {
+		return t.Binary
+	}
+	var names []string
+	for manager, name := range t.Packages {
+		names = append(names, name+" ("+manager+")")
+	}
+	sort.Strings(names)
+	return t.Binary + " or " + strings.Join(names, ", ")
+}
@@ -0,0 +1,290 @@
+package prereq
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeHost has the binaries found on the path and records the commands run
+type fakeHost struct {
+	binaries map[string]bool
+	iptables string
+	ran      []string
+}
+
+func (h *fakeHost) lookPath(name string) (string, error) {
+	if h.binaries[name] {
+		return "/usr/sbin/" + name, nil
+	}
+	return "", fmt.Errorf("%s not found", name)
+}
+
+func (h *fakeHost) run(name string, args ...string) (string, error) {
+	h.ran = append(h.ran, name+" "+strings.Join(args, " "))
+	if name == "iptables" {
+		return h.iptables, nil
+	}
+	// The package manager installs the packages named
+	for _, arg := range args {
+		if arg == "conntrack-tools" {
+			arg = "conntrack"
+		}
+		h.binaries[arg] = true
+	}
+	return "", nil
+}
+
+// withHost replaces the host with the fake (and checks no disks)
+func withHost(t *testing.T, h *fakeHost, mode, provider string) func() {
+	oldLookPath, oldRun, oldMode, oldProvider, oldDiskPaths := lookPath, run, Mode, NetworkProvider, DiskPaths
+	lookPath, run, Mode, NetworkProvider, DiskPaths = h.lookPath, h.run, mode, provider, nil
+	return func() {
+		lookPath, run, Mode, NetworkProvider, DiskPaths = oldLookPath, oldRun, oldMode, oldProvider, oldDiskPaths
+	}
+}
+
+func TestTools(t *testing.T) {
+	var binaries []string
+	for _, tool := range Tools("weave") {
+		binaries = append(binaries, tool.Binary)
+	}
+	if !reflect.DeepEqual(binaries, []string{"iptables", "conntrack", "ebtables", "socat", "ipset"}) {
+		t.Errorf("unexpected weave tools %v", binaries)
+	}
+	if tools := Tools("flannel"); len(tools) != len(baseTools) {
+		t.Errorf("expected only the base tools for flannel but got %v", tools)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	h := &fakeHost{binaries: map[string]bool{"iptables": true, "ebtables": true}, iptables: "iptables v1.8.2 (nf_tables)"}
+	defer withHost(t, h, ModeCheck, "flannel")()
+
+	err := Check()
+	if err == nil {
+		t.Fatal("expected an error for the missing prerequisites")
+	}
+	for _, expected := range []string{"conntrack not found", "conntrack-tools (yum)", "socat not found", "iptables-legacy"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in the remediation but got: %v", expected, err)
+		}
+	}
+
+	// Only warnings are logged
+	Mode = ModeWarn
+	if err = Check(); err != nil {
+		t.Errorf("expected only warnings but got %v", err)
+	}
+
+	// Nothing is checked without a mode
+	Mode = ""
+	h.ran = nil
+	if err = Check(); err != nil || len(h.ran) > 0 {
+		t.Errorf("expected nothing to be checked but ran %v [%v]", h.ran, err)
+	}
+}
+
+func TestCheckInstall(t *testing.T) {
+	h := &fakeHost{binaries: map[string]bool{"iptables": true, "ebtables": true, "socat": true, "yum": true}}
+	defer withHost(t, h, ModeInstall, "canal")()
+
+	if err := Check(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"iptables --version", "yum install -y conntrack-tools ipset", "iptables --version"}
+	if !reflect.DeepEqual(h.ran, expected) {
+		t.Errorf("expected %v but ran %v", expected, h.ran)
+	}
+
+	// Without a package manager the missing tools can't be installed
+	h = &fakeHost{binaries: map[string]bool{"iptables": true}}
+	defer withHost(t, h, ModeInstall, "flannel")()
+	if err := Check(); err == nil || !strings.Contains(err.Error(), "no package manager") {
+		t.Errorf("expected an error without a package manager but got %v", err)
+	}
+}
+
+func TestValidateMode(t *testing.T) {
+	for _, mode := range []string{"", ModeWarn, ModeCheck, ModeInstall} {
+		if err := ValidateMode(mode); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := ValidateMode("ignore"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	h := &fakeHost{binaries: map[string]bool{"iptables": true, "conntrack": true, "ebtables": true, "socat": true}}
+	defer withHost(t, h, ModeCheck, "flannel")()
+	defer func(server string, offset func(string) (time.Duration, error)) {
+		NTPServer, clockOffset = server, offset
+	}(NTPServer, clockOffset)
+	NTPServer = "169.254.169.123"
+
+	skew := 3 * time.Second
+	clockOffset = func(server string) (time.Duration, error) { return -skew, nil }
+	if err := Check(); err == nil || !strings.Contains(err.Error(), "clock is 3s out from the NTP server 169.254.169.123") {
+		t.Errorf("expected an error for the skewed clock but got %v", err)
+	}
+	skew = time.Second
+	if err := Check(); err != nil {
+		t.Errorf("expected a clock within the max skew to pass but got %v", err)
+	}
+	// An unreachable server isn't a failure
+	clockOffset = func(server string) (time.Duration, error) { return 0, fmt.Errorf("timeout") }
+	if err := Check(); err != nil {
+		t.Errorf("expected only a warning when the NTP server can't be queried but got %v", err)
+	}
+}
+
+func TestQueryNTP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// The server clock is 10 seconds ahead
+	go func() {
+		req := make([]byte, 48)
+		_, addr, err := conn.ReadFrom(req)
+		if err != nil {
+			return
+		}
+		resp := make([]byte, 48)
+		resp[0], resp[1] = 0x1c, 2
+		now := time.Now().Add(10 * time.Second)
+		seconds := uint32(now.Unix() + ntpEpochOffset)
+		fraction := uint32(int64(now.Nanosecond()) << 32 / int64(time.Second))
+		for _, offset := range []int{32, 40} {
+			binary.BigEndian.PutUint32(resp[offset:], seconds)
+			binary.BigEndian.PutUint32(resp[offset+4:], fraction)
+		}
+		conn.WriteTo(resp, addr)
+	}()
+
+	offset, err := queryNTP(conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset < 9*time.Second || offset > 11*time.Second {
+		t.Errorf("expected an offset of about 10s but got %v", offset)
+	}
+}
+
+func TestUnreachableTargets(t *testing.T) {
+	h := &fakeHost{binaries: map[string]bool{"iptables": true, "conntrack": true, "ebtables": true, "socat": true}}
+	defer withHost(t, h, ModeCheck, "flannel")()
+	defer func(l func(string) ([]string, error), d func(string) error) { lookupHost, dial = l, d }(lookupHost, dial)
+	var dialled []string
+	lookupHost = func(host string) ([]string, error) {
+		if host == "api.example.com" {
+			return []string{"10.0.0.10"}, nil
+		}
+		return nil, fmt.Errorf("no such host")
+	}
+	dial = func(address string) error {
+		dialled = append(dialled, address)
+		if address == "10.0.1.12:2379" {
+			return fmt.Errorf("connection refused")
+		}
+		return nil
+	}
+	api, _ := url.Parse("https://api.example.com")
+	targets := append(EtcdTargets("https://10.0.1.11:2379,https://10.0.1.12:2379, etcd3.example.com:2379"), APITarget(api, false)...)
+
+	err := Check(targets...)
+	if err == nil {
+		t.Fatal("expected an error for the unreachable targets")
+	}
+	for _, expected := range []string{
+		"etcd endpoint https://10.0.1.12:2379 unreachable: TCP connection to 10.0.1.12:2379 failed",
+		"etcd endpoint etcd3.example.com:2379 unreachable: DNS lookup failed",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in the remediation but got: %v", expected, err)
+		}
+	}
+	if strings.Contains(err.Error(), "10.0.1.11") || strings.Contains(err.Error(), "api server") {
+		t.Errorf("expected only the unreachable targets to be reported but got: %v", err)
+	}
+	if !reflect.DeepEqual(dialled, []string{"10.0.1.11:2379", "10.0.1.12:2379", "api.example.com:443"}) {
+		t.Errorf("unexpected connections %v", dialled)
+	}
+
+	// The api load balancer is only resolved on masters
+	dialled = nil
+	if err = Check(APITarget(api, true)...); err != nil || len(dialled) > 0 {
+		t.Errorf("expected the api server to only be resolved but dialled %v [%v]", dialled, err)
+	}
+	if targets = APITarget(nil, true); len(targets) > 0 {
+		t.Errorf("expected no target without an api server but got %v", targets)
+	}
+}
+
+func TestLowDisk(t *testing.T) {
+	h := &fakeHost{binaries: map[string]bool{"iptables": true, "conntrack": true, "ebtables": true, "socat": true}}
+	defer withHost(t, h, ModeCheck, "flannel")()
+	defer func(s func(string, *syscall.Statfs_t) error, d func(string) (uint64, error)) { statfs, device = s, d }(statfs, device)
+	dir, err := ioutil.TempDir("", "prereq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	kubelet := filepath.Join(dir, "kubelet")
+	if err = os.Mkdir(kubelet, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// The kubelet dir is its own (read-only) filesystem, the rest share the root (short of space and inodes)
+	filesystems := map[string]syscall.Statfs_t{
+		dir:     {Bsize: 4096, Bavail: 1024 * 256, Files: 100000, Ffree: 1000},
+		kubelet: {Bsize: 4096, Bavail: 1024 * 1024, Files: 100000, Ffree: 100000, Flags: stReadOnly},
+	}
+	device = func(path string) (uint64, error) {
+		if path == kubelet {
+			return 2, nil
+		}
+		return 1, nil
+	}
+	statfs = func(path string, stat *syscall.Statfs_t) error {
+		fs, ok := filesystems[path]
+		if !ok {
+			return fmt.Errorf("unexpected path %s", path)
+		}
+		*stat = fs
+		return nil
+	}
+	DiskPaths = []string{filepath.Join(dir, "kubernetes"), kubelet, filepath.Join(dir, "docker")}
+
+	err = Check()
+	if err == nil {
+		t.Fatal("expected an error for the low disk")
+	}
+	for _, expected := range []string{
+		"the filesystem of " + DiskPaths[0] + ", " + DiskPaths[2] + " has 1024MiB free (less than 2048MiB)",
+		"has 1000 inodes free (less than 50000)",
+		"the filesystem of " + kubelet + " is read-only",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in the remediation but got: %v", expected, err)
+		}
+	}
+
+	MinFreeDiskMB, MinFreeInodes = 512, 500
+	defer func() { MinFreeDiskMB, MinFreeInodes = DefaultMinFreeDiskMB, DefaultMinFreeInodes }()
+	DiskPaths = DiskPaths[:1]
+	if err = Check(); err != nil {
+		t.Errorf("expected the lower thresholds to pass but got %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package priority
+
+import (
+	"bytes"
+	"encoding/json"
+	"text/template"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+	"k8s.io/kubernetes/pkg/util/version"
+)
+
+const (
+	// NodeCritical is the class for pods which must run on every node (static pods, CNI, tokens)
+	NodeCritical = "system-node-critical"
+
+	// ClusterCritical is the class for pods the cluster can't function without (e.g. DNS)
+	ClusterCritical = "system-cluster-critical"
+
+	// CriticalPodAnnotation marks a pod as critical for the rescheduler (pre priority class versions)
+	CriticalPodAnnotation = "scheduler.alpha.kubernetes.io/critical-pod"
+
+	// ketoClassPrefix is used for the custom classes created where the system classes don't exist
+	ketoClassPrefix = "keto-"
+)
+
+var (
+	// First version with any PriorityClass API (alpha)
+	minPriorityClassVersion = version.MustParseGeneric("v1.8.0")
+	// First version with the built-in system-* classes
+	minSystemClassVersion = version.MustParseGeneric("v1.11.0")
+)
+
+// maxCustomValue is the highest value allowed for a class which isn't a system class
+const maxCustomValue = 1000000000
+
+// customClasses are the values to use when creating our own copies of the system classes (in the same order)
+var customClasses = []struct {
+	Name  string
+	Value int
+}{
+	{Name: ketoClassPrefix + NodeCritical, Value: maxCustomValue},
+	{Name: ketoClassPrefix + ClusterCritical, Value: maxCustomValue - 1000},
+}
+
+const priorityClassTemplate = `{{ range .Classes }}
+---
+apiVersion: scheduling.k8s.io/v1alpha1
+kind: PriorityClass
+metadata:
+  name: {{ .Name }}
+  labels:
+    owner: keto-k8
+value: {{ .Value }}
+globalDefault: false
+{{ end }}`
+
+// ClassName will return the priority class to use for a system class at a kubernetes version
+// An empty string is returned when priority classes aren't supported
+func ClassName(kubeVersion, class string) string {
+	v, err := version.ParseGeneric(kubeVersion)
+	if err != nil || v.LessThan(minPriorityClassVersion) {
+		return ""
+	}
+	if v.LessThan(minSystemClassVersion) {
+		return ketoClassPrefix + class
+	}
+	return class
+}
+
+// StaticPodClassName will return the class for static pods (which can only use the built-in classes)
+func StaticPodClassName(kubeVersion string) string {
+	if name := ClassName(kubeVersion, NodeCritical); name == NodeCritical {
+		return name
+	}
+	return ""
+}
+
+// CustomClassesYaml returns the resources for any classes to be created for a kubernetes version
+// (empty if the system classes exist or priority isn't supported)
+func CustomClassesYaml(kubeVersion string) (string, error) {
+	name := ClassName(kubeVersion, NodeCritical)
+	if name == "" || name == NodeCritical {
+		return "", nil
+	}
+	data := struct {
+		Classes interface{}
+	}{
+		Classes: customClasses,
+	}
+	t := template.Must(template.New("priorityClasses").Parse(priorityClassTemplate))
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Mutator returns a podspec.Mutator marking all pods as critical with the correct class
+func Mutator(kubeVersion, class string) podspec.Mutator {
+	className := ClassName(kubeVersion, class)
+	return func(o podspec.Object) error {
+		if !o.HasPodSpec() {
+			return nil
+		}
+		o.SetPodAnnotation(CriticalPodAnnotation, "")
+		o.AddToleration(map[string]interface{}{
+			"key":      "CriticalAddonsOnly",
+			"operator": "Exists",
+		})
+		if className != "" {
+			o.SetPodSpecField("priorityClassName", className)
+		}
+		return nil
+	}
+}
+
+// StaticPodMutator returns a podspec.Mutator for the control plane static pods
+func StaticPodMutator(kubeVersion string) podspec.Mutator {
+	className := StaticPodClassName(kubeVersion)
+	return func(o podspec.Object) error {
+		o.SetPodAnnotation(CriticalPodAnnotation, "")
+		if className != "" {
+			o.SetPodSpecField("priorityClassName", className)
+		}
+		return nil
+	}
+}
+
+// Patch returns a merge patch to mark an existing workload as critical
+func Patch(kubeVersion, class string) (string, error) {
+	workload := podspec.Object{"kind": "Deployment"}
+	if err := Mutator(kubeVersion, class)(workload); err != nil {
+		return "", err
+	}
+	// Only the pod template is patched (and tolerations are left to the addon)
+	spec := map[string]interface{}{}
+	if className, ok := workload.PodSpec()["priorityClassName"]; ok {
+		spec["priorityClassName"] = className
+	}
+	patch := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": workload.PodMetadata(),
+				"spec":     spec,
+			},
+		},
+	}
+	b, err := json.Marshal(patch)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
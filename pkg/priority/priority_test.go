@@ -0,0 +1,42 @@
+package priority
+
+import (
+	"testing"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+)
+
+func TestCustomClassesYaml(t *testing.T) {
+	for _, v := range []string{"v1.7.5", "v1.11.0"} {
+		if yaml, err := CustomClassesYaml(v); err != nil || yaml != "" {
+			t.Errorf("expected no custom classes for %s but got %q (%v)", v, yaml, err)
+		}
+	}
+
+	yaml, err := CustomClassesYaml("v1.8.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs, err := podspec.Decode(yaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 2 {
+		t.Fatalf("expected the node and cluster critical classes but got %d", len(objs))
+	}
+	values := map[string]float64{}
+	for _, o := range objs {
+		// Decoded as json numbers
+		value, ok := o["value"].(float64)
+		if !ok {
+			t.Fatalf("unexpected value for %s: %v", o.Name(), o["value"])
+		}
+		if value > maxCustomValue {
+			t.Errorf("expected %s to be at most %d but got %v", o.Name(), maxCustomValue, value)
+		}
+		values[o.Name()] = value
+	}
+	if values["keto-"+NodeCritical] <= values["keto-"+ClusterCritical] {
+		t.Errorf("expected node critical pods to have the higher priority but got %v", values)
+	}
+}
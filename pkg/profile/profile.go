@@ -0,0 +1,178 @@
+package profile
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// barWidth is the width of the bar for the longest phase in the report
+const barWidth = 40
+
+// Operation is the total time taken by all the runs of an operation (e.g. a subprocess or etcd request) in a phase
+type Operation struct {
+	Name  string
+	Count int
+	Wall  time.Duration
+	// CPU is only recorded for subprocesses
+	CPU time.Duration
+}
+
+// Phase is the time taken by a bootstrap phase
+// The CPU time is for keto-k8 and all the subprocesses it waited for
+type Phase struct {
+	Name       string
+	Wall       time.Duration
+	CPU        time.Duration
+	Operations []*Operation
+	started    time.Time
+	startedCPU time.Duration
+	ended      bool
+}
+
+var (
+	mu      sync.Mutex
+	enabled bool
+	phases  []*Phase
+	// now and cpuTime are replaced in tests
+	now     = time.Now
+	cpuTime = processCPUTime
+)
+
+// Enable will start recording the time taken by each phase and operation
+func Enable() {
+	mu.Lock()
+	defer mu.Unlock()
+	enabled = true
+	phases = nil
+}
+
+// Enabled is true when profiling
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return enabled
+}
+
+// StartPhase will end the current phase and start another (a no-op unless enabled)
+func StartPhase(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if !enabled {
+		return
+	}
+	endPhase()
+	phases = append(phases, &Phase{Name: name, started: now(), startedCPU: cpuTime()})
+}
+
+// Record will add the time taken by an operation to the current phase (a no-op unless enabled)
+func Record(name string, wall, cpu time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	if !enabled {
+		return
+	}
+	if len(phases) == 0 {
+		phases = append(phases, &Phase{Name: "-", started: now(), startedCPU: cpuTime()})
+	}
+	p := phases[len(phases)-1]
+	for _, o := range p.Operations {
+		if o.Name == name {
+			o.Count++
+			o.Wall += wall
+			o.CPU += cpu
+			return
+		}
+	}
+	p.Operations = append(p.Operations, &Operation{Name: name, Count: 1, Wall: wall, CPU: cpu})
+}
+
+// Phases will end the current phase and return all the phases recorded
+func Phases() []Phase {
+	mu.Lock()
+	defer mu.Unlock()
+	endPhase()
+	result := []Phase{}
+	for _, p := range phases {
+		result = append(result, *p)
+	}
+	return result
+}
+
+// Report will write a flame style summary of the phases, with the operations of each phase (slowest first)
+// Operations run at once (e.g. parallel bootstrap steps) can add up to more than their phase
+func Report(w io.Writer) {
+	recorded := Phases()
+	var total, longest time.Duration
+	for _, p := range recorded {
+		total += p.Wall
+		if p.Wall > longest {
+			longest = p.Wall
+		}
+	}
+	fmt.Fprintf(w, "Bootstrap profile (total %v):\n", round(total))
+	fmt.Fprintf(w, "%-32s %10s %10s\n", "PHASE / OPERATION", "WALL", "CPU")
+	for _, p := range recorded {
+		fmt.Fprintf(w, "%-32s %10v %10v %s\n", p.Name, round(p.Wall), round(p.CPU), bar(p.Wall, longest))
+		operations := append([]*Operation{}, p.Operations...)
+		sort.Slice(operations, func(i, j int) bool {
+			return operations[i].Wall > operations[j].Wall
+		})
+		for _, o := range operations {
+			name := "  " + o.Name
+			if o.Count > 1 {
+				name = fmt.Sprintf("%s (x%d)", name, o.Count)
+			}
+			cpu := "-"
+			if o.CPU > 0 {
+				cpu = round(o.CPU).String()
+			}
+			fmt.Fprintf(w, "%-32s %10v %10s %s\n", name, round(o.Wall), cpu, bar(o.Wall, longest))
+		}
+	}
+}
+
+// endPhase will set the times of the last phase (if still running)
+func endPhase() {
+	if last := len(phases) - 1; last >= 0 && !phases[last].ended {
+		phases[last].Wall = now().Sub(phases[last].started)
+		phases[last].CPU = cpuTime() - phases[last].startedCPU
+		phases[last].ended = true
+	}
+}
+
+// bar returns a bar scaled to the longest phase
+func bar(d, longest time.Duration) string {
+	if longest <= 0 {
+		return ""
+	}
+	width := int(int64(barWidth) * int64(d) / int64(longest))
+	if width < 1 && d > 0 {
+		width = 1
+	}
+	if width > barWidth {
+		width = barWidth
+	}
+	return strings.Repeat("#", width)
+}
+
+func round(d time.Duration) time.Duration {
+	return d - d%time.Millisecond
+}
+
+// processCPUTime returns the CPU time used by keto-k8 and the subprocesses it has waited for
+func processCPUTime() time.Duration {
+	var total time.Duration
+	for _, who := range []int{syscall.RUSAGE_SELF, syscall.RUSAGE_CHILDREN} {
+		var usage syscall.Rusage
+		if err := syscall.Getrusage(who, &usage); err != nil {
+			continue
+		}
+		total += time.Duration(usage.Utime.Nano()) + time.Duration(usage.Stime.Nano())
+	}
+	return total
+}
@@ -0,0 +1,63 @@
+package profile
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	clock := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+	var cpu time.Duration
+	cpuTime = func() time.Duration {
+		cpu += 100 * time.Millisecond
+		return cpu
+	}
+	defer func() {
+		now = time.Now
+		cpuTime = processCPUTime
+		enabled = false
+	}()
+
+	Record("ignored", time.Second, 0)
+	Enable()
+	StartPhase("prepare")
+	Record("step cloud", 300*time.Millisecond, 0)
+	StartPhase("primary")
+	Record("kubeadm alpha", 200*time.Millisecond, 150*time.Millisecond)
+	Record("kubeadm alpha", 400*time.Millisecond, 250*time.Millisecond)
+	Record("etcd.Get", 10*time.Millisecond, 0)
+
+	recorded := Phases()
+	if len(recorded) != 2 || recorded[0].Wall != time.Second || recorded[1].CPU != 100*time.Millisecond {
+		t.Fatalf("unexpected phases %+v", recorded)
+	}
+	if ops := recorded[1].Operations; len(ops) != 2 || ops[0].Count != 2 || ops[0].Wall != 600*time.Millisecond || ops[0].CPU != 400*time.Millisecond {
+		t.Errorf("unexpected operations %+v", ops)
+	}
+
+	var out bytes.Buffer
+	Report(&out)
+	report := out.String()
+	for _, expected := range []string{
+		"Bootstrap profile (total 2s)",
+		"  kubeadm alpha (x2)",
+		"400ms",
+		strings.Repeat("#", barWidth),
+	} {
+		if !strings.Contains(report, expected) {
+			t.Errorf("expected %q in the report:\n%s", expected, report)
+		}
+	}
+	if strings.Contains(report, "ignored") {
+		t.Errorf("expected nothing recorded before profiling was enabled:\n%s", report)
+	}
+	if strings.Index(report, "kubeadm alpha") > strings.Index(report, "etcd.Get") {
+		t.Errorf("expected the slowest operations first:\n%s", report)
+	}
+}
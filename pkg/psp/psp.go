@@ -0,0 +1,170 @@
+package psp
+
+import (
+	"strings"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/render"
+	"k8s.io/kubernetes/pkg/util/version"
+)
+
+const (
+	// AdmissionPlugin is the apiserver admission plugin enforcing policies
+	AdmissionPlugin = "PodSecurityPolicy"
+
+	// Privileged is the policy for kube-system components (CNI, kube-proxy, keto-tokens)
+	Privileged = "keto-privileged"
+
+	// Restricted is the default policy for all other pods
+	Restricted = "keto-restricted"
+)
+
+// First version serving policies from the policy api group
+var minPolicyGroupVersion = version.MustParseGeneric("v1.10.0")
+
+const policiesTemplate = `apiVersion: {{ .APIGroup }}/v1beta1
+kind: PodSecurityPolicy
+metadata:
+  name: {{ .Privileged }}
+  annotations:
+    seccomp.security.alpha.kubernetes.io/allowedProfileNames: '*'
+spec:
+  privileged: true
+  allowPrivilegeEscalation: true
+  allowedCapabilities: ['*']
+  volumes: ['*']
+  hostNetwork: true
+  hostPorts:
+  - min: 0
+    max: 65535
+  hostIPC: true
+  hostPID: true
+  runAsUser:
+    rule: RunAsAny
+  seLinux:
+    rule: RunAsAny
+  supplementalGroups:
+    rule: RunAsAny
+  fsGroup:
+    rule: RunAsAny
+---
+apiVersion: {{ .APIGroup }}/v1beta1
+kind: PodSecurityPolicy
+metadata:
+  name: {{ .Restricted }}
+  annotations:
+    seccomp.security.alpha.kubernetes.io/allowedProfileNames: 'docker/default'
+    seccomp.security.alpha.kubernetes.io/defaultProfileName: 'docker/default'
+spec:
+  privileged: false
+  allowPrivilegeEscalation: false
+  requiredDropCapabilities: ['ALL']
+  volumes:
+  - configMap
+  - emptyDir
+  - projected
+  - secret
+  - downwardAPI
+  - persistentVolumeClaim
+  hostNetwork: false
+  hostIPC: false
+  hostPID: false
+  runAsUser:
+    rule: MustRunAsNonRoot
+  seLinux:
+    rule: RunAsAny
+  supplementalGroups:
+    rule: MustRunAs
+    ranges:
+    - min: 1
+      max: 65535
+  fsGroup:
+    rule: MustRunAs
+    ranges:
+    - min: 1
+      max: 65535
+  readOnlyRootFilesystem: false
+{{- range .Policies }}
+---
+kind: ClusterRole
+apiVersion: rbac.authorization.k8s.io/v1beta1
+metadata:
+  name: psp:{{ .Name }}
+rules:
+- apiGroups: ["{{ $.APIGroup }}"]
+  resources: ["podsecuritypolicies"]
+  resourceNames: ["{{ .Name }}"]
+  verbs: ["use"]
+{{- end }}
+---
+# All kube-system service accounts (CNI, kube-proxy, kube-dns, keto-tokens) and nodes (mirror pods)
+kind: RoleBinding
+apiVersion: rbac.authorization.k8s.io/v1beta1
+metadata:
+  name: psp:{{ .Privileged }}
+  namespace: kube-system
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: psp:{{ .Privileged }}
+subjects:
+- kind: Group
+  apiGroup: rbac.authorization.k8s.io
+  name: system:serviceaccounts:kube-system
+- kind: Group
+  apiGroup: rbac.authorization.k8s.io
+  name: system:nodes
+---
+kind: ClusterRoleBinding
+apiVersion: rbac.authorization.k8s.io/v1beta1
+metadata:
+  name: psp:{{ .Restricted }}
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: psp:{{ .Restricted }}
+subjects:
+- kind: Group
+  apiGroup: rbac.authorization.k8s.io
+  name: system:authenticated
+`
+
+// APIGroup returns the api group serving policies at a kubernetes version
+func APIGroup(kubeVersion string) string {
+	v, err := version.ParseGeneric(kubeVersion)
+	if err != nil || v.LessThan(minPolicyGroupVersion) {
+		return "extensions"
+	}
+	return "policy"
+}
+
+// Yaml returns the baseline policies and the RBAC to use them
+func Yaml(kubeVersion string) (string, error) {
+	data := struct {
+		APIGroup   string
+		Privileged string
+		Restricted string
+		Policies   []struct{ Name string }
+	}{
+		APIGroup:   APIGroup(kubeVersion),
+		Privileged: Privileged,
+		Restricted: Restricted,
+		Policies:   []struct{ Name string }{{Name: Privileged}, {Name: Restricted}},
+	}
+	return render.Template("podSecurityPolicies", policiesTemplate, data)
+}
+
+// ClusterRoleName returns the role granting use of a policy
+func ClusterRoleName(policy string) string {
+	return "psp:" + policy
+}
+
+// AddAdmissionPlugin will add the PodSecurityPolicy plugin to an admission control list
+func AddAdmissionPlugin(admissionControl string) string {
+	plugins := strings.Split(admissionControl, ",")
+	for _, plugin := range plugins {
+		if plugin == AdmissionPlugin {
+			return admissionControl
+		}
+	}
+	return strings.Join(append(plugins, AdmissionPlugin), ",")
+}
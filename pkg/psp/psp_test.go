@@ -0,0 +1,35 @@
+package psp
+
+import (
+	"testing"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+)
+
+func TestYaml(t *testing.T) {
+	for kubeVersion, group := range map[string]string{"v1.7.5": "extensions", "v1.10.0": "policy"} {
+		policies, err := Yaml(kubeVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		objs, err := podspec.Decode(policies)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if objs[0]["apiVersion"] != group+"/v1beta1" {
+			t.Errorf("expected api group %s for %s but got %v", group, kubeVersion, objs[0]["apiVersion"])
+		}
+		if len(objs) != 6 {
+			t.Errorf("expected 2 policies, 2 roles and 2 bindings but got %d resources", len(objs))
+		}
+	}
+}
+
+func TestAddAdmissionPlugin(t *testing.T) {
+	if got := AddAdmissionPlugin("NamespaceLifecycle,ServiceAccount"); got != "NamespaceLifecycle,ServiceAccount,PodSecurityPolicy" {
+		t.Errorf("expected plugin to be appended but got %s", got)
+	}
+	if got := AddAdmissionPlugin("PodSecurityPolicy,ServiceAccount"); got != "PodSecurityPolicy,ServiceAccount" {
+		t.Errorf("expected plugin not to be added twice but got %s", got)
+	}
+}
@@ -0,0 +1,286 @@
+package publish
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/logging"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+var logger = logging.New("publish")
+
+const (
+	// DefaultOperatorUser is the client cert common name of the operator kubeconfig
+	DefaultOperatorUser = "keto-operator"
+	// DefaultOperatorGroup is the client cert organisation of the operator kubeconfig
+	DefaultOperatorGroup = "keto:operators"
+	// DefaultOperatorClusterRole is the role the operator group is bound to
+	DefaultOperatorClusterRole = "view"
+
+	// ssmStandardLimit is the largest standard tier parameter (a kubeconfig with a CA chain is often bigger)
+	ssmStandardLimit = 4096
+)
+
+// Timeout for each request to publish the kubeconfig
+var Timeout = 30 * time.Second
+
+// privilegedRoles would make the operator kubeconfig the same as the admin kubeconfig
+var privilegedRoles = map[string]bool{
+	"cluster-admin": true,
+}
+
+// Config is where the kubeconfig operators use is published once the primary master has created the cluster (from
+// the config file), each destination is encrypted with the KMS key
+type Config struct {
+	// KMSKeyID is the key id, alias or ARN (the instance role must be allowed to use it)
+	KMSKeyID string `json:"kmsKeyID"`
+	// Region of the destinations (the region of the instance when not set)
+	Region string `json:"region,omitempty"`
+	// S3 publishes an object (the instance role must allow s3:PutObject)
+	S3 *S3 `json:"s3,omitempty"`
+	// SSM publishes a SecureString parameter (the instance role must allow ssm:PutParameter)
+	SSM *SSM `json:"ssm,omitempty"`
+	// SecretsManager publishes a secret (the instance role must allow secretsmanager:CreateSecret and PutSecretValue)
+	SecretsManager *SecretsManager `json:"secretsManager,omitempty"`
+	// Operator publishes a reduced privilege kubeconfig instead of the admin kubeconfig
+	Operator *Operator `json:"operator,omitempty"`
+}
+
+// S3 is a bucket the kubeconfig is uploaded to
+type S3 struct {
+	Bucket string `json:"bucket"`
+	// Key is the object name (<cluster>/kubeconfig when not set)
+	Key string `json:"key,omitempty"`
+}
+
+// SSM is a parameter store parameter
+type SSM struct {
+	// Name of the parameter (/keto-k8/<cluster>/kubeconfig when not set)
+	Name string `json:"name,omitempty"`
+}
+
+// SecretsManager is a secret
+type SecretsManager struct {
+	// Name of the secret (keto-k8/<cluster>/kubeconfig when not set)
+	Name string `json:"name,omitempty"`
+}
+
+// Operator is the user and group of the operator kubeconfig client cert, the group is bound to the cluster role
+type Operator struct {
+	User        string `json:"user,omitempty"`
+	Group       string `json:"group,omitempty"`
+	ClusterRole string `json:"clusterRole,omitempty"`
+}
+
+// destination is somewhere the kubeconfig is published
+type destination interface {
+	publish(sess *session.Session, keyID, cluster string, kubeconfig []byte) (string, error)
+}
+
+// Validate will check there's a key and at least one complete destination
+func (c *Config) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if len(c.KMSKeyID) == 0 {
+		return fmt.Errorf("publish kmsKeyID is required")
+	}
+	if c.S3 == nil && c.SSM == nil && c.SecretsManager == nil {
+		return fmt.Errorf("publish needs an s3, ssm or secretsManager destination")
+	}
+	if c.S3 != nil && len(c.S3.Bucket) == 0 {
+		return fmt.Errorf("publish s3 bucket is required")
+	}
+	if c.Operator != nil && privilegedRoles[c.Operator.role()] {
+		return fmt.Errorf("publish operator clusterRole %q isn't reduced privilege (publish the admin kubeconfig instead)",
+			c.Operator.role())
+	}
+	return nil
+}
+
+// Publish will upload the kubeconfig to every destination (nil publishes nothing)
+func Publish(c *Config, cluster string, kubeconfig []byte) error {
+	if c == nil {
+		return nil
+	}
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	// The default names are by cluster, without one clusters would overwrite each other's kubeconfig
+	if len(cluster) == 0 {
+		return fmt.Errorf("the cluster name is required to publish the kubeconfig")
+	}
+	region := c.Region
+	httpClient := &http.Client{Timeout: Timeout}
+	if len(region) == 0 {
+		var err error
+		if region, err = ec2metadata.New(session.New(&aws.Config{HTTPClient: httpClient})).Region(); err != nil {
+			return fmt.Errorf("publish region not set and not found in the instance metadata [%v]", err)
+		}
+	}
+	sess := session.New(&aws.Config{
+		Region:     aws.String(region),
+		HTTPClient: httpClient,
+	})
+	var failed []string
+	for _, d := range c.destinations() {
+		location, err := d.publish(sess, c.KMSKeyID, cluster, kubeconfig)
+		if err != nil {
+			failed = append(failed, err.Error())
+			continue
+		}
+		logger.Printf("Published the kubeconfig to %s", location)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("error publishing the kubeconfig: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// destinations returns the configured destinations
+func (c *Config) destinations() []destination {
+	var d []destination
+	if c.S3 != nil {
+		d = append(d, c.S3)
+	}
+	if c.SSM != nil {
+		d = append(d, c.SSM)
+	}
+	if c.SecretsManager != nil {
+		d = append(d, c.SecretsManager)
+	}
+	return d
+}
+
+// key returns the object name
+func (s *S3) key(cluster string) string {
+	if len(s.Key) > 0 {
+		return s.Key
+	}
+	return cluster + "/kubeconfig"
+}
+
+func (s *S3) publish(sess *session.Session, keyID, cluster string, kubeconfig []byte) (string, error) {
+	location := "s3://" + s.Bucket + "/" + s.key(cluster)
+	_, err := s3.New(sess).PutObject(&s3.PutObjectInput{
+		Bucket:               aws.String(s.Bucket),
+		Key:                  aws.String(s.key(cluster)),
+		Body:                 bytes.NewReader(kubeconfig),
+		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAwsKms),
+		SSEKMSKeyId:          aws.String(keyID),
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s [%v]", location, err)
+	}
+	return location, nil
+}
+
+// name returns the parameter name
+func (s *SSM) name(cluster string) string {
+	if len(s.Name) > 0 {
+		return s.Name
+	}
+	return "/keto-k8/" + cluster + "/kubeconfig"
+}
+
+func (s *SSM) publish(sess *session.Session, keyID, cluster string, kubeconfig []byte) (string, error) {
+	location := "ssm parameter " + s.name(cluster)
+	tier := ssm.ParameterTierStandard
+	if len(kubeconfig) > ssmStandardLimit {
+		tier = ssm.ParameterTierAdvanced
+	}
+	_, err := ssm.New(sess).PutParameter(&ssm.PutParameterInput{
+		Name:        aws.String(s.name(cluster)),
+		Description: aws.String("keto-k8 kubeconfig for cluster " + cluster),
+		Type:        aws.String(ssm.ParameterTypeSecureString),
+		KeyId:       aws.String(keyID),
+		Value:       aws.String(string(kubeconfig)),
+		Tier:        aws.String(tier),
+		Overwrite:   aws.Bool(true),
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s [%v]", location, err)
+	}
+	return location, nil
+}
+
+// name returns the secret name
+func (s *SecretsManager) name(cluster string) string {
+	if len(s.Name) > 0 {
+		return s.Name
+	}
+	return "keto-k8/" + cluster + "/kubeconfig"
+}
+
+func (s *SecretsManager) publish(sess *session.Session, keyID, cluster string, kubeconfig []byte) (string, error) {
+	location := "secret " + s.name(cluster)
+	svc := secretsmanager.New(sess)
+	_, err := svc.CreateSecret(&secretsmanager.CreateSecretInput{
+		Name:         aws.String(s.name(cluster)),
+		Description:  aws.String("keto-k8 kubeconfig for cluster " + cluster),
+		KmsKeyId:     aws.String(keyID),
+		SecretString: aws.String(string(kubeconfig)),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == secretsmanager.ErrCodeResourceExistsException {
+		// e.g. the cluster was rebuilt, the new kubeconfig becomes the current version
+		_, err = svc.PutSecretValue(&secretsmanager.PutSecretValueInput{
+			SecretId:     aws.String(s.name(cluster)),
+			SecretString: aws.String(string(kubeconfig)),
+		})
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s [%v]", location, err)
+	}
+	return location, nil
+}
+
+// UserName returns the client cert common name
+func (o *Operator) UserName() string {
+	if len(o.User) > 0 {
+		return o.User
+	}
+	return DefaultOperatorUser
+}
+
+// GroupName returns the client cert organisation
+func (o *Operator) GroupName() string {
+	if len(o.Group) > 0 {
+		return o.Group
+	}
+	return DefaultOperatorGroup
+}
+
+// role returns the cluster role the group is bound to
+func (o *Operator) role() string {
+	if len(o.ClusterRole) > 0 {
+		return o.ClusterRole
+	}
+	return DefaultOperatorClusterRole
+}
+
+// ClusterRoleBinding returns the binding of the operator group to its cluster role
+func (o *Operator) ClusterRoleBinding() string {
+	return fmt.Sprintf(`apiVersion: rbac.authorization.k8s.io/v1beta1
+kind: ClusterRoleBinding
+metadata:
+  name: keto:operators
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: %s
+subjects:
+- apiGroup: rbac.authorization.k8s.io
+  kind: Group
+  name: %s
+`, o.role(), o.GroupName())
+}
@@ -0,0 +1,63 @@
+package publish
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+func TestValidate(t *testing.T) {
+	for _, test := range []struct {
+		config *Config
+		valid  bool
+	}{
+		{nil, true},
+		{&Config{KMSKeyID: "alias/keto-k8", S3: &S3{Bucket: "access"}}, true},
+		{&Config{KMSKeyID: "alias/keto-k8", SSM: &SSM{}, SecretsManager: &SecretsManager{}}, true},
+		{&Config{S3: &S3{Bucket: "access"}}, false},
+		{&Config{KMSKeyID: "alias/keto-k8"}, false},
+		{&Config{KMSKeyID: "alias/keto-k8", S3: &S3{}}, false},
+		{&Config{KMSKeyID: "alias/keto-k8", SSM: &SSM{}, Operator: &Operator{ClusterRole: "cluster-admin"}}, false},
+	} {
+		if err := test.config.Validate(); (err == nil) != test.valid {
+			t.Errorf("expected %+v valid %v but got %v", test.config, test.valid, err)
+		}
+	}
+}
+
+func TestPublishNeedsCluster(t *testing.T) {
+	c := &Config{KMSKeyID: "alias/keto-k8", S3: &S3{Bucket: "access"}}
+	if err := Publish(c, "", []byte("kubeconfig")); err == nil || !strings.Contains(err.Error(), "cluster name") {
+		t.Errorf("expected publishing without a cluster name to fail but got %v", err)
+	}
+}
+
+func TestNames(t *testing.T) {
+	if key := (&S3{Bucket: "access"}).key("prod"); key != "prod/kubeconfig" {
+		t.Errorf("unexpected default s3 key %q", key)
+	}
+	if name := (&SSM{}).name("prod"); name != "/keto-k8/prod/kubeconfig" {
+		t.Errorf("unexpected default ssm name %q", name)
+	}
+	if name := (&SecretsManager{Name: "ops/prod"}).name("prod"); name != "ops/prod" {
+		t.Errorf("unexpected secret name %q", name)
+	}
+}
+
+func TestClusterRoleBinding(t *testing.T) {
+	o := &Operator{Group: "ops"}
+	binding := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(o.ClusterRoleBinding()), &binding); err != nil {
+		t.Fatal(err)
+	}
+	roleRef, _ := binding["roleRef"].(map[string]interface{})
+	subjects, _ := binding["subjects"].([]interface{})
+	if roleRef["name"] != DefaultOperatorClusterRole || len(subjects) != 1 ||
+		!strings.Contains(o.ClusterRoleBinding(), "name: ops") {
+		t.Errorf("unexpected binding %v", binding)
+	}
+	if o.UserName() != DefaultOperatorUser || o.GroupName() != "ops" {
+		t.Errorf("unexpected operator %s/%s", o.UserName(), o.GroupName())
+	}
+}
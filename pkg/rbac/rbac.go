@@ -0,0 +1,92 @@
+package rbac
+
+import (
+	"fmt"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/artifacts"
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+)
+
+// kinds are the resources which grant API access
+var kinds = map[string]bool{
+	"ServiceAccount":     true,
+	"Role":               true,
+	"RoleBinding":        true,
+	"ClusterRole":        true,
+	"ClusterRoleBinding": true,
+}
+
+// privilegedRoles are the built-in roles no keto-k8 component should be bound to
+var privilegedRoles = map[string]bool{
+	"cluster-admin": true,
+	"admin":         true,
+	"edit":          true,
+}
+
+// Filter returns only the RBAC resources
+func Filter(objs []podspec.Object) []podspec.Object {
+	var rbacObjs []podspec.Object
+	for _, o := range objs {
+		if kinds[o.Kind()] {
+			rbacObjs = append(rbacObjs, o)
+		}
+	}
+	return rbacObjs
+}
+
+// Audit will check the RBAC resources are explicit and minimal:
+// - no bindings to the privileged built-in roles
+// - no wildcard api groups, resources or verbs
+func Audit(component string, objs []podspec.Object) error {
+	for _, o := range Filter(objs) {
+		switch o.Kind() {
+		case "RoleBinding", "ClusterRoleBinding":
+			roleRef, _ := o["roleRef"].(map[string]interface{})
+			if name, _ := roleRef["name"].(string); privilegedRoles[name] {
+				return fmt.Errorf("%s %s %q binds to the built-in role %q", component, o.Kind(), o.Name(), name)
+			}
+		case "Role", "ClusterRole":
+			rules, _ := o["rules"].([]interface{})
+			for _, r := range rules {
+				rule, _ := r.(map[string]interface{})
+				for _, field := range []string{"apiGroups", "resources", "verbs"} {
+					if hasWildcard(rule[field]) {
+						return fmt.Errorf("%s %s %q has a wildcard in %s", component, o.Kind(), o.Name(), field)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Save will audit and then write the RBAC resources of a component to the artifacts directory
+func Save(component string, objs []podspec.Object) error {
+	if err := Audit(component, objs); err != nil {
+		return err
+	}
+	rbacObjs := Filter(objs)
+	if len(rbacObjs) == 0 {
+		return nil
+	}
+	manifest, err := podspec.Encode(rbacObjs)
+	if err != nil {
+		return err
+	}
+	return artifacts.Save(ArtifactName(component), manifest)
+}
+
+// ArtifactName returns the artifact used to save the RBAC for a component
+func ArtifactName(component string) string {
+	return "rbac/" + component + ".yaml"
+}
+
+func hasWildcard(field interface{}) bool {
+	values, _ := field.([]interface{})
+	for _, v := range values {
+		if v == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package rbac
+
+import (
+	"testing"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+)
+
+const testRbac = `
+kind: Role
+apiVersion: rbac.authorization.k8s.io/v1beta1
+metadata:
+  name: test
+  namespace: kube-system
+rules:
+- apiGroups: [""]
+  resources: ["secrets"]
+  verbs: ["get", "list"]
+---
+kind: RoleBinding
+apiVersion: rbac.authorization.k8s.io/v1beta1
+metadata:
+  name: test
+  namespace: kube-system
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: test
+subjects:
+- kind: ServiceAccount
+  name: test
+  namespace: kube-system
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+`
+
+func TestAudit(t *testing.T) {
+	objs, err := podspec.Decode(testRbac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Audit("test", objs); err != nil {
+		t.Errorf("didn't expect an error for minimal rbac but got %v", err)
+	}
+	if len(Filter(objs)) != 2 {
+		t.Errorf("expected the ConfigMap to be filtered out")
+	}
+
+	objs[1]["roleRef"].(map[string]interface{})["name"] = "cluster-admin"
+	if err := Audit("test", objs); err == nil {
+		t.Errorf("expected an error for a cluster-admin binding")
+	}
+}
+
+func TestAuditWildcard(t *testing.T) {
+	objs, err := podspec.Decode(`
+kind: ClusterRole
+apiVersion: rbac.authorization.k8s.io/v1beta1
+metadata:
+  name: test
+rules:
+- apiGroups: [""]
+  resources: ["*"]
+  verbs: ["get"]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Audit("test", objs); err == nil {
+		t.Errorf("expected an error for a wildcard resource")
+	}
+}
@@ -0,0 +1,60 @@
+package render
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/ghodss/yaml"
+)
+
+// Funcs are the functions available to all keto-k8 resource templates
+var Funcs = template.FuncMap{
+	"default": defaultValue,
+	"indent":  indent,
+	"toYaml":  toYaml,
+}
+
+// Template will render a resource template with data
+// Templates can use values e.g. {{ default "image:v1" .Values.image }}
+func Template(name, text string, data interface{}) (string, error) {
+	t, err := template.New(name).Funcs(Funcs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// defaultValue returns the value unless it's empty or missing
+func defaultValue(def interface{}, value interface{}) interface{} {
+	if value == nil {
+		return def
+	}
+	if s, ok := value.(string); ok && len(s) == 0 {
+		return def
+	}
+	return value
+}
+
+// indent will prefix every line with spaces
+func indent(spaces int, text string) string {
+	pad := strings.Repeat(" ", spaces)
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = pad + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// toYaml will render any value (e.g. a nested map of values) as yaml
+func toYaml(value interface{}) (string, error) {
+	b, err := yaml.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
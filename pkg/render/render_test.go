@@ -0,0 +1,38 @@
+package render
+
+import (
+	"testing"
+)
+
+const testTemplate = `image: {{ default "test:v1" .Values.image }}
+nodeSelector:
+{{ toYaml .Values.nodeSelector | indent 2 }}`
+
+func TestTemplate(t *testing.T) {
+	out, err := Template("test", testTemplate, struct {
+		Values map[string]interface{}
+	}{
+		Values: map[string]interface{}{
+			"nodeSelector": map[string]interface{}{"pool": "infra"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "image: test:v1\nnodeSelector:\n  pool: infra"
+	if out != expected {
+		t.Errorf("expected %q but got %q", expected, out)
+	}
+
+	out, err = Template("test", `image: {{ default "test:v1" .Values.image }}`, struct {
+		Values map[string]interface{}
+	}{
+		Values: map[string]interface{}{"image": "test:v2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "image: test:v2" {
+		t.Errorf("expected the image value to be used but got %q", out)
+	}
+}
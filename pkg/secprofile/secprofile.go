@@ -0,0 +1,88 @@
+package secprofile
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+	"k8s.io/kubernetes/pkg/util/version"
+)
+
+const (
+	// SeccompPodAnnotation sets the seccomp profile for all containers in a pod (before the field existed)
+	SeccompPodAnnotation = "seccomp.security.alpha.kubernetes.io/pod"
+
+	// AppArmorAnnotationPrefix sets the AppArmor profile for a container
+	AppArmorAnnotationPrefix = "container.apparmor.security.beta.kubernetes.io/"
+
+	// RuntimeDefault is the container runtime default profile
+	RuntimeDefault = "runtime/default"
+
+	// dockerDefault is the name of the default profile before runtime/default
+	dockerDefault = "docker/default"
+
+	appArmorEnabledFile = "/sys/module/apparmor/parameters/enabled"
+)
+
+var (
+	// First version with the runtime/default seccomp profile name
+	minRuntimeDefaultVersion = version.MustParseGeneric("v1.11.0")
+	// First version with the seccompProfile security context field
+	minSeccompFieldVersion = version.MustParseGeneric("v1.19.0")
+)
+
+// Enabled controls if default profiles are added (can be disabled by flags for debugging)
+var Enabled = true
+
+// AppArmorAvailable is true when this host supports AppArmor
+func AppArmorAvailable() bool {
+	enabled, err := ioutil.ReadFile(appArmorEnabledFile)
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(enabled)) == "Y"
+}
+
+// Mutator returns a podspec.Mutator adding the runtime default seccomp (and AppArmor where available) profiles
+// Any profiles already set are left unchanged
+func Mutator(kubeVersion string) podspec.Mutator {
+	v, err := version.ParseGeneric(kubeVersion)
+	appArmor := AppArmorAvailable()
+	return func(o podspec.Object) error {
+		if !Enabled || !o.HasPodSpec() {
+			return nil
+		}
+		switch {
+		case err == nil && v.AtLeast(minSeccompFieldVersion):
+			securityContext, _ := o.PodSpec()["securityContext"].(map[string]interface{})
+			if securityContext == nil {
+				securityContext = map[string]interface{}{}
+				o.SetPodSpecField("securityContext", securityContext)
+			}
+			if _, ok := securityContext["seccompProfile"]; !ok {
+				securityContext["seccompProfile"] = map[string]interface{}{"type": "RuntimeDefault"}
+			}
+		case err == nil && v.AtLeast(minRuntimeDefaultVersion):
+			setDefaultAnnotation(o, SeccompPodAnnotation, RuntimeDefault)
+		default:
+			setDefaultAnnotation(o, SeccompPodAnnotation, dockerDefault)
+		}
+		if appArmor {
+			for _, c := range o.Containers() {
+				if name, ok := c["name"].(string); ok {
+					setDefaultAnnotation(o, AppArmorAnnotationPrefix+name, RuntimeDefault)
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// setDefaultAnnotation will set a pod annotation unless already present
+func setDefaultAnnotation(o podspec.Object, key, value string) {
+	annotations, _ := o.PodMetadata()["annotations"].(map[string]interface{})
+	if _, ok := annotations[key]; ok {
+		return
+	}
+	o.SetPodAnnotation(key, value)
+}
@@ -0,0 +1,68 @@
+package secprofile
+
+import (
+	"testing"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+)
+
+const testPod = `apiVersion: v1
+kind: Pod
+metadata:
+  name: test
+spec:
+  containers:
+  - name: test
+    image: test:v0.0.1
+`
+
+func decodePod(t *testing.T, doc string) podspec.Object {
+	objs, err := podspec.Decode(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return objs[0]
+}
+
+func TestMutatorAnnotation(t *testing.T) {
+	for kubeVersion, profile := range map[string]string{"v1.7.5": "docker/default", "v1.12.0": RuntimeDefault} {
+		pod := decodePod(t, testPod)
+		if err := Mutator(kubeVersion)(pod); err != nil {
+			t.Fatal(err)
+		}
+		annotations, _ := pod.PodMetadata()["annotations"].(map[string]interface{})
+		if annotations[SeccompPodAnnotation] != profile {
+			t.Errorf("expected seccomp profile %s for %s but got %v", profile, kubeVersion, annotations)
+		}
+	}
+}
+
+func TestMutatorField(t *testing.T) {
+	pod := decodePod(t, testPod)
+	if err := Mutator("v1.19.0")(pod); err != nil {
+		t.Fatal(err)
+	}
+	securityContext, _ := pod.PodSpec()["securityContext"].(map[string]interface{})
+	if _, ok := securityContext["seccompProfile"]; !ok {
+		t.Errorf("expected the seccompProfile field to be set but got %v", pod.PodSpec())
+	}
+}
+
+func TestMutatorExisting(t *testing.T) {
+	pod := decodePod(t, testPod)
+	pod.SetPodAnnotation(SeccompPodAnnotation, "unconfined")
+	Mutator("v1.12.0")(pod)
+	if pod.PodMetadata()["annotations"].(map[string]interface{})[SeccompPodAnnotation] != "unconfined" {
+		t.Errorf("expected an existing profile to be left unchanged")
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	Enabled = false
+	defer func() { Enabled = true }()
+	pod := decodePod(t, testPod)
+	Mutator("v1.12.0")(pod)
+	if _, ok := pod.PodMetadata()["annotations"]; ok {
+		t.Errorf("didn't expect annotations when disabled")
+	}
+}
@@ -0,0 +1,111 @@
+package selinux
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/UKHomeOffice/keto-k8/pkg/tracing"
+)
+
+const (
+	// DefaultFileType is the type containers (e.g. static pods) can read (svirt_sandbox_file_t on older policies)
+	DefaultFileType = "container_file_t"
+
+	enforceFile = "/sys/fs/selinux/enforce"
+	cmdChcon    = "chcon"
+)
+
+// FileType is the SELinux type used to label files (can be changed by flags)
+var FileType = DefaultFileType
+
+// Paths are the directories keto-k8 writes to which the kubelet and static pods must read
+var Paths = []string{
+	"/etc/kubernetes",
+	"/var/lib/kubelet",
+}
+
+var (
+	// enforcing returns true when SELinux is enabled and enforcing (replaced in tests)
+	enforcing = func() bool {
+		enforce, err := ioutil.ReadFile(enforceFile)
+		if err != nil {
+			return false
+		}
+		return strings.TrimSpace(string(enforce)) == "1"
+	}
+	// chcon sets the file type on everything under a path, returning the command output (replaced in tests)
+	chcon = func(fileType, path string) ([]byte, error) {
+		span := tracing.Start(cmdChcon)
+		span.SetTag("args", path)
+		out, err := exec.Command(cmdChcon, "-R", "-t", fileType, path).CombinedOutput()
+		tracing.End(span, err)
+		return out, err
+	}
+)
+
+// Enforcing is true when SELinux is enabled and enforcing
+func Enforcing() bool {
+	return enforcing()
+}
+
+// Relabel will set the file type on all files under the paths (when SELinux is enforcing)
+// Paths which don't exist (yet) are skipped and linked paths (e.g. to a state volume) are labelled at their target
+func Relabel(paths ...string) error {
+	if !Enforcing() {
+		return nil
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		if target, err := filepath.EvalSymlinks(path); err == nil {
+			path = target
+		}
+		log.Debugf("Labelling %s with SELinux type %s", path, FileType)
+		if out, err := chcon(FileType, path); err != nil {
+			return fmt.Errorf("failed to set SELinux type %s on %s [%v]: %s", FileType, path, err, out)
+		}
+		// chcon -R doesn't follow the links in the tree (e.g. the CA key), so the static pods can read their targets
+		targets, err := linkTargets(path)
+		if err != nil {
+			return err
+		}
+		for _, target := range targets {
+			log.Debugf("Labelling the link target %s with SELinux type %s", target, FileType)
+			if out, err := chcon(FileType, target); err != nil {
+				return fmt.Errorf("failed to set SELinux type %s on %s [%v]: %s", FileType, target, err, out)
+			}
+		}
+	}
+	return nil
+}
+
+// linkTargets returns the targets of the symlinks under a path which are outside it (broken links are skipped)
+func linkTargets(root string) ([]string, error) {
+	var targets []string
+	seen := map[string]bool{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return nil
+		}
+		target, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return nil
+		}
+		if target == root || strings.HasPrefix(target, root+string(filepath.Separator)) || seen[target] {
+			return nil
+		}
+		seen[target] = true
+		targets = append(targets, target)
+		return nil
+	})
+	return targets, err
+}
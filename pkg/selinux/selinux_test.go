@@ -0,0 +1,90 @@
+package selinux
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRelabel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "selinux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(e func() bool, c func(string, string) ([]byte, error)) { enforcing, chcon = e, c }(enforcing, chcon)
+	kubernetes := filepath.Join(dir, "kubernetes")
+	state := filepath.Join(dir, "state")
+	linked := filepath.Join(dir, "kubelet")
+	for _, d := range []string{kubernetes, state} {
+		if err = os.Mkdir(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = os.Symlink(state, linked); err != nil {
+		t.Fatal(err)
+	}
+	var labelled []string
+	chcon = func(fileType, path string) ([]byte, error) {
+		labelled = append(labelled, fileType+":"+path)
+		return nil, nil
+	}
+
+	// Nothing is labelled unless SELinux is enforcing
+	enforcing = func() bool { return false }
+	if err = Relabel(kubernetes); err != nil || len(labelled) != 0 {
+		t.Fatalf("expected nothing labelled when not enforcing but got %v [%v]", labelled, err)
+	}
+
+	// Missing paths are skipped and linked paths are labelled at their target
+	enforcing = func() bool { return true }
+	if err = Relabel(kubernetes, filepath.Join(dir, "missing"), linked); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{DefaultFileType + ":" + kubernetes, DefaultFileType + ":" + state}
+	if !reflect.DeepEqual(labelled, expected) {
+		t.Errorf("expected %v labelled but got %v", expected, labelled)
+	}
+
+	// A symlinked key in the tree is labelled at its target (chcon -R doesn't follow it)
+	persistent := filepath.Join(dir, "persistent")
+	if err = os.Mkdir(persistent, 0700); err != nil {
+		t.Fatal(err)
+	}
+	key := filepath.Join(persistent, "ca.key")
+	if err = ioutil.WriteFile(key, []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	pki := filepath.Join(kubernetes, "pki")
+	if err = os.Mkdir(pki, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{
+		"ca.key":     key,
+		"broken.key": filepath.Join(dir, "missing.key"),
+		"local.crt":  filepath.Join(pki, "ca.key"),
+	} {
+		if err = os.Symlink(target, filepath.Join(pki, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	labelled = nil
+	if err = Relabel(kubernetes); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{DefaultFileType + ":" + kubernetes, DefaultFileType + ":" + key}
+	if !reflect.DeepEqual(labelled, expected) {
+		t.Errorf("expected %v labelled but got %v", expected, labelled)
+	}
+
+	chcon = func(string, string) ([]byte, error) {
+		return []byte("chcon: Operation not supported"), errors.New("exit status 1")
+	}
+	if err = Relabel(kubernetes); err == nil || !strings.Contains(err.Error(), "Operation not supported") {
+		t.Errorf("expected the chcon output in the error but got %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package statedir
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/command"
+	"github.com/UKHomeOffice/keto-k8/pkg/logging"
+)
+
+// DefaultPaths are the directories written to which may be on a read-only root filesystem
+var DefaultPaths = []string{
+	"/etc/kubernetes",
+	"/var/lib/keto-k8",
+}
+
+var (
+	// Dir is a writable state volume (empty to write to the paths in place)
+	Dir string
+	// Paths are the directories kept in the state volume (each is linked to Dir/<path>)
+	Paths = DefaultPaths
+
+	logger = logging.New("statedir")
+
+	// bindMount mounts a directory on another (replaced by tests)
+	bindMount = func(source, target string) error {
+		_, err := command.Run(logger, "", "mount", "--bind", source, target)
+		return err
+	}
+)
+
+// Path returns where a path is kept in the state volume (the path itself without a state volume)
+func Path(path string) string {
+	if len(Dir) == 0 {
+		return path
+	}
+	return filepath.Join(Dir, path)
+}
+
+// Link will make each of the paths resolve to its directory in the state volume so the kubelet, kubeadm and the
+// static pods can still use the expected locations. A missing path is symlinked and an existing empty directory
+// (e.g. a mount point on a read-only root) is bind mounted. Nothing is done without a state volume.
+func Link() error {
+	if len(Dir) == 0 {
+		return nil
+	}
+	for _, path := range Paths {
+		if err := link(path); err != nil {
+			return fmt.Errorf("failed to link %s to the state dir %s [%v]", path, Dir, err)
+		}
+	}
+	return nil
+}
+
+// link will symlink or bind mount a path to its directory in the state volume (unless already done)
+func link(path string) error {
+	state := Path(path)
+	if err := os.MkdirAll(state, 0755); err != nil {
+		return err
+	}
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		logger.Printf("Linking %s to %s", path, state)
+		return os.Symlink(state, path)
+	} else if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		if target, _ := os.Readlink(path); target != state {
+			return fmt.Errorf("%s is already a link to %s", path, target)
+		}
+		return nil
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s isn't a directory", path)
+	}
+	stateInfo, err := os.Stat(state)
+	if err != nil {
+		return err
+	}
+	if os.SameFile(info, stateInfo) {
+		// Already mounted
+		return nil
+	}
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	if len(files) > 0 {
+		return fmt.Errorf("%s already has files (move them to %s first)", path, state)
+	}
+	logger.Printf("Bind mounting %s on %s", state, path)
+	return bindMount(state, path)
+}
@@ -0,0 +1,69 @@
+package statedir
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statedir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(stateDir string, paths []string, mount func(string, string) error) {
+		Dir = stateDir
+		Paths = paths
+		bindMount = mount
+	}(Dir, Paths, bindMount)
+	var mounted []string
+	bindMount = func(source, target string) error {
+		mounted = append(mounted, target)
+		return nil
+	}
+
+	// Nothing to do without a state volume
+	missing := filepath.Join(dir, "root", "etc", "kubernetes")
+	mountPoint := filepath.Join(dir, "root", "var", "lib", "keto-k8")
+	Dir = ""
+	Paths = []string{missing, mountPoint}
+	if err = Link(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Lstat(missing); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be linked [%v]", err)
+	}
+
+	Dir = filepath.Join(dir, "state")
+	if err = os.MkdirAll(mountPoint, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for run := 0; run < 2; run++ {
+		if err = Link(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if target, _ := os.Readlink(missing); target != Path(missing) {
+		t.Errorf("expected %s to be linked to %s but got %q", missing, Path(missing), target)
+	}
+	if err = ioutil.WriteFile(filepath.Join(missing, "admin.conf"), []byte("config"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(Path(missing), "admin.conf")); err != nil {
+		t.Errorf("expected files to be written to the state dir [%v]", err)
+	}
+	// The empty directory is mounted on each run (the mount is faked)
+	if len(mounted) != 2 || mounted[0] != mountPoint {
+		t.Errorf("expected %s to be bind mounted but got %v", mountPoint, mounted)
+	}
+
+	// Existing files aren't hidden
+	if err = ioutil.WriteFile(filepath.Join(mountPoint, "file"), []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = Link(); err == nil {
+		t.Error("expected an error for a directory with files")
+	}
+}
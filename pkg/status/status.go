@@ -0,0 +1,88 @@
+package status
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/logging"
+)
+
+var logger = logging.New("status")
+
+// Server is the optional http server for the status of a long running kmm process
+type Server struct {
+	// Address to listen on e.g. 127.0.0.1:10260
+	Address string
+	// Pprof will add the pprof and runtime (expvar) endpoints under /debug/
+	Pprof bool
+	// Status returns the bootstrap state served as json on /status (for the keto CLI), not served when nil
+	Status func() interface{}
+
+	listener net.Listener
+}
+
+// Handler returns the status endpoints
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	})
+	if s.Status != nil {
+		mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(s.Status()); err != nil {
+				logger.Warnf("error encoding status: %v", err)
+			}
+		})
+	}
+	if s.Pprof {
+		// Only registered when asked for as profiles expose internals (and can be expensive)
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		mux.Handle("/debug/vars", expvar.Handler())
+	}
+	return mux
+}
+
+// Start will listen on the address and serve the status endpoints in the background
+// Nothing is started when the address isn't set
+func (s *Server) Start() (err error) {
+	if s.Address == "" {
+		return nil
+	}
+	if s.listener, err = net.Listen("tcp", s.Address); err != nil {
+		return fmt.Errorf("error starting status server on %s: %v", s.Address, err)
+	}
+	logger.Printf("Serving status on %s (pprof %t)", s.listener.Addr(), s.Pprof)
+	go func(l net.Listener) {
+		if err := http.Serve(l, s.Handler()); err != nil {
+			logger.Debugf("status server stopped: %v", err)
+		}
+	}(s.listener)
+	return nil
+}
+
+// Addr returns the address being listened on (nil when not started)
+func (s *Server) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Stop will stop serving
+func (s *Server) Stop() error {
+	if s.listener == nil {
+		return nil
+	}
+	err := s.listener.Close()
+	s.listener = nil
+	return err
+}
@@ -0,0 +1,80 @@
+package status
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	for _, pprofEnabled := range []bool{false, true} {
+		s := &Server{Address: "127.0.0.1:0", Pprof: pprofEnabled}
+		if err := s.Start(); err != nil {
+			t.Fatal(err)
+		}
+		base := "http://" + s.Addr().String()
+
+		resp, err := http.Get(base + "/healthz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "ok" {
+			t.Errorf("unexpected healthz %q", body)
+		}
+
+		for _, path := range []string{"/debug/pprof/goroutine?debug=1", "/debug/vars"} {
+			resp, err = http.Get(base + path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if pprofEnabled != (resp.StatusCode == http.StatusOK) {
+				t.Errorf("unexpected status %d for %s with pprof %t", resp.StatusCode, path, pprofEnabled)
+			}
+		}
+		if err = s.Stop(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestServerStatus(t *testing.T) {
+	s := &Server{Address: "127.0.0.1:0"}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get("http://" + s.Addr().String() + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	s.Stop()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected no status endpoint without a status func but got %d", resp.StatusCode)
+	}
+
+	s.Status = func() interface{} { return map[string]string{"state": "ready"} }
+	if err = s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	resp, err = http.Get("http://" + s.Addr().String() + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if strings.TrimSpace(string(body)) != `{"state":"ready"}` || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected status %q", body)
+	}
+}
+
+func TestServerDisabled(t *testing.T) {
+	s := &Server{}
+	if err := s.Start(); err != nil || s.Addr() != nil {
+		t.Errorf("expected nothing to be started but got %v, %v", s.Addr(), err)
+	}
+}
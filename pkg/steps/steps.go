@@ -0,0 +1,87 @@
+package steps
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/profile"
+)
+
+// Step is a unit of work which only starts once the steps it depends on have succeeded
+type Step struct {
+	Name string
+	// DependsOn are the names of earlier steps which must succeed first
+	DependsOn []string
+	Run       func() error
+}
+
+type result struct {
+	index int
+	err   error
+}
+
+// Run will run the steps with at most parallelism steps running at once (less than 1 is the same as 1)
+// Steps are started in the order given once their dependencies have succeeded so a parallelism of 1 runs them in
+// order. After an error no more steps are started and the first error is returned once the running steps finish.
+func Run(parallelism int, steps ...Step) error {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	// Only allowing dependencies on earlier steps means there can't be a cycle
+	index := map[string]int{}
+	for i, s := range steps {
+		if _, duplicate := index[s.Name]; duplicate {
+			return fmt.Errorf("duplicate step %q", s.Name)
+		}
+		for _, d := range s.DependsOn {
+			if _, ok := index[d]; !ok {
+				return fmt.Errorf("step %q depends on %q which isn't an earlier step", s.Name, d)
+			}
+		}
+		index[s.Name] = i
+	}
+
+	started := make([]bool, len(steps))
+	succeeded := make([]bool, len(steps))
+	results := make(chan result)
+	running := 0
+	var err error
+	for {
+		for i := 0; err == nil && running < parallelism && i < len(steps); i++ {
+			if started[i] || !ready(steps[i], index, succeeded) {
+				continue
+			}
+			started[i] = true
+			running++
+			go func(i int) {
+				started := time.Now()
+				err := steps[i].Run()
+				profile.Record("step "+steps[i].Name, time.Since(started), 0)
+				results <- result{index: i, err: err}
+			}(i)
+		}
+		if running == 0 {
+			break
+		}
+		r := <-results
+		running--
+		if r.err != nil {
+			if err == nil {
+				err = r.err
+			}
+			continue
+		}
+		succeeded[r.index] = true
+	}
+	return err
+}
+
+// ready is true when all the dependencies of a step have succeeded
+func ready(s Step, index map[string]int, succeeded []bool) bool {
+	for _, d := range s.DependsOn {
+		if !succeeded[index[d]] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package steps
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder keeps the order steps ran in and the most running at once
+type recorder struct {
+	mu         sync.Mutex
+	order      []string
+	running    int
+	maxRunning int
+}
+
+func (r *recorder) step(name string, err error, dependsOn ...string) Step {
+	return Step{
+		Name:      name,
+		DependsOn: dependsOn,
+		Run: func() error {
+			r.mu.Lock()
+			r.order = append(r.order, name)
+			r.running++
+			if r.running > r.maxRunning {
+				r.maxRunning = r.running
+			}
+			r.mu.Unlock()
+			// Failures are quicker so steps which don't depend on them are still running
+			if err == nil {
+				time.Sleep(10 * time.Millisecond)
+			}
+			r.mu.Lock()
+			r.running--
+			r.mu.Unlock()
+			return err
+		},
+	}
+}
+
+// sorted returns the names of steps run from start to end (sorted as running steps can start in any order)
+func (r *recorder) sorted(start, end int) string {
+	names := append([]string{}, r.order[start:end]...)
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func TestRunInOrder(t *testing.T) {
+	r := &recorder{}
+	if err := Run(0, r.step("a", nil), r.step("b", nil), r.step("c", nil, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(r.order, ",") != "a,b,c" || r.maxRunning != 1 {
+		t.Errorf("expected the steps to run in order one at a time but got %v (max %d)", r.order, r.maxRunning)
+	}
+}
+
+func TestRunParallel(t *testing.T) {
+	r := &recorder{}
+	if err := Run(2, r.step("a", nil), r.step("b", nil), r.step("c", nil), r.step("d", nil, "a", "b")); err != nil {
+		t.Fatal(err)
+	}
+	if r.maxRunning != 2 {
+		t.Errorf("expected two steps at once but got %d", r.maxRunning)
+	}
+	// c can start before d but a and b are always first
+	if first := r.sorted(0, 2); first != "a,b" {
+		t.Errorf("expected d to wait for a and b but got %v", r.order)
+	}
+}
+
+func TestRunError(t *testing.T) {
+	r := &recorder{}
+	failed := errors.New("failed")
+	err := Run(2, r.step("a", failed), r.step("b", nil), r.step("c", nil, "a"), r.step("d", nil, "b"))
+	if err != failed {
+		t.Errorf("expected the step error but got %v", err)
+	}
+	if len(r.order) != 2 || r.sorted(0, 2) != "a,b" {
+		t.Errorf("expected no steps to start after the error but got %v", r.order)
+	}
+}
+
+func TestRunInvalid(t *testing.T) {
+	r := &recorder{}
+	if err := Run(1, r.step("a", nil, "b"), r.step("b", nil)); err == nil {
+		t.Error("expected an error for a dependency on a later step")
+	}
+	if err := Run(1, r.step("a", nil), r.step("a", nil)); err == nil {
+		t.Error("expected an error for a duplicate step")
+	}
+	if len(r.order) != 0 {
+		t.Errorf("expected no steps to run but got %v", r.order)
+	}
+}
@@ -0,0 +1,120 @@
+package summary
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/failure"
+)
+
+// ArtifactName is the summary file saved in the artifacts directory
+const ArtifactName = "bootstrap-summary.json"
+
+// Phase is a bootstrap phase run
+type Phase struct {
+	Name     string    `json:"name"`
+	Started  time.Time `json:"started"`
+	Duration string    `json:"duration"`
+	Error    string    `json:"error,omitempty"`
+	Hint     string    `json:"hint,omitempty"`
+}
+
+// Summary is the machine readable record of a bootstrap
+type Summary struct {
+	Role          string    `json:"role"`
+	Node          string    `json:"node,omitempty"`
+	Cluster       string    `json:"cluster,omitempty"`
+	KubeVersion   string    `json:"kubeVersion,omitempty"`
+	KetoK8Version string    `json:"ketoK8Version,omitempty"`
+	Assets        string    `json:"assets,omitempty"`
+	CACertHashes  []string  `json:"caCertHashes,omitempty"`
+	Started       time.Time `json:"started"`
+	Finished      time.Time `json:"finished"`
+	Duration      string    `json:"duration"`
+	Success       bool      `json:"success"`
+	Phases        []Phase   `json:"phases"`
+	Errors        []string  `json:"errors,omitempty"`
+}
+
+// Assets values
+const (
+	AssetsCreated = "created"
+	AssetsReused  = "reused"
+)
+
+var (
+	mu      sync.Mutex
+	current = &Summary{}
+	now     = time.Now
+)
+
+// Start will reset the summary for a new bootstrap e.g. as a "master" or "compute"
+func Start(role string) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = &Summary{
+		Role:    role,
+		Started: now(),
+		Phases:  []Phase{},
+	}
+}
+
+// StartPhase will end the current phase and start another
+func StartPhase(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	endPhase()
+	current.Phases = append(current.Phases, Phase{Name: name, Started: now()})
+}
+
+// Update will change the summary details e.g. once versions are known
+func Update(update func(s *Summary)) {
+	mu.Lock()
+	defer mu.Unlock()
+	update(current)
+}
+
+// Current returns a copy of the summary so far
+func Current() Summary {
+	mu.Lock()
+	defer mu.Unlock()
+	s := *current
+	s.Phases = append([]Phase{}, current.Phases...)
+	s.Errors = append([]string(nil), current.Errors...)
+	return s
+}
+
+// Finish will complete the summary, recording any error (and its remediation hint) against the current phase
+func Finish(err error) Summary {
+	mu.Lock()
+	defer mu.Unlock()
+	if err != nil {
+		if last := len(current.Phases) - 1; last >= 0 {
+			current.Phases[last].Error = err.Error()
+			current.Phases[last].Hint = failure.Hint(err)
+		}
+		current.Errors = append(current.Errors, err.Error())
+	}
+	endPhase()
+	current.Finished = now()
+	current.Duration = current.Finished.Sub(current.Started).String()
+	current.Success = err == nil
+	return *current
+}
+
+// JSON returns the indented summary
+func (s Summary) JSON() (string, error) {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// endPhase will set the duration of the last phase (if still running)
+func endPhase() {
+	if last := len(current.Phases) - 1; last >= 0 && current.Phases[last].Duration == "" {
+		current.Phases[last].Duration = now().Sub(current.Phases[last].Started).String()
+	}
+}
@@ -0,0 +1,47 @@
+package summary
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/failure"
+)
+
+func TestSummary(t *testing.T) {
+	clock := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+	defer func() { now = time.Now }()
+
+	Start("master")
+	StartPhase("prepare")
+	StartPhase("primary")
+	Update(func(s *Summary) {
+		s.Assets = AssetsCreated
+	})
+	s := Finish(failure.Wrap(errors.New("exit status 1"), "kubeadm failed", "check the kubeadm output"))
+
+	if s.Success {
+		t.Error("expected a failed summary")
+	}
+	if len(s.Phases) != 2 || s.Phases[0].Duration != "1s" || s.Phases[1].Error != "kubeadm failed [exit status 1]" {
+		t.Errorf("unexpected phases %+v", s.Phases)
+	}
+	if s.Phases[1].Hint != "check the kubeadm output" {
+		t.Errorf("expected the hint recorded against the failed phase but got %q", s.Phases[1].Hint)
+	}
+	if s.Duration != "5s" || s.Assets != AssetsCreated {
+		t.Errorf("unexpected summary %+v", s)
+	}
+	out, err := s.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, `"role": "master"`) {
+		t.Errorf("expected the role in the json:\n%s", out)
+	}
+}
@@ -0,0 +1,108 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Config is the minimum TLS version and allowed cipher suites for the control plane
+// Empty values leave the component defaults
+type Config struct {
+	// MinVersion e.g. VersionTLS12
+	MinVersion string
+	// CipherSuites are the go / kubernetes names e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+	CipherSuites []string
+}
+
+// versions are the supported minimum versions (as named by the kubernetes flags)
+var versions = map[string]uint16{
+	"VersionTLS10": tls.VersionTLS10,
+	"VersionTLS11": tls.VersionTLS11,
+	"VersionTLS12": tls.VersionTLS12,
+}
+
+// cipherSuites are the supported ciphers (as named by the kubernetes flags)
+var cipherSuites = map[string]uint16{
+	"TLS_RSA_WITH_RC4_128_SHA":                tls.TLS_RSA_WITH_RC4_128_SHA,
+	"TLS_RSA_WITH_3DES_EDE_CBC_SHA":           tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+	"TLS_RSA_WITH_AES_128_CBC_SHA":            tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_RSA_WITH_AES_256_CBC_SHA":            tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_RSA_WITH_AES_128_CBC_SHA256":         tls.TLS_RSA_WITH_AES_128_CBC_SHA256,
+	"TLS_RSA_WITH_AES_128_GCM_SHA256":         tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_RSA_WITH_AES_256_GCM_SHA384":         tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_RC4_128_SHA":        tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_RC4_128_SHA":          tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA,
+	"TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA":     tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA":      tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA":      tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":   tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384": tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305":    tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305":  tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+}
+
+// Validate checks the version and cipher suite names are known
+func (c Config) Validate() error {
+	if _, ok := versions[c.MinVersion]; len(c.MinVersion) > 0 && !ok {
+		return fmt.Errorf("invalid TLS min version %q, must be one of: %s", c.MinVersion, names(versions))
+	}
+	for _, cipher := range c.CipherSuites {
+		if _, ok := cipherSuites[cipher]; !ok {
+			return fmt.Errorf("invalid TLS cipher suite %q, must be one of: %s", cipher, names(cipherSuites))
+		}
+	}
+	return nil
+}
+
+// Args returns the flags for the apiserver and kubelet (which share the same names)
+func (c Config) Args() map[string]string {
+	args := map[string]string{}
+	if len(c.MinVersion) > 0 {
+		args["tls-min-version"] = c.MinVersion
+	}
+	if len(c.CipherSuites) > 0 {
+		args["tls-cipher-suites"] = strings.Join(c.CipherSuites, ",")
+	}
+	return args
+}
+
+// ArgsString returns the flags as a command line e.g. for the kubelet unit
+func (c Config) ArgsString() string {
+	var flags []string
+	for k, v := range c.Args() {
+		flags = append(flags, "--"+k+"="+v)
+	}
+	sort.Strings(flags)
+	return strings.Join(flags, " ")
+}
+
+// Apply will restrict a go TLS config e.g. for the etcd client
+func (c Config) Apply(t *tls.Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if len(c.MinVersion) > 0 {
+		t.MinVersion = versions[c.MinVersion]
+	}
+	for _, cipher := range c.CipherSuites {
+		t.CipherSuites = append(t.CipherSuites, cipherSuites[cipher])
+	}
+	return nil
+}
+
+func names(m map[string]uint16) string {
+	var n []string
+	for k := range m {
+		n = append(n, k)
+	}
+	sort.Strings(n)
+	return strings.Join(n, ", ")
+}
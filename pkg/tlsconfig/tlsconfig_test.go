@@ -0,0 +1,32 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	if err := (Config{}).Validate(); err != nil {
+		t.Errorf("expected an empty config to be valid but got %v", err)
+	}
+	if err := (Config{MinVersion: "TLS1.2"}).Validate(); err == nil {
+		t.Errorf("expected an error for an invalid version")
+	}
+	if err := (Config{CipherSuites: []string{"TLS_FAKE"}}).Validate(); err == nil {
+		t.Errorf("expected an error for an invalid cipher")
+	}
+}
+
+func TestApply(t *testing.T) {
+	c := Config{MinVersion: "VersionTLS12", CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}}
+	tlsConfig := &tls.Config{}
+	if err := c.Apply(tlsConfig); err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig.MinVersion != tls.VersionTLS12 || len(tlsConfig.CipherSuites) != 1 {
+		t.Errorf("unexpected tls config %v", tlsConfig)
+	}
+	if c.ArgsString() != "--tls-cipher-suites=TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 --tls-min-version=VersionTLS12" {
+		t.Errorf("unexpected args %s", c.ArgsString())
+	}
+}
@@ -3,8 +3,9 @@ package tokens
 import (
 	"io/ioutil"
 
-	kubeadmconstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
 	"github.com/UKHomeOffice/keto-k8/pkg/constants"
+	"github.com/UKHomeOffice/keto-k8/pkg/fileutil"
+	kubeadmconstants "github.com/UKHomeOffice/keto-k8/pkg/kubeadm/constants"
 )
 
 // WriteKetoTokenEnv will write details needed by keto-tokens
@@ -16,7 +17,11 @@ func WriteKetoTokenEnv(cloud, apiURL string) (error) {
 	                   "KETO_TOKENS_KUBELET_CONF=" + kubeadmconstants.KubernetesDir + "/bootstrap-kubelet.conf" + "\n" +
 	                   "KETO_TOKENS_API_URL=" + apiURL + "\n"
 
-	if err := ioutil.WriteFile(constants.KetoTokenEnvName, []byte(envFileContents), 0644); err != nil {
+	// Unchanged on a re-run (e.g. every boot) so the kubelet isn't restarted for nothing
+	if current, err := ioutil.ReadFile(constants.KetoTokenEnvName); err == nil && string(current) == envFileContents {
+		return nil
+	}
+	if err := fileutil.WriteFile(constants.KetoTokenEnvName, []byte(envFileContents), 0644); err != nil {
 		return err
 	}
 	return nil
@@ -1,36 +1,75 @@
 package tokens
 
 import (
-	"bytes"
-	"text/template"
-
 	"github.com/UKHomeOffice/keto-k8/pkg/constants"
 	"github.com/UKHomeOffice/keto-k8/pkg/k8client"
+	"github.com/UKHomeOffice/keto-k8/pkg/placement"
+	"github.com/UKHomeOffice/keto-k8/pkg/podspec"
+	"github.com/UKHomeOffice/keto-k8/pkg/priority"
+	"github.com/UKHomeOffice/keto-k8/pkg/rbac"
+	"github.com/UKHomeOffice/keto-k8/pkg/secprofile"
+	"github.com/UKHomeOffice/keto-k8/pkg/render"
 )
 
-// Deploy creates keto-tokens k8 resources
-func Deploy(clusterName string) (error) {
-	k8Definition, err := getDeployment(clusterName)
+// AddonName is the name used for the keto-tokens values in the config file
+const AddonName = "keto-tokens"
+
+// Deploy creates keto-tokens k8 resources (with the default kubectl client when nil)
+func Deploy(client k8client.Clienter, clusterName, kubeVersion string, values map[string]interface{}) (error) {
+	client = k8client.Or(client)
+	k8Definition, err := getDeployment(clusterName, values)
+	if err != nil {
+		return err
+	}
+	place, err := placement.For(values)
+	if err != nil {
+		return err
+	}
+	// Computes can't join without keto-tokens so it must not be evicted
+	k8Definition, err = podspec.Transform(k8Definition,
+		priority.Mutator(kubeVersion, priority.NodeCritical),
+		secprofile.Mutator(kubeVersion),
+		place.Mutator())
+	if err != nil {
+		return err
+	}
+	objs, err := podspec.Decode(k8Definition)
 	if err != nil {
 		return err
 	}
-	return k8client.Apply(k8Definition)
+	if err = rbac.Save(AddonName, objs); err != nil {
+		return err
+	}
+	if err = client.Apply(k8Definition); err != nil {
+		return err
+	}
+	// Secrets access was previously granted for all namespaces
+	for _, kind := range []string{"clusterrolebinding", "clusterrole"} {
+		if err = client.Delete(kind, AddonName, ""); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func getDeployment(clusterName string) (string, error) {
+func getDeployment(clusterName string, values map[string]interface{}) (string, error) {
 
 	data := struct {
 		ClusterName	string
 		ImageName string
+		Values		map[string]interface{}
 	}{
 		ClusterName:    clusterName,
 		ImageName:      constants.KetoTokenImage,
+		Values:         values,
 	}
 	const ketoTokensDeployment = `
-kind: ClusterRole
+# Bootstrap tokens are only ever secrets in kube-system
+kind: Role
 apiVersion: rbac.authorization.k8s.io/v1beta1
 metadata:
   name: keto-tokens
+  namespace: kube-system
 rules:
 - apiGroups: [""]
   resources: ["secrets"]
@@ -42,13 +81,14 @@ metadata:
   name: keto-tokens
   namespace: kube-system
 ---
-kind: ClusterRoleBinding
+kind: RoleBinding
 apiVersion: rbac.authorization.k8s.io/v1beta1
 metadata:
   name: keto-tokens
+  namespace: kube-system
 roleRef:
   apiGroup: rbac.authorization.k8s.io
-  kind: ClusterRole
+  kind: Role
   name: keto-tokens
 subjects:
 - kind: ServiceAccount
@@ -90,26 +130,24 @@ spec:
       serviceAccount: keto-tokens
       containers:
       - name: keto-tockens
-        image: {{ .ImageName }}
+        image: {{ default .ImageName .Values.image }}
         imagePullPolicy: Always
         resources:
+{{- if .Values.resources }}
+{{ toYaml .Values.resources | indent 10 }}
+{{- else }}
           limits:
             cpu: 100m
             memory: 128M
+{{- end }}
         args:
         - --cloud=aws
         - server
         - --tag-name=KubeletToken
         - --filter=stack-type=computepool
         - --filter=cluster-name={{ .ClusterName }}
-        - --token-ttl=20m
-        - --interval=10s
+        - --token-ttl={{ default "20m" .Values.tokenTTL }}
+        - --interval={{ default "10s" .Values.interval }}
 `
-	t := template.Must(template.New("ketoTokensDeploy").Parse(ketoTokensDeployment))
-	var b bytes.Buffer
-	if err := t.Execute(&b, data); err != nil {
-		return "", err
-	}
-
-	return b.String(), nil
+	return render.Template("ketoTokensDeploy", ketoTokensDeployment, data)
 }
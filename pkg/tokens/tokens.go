@@ -0,0 +1,37 @@
+package tokens
+
+import (
+	"github.com/UKHomeOffice/keto-k8/pkg/k8client"
+)
+
+// Interface allows for mocking out keto-tokens for testing
+type Interface interface {
+	// WriteEnv will write the env file keto-tokens needs on a node
+	WriteEnv(cloud, apiURL string) error
+	// Deploy will create the keto-tokens resources in the cluster
+	Deploy(client k8client.Clienter, clusterName, kubeVersion string, values map[string]interface{}) error
+}
+
+// Tokens is the real keto-tokens implementation
+type Tokens struct{}
+
+// verify the concrete implementation satisfies the abstract interface
+var _ Interface = Tokens{}
+
+// WriteEnv will write details needed by keto-tokens
+func (Tokens) WriteEnv(cloud, apiURL string) error {
+	return WriteKetoTokenEnv(cloud, apiURL)
+}
+
+// Deploy creates keto-tokens k8 resources
+func (Tokens) Deploy(client k8client.Clienter, clusterName, kubeVersion string, values map[string]interface{}) error {
+	return Deploy(client, clusterName, kubeVersion, values)
+}
+
+// Or returns the implementation unless nil when the real one is returned
+func Or(t Interface) Interface {
+	if t == nil {
+		return Tokens{}
+	}
+	return t
+}
@@ -0,0 +1,67 @@
+// Package tokenstest provides a tokens.Interface for testing the compute and master flows without keto-tokens
+package tokenstest
+
+import (
+	"sync"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/k8client"
+	"github.com/UKHomeOffice/keto-k8/pkg/tokens"
+)
+
+// Env is the details recorded by WriteEnv
+type Env struct {
+	Cloud  string
+	APIURL string
+}
+
+// Deployment is the details recorded by Deploy
+type Deployment struct {
+	ClusterName string
+	KubeVersion string
+	Values      map[string]interface{}
+}
+
+// Fake records every call (returning the errors set)
+type Fake struct {
+	// WriteEnvErr is returned from WriteEnv
+	WriteEnvErr error
+	// DeployErr is returned from Deploy
+	DeployErr error
+
+	mu          sync.Mutex
+	envs        []Env
+	deployments []Deployment
+}
+
+// Verify the fake satisfies the abstract interface
+var _ tokens.Interface = (*Fake)(nil)
+
+// WriteEnv records the env
+func (f *Fake) WriteEnv(cloud, apiURL string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.envs = append(f.envs, Env{Cloud: cloud, APIURL: apiURL})
+	return f.WriteEnvErr
+}
+
+// Deploy records the deployment (the client isn't used)
+func (f *Fake) Deploy(client k8client.Clienter, clusterName, kubeVersion string, values map[string]interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deployments = append(f.deployments, Deployment{ClusterName: clusterName, KubeVersion: kubeVersion, Values: values})
+	return f.DeployErr
+}
+
+// Envs returns the envs written (in order)
+func (f *Fake) Envs() []Env {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Env{}, f.envs...)
+}
+
+// Deployments returns the deployments (in order)
+func (f *Fake) Deployments() []Deployment {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Deployment{}, f.deployments...)
+}
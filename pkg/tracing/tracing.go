@@ -0,0 +1,127 @@
+package tracing
+
+import (
+	"io"
+	"sync"
+
+	"github.com/UKHomeOffice/keto-k8/pkg/logging"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	jaeger "github.com/uber/jaeger-client-go"
+	jaegercfg "github.com/uber/jaeger-client-go/config"
+)
+
+// ServiceName is the name all keto-k8 spans are reported under
+const ServiceName = "keto-k8"
+
+var (
+	mu     sync.Mutex
+	closer io.Closer
+	root   opentracing.Span
+	phase  opentracing.Span
+)
+
+// Init will report spans to a jaeger agent (host:port) and start the root span for a command
+// Tracing is a no-op when the agent isn't set
+func Init(agent, operation string) error {
+	if agent != "" {
+		cfg := jaegercfg.Configuration{
+			// Bootstraps are rare, always sample
+			Sampler: &jaegercfg.SamplerConfig{
+				Type:  jaeger.SamplerTypeConst,
+				Param: 1,
+			},
+			Reporter: &jaegercfg.ReporterConfig{
+				LocalAgentHostPort: agent,
+			},
+		}
+		tracer, c, err := cfg.New(ServiceName)
+		if err != nil {
+			return err
+		}
+		opentracing.SetGlobalTracer(tracer)
+		mu.Lock()
+		closer = c
+		mu.Unlock()
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	root = opentracing.StartSpan(operation)
+	return nil
+}
+
+// Phase will finish the current phase span and start a new one (also setting the log phase)
+func Phase(name string) {
+	logging.SetPhase(name)
+	mu.Lock()
+	defer mu.Unlock()
+	if phase != nil {
+		phase.Finish()
+	}
+	phase = startChild(root, name)
+}
+
+// Start will start a span for an operation in the current phase e.g. an etcd request or a subprocess
+func Start(operation string) opentracing.Span {
+	mu.Lock()
+	defer mu.Unlock()
+	if phase != nil {
+		return startChild(phase, operation)
+	}
+	return startChild(root, operation)
+}
+
+// Error will mark a span as failed (when err is set)
+func Error(span opentracing.Span, err error) {
+	if err == nil {
+		return
+	}
+	ext.Error.Set(span, true)
+	span.LogKV("event", "error", "message", err.Error())
+}
+
+// End will finish a span, marking it as failed when err is set
+func End(span opentracing.Span, err error) {
+	Error(span, err)
+	span.Finish()
+}
+
+// Finish will finish the current phase and the root span (e.g. once bootstrapped)
+func Finish() {
+	mu.Lock()
+	defer mu.Unlock()
+	if phase != nil {
+		phase.Finish()
+		phase = nil
+	}
+	if root != nil {
+		root.Finish()
+		root = nil
+	}
+}
+
+// Close will finish all spans and flush them to the agent
+func Close() error {
+	Finish()
+	mu.Lock()
+	defer mu.Unlock()
+	if closer == nil {
+		return nil
+	}
+	c := closer
+	closer = nil
+	return c.Close()
+}
+
+// startChild will start a span with the fields used for logging as tags
+func startChild(parent opentracing.Span, operation string) opentracing.Span {
+	opts := []opentracing.StartSpanOption{}
+	if parent != nil {
+		opts = append(opts, opentracing.ChildOf(parent.Context()))
+	}
+	span := opentracing.StartSpan(operation, opts...)
+	for k, v := range logging.Fields() {
+		span.SetTag(k, v)
+	}
+	return span
+}
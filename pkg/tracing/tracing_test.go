@@ -0,0 +1,46 @@
+package tracing
+
+import (
+	"errors"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestSpans(t *testing.T) {
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	if err := Init("", "master"); err != nil {
+		t.Fatal(err)
+	}
+	Phase("primary")
+	span := Start("kubeadm")
+	Error(span, errors.New("failed"))
+	span.Finish()
+	Phase("hardening")
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 4 {
+		t.Fatalf("expected 4 finished spans but got %d", len(spans))
+	}
+	byName := map[string]*mocktracer.MockSpan{}
+	for _, s := range spans {
+		byName[s.OperationName] = s
+	}
+	rootID := byName["master"].SpanContext.SpanID
+	if byName["primary"].ParentID != rootID || byName["hardening"].ParentID != rootID {
+		t.Errorf("expected phases to be children of the root span")
+	}
+	if byName["kubeadm"].ParentID != byName["primary"].SpanContext.SpanID {
+		t.Errorf("expected operation to be a child of the current phase")
+	}
+	if byName["kubeadm"].Tag("error") != true {
+		t.Errorf("expected the operation to be marked as an error")
+	}
+}